@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cr1cr1/farm-manager/internal/backup"
+	appdb "github.com/cr1cr1/farm-manager/internal/db"
+)
+
+const usage = `usage: farm-manager [command]
+
+With no command the web server runs. Commands:
+  backup            take a backup now and prune old ones
+  backups           list the stored backups, oldest first
+  restore [name]    restore a backup (default: the newest); stop the server first`
+
+// runCommand runs one of the maintenance commands instead of the server.
+func runCommand(ctx context.Context, args []string) error {
+	cfg, err := backup.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "backup":
+		db, err := appdb.Open(ctx)
+		if err != nil {
+			return err
+		}
+		defer appdb.Close(db)
+		if err := appdb.Migrate(ctx, db); err != nil {
+			return err
+		}
+		name, err := backup.Run(ctx, db, cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Println(name)
+		return nil
+
+	case "backups":
+		if cfg.Target == nil {
+			return backup.ErrNoTarget
+		}
+		names, err := backup.List(ctx, cfg.Target)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+
+	case "restore":
+		path, ok := appdb.FilePath()
+		if !ok {
+			return errors.New("restore needs SQLITE_DSN to name a database file")
+		}
+		name := "latest"
+		if len(args) > 1 {
+			name = args[1]
+		}
+		restored, err := backup.Restore(ctx, cfg, name, path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored %s to %s\n", restored, path)
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
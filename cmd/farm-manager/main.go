@@ -2,10 +2,14 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 
+	"github.com/cr1cr1/farm-manager/internal/backup"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	appdb "github.com/cr1cr1/farm-manager/internal/db"
+	"github.com/cr1cr1/farm-manager/internal/events"
+	"github.com/cr1cr1/farm-manager/internal/routing"
 	"github.com/cr1cr1/farm-manager/internal/web/handlers"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/gogf/gf/v2/frame/g"
@@ -29,6 +33,14 @@ func addrFromEnv() string {
 func main() {
 	ctx := context.Background()
 
+	if len(os.Args) > 1 {
+		if err := runCommand(ctx, os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup DB and run migrations.
 	db, err := appdb.Open(ctx)
 	if err != nil {
@@ -40,21 +52,51 @@ func main() {
 		panic(err)
 	}
 
-	// Repositories.
-	userRepo := data.NewSQLiteUserRepo(db)
-	barnRepo := &data.SQLiteBarnRepo{DB: db}
-	feedTypeRepo := &data.SQLiteFeedTypeRepo{DB: db}
-	staffRepo := &data.SQLiteStaffRepo{DB: db}
-	flockRepo := &data.SQLiteFlockRepo{DB: db}
-	feedingRecordRepo := &data.SQLiteFeedingRecordRepo{DB: db}
-	healthCheckRepo := &data.SQLiteHealthCheckRepo{DB: db}
-	mortalityRecordRepo := &data.SQLiteMortalityRecordRepo{DB: db}
-	productionBatchRepo := &data.SQLiteProductionBatchRepo{DB: db}
-	slaughterRecordRepo := &data.SQLiteSlaughterRecordRepo{DB: db}
-	inventoryItemRepo := &data.SQLiteInventoryItemRepo{DB: db}
-	customerRepo := &data.SQLiteCustomerRepo{DB: db}
-	orderRepo := &data.SQLiteOrderRepo{DB: db}
-	orderItemRepo := &data.SQLiteOrderItemRepo{DB: db}
+	// Scheduled backups, when BACKUP_INTERVAL and a target are set.
+	backupConfig, err := backup.ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	go backup.Schedule(ctx, db, backupConfig)
+
+	// Repositories publish their writes so open pages can follow them live.
+	bus := events.NewBus()
+
+	userRepo := &data.SQLiteUserRepo{DB: db, Events: bus}
+	farmRepo := &data.SQLiteFarmRepo{DB: db, Events: bus}
+	barnRepo := &data.SQLiteBarnRepo{DB: db, Events: bus}
+	feedTypeRepo := &data.SQLiteFeedTypeRepo{DB: db, Events: bus}
+	staffRepo := &data.SQLiteStaffRepo{DB: db, Events: bus}
+	flockRepo := &data.SQLiteFlockRepo{DB: db, Events: bus}
+	feedingRecordRepo := &data.SQLiteFeedingRecordRepo{DB: db, Events: bus}
+	healthCheckRepo := &data.SQLiteHealthCheckRepo{DB: db, Events: bus}
+	mortalityRecordRepo := &data.SQLiteMortalityRecordRepo{DB: db, Events: bus}
+	productionBatchRepo := &data.SQLiteProductionBatchRepo{DB: db, Events: bus}
+	slaughterRecordRepo := &data.SQLiteSlaughterRecordRepo{DB: db, Events: bus}
+	inventoryItemRepo := &data.SQLiteInventoryItemRepo{DB: db, Events: bus}
+	customerRepo := &data.SQLiteCustomerRepo{DB: db, Events: bus}
+	orderRepo := &data.SQLiteOrderRepo{DB: db, Events: bus}
+	orderItemRepo := &data.SQLiteOrderItemRepo{DB: db, Events: bus}
+	complianceRepo := &data.SQLiteComplianceRepo{DB: db, Events: bus}
+	outdoorAccessRecordRepo := &data.SQLiteOutdoorAccessRecordRepo{DB: db, Events: bus}
+	traceabilityRepo := &data.SQLiteTraceabilityRepo{DB: db}
+	productRepo := &data.SQLiteProductRepo{DB: db, Events: bus}
+	priceListRepo := &data.SQLitePriceListRepo{DB: db, Events: bus}
+	invoiceRepo := &data.SQLiteInvoiceRepo{DB: db, Events: bus}
+	paymentRepo := &data.SQLitePaymentRepo{DB: db, Events: bus}
+	productLotRepo := &data.SQLiteProductLotRepo{DB: db, Events: bus}
+	preorderRepo := &data.SQLitePreorderRepo{DB: db, Events: bus}
+	deliveryRunRepo := &data.SQLiteDeliveryRunRepo{DB: db, Events: bus}
+	customerAccountRepo := &data.SQLiteCustomerAccountRepo{DB: db, Events: bus}
+	customerCRMRepo := &data.SQLiteCustomerCRMRepo{DB: db, Events: bus}
+	rosterRepo := &data.SQLiteRosterRepo{DB: db, Events: bus}
+	taskRepo := &data.SQLiteTaskRepo{DB: db, Events: bus}
+	labourRepo := &data.SQLiteLabourRepo{DB: db, Events: bus}
+	ledgerRepo := &data.SQLiteLedgerRepo{DB: db, Events: bus}
+	dashboardRepo := &data.SQLiteDashboardRepo{DB: db}
+	importRepo := &data.SQLiteImportRepo{DB: db, Events: bus}
+	unitOfWork := data.NewUnitOfWork(db)
+	go handlers.ScheduleChecklists(ctx, taskRepo, farmRepo)
 
 	// Server.
 	s := g.Server()
@@ -94,47 +136,69 @@ func main() {
 	// Public routes (login, logout). CSRF applied for POST.
 	public := s.Group(base)
 	public.Middleware(middleware.Csrf())
-	handlers.RegisterAuthRoutes(public, userRepo)
+	handlers.RegisterAuthRoutes(public, userRepo, farmRepo)
+	handlers.RegisterRosterFeedRoutes(public, staffRepo, rosterRepo)
 
 	// Protected routes (dashboard and fragments).
 	protected := s.Group(base)
-	protected.Middleware(middleware.Csrf(), middleware.RequireAuth())
+	protected.Middleware(middleware.Csrf(), middleware.RequireAuth(farmRepo))
 
-	// Create dashboard repos struct with all repositories
 	dashboardRepos := &handlers.DashboardRepos{
-		UserRepo:            userRepo,
-		BarnRepo:            barnRepo,
-		FeedTypeRepo:        feedTypeRepo,
-		StaffRepo:           staffRepo,
-		FlockRepo:           flockRepo,
-		FeedingRecordRepo:   feedingRecordRepo,
-		HealthCheckRepo:     healthCheckRepo,
-		MortalityRecordRepo: mortalityRecordRepo,
-		ProductionBatchRepo: productionBatchRepo,
-		SlaughterRecordRepo: slaughterRecordRepo,
-		InventoryItemRepo:   inventoryItemRepo,
-		CustomerRepo:        customerRepo,
-		OrderRepo:           orderRepo,
-		OrderItemRepo:       orderItemRepo,
+		DashboardRepo: dashboardRepo,
+		TaskRepo:      taskRepo,
 	}
 
-	handlers.RegisterDashboardRoutes(protected, dashboardRepos)
+	handlers.RegisterDashboardRoutes(protected, dashboardRepos, bus)
 	handlers.RegisterProfileRoutes(protected, userRepo)
+	handlers.RegisterLiveRoutes(protected, bus)
+	handlers.RegisterFarmRoutes(protected, farmRepo, userRepo, barnRepo, flockRepo, productLotRepo, inventoryItemRepo)
 
 	// Register individual domain management routes
-	handlers.RegisterBarnRoutes(protected, barnRepo)
-	handlers.RegisterFeedTypeRoutes(protected, feedTypeRepo)
-	handlers.RegisterStaffRoutes(protected, staffRepo)
-	handlers.RegisterFlockRoutes(protected, flockRepo, barnRepo, feedTypeRepo)
-	handlers.RegisterFeedingRecordRoutes(protected, feedingRecordRepo, flockRepo, feedTypeRepo, staffRepo)
-	handlers.RegisterHealthCheckRoutes(protected, healthCheckRepo, flockRepo, staffRepo)
-	handlers.RegisterInventoryItemRoutes(protected, inventoryItemRepo)
-	handlers.RegisterMortalityRecordRoutes(protected, mortalityRecordRepo, flockRepo)
-	handlers.RegisterProductionBatchRoutes(protected, productionBatchRepo, flockRepo, staffRepo)
-	handlers.RegisterSlaughterRecordRoutes(protected, slaughterRecordRepo, productionBatchRepo, staffRepo)
-	handlers.RegisterCustomerRoutes(protected, customerRepo)
-	handlers.RegisterOrderRoutes(protected, orderRepo, customerRepo)
-	handlers.RegisterOrderItemRoutes(protected, orderItemRepo, orderRepo)
+	handlers.RegisterBarnRoutes(protected, barnRepo, bus)
+	handlers.RegisterFeedTypeRoutes(protected, feedTypeRepo, bus)
+	handlers.RegisterStaffRoutes(protected, staffRepo, rosterRepo, barnRepo, bus)
+	handlers.RegisterFlockRoutes(protected, flockRepo, barnRepo, feedTypeRepo, bus)
+	handlers.RegisterFeedingRecordRoutes(protected, feedingRecordRepo, flockRepo, feedTypeRepo, staffRepo, taskRepo, bus)
+	handlers.RegisterHealthCheckRoutes(protected, healthCheckRepo, flockRepo, staffRepo, taskRepo, bus)
+	handlers.RegisterInventoryItemRoutes(protected, inventoryItemRepo, bus)
+	handlers.RegisterMortalityRecordRoutes(protected, mortalityRecordRepo, flockRepo, taskRepo, bus)
+	handlers.RegisterTaskRoutes(protected, taskRepo, barnRepo, flockRepo, staffRepo)
+	handlers.RegisterLabourRoutes(protected, labourRepo, staffRepo, barnRepo, flockRepo, taskRepo)
+	handlers.RegisterLedgerRoutes(protected, ledgerRepo, labourRepo, barnRepo, flockRepo)
+	handlers.RegisterProductionBatchRoutes(protected, productionBatchRepo, flockRepo, staffRepo, bus)
+	handlers.RegisterSlaughterRecordRoutes(protected, slaughterRecordRepo, productionBatchRepo, staffRepo, productLotRepo, productRepo, bus)
+	handlers.RegisterCustomerRoutes(protected, customerRepo, customerCRMRepo, bus)
+	handlers.RegisterCustomerAccountRoutes(protected, customerAccountRepo, customerRepo)
+	handlers.RegisterOrderRoutes(protected, orderRepo, orderItemRepo, customerRepo, productRepo, priceListRepo, slaughterRecordRepo, invoiceRepo, bus)
+	handlers.RegisterInvoiceRoutes(protected, invoiceRepo, orderRepo, orderItemRepo, customerRepo, paymentRepo, unitOfWork)
+	handlers.RegisterStockRoutes(protected, productLotRepo)
+	handlers.RegisterPaymentRoutes(protected, paymentRepo, invoiceRepo, customerRepo)
+	handlers.RegisterPreorderRoutes(protected, preorderRepo, customerRepo)
+	handlers.RegisterDeliveryRunRoutes(protected, deliveryRunRepo, orderItemRepo, staffRepo, routing.StraightLine{})
+	handlers.RegisterProductRoutes(protected, productRepo, bus)
+	handlers.RegisterPriceListRoutes(protected, priceListRepo, productRepo)
+	handlers.RegisterComplianceRoutes(protected, complianceRepo, outdoorAccessRecordRepo, flockRepo, barnRepo, feedTypeRepo)
+	handlers.RegisterTraceabilityRoutes(protected, traceabilityRepo, productionBatchRepo, slaughterRecordRepo)
+	handlers.RegisterImportRoutes(protected, importRepo, feedingRecordRepo, mortalityRecordRepo, orderRepo, unitOfWork)
+
+	// Customer portal: its own base path and sign-in, never the staff session.
+	portalRepos := &handlers.PortalRepos{
+		CustomerAccountRepo: customerAccountRepo,
+		CustomerRepo:        customerRepo,
+		ProductRepo:         productRepo,
+		PriceListRepo:       priceListRepo,
+		ProductLotRepo:      productLotRepo,
+		OrderRepo:           orderRepo,
+		OrderItemRepo:       orderItemRepo,
+		InvoiceRepo:         invoiceRepo,
+	}
+	portalPublic := s.Group(middleware.PortalBasePath())
+	portalPublic.Middleware(middleware.Csrf())
+	handlers.RegisterPortalAuthRoutes(portalPublic, portalRepos)
+
+	portal := s.Group(middleware.PortalBasePath())
+	portal.Middleware(middleware.Csrf(), middleware.RequireCustomer())
+	handlers.RegisterPortalRoutes(portal, portalRepos)
 
 	s.Run()
 }
@@ -0,0 +1,44 @@
+-- 0003_organic_compliance.sql
+-- Organic (bio) certification: barn areas, certified feed, outdoor access log and configurable rules.
+
+ALTER TABLE barns ADD COLUMN area_m2 REAL;
+
+ALTER TABLE feed_types ADD COLUMN organic_certified INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS outdoor_access_records (
+    outdoor_access_record_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    flock_id INTEGER NOT NULL,
+    date DATE NOT NULL,
+    hours REAL,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (flock_id) REFERENCES flocks(flock_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_outdooraccess_flock ON outdoor_access_records(flock_id);
+
+CREATE TABLE IF NOT EXISTS compliance_rules (
+    compliance_rule_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    threshold REAL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER
+);
+
+-- Defaults follow the EU organic regulation for turkeys; adjust per certification body.
+INSERT OR IGNORE INTO compliance_rules (code, name, threshold, notes) VALUES
+    ('max_stocking_density', 'Maximum stocking density (birds per m² of barn area)', 10, 'Live birds divided by barn area'),
+    ('min_outdoor_access_days', 'Minimum outdoor access days', 47, 'At least one third of the productive life'),
+    ('organic_feed_only', 'Organic-certified feed types only', NULL, 'Every feed type given must be certified'),
+    ('max_treatments', 'Maximum allopathic treatments per lifetime', 1, 'One course for birds living less than a year'),
+    ('min_slaughter_age_days', 'Minimum slaughter age (days)', 140, 'Days between hatch and slaughter');
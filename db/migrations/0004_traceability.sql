@@ -0,0 +1,8 @@
+-- 0004_traceability.sql
+-- Traceability: feed lot numbers on feeding records and order items linked to slaughter output lots.
+
+ALTER TABLE feeding_records ADD COLUMN lot_number TEXT;
+
+ALTER TABLE order_items ADD COLUMN slaughter_id INTEGER REFERENCES slaughter_records(slaughter_id);
+
+CREATE INDEX IF NOT EXISTS idx_orderitem_slaughter ON order_items(slaughter_id);
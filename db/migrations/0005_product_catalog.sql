@@ -0,0 +1,53 @@
+-- 0005_product_catalog.sql
+-- Product catalog and customer-type price lists; order items reference a product.
+
+CREATE TABLE IF NOT EXISTS products (
+    product_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sku TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    unit TEXT NOT NULL DEFAULT 'kg',
+    vat_rate REAL NOT NULL DEFAULT 0,
+    description TEXT,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS price_lists (
+    price_list_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    customer_type TEXT,
+    valid_from DATE,
+    valid_to DATE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_pricelist_customer_type ON price_lists(customer_type);
+
+CREATE TABLE IF NOT EXISTS price_list_items (
+    price_list_item_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    price_list_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    unit_price REAL NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (price_list_id) REFERENCES price_lists(price_list_id),
+    FOREIGN KEY (product_id) REFERENCES products(product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_pricelistitem_list ON price_list_items(price_list_id);
+CREATE INDEX IF NOT EXISTS idx_pricelistitem_product ON price_list_items(product_id);
+
+ALTER TABLE order_items ADD COLUMN product_id INTEGER REFERENCES products(product_id);
+
+CREATE INDEX IF NOT EXISTS idx_orderitem_product ON order_items(product_id);
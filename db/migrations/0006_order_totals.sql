@@ -0,0 +1,25 @@
+-- 0006_order_totals.sql
+-- Server-computed order totals: line discounts and VAT, order subtotal/VAT/delivery fee.
+
+ALTER TABLE order_items ADD COLUMN discount REAL NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN vat_rate REAL NOT NULL DEFAULT 0;
+
+ALTER TABLE orders ADD COLUMN subtotal_amount REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN vat_amount REAL NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN delivery_fee REAL NOT NULL DEFAULT 0;
+
+-- Re-derive existing totals from their lines; client-supplied values are discarded.
+UPDATE order_items
+SET total_price = ROUND(COALESCE(quantity, 0) * COALESCE(unit_price, 0), 2)
+WHERE deleted_at IS NULL;
+
+UPDATE orders
+SET subtotal_amount = (
+        SELECT COALESCE(SUM(total_price), 0) FROM order_items
+        WHERE order_items.order_id = orders.order_id AND order_items.deleted_at IS NULL
+    ),
+    total_amount = (
+        SELECT COALESCE(SUM(total_price), 0) FROM order_items
+        WHERE order_items.order_id = orders.order_id AND order_items.deleted_at IS NULL
+    )
+WHERE deleted_at IS NULL;
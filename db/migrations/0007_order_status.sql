@@ -0,0 +1,22 @@
+-- 0007_order_status.sql
+-- Order status workflow: normalise free-text statuses and record every transition.
+
+UPDATE orders SET status = LOWER(TRIM(status)) WHERE status IS NOT NULL;
+UPDATE orders SET status = 'draft' WHERE status IN ('new', 'pending', 'open');
+UPDATE orders SET status = 'cancelled' WHERE status = 'canceled';
+UPDATE orders SET status = 'draft'
+WHERE status IS NULL
+   OR status NOT IN ('draft', 'confirmed', 'reserved', 'picked', 'delivered', 'invoiced', 'paid', 'cancelled', 'returned');
+
+CREATE TABLE IF NOT EXISTS order_status_transitions (
+    transition_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_id INTEGER NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    note TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    FOREIGN KEY (order_id) REFERENCES orders(order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_transition_order ON order_status_transitions(order_id);
@@ -0,0 +1,78 @@
+-- 0008_invoicing.sql
+-- Invoices and credit notes issued from delivered orders. Numbers are gap-free per fiscal
+-- year and kind; issued documents are immutable.
+
+CREATE TABLE IF NOT EXISTS invoice_sequences (
+    fiscal_year INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    last_number INTEGER NOT NULL,
+    PRIMARY KEY (fiscal_year, kind)
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    invoice_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL CHECK (kind IN ('invoice', 'credit_note')),
+    number TEXT NOT NULL UNIQUE,
+    fiscal_year INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+    order_id INTEGER NOT NULL,
+    customer_id INTEGER NOT NULL,
+    credited_invoice_id INTEGER,
+    issue_date DATE NOT NULL,
+    due_date DATE NOT NULL,
+    customer_name TEXT NOT NULL,
+    customer_address TEXT,
+    subtotal_amount REAL NOT NULL,
+    vat_amount REAL NOT NULL,
+    delivery_fee REAL NOT NULL,
+    total_amount REAL NOT NULL,
+    reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    UNIQUE (fiscal_year, kind, sequence),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (credited_invoice_id) REFERENCES invoices(invoice_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoice_order ON invoices(order_id);
+CREATE INDEX IF NOT EXISTS idx_invoice_customer ON invoices(customer_id);
+-- An invoice can be credited once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_invoice_credited ON invoices(credited_invoice_id);
+
+CREATE TABLE IF NOT EXISTS invoice_lines (
+    invoice_line_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    invoice_id INTEGER NOT NULL,
+    description TEXT NOT NULL,
+    quantity REAL NOT NULL,
+    unit TEXT,
+    unit_price REAL NOT NULL,
+    discount REAL NOT NULL DEFAULT 0,
+    vat_rate REAL NOT NULL DEFAULT 0,
+    net_amount REAL NOT NULL,
+    vat_amount REAL NOT NULL,
+    FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoiceline_invoice ON invoice_lines(invoice_id);
+
+-- Issued documents are immutable; corrections go through credit notes.
+CREATE TRIGGER IF NOT EXISTS invoices_no_update BEFORE UPDATE ON invoices
+BEGIN
+    SELECT RAISE(ABORT, 'issued invoices are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS invoices_no_delete BEFORE DELETE ON invoices
+BEGIN
+    SELECT RAISE(ABORT, 'issued invoices are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS invoice_lines_no_update BEFORE UPDATE ON invoice_lines
+BEGIN
+    SELECT RAISE(ABORT, 'issued invoices are immutable');
+END;
+
+CREATE TRIGGER IF NOT EXISTS invoice_lines_no_delete BEFORE DELETE ON invoice_lines
+BEGIN
+    SELECT RAISE(ABORT, 'issued invoices are immutable');
+END;
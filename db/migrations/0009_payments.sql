@@ -0,0 +1,34 @@
+-- 0009_payments.sql
+-- Customer payments allocated to invoices. A payment can settle several invoices and an
+-- invoice can be settled by several (partial) payments; unallocated amounts stay on account.
+
+CREATE TABLE IF NOT EXISTS payments (
+    payment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    payment_date DATE NOT NULL,
+    method TEXT NOT NULL CHECK (method IN ('cash', 'bank_transfer', 'card')),
+    amount REAL NOT NULL CHECK (amount > 0),
+    reference TEXT,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_customer ON payments(customer_id);
+CREATE INDEX IF NOT EXISTS idx_payment_date ON payments(payment_date);
+
+CREATE TABLE IF NOT EXISTS payment_allocations (
+    payment_allocation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    payment_id INTEGER NOT NULL,
+    invoice_id INTEGER NOT NULL,
+    amount REAL NOT NULL CHECK (amount > 0),
+    UNIQUE (payment_id, invoice_id),
+    FOREIGN KEY (payment_id) REFERENCES payments(payment_id),
+    FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_allocation_invoice ON payment_allocations(invoice_id);
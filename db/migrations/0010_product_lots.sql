@@ -0,0 +1,36 @@
+-- 0010_product_lots.sql
+-- Slaughter output broken into product lots that make up the sellable stock, and the stock
+-- reserved from those lots by confirmed order lines.
+
+CREATE TABLE IF NOT EXISTS product_lots (
+    product_lot_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slaughter_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    weight_kg REAL NOT NULL DEFAULT 0,
+    piece_count INTEGER NOT NULL DEFAULT 0,
+    packing_date DATE NOT NULL,
+    use_by_date DATE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (slaughter_id) REFERENCES slaughter_records(slaughter_id),
+    FOREIGN KEY (product_id) REFERENCES products(product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_productlot_slaughter ON product_lots(slaughter_id);
+CREATE INDEX IF NOT EXISTS idx_productlot_product ON product_lots(product_id);
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    stock_reservation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    order_item_id INTEGER NOT NULL,
+    product_lot_id INTEGER NOT NULL,
+    quantity REAL NOT NULL CHECK (quantity > 0),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (order_item_id) REFERENCES order_items(order_item_id),
+    FOREIGN KEY (product_lot_id) REFERENCES product_lots(product_lot_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservation_item ON stock_reservations(order_item_id);
+CREATE INDEX IF NOT EXISTS idx_reservation_lot ON stock_reservations(product_lot_id);
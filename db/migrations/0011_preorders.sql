@@ -0,0 +1,66 @@
+-- 0011_preorders.sql
+-- Seasonal pre-order campaigns (Thanksgiving, Christmas): customers reserve whole birds in a
+-- weight band for a pickup date and pay a deposit up front.
+
+CREATE TABLE IF NOT EXISTS preorder_campaigns (
+    campaign_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    pickup_from DATE NOT NULL,
+    pickup_to DATE NOT NULL,
+    deposit_per_bird REAL NOT NULL DEFAULT 0 CHECK (deposit_per_bird >= 0),
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    CHECK (pickup_to >= pickup_from)
+);
+
+CREATE TABLE IF NOT EXISTS preorder_weight_bands (
+    weight_band_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id INTEGER NOT NULL,
+    label TEXT NOT NULL,
+    min_kg REAL NOT NULL CHECK (min_kg >= 0),
+    max_kg REAL NOT NULL,
+    CHECK (max_kg > min_kg),
+    FOREIGN KEY (campaign_id) REFERENCES preorder_campaigns(campaign_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_weightband_campaign ON preorder_weight_bands(campaign_id);
+
+CREATE TABLE IF NOT EXISTS preorders (
+    preorder_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id INTEGER NOT NULL,
+    customer_id INTEGER NOT NULL,
+    weight_band_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    pickup_date DATE NOT NULL,
+    status TEXT NOT NULL DEFAULT 'reserved' CHECK (status IN ('reserved', 'collected', 'cancelled')),
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (campaign_id) REFERENCES preorder_campaigns(campaign_id),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (weight_band_id) REFERENCES preorder_weight_bands(weight_band_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_preorder_campaign ON preorders(campaign_id);
+CREATE INDEX IF NOT EXISTS idx_preorder_customer ON preorders(customer_id);
+
+CREATE TABLE IF NOT EXISTS preorder_deposits (
+    preorder_deposit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    preorder_id INTEGER NOT NULL,
+    received_on DATE NOT NULL,
+    method TEXT NOT NULL CHECK (method IN ('cash', 'bank_transfer', 'card')),
+    amount REAL NOT NULL CHECK (amount > 0),
+    reference TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    FOREIGN KEY (preorder_id) REFERENCES preorders(preorder_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deposit_preorder ON preorder_deposits(preorder_id);
@@ -0,0 +1,41 @@
+-- 0012_delivery_runs.sql
+-- Delivery runs: the orders a driver delivers on a day, in visiting order, with the proof of
+-- delivery captured at each stop. Customer coordinates feed the route planner.
+
+ALTER TABLE customers ADD COLUMN latitude REAL;
+ALTER TABLE customers ADD COLUMN longitude REAL;
+
+CREATE TABLE IF NOT EXISTS delivery_runs (
+    delivery_run_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_date DATE NOT NULL,
+    driver_id INTEGER,
+    status TEXT NOT NULL DEFAULT 'planned' CHECK (status IN ('planned', 'dispatched', 'completed')),
+    total_distance_km REAL,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (driver_id) REFERENCES staff(staff_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deliveryrun_date ON delivery_runs(run_date);
+
+CREATE TABLE IF NOT EXISTS delivery_stops (
+    delivery_stop_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_run_id INTEGER NOT NULL,
+    order_id INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+    leg_distance_km REAL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'delivered', 'failed')),
+    delivered_at DATETIME,
+    recipient_name TEXT,
+    signature TEXT,
+    notes TEXT,
+    UNIQUE (delivery_run_id, order_id),
+    FOREIGN KEY (delivery_run_id) REFERENCES delivery_runs(delivery_run_id),
+    FOREIGN KEY (order_id) REFERENCES orders(order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_deliverystop_order ON delivery_stops(order_id);
@@ -0,0 +1,22 @@
+-- 0013_customer_portal.sql
+-- Customer portal: sign-in accounts for customers, kept apart from staff users, and the origin
+-- of each order so staff can spot orders placed online.
+
+ALTER TABLE orders ADD COLUMN source TEXT NOT NULL DEFAULT 'staff' CHECK (source IN ('staff', 'portal'));
+
+CREATE TABLE IF NOT EXISTS customer_accounts (
+    customer_account_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    email TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    last_login_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customeraccount_email ON customer_accounts(email) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_customeraccount_customer ON customer_accounts(customer_id);
@@ -0,0 +1,78 @@
+-- 0014_customer_crm.sql
+-- Customer CRM: structured contacts, billing and delivery addresses with a default per kind,
+-- tags, a VAT number and a log of calls, emails and complaints. customers.delivery_address and
+-- customers.billing_address keep a copy of the default addresses for the screens and documents
+-- that print them.
+
+ALTER TABLE customers ADD COLUMN vat_number TEXT;
+ALTER TABLE customers ADD COLUMN billing_address TEXT;
+
+CREATE TABLE IF NOT EXISTS customer_tags (
+    customer_id INTEGER NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (customer_id, tag),
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_customertag_tag ON customer_tags(tag);
+
+CREATE TABLE IF NOT EXISTS customer_contacts (
+    customer_contact_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT,
+    phone TEXT,
+    email TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_customercontact_customer ON customer_contacts(customer_id);
+
+CREATE TABLE IF NOT EXISTS customer_addresses (
+    customer_address_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('billing', 'delivery')),
+    label TEXT,
+    address TEXT NOT NULL,
+    is_default BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_customeraddress_customer ON customer_addresses(customer_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_customeraddress_default
+    ON customer_addresses(customer_id, kind) WHERE is_default = 1 AND deleted_at IS NULL;
+
+-- The single delivery address each customer had becomes its default delivery address.
+INSERT INTO customer_addresses (customer_id, kind, address, is_default, created_at, updated_at)
+SELECT customer_id, 'delivery', delivery_address, 1, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM customers
+WHERE deleted_at IS NULL AND TRIM(COALESCE(delivery_address, '')) <> '';
+
+CREATE TABLE IF NOT EXISTS customer_communications (
+    customer_communication_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL,
+    customer_contact_id INTEGER,
+    kind TEXT NOT NULL CHECK (kind IN ('call', 'email', 'visit', 'complaint', 'note')),
+    occurred_at DATETIME NOT NULL,
+    subject TEXT NOT NULL,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (customer_id) REFERENCES customers(customer_id),
+    FOREIGN KEY (customer_contact_id) REFERENCES customer_contacts(customer_contact_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_customercomm_customer ON customer_communications(customer_id, occurred_at);
@@ -0,0 +1,45 @@
+-- 0015_shift_roster.sql
+-- Shift roster: reusable shift templates and the shifts staff are assigned to per day and
+-- barn. A shift keeps its own start and end so changing a template does not move shifts
+-- already rostered. Each staff member can get a secret calendar token for an iCalendar feed.
+
+ALTER TABLE staff ADD COLUMN calendar_token TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_staff_calendar_token ON staff(calendar_token) WHERE calendar_token IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS shift_templates (
+    shift_template_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    start_time TEXT NOT NULL, -- HH:MM
+    end_time TEXT NOT NULL,   -- HH:MM, at or before start_time for shifts ending the next day
+    barn_id INTEGER,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id)
+);
+
+CREATE TABLE IF NOT EXISTS shifts (
+    shift_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shift_template_id INTEGER NOT NULL,
+    staff_id INTEGER NOT NULL,
+    barn_id INTEGER,
+    shift_date DATE NOT NULL,
+    starts_at DATETIME NOT NULL,
+    ends_at DATETIME NOT NULL,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (shift_template_id) REFERENCES shift_templates(shift_template_id),
+    FOREIGN KEY (staff_id) REFERENCES staff(staff_id),
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shift_date ON shifts(shift_date);
+CREATE INDEX IF NOT EXISTS idx_shift_staff ON shifts(staff_id, shift_date);
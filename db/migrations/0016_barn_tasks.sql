@@ -0,0 +1,55 @@
+-- 0016_barn_tasks.sql
+-- Barn work checklists: recurring task templates per barn (optionally per flock) and the
+-- tasks generated from them for each day. A task copies what it needs from its template so
+-- editing the template does not rewrite past checklists. Tasks that are recorded through a
+-- mortality record, feeding record or health check keep the id of that record.
+
+CREATE TABLE IF NOT EXISTS task_templates (
+    task_template_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL DEFAULT 'general' CHECK (kind IN ('general', 'mortality', 'feeding', 'health_check')),
+    barn_id INTEGER NOT NULL,
+    flock_id INTEGER,
+    staff_id INTEGER,                     -- default assignee
+    weekdays INTEGER NOT NULL DEFAULT 0,  -- bit per weekday, Sunday = 1; 0 means every day
+    due_time TEXT NOT NULL,               -- HH:MM
+    notes TEXT,
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id),
+    FOREIGN KEY (flock_id) REFERENCES flocks(flock_id),
+    FOREIGN KEY (staff_id) REFERENCES staff(staff_id)
+);
+
+CREATE TABLE IF NOT EXISTS tasks (
+    task_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_template_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    barn_id INTEGER NOT NULL,
+    flock_id INTEGER,
+    staff_id INTEGER,
+    task_date DATE NOT NULL,
+    due_time TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'done', 'skipped')),
+    completed_at DATETIME,
+    completed_by INTEGER,
+    record_id INTEGER,                    -- mortality record, feeding record or health check, by kind
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (task_template_id) REFERENCES task_templates(task_template_id),
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id),
+    FOREIGN KEY (flock_id) REFERENCES flocks(flock_id),
+    FOREIGN KEY (staff_id) REFERENCES staff(staff_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_task_template_date ON tasks(task_template_id, task_date);
+CREATE INDEX IF NOT EXISTS idx_task_status_date ON tasks(status, task_date);
@@ -0,0 +1,34 @@
+-- 0017_labour_costs.sql
+-- Labour and feed cost per flock: hourly rates on staff, a cost per kg on feed types and the
+-- time staff book to a barn and, where known, a flock. A time entry without an end is a staff
+-- member still clocked in. Entries keep the hourly rate they were booked at so a pay rise does
+-- not rewrite the cost of past flocks.
+
+ALTER TABLE staff ADD COLUMN hourly_rate REAL;
+ALTER TABLE feed_types ADD COLUMN cost_per_kg REAL;
+
+CREATE TABLE IF NOT EXISTS time_entries (
+    time_entry_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    staff_id INTEGER NOT NULL,
+    barn_id INTEGER NOT NULL,
+    flock_id INTEGER,  -- NULL spreads the hours over the flocks in the barn
+    task_id INTEGER,   -- checklist task the time was spent on
+    started_at DATETIME NOT NULL,
+    ended_at DATETIME, -- NULL while clocked in
+    hourly_rate REAL,
+    notes TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    FOREIGN KEY (staff_id) REFERENCES staff(staff_id),
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id),
+    FOREIGN KEY (flock_id) REFERENCES flocks(flock_id),
+    FOREIGN KEY (task_id) REFERENCES tasks(task_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_time_entry_started ON time_entries(started_at);
+CREATE INDEX IF NOT EXISTS idx_time_entry_flock ON time_entries(flock_id);
+-- A staff member can only be clocked in once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entry_open ON time_entries(staff_id) WHERE ended_at IS NULL AND deleted_at IS NULL;
@@ -0,0 +1,26 @@
+-- 0018_cost_ledger.sql
+-- Cost ledger for flock profitability: costs that are not recorded elsewhere, e.g. the chick
+-- purchase, medications, energy and slaughter fees. An entry booked to a barn without a flock,
+-- typically the energy bill, is shared by the flocks in the barn. Feed and labour are not booked
+-- here; they come from the feeding records and time entries.
+
+CREATE TABLE IF NOT EXISTS cost_entries (
+    cost_entry_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    category TEXT NOT NULL CHECK (category IN ('chicks', 'medication', 'energy', 'slaughter', 'other')),
+    flock_id INTEGER,
+    barn_id INTEGER,
+    entry_date DATE NOT NULL,
+    amount REAL NOT NULL CHECK (amount >= 0),
+    description TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER,
+    CHECK (flock_id IS NOT NULL OR barn_id IS NOT NULL),
+    FOREIGN KEY (flock_id) REFERENCES flocks(flock_id),
+    FOREIGN KEY (barn_id) REFERENCES barns(barn_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_cost_entry_flock ON cost_entries(flock_id);
+CREATE INDEX IF NOT EXISTS idx_cost_entry_barn ON cost_entries(barn_id);
@@ -0,0 +1,6 @@
+-- 0019_dashboard.sql
+-- Operational dashboard: a planned daily ration per flock to compare the feed given today
+-- against, and a reorder level per inventory item below which the item shows as low stock.
+
+ALTER TABLE flocks ADD COLUMN daily_feed_kg REAL;
+ALTER TABLE inventory_items ADD COLUMN reorder_level REAL;
@@ -0,0 +1,20 @@
+-- 0020_record_versions.sql
+-- Optimistic concurrency: every record edited through a form carries a version that each update
+-- bumps. An edit only applies when the record is still at the version its form was loaded at, so
+-- two people saving the same record no longer silently overwrite each other.
+
+ALTER TABLE barns ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE feed_types ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE staff ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE flocks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE feeding_records ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE health_checks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE mortality_records ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE production_batches ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE slaughter_records ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE inventory_items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE products ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE order_items ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE price_lists ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
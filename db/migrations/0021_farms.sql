@@ -0,0 +1,93 @@
+-- 0021_farms.sql
+-- Several farm sites in one installation. Every operational record belongs to a farm; users
+-- reach farms through memberships that carry their role there. The product catalog, price lists,
+-- compliance rules and invoice numbering stay shared: they belong to the business, not a site.
+-- Everything that existed before is assigned to farm 1 and every existing user owns it.
+
+CREATE TABLE IF NOT EXISTS farms (
+    farm_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    location TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME,
+    created_by INTEGER,
+    updated_by INTEGER
+);
+
+INSERT OR IGNORE INTO farms (farm_id, name) VALUES (1, 'Home farm');
+
+-- role: owner (everything, including members and cross-farm reports), manager (day-to-day work
+-- and transfers), worker (day-to-day work).
+CREATE TABLE IF NOT EXISTS farm_memberships (
+    farm_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL DEFAULT 'worker' CHECK (role IN ('owner', 'manager', 'worker')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    PRIMARY KEY (farm_id, user_id),
+    FOREIGN KEY (farm_id) REFERENCES farms(farm_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_farmmembership_user ON farm_memberships(user_id);
+
+INSERT OR IGNORE INTO farm_memberships (farm_id, user_id, role)
+SELECT 1, id, 'owner' FROM users WHERE deleted_at IS NULL;
+
+-- Records that are only ever reached through their parent (an order's status history, an
+-- invoice's lines, a run's stops, ...) follow the parent's farm and carry no farm_id of their own.
+-- SQLite cannot add a column with both a REFERENCES clause and a non-NULL default, so the link
+-- to farms is kept by the application.
+
+ALTER TABLE barns ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE feed_types ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE staff ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE flocks ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE feeding_records ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE health_checks ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE mortality_records ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE production_batches ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE slaughter_records ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE inventory_items ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE customers ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE orders ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE order_items ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE invoices ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE payments ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE product_lots ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE preorder_campaigns ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE preorders ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE delivery_runs ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shift_templates ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE shifts ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE task_templates ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tasks ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE time_entries ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE cost_entries ADD COLUMN farm_id INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_barn_farm ON barns(farm_id);
+CREATE INDEX IF NOT EXISTS idx_feedtype_farm ON feed_types(farm_id);
+CREATE INDEX IF NOT EXISTS idx_staff_farm ON staff(farm_id);
+CREATE INDEX IF NOT EXISTS idx_flock_farm ON flocks(farm_id);
+CREATE INDEX IF NOT EXISTS idx_feedingrecord_farm ON feeding_records(farm_id);
+CREATE INDEX IF NOT EXISTS idx_healthcheck_farm ON health_checks(farm_id);
+CREATE INDEX IF NOT EXISTS idx_mortalityrecord_farm ON mortality_records(farm_id);
+CREATE INDEX IF NOT EXISTS idx_productionbatch_farm ON production_batches(farm_id);
+CREATE INDEX IF NOT EXISTS idx_slaughterrecord_farm ON slaughter_records(farm_id);
+CREATE INDEX IF NOT EXISTS idx_inventoryitem_farm ON inventory_items(farm_id);
+CREATE INDEX IF NOT EXISTS idx_customer_farm ON customers(farm_id);
+CREATE INDEX IF NOT EXISTS idx_order_farm ON orders(farm_id);
+CREATE INDEX IF NOT EXISTS idx_orderitem_farm ON order_items(farm_id);
+CREATE INDEX IF NOT EXISTS idx_invoice_farm ON invoices(farm_id);
+CREATE INDEX IF NOT EXISTS idx_payment_farm ON payments(farm_id);
+CREATE INDEX IF NOT EXISTS idx_productlot_farm ON product_lots(farm_id);
+CREATE INDEX IF NOT EXISTS idx_preordercampaign_farm ON preorder_campaigns(farm_id);
+CREATE INDEX IF NOT EXISTS idx_preorder_farm ON preorders(farm_id);
+CREATE INDEX IF NOT EXISTS idx_deliveryrun_farm ON delivery_runs(farm_id);
+CREATE INDEX IF NOT EXISTS idx_shifttemplate_farm ON shift_templates(farm_id);
+CREATE INDEX IF NOT EXISTS idx_shift_farm ON shifts(farm_id);
+CREATE INDEX IF NOT EXISTS idx_tasktemplate_farm ON task_templates(farm_id);
+CREATE INDEX IF NOT EXISTS idx_task_farm ON tasks(farm_id);
+CREATE INDEX IF NOT EXISTS idx_timeentry_farm ON time_entries(farm_id);
+CREATE INDEX IF NOT EXISTS idx_costentry_farm ON cost_entries(farm_id);
@@ -0,0 +1,35 @@
+-- 0022_imports.sql
+-- Spreadsheet imports of historical records. An uploaded sheet is kept, as JSON, while it is
+-- mapped and previewed, and marked committed once its rows are in; a committed upload cannot be
+-- committed again. Column mappings are saved by name per entity for the next sheet of the kind.
+
+CREATE TABLE IF NOT EXISTS import_uploads (
+    upload_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL DEFAULT 1,
+    entity TEXT NOT NULL CHECK (entity IN ('feeding', 'mortality', 'sales')),
+    filename TEXT NOT NULL,
+    header TEXT NOT NULL,
+    rows TEXT NOT NULL,
+    imported_rows INTEGER,
+    committed_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    FOREIGN KEY (farm_id) REFERENCES farms(farm_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_importupload_farm ON import_uploads(farm_id, created_at);
+
+-- columns: JSON object from field key to the heading of the column holding it.
+CREATE TABLE IF NOT EXISTS import_mappings (
+    mapping_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL DEFAULT 1,
+    entity TEXT NOT NULL CHECK (entity IN ('feeding', 'mortality', 'sales')),
+    name TEXT NOT NULL,
+    columns TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_by INTEGER,
+    updated_by INTEGER,
+    UNIQUE (farm_id, entity, name),
+    FOREIGN KEY (farm_id) REFERENCES farms(farm_id)
+);
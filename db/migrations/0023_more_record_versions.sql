@@ -0,0 +1,10 @@
+-- 0023_more_record_versions.sql
+-- Versions for the records that are changed from a page but were not versioned yet: farm
+-- settings, compliance rules, checklist tasks and their templates, preorders and delivery runs.
+
+ALTER TABLE farms ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE compliance_rules ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE task_templates ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE preorders ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE delivery_runs ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -3,6 +3,7 @@ module github.com/cr1cr1/farm-manager
 go 1.25
 
 require (
+	filippo.io/age v1.2.1
 	github.com/a-h/templ v0.3.943
 	github.com/coreycole/datastarui v0.0.0-20250820054757-f74cfda6a683
 	github.com/gogf/gf/v2 v2.9.0
@@ -0,0 +1,443 @@
+// Package backup takes online snapshots of the SQLite database, keeps them in a local directory
+// or an S3-compatible bucket, and restores them.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/gogf/gf/v2/frame/g"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// namePrefix starts the name of every backup; files in the target without it are left alone.
+const namePrefix = "farm-manager-"
+
+// ErrNoTarget is returned when neither BACKUP_DIR nor BACKUP_S3_BUCKET is set.
+var ErrNoTarget = errors.New("no backup target: set BACKUP_DIR or BACKUP_S3_BUCKET")
+
+// ErrDatabaseInUse is returned by Restore while another process has the database open.
+var ErrDatabaseInUse = errors.New("the database is in use: stop the application before restoring")
+
+// Config says where backups go, how often they are taken, how many are kept and how they are
+// protected.
+type Config struct {
+	Target Target
+	// Interval between scheduled backups; zero turns the schedule off.
+	Interval time.Duration
+	// Keep is the number of newest backups retained; zero keeps them all.
+	Keep int
+	// Gzip compresses the snapshot.
+	Gzip bool
+	// AgeRecipient, when set, encrypts the backup to this age public key.
+	AgeRecipient string
+	// AgeIdentity is the age key file a restore decrypts with.
+	AgeIdentity string
+}
+
+// ConfigFromEnv reads the backup settings from BACKUP_* environment variables. A bucket takes
+// precedence over a directory.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Keep:         envInt("BACKUP_KEEP", 14),
+		Gzip:         os.Getenv("BACKUP_GZIP") != "false",
+		AgeRecipient: strings.TrimSpace(os.Getenv("BACKUP_AGE_RECIPIENT")),
+		AgeIdentity:  os.Getenv("BACKUP_AGE_IDENTITY"),
+	}
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("invalid BACKUP_INTERVAL %q", v)
+		}
+		cfg.Interval = d
+	}
+	if cfg.AgeRecipient != "" {
+		if _, err := age.ParseRecipients(strings.NewReader(cfg.AgeRecipient)); err != nil {
+			return cfg, fmt.Errorf("invalid BACKUP_AGE_RECIPIENT: %w", err)
+		}
+	}
+	switch {
+	case os.Getenv("BACKUP_S3_BUCKET") != "":
+		cfg.Target = &S3Target{
+			Endpoint:  os.Getenv("BACKUP_S3_ENDPOINT"),
+			Bucket:    os.Getenv("BACKUP_S3_BUCKET"),
+			Region:    os.Getenv("BACKUP_S3_REGION"),
+			Prefix:    os.Getenv("BACKUP_S3_PREFIX"),
+			AccessKey: os.Getenv("BACKUP_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("BACKUP_S3_SECRET_KEY"),
+		}
+		if cfg.Target.(*S3Target).Endpoint == "" {
+			return cfg, errors.New("BACKUP_S3_ENDPOINT is required with BACKUP_S3_BUCKET")
+		}
+	case os.Getenv("BACKUP_DIR") != "":
+		cfg.Target = DirTarget{Dir: os.Getenv("BACKUP_DIR")}
+	}
+	return cfg, nil
+}
+
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
+}
+
+// Run snapshots db, compresses and encrypts the snapshot as configured, stores it in the target
+// and prunes the backups beyond the retention. It returns the name of the new backup.
+//
+// The snapshot is taken with VACUUM INTO on the writer connection: it is a consistent copy of
+// the committed data, writes wait for it to finish, and readers carry on.
+func Run(ctx context.Context, db *sql.DB, cfg Config) (string, error) {
+	if cfg.Target == nil {
+		return "", ErrNoTarget
+	}
+	dir, err := os.MkdirTemp("", "farm-manager-backup-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "snapshot.db")
+	if _, err := db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("snapshot: %w", err)
+	}
+	if err := verify(ctx, path); err != nil {
+		return "", err
+	}
+
+	name := namePrefix + time.Now().UTC().Format("20060102T150405Z") + ".db"
+	if cfg.Gzip {
+		if path, err = gzipFile(path); err != nil {
+			return "", err
+		}
+		name += ".gz"
+	}
+	if cfg.AgeRecipient != "" {
+		if path, err = encryptFile(path, cfg.AgeRecipient); err != nil {
+			return "", err
+		}
+		name += ".age"
+	}
+
+	if err := cfg.Target.Put(ctx, name, path); err != nil {
+		return "", fmt.Errorf("store %s: %w", name, err)
+	}
+	if err := Prune(ctx, cfg.Target, cfg.Keep); err != nil {
+		return name, fmt.Errorf("prune: %w", err)
+	}
+	return name, nil
+}
+
+// Schedule takes a backup every cfg.Interval until ctx is done, logging the outcome of each.
+func Schedule(ctx context.Context, db *sql.DB, cfg Config) {
+	if cfg.Interval <= 0 || cfg.Target == nil {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			name, err := Run(ctx, db, cfg)
+			if err != nil {
+				g.Log().Errorf(ctx, "scheduled backup: %v", err)
+				continue
+			}
+			g.Log().Infof(ctx, "scheduled backup stored as %s", name)
+		}
+	}
+}
+
+// List returns the names of the backups in target, oldest first.
+func List(ctx context.Context, target Target) ([]string, error) {
+	all, err := target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if strings.HasPrefix(name, namePrefix) {
+			names = append(names, name)
+		}
+	}
+	// The UTC timestamp in the name sorts in the order the backups were taken.
+	sort.Strings(names)
+	return names, nil
+}
+
+// Prune deletes all but the newest keep backups from target. A keep of zero keeps everything.
+func Prune(ctx context.Context, target Target, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	names, err := List(ctx, target)
+	if err != nil {
+		return err
+	}
+	for len(names) > keep {
+		if err := target.Delete(ctx, names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Restore replaces the database file at dbPath with the backup called name, or with the newest
+// backup when name is "latest". The backup is fetched, decrypted and decompressed next to
+// dbPath and must pass an integrity check before anything is swapped; the database it replaces
+// is kept beside it as dbPath.before-restore-<time>. The application must not be running: the
+// swap happens under an exclusive lock on the current database, and ErrDatabaseInUse is
+// returned when another process holds it open.
+func Restore(ctx context.Context, cfg Config, name, dbPath string) (string, error) {
+	if cfg.Target == nil {
+		return "", ErrNoTarget
+	}
+	if name == "" || name == "latest" {
+		names, err := List(ctx, cfg.Target)
+		if err != nil {
+			return "", err
+		}
+		if len(names) == 0 {
+			return "", ErrNotFound
+		}
+		name = names[len(names)-1]
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(dbPath), ".restore-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(name))
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	err = cfg.Target.Get(ctx, name, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", name, err)
+	}
+
+	if strings.HasSuffix(path, ".age") {
+		if cfg.AgeIdentity == "" {
+			return "", errors.New("backup is encrypted: set BACKUP_AGE_IDENTITY to the age key file")
+		}
+		if path, err = decryptFile(path, cfg.AgeIdentity); err != nil {
+			return "", err
+		}
+	}
+	if strings.HasSuffix(path, ".gz") {
+		if path, err = gunzipFile(path); err != nil {
+			return "", err
+		}
+	}
+	if err := verify(ctx, path); err != nil {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	if _, err := os.Stat(dbPath); err == nil {
+		unlock, err := lockDatabase(ctx, dbPath)
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+		// Locking folded the -wal file into the database; any -wal or -shm file still there
+		// belongs to the old database and would be replayed into the restored one.
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			err := os.Rename(dbPath+suffix, dbPath+".before-restore-"+stamp+suffix)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	}
+	if err := os.Rename(path, dbPath); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// lockDatabase takes an exclusive lock on the database at path, failing with ErrDatabaseInUse
+// instead of waiting when another connection has it open. Leaving WAL mode needs that lock and
+// checkpoints and removes the -wal and -shm files; the exclusive locking mode keeps the lock
+// until the returned func closes the connection.
+func lockDatabase(ctx context.Context, path string) (func(), error) {
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	for _, pragma := range []string{
+		"PRAGMA busy_timeout = 0",
+		"PRAGMA locking_mode = EXCLUSIVE",
+		"PRAGMA journal_mode = DELETE",
+		"BEGIN EXCLUSIVE",
+	} {
+		if _, err := db.ExecContext(ctx, pragma); err != nil {
+			db.Close()
+			var sqliteErr *sqlite.Error
+			if errors.As(err, &sqliteErr) && sqliteErr.Code()&0xff == sqlite3.SQLITE_BUSY {
+				return nil, ErrDatabaseInUse
+			}
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+	}
+	return func() {
+		db.ExecContext(ctx, "ROLLBACK")
+		db.Close()
+	}, nil
+}
+
+// verify checks that the database file at path is intact and is a farm-manager database.
+func verify(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+	var n int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(1) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("not a farm-manager database: no schema_migrations table")
+	}
+	return nil
+}
+
+func gzipFile(path string) (string, error) {
+	out := path + ".gz"
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		return "", err
+	}
+	if err := zw.Close(); err != nil {
+		return "", err
+	}
+	return out, dst.Close()
+}
+
+func gunzipFile(path string) (string, error) {
+	out := strings.TrimSuffix(path, ".gz")
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		return "", fmt.Errorf("decompress: %w", err)
+	}
+	dst, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, zr); err != nil {
+		return "", fmt.Errorf("decompress: %w", err)
+	}
+	return out, dst.Close()
+}
+
+// encryptFile encrypts the file at path to the age recipients, one per line, into path.age.
+func encryptFile(path, recipients string) (string, error) {
+	rs, err := age.ParseRecipients(strings.NewReader(recipients))
+	if err != nil {
+		return "", fmt.Errorf("age recipient: %w", err)
+	}
+	out := path + ".age"
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	dst, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	w, err := age.Encrypt(dst, rs...)
+	if err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("encrypt: %w", err)
+	}
+	return out, dst.Close()
+}
+
+// decryptFile decrypts the file at path, which ends in .age, with the identities in the age key
+// file identityFile.
+func decryptFile(path, identityFile string) (string, error) {
+	keys, err := os.Open(identityFile)
+	if err != nil {
+		return "", err
+	}
+	defer keys.Close()
+	ids, err := age.ParseIdentities(keys)
+	if err != nil {
+		return "", fmt.Errorf("age identity %s: %w", identityFile, err)
+	}
+	out := strings.TrimSuffix(path, ".age")
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	r, err := age.Decrypt(src, ids...)
+	if err != nil {
+		return "", fmt.Errorf("decrypt: %w", err)
+	}
+	dst, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, r); err != nil {
+		return "", fmt.Errorf("decrypt: %w", err)
+	}
+	return out, dst.Close()
+}
@@ -0,0 +1,237 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+
+	appdb "github.com/cr1cr1/farm-manager/internal/db"
+)
+
+// openDB opens a migrated file database at a temporary path, returning it with the path.
+func openDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.db")
+	t.Setenv("SQLITE_DSN", "file:"+path+"?mode=rwc")
+	ctx := context.Background()
+	db, err := appdb.Open(ctx)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := appdb.Migrate(ctx, db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db, path
+}
+
+func barnNames(t *testing.T, path string) []string {
+	t.Helper()
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT name FROM barns ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestRunAndRestore_RoundTripsThroughADirectory(t *testing.T) {
+	ctx := context.Background()
+	db, path := openDB(t)
+	cfg := Config{Target: DirTarget{Dir: t.TempDir()}, Keep: 5, Gzip: true}
+
+	if _, err := db.Exec(`INSERT INTO barns (name, created_at, updated_at) VALUES ('North', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	name, err := Run(ctx, db, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.HasPrefix(name, namePrefix) || !strings.HasSuffix(name, ".db.gz") {
+		t.Errorf("backup name = %q", name)
+	}
+	// Written after the backup, so gone once it is restored.
+	if _, err := db.Exec(`INSERT INTO barns (name, created_at, updated_at) VALUES ('South', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := appdb.Close(db); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Restore(ctx, cfg, "latest", path)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored != name {
+		t.Errorf("restored %q, want the newest backup %q", restored, name)
+	}
+	if got := barnNames(t, path); len(got) != 1 || got[0] != "North" {
+		t.Errorf("barns after restore = %v, want [North]", got)
+	}
+	kept, _ := filepath.Glob(path + ".before-restore-*")
+	if len(kept) == 0 {
+		t.Error("the replaced database was not kept")
+	}
+}
+
+func TestRestore_RefusesACorruptBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := Config{Target: DirTarget{Dir: dir}}
+	path := filepath.Join(t.TempDir(), "app.db")
+	if err := os.WriteFile(path, []byte("current"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bad := namePrefix + "20260101T000000Z.db"
+	if err := os.WriteFile(filepath.Join(dir, bad), []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(ctx, cfg, bad, path); err == nil {
+		t.Fatal("Restore accepted a corrupt backup")
+	}
+	if b, _ := os.ReadFile(path); string(b) != "current" {
+		t.Error("a failed restore replaced the database")
+	}
+}
+
+func TestPrune_KeepsTheNewest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	target := DirTarget{Dir: dir}
+	for _, name := range []string{
+		namePrefix + "20261017T020000Z.db.gz",
+		namePrefix + "20261019T020000Z.db.gz",
+		namePrefix + "20261018T020000Z.db.gz",
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Prune(ctx, target, 2); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	names, _ := target.List(ctx)
+	want := []string{namePrefix + "20261018T020000Z.db.gz", namePrefix + "20261019T020000Z.db.gz", "notes.txt"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("after prune = %v, want %v", names, want)
+	}
+}
+
+func TestRun_EncryptsWithAge(t *testing.T) {
+	ctx := context.Background()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, path := openDB(t)
+	cfg := Config{Target: DirTarget{Dir: t.TempDir()}, Gzip: true, AgeRecipient: identity.Recipient().String()}
+	name, err := Run(ctx, db, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.HasSuffix(name, ".db.gz.age") {
+		t.Errorf("backup name = %q", name)
+	}
+	appdb.Close(db)
+
+	if _, err := Restore(ctx, cfg, name, path); err == nil {
+		t.Error("restored an encrypted backup without an identity")
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFile := filepath.Join(t.TempDir(), "other.txt")
+	if err := os.WriteFile(otherFile, []byte(other.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg.AgeIdentity = otherFile
+	if _, err := Restore(ctx, cfg, name, path); err == nil {
+		t.Error("restored an encrypted backup with someone else's key")
+	}
+	cfg.AgeIdentity = keyFile
+	if _, err := Restore(ctx, cfg, name, path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+}
+
+func TestConfigFromEnv_RejectsABadAgeRecipient(t *testing.T) {
+	t.Setenv("BACKUP_AGE_RECIPIENT", "age1notakey")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("ConfigFromEnv accepted an invalid age recipient")
+	}
+}
+
+func TestRestore_RefusesWhileTheDatabaseIsOpen(t *testing.T) {
+	ctx := context.Background()
+	db, path := openDB(t)
+	cfg := Config{Target: DirTarget{Dir: t.TempDir()}}
+	if _, err := db.Exec(`INSERT INTO barns (name, created_at, updated_at) VALUES ('North', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+	name, err := Run(ctx, db, cfg)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO barns (name, created_at, updated_at) VALUES ('South', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// The running application keeps its connections, and with them the -wal file, open.
+	if _, err := Restore(ctx, cfg, name, path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("Restore of an open database = %v, want ErrDatabaseInUse", err)
+	}
+	if kept, _ := filepath.Glob(path + ".before-restore-*"); len(kept) != 0 {
+		t.Fatalf("a refused restore moved files aside: %v", kept)
+	}
+	if got := barnNames(t, path); len(got) != 2 {
+		t.Fatalf("barns after a refused restore = %v, want both", got)
+	}
+
+	if err := appdb.Close(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, cfg, name, path); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if got := barnNames(t, path); len(got) != 1 || got[0] != "North" {
+		t.Errorf("barns after restore = %v, want [North]", got)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(path + suffix); err == nil {
+			t.Errorf("%s of the old database left beside the restored one", suffix)
+		}
+	}
+}
+
+func TestRun_NeedsATarget(t *testing.T) {
+	if _, err := Run(context.Background(), nil, Config{}); !errors.Is(err, ErrNoTarget) {
+		t.Errorf("Run without a target = %v, want ErrNoTarget", err)
+	}
+}
@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The get-vanilla case of the AWS Signature Version 4 test suite.
+func TestSignV4_MatchesTheAWSTestSuite(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signV4(req, emptySHA256, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// fakeS3 is a bucket held in memory that answers the calls S3Target makes, rejecting unsigned
+// requests.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+		http.Error(w, "unsigned", http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/backups/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/backups":
+		type content struct{ Key string }
+		var list struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}
+		for k := range f.objects {
+			if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+				list.Contents = append(list.Contents, content{k})
+			}
+		}
+		sort.Slice(list.Contents, func(i, j int) bool { return list.Contents[i].Key < list.Contents[j].Key })
+		_ = xml.NewEncoder(w).Encode(list)
+	case r.Method == http.MethodPut:
+		f.objects[key], _ = io.ReadAll(r.Body)
+	case r.Method == http.MethodGet:
+		b, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(b)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Target_PutListGetDelete(t *testing.T) {
+	ctx := context.Background()
+	bucket := &fakeS3{objects: map[string][]byte{"other/file": []byte("x")}}
+	srv := httptest.NewServer(bucket)
+	defer srv.Close()
+	target := &S3Target{Endpoint: srv.URL, Bucket: "backups", Prefix: "farm/", AccessKey: "minio", SecretKey: "minio123"}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	if err := os.WriteFile(path, []byte("snapshot"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	name := namePrefix + "20261019T020000Z.db.gz"
+	if err := target.Put(ctx, name, path); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, ok := bucket.objects["farm/"+name]; !ok {
+		t.Fatalf("objects = %v, want the backup under the prefix", bucket.objects)
+	}
+
+	names, err := target.List(ctx)
+	if err != nil || len(names) != 1 || names[0] != name {
+		t.Fatalf("List = %v, %v; want [%s]", names, err, name)
+	}
+
+	var got strings.Builder
+	if err := target.Get(ctx, name, &got); err != nil || got.String() != "snapshot" {
+		t.Fatalf("Get = %q, %v", got.String(), err)
+	}
+	if err := target.Get(ctx, "missing", io.Discard); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing = %v, want ErrNotFound", err)
+	}
+
+	if err := target.Delete(ctx, name); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if names, _ := target.List(ctx); len(names) != 0 {
+		t.Errorf("List after delete = %v", names)
+	}
+}
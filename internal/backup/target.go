@@ -0,0 +1,101 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by a Target for a backup it does not hold.
+var ErrNotFound = errors.New("backup not found")
+
+// Target is where backups are kept: a local directory or an S3-compatible bucket.
+type Target interface {
+	// Put stores the file at path under name.
+	Put(ctx context.Context, name, path string) error
+	// Get writes the backup called name to w.
+	Get(ctx context.Context, name string, w io.Writer) error
+	// List returns the names of the stored backups.
+	List(ctx context.Context) ([]string, error)
+	// Delete removes the backup called name.
+	Delete(ctx context.Context, name string) error
+}
+
+// DirTarget keeps backups as files in a local directory, which may be a mounted network share.
+type DirTarget struct {
+	Dir string
+}
+
+func (d DirTarget) Put(ctx context.Context, name, path string) error {
+	if err := os.MkdirAll(d.Dir, 0o750); err != nil {
+		return err
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Write next to the final name and rename, so a half-copied file never looks like a backup.
+	tmp, err := os.CreateTemp(d.Dir, ".partial-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.Dir, name))
+}
+
+func (d DirTarget) Get(ctx context.Context, name string, w io.Writer) error {
+	f, err := os.Open(filepath.Join(d.Dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (d DirTarget) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d DirTarget) Delete(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(d.Dir, filepath.Base(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
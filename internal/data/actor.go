@@ -0,0 +1,44 @@
+package data
+
+import (
+	"context"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+type actorKey struct{}
+
+// WithActor returns a context whose writes are made by actor, the ID of the signed-in user.
+// Repositories record it as the creator or last editor of the records they write when the
+// caller has not set one.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the acting user ctx carries.
+func ActorFrom(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// actorID returns the acting user ctx carries, or nil when it carries none.
+func actorID(ctx context.Context) *string {
+	if actor, ok := ActorFrom(ctx); ok {
+		return &actor
+	}
+	return nil
+}
+
+// stampActor fills the unset created/updated by fields of a record with the acting user.
+func stampActor(ctx context.Context, audit *domain.AuditFields) {
+	actor, ok := ActorFrom(ctx)
+	if !ok {
+		return
+	}
+	if audit.CreatedBy == nil {
+		audit.CreatedBy = &actor
+	}
+	if audit.UpdatedBy == nil {
+		audit.UpdatedBy = &actor
+	}
+}
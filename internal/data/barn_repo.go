@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // BarnRepo defines operations for barn management.
@@ -25,7 +26,8 @@ type BarnRepo interface {
 }
 
 type SQLiteBarnRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteBarnRepo(db *sql.DB) *SQLiteBarnRepo {
@@ -33,9 +35,9 @@ func NewSQLiteBarnRepo(db *sql.DB) *SQLiteBarnRepo {
 }
 
 func (r *SQLiteBarnRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM barns WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM barns WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -43,13 +45,13 @@ func (r *SQLiteBarnRepo) Count(ctx context.Context) (int64, error) {
 
 func (r *SQLiteBarnRepo) List(ctx context.Context) ([]*domain.Barn, error) {
 	const q = `
-		SELECT barn_id, name, capacity, environment_control, maintenance_schedule, location,
+		SELECT barn_id, name, capacity, environment_control, maintenance_schedule, location, area_m2,
 			   created_at, updated_at, deleted_at, created_by, updated_by
 		FROM barns
-		WHERE deleted_at IS NULL
+		WHERE farm_id = ? AND deleted_at IS NULL
 		ORDER BY name
 	`
-	rows, err := r.DB.QueryContext(ctx, q)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +67,7 @@ func (r *SQLiteBarnRepo) List(ctx context.Context) ([]*domain.Barn, error) {
 			&barn.EnvironmentControl,
 			&barn.MaintenanceSchedule,
 			&barn.Location,
+			&barn.AreaM2,
 			&barn.Audit.CreatedAt,
 			&barn.Audit.UpdatedAt,
 			&barn.Audit.DeletedAt,
@@ -81,24 +84,26 @@ func (r *SQLiteBarnRepo) List(ctx context.Context) ([]*domain.Barn, error) {
 
 func (r *SQLiteBarnRepo) FindByID(ctx context.Context, id int64) (*domain.Barn, error) {
 	const q = `
-		SELECT barn_id, name, capacity, environment_control, maintenance_schedule, location,
-			   created_at, updated_at, deleted_at, created_by, updated_by
+		SELECT barn_id, name, capacity, environment_control, maintenance_schedule, location, area_m2,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
 		FROM barns
-		WHERE barn_id = ? AND deleted_at IS NULL
+		WHERE barn_id = ? AND farm_id = ? AND deleted_at IS NULL
 	`
 	var barn domain.Barn
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&barn.BarnID,
 		&barn.Name,
 		&barn.Capacity,
 		&barn.EnvironmentControl,
 		&barn.MaintenanceSchedule,
 		&barn.Location,
+		&barn.AreaM2,
 		&barn.Audit.CreatedAt,
 		&barn.Audit.UpdatedAt,
 		&barn.Audit.DeletedAt,
 		&barn.Audit.CreatedBy,
 		&barn.Audit.UpdatedBy,
+		&barn.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -108,20 +113,23 @@ func (r *SQLiteBarnRepo) FindByID(ctx context.Context, id int64) (*domain.Barn,
 
 func (r *SQLiteBarnRepo) Create(ctx context.Context, barn *domain.Barn) (int64, error) {
 	const q = `
-		INSERT INTO barns (name, capacity, environment_control, maintenance_schedule, location,
+		INSERT INTO barns (farm_id, name, capacity, environment_control, maintenance_schedule, location, area_m2,
 						   created_at, updated_at, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	now := time.Now()
 	barn.Audit.CreatedAt = now
 	barn.Audit.UpdatedAt = now
+	stampActor(ctx, &barn.Audit)
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		barn.Name,
 		barn.Capacity,
 		barn.EnvironmentControl,
 		barn.MaintenanceSchedule,
 		barn.Location,
+		barn.AreaM2,
 		barn.Audit.CreatedAt,
 		barn.Audit.UpdatedAt,
 		barn.Audit.CreatedBy,
@@ -130,34 +138,50 @@ func (r *SQLiteBarnRepo) Create(ctx context.Context, barn *domain.Barn) (int64,
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "barns", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteBarnRepo) Update(ctx context.Context, barn *domain.Barn) error {
 	const q = `
 		UPDATE barns
-		SET name = ?, capacity = ?, environment_control = ?, maintenance_schedule = ?, location = ?,
-			updated_at = ?, updated_by = ?
-		WHERE barn_id = ? AND deleted_at IS NULL
-	`
+		SET name = ?, capacity = ?, environment_control = ?, maintenance_schedule = ?, location = ?, area_m2 = ?,
+			updated_at = ?, updated_by = ?, version = version + 1
+		WHERE barn_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	barn.Audit.UpdatedAt = now
+	stampActor(ctx, &barn.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		barn.Name,
 		barn.Capacity,
 		barn.EnvironmentControl,
 		barn.MaintenanceSchedule,
 		barn.Location,
+		barn.AreaM2,
 		barn.Audit.UpdatedAt,
 		barn.Audit.UpdatedBy,
 		barn.BarnID,
-	)
-	return err
+		FarmFrom(ctx),
+		barn.Audit.Version,
+	).Scan(&barn.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "barns", "barn_id", barn.BarnID)
+	}
+	publish(ctx, r.Events, "barns", barn.BarnID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteBarnRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE barns SET deleted_at = ? WHERE barn_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE barns SET deleted_at = ? WHERE barn_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "barns", id, events.Deleted)
+	return nil
 }
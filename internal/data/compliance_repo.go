@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// ComplianceRepo defines operations for organic compliance rules and the facts they are evaluated against.
+type ComplianceRepo interface {
+	// ListRules returns all non-deleted compliance rules.
+	ListRules(ctx context.Context) ([]*domain.ComplianceRule, error)
+	// UpdateRule modifies the threshold, enabled flag and notes of a rule.
+	UpdateRule(ctx context.Context, rule *domain.ComplianceRule) error
+	// FlockFacts gathers barn, feed, treatment, outdoor access and slaughter data for a flock.
+	FlockFacts(ctx context.Context, flock *domain.Flock) (*domain.FlockComplianceFacts, error)
+}
+
+type SQLiteComplianceRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteComplianceRepo(db *sql.DB) *SQLiteComplianceRepo {
+	return &SQLiteComplianceRepo{DB: db}
+}
+
+func (r *SQLiteComplianceRepo) ListRules(ctx context.Context) ([]*domain.ComplianceRule, error) {
+	const q = `SELECT compliance_rule_id, code, name, threshold, enabled, notes, created_at, updated_at, deleted_at, created_by, updated_by, version FROM compliance_rules WHERE deleted_at IS NULL ORDER BY compliance_rule_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.ComplianceRule
+	for rows.Next() {
+		var item domain.ComplianceRule
+		err := rows.Scan(
+			&item.ComplianceRuleID,
+			&item.Code,
+			&item.Name,
+			&item.Threshold,
+			&item.Enabled,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.Audit.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteComplianceRepo) UpdateRule(ctx context.Context, rule *domain.ComplianceRule) error {
+	const q = `UPDATE compliance_rules SET threshold = ?, enabled = ?, notes = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE compliance_rule_id = ? AND deleted_at IS NULL` + versionCheck
+	rule.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &rule.Audit)
+
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
+		rule.Threshold,
+		boolToInt(rule.Enabled),
+		rule.Notes,
+		rule.Audit.UpdatedAt,
+		rule.Audit.UpdatedBy,
+		rule.ComplianceRuleID,
+		rule.Audit.Version,
+	).Scan(&rule.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "compliance_rules", "compliance_rule_id", rule.ComplianceRuleID)
+	}
+	publish(ctx, r.Events, "compliance_rules", rule.ComplianceRuleID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteComplianceRepo) FlockFacts(ctx context.Context, flock *domain.Flock) (*domain.FlockComplianceFacts, error) {
+	facts := &domain.FlockComplianceFacts{Flock: flock}
+
+	if flock.BarnID != nil {
+		const qBarn = `SELECT area_m2 FROM barns WHERE barn_id = ? AND deleted_at IS NULL`
+		if err := conn(ctx, r.DB).QueryRowContext(ctx, qBarn, *flock.BarnID).Scan(&facts.BarnAreaM2); err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+
+	// The same count of birds left as the dashboard's, so density and occupancy agree.
+	const qLive = `SELECT live FROM (` + liveBirds + ` AND f.flock_id = ?)`
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, qLive, flock.FlockID).Scan(&facts.LiveBirds); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	// Dates are stored as full timestamps; the first 10 characters are the calendar day.
+	const qOutdoor = `SELECT COUNT(DISTINCT substr(date, 1, 10)) FROM outdoor_access_records WHERE flock_id = ? AND deleted_at IS NULL`
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, qOutdoor, flock.FlockID).Scan(&facts.OutdoorAccessDays); err != nil {
+		return nil, err
+	}
+
+	const qFeed = `
+		SELECT ft.name, ft.organic_certified
+		FROM feed_types ft
+		WHERE ft.deleted_at IS NULL AND (
+			ft.feed_type_id = ? OR ft.feed_type_id IN (
+				SELECT feed_type_id FROM feeding_records WHERE flock_id = ? AND deleted_at IS NULL
+			)
+		)
+		ORDER BY ft.name
+	`
+	var flockFeedTypeID int64
+	if flock.FeedTypeID != nil {
+		flockFeedTypeID = *flock.FeedTypeID
+	}
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qFeed, flockFeedTypeID, flock.FlockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var organic bool
+		if err := rows.Scan(&name, &organic); err != nil {
+			return nil, err
+		}
+		facts.FeedTypesUsed = append(facts.FeedTypesUsed, name)
+		if !organic {
+			facts.NonOrganicFeedTypes = append(facts.NonOrganicFeedTypes, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	const qTreatments = `SELECT COUNT(1) FROM health_checks WHERE flock_id = ? AND deleted_at IS NULL AND TRIM(COALESCE(treatments_administered, '')) <> ''`
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, qTreatments, flock.FlockID).Scan(&facts.TreatmentCount); err != nil {
+		return nil, err
+	}
+
+	const qSlaughter = `
+		SELECT s.date
+		FROM slaughter_records s
+		JOIN production_batches b ON s.batch_id = b.batch_id AND b.deleted_at IS NULL
+		WHERE b.flock_id = ? AND s.deleted_at IS NULL
+	`
+	sRows, err := conn(ctx, r.DB).QueryContext(ctx, qSlaughter, flock.FlockID)
+	if err != nil {
+		return nil, err
+	}
+	defer sRows.Close()
+	for sRows.Next() {
+		var date *time.Time
+		if err := sRows.Scan(&date); err != nil {
+			return nil, err
+		}
+		facts.Slaughtered = true
+		if date != nil && flock.HatchDate != nil {
+			facts.SlaughterAgesDays = append(facts.SlaughterAgesDays, int(date.Sub(*flock.HatchDate).Hours()/24))
+		}
+	}
+	return facts, sRows.Err()
+}
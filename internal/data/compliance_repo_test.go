@@ -0,0 +1,96 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestComplianceRepo_FlockFacts(t *testing.T) {
+	ctx, db := openTestDB(t)
+	barns := NewSQLiteBarnRepo(db)
+	feedTypes := NewSQLiteFeedTypeRepo(db)
+	flocks := NewSQLiteFlockRepo(db)
+	outdoor := NewSQLiteOutdoorAccessRecordRepo(db)
+	repo := NewSQLiteComplianceRepo(db)
+
+	area := 100.0
+	barnID, err := barns.Create(ctx, &domain.Barn{Name: "North", AreaM2: &area})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	organicID, err := feedTypes.Create(ctx, &domain.FeedType{Name: "Organic grower", OrganicCertified: true})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+	conventionalID, err := feedTypes.Create(ctx, &domain.FeedType{Name: "Conventional"})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+
+	hatch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	birds := 500
+	flockID, err := flocks.Create(ctx, &domain.Flock{Breed: "Bronze", HatchDate: &hatch, NumberOfBirds: &birds, BarnID: &barnID, FeedTypeID: &organicID})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO feeding_records (flock_id, feed_type_id, amount_given) VALUES (?, ?, 10)`, []any{flockID, conventionalID}},
+		{`INSERT INTO mortality_records (flock_id, number_dead) VALUES (?, 20)`, []any{flockID}},
+		{`INSERT INTO health_checks (flock_id, treatments_administered) VALUES (?, 'Antibiotic')`, []any{flockID}},
+		{`INSERT INTO health_checks (flock_id, treatments_administered) VALUES (?, '')`, []any{flockID}},
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (1, ?)`, []any{flockID}},
+		{`INSERT INTO slaughter_records (batch_id, date, number_slaughtered) VALUES (1, ?, 100)`, []any{hatch.AddDate(0, 0, 150)}},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+	for _, d := range []time.Time{hatch.AddDate(0, 0, 30), hatch.AddDate(0, 0, 30), hatch.AddDate(0, 0, 31)} {
+		if _, err := outdoor.Create(ctx, &domain.OutdoorAccessRecord{FlockID: flockID, Date: d}); err != nil {
+			t.Fatalf("create outdoor access: %v", err)
+		}
+	}
+
+	flock, err := flocks.FindByID(ctx, flockID)
+	if err != nil {
+		t.Fatalf("find flock: %v", err)
+	}
+	facts, err := repo.FlockFacts(ctx, flock)
+	if err != nil {
+		t.Fatalf("flock facts: %v", err)
+	}
+
+	if facts.BarnAreaM2 == nil || *facts.BarnAreaM2 != area {
+		t.Fatalf("unexpected barn area: %v", facts.BarnAreaM2)
+	}
+	// 500 placed, 20 found dead and 100 slaughtered.
+	if facts.LiveBirds != 380 {
+		t.Fatalf("expected 380 live birds, got %d", facts.LiveBirds)
+	}
+	if facts.OutdoorAccessDays != 2 {
+		t.Fatalf("expected 2 distinct outdoor days, got %d", facts.OutdoorAccessDays)
+	}
+	if len(facts.FeedTypesUsed) != 2 || len(facts.NonOrganicFeedTypes) != 1 || facts.NonOrganicFeedTypes[0] != "Conventional" {
+		t.Fatalf("unexpected feed facts: used=%v non-organic=%v", facts.FeedTypesUsed, facts.NonOrganicFeedTypes)
+	}
+	if facts.TreatmentCount != 1 {
+		t.Fatalf("expected 1 treatment, got %d", facts.TreatmentCount)
+	}
+	if !facts.Slaughtered || len(facts.SlaughterAgesDays) != 1 || facts.SlaughterAgesDays[0] != 150 {
+		t.Fatalf("unexpected slaughter facts: %v %v", facts.Slaughtered, facts.SlaughterAgesDays)
+	}
+
+	rules, err := repo.ListRules(ctx)
+	if err != nil {
+		t.Fatalf("list rules: %v", err)
+	}
+	if len(rules) != 5 {
+		t.Fatalf("expected 5 seeded rules, got %d", len(rules))
+	}
+}
@@ -0,0 +1,174 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// CustomerAccountRepo defines operations for customer portal accounts.
+type CustomerAccountRepo interface {
+	// ListByCustomer returns the portal accounts of a customer.
+	ListByCustomer(ctx context.Context, customerID int64) ([]*domain.CustomerAccount, error)
+	// FindByEmail returns the account signing in with email, with its customer's name.
+	FindByEmail(ctx context.Context, email string) (*domain.CustomerAccount, error)
+	// FindByID returns an account with its customer's name.
+	FindByID(ctx context.Context, id int64) (*domain.CustomerAccount, error)
+	// Create inserts an account with a pre-hashed password; a used email returns domain.ErrEmailTaken.
+	Create(ctx context.Context, a *domain.CustomerAccount) (int64, error)
+	// UpdatePassword replaces the password hash of an account.
+	UpdatePassword(ctx context.Context, id int64, hash string) error
+	// RecordLogin stamps the time of a successful sign-in.
+	RecordLogin(ctx context.Context, id int64, at time.Time) error
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+}
+
+type SQLiteCustomerAccountRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteCustomerAccountRepo(db *sql.DB) *SQLiteCustomerAccountRepo {
+	return &SQLiteCustomerAccountRepo{DB: db}
+}
+
+// customerAccountColumns are the account fields read by scanCustomerAccount.
+const customerAccountColumns = `a.customer_account_id, a.customer_id, a.email, a.password_hash, a.last_login_at,
+	a.created_at, a.updated_at, a.deleted_at, a.created_by, a.updated_by, c.name, c.farm_id`
+
+func (r *SQLiteCustomerAccountRepo) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.CustomerAccount, error) {
+	const q = `SELECT ` + customerAccountColumns + `
+		FROM customer_accounts a
+		JOIN customers c ON c.customer_id = a.customer_id
+		WHERE a.customer_id = ? AND a.deleted_at IS NULL
+		ORDER BY a.email`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.CustomerAccount
+	for rows.Next() {
+		item, err := scanCustomerAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteCustomerAccountRepo) FindByEmail(ctx context.Context, email string) (*domain.CustomerAccount, error) {
+	// Accounts of deleted customers can no longer sign in.
+	const q = `SELECT ` + customerAccountColumns + `
+		FROM customer_accounts a
+		JOIN customers c ON c.customer_id = a.customer_id AND c.deleted_at IS NULL
+		WHERE a.email = ? AND a.deleted_at IS NULL`
+	return scanCustomerAccount(conn(ctx, r.DB).QueryRowContext(ctx, q, normalizeEmail(email)))
+}
+
+func (r *SQLiteCustomerAccountRepo) FindByID(ctx context.Context, id int64) (*domain.CustomerAccount, error) {
+	const q = `SELECT ` + customerAccountColumns + `
+		FROM customer_accounts a
+		JOIN customers c ON c.customer_id = a.customer_id AND c.deleted_at IS NULL
+		WHERE a.customer_account_id = ? AND a.deleted_at IS NULL`
+	return scanCustomerAccount(conn(ctx, r.DB).QueryRowContext(ctx, q, id))
+}
+
+func (r *SQLiteCustomerAccountRepo) Create(ctx context.Context, a *domain.CustomerAccount) (int64, error) {
+	const qTaken = `SELECT COUNT(1) FROM customer_accounts WHERE email = ? AND deleted_at IS NULL`
+	const q = `INSERT INTO customer_accounts (customer_id, email, password_hash, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	a.Email = normalizeEmail(a.Email)
+	a.Audit.TouchCreated(time.Now())
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", a.CustomerID); err != nil {
+			return err
+		}
+		var taken int
+		if err := tx.QueryRowContext(ctx, qTaken, a.Email).Scan(&taken); err != nil {
+			return err
+		}
+		if taken > 0 {
+			return domain.ErrEmailTaken
+		}
+		result, err := tx.ExecContext(ctx, q,
+			a.CustomerID,
+			a.Email,
+			a.PasswordHash,
+			a.Audit.CreatedAt,
+			a.Audit.UpdatedAt,
+			a.Audit.CreatedBy,
+			a.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "customer_accounts", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteCustomerAccountRepo) UpdatePassword(ctx context.Context, id int64, hash string) error {
+	const q = `UPDATE customer_accounts SET password_hash = ?, updated_at = ? WHERE customer_account_id = ? AND deleted_at IS NULL`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, hash, time.Now(), id); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customer_accounts", id, events.Updated)
+	return nil
+}
+
+func (r *SQLiteCustomerAccountRepo) RecordLogin(ctx context.Context, id int64, at time.Time) error {
+	const q = `UPDATE customer_accounts SET last_login_at = ? WHERE customer_account_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, at, id)
+	return err
+}
+
+func (r *SQLiteCustomerAccountRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE customer_accounts SET deleted_at = ? WHERE customer_account_id = ?
+		AND customer_id IN (SELECT customer_id FROM customers WHERE farm_id = ?)`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx)); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customer_accounts", id, events.Deleted)
+	return nil
+}
+
+// scanCustomerAccount reads one row of customerAccountColumns.
+func scanCustomerAccount(row interface{ Scan(...any) error }) (*domain.CustomerAccount, error) {
+	var item domain.CustomerAccount
+	err := row.Scan(
+		&item.CustomerAccountID,
+		&item.CustomerID,
+		&item.Email,
+		&item.PasswordHash,
+		&item.LastLoginAt,
+		&item.Audit.CreatedAt,
+		&item.Audit.UpdatedAt,
+		&item.Audit.DeletedAt,
+		&item.Audit.CreatedBy,
+		&item.Audit.UpdatedBy,
+		&item.CustomerName,
+		&item.FarmID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// normalizeEmail compares email addresses case-insensitively.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestCustomerAccountRepo_EmailIsUnique(t *testing.T) {
+	ctx, db := openTestDB(t)
+	accounts := NewSQLiteCustomerAccountRepo(db)
+
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, &domain.Customer{Name: "Butcher"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	id, err := accounts.Create(ctx, &domain.CustomerAccount{CustomerID: customerID, Email: " Shop@Example.com ", PasswordHash: "x"})
+	if err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	if _, err := accounts.Create(ctx, &domain.CustomerAccount{CustomerID: customerID, Email: "shop@example.COM", PasswordHash: "y"}); !errors.Is(err, domain.ErrEmailTaken) {
+		t.Fatalf("duplicate email: got %v, want ErrEmailTaken", err)
+	}
+
+	account, err := accounts.FindByEmail(ctx, "SHOP@example.com")
+	if err != nil {
+		t.Fatalf("find by email: %v", err)
+	}
+	if account.CustomerAccountID != id || account.CustomerName != "Butcher" || account.Email != "shop@example.com" {
+		t.Errorf("account = %+v", account)
+	}
+
+	// A revoked account frees its email and can no longer sign in.
+	if err := accounts.SoftDelete(ctx, id, time.Now()); err != nil {
+		t.Fatalf("delete account: %v", err)
+	}
+	if _, err := accounts.FindByEmail(ctx, "shop@example.com"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revoked account: got %v, want ErrNotFound", err)
+	}
+	if _, err := accounts.Create(ctx, &domain.CustomerAccount{CustomerID: customerID, Email: "shop@example.com", PasswordHash: "z"}); err != nil {
+		t.Fatalf("recreate account: %v", err)
+	}
+}
+
+func TestOrderRepo_PlacePortalOrder(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	customers := NewSQLiteCustomerRepo(db)
+
+	customerID, err := customers.Create(ctx, &domain.Customer{Name: "Butcher"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	otherID, err := customers.Create(ctx, &domain.Customer{Name: "Restaurant"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "BR", Name: "Breast", Unit: "kg", VATRate: 9, Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	if _, err := orders.Create(ctx, &domain.Order{CustomerID: otherID}); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	orderID, err := orders.Place(ctx, &domain.Order{CustomerID: customerID, Source: domain.OrderSourcePortal}, []*domain.OrderItem{
+		{ProductID: &productID, Quantity: f(2), UnitPrice: f(10), VATRate: 9},
+	})
+	if err != nil {
+		t.Fatalf("place order: %v", err)
+	}
+
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if order.Status != domain.OrderStatusDraft || order.Source != domain.OrderSourcePortal {
+		t.Errorf("order status/source = %s/%s, want draft/portal", order.Status, order.Source)
+	}
+	if order.SubtotalAmount != 20 || order.VATAmount != 1.8 || order.TotalAmount == nil || *order.TotalAmount != 21.8 {
+		t.Errorf("order totals = %v/%v/%v, want 20/1.8/21.8", order.SubtotalAmount, order.VATAmount, order.TotalAmount)
+	}
+	lines, err := NewSQLiteOrderItemRepo(db).ListByOrder(ctx, orderID)
+	if err != nil || len(lines) != 1 {
+		t.Fatalf("lines = %v, %v; want one", lines, err)
+	}
+
+	mine, err := orders.ListByCustomer(ctx, customerID)
+	if err != nil {
+		t.Fatalf("list by customer: %v", err)
+	}
+	if len(mine) != 1 || mine[0].OrderID != orderID {
+		t.Errorf("customer orders = %+v, want only the placed order", mine)
+	}
+}
@@ -0,0 +1,384 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// CustomerCRMRepo defines operations for the contacts, addresses and communication log of
+// customers. Address writes keep customers.delivery_address and customers.billing_address equal
+// to the default address of each kind.
+//
+// Contacts and addresses carry no version: they are only added and removed, never edited, so
+// there is no form whose save could overwrite someone else's. Removing one already removed
+// fails with ErrNotFound, and choosing a default address is a single pick where the last one
+// is the one meant.
+type CustomerCRMRepo interface {
+	// Details loads the contacts, addresses and communication log of a customer.
+	Details(ctx context.Context, customerID int64) (*domain.CustomerDetails, error)
+	CreateContact(ctx context.Context, c *domain.CustomerContact) (int64, error)
+	DeleteContact(ctx context.Context, customerID, contactID int64, deletedAt time.Time) error
+	// CreateAddress adds an address; it becomes the default of its kind when asked to or when
+	// the customer has no default of that kind yet.
+	CreateAddress(ctx context.Context, a *domain.CustomerAddress) (int64, error)
+	// SetDefaultAddress makes an address the default of its kind.
+	SetDefaultAddress(ctx context.Context, customerID, addressID int64) error
+	// DeleteAddress removes an address; when it was the default, the oldest remaining address
+	// of its kind takes over.
+	DeleteAddress(ctx context.Context, customerID, addressID int64, deletedAt time.Time) error
+	// CreateCommunication logs a communication; ErrNotFound when the contact is not the
+	// customer's.
+	CreateCommunication(ctx context.Context, c *domain.CustomerCommunication) (int64, error)
+}
+
+type SQLiteCustomerCRMRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteCustomerCRMRepo(db *sql.DB) *SQLiteCustomerCRMRepo {
+	return &SQLiteCustomerCRMRepo{DB: db}
+}
+
+func (r *SQLiteCustomerCRMRepo) Details(ctx context.Context, customerID int64) (*domain.CustomerDetails, error) {
+	details := &domain.CustomerDetails{}
+	var err error
+	if details.Contacts, err = r.listContacts(ctx, customerID); err != nil {
+		return nil, err
+	}
+	if details.Addresses, err = r.listAddresses(ctx, customerID); err != nil {
+		return nil, err
+	}
+	if details.Communications, err = r.listCommunications(ctx, customerID); err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+func (r *SQLiteCustomerCRMRepo) listContacts(ctx context.Context, customerID int64) ([]*domain.CustomerContact, error) {
+	const q = `SELECT customer_contact_id, customer_id, name, role, phone, email, created_at, updated_at, deleted_at, created_by, updated_by
+		FROM customer_contacts WHERE customer_id = ? AND deleted_at IS NULL ORDER BY name, customer_contact_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.CustomerContact
+	for rows.Next() {
+		var item domain.CustomerContact
+		err := rows.Scan(
+			&item.CustomerContactID,
+			&item.CustomerID,
+			&item.Name,
+			&item.Role,
+			&item.Phone,
+			&item.Email,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteCustomerCRMRepo) listAddresses(ctx context.Context, customerID int64) ([]*domain.CustomerAddress, error) {
+	const q = `SELECT customer_address_id, customer_id, kind, label, address, is_default, created_at, updated_at, deleted_at, created_by, updated_by
+		FROM customer_addresses WHERE customer_id = ? AND deleted_at IS NULL ORDER BY kind DESC, is_default DESC, customer_address_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.CustomerAddress
+	for rows.Next() {
+		var item domain.CustomerAddress
+		err := rows.Scan(
+			&item.CustomerAddressID,
+			&item.CustomerID,
+			&item.Kind,
+			&item.Label,
+			&item.Address,
+			&item.IsDefault,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteCustomerCRMRepo) listCommunications(ctx context.Context, customerID int64) ([]*domain.CustomerCommunication, error) {
+	const q = `SELECT m.customer_communication_id, m.customer_id, m.customer_contact_id, m.kind, m.occurred_at, m.subject, m.notes,
+		m.created_at, m.updated_at, m.deleted_at, m.created_by, m.updated_by, ct.name
+		FROM customer_communications m
+		LEFT JOIN customer_contacts ct ON ct.customer_contact_id = m.customer_contact_id
+		WHERE m.customer_id = ? AND m.deleted_at IS NULL
+		ORDER BY m.occurred_at DESC, m.customer_communication_id DESC`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.CustomerCommunication
+	for rows.Next() {
+		var item domain.CustomerCommunication
+		err := rows.Scan(
+			&item.CustomerCommunicationID,
+			&item.CustomerID,
+			&item.CustomerContactID,
+			&item.Kind,
+			&item.OccurredAt,
+			&item.Subject,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.ContactName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteCustomerCRMRepo) CreateContact(ctx context.Context, c *domain.CustomerContact) (int64, error) {
+	const q = `INSERT INTO customer_contacts (customer_id, name, role, phone, email, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	c.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &c.Audit)
+
+	if err := onFarm(ctx, conn(ctx, r.DB), "customers", "customer_id", c.CustomerID); err != nil {
+		return 0, err
+	}
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		c.CustomerID,
+		c.Name,
+		c.Role,
+		c.Phone,
+		c.Email,
+		c.Audit.CreatedAt,
+		c.Audit.UpdatedAt,
+		c.Audit.CreatedBy,
+		c.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "customers", c.CustomerID, events.Updated)
+	return id, nil
+}
+
+func (r *SQLiteCustomerCRMRepo) DeleteContact(ctx context.Context, customerID, contactID int64, deletedAt time.Time) error {
+	const q = `UPDATE customer_contacts SET deleted_at = ? WHERE customer_contact_id = ? AND customer_id = ? AND deleted_at IS NULL`
+	if err := onFarm(ctx, conn(ctx, r.DB), "customers", "customer_id", customerID); err != nil {
+		return err
+	}
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, contactID, customerID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	publish(ctx, r.Events, "customers", customerID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteCustomerCRMRepo) CreateAddress(ctx context.Context, a *domain.CustomerAddress) (int64, error) {
+	const qHasDefault = `SELECT COUNT(1) FROM customer_addresses WHERE customer_id = ? AND kind = ? AND is_default = 1 AND deleted_at IS NULL`
+	const q = `INSERT INTO customer_addresses (customer_id, kind, label, address, is_default, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?)`
+	a.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &a.Audit)
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", a.CustomerID); err != nil {
+			return err
+		}
+		var defaults int
+		if err := tx.QueryRowContext(ctx, qHasDefault, a.CustomerID, a.Kind).Scan(&defaults); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q,
+			a.CustomerID,
+			a.Kind,
+			a.Label,
+			a.Address,
+			a.Audit.CreatedAt,
+			a.Audit.UpdatedAt,
+			a.Audit.CreatedBy,
+			a.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		a.IsDefault = a.IsDefault || defaults == 0
+		if !a.IsDefault {
+			return nil
+		}
+		return setDefaultAddress(ctx, tx, a.CustomerID, a.Kind, id)
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "customers", a.CustomerID, events.Updated)
+	return id, nil
+}
+
+func (r *SQLiteCustomerCRMRepo) SetDefaultAddress(ctx context.Context, customerID, addressID int64) error {
+	const q = `SELECT kind FROM customer_addresses WHERE customer_address_id = ? AND customer_id = ? AND deleted_at IS NULL`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", customerID); err != nil {
+			return err
+		}
+		var kind domain.AddressKind
+		if err := tx.QueryRowContext(ctx, q, addressID, customerID).Scan(&kind); err != nil {
+			return err
+		}
+		return setDefaultAddress(ctx, tx, customerID, kind, addressID)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customers", customerID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteCustomerCRMRepo) DeleteAddress(ctx context.Context, customerID, addressID int64, deletedAt time.Time) error {
+	const q = `SELECT kind, is_default FROM customer_addresses WHERE customer_address_id = ? AND customer_id = ? AND deleted_at IS NULL`
+	const qDelete = `UPDATE customer_addresses SET deleted_at = ?, is_default = 0 WHERE customer_address_id = ?`
+	const qOldest = `SELECT customer_address_id FROM customer_addresses WHERE customer_id = ? AND kind = ? AND deleted_at IS NULL ORDER BY customer_address_id LIMIT 1`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", customerID); err != nil {
+			return err
+		}
+		var kind domain.AddressKind
+		var wasDefault bool
+		if err := tx.QueryRowContext(ctx, q, addressID, customerID).Scan(&kind, &wasDefault); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, qDelete, deletedAt, addressID); err != nil {
+			return err
+		}
+		if !wasDefault {
+			return nil
+		}
+		var next int64
+		err := tx.QueryRowContext(ctx, qOldest, customerID, kind).Scan(&next)
+		if err == sql.ErrNoRows {
+			return syncDefaultAddress(ctx, tx, customerID, kind)
+		}
+		if err != nil {
+			return err
+		}
+		return setDefaultAddress(ctx, tx, customerID, kind, next)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customers", customerID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteCustomerCRMRepo) CreateCommunication(ctx context.Context, c *domain.CustomerCommunication) (int64, error) {
+	const qContact = `SELECT COUNT(1) FROM customer_contacts WHERE customer_contact_id = ? AND customer_id = ? AND deleted_at IS NULL`
+	const q = `INSERT INTO customer_communications (customer_id, customer_contact_id, kind, occurred_at, subject, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	c.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &c.Audit)
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", c.CustomerID); err != nil {
+			return err
+		}
+		// The contact spoken to must be one of the customer's own.
+		if c.CustomerContactID != nil {
+			var n int
+			if err := tx.QueryRowContext(ctx, qContact, *c.CustomerContactID, c.CustomerID).Scan(&n); err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrNotFound
+			}
+		}
+		result, err := tx.ExecContext(ctx, q,
+			c.CustomerID,
+			c.CustomerContactID,
+			c.Kind,
+			c.OccurredAt,
+			c.Subject,
+			c.Notes,
+			c.Audit.CreatedAt,
+			c.Audit.UpdatedAt,
+			c.Audit.CreatedBy,
+			c.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "customers", c.CustomerID, events.Updated)
+	return id, nil
+}
+
+// setDefaultAddress makes addressID the only default address of its kind and copies it onto the
+// customer.
+func setDefaultAddress(ctx context.Context, tx *sql.Tx, customerID int64, kind domain.AddressKind, addressID int64) error {
+	const qClear = `UPDATE customer_addresses SET is_default = 0 WHERE customer_id = ? AND kind = ? AND is_default = 1`
+	const qSet = `UPDATE customer_addresses SET is_default = 1 WHERE customer_address_id = ?`
+	if _, err := tx.ExecContext(ctx, qClear, customerID, kind); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, qSet, addressID); err != nil {
+		return err
+	}
+	return syncDefaultAddress(ctx, tx, customerID, kind)
+}
+
+// syncDefaultAddress copies the default address of a kind onto the customer, or clears it when
+// there is none.
+func syncDefaultAddress(ctx context.Context, tx *sql.Tx, customerID int64, kind domain.AddressKind) error {
+	column := "delivery_address"
+	if kind == domain.AddressKindBilling {
+		column = "billing_address"
+	}
+	q := `UPDATE customers SET ` + column + ` = (SELECT address FROM customer_addresses WHERE customer_id = ? AND kind = ? AND is_default = 1 AND deleted_at IS NULL) WHERE customer_id = ?`
+	_, err := tx.ExecContext(ctx, q, customerID, kind, customerID)
+	return err
+}
@@ -0,0 +1,158 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestCustomerCRMRepo_DefaultAddressFollowsCustomer(t *testing.T) {
+	ctx, db := openTestDB(t)
+	customers := NewSQLiteCustomerRepo(db)
+	crm := NewSQLiteCustomerCRMRepo(db)
+
+	shop := "Market Square 3"
+	customerID, err := customers.Create(ctx, &domain.Customer{Name: "Butcher", DeliveryAddress: &shop})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	wantAddresses := func(delivery, billing string) {
+		t.Helper()
+		c, err := customers.FindByID(ctx, customerID)
+		if err != nil {
+			t.Fatalf("find customer: %v", err)
+		}
+		if got := deref(c.DeliveryAddress); got != delivery {
+			t.Errorf("delivery address = %q, want %q", got, delivery)
+		}
+		if got := deref(c.BillingAddress); got != billing {
+			t.Errorf("billing address = %q, want %q", got, billing)
+		}
+	}
+	wantAddresses(shop, "")
+
+	// The first billing address becomes the default; a later delivery address only when asked.
+	if _, err := crm.CreateAddress(ctx, &domain.CustomerAddress{CustomerID: customerID, Kind: domain.AddressKindBilling, Address: "Office 1"}); err != nil {
+		t.Fatalf("create billing address: %v", err)
+	}
+	warehouseID, err := crm.CreateAddress(ctx, &domain.CustomerAddress{CustomerID: customerID, Kind: domain.AddressKindDelivery, Address: "Warehouse 7"})
+	if err != nil {
+		t.Fatalf("create delivery address: %v", err)
+	}
+	wantAddresses(shop, "Office 1")
+
+	if err := crm.SetDefaultAddress(ctx, customerID, warehouseID); err != nil {
+		t.Fatalf("set default: %v", err)
+	}
+	wantAddresses("Warehouse 7", "Office 1")
+
+	// Removing the default hands over to the remaining delivery address, then to none.
+	if err := crm.DeleteAddress(ctx, customerID, warehouseID, time.Now()); err != nil {
+		t.Fatalf("delete address: %v", err)
+	}
+	wantAddresses(shop, "Office 1")
+
+	details, err := crm.Details(ctx, customerID)
+	if err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	for _, a := range details.Addresses {
+		if a.Kind == domain.AddressKindDelivery {
+			if err := crm.DeleteAddress(ctx, customerID, a.CustomerAddressID, time.Now()); err != nil {
+				t.Fatalf("delete address: %v", err)
+			}
+		}
+	}
+	wantAddresses("", "Office 1")
+
+	if err := crm.SetDefaultAddress(ctx, customerID+1, warehouseID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("default address of another customer: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestCustomerRepo_SearchByTagAndType(t *testing.T) {
+	ctx, db := openTestDB(t)
+	customers := NewSQLiteCustomerRepo(db)
+	crm := NewSQLiteCustomerCRMRepo(db)
+
+	restaurant := domain.CustomerTypeRestaurant
+	bistroID, err := customers.Create(ctx, &domain.Customer{Name: "Bistro", CustomerType: &restaurant, Tags: []string{"organic", "weekly"}})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	if _, err := customers.Create(ctx, &domain.Customer{Name: "Shop", Tags: []string{"weekly"}}); err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	names := func(filter domain.CustomerFilter) []string {
+		t.Helper()
+		list, err := customers.Search(ctx, filter)
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		var out []string
+		for _, c := range list {
+			out = append(out, c.Name)
+		}
+		return out
+	}
+	if got := names(domain.CustomerFilter{Tag: "weekly"}); len(got) != 2 {
+		t.Errorf("weekly = %v, want both", got)
+	}
+	if got := names(domain.CustomerFilter{Tag: "Organic"}); len(got) != 1 || got[0] != "Bistro" {
+		t.Errorf("organic = %v, want Bistro", got)
+	}
+	if got := names(domain.CustomerFilter{Tag: "weekly", Type: restaurant}); len(got) != 1 || got[0] != "Bistro" {
+		t.Errorf("weekly restaurants = %v, want Bistro", got)
+	}
+
+	// Updating replaces the tags.
+	bistro, err := customers.FindByID(ctx, bistroID)
+	if err != nil {
+		t.Fatalf("find customer: %v", err)
+	}
+	if len(bistro.Tags) != 2 || bistro.Tags[0] != "organic" {
+		t.Errorf("tags = %v, want [organic weekly]", bistro.Tags)
+	}
+	bistro.Tags = []string{"vip"}
+	if err := customers.Update(ctx, bistro); err != nil {
+		t.Fatalf("update customer: %v", err)
+	}
+	tags, err := customers.ListTags(ctx)
+	if err != nil {
+		t.Fatalf("list tags: %v", err)
+	}
+	if len(tags) != 2 || tags[0] != "vip" || tags[1] != "weekly" {
+		t.Errorf("tags in use = %v, want [vip weekly]", tags)
+	}
+
+	// The log only links contacts of the same customer.
+	contactID, err := crm.CreateContact(ctx, &domain.CustomerContact{CustomerID: bistroID, Name: "Chef"})
+	if err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	entry := &domain.CustomerCommunication{CustomerID: bistroID + 1, CustomerContactID: &contactID, Kind: domain.CommunicationComplaint, OccurredAt: time.Now(), Subject: "Late"}
+	if _, err := crm.CreateCommunication(ctx, entry); !errors.Is(err, ErrNotFound) {
+		t.Errorf("foreign contact: got %v, want ErrNotFound", err)
+	}
+	entry.CustomerID = bistroID
+	if _, err := crm.CreateCommunication(ctx, entry); err != nil {
+		t.Fatalf("log communication: %v", err)
+	}
+	details, err := crm.Details(ctx, bistroID)
+	if err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	if len(details.Communications) != 1 || deref(details.Communications[0].ContactName) != "Chef" {
+		t.Errorf("communications = %+v", details.Communications)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -3,41 +3,72 @@ package data
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // CustomerRepo defines operations for customer management.
+// The delivery and billing addresses of a customer are copies of its default addresses; they
+// are only written through CustomerCRMRepo.
 type CustomerRepo interface {
 	Count(ctx context.Context) (int64, error)
 	List(ctx context.Context) ([]*domain.Customer, error)
+	// Search lists the customers matching the filter.
+	Search(ctx context.Context, filter domain.CustomerFilter) ([]*domain.Customer, error)
+	// ListTags returns every tag in use, sorted.
+	ListTags(ctx context.Context) ([]string, error)
 	FindByID(ctx context.Context, id int64) (*domain.Customer, error)
+	// Create inserts the customer with its tags; a delivery address becomes its default
+	// delivery address.
 	Create(ctx context.Context, c *domain.Customer) (int64, error)
 	Update(ctx context.Context, c *domain.Customer) error
 	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
 }
 
 type SQLiteCustomerRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteCustomerRepo(db *sql.DB) *SQLiteCustomerRepo {
 	return &SQLiteCustomerRepo{DB: db}
 }
 
+// customerColumns lists the columns scanCustomer reads, tags last as a comma separated list.
+const customerColumns = `c.customer_id, c.name, c.contact_info, c.delivery_address, c.billing_address, c.customer_type, c.vat_number, c.latitude, c.longitude,
+	c.created_at, c.updated_at, c.deleted_at, c.created_by, c.updated_by, c.version,
+	(SELECT GROUP_CONCAT(t.tag) FROM (SELECT tag FROM customer_tags WHERE customer_id = c.customer_id ORDER BY tag) t)`
+
 func (r *SQLiteCustomerRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM customers WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM customers WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteCustomerRepo) List(ctx context.Context) ([]*domain.Customer, error) {
-	const q = `SELECT customer_id, name, contact_info, delivery_address, customer_type, created_at, updated_at, deleted_at, created_by, updated_by FROM customers WHERE deleted_at IS NULL ORDER BY customer_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	return r.Search(ctx, domain.CustomerFilter{})
+}
+
+func (r *SQLiteCustomerRepo) Search(ctx context.Context, filter domain.CustomerFilter) ([]*domain.Customer, error) {
+	q := `SELECT ` + customerColumns + ` FROM customers c WHERE c.farm_id = ? AND c.deleted_at IS NULL`
+	args := []any{FarmFrom(ctx)}
+	if filter.Tag != "" {
+		q += ` AND EXISTS (SELECT 1 FROM customer_tags t WHERE t.customer_id = c.customer_id AND t.tag = ?)`
+		args = append(args, strings.ToLower(filter.Tag))
+	}
+	if filter.Type != "" {
+		q += ` AND c.customer_type = ?`
+		args = append(args, filter.Type)
+	}
+	q += ` ORDER BY c.customer_id`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,89 +76,168 @@ func (r *SQLiteCustomerRepo) List(ctx context.Context) ([]*domain.Customer, erro
 
 	var items []*domain.Customer
 	for rows.Next() {
-		var item domain.Customer
-		err := rows.Scan(
-			&item.CustomerID,
-			&item.Name,
-			&item.ContactInfo,
-			&item.DeliveryAddress,
-			&item.CustomerType,
-			&item.Audit.CreatedAt,
-			&item.Audit.UpdatedAt,
-			&item.Audit.DeletedAt,
-			&item.Audit.CreatedBy,
-			&item.Audit.UpdatedBy,
-		)
+		item, err := scanCustomer(rows)
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, &item)
+		items = append(items, item)
 	}
 	return items, rows.Err()
 }
 
-func (r *SQLiteCustomerRepo) FindByID(ctx context.Context, id int64) (*domain.Customer, error) {
-	const q = `SELECT customer_id, name, contact_info, delivery_address, customer_type, created_at, updated_at, deleted_at, created_by, updated_by FROM customers WHERE customer_id = ? AND deleted_at IS NULL`
-	var item domain.Customer
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
-		&item.CustomerID,
-		&item.Name,
-		&item.ContactInfo,
-		&item.DeliveryAddress,
-		&item.CustomerType,
-		&item.Audit.CreatedAt,
-		&item.Audit.UpdatedAt,
-		&item.Audit.DeletedAt,
-		&item.Audit.CreatedBy,
-		&item.Audit.UpdatedBy,
-	)
+func (r *SQLiteCustomerRepo) ListTags(ctx context.Context) ([]string, error) {
+	const q = `SELECT DISTINCT t.tag FROM customer_tags t JOIN customers c ON c.customer_id = t.customer_id AND c.farm_id = ? AND c.deleted_at IS NULL ORDER BY t.tag`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
-	return &item, nil
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (r *SQLiteCustomerRepo) FindByID(ctx context.Context, id int64) (*domain.Customer, error) {
+	const q = `SELECT ` + customerColumns + ` FROM customers c WHERE c.customer_id = ? AND c.farm_id = ? AND c.deleted_at IS NULL`
+	return scanCustomer(conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)))
 }
 
 func (r *SQLiteCustomerRepo) Create(ctx context.Context, c *domain.Customer) (int64, error) {
-	const q = `INSERT INTO customers (name, contact_info, delivery_address, customer_type, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO customers (farm_id, name, contact_info, delivery_address, customer_type, vat_number, latitude, longitude, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const qAddress = `INSERT INTO customer_addresses (customer_id, kind, address, is_default, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, 1, ?, ?, ?, ?)`
 	now := time.Now()
 	c.Audit.CreatedAt = now
 	c.Audit.UpdatedAt = now
+	stampActor(ctx, &c.Audit)
 
-	result, err := r.DB.ExecContext(ctx, q,
-		c.Name,
-		c.ContactInfo,
-		c.DeliveryAddress,
-		c.CustomerType,
-		c.Audit.CreatedAt,
-		c.Audit.UpdatedAt,
-		c.Audit.CreatedBy,
-		c.Audit.UpdatedBy,
-	)
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, q,
+			FarmFrom(ctx),
+			c.Name,
+			c.ContactInfo,
+			c.DeliveryAddress,
+			c.CustomerType,
+			c.VATNumber,
+			c.Latitude,
+			c.Longitude,
+			c.Audit.CreatedAt,
+			c.Audit.UpdatedAt,
+			c.Audit.CreatedBy,
+			c.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		if c.DeliveryAddress != nil {
+			_, err := tx.ExecContext(ctx, qAddress, id, domain.AddressKindDelivery, *c.DeliveryAddress, now, now, c.Audit.CreatedBy, c.Audit.UpdatedBy)
+			if err != nil {
+				return err
+			}
+		}
+		return replaceCustomerTags(ctx, tx, id, c.Tags)
+	})
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	publish(ctx, r.Events, "customers", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteCustomerRepo) Update(ctx context.Context, c *domain.Customer) error {
-	const q = `UPDATE customers SET name = ?, contact_info = ?, delivery_address = ?, customer_type = ?, updated_at = ?, updated_by = ? WHERE customer_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE customers SET name = ?, contact_info = ?, customer_type = ?, vat_number = ?, latitude = ?, longitude = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE customer_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	c.Audit.UpdatedAt = now
+	stampActor(ctx, &c.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
-		c.Name,
-		c.ContactInfo,
-		c.DeliveryAddress,
-		c.CustomerType,
-		now,
-		c.Audit.UpdatedBy,
-		c.CustomerID,
-	)
-	return err
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, q,
+			c.Name,
+			c.ContactInfo,
+			c.CustomerType,
+			c.VATNumber,
+			c.Latitude,
+			c.Longitude,
+			now,
+			c.Audit.UpdatedBy,
+			c.CustomerID,
+			FarmFrom(ctx),
+			c.Audit.Version,
+		).Scan(&c.Audit.Version)
+		if err != nil {
+			return versionError(ctx, tx, err, "customers", "customer_id", c.CustomerID)
+		}
+		return replaceCustomerTags(ctx, tx, c.CustomerID, c.Tags)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customers", c.CustomerID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteCustomerRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE customers SET deleted_at = ? WHERE customer_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE customers SET deleted_at = ? WHERE customer_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "customers", id, events.Deleted)
+	return nil
+}
+
+// replaceCustomerTags sets the tags of a customer to tags.
+func replaceCustomerTags(ctx context.Context, tx *sql.Tx, customerID int64, tags []string) error {
+	const qDelete = `DELETE FROM customer_tags WHERE customer_id = ?`
+	const qInsert = `INSERT OR IGNORE INTO customer_tags (customer_id, tag) VALUES (?, ?)`
+	if _, err := tx.ExecContext(ctx, qDelete, customerID); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, qInsert, customerID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanCustomer reads one row of customerColumns.
+func scanCustomer(row interface{ Scan(...any) error }) (*domain.Customer, error) {
+	var item domain.Customer
+	var tags sql.NullString
+	err := row.Scan(
+		&item.CustomerID,
+		&item.Name,
+		&item.ContactInfo,
+		&item.DeliveryAddress,
+		&item.BillingAddress,
+		&item.CustomerType,
+		&item.VATNumber,
+		&item.Latitude,
+		&item.Longitude,
+		&item.Audit.CreatedAt,
+		&item.Audit.UpdatedAt,
+		&item.Audit.DeletedAt,
+		&item.Audit.CreatedBy,
+		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
+		&tags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if tags.Valid {
+		item.Tags = strings.Split(tags.String, ",")
+	}
+	return &item, nil
 }
@@ -0,0 +1,268 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// DashboardRepo defines the read-only aggregates behind the operational dashboard.
+type DashboardRepo interface {
+	// BarnOccupancy returns the live birds of every barn against its capacity, by barn name.
+	BarnOccupancy(ctx context.Context) ([]*domain.BarnOccupancy, error)
+	// MortalityTrend returns the mortality of the given number of days up to and including today.
+	MortalityTrend(ctx context.Context, today time.Time, days int) ([]domain.MortalityDay, error)
+	// FeedOnDay returns the feed given on a day to every flock with birds left or a ration planned.
+	FeedOnDay(ctx context.Context, day time.Time) ([]*domain.FlockFeed, error)
+	// BatchesReadyBy returns the production batches ready by the given day and not yet
+	// slaughtered, soonest first.
+	BatchesReadyBy(ctx context.Context, day time.Time) ([]*domain.ProductionBatch, error)
+	// OpenOrdersByStatus returns the number of open orders per status in workflow order.
+	OpenOrdersByStatus(ctx context.Context) ([]*domain.OrderStatusCount, error)
+	// LowStock returns the inventory items at or below their reorder level, by name.
+	LowStock(ctx context.Context) ([]*domain.InventoryItem, error)
+}
+
+type SQLiteDashboardRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLiteDashboardRepo(db *sql.DB) *SQLiteDashboardRepo {
+	return &SQLiteDashboardRepo{DB: db}
+}
+
+// liveBirds selects the birds left in every flock: the birds placed less the birds found dead
+// and the birds slaughtered.
+const liveBirds = `
+	SELECT f.flock_id, f.barn_id,
+		MAX(COALESCE(f.number_of_birds, 0) - COALESCE(d.dead, 0) - COALESCE(s.slaughtered, 0), 0) AS live
+	FROM flocks f
+	LEFT JOIN (
+		SELECT flock_id, SUM(number_dead) AS dead
+		FROM mortality_records
+		WHERE deleted_at IS NULL
+		GROUP BY flock_id
+	) d ON d.flock_id = f.flock_id
+	LEFT JOIN (
+		SELECT pb.flock_id, SUM(sr.number_slaughtered) AS slaughtered
+		FROM slaughter_records sr
+		JOIN production_batches pb ON pb.batch_id = sr.batch_id AND pb.deleted_at IS NULL
+		WHERE sr.deleted_at IS NULL
+		GROUP BY pb.flock_id
+	) s ON s.flock_id = f.flock_id
+	WHERE f.deleted_at IS NULL`
+
+func (r *SQLiteDashboardRepo) BarnOccupancy(ctx context.Context) ([]*domain.BarnOccupancy, error) {
+	const q = `
+		SELECT b.barn_id, b.name, b.capacity, COALESCE(SUM(l.live), 0)
+		FROM barns b
+		LEFT JOIN (` + liveBirds + `) l ON l.barn_id = b.barn_id
+		WHERE b.farm_id = ? AND b.deleted_at IS NULL
+		GROUP BY b.barn_id
+		ORDER BY b.name, b.barn_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var barns []*domain.BarnOccupancy
+	for rows.Next() {
+		var b domain.BarnOccupancy
+		if err := rows.Scan(&b.BarnID, &b.Name, &b.Capacity, &b.LiveBirds); err != nil {
+			return nil, err
+		}
+		barns = append(barns, &b)
+	}
+	return barns, rows.Err()
+}
+
+func (r *SQLiteDashboardRepo) MortalityTrend(ctx context.Context, today time.Time, days int) ([]domain.MortalityDay, error) {
+	const qLive = `SELECT COALESCE(SUM(live), 0) FROM (` + liveBirds + ` AND f.farm_id = ?)`
+	const qDead = `
+		SELECT substr(m.date, 1, 10), SUM(m.number_dead)
+		FROM mortality_records m
+		JOIN flocks f ON f.flock_id = m.flock_id AND f.deleted_at IS NULL
+		WHERE m.farm_id = ? AND m.deleted_at IS NULL AND substr(m.date, 1, 10) BETWEEN ? AND ?
+		GROUP BY 1`
+	const qSlaughtered = `
+		SELECT substr(sr.date, 1, 10), SUM(sr.number_slaughtered)
+		FROM slaughter_records sr
+		JOIN production_batches pb ON pb.batch_id = sr.batch_id AND pb.deleted_at IS NULL
+		JOIN flocks f ON f.flock_id = pb.flock_id AND f.deleted_at IS NULL
+		WHERE sr.farm_id = ? AND sr.deleted_at IS NULL AND substr(sr.date, 1, 10) BETWEEN ? AND ?
+		GROUP BY 1`
+
+	var live int
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, qLive, FarmFrom(ctx)).Scan(&live); err != nil {
+		return nil, err
+	}
+	from, to := today.AddDate(0, 0, 1-days).Format("2006-01-02"), today.Format("2006-01-02")
+	dead, err := r.countsPerDay(ctx, qDead, FarmFrom(ctx), from, to)
+	if err != nil {
+		return nil, err
+	}
+	slaughtered, err := r.countsPerDay(ctx, qSlaughtered, FarmFrom(ctx), from, to)
+	if err != nil {
+		return nil, err
+	}
+	return domain.MortalityTrend(today, days, live, dead, slaughtered), nil
+}
+
+// countsPerDay runs a query selecting a day as YYYY-MM-DD and a count.
+func (r *SQLiteDashboardRepo) countsPerDay(ctx context.Context, q string, args ...any) (map[string]int, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var day string
+		var n sql.NullInt64
+		if err := rows.Scan(&day, &n); err != nil {
+			return nil, err
+		}
+		counts[day] = int(n.Int64)
+	}
+	return counts, rows.Err()
+}
+
+func (r *SQLiteDashboardRepo) FeedOnDay(ctx context.Context, day time.Time) ([]*domain.FlockFeed, error) {
+	const q = `
+		SELECT f.flock_id, f.breed, b.name, f.daily_feed_kg, COALESCE(fd.kg, 0)
+		FROM flocks f
+		JOIN (` + liveBirds + `) l ON l.flock_id = f.flock_id
+		LEFT JOIN barns b ON b.barn_id = f.barn_id
+		LEFT JOIN (
+			SELECT flock_id, SUM(amount_given) AS kg
+			FROM feeding_records
+			WHERE deleted_at IS NULL AND substr(date_time, 1, 10) = ?
+			GROUP BY flock_id
+		) fd ON fd.flock_id = f.flock_id
+		WHERE f.farm_id = ? AND (l.live > 0 OR fd.kg > 0)
+		ORDER BY b.name, f.flock_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, day.Format("2006-01-02"), FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feed []*domain.FlockFeed
+	for rows.Next() {
+		var f domain.FlockFeed
+		if err := rows.Scan(&f.FlockID, &f.Breed, &f.BarnName, &f.PlannedKg, &f.GivenKg); err != nil {
+			return nil, err
+		}
+		feed = append(feed, &f)
+	}
+	return feed, rows.Err()
+}
+
+func (r *SQLiteDashboardRepo) BatchesReadyBy(ctx context.Context, day time.Time) ([]*domain.ProductionBatch, error) {
+	const q = `
+		SELECT pb.batch_id, pb.flock_id, pb.date_ready, pb.number_in_batch, pb.weight_estimate, pb.notes, f.breed
+		FROM production_batches pb
+		JOIN flocks f ON f.flock_id = pb.flock_id AND f.deleted_at IS NULL
+		WHERE pb.farm_id = ? AND pb.deleted_at IS NULL AND pb.date_ready IS NOT NULL AND substr(pb.date_ready, 1, 10) <= ?
+			AND NOT EXISTS (SELECT 1 FROM slaughter_records sr WHERE sr.batch_id = pb.batch_id AND sr.deleted_at IS NULL)
+		ORDER BY pb.date_ready, pb.batch_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), day.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []*domain.ProductionBatch
+	for rows.Next() {
+		b := domain.ProductionBatch{Flock: &domain.Flock{}}
+		err := rows.Scan(
+			&b.BatchID,
+			&b.FlockID,
+			&b.DateReady,
+			&b.NumberInBatch,
+			&b.WeightEstimate,
+			&b.Notes,
+			&b.Flock.Breed,
+		)
+		if err != nil {
+			return nil, err
+		}
+		b.Flock.FlockID = b.FlockID
+		batches = append(batches, &b)
+	}
+	return batches, rows.Err()
+}
+
+func (r *SQLiteDashboardRepo) OpenOrdersByStatus(ctx context.Context) ([]*domain.OrderStatusCount, error) {
+	const q = `SELECT status, COUNT(1) FROM orders WHERE farm_id = ? AND deleted_at IS NULL GROUP BY status`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byStatus := map[domain.OrderStatus]int{}
+	for rows.Next() {
+		var status domain.OrderStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		byStatus[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var counts []*domain.OrderStatusCount
+	for _, status := range domain.OrderStatuses {
+		if status.Open() && byStatus[status] > 0 {
+			counts = append(counts, &domain.OrderStatusCount{Status: status, Orders: byStatus[status]})
+		}
+	}
+	return counts, nil
+}
+
+func (r *SQLiteDashboardRepo) LowStock(ctx context.Context) ([]*domain.InventoryItem, error) {
+	const q = `
+		SELECT inventory_item_id, name, type, quantity, unit, reorder_level, expiration_date, supplier_info, notes,
+			created_at, updated_at, deleted_at, created_by, updated_by
+		FROM inventory_items
+		WHERE farm_id = ? AND deleted_at IS NULL AND reorder_level IS NOT NULL AND COALESCE(quantity, 0) <= reorder_level
+		ORDER BY name, inventory_item_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.InventoryItem
+	for rows.Next() {
+		var item domain.InventoryItem
+		err := rows.Scan(
+			&item.InventoryItemID,
+			&item.Name,
+			&item.Type,
+			&item.Quantity,
+			&item.Unit,
+			&item.ReorderLevel,
+			&item.ExpirationDate,
+			&item.SupplierInfo,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,119 @@
+package data
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestDashboardRepo_Widgets(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLiteDashboardRepo(db)
+
+	i := func(v int) *int { return &v }
+	f := func(v float64) *float64 { return &v }
+	today := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	yesterday := today.AddDate(0, 0, -1)
+
+	barnID, err := NewSQLiteBarnRepo(db).Create(ctx, &domain.Barn{Name: "B1", Capacity: i(500)})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	flocks := NewSQLiteFlockRepo(db)
+	flockID, err := flocks.Create(ctx, &domain.Flock{Breed: "Bronze", BarnID: &barnID, NumberOfBirds: i(400), DailyFeedKg: f(50)})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	if _, err := NewSQLiteMortalityRecordRepo(db).Create(ctx, &domain.MortalityRecord{FlockID: flockID, Date: &yesterday, NumberDead: i(10)}); err != nil {
+		t.Fatalf("create mortality record: %v", err)
+	}
+	batches := NewSQLiteProductionBatchRepo(db)
+	slaughteredBatch, err := batches.Create(ctx, &domain.ProductionBatch{FlockID: flockID, DateReady: &yesterday, NumberInBatch: i(90)})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	nextWeek := today.AddDate(0, 0, 7)
+	if _, err := batches.Create(ctx, &domain.ProductionBatch{FlockID: flockID, DateReady: &nextWeek, NumberInBatch: i(100)}); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if _, err := NewSQLiteSlaughterRecordRepo(db).Create(ctx, &domain.SlaughterRecord{BatchID: slaughteredBatch, Date: &today, NumberSlaughtered: i(90)}); err != nil {
+		t.Fatalf("create slaughter record: %v", err)
+	}
+	feedTypeID, err := NewSQLiteFeedTypeRepo(db).Create(ctx, &domain.FeedType{Name: "Grower"})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+	morning := sql.NullTime{Time: today.Add(7 * time.Hour), Valid: true}
+	if _, err := NewSQLiteFeedingRecordRepo(db).Create(ctx, &domain.FeedingRecord{FlockID: flockID, FeedTypeID: feedTypeID, AmountGiven: f(20), DateTime: morning}); err != nil {
+		t.Fatalf("create feeding record: %v", err)
+	}
+	items := NewSQLiteInventoryItemRepo(db)
+	for _, item := range []*domain.InventoryItem{
+		{Name: "Litter", Quantity: f(2), ReorderLevel: f(5)},
+		{Name: "Vaccine", Quantity: f(20), ReorderLevel: f(5)},
+		{Name: "Gloves", Quantity: f(1)},
+	} {
+		if _, err := items.Create(ctx, item); err != nil {
+			t.Fatalf("create inventory item: %v", err)
+		}
+	}
+
+	barns, err := repo.BarnOccupancy(ctx)
+	if err != nil {
+		t.Fatalf("barn occupancy: %v", err)
+	}
+	if len(barns) != 1 || barns[0].LiveBirds != 300 {
+		t.Fatalf("barns = %+v, want 300 live birds in B1", barns)
+	}
+
+	trend, err := repo.MortalityTrend(ctx, today, 7)
+	if err != nil {
+		t.Fatalf("mortality trend: %v", err)
+	}
+	if len(trend) != 7 || trend[5].Dead != 10 || trend[5].Birds != 400 || trend[6].Birds != 390 {
+		t.Errorf("trend = %+v, want 10 of 400 dead yesterday and 390 birds today", trend)
+	}
+
+	feed, err := repo.FeedOnDay(ctx, today)
+	if err != nil {
+		t.Fatalf("feed on day: %v", err)
+	}
+	if len(feed) != 1 || feed[0].GivenKg != 20 || feed[0].PlannedKg == nil || *feed[0].PlannedKg != 50 {
+		t.Errorf("feed = %+v, want 20 of 50 kg", feed)
+	}
+
+	ready, err := repo.BatchesReadyBy(ctx, today.AddDate(0, 0, 14))
+	if err != nil {
+		t.Fatalf("batches ready: %v", err)
+	}
+	if len(ready) != 1 || ready[0].NumberInBatch == nil || *ready[0].NumberInBatch != 100 || ready[0].Flock.Breed != "Bronze" {
+		t.Errorf("ready = %+v, want only the batch not yet slaughtered", ready)
+	}
+
+	low, err := repo.LowStock(ctx)
+	if err != nil {
+		t.Fatalf("low stock: %v", err)
+	}
+	if len(low) != 1 || low[0].Name != "Litter" {
+		t.Errorf("low stock = %+v, want Litter only", low)
+	}
+
+	if _, err := db.ExecContext(ctx, `INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher')`); err != nil {
+		t.Fatalf("seed customer: %v", err)
+	}
+	orders := NewSQLiteOrderRepo(db)
+	for _, status := range []domain.OrderStatus{domain.OrderStatusDraft, domain.OrderStatusDraft, domain.OrderStatusPaid} {
+		if _, err := orders.Create(ctx, &domain.Order{CustomerID: 1, Status: status}); err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+	}
+	open, err := repo.OpenOrdersByStatus(ctx)
+	if err != nil {
+		t.Fatalf("open orders: %v", err)
+	}
+	if len(open) != 1 || open[0].Status != domain.OrderStatusDraft || open[0].Orders != 2 {
+		t.Errorf("open orders = %+v, want 2 drafts", open)
+	}
+}
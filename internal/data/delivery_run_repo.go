@@ -0,0 +1,496 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// DeliveryRunRepo defines operations for delivery runs and their stops. Dispatching a run and
+// closing its stops advance the orders through the order workflow in the same transaction.
+type DeliveryRunRepo interface {
+	// Count returns the number of runs not completed yet.
+	Count(ctx context.Context) (int64, error)
+	// List returns all runs with driver names and stop counts, newest first, without stops.
+	List(ctx context.Context) ([]*domain.DeliveryRun, error)
+	// FindByID returns a run with its stops in visiting order, each with its order and customer.
+	FindByID(ctx context.Context, id int64) (*domain.DeliveryRun, error)
+	Create(ctx context.Context, run *domain.DeliveryRun) (int64, error)
+	// SoftDelete removes a planned run, freeing its orders for another run.
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+	// ReadyOrders returns the reserved and picked orders not on an open run yet, with their
+	// customers, by delivery date.
+	ReadyOrders(ctx context.Context) ([]*domain.Order, error)
+	// AddStop puts an order at the end of a planned run loaded at version.
+	AddStop(ctx context.Context, runID, orderID, version int64) (int64, error)
+	// RemoveStop takes a stop off a planned run loaded at version.
+	RemoveStop(ctx context.Context, runID, stopID, version int64) error
+	// SetRoute stores the visiting order (Sequence) and leg distances of a planned run's stops
+	// together with the total route length, for a run loaded at version.
+	SetRoute(ctx context.Context, runID int64, stops []*domain.DeliveryStop, totalKm *float64, version int64) error
+	// Dispatch sends a planned run loaded at version out, moving its reserved orders to picked.
+	Dispatch(ctx context.Context, runID, version int64) error
+	// CloseStop records the outcome of a stop of a dispatched run and bumps the run's version.
+	// A delivered stop moves its order to delivered; the run completes once no stop is pending.
+	CloseStop(ctx context.Context, stop *domain.DeliveryStop) error
+}
+
+type SQLiteDeliveryRunRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteDeliveryRunRepo(db *sql.DB) *SQLiteDeliveryRunRepo {
+	return &SQLiteDeliveryRunRepo{DB: db}
+}
+
+func (r *SQLiteDeliveryRunRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM delivery_runs WHERE farm_id = ? AND deleted_at IS NULL AND status != 'completed'`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+const deliveryRunSelect = `
+	SELECT r.delivery_run_id, r.run_date, r.driver_id, r.status, r.total_distance_km, r.notes,
+		   r.created_at, r.updated_at, r.deleted_at, r.created_by, r.updated_by, r.version, s.name,
+		   (SELECT COUNT(1) FROM delivery_stops ds WHERE ds.delivery_run_id = r.delivery_run_id),
+		   (SELECT COUNT(1) FROM delivery_stops ds WHERE ds.delivery_run_id = r.delivery_run_id AND ds.status = 'pending')
+	FROM delivery_runs r
+	LEFT JOIN staff s ON s.staff_id = r.driver_id
+	WHERE r.farm_id = ? AND r.deleted_at IS NULL`
+
+func scanDeliveryRun(scan func(dest ...any) error) (*domain.DeliveryRun, error) {
+	var run domain.DeliveryRun
+	err := scan(
+		&run.DeliveryRunID,
+		&run.RunDate,
+		&run.DriverID,
+		&run.Status,
+		&run.TotalDistanceKm,
+		&run.Notes,
+		&run.Audit.CreatedAt,
+		&run.Audit.UpdatedAt,
+		&run.Audit.DeletedAt,
+		&run.Audit.CreatedBy,
+		&run.Audit.UpdatedBy,
+		&run.Audit.Version,
+		&run.DriverName,
+		&run.StopCount,
+		&run.OpenStops,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *SQLiteDeliveryRunRepo) List(ctx context.Context) ([]*domain.DeliveryRun, error) {
+	const q = deliveryRunSelect + ` ORDER BY r.run_date DESC, r.delivery_run_id DESC`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*domain.DeliveryRun
+	for rows.Next() {
+		run, err := scanDeliveryRun(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *SQLiteDeliveryRunRepo) FindByID(ctx context.Context, id int64) (*domain.DeliveryRun, error) {
+	const q = deliveryRunSelect + ` AND r.delivery_run_id = ?`
+	run, err := scanDeliveryRun(conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx), id).Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	const qStops = `
+		SELECT s.delivery_stop_id, s.delivery_run_id, s.order_id, s.sequence, s.leg_distance_km, s.status,
+			   s.delivered_at, s.recipient_name, s.signature, s.notes,
+			   o.customer_id, o.order_date, o.delivery_date, o.total_amount, COALESCE(o.status, 'draft'),
+			   c.name, c.contact_info, c.delivery_address, c.latitude, c.longitude
+		FROM delivery_stops s
+		JOIN orders o ON o.order_id = s.order_id
+		JOIN customers c ON c.customer_id = o.customer_id
+		WHERE s.delivery_run_id = ?
+		ORDER BY s.sequence, s.delivery_stop_id
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qStops, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stop := domain.DeliveryStop{Order: &domain.Order{Customer: &domain.Customer{}}}
+		order, customer := stop.Order, stop.Order.Customer
+		err := rows.Scan(
+			&stop.DeliveryStopID,
+			&stop.DeliveryRunID,
+			&stop.OrderID,
+			&stop.Sequence,
+			&stop.LegDistanceKm,
+			&stop.Status,
+			&stop.DeliveredAt,
+			&stop.RecipientName,
+			&stop.Signature,
+			&stop.Notes,
+			&order.CustomerID,
+			&order.OrderDate,
+			&order.DeliveryDate,
+			&order.TotalAmount,
+			&order.Status,
+			&customer.Name,
+			&customer.ContactInfo,
+			&customer.DeliveryAddress,
+			&customer.Latitude,
+			&customer.Longitude,
+		)
+		if err != nil {
+			return nil, err
+		}
+		order.OrderID = stop.OrderID
+		customer.CustomerID = order.CustomerID
+		run.Stops = append(run.Stops, &stop)
+	}
+	return run, rows.Err()
+}
+
+func (r *SQLiteDeliveryRunRepo) Create(ctx context.Context, run *domain.DeliveryRun) (int64, error) {
+	const q = `INSERT INTO delivery_runs (farm_id, run_date, driver_id, status, notes, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	run.Status = domain.DeliveryRunPlanned
+	run.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &run.Audit)
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
+		run.RunDate,
+		run.DriverID,
+		run.Status,
+		run.Notes,
+		run.Audit.CreatedAt,
+		run.Audit.UpdatedAt,
+		run.Audit.CreatedBy,
+		run.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "delivery_runs", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteDeliveryRunRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE delivery_runs SET deleted_at = ?, updated_at = ? WHERE delivery_run_id = ?`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, id, domain.DeliveryRunPlanned, domain.ErrRunNotPlanned); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, q, deletedAt, deletedAt, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "delivery_runs", id, events.Deleted)
+	return nil
+}
+
+// openStopCondition matches stops that hold on to their order: stops of live runs that are
+// pending or delivered. A failed stop frees the order for another run.
+const openStopCondition = `s.status != 'failed' AND EXISTS (
+	SELECT 1 FROM delivery_runs r WHERE r.delivery_run_id = s.delivery_run_id AND r.deleted_at IS NULL)`
+
+func (r *SQLiteDeliveryRunRepo) ReadyOrders(ctx context.Context) ([]*domain.Order, error) {
+	const q = `
+		SELECT o.order_id, o.customer_id, o.order_date, o.delivery_date, o.total_amount, COALESCE(o.status, 'draft'),
+			   c.name, c.delivery_address, c.latitude, c.longitude
+		FROM orders o
+		JOIN customers c ON c.customer_id = o.customer_id
+		WHERE o.farm_id = ? AND o.deleted_at IS NULL AND o.status IN ('reserved', 'picked')
+		  AND NOT EXISTS (SELECT 1 FROM delivery_stops s WHERE s.order_id = o.order_id AND ` + openStopCondition + `)
+		ORDER BY o.delivery_date IS NULL, o.delivery_date, o.order_id
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []*domain.Order
+	for rows.Next() {
+		order := domain.Order{Customer: &domain.Customer{}}
+		err := rows.Scan(
+			&order.OrderID,
+			&order.CustomerID,
+			&order.OrderDate,
+			&order.DeliveryDate,
+			&order.TotalAmount,
+			&order.Status,
+			&order.Customer.Name,
+			&order.Customer.DeliveryAddress,
+			&order.Customer.Latitude,
+			&order.Customer.Longitude,
+		)
+		if err != nil {
+			return nil, err
+		}
+		order.Customer.CustomerID = order.CustomerID
+		orders = append(orders, &order)
+	}
+	return orders, rows.Err()
+}
+
+func (r *SQLiteDeliveryRunRepo) AddStop(ctx context.Context, runID, orderID, version int64) (int64, error) {
+	const qOrder = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qOnRun = `SELECT COUNT(1) FROM delivery_stops s WHERE s.order_id = ? AND ` + openStopCondition
+	const qInsert = `INSERT INTO delivery_stops (delivery_run_id, order_id, sequence, status)
+		VALUES (?, ?, (SELECT COALESCE(MAX(sequence), 0) + 1 FROM delivery_stops WHERE delivery_run_id = ?), 'pending')`
+
+	var stopID int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, runID, domain.DeliveryRunPlanned, domain.ErrRunNotPlanned); err != nil {
+			return err
+		}
+		if err := claimRun(ctx, tx, runID, version); err != nil {
+			return err
+		}
+		var status domain.OrderStatus
+		if err := tx.QueryRowContext(ctx, qOrder, orderID, FarmFrom(ctx)).Scan(&status); err != nil {
+			return err
+		}
+		if status != domain.OrderStatusReserved && status != domain.OrderStatusPicked {
+			return domain.ErrOrderNotReady
+		}
+		var onRun int
+		if err := tx.QueryRowContext(ctx, qOnRun, orderID).Scan(&onRun); err != nil {
+			return err
+		}
+		if onRun > 0 {
+			return domain.ErrOrderOnRun
+		}
+
+		result, err := tx.ExecContext(ctx, qInsert, runID, orderID, runID)
+		if err != nil {
+			return err
+		}
+		if stopID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return clearRoute(ctx, tx, runID)
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "delivery_runs", runID, events.Updated)
+	return stopID, nil
+}
+
+func (r *SQLiteDeliveryRunRepo) RemoveStop(ctx context.Context, runID, stopID, version int64) error {
+	const q = `DELETE FROM delivery_stops WHERE delivery_stop_id = ? AND delivery_run_id = ?`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, runID, domain.DeliveryRunPlanned, domain.ErrRunNotPlanned); err != nil {
+			return err
+		}
+		if err := claimRun(ctx, tx, runID, version); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q, stopID, runID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return clearRoute(ctx, tx, runID)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "delivery_runs", runID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteDeliveryRunRepo) SetRoute(ctx context.Context, runID int64, stops []*domain.DeliveryStop, totalKm *float64, version int64) error {
+	const qStop = `UPDATE delivery_stops SET sequence = ?, leg_distance_km = ? WHERE delivery_stop_id = ? AND delivery_run_id = ?`
+	const qRun = `UPDATE delivery_runs SET total_distance_km = ?, updated_at = ? WHERE delivery_run_id = ?`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, runID, domain.DeliveryRunPlanned, domain.ErrRunNotPlanned); err != nil {
+			return err
+		}
+		if err := claimRun(ctx, tx, runID, version); err != nil {
+			return err
+		}
+		for _, stop := range stops {
+			if _, err := tx.ExecContext(ctx, qStop, stop.Sequence, stop.LegDistanceKm, stop.DeliveryStopID, runID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, qRun, totalKm, time.Now(), runID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "delivery_runs", runID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteDeliveryRunRepo) Dispatch(ctx context.Context, runID, version int64) error {
+	const qOrders = `SELECT s.order_id FROM delivery_stops s JOIN orders o ON o.order_id = s.order_id
+		WHERE s.delivery_run_id = ? AND o.status = 'reserved' ORDER BY s.sequence`
+	const qStops = `SELECT COUNT(1) FROM delivery_stops WHERE delivery_run_id = ?`
+	const qRun = `UPDATE delivery_runs SET status = 'dispatched', updated_at = ?, updated_by = ? WHERE delivery_run_id = ?`
+
+	var orderIDs []int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, runID, domain.DeliveryRunPlanned, domain.ErrRunNotPlanned); err != nil {
+			return err
+		}
+		if err := claimRun(ctx, tx, runID, version); err != nil {
+			return err
+		}
+		var stops int
+		if err := tx.QueryRowContext(ctx, qStops, runID).Scan(&stops); err != nil {
+			return err
+		}
+		if stops == 0 {
+			return domain.ErrRunEmpty
+		}
+
+		var err error
+		orderIDs, err = queryIDs(ctx, tx, qOrders, runID)
+		if err != nil {
+			return err
+		}
+		note := fmt.Sprintf("Loaded on delivery run #%d", runID)
+		for _, orderID := range orderIDs {
+			if err := transitionOrderStatus(ctx, tx, orderID, domain.OrderStatusPicked, &note); err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, qRun, time.Now(), actorID(ctx), runID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "delivery_runs", runID, events.Updated)
+	for _, orderID := range orderIDs {
+		publish(ctx, r.Events, "orders", orderID, events.Updated)
+	}
+	return nil
+}
+
+func (r *SQLiteDeliveryRunRepo) CloseStop(ctx context.Context, stop *domain.DeliveryStop) error {
+	const qStop = `SELECT order_id, status FROM delivery_stops WHERE delivery_stop_id = ? AND delivery_run_id = ?`
+	const qClose = `UPDATE delivery_stops SET status = ?, delivered_at = ?, recipient_name = ?, signature = ?, notes = ? WHERE delivery_stop_id = ?`
+	const qOpen = `SELECT COUNT(1) FROM delivery_stops WHERE delivery_run_id = ? AND status = 'pending'`
+	const qTouch = `UPDATE delivery_runs SET updated_at = ?, updated_by = ?, version = version + 1 WHERE delivery_run_id = ?`
+	const qComplete = `UPDATE delivery_runs SET status = 'completed' WHERE delivery_run_id = ?`
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireRunStatus(ctx, tx, stop.DeliveryRunID, domain.DeliveryRunDispatched, domain.ErrRunNotDispatched); err != nil {
+			return err
+		}
+		var status domain.DeliveryStopStatus
+		if err := tx.QueryRowContext(ctx, qStop, stop.DeliveryStopID, stop.DeliveryRunID).Scan(&stop.OrderID, &status); err != nil {
+			return err
+		}
+		if status != domain.DeliveryStopPending {
+			return domain.ErrStopClosed
+		}
+
+		now := time.Now()
+		stop.DeliveredAt = &now
+		if _, err := tx.ExecContext(ctx, qClose, stop.Status, stop.DeliveredAt, stop.RecipientName, stop.Signature, stop.Notes, stop.DeliveryStopID); err != nil {
+			return err
+		}
+
+		if stop.Status == domain.DeliveryStopDelivered {
+			note := fmt.Sprintf("Delivered on run #%d", stop.DeliveryRunID)
+			if stop.RecipientName != nil {
+				note += ", received by " + *stop.RecipientName
+			}
+			if err := transitionOrderStatus(ctx, tx, stop.OrderID, domain.OrderStatusDelivered, &note); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, qTouch, now, actorID(ctx), stop.DeliveryRunID); err != nil {
+			return err
+		}
+		var open int
+		if err := tx.QueryRowContext(ctx, qOpen, stop.DeliveryRunID).Scan(&open); err != nil {
+			return err
+		}
+		if open == 0 {
+			_, err := tx.ExecContext(ctx, qComplete, stop.DeliveryRunID)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "delivery_runs", stop.DeliveryRunID, events.Updated)
+	if stop.Status == domain.DeliveryStopDelivered {
+		publish(ctx, r.Events, "orders", stop.OrderID, events.Updated)
+	}
+	return nil
+}
+
+// requireRunStatus checks a live run of the context's farm is in the wanted status, returning
+// notInStatus when it is not.
+func requireRunStatus(ctx context.Context, tx *sql.Tx, runID int64, want domain.DeliveryRunStatus, notInStatus error) error {
+	const q = `SELECT status FROM delivery_runs WHERE delivery_run_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	var status domain.DeliveryRunStatus
+	if err := tx.QueryRowContext(ctx, q, runID, FarmFrom(ctx)).Scan(&status); err != nil {
+		return err
+	}
+	if status != want {
+		return notInStatus
+	}
+	return nil
+}
+
+// claimRun moves a run from the version its page was loaded at to the next one, returning
+// ErrConflict when the run changed since.
+func claimRun(ctx context.Context, tx *sql.Tx, runID, version int64) error {
+	const q = `UPDATE delivery_runs SET updated_at = ?, updated_by = ?, version = version + 1
+		WHERE delivery_run_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
+	if err := tx.QueryRowContext(ctx, q, time.Now(), actorID(ctx), runID, FarmFrom(ctx), version).Scan(&version); err != nil {
+		return versionError(ctx, tx, err, "delivery_runs", "delivery_run_id", runID)
+	}
+	return nil
+}
+
+// clearRoute forgets the planned route of a run whose stops changed.
+func clearRoute(ctx context.Context, tx *sql.Tx, runID int64) error {
+	const qStops = `UPDATE delivery_stops SET leg_distance_km = NULL WHERE delivery_run_id = ?`
+	const qRun = `UPDATE delivery_runs SET total_distance_km = NULL, updated_at = ? WHERE delivery_run_id = ?`
+	if _, err := tx.ExecContext(ctx, qStops, runID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, qRun, time.Now(), runID)
+	return err
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+func TestDeliveryRunRepo_DispatchAndDeliver(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	bus := events.NewBus()
+	runs := &SQLiteDeliveryRunRepo{DB: db, Events: bus}
+	orderEvents, cancel := bus.Subscribe("orders")
+	defer cancel()
+
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (7, ?)`, []any{flockID}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (21, 7, CURRENT_DATE)`, nil},
+		{`INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher')`, nil},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "WB", Name: "Whole bird", Unit: "pc", Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	if _, err := NewSQLiteProductLotRepo(db).Create(ctx, &domain.ProductLot{SlaughterID: 21, ProductID: productID, WeightKg: 9, PieceCount: 2, PackingDate: time.Now()}); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+
+	draftID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	readyID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	qty, price := 1.0, 30.0
+	if _, err := NewSQLiteOrderItemRepo(db).Create(ctx, &domain.OrderItem{OrderID: readyID, ProductID: &productID, Quantity: &qty, UnitPrice: &price}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	for _, to := range []domain.OrderStatus{domain.OrderStatusConfirmed, domain.OrderStatusReserved} {
+		if err := orders.TransitionStatus(ctx, readyID, to, nil); err != nil {
+			t.Fatalf("transition to %s: %v", to, err)
+		}
+	}
+
+	runID, err := runs.Create(ctx, &domain.DeliveryRun{RunDate: time.Now()})
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if err := runs.Dispatch(ctx, runID, 1); !errors.Is(err, domain.ErrRunEmpty) {
+		t.Fatalf("dispatch empty run: got %v, want ErrRunEmpty", err)
+	}
+	if _, err := runs.AddStop(ctx, runID, draftID, 1); !errors.Is(err, domain.ErrOrderNotReady) {
+		t.Fatalf("add draft order: got %v, want ErrOrderNotReady", err)
+	}
+	if _, err := runs.AddStop(ctx, runID, readyID, 1); err != nil {
+		t.Fatalf("add stop: %v", err)
+	}
+	if ready, err := runs.ReadyOrders(ctx); err != nil || len(ready) != 0 {
+		t.Fatalf("ready orders after adding the stop: %v (%d)", err, len(ready))
+	}
+	otherRunID, err := runs.Create(ctx, &domain.DeliveryRun{RunDate: time.Now()})
+	if err != nil {
+		t.Fatalf("create run: %v", err)
+	}
+	if _, err := runs.AddStop(ctx, otherRunID, readyID, 1); !errors.Is(err, domain.ErrOrderOnRun) {
+		t.Fatalf("add order twice: got %v, want ErrOrderOnRun", err)
+	}
+
+	// Dispatching loads the order on the van, from a page showing the run with its stop.
+	if err := runs.Dispatch(ctx, runID, 1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("dispatch at the version before the stop: got %v, want ErrConflict", err)
+	}
+	if err := runs.Dispatch(ctx, runID, 2); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	order, err := orders.FindByID(ctx, readyID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if order.Status != domain.OrderStatusPicked {
+		t.Fatalf("order status after dispatch = %s, want picked", order.Status)
+	}
+	// Open order pages follow the status the run moved the order to.
+	expectOrderUpdated(t, orderEvents, readyID)
+
+	// An order out for delivery can be neither cancelled nor deleted, or its stop could never be
+	// closed and the run never complete.
+	var transitionErr *domain.OrderTransitionError
+	if err := orders.TransitionStatus(ctx, readyID, domain.OrderStatusCancelled, nil); !errors.As(err, &transitionErr) {
+		t.Fatalf("cancel an order out for delivery: got %v, want an OrderTransitionError", err)
+	}
+	if err := orders.SoftDelete(ctx, readyID, time.Now()); !errors.Is(err, domain.ErrOrderOnRun) {
+		t.Fatalf("delete an order out for delivery: got %v, want ErrOrderOnRun", err)
+	}
+
+	// Handing over the last stop delivers the order and completes the run.
+	run, err := runs.FindByID(ctx, runID)
+	if err != nil || len(run.Stops) != 1 {
+		t.Fatalf("find run: %v", err)
+	}
+	recipient := "Joe"
+	stop := &domain.DeliveryStop{DeliveryStopID: run.Stops[0].DeliveryStopID, DeliveryRunID: runID, Status: domain.DeliveryStopDelivered, RecipientName: &recipient}
+	if err := runs.CloseStop(ctx, stop); err != nil {
+		t.Fatalf("close stop: %v", err)
+	}
+	if err := runs.CloseStop(ctx, stop); !errors.Is(err, domain.ErrRunNotDispatched) {
+		t.Fatalf("close stop of a completed run: got %v, want ErrRunNotDispatched", err)
+	}
+	if order, err = orders.FindByID(ctx, readyID); err != nil || order.Status != domain.OrderStatusDelivered {
+		t.Fatalf("order after delivery: %v, status %s", err, order.Status)
+	}
+	expectOrderUpdated(t, orderEvents, readyID)
+	if run, err = runs.FindByID(ctx, runID); err != nil || run.Status != domain.DeliveryRunCompleted || run.Audit.Version != 4 {
+		t.Fatalf("run after last stop: %v, status %s, version %d", err, run.Status, run.Audit.Version)
+	}
+	if run.Stops[0].RecipientName == nil || *run.Stops[0].RecipientName != "Joe" || run.Stops[0].DeliveredAt == nil {
+		t.Fatalf("stop receipt not recorded: %+v", run.Stops[0])
+	}
+}
+
+// expectOrderUpdated fails t unless an update of orderID is waiting on ch.
+func expectOrderUpdated(t *testing.T, ch <-chan events.Event, orderID int64) {
+	t.Helper()
+	select {
+	case e := <-ch:
+		if e.ID != orderID || e.Action != events.Updated {
+			t.Fatalf("order event = %+v, want order %d updated", e, orderID)
+		}
+	default:
+		t.Fatalf("no event for order %d", orderID)
+	}
+}
@@ -0,0 +1,61 @@
+package data
+
+import "context"
+
+// DefaultFarmID is the farm every record belonged to before there were several, and the one
+// the first user owns.
+const DefaultFarmID int64 = 1
+
+type farmKey struct{}
+
+// WithFarm returns a context scoped to a farm: repositories called with it only see that farm's
+// records and file new ones under it.
+func WithFarm(ctx context.Context, farmID int64) context.Context {
+	return context.WithValue(ctx, farmKey{}, farmID)
+}
+
+// FarmFrom returns the farm ctx is scoped to, or 0 when it is not scoped to one: no farm has
+// that ID, so a context that missed WithFarm sees no records and cannot write any.
+func FarmFrom(ctx context.Context) int64 {
+	if id, ok := ctx.Value(farmKey{}).(int64); ok && id > 0 {
+		return id
+	}
+	return 0
+}
+
+// onFarm returns ErrNotFound unless the row of table identified by idColumn = id belongs to the
+// context's farm. Records without a farm of their own (a customer's contacts, an order's status
+// history, ...) check their parent with it before they are written.
+func onFarm(ctx context.Context, q queryer, table, idColumn string, id int64) error {
+	var n int
+	query := `SELECT COUNT(1) FROM ` + table + ` WHERE ` + idColumn + ` = ? AND farm_id = ?`
+	if err := q.QueryRowContext(ctx, query, id, FarmFrom(ctx)).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// farmRef names a row a record refers to; a nil id is an optional reference left empty.
+type farmRef struct {
+	table    string
+	idColumn string
+	id       *int64
+}
+
+// refsOnFarm checks with onFarm that every row a record refers to belongs to the context's farm,
+// so a crafted form cannot file a record under another farm's flock, barn or customer.
+// Staff are not checked: records moved with a flock keep the people who made them.
+func refsOnFarm(ctx context.Context, q queryer, refs ...farmRef) error {
+	for _, ref := range refs {
+		if ref.id == nil {
+			continue
+		}
+		if err := onFarm(ctx, q, ref.table, ref.idColumn, *ref.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
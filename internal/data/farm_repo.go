@@ -0,0 +1,510 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// FarmRepo defines the farms of the installation, who belongs to them, the report across them
+// and the transfers between them.
+type FarmRepo interface {
+	// Memberships returns the farms a user belongs to with their role there, by farm name.
+	Memberships(ctx context.Context, userID int64) ([]*domain.FarmMembership, error)
+	// IDs returns the IDs of every farm of the installation, for work done on each of them.
+	IDs(ctx context.Context) ([]int64, error)
+	// FindByID returns a farm by ID (excluding soft-deleted).
+	FindByID(ctx context.Context, id int64) (*domain.Farm, error)
+	// Create inserts a farm and makes ownerID its owner.
+	Create(ctx context.Context, farm *domain.Farm, ownerID int64) (int64, error)
+	// Update renames or relocates a farm.
+	Update(ctx context.Context, farm *domain.Farm) error
+	// Members returns the members of a farm, by username.
+	Members(ctx context.Context, farmID int64) ([]*domain.FarmMembership, error)
+	// SetMember adds a user to a farm or changes their role there. Demoting the last owner
+	// returns domain.ErrLastOwner.
+	SetMember(ctx context.Context, farmID, userID int64, role domain.FarmRole) error
+	// RemoveMember takes a user off a farm. Removing the last owner returns domain.ErrLastOwner.
+	RemoveMember(ctx context.Context, farmID, userID int64) error
+	// Summaries returns the key figures of each of the farms over the days from and to.
+	Summaries(ctx context.Context, farmIDs []int64, from, to time.Time) ([]*domain.FarmSummary, error)
+	// TransferFlock moves a flock of the context's farm to another farm, into barnID there or
+	// no barn. Its feeding, health, mortality and outdoor access records go with it; production
+	// batches, stock and costs stay with the farm they arose on.
+	TransferFlock(ctx context.Context, flockID, toFarmID int64, barnID *int64) error
+	// TransferLot moves a product lot of the context's farm to another farm. Lots with stock
+	// reserved by orders return domain.ErrLotReserved.
+	TransferLot(ctx context.Context, lotID, toFarmID int64) error
+	// TransferInventory moves quantity of an inventory item of the context's farm to the item
+	// of the same name and unit on another farm, creating that item when there is none.
+	TransferInventory(ctx context.Context, itemID, toFarmID int64, quantity float64) error
+}
+
+type SQLiteFarmRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteFarmRepo(db *sql.DB) *SQLiteFarmRepo {
+	return &SQLiteFarmRepo{DB: db}
+}
+
+func (r *SQLiteFarmRepo) Memberships(ctx context.Context, userID int64) ([]*domain.FarmMembership, error) {
+	const q = `
+		SELECT m.farm_id, f.name, m.user_id, u.username, m.role
+		FROM farm_memberships m
+		JOIN farms f ON f.farm_id = m.farm_id AND f.deleted_at IS NULL
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = ?
+		ORDER BY f.name, f.farm_id`
+	return r.listMemberships(ctx, q, userID)
+}
+
+func (r *SQLiteFarmRepo) Members(ctx context.Context, farmID int64) ([]*domain.FarmMembership, error) {
+	const q = `
+		SELECT m.farm_id, f.name, m.user_id, u.username, m.role
+		FROM farm_memberships m
+		JOIN farms f ON f.farm_id = m.farm_id
+		JOIN users u ON u.id = m.user_id AND u.deleted_at IS NULL
+		WHERE m.farm_id = ?
+		ORDER BY u.username`
+	return r.listMemberships(ctx, q, farmID)
+}
+
+func (r *SQLiteFarmRepo) listMemberships(ctx context.Context, q string, args ...any) ([]*domain.FarmMembership, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*domain.FarmMembership
+	for rows.Next() {
+		var m domain.FarmMembership
+		if err := rows.Scan(&m.FarmID, &m.FarmName, &m.UserID, &m.Username, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &m)
+	}
+	return memberships, rows.Err()
+}
+
+func (r *SQLiteFarmRepo) IDs(ctx context.Context) ([]int64, error) {
+	const q = `SELECT farm_id FROM farms WHERE deleted_at IS NULL ORDER BY farm_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *SQLiteFarmRepo) FindByID(ctx context.Context, id int64) (*domain.Farm, error) {
+	const q = `
+		SELECT farm_id, name, location, created_at, updated_at, deleted_at, created_by, updated_by, version
+		FROM farms
+		WHERE farm_id = ? AND deleted_at IS NULL`
+	var farm domain.Farm
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id).Scan(
+		&farm.FarmID,
+		&farm.Name,
+		&farm.Location,
+		&farm.Audit.CreatedAt,
+		&farm.Audit.UpdatedAt,
+		&farm.Audit.DeletedAt,
+		&farm.Audit.CreatedBy,
+		&farm.Audit.UpdatedBy,
+		&farm.Audit.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &farm, nil
+}
+
+func (r *SQLiteFarmRepo) Create(ctx context.Context, farm *domain.Farm, ownerID int64) (int64, error) {
+	const q = `INSERT INTO farms (name, location, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?)`
+	const qOwner = `INSERT INTO farm_memberships (farm_id, user_id, role, created_at, created_by) VALUES (?, ?, 'owner', ?, ?)`
+	now := time.Now()
+	farm.Audit.CreatedAt = now
+	farm.Audit.UpdatedAt = now
+	stampActor(ctx, &farm.Audit)
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, q,
+			farm.Name,
+			farm.Location,
+			farm.Audit.CreatedAt,
+			farm.Audit.UpdatedAt,
+			farm.Audit.CreatedBy,
+			farm.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if farm.FarmID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qOwner, farm.FarmID, ownerID, now, farm.Audit.CreatedBy)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return farm.FarmID, nil
+}
+
+func (r *SQLiteFarmRepo) Update(ctx context.Context, farm *domain.Farm) error {
+	const q = `UPDATE farms SET name = ?, location = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE farm_id = ? AND deleted_at IS NULL` + versionCheck
+	farm.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &farm.Audit)
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, farm.Name, farm.Location, farm.Audit.UpdatedAt, farm.Audit.UpdatedBy, farm.FarmID, farm.Audit.Version).Scan(&farm.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "farms", "farm_id", farm.FarmID)
+	}
+	return nil
+}
+
+func (r *SQLiteFarmRepo) SetMember(ctx context.Context, farmID, userID int64, role domain.FarmRole) error {
+	const q = `INSERT INTO farm_memberships (farm_id, user_id, role, created_at, created_by) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (farm_id, user_id) DO UPDATE SET role = excluded.role`
+	actor, _ := ActorFrom(ctx)
+	return withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if role != domain.FarmRoleOwner {
+			if err := keepAnOwner(ctx, tx, farmID, userID); err != nil {
+				return err
+			}
+		}
+		_, err := tx.ExecContext(ctx, q, farmID, userID, role, time.Now(), nullIfEmpty(actor))
+		return err
+	})
+}
+
+func (r *SQLiteFarmRepo) RemoveMember(ctx context.Context, farmID, userID int64) error {
+	const q = `DELETE FROM farm_memberships WHERE farm_id = ? AND user_id = ?`
+	return withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := keepAnOwner(ctx, tx, farmID, userID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, q, farmID, userID)
+		return err
+	})
+}
+
+// keepAnOwner refuses a change to userID's membership when they are the only owner of the farm.
+func keepAnOwner(ctx context.Context, tx *sql.Tx, farmID, userID int64) error {
+	const q = `SELECT COUNT(1) FROM farm_memberships WHERE farm_id = ? AND role = 'owner' AND user_id <> ?`
+	const qIsOwner = `SELECT COUNT(1) FROM farm_memberships WHERE farm_id = ? AND role = 'owner' AND user_id = ?`
+	var isOwner, others int
+	if err := tx.QueryRowContext(ctx, qIsOwner, farmID, userID).Scan(&isOwner); err != nil {
+		return err
+	}
+	if isOwner == 0 {
+		return nil
+	}
+	if err := tx.QueryRowContext(ctx, q, farmID, userID).Scan(&others); err != nil {
+		return err
+	}
+	if others == 0 {
+		return domain.ErrLastOwner
+	}
+	return nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func (r *SQLiteFarmRepo) Summaries(ctx context.Context, farmIDs []int64, from, to time.Time) ([]*domain.FarmSummary, error) {
+	const qFarm = `SELECT name FROM farms WHERE farm_id = ? AND deleted_at IS NULL`
+	const qFlocks = `SELECT COUNT(1), COALESCE(SUM(l.live), 0) FROM (` + liveBirds + ` AND f.farm_id = ?) l WHERE l.live > 0`
+	const qDeaths = `SELECT COALESCE(SUM(number_dead), 0) FROM mortality_records
+		WHERE farm_id = ? AND deleted_at IS NULL AND substr(date, 1, 10) BETWEEN ? AND ?`
+	const qFeed = `SELECT COALESCE(SUM(amount_given), 0) FROM feeding_records
+		WHERE farm_id = ? AND deleted_at IS NULL AND substr(date_time, 1, 10) BETWEEN ? AND ?`
+	const qOrders = `SELECT COUNT(1) FROM orders
+		WHERE farm_id = ? AND deleted_at IS NULL AND COALESCE(status, 'draft') NOT IN ('paid', 'cancelled', 'returned')`
+	const qInvoiced = `SELECT COALESCE(SUM(total_amount), 0) FROM invoices
+		WHERE farm_id = ? AND substr(issue_date, 1, 10) BETWEEN ? AND ?`
+	const qLabour = `SELECT started_at, ended_at, hourly_rate FROM time_entries
+		WHERE farm_id = ? AND deleted_at IS NULL AND ended_at IS NOT NULL AND substr(started_at, 1, 10) BETWEEN ? AND ?`
+
+	db := conn(ctx, r.DB)
+	fromDay, toDay := from.Format("2006-01-02"), to.Format("2006-01-02")
+	var summaries []*domain.FarmSummary
+	for _, farmID := range farmIDs {
+		s := &domain.FarmSummary{FarmID: farmID}
+		if err := db.QueryRowContext(ctx, qFarm, farmID).Scan(&s.FarmName); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return nil, err
+		}
+		if err := db.QueryRowContext(ctx, qFlocks, farmID).Scan(&s.Flocks, &s.Birds); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRowContext(ctx, qDeaths, farmID, fromDay, toDay).Scan(&s.Deaths); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRowContext(ctx, qFeed, farmID, fromDay, toDay).Scan(&s.FeedKg); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRowContext(ctx, qOrders, farmID).Scan(&s.OpenOrders); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRowContext(ctx, qInvoiced, farmID, fromDay, toDay).Scan(&s.Invoiced); err != nil {
+			return nil, err
+		}
+
+		lots, err := listProductLots(ctx, db, productLotSelect+` AND l.farm_id = ?`, farmID)
+		if err != nil {
+			return nil, err
+		}
+		for _, lot := range lots {
+			if lot.Quantity()-lot.Shipped > 0.0005 {
+				s.StockLots++
+			}
+		}
+
+		rows, err := db.QueryContext(ctx, qLabour, farmID, fromDay, toDay)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var e domain.TimeEntry
+			if err := rows.Scan(&e.StartedAt, &e.EndedAt, &e.HourlyRate); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			s.LabourCost += e.Cost(to)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		s.LabourCost = math.Round(s.LabourCost*100) / 100
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+func (r *SQLiteFarmRepo) TransferFlock(ctx context.Context, flockID, toFarmID int64, barnID *int64) error {
+	const qFlock = `UPDATE flocks SET farm_id = ?, barn_id = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE flock_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qBarn = `SELECT COUNT(1) FROM barns WHERE barn_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qBatches = `SELECT COUNT(1) FROM production_batches WHERE flock_id = ? AND deleted_at IS NULL`
+	const qBarnBound = `SELECT
+		(SELECT COUNT(1) FROM task_templates WHERE flock_id = ?) +
+		(SELECT COUNT(1) FROM tasks WHERE flock_id = ?) +
+		(SELECT COUNT(1) FROM time_entries WHERE flock_id = ?)`
+	from := FarmFrom(ctx)
+	if toFarmID == from {
+		return domain.ErrSameFarm
+	}
+	var audit domain.AuditFields
+	audit.TouchCreated(time.Now())
+	stampActor(ctx, &audit)
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if barnID != nil {
+			var n int
+			if err := tx.QueryRowContext(ctx, qBarn, *barnID, toFarmID).Scan(&n); err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrNotFound
+			}
+		}
+		var batches, barnBound int
+		if err := tx.QueryRowContext(ctx, qBatches, flockID).Scan(&batches); err != nil {
+			return err
+		}
+		if batches > 0 {
+			return domain.ErrFlockHasBatches
+		}
+		if err := tx.QueryRowContext(ctx, qBarnBound, flockID, flockID, flockID).Scan(&barnBound); err != nil {
+			return err
+		}
+		if barnBound > 0 && barnID == nil {
+			return domain.ErrTransferNeedsBarn
+		}
+
+		result, err := tx.ExecContext(ctx, qFlock, toFarmID, barnID, audit.UpdatedAt, audit.UpdatedBy, flockID, from)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		for _, table := range []string{"feeding_records", "health_checks", "mortality_records"} {
+			q := `UPDATE ` + table + ` SET farm_id = ? WHERE flock_id = ? AND farm_id = ?`
+			if _, err := tx.ExecContext(ctx, q, toFarmID, flockID, from); err != nil {
+				return err
+			}
+		}
+		// Checklists, hours and costs follow the flock into its new barn, so its labour cost and
+		// P&L stay whole.
+		for _, table := range []string{"task_templates", "tasks", "time_entries", "cost_entries"} {
+			q := `UPDATE ` + table + ` SET farm_id = ?, barn_id = ? WHERE flock_id = ? AND farm_id = ?`
+			if _, err := tx.ExecContext(ctx, q, toFarmID, barnID, flockID, from); err != nil {
+				return err
+			}
+		}
+		return moveFlockFeedTypes(ctx, tx, flockID, from, toFarmID, audit)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "flocks", flockID, events.Deleted)
+	return nil
+}
+
+// moveFlockFeedTypes points a transferred flock and its feeding records at the feed types of the
+// same name on the farm it moved to, copying the ones that farm does not have yet.
+func moveFlockFeedTypes(ctx context.Context, tx *sql.Tx, flockID, from, toFarmID int64, audit domain.AuditFields) error {
+	const qUsed = `SELECT feed_type_id FROM flocks WHERE flock_id = ? AND feed_type_id IS NOT NULL
+		UNION SELECT feed_type_id FROM feeding_records WHERE flock_id = ? AND feed_type_id IS NOT NULL`
+	const qTarget = `SELECT t.feed_type_id FROM feed_types s
+		JOIN feed_types t ON t.name = s.name COLLATE NOCASE AND t.farm_id = ? AND t.deleted_at IS NULL
+		WHERE s.feed_type_id = ? AND s.farm_id = ?
+		ORDER BY t.feed_type_id LIMIT 1`
+	const qCopy = `INSERT INTO feed_types (farm_id, name, description, nutritional_info, organic_certified, cost_per_kg, created_at, updated_at, created_by, updated_by)
+		SELECT ?, name, description, nutritional_info, organic_certified, cost_per_kg, ?, ?, ?, ? FROM feed_types WHERE feed_type_id = ? AND farm_id = ?`
+	const qFlock = `UPDATE flocks SET feed_type_id = ?, version = version + 1 WHERE flock_id = ? AND feed_type_id = ?`
+	const qRecords = `UPDATE feeding_records SET feed_type_id = ?, version = version + 1 WHERE flock_id = ? AND feed_type_id = ?`
+
+	used, err := queryIDs(ctx, tx, qUsed, flockID, flockID)
+	if err != nil {
+		return err
+	}
+	for _, feedTypeID := range used {
+		var targetID int64
+		err := tx.QueryRowContext(ctx, qTarget, toFarmID, feedTypeID, from).Scan(&targetID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result, err := tx.ExecContext(ctx, qCopy, toFarmID, audit.CreatedAt, audit.UpdatedAt, audit.CreatedBy, audit.UpdatedBy, feedTypeID, from)
+			if err != nil {
+				return err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				continue // not a feed type of the source farm; leave it alone
+			}
+			if targetID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, qFlock, targetID, flockID, feedTypeID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, qRecords, targetID, flockID, feedTypeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SQLiteFarmRepo) TransferLot(ctx context.Context, lotID, toFarmID int64) error {
+	const qReserved = `SELECT COUNT(1) FROM stock_reservations WHERE product_lot_id = ?`
+	const q = `UPDATE product_lots SET farm_id = ?, updated_at = ? WHERE product_lot_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	from := FarmFrom(ctx)
+	if toFarmID == from {
+		return domain.ErrSameFarm
+	}
+	return withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRowContext(ctx, qReserved, lotID).Scan(&reserved); err != nil {
+			return err
+		}
+		if reserved > 0 {
+			return domain.ErrLotReserved
+		}
+		result, err := tx.ExecContext(ctx, q, toFarmID, time.Now(), lotID, from)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (r *SQLiteFarmRepo) TransferInventory(ctx context.Context, itemID, toFarmID int64, quantity float64) error {
+	const qItem = `SELECT name, type, COALESCE(quantity, 0), unit FROM inventory_items WHERE inventory_item_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qTake = `UPDATE inventory_items SET quantity = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE inventory_item_id = ?`
+	const qTarget = `SELECT inventory_item_id FROM inventory_items
+		WHERE farm_id = ? AND deleted_at IS NULL AND name = ? COLLATE NOCASE AND COALESCE(unit, '') = COALESCE(?, '')
+		ORDER BY inventory_item_id LIMIT 1`
+	const qAdd = `UPDATE inventory_items SET quantity = COALESCE(quantity, 0) + ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE inventory_item_id = ?`
+	const qCreate = `INSERT INTO inventory_items (farm_id, name, type, quantity, unit, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	from := FarmFrom(ctx)
+	if toFarmID == from {
+		return domain.ErrSameFarm
+	}
+	var audit domain.AuditFields
+	audit.TouchCreated(time.Now())
+	stampActor(ctx, &audit)
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var (
+			name     string
+			kind     *string
+			onHand   float64
+			unit     *string
+			targetID int64
+		)
+		if err := tx.QueryRowContext(ctx, qItem, itemID, from).Scan(&name, &kind, &onHand, &unit); err != nil {
+			return err
+		}
+		if quantity <= 0 || quantity > onHand+0.0005 {
+			return domain.ErrTransferQuantity
+		}
+		left := math.Max(math.Round((onHand-quantity)*1000)/1000, 0)
+		if _, err := tx.ExecContext(ctx, qTake, left, audit.UpdatedAt, audit.UpdatedBy, itemID); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowContext(ctx, qTarget, toFarmID, name, unit).Scan(&targetID)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.ExecContext(ctx, qCreate, toFarmID, name, kind, quantity, unit,
+				audit.CreatedAt, audit.UpdatedAt, audit.CreatedBy, audit.UpdatedBy)
+			return err
+		case err != nil:
+			return err
+		}
+		_, err = tx.ExecContext(ctx, qAdd, quantity, audit.UpdatedAt, audit.UpdatedBy, targetID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "inventory_items", itemID, events.Updated)
+	return nil
+}
@@ -0,0 +1,188 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestFarmRepo_MembershipsKeepAnOwner(t *testing.T) {
+	ctx, db := openTestDB(t)
+	farms := NewSQLiteFarmRepo(db)
+	users := NewSQLiteUserRepo(db)
+
+	ownerID, err := users.Create(ctx, &domain.User{Username: "ann", PasswordHash: "x"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	workerID, err := users.Create(ctx, &domain.User{Username: "bob", PasswordHash: "x"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	farmID, err := farms.Create(ctx, &domain.Farm{Name: "Hill farm"}, ownerID)
+	if err != nil {
+		t.Fatalf("create farm: %v", err)
+	}
+	if err := farms.SetMember(ctx, farmID, workerID, domain.FarmRoleWorker); err != nil {
+		t.Fatalf("add worker: %v", err)
+	}
+
+	memberships, err := farms.Memberships(ctx, ownerID)
+	if err != nil || len(memberships) != 1 || memberships[0].Role != domain.FarmRoleOwner {
+		t.Fatalf("owner memberships = %+v (%v), want owner of one farm", memberships, err)
+	}
+
+	// The only owner can neither step down nor leave.
+	if err := farms.SetMember(ctx, farmID, ownerID, domain.FarmRoleManager); !errors.Is(err, domain.ErrLastOwner) {
+		t.Fatalf("demote last owner: err = %v, want ErrLastOwner", err)
+	}
+	if err := farms.RemoveMember(ctx, farmID, ownerID); !errors.Is(err, domain.ErrLastOwner) {
+		t.Fatalf("remove last owner: err = %v, want ErrLastOwner", err)
+	}
+
+	// Once someone else owns the farm, they can.
+	if err := farms.SetMember(ctx, farmID, workerID, domain.FarmRoleOwner); err != nil {
+		t.Fatalf("promote worker: %v", err)
+	}
+	if err := farms.RemoveMember(ctx, farmID, ownerID); err != nil {
+		t.Fatalf("remove owner: %v", err)
+	}
+	members, err := farms.Members(ctx, farmID)
+	if err != nil || len(members) != 1 || members[0].Username != "bob" {
+		t.Fatalf("members = %+v (%v), want bob only", members, err)
+	}
+}
+
+func TestFarmRepo_ScopingAndTransfers(t *testing.T) {
+	ctx, db := openTestDB(t)
+	farms := NewSQLiteFarmRepo(db)
+	barns := NewSQLiteBarnRepo(db)
+	flocks := NewSQLiteFlockRepo(db)
+	items := NewSQLiteInventoryItemRepo(db)
+
+	userID, err := NewSQLiteUserRepo(db).Create(ctx, &domain.User{Username: "ann", PasswordHash: "x"})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	otherID, err := farms.Create(ctx, &domain.Farm{Name: "Hill farm"}, userID)
+	if err != nil {
+		t.Fatalf("create farm: %v", err)
+	}
+	home, other := WithFarm(ctx, DefaultFarmID), WithFarm(ctx, otherID)
+
+	flockID, err := flocks.Create(home, &domain.Flock{Breed: "Bronze"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	feedTypeID, err := NewSQLiteFeedTypeRepo(db).Create(home, &domain.FeedType{Name: "Grower"})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+	if _, err := NewSQLiteFeedingRecordRepo(db).Create(home, &domain.FeedingRecord{FlockID: flockID, FeedTypeID: feedTypeID}); err != nil {
+		t.Fatalf("create feeding record: %v", err)
+	}
+	barnID, err := barns.Create(other, &domain.Barn{Name: "North shed"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+
+	// Each farm sees its own records only.
+	if _, err := flocks.FindByID(other, flockID); err != ErrNotFound {
+		t.Fatalf("flock from the other farm: err = %v, want ErrNotFound", err)
+	}
+	if list, err := barns.List(home); err != nil || len(list) != 0 {
+		t.Fatalf("home barns = %d (%v), want none", len(list), err)
+	}
+	if list, err := flocks.List(context.Background()); err != nil || len(list) != 0 {
+		t.Fatalf("flocks without a farm = %d (%v), want none", len(list), err)
+	}
+
+	// Records cannot refer to another farm's rows.
+	if _, err := flocks.Create(home, &domain.Flock{Breed: "Bronze", BarnID: &barnID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("flock in the other farm's barn: err = %v, want ErrNotFound", err)
+	}
+	if _, err := NewSQLiteMortalityRecordRepo(db).Create(other, &domain.MortalityRecord{FlockID: flockID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("mortality of the other farm's flock: err = %v, want ErrNotFound", err)
+	}
+	outdoor := NewSQLiteOutdoorAccessRecordRepo(db)
+	if _, err := outdoor.Create(other, &domain.OutdoorAccessRecord{FlockID: flockID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outdoor access of the other farm's flock: err = %v, want ErrNotFound", err)
+	}
+	if _, err := outdoor.Create(home, &domain.OutdoorAccessRecord{FlockID: flockID}); err != nil {
+		t.Fatalf("create outdoor access: %v", err)
+	}
+	if list, err := outdoor.ListByFlock(other, flockID); err != nil || len(list) != 0 {
+		t.Fatalf("outdoor access read from the other farm = %d (%v), want none", len(list), err)
+	}
+
+	// A flock moves with its records, into a barn of the farm it moves to.
+	if err := farms.TransferFlock(home, flockID, DefaultFarmID, nil); !errors.Is(err, domain.ErrSameFarm) {
+		t.Fatalf("transfer to the same farm: err = %v, want ErrSameFarm", err)
+	}
+	batchedID, err := flocks.Create(home, &domain.Flock{Breed: "White"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	if _, err := NewSQLiteProductionBatchRepo(db).Create(home, &domain.ProductionBatch{FlockID: batchedID}); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	if err := farms.TransferFlock(home, batchedID, otherID, &barnID); !errors.Is(err, domain.ErrFlockHasBatches) {
+		t.Fatalf("transfer flock with batches: err = %v, want ErrFlockHasBatches", err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO cost_entries (farm_id, category, flock_id, entry_date, amount) VALUES (1, 'chicks', ?, CURRENT_DATE, 250)`, flockID); err != nil {
+		t.Fatalf("seed cost entry: %v", err)
+	}
+	if err := farms.TransferFlock(home, flockID, otherID, &barnID); err != nil {
+		t.Fatalf("transfer flock: %v", err)
+	}
+	moved, err := flocks.FindByID(other, flockID)
+	if err != nil || moved.BarnID == nil || *moved.BarnID != barnID {
+		t.Fatalf("moved flock = %+v (%v), want in barn %d", moved, err, barnID)
+	}
+	var records int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM feeding_records WHERE flock_id = ? AND farm_id = ?`, flockID, otherID).Scan(&records); err != nil || records != 1 {
+		t.Fatalf("feeding records moved = %d (%v), want 1", records, err)
+	}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(1) FROM cost_entries WHERE flock_id = ? AND farm_id = ? AND barn_id = ?`, flockID, otherID, barnID).Scan(&records); err != nil || records != 1 {
+		t.Fatalf("cost entries moved = %d (%v), want 1", records, err)
+	}
+	// The feeding record now uses a copy of the feed type on the other farm, so it stays editable.
+	feeding, err := NewSQLiteFeedingRecordRepo(db).List(other)
+	if err != nil || len(feeding) != 1 || feeding[0].FeedTypeID == feedTypeID {
+		t.Fatalf("moved feeding records = %+v (%v), want one with the other farm's feed type", feeding, err)
+	}
+	record, err := NewSQLiteFeedingRecordRepo(db).FindByID(other, feeding[0].FeedingRecordID)
+	if err != nil {
+		t.Fatalf("find moved feeding record: %v", err)
+	}
+	if err := NewSQLiteFeedingRecordRepo(db).Update(other, record); err != nil {
+		t.Fatalf("edit moved feeding record: %v", err)
+	}
+
+	// Inventory stock is split off into the item of the same name on the other farm.
+	f := func(v float64) *float64 { return &v }
+	kg := "kg"
+	itemID, err := items.Create(home, &domain.InventoryItem{Name: "Grower pellets", Quantity: f(100), Unit: &kg})
+	if err != nil {
+		t.Fatalf("create item: %v", err)
+	}
+	if err := farms.TransferInventory(home, itemID, otherID, 150); !errors.Is(err, domain.ErrTransferQuantity) {
+		t.Fatalf("transfer too much: err = %v, want ErrTransferQuantity", err)
+	}
+	for range 2 {
+		if err := farms.TransferInventory(home, itemID, otherID, 30); err != nil {
+			t.Fatalf("transfer inventory: %v", err)
+		}
+	}
+	left, err := items.FindByID(home, itemID)
+	if err != nil || *left.Quantity != 40 {
+		t.Fatalf("left on the home farm = %v (%v), want 40", left, err)
+	}
+	there, err := items.List(other)
+	if err != nil || len(there) != 1 || *there[0].Quantity != 60 {
+		t.Fatalf("items on the other farm = %+v (%v), want one of 60", there, err)
+	}
+}
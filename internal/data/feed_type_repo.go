@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // FeedTypeRepo defines operations for feed type management.
@@ -19,7 +20,8 @@ type FeedTypeRepo interface {
 }
 
 type SQLiteFeedTypeRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteFeedTypeRepo(db *sql.DB) *SQLiteFeedTypeRepo {
@@ -27,9 +29,9 @@ func NewSQLiteFeedTypeRepo(db *sql.DB) *SQLiteFeedTypeRepo {
 }
 
 func (r *SQLiteFeedTypeRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM feed_types WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM feed_types WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -37,13 +39,13 @@ func (r *SQLiteFeedTypeRepo) Count(ctx context.Context) (int64, error) {
 
 func (r *SQLiteFeedTypeRepo) List(ctx context.Context) ([]*domain.FeedType, error) {
 	const q = `
-		SELECT feed_type_id, name, description, nutritional_info,
+		SELECT feed_type_id, name, description, nutritional_info, organic_certified, cost_per_kg,
 			   created_at, updated_at, deleted_at, created_by, updated_by
 		FROM feed_types
-		WHERE deleted_at IS NULL
+		WHERE farm_id = ? AND deleted_at IS NULL
 		ORDER BY name
 	`
-	rows, err := r.DB.QueryContext(ctx, q)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -57,6 +59,8 @@ func (r *SQLiteFeedTypeRepo) List(ctx context.Context) ([]*domain.FeedType, erro
 			&feedType.Name,
 			&feedType.Description,
 			&feedType.NutritionalInfo,
+			&feedType.OrganicCertified,
+			&feedType.CostPerKg,
 			&feedType.Audit.CreatedAt,
 			&feedType.Audit.UpdatedAt,
 			&feedType.Audit.DeletedAt,
@@ -73,22 +77,25 @@ func (r *SQLiteFeedTypeRepo) List(ctx context.Context) ([]*domain.FeedType, erro
 
 func (r *SQLiteFeedTypeRepo) FindByID(ctx context.Context, id int64) (*domain.FeedType, error) {
 	const q = `
-		SELECT feed_type_id, name, description, nutritional_info,
-			   created_at, updated_at, deleted_at, created_by, updated_by
+		SELECT feed_type_id, name, description, nutritional_info, organic_certified, cost_per_kg,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
 		FROM feed_types
-		WHERE feed_type_id = ? AND deleted_at IS NULL
+		WHERE feed_type_id = ? AND farm_id = ? AND deleted_at IS NULL
 	`
 	var feedType domain.FeedType
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&feedType.FeedTypeID,
 		&feedType.Name,
 		&feedType.Description,
 		&feedType.NutritionalInfo,
+		&feedType.OrganicCertified,
+		&feedType.CostPerKg,
 		&feedType.Audit.CreatedAt,
 		&feedType.Audit.UpdatedAt,
 		&feedType.Audit.DeletedAt,
 		&feedType.Audit.CreatedBy,
 		&feedType.Audit.UpdatedBy,
+		&feedType.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -98,18 +105,22 @@ func (r *SQLiteFeedTypeRepo) FindByID(ctx context.Context, id int64) (*domain.Fe
 
 func (r *SQLiteFeedTypeRepo) Create(ctx context.Context, feedType *domain.FeedType) (int64, error) {
 	const q = `
-		INSERT INTO feed_types (name, description, nutritional_info,
+		INSERT INTO feed_types (farm_id, name, description, nutritional_info, organic_certified, cost_per_kg,
 							   created_at, updated_at, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	now := time.Now()
 	feedType.Audit.CreatedAt = now
 	feedType.Audit.UpdatedAt = now
+	stampActor(ctx, &feedType.Audit)
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		feedType.Name,
 		feedType.Description,
 		feedType.NutritionalInfo,
+		boolToInt(feedType.OrganicCertified),
+		feedType.CostPerKg,
 		feedType.Audit.CreatedAt,
 		feedType.Audit.UpdatedAt,
 		feedType.Audit.CreatedBy,
@@ -118,32 +129,49 @@ func (r *SQLiteFeedTypeRepo) Create(ctx context.Context, feedType *domain.FeedTy
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "feed_types", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteFeedTypeRepo) Update(ctx context.Context, feedType *domain.FeedType) error {
 	const q = `
 		UPDATE feed_types
-		SET name = ?, description = ?, nutritional_info = ?,
-			updated_at = ?, updated_by = ?
-		WHERE feed_type_id = ? AND deleted_at IS NULL
-	`
+		SET name = ?, description = ?, nutritional_info = ?, organic_certified = ?, cost_per_kg = ?,
+			updated_at = ?, updated_by = ?, version = version + 1
+		WHERE feed_type_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	feedType.Audit.UpdatedAt = now
+	stampActor(ctx, &feedType.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		feedType.Name,
 		feedType.Description,
 		feedType.NutritionalInfo,
+		boolToInt(feedType.OrganicCertified),
+		feedType.CostPerKg,
 		feedType.Audit.UpdatedAt,
 		feedType.Audit.UpdatedBy,
 		feedType.FeedTypeID,
-	)
-	return err
+		FarmFrom(ctx),
+		feedType.Audit.Version,
+	).Scan(&feedType.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "feed_types", "feed_type_id", feedType.FeedTypeID)
+	}
+	publish(ctx, r.Events, "feed_types", feedType.FeedTypeID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteFeedTypeRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE feed_types SET deleted_at = ? WHERE feed_type_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE feed_types SET deleted_at = ? WHERE feed_type_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "feed_types", id, events.Deleted)
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // FeedingRecordRepo defines operations for feedingrecord management.
@@ -19,7 +20,8 @@ type FeedingRecordRepo interface {
 }
 
 type SQLiteFeedingRecordRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteFeedingRecordRepo(db *sql.DB) *SQLiteFeedingRecordRepo {
@@ -27,17 +29,17 @@ func NewSQLiteFeedingRecordRepo(db *sql.DB) *SQLiteFeedingRecordRepo {
 }
 
 func (r *SQLiteFeedingRecordRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM feeding_records WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM feeding_records WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteFeedingRecordRepo) List(ctx context.Context) ([]*domain.FeedingRecord, error) {
-	const q = `SELECT feeding_record_id, flock_id, feed_type_id, amount_given, date_time, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM feeding_records WHERE deleted_at IS NULL ORDER BY feeding_record_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT feeding_record_id, flock_id, feed_type_id, amount_given, lot_number, date_time, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM feeding_records WHERE farm_id = ? AND deleted_at IS NULL ORDER BY feeding_record_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -51,6 +53,7 @@ func (r *SQLiteFeedingRecordRepo) List(ctx context.Context) ([]*domain.FeedingRe
 			&item.FlockID,
 			&item.FeedTypeID,
 			&item.AmountGiven,
+			&item.LotNumber,
 			&item.DateTime,
 			&item.StaffID,
 			&item.Audit.CreatedAt,
@@ -68,13 +71,14 @@ func (r *SQLiteFeedingRecordRepo) List(ctx context.Context) ([]*domain.FeedingRe
 }
 
 func (r *SQLiteFeedingRecordRepo) FindByID(ctx context.Context, id int64) (*domain.FeedingRecord, error) {
-	const q = `SELECT feeding_record_id, flock_id, feed_type_id, amount_given, date_time, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM feeding_records WHERE feeding_record_id = ? AND deleted_at IS NULL`
+	const q = `SELECT feeding_record_id, flock_id, feed_type_id, amount_given, lot_number, date_time, staff_id, created_at, updated_at, deleted_at, created_by, updated_by, version FROM feeding_records WHERE feeding_record_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.FeedingRecord
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.FeedingRecordID,
 		&item.FlockID,
 		&item.FeedTypeID,
 		&item.AmountGiven,
+		&item.LotNumber,
 		&item.DateTime,
 		&item.StaffID,
 		&item.Audit.CreatedAt,
@@ -82,6 +86,7 @@ func (r *SQLiteFeedingRecordRepo) FindByID(ctx context.Context, id int64) (*doma
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -90,15 +95,24 @@ func (r *SQLiteFeedingRecordRepo) FindByID(ctx context.Context, id int64) (*doma
 }
 
 func (r *SQLiteFeedingRecordRepo) Create(ctx context.Context, f *domain.FeedingRecord) (int64, error) {
-	const q = `INSERT INTO feeding_records (flock_id, feed_type_id, amount_given, date_time, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO feeding_records (farm_id, flock_id, feed_type_id, amount_given, lot_number, date_time, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	f.Audit.CreatedAt = now
 	f.Audit.UpdatedAt = now
+	stampActor(ctx, &f.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &f.FlockID},
+		farmRef{"feed_types", "feed_type_id", &f.FeedTypeID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		f.FlockID,
 		f.FeedTypeID,
 		f.AmountGiven,
+		f.LotNumber,
 		f.DateTime,
 		f.StaffID,
 		f.Audit.CreatedAt,
@@ -109,28 +123,51 @@ func (r *SQLiteFeedingRecordRepo) Create(ctx context.Context, f *domain.FeedingR
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "feeding_records", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteFeedingRecordRepo) Update(ctx context.Context, f *domain.FeedingRecord) error {
-	const q = `UPDATE feeding_records SET flock_id = ?, feed_type_id = ?, amount_given = ?, date_time = ?, staff_id = ?, updated_at = ?, updated_by = ? WHERE feeding_record_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE feeding_records SET flock_id = ?, feed_type_id = ?, amount_given = ?, lot_number = ?, date_time = ?, staff_id = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE feeding_record_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	f.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &f.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &f.FlockID},
+		farmRef{"feed_types", "feed_type_id", &f.FeedTypeID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		f.FlockID,
 		f.FeedTypeID,
 		f.AmountGiven,
+		f.LotNumber,
 		f.DateTime,
 		f.StaffID,
 		f.Audit.UpdatedAt,
 		f.Audit.UpdatedBy,
 		f.FeedingRecordID,
-	)
-	return err
+		FarmFrom(ctx),
+		f.Audit.Version,
+	).Scan(&f.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "feeding_records", "feeding_record_id", f.FeedingRecordID)
+	}
+	publish(ctx, r.Events, "feeding_records", f.FeedingRecordID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteFeedingRecordRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE feeding_records SET deleted_at = ? WHERE feeding_record_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE feeding_records SET deleted_at = ? WHERE feeding_record_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "feeding_records", id, events.Deleted)
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // FlockRepo defines operations for flock management.
@@ -19,7 +20,8 @@ type FlockRepo interface {
 }
 
 type SQLiteFlockRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteFlockRepo(db *sql.DB) *SQLiteFlockRepo {
@@ -27,9 +29,9 @@ func NewSQLiteFlockRepo(db *sql.DB) *SQLiteFlockRepo {
 }
 
 func (r *SQLiteFlockRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM flocks WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM flocks WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -38,16 +40,16 @@ func (r *SQLiteFlockRepo) Count(ctx context.Context) (int64, error) {
 func (r *SQLiteFlockRepo) List(ctx context.Context) ([]*domain.Flock, error) {
 	const q = `
 		SELECT f.flock_id, f.breed, f.hatch_date, f.number_of_birds, f.current_age,
-			   f.barn_id, f.health_status, f.feed_type_id, f.notes,
+			   f.barn_id, f.health_status, f.feed_type_id, f.daily_feed_kg, f.notes,
 			   f.created_at, f.updated_at, f.deleted_at, f.created_by, f.updated_by,
 			   b.name as barn_name, ft.name as feed_type_name
 		FROM flocks f
 		LEFT JOIN barns b ON f.barn_id = b.barn_id AND b.deleted_at IS NULL
 		LEFT JOIN feed_types ft ON f.feed_type_id = ft.feed_type_id AND ft.deleted_at IS NULL
-		WHERE f.deleted_at IS NULL
+		WHERE f.farm_id = ? AND f.deleted_at IS NULL
 		ORDER BY f.breed, f.flock_id
 	`
-	rows, err := r.DB.QueryContext(ctx, q)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +69,7 @@ func (r *SQLiteFlockRepo) List(ctx context.Context) ([]*domain.Flock, error) {
 			&flock.BarnID,
 			&flock.HealthStatus,
 			&flock.FeedTypeID,
+			&flock.DailyFeedKg,
 			&flock.Notes,
 			&flock.Audit.CreatedAt,
 			&flock.Audit.UpdatedAt,
@@ -96,18 +99,18 @@ func (r *SQLiteFlockRepo) List(ctx context.Context) ([]*domain.Flock, error) {
 func (r *SQLiteFlockRepo) FindByID(ctx context.Context, id int64) (*domain.Flock, error) {
 	const q = `
 		SELECT f.flock_id, f.breed, f.hatch_date, f.number_of_birds, f.current_age,
-			   f.barn_id, f.health_status, f.feed_type_id, f.notes,
-			   f.created_at, f.updated_at, f.deleted_at, f.created_by, f.updated_by,
+			   f.barn_id, f.health_status, f.feed_type_id, f.daily_feed_kg, f.notes,
+			   f.created_at, f.updated_at, f.deleted_at, f.created_by, f.updated_by, f.version,
 			   b.name as barn_name, ft.name as feed_type_name
 		FROM flocks f
 		LEFT JOIN barns b ON f.barn_id = b.barn_id AND b.deleted_at IS NULL
 		LEFT JOIN feed_types ft ON f.feed_type_id = ft.feed_type_id AND ft.deleted_at IS NULL
-		WHERE f.flock_id = ? AND f.deleted_at IS NULL
+		WHERE f.flock_id = ? AND f.farm_id = ? AND f.deleted_at IS NULL
 	`
 	var flock domain.Flock
 	var barnName, feedTypeName sql.NullString
 
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&flock.FlockID,
 		&flock.Breed,
 		&flock.HatchDate,
@@ -116,12 +119,14 @@ func (r *SQLiteFlockRepo) FindByID(ctx context.Context, id int64) (*domain.Flock
 		&flock.BarnID,
 		&flock.HealthStatus,
 		&flock.FeedTypeID,
+		&flock.DailyFeedKg,
 		&flock.Notes,
 		&flock.Audit.CreatedAt,
 		&flock.Audit.UpdatedAt,
 		&flock.Audit.DeletedAt,
 		&flock.Audit.CreatedBy,
 		&flock.Audit.UpdatedBy,
+		&flock.Audit.Version,
 		&barnName,
 		&feedTypeName,
 	)
@@ -142,16 +147,24 @@ func (r *SQLiteFlockRepo) FindByID(ctx context.Context, id int64) (*domain.Flock
 
 func (r *SQLiteFlockRepo) Create(ctx context.Context, flock *domain.Flock) (int64, error) {
 	const q = `
-		INSERT INTO flocks (breed, hatch_date, number_of_birds, current_age,
-						   barn_id, health_status, feed_type_id, notes,
+		INSERT INTO flocks (farm_id, breed, hatch_date, number_of_birds, current_age,
+						   barn_id, health_status, feed_type_id, daily_feed_kg, notes,
 						   created_at, updated_at, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	now := time.Now()
 	flock.Audit.CreatedAt = now
 	flock.Audit.UpdatedAt = now
+	stampActor(ctx, &flock.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"barns", "barn_id", flock.BarnID},
+		farmRef{"feed_types", "feed_type_id", flock.FeedTypeID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		flock.Breed,
 		flock.HatchDate,
 		flock.NumberOfBirds,
@@ -159,6 +172,7 @@ func (r *SQLiteFlockRepo) Create(ctx context.Context, flock *domain.Flock) (int6
 		flock.BarnID,
 		flock.HealthStatus,
 		flock.FeedTypeID,
+		flock.DailyFeedKg,
 		flock.Notes,
 		flock.Audit.CreatedAt,
 		flock.Audit.UpdatedAt,
@@ -168,21 +182,32 @@ func (r *SQLiteFlockRepo) Create(ctx context.Context, flock *domain.Flock) (int6
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "flocks", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteFlockRepo) Update(ctx context.Context, flock *domain.Flock) error {
 	const q = `
 		UPDATE flocks
 		SET breed = ?, hatch_date = ?, number_of_birds = ?, current_age = ?,
-			barn_id = ?, health_status = ?, feed_type_id = ?, notes = ?,
-			updated_at = ?, updated_by = ?
-		WHERE flock_id = ? AND deleted_at IS NULL
-	`
+			barn_id = ?, health_status = ?, feed_type_id = ?, daily_feed_kg = ?, notes = ?,
+			updated_at = ?, updated_by = ?, version = version + 1
+		WHERE flock_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	flock.Audit.UpdatedAt = now
+	stampActor(ctx, &flock.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"barns", "barn_id", flock.BarnID},
+		farmRef{"feed_types", "feed_type_id", flock.FeedTypeID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		flock.Breed,
 		flock.HatchDate,
 		flock.NumberOfBirds,
@@ -190,16 +215,27 @@ func (r *SQLiteFlockRepo) Update(ctx context.Context, flock *domain.Flock) error
 		flock.BarnID,
 		flock.HealthStatus,
 		flock.FeedTypeID,
+		flock.DailyFeedKg,
 		flock.Notes,
 		flock.Audit.UpdatedAt,
 		flock.Audit.UpdatedBy,
 		flock.FlockID,
-	)
-	return err
+		FarmFrom(ctx),
+		flock.Audit.Version,
+	).Scan(&flock.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "flocks", "flock_id", flock.FlockID)
+	}
+	publish(ctx, r.Events, "flocks", flock.FlockID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteFlockRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE flocks SET deleted_at = ? WHERE flock_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE flocks SET deleted_at = ? WHERE flock_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "flocks", id, events.Deleted)
+	return nil
 }
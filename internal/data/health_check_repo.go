@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // HealthCheckRepo defines operations for healthcheck management.
@@ -19,7 +20,8 @@ type HealthCheckRepo interface {
 }
 
 type SQLiteHealthCheckRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteHealthCheckRepo(db *sql.DB) *SQLiteHealthCheckRepo {
@@ -27,17 +29,17 @@ func NewSQLiteHealthCheckRepo(db *sql.DB) *SQLiteHealthCheckRepo {
 }
 
 func (r *SQLiteHealthCheckRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM health_checks WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM health_checks WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteHealthCheckRepo) List(ctx context.Context) ([]*domain.HealthCheck, error) {
-	const q = `SELECT health_check_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM health_checks WHERE deleted_at IS NULL ORDER BY health_check_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT health_check_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM health_checks WHERE farm_id = ? AND deleted_at IS NULL ORDER BY health_check_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -70,9 +72,9 @@ func (r *SQLiteHealthCheckRepo) List(ctx context.Context) ([]*domain.HealthCheck
 }
 
 func (r *SQLiteHealthCheckRepo) FindByID(ctx context.Context, id int64) (*domain.HealthCheck, error) {
-	const q = `SELECT health_check_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM health_checks WHERE health_check_id = ? AND deleted_at IS NULL`
+	const q = `SELECT health_check_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, deleted_at, created_by, updated_by, version FROM health_checks WHERE health_check_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.HealthCheck
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.HealthCheckID,
 		&item.FlockID,
 		&item.CheckDate,
@@ -86,6 +88,7 @@ func (r *SQLiteHealthCheckRepo) FindByID(ctx context.Context, id int64) (*domain
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -94,12 +97,19 @@ func (r *SQLiteHealthCheckRepo) FindByID(ctx context.Context, id int64) (*domain
 }
 
 func (r *SQLiteHealthCheckRepo) Create(ctx context.Context, h *domain.HealthCheck) (int64, error) {
-	const q = `INSERT INTO health_checks (flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO health_checks (farm_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	h.Audit.CreatedAt = now
 	h.Audit.UpdatedAt = now
+	stampActor(ctx, &h.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &h.FlockID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		h.FlockID,
 		h.CheckDate,
 		h.HealthStatus,
@@ -115,14 +125,25 @@ func (r *SQLiteHealthCheckRepo) Create(ctx context.Context, h *domain.HealthChec
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "health_checks", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteHealthCheckRepo) Update(ctx context.Context, h *domain.HealthCheck) error {
-	const q = `UPDATE health_checks SET flock_id = ?, check_date = ?, health_status = ?, vaccinations_given = ?, treatments_administered = ?, notes = ?, staff_id = ?, updated_at = ?, updated_by = ? WHERE health_check_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE health_checks SET flock_id = ?, check_date = ?, health_status = ?, vaccinations_given = ?, treatments_administered = ?, notes = ?, staff_id = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE health_check_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	h.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &h.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &h.FlockID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		h.FlockID,
 		h.CheckDate,
 		h.HealthStatus,
@@ -133,12 +154,22 @@ func (r *SQLiteHealthCheckRepo) Update(ctx context.Context, h *domain.HealthChec
 		h.Audit.UpdatedAt,
 		h.Audit.UpdatedBy,
 		h.HealthCheckID,
-	)
-	return err
+		FarmFrom(ctx),
+		h.Audit.Version,
+	).Scan(&h.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "health_checks", "health_check_id", h.HealthCheckID)
+	}
+	publish(ctx, r.Events, "health_checks", h.HealthCheckID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteHealthCheckRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE health_checks SET deleted_at = ? WHERE health_check_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE health_checks SET deleted_at = ? WHERE health_check_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "health_checks", id, events.Deleted)
+	return nil
 }
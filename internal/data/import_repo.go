@@ -0,0 +1,333 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// importUploadKeep is how long an upload that was never committed is kept.
+const importUploadKeep = 7 * 24 * time.Hour
+
+// ImportRepo defines the uploads and saved column mappings of the spreadsheet imports, and the
+// records the names in a sheet resolve to. The imported records themselves are written by their
+// own repositories, in one unit of work with MarkCommitted.
+type ImportRepo interface {
+	// Lookups returns the context farm's barns, flocks, feed types and customers, and the
+	// product catalog, for resolving names.
+	Lookups(ctx context.Context) (*domain.ImportLookups, error)
+	// CreateUpload keeps an uploaded sheet, dropping uploads of the farm never committed within
+	// a week.
+	CreateUpload(ctx context.Context, u *domain.ImportUpload) (int64, error)
+	// FindUpload returns an upload of the context farm.
+	FindUpload(ctx context.Context, id int64) (*domain.ImportUpload, error)
+	// ListUploads returns the farm's latest uploads, newest first, without their rows.
+	ListUploads(ctx context.Context, limit int) ([]*domain.ImportUpload, error)
+	// MarkCommitted records that rows rows of an upload were imported. An upload already
+	// committed returns domain.ErrImportCommitted.
+	MarkCommitted(ctx context.Context, id int64, rows int) error
+	// RecordImportedOrder records in an imported order's status history that it was imported
+	// with its status, so the history does not start past draft without a step.
+	RecordImportedOrder(ctx context.Context, orderID int64, status domain.OrderStatus, filename string) error
+	// ListMappings returns the saved mappings of an entity, by name.
+	ListMappings(ctx context.Context, entity domain.ImportEntity) ([]*domain.SavedImportMapping, error)
+	// FindMapping returns a saved mapping of the context farm.
+	FindMapping(ctx context.Context, id int64) (*domain.SavedImportMapping, error)
+	// SaveMapping saves a mapping under its name, replacing the entity's mapping of that name.
+	SaveMapping(ctx context.Context, m *domain.SavedImportMapping) error
+	// DeleteMapping deletes a saved mapping.
+	DeleteMapping(ctx context.Context, id int64) error
+}
+
+type SQLiteImportRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteImportRepo(db *sql.DB) *SQLiteImportRepo {
+	return &SQLiteImportRepo{DB: db}
+}
+
+func (r *SQLiteImportRepo) Lookups(ctx context.Context) (*domain.ImportLookups, error) {
+	const qBarns = `SELECT barn_id, name FROM barns WHERE farm_id = ? AND deleted_at IS NULL`
+	const qFlocks = `SELECT flock_id, breed, hatch_date, barn_id FROM flocks WHERE farm_id = ? AND deleted_at IS NULL`
+	const qFeedTypes = `SELECT feed_type_id, name FROM feed_types WHERE farm_id = ? AND deleted_at IS NULL`
+	const qCustomers = `SELECT customer_id, name FROM customers WHERE farm_id = ? AND deleted_at IS NULL`
+	const qProducts = `SELECT product_id, sku, name, vat_rate FROM products WHERE deleted_at IS NULL`
+
+	db := conn(ctx, r.DB)
+	farmID := FarmFrom(ctx)
+	l := domain.NewImportLookups()
+	for _, names := range []struct {
+		q    string
+		into domain.ImportNames
+	}{
+		{qBarns, l.Barns},
+		{qFeedTypes, l.FeedTypes},
+		{qCustomers, l.Customers},
+	} {
+		if err := scanNames(ctx, db, names.into, names.q, farmID); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, qFlocks, farmID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f domain.Flock
+		if err := rows.Scan(&f.FlockID, &f.Breed, &f.HatchDate, &f.BarnID); err != nil {
+			return nil, err
+		}
+		l.Flocks = append(l.Flocks, &f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	products, err := db.QueryContext(ctx, qProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer products.Close()
+	for products.Next() {
+		var p domain.Product
+		if err := products.Scan(&p.ProductID, &p.SKU, &p.Name, &p.VATRate); err != nil {
+			return nil, err
+		}
+		l.Products.Add(p.SKU, p.ProductID)
+		l.Products.Add(p.Name, p.ProductID)
+		l.ProductVAT[p.ProductID] = p.VATRate
+	}
+	return l, products.Err()
+}
+
+// scanNames adds the ID and name of each row q returns to names.
+func scanNames(ctx context.Context, db queryer, names domain.ImportNames, q string, args ...any) error {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id   int64
+			name string
+		)
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		names.Add(name, id)
+	}
+	return rows.Err()
+}
+
+func (r *SQLiteImportRepo) CreateUpload(ctx context.Context, u *domain.ImportUpload) (int64, error) {
+	const qPrune = `DELETE FROM import_uploads WHERE farm_id = ? AND committed_at IS NULL AND created_at < ?`
+	const q = `INSERT INTO import_uploads (farm_id, entity, filename, header, rows, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	header, err := json.Marshal(u.Header)
+	if err != nil {
+		return 0, err
+	}
+	sheetRows, err := json.Marshal(u.Rows)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	u.Audit.CreatedAt = now
+	stampActor(ctx, &u.Audit)
+
+	err = withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, qPrune, FarmFrom(ctx), now.Add(-importUploadKeep)); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q, FarmFrom(ctx), u.Entity, u.Filename, string(header), string(sheetRows), u.Audit.CreatedAt, u.Audit.CreatedBy)
+		if err != nil {
+			return err
+		}
+		u.UploadID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "import_uploads", u.UploadID, events.Created)
+	return u.UploadID, nil
+}
+
+func (r *SQLiteImportRepo) FindUpload(ctx context.Context, id int64) (*domain.ImportUpload, error) {
+	const q = `SELECT upload_id, entity, filename, header, rows, imported_rows, committed_at, created_at, created_by
+		FROM import_uploads WHERE upload_id = ? AND farm_id = ?`
+	var (
+		u                 domain.ImportUpload
+		header, sheetRows string
+	)
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
+		&u.UploadID,
+		&u.Entity,
+		&u.Filename,
+		&header,
+		&sheetRows,
+		&u.ImportedRows,
+		&u.CommittedAt,
+		&u.Audit.CreatedAt,
+		&u.Audit.CreatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(header), &u.Header); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sheetRows), &u.Rows); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *SQLiteImportRepo) ListUploads(ctx context.Context, limit int) ([]*domain.ImportUpload, error) {
+	const q = `SELECT upload_id, entity, filename, imported_rows, committed_at, created_at, created_by
+		FROM import_uploads WHERE farm_id = ? ORDER BY created_at DESC, upload_id DESC LIMIT ?`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []*domain.ImportUpload
+	for rows.Next() {
+		var u domain.ImportUpload
+		if err := rows.Scan(&u.UploadID, &u.Entity, &u.Filename, &u.ImportedRows, &u.CommittedAt, &u.Audit.CreatedAt, &u.Audit.CreatedBy); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, &u)
+	}
+	return uploads, rows.Err()
+}
+
+func (r *SQLiteImportRepo) MarkCommitted(ctx context.Context, id int64, rows int) error {
+	const q = `UPDATE import_uploads SET imported_rows = ?, committed_at = ? WHERE upload_id = ? AND farm_id = ? AND committed_at IS NULL`
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, rows, time.Now(), id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return domain.ErrImportCommitted
+	}
+	publish(ctx, r.Events, "import_uploads", id, events.Updated)
+	return nil
+}
+
+func (r *SQLiteImportRepo) RecordImportedOrder(ctx context.Context, orderID int64, status domain.OrderStatus, filename string) error {
+	const q = `INSERT INTO order_status_transitions (order_id, from_status, to_status, note, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?)`
+	if status == domain.OrderStatusDraft {
+		return nil
+	}
+	note := "Imported from " + filename
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, orderID, domain.OrderStatusDraft, status, note, time.Now(), actorID(ctx)); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "orders", orderID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteImportRepo) ListMappings(ctx context.Context, entity domain.ImportEntity) ([]*domain.SavedImportMapping, error) {
+	const q = mappingSelect + ` AND entity = ? ORDER BY name COLLATE NOCASE`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), entity)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*domain.SavedImportMapping
+	for rows.Next() {
+		m, err := scanMapping(rows)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, rows.Err()
+}
+
+func (r *SQLiteImportRepo) FindMapping(ctx context.Context, id int64) (*domain.SavedImportMapping, error) {
+	const q = mappingSelect + ` AND mapping_id = ?`
+	return scanMapping(conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx), id))
+}
+
+const mappingSelect = `SELECT mapping_id, entity, name, columns, created_at, updated_at, created_by, updated_by
+	FROM import_mappings WHERE farm_id = ?`
+
+// scanMapping scans a row of mappingSelect.
+func scanMapping(row interface{ Scan(...any) error }) (*domain.SavedImportMapping, error) {
+	var (
+		m       domain.SavedImportMapping
+		columns string
+	)
+	err := row.Scan(&m.MappingID, &m.Entity, &m.Name, &columns, &m.Audit.CreatedAt, &m.Audit.UpdatedAt, &m.Audit.CreatedBy, &m.Audit.UpdatedBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(columns), &m.Columns); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *SQLiteImportRepo) SaveMapping(ctx context.Context, m *domain.SavedImportMapping) error {
+	const q = `INSERT INTO import_mappings (farm_id, entity, name, columns, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (farm_id, entity, name) DO UPDATE SET columns = excluded.columns, updated_at = excluded.updated_at, updated_by = excluded.updated_by
+		RETURNING mapping_id`
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Name == "" {
+		return errors.New("mapping name is required")
+	}
+	columns, err := json.Marshal(m.Columns)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	m.Audit.CreatedAt = now
+	m.Audit.UpdatedAt = now
+	stampActor(ctx, &m.Audit)
+	err = conn(ctx, r.DB).QueryRowContext(ctx, q,
+		FarmFrom(ctx),
+		m.Entity,
+		m.Name,
+		string(columns),
+		m.Audit.CreatedAt,
+		m.Audit.UpdatedAt,
+		m.Audit.CreatedBy,
+		m.Audit.UpdatedBy,
+	).Scan(&m.MappingID)
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "import_mappings", m.MappingID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteImportRepo) DeleteMapping(ctx context.Context, id int64) error {
+	const q = `DELETE FROM import_mappings WHERE mapping_id = ? AND farm_id = ?`
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	publish(ctx, r.Events, "import_mappings", id, events.Deleted)
+	return nil
+}
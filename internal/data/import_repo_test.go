@@ -0,0 +1,88 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestImportRepo_UploadsAndMappings(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLiteImportRepo(db)
+
+	barnID, err := NewSQLiteBarnRepo(db).Create(ctx, &domain.Barn{Name: "North shed"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	hatch := time.Date(2024, 3, 1, 0, 0, 0, 0, time.Local)
+	if _, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze", HatchDate: &hatch, BarnID: &barnID}); err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	l, err := repo.Lookups(ctx)
+	if err != nil {
+		t.Fatalf("lookups: %v", err)
+	}
+	if id, err := l.Barns.Find("barn", "north SHED "); err != nil || id != barnID {
+		t.Errorf("barn lookup = %d (%v), want %d", id, err, barnID)
+	}
+	if len(l.Flocks) != 1 || l.Flocks[0].HatchDate == nil || !l.Flocks[0].HatchDate.Equal(hatch) {
+		t.Errorf("flocks = %+v, want the Bronze flock with its hatch date", l.Flocks)
+	}
+
+	u := &domain.ImportUpload{
+		Entity:   domain.ImportMortality,
+		Filename: "deaths.csv",
+		Header:   []string{"Flock", "Date", "Dead"},
+		Rows:     []domain.ImportSheetRow{{Line: 2, Cells: []string{"Bronze", "2024-04-01", "3"}}},
+	}
+	id, err := repo.CreateUpload(ctx, u)
+	if err != nil {
+		t.Fatalf("create upload: %v", err)
+	}
+	got, err := repo.FindUpload(ctx, id)
+	if err != nil {
+		t.Fatalf("find upload: %v", err)
+	}
+	if got.Entity != domain.ImportMortality || len(got.Header) != 3 || len(got.Rows) != 1 || got.Rows[0].Cells[2] != "3" || got.CommittedAt != nil {
+		t.Fatalf("upload = %+v", got)
+	}
+
+	if err := repo.MarkCommitted(ctx, id, 1); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := repo.MarkCommitted(ctx, id, 1); !errors.Is(err, domain.ErrImportCommitted) {
+		t.Fatalf("second commit: err = %v, want ErrImportCommitted", err)
+	}
+	uploads, err := repo.ListUploads(ctx, 10)
+	if err != nil || len(uploads) != 1 || uploads[0].ImportedRows == nil || *uploads[0].ImportedRows != 1 {
+		t.Fatalf("uploads = %+v (%v), want one with 1 row imported", uploads, err)
+	}
+
+	// Saving under a taken name replaces the mapping.
+	m := &domain.SavedImportMapping{Entity: domain.ImportMortality, Name: "Old book", Columns: domain.ImportMapping{"flock_breed": "Flock"}}
+	if err := repo.SaveMapping(ctx, m); err != nil {
+		t.Fatalf("save mapping: %v", err)
+	}
+	again := &domain.SavedImportMapping{Entity: domain.ImportMortality, Name: " Old book", Columns: domain.ImportMapping{"flock_breed": "Breed"}}
+	if err := repo.SaveMapping(ctx, again); err != nil {
+		t.Fatalf("resave mapping: %v", err)
+	}
+	if again.MappingID != m.MappingID {
+		t.Errorf("resaved mapping id = %d, want %d", again.MappingID, m.MappingID)
+	}
+	mappings, err := repo.ListMappings(ctx, domain.ImportMortality)
+	if err != nil || len(mappings) != 1 || mappings[0].Columns["flock_breed"] != "Breed" {
+		t.Fatalf("mappings = %+v (%v), want the replaced one", mappings, err)
+	}
+	if others, err := repo.ListMappings(ctx, domain.ImportFeeding); err != nil || len(others) != 0 {
+		t.Errorf("feeding mappings = %+v (%v), want none", others, err)
+	}
+	if err := repo.DeleteMapping(ctx, m.MappingID); err != nil {
+		t.Fatalf("delete mapping: %v", err)
+	}
+	if _, err := repo.FindMapping(ctx, m.MappingID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("find deleted mapping: err = %v, want ErrNotFound", err)
+	}
+}
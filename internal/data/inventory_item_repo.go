@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // InventoryItemRepo defines operations for inventoryitem management.
@@ -19,7 +20,8 @@ type InventoryItemRepo interface {
 }
 
 type SQLiteInventoryItemRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteInventoryItemRepo(db *sql.DB) *SQLiteInventoryItemRepo {
@@ -27,17 +29,17 @@ func NewSQLiteInventoryItemRepo(db *sql.DB) *SQLiteInventoryItemRepo {
 }
 
 func (r *SQLiteInventoryItemRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM inventory_items WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM inventory_items WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteInventoryItemRepo) List(ctx context.Context) ([]*domain.InventoryItem, error) {
-	const q = `SELECT inventory_item_id, name, type, quantity, unit, expiration_date, supplier_info, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM inventory_items WHERE deleted_at IS NULL ORDER BY inventory_item_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT inventory_item_id, name, type, quantity, unit, reorder_level, expiration_date, supplier_info, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM inventory_items WHERE farm_id = ? AND deleted_at IS NULL ORDER BY inventory_item_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -52,6 +54,7 @@ func (r *SQLiteInventoryItemRepo) List(ctx context.Context) ([]*domain.Inventory
 			&item.Type,
 			&item.Quantity,
 			&item.Unit,
+			&item.ReorderLevel,
 			&item.ExpirationDate,
 			&item.SupplierInfo,
 			&item.Notes,
@@ -70,14 +73,15 @@ func (r *SQLiteInventoryItemRepo) List(ctx context.Context) ([]*domain.Inventory
 }
 
 func (r *SQLiteInventoryItemRepo) FindByID(ctx context.Context, id int64) (*domain.InventoryItem, error) {
-	const q = `SELECT inventory_item_id, name, type, quantity, unit, expiration_date, supplier_info, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM inventory_items WHERE inventory_item_id = ? AND deleted_at IS NULL`
+	const q = `SELECT inventory_item_id, name, type, quantity, unit, reorder_level, expiration_date, supplier_info, notes, created_at, updated_at, deleted_at, created_by, updated_by, version FROM inventory_items WHERE inventory_item_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.InventoryItem
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.InventoryItemID,
 		&item.Name,
 		&item.Type,
 		&item.Quantity,
 		&item.Unit,
+		&item.ReorderLevel,
 		&item.ExpirationDate,
 		&item.SupplierInfo,
 		&item.Notes,
@@ -86,6 +90,7 @@ func (r *SQLiteInventoryItemRepo) FindByID(ctx context.Context, id int64) (*doma
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -94,16 +99,19 @@ func (r *SQLiteInventoryItemRepo) FindByID(ctx context.Context, id int64) (*doma
 }
 
 func (r *SQLiteInventoryItemRepo) Create(ctx context.Context, i *domain.InventoryItem) (int64, error) {
-	const q = `INSERT INTO inventory_items (name, type, quantity, unit, expiration_date, supplier_info, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO inventory_items (farm_id, name, type, quantity, unit, reorder_level, expiration_date, supplier_info, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	i.Audit.CreatedAt = now
 	i.Audit.UpdatedAt = now
+	stampActor(ctx, &i.Audit)
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		i.Name,
 		i.Type,
 		i.Quantity,
 		i.Unit,
+		i.ReorderLevel,
 		i.ExpirationDate,
 		i.SupplierInfo,
 		i.Notes,
@@ -115,30 +123,47 @@ func (r *SQLiteInventoryItemRepo) Create(ctx context.Context, i *domain.Inventor
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "inventory_items", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteInventoryItemRepo) Update(ctx context.Context, i *domain.InventoryItem) error {
-	const q = `UPDATE inventory_items SET name = ?, type = ?, quantity = ?, unit = ?, expiration_date = ?, supplier_info = ?, notes = ?, updated_at = ?, updated_by = ? WHERE inventory_item_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE inventory_items SET name = ?, type = ?, quantity = ?, unit = ?, reorder_level = ?, expiration_date = ?, supplier_info = ?, notes = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE inventory_item_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	i.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &i.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		i.Name,
 		i.Type,
 		i.Quantity,
 		i.Unit,
+		i.ReorderLevel,
 		i.ExpirationDate,
 		i.SupplierInfo,
 		i.Notes,
 		i.Audit.UpdatedAt,
 		i.Audit.UpdatedBy,
 		i.InventoryItemID,
-	)
-	return err
+		FarmFrom(ctx),
+		i.Audit.Version,
+	).Scan(&i.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "inventory_items", "inventory_item_id", i.InventoryItemID)
+	}
+	publish(ctx, r.Events, "inventory_items", i.InventoryItemID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteInventoryItemRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE inventory_items SET deleted_at = ? WHERE inventory_item_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE inventory_items SET deleted_at = ? WHERE inventory_item_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "inventory_items", id, events.Deleted)
+	return nil
 }
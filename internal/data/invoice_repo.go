@@ -0,0 +1,266 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// InvoiceRepo defines operations for invoices and credit notes. Issued documents are immutable,
+// so there is no update or delete.
+type InvoiceRepo interface {
+	// Count returns the number of issued invoices and credit notes.
+	Count(ctx context.Context) (int64, error)
+	// List returns all invoices and credit notes, newest first, without lines.
+	List(ctx context.Context) ([]*domain.Invoice, error)
+	// ListByCustomer returns the invoices and credit notes of a customer, oldest first, without lines.
+	ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Invoice, error)
+	// ListByOrder returns the invoices and credit notes of an order, oldest first, without lines.
+	ListByOrder(ctx context.Context, orderID int64) ([]*domain.Invoice, error)
+	// FindByID returns an invoice or credit note with its lines.
+	FindByID(ctx context.Context, id int64) (*domain.Invoice, error)
+	// CreditNoteFor returns the credit note issued against an invoice, or ErrNotFound.
+	CreditNoteFor(ctx context.Context, invoiceID int64) (*domain.Invoice, error)
+	// Issue assigns the next number of the document's fiscal year and kind and stores it with its
+	// lines. Issuing an invoice also moves a delivered order to invoiced; all of it commits
+	// together. An order has at most one invoice that is not credited (ErrOrderAlreadyInvoiced).
+	Issue(ctx context.Context, inv *domain.Invoice) (int64, error)
+}
+
+type SQLiteInvoiceRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteInvoiceRepo(db *sql.DB) *SQLiteInvoiceRepo {
+	return &SQLiteInvoiceRepo{DB: db}
+}
+
+const invoiceColumns = `invoice_id, kind, number, fiscal_year, sequence, order_id, customer_id, credited_invoice_id,
+	issue_date, due_date, customer_name, customer_address, subtotal_amount, vat_amount, delivery_fee, total_amount,
+	reason, created_at, created_by`
+
+func scanInvoice(scan func(dest ...any) error) (*domain.Invoice, error) {
+	var inv domain.Invoice
+	err := scan(
+		&inv.InvoiceID,
+		&inv.Kind,
+		&inv.Number,
+		&inv.FiscalYear,
+		&inv.Sequence,
+		&inv.OrderID,
+		&inv.CustomerID,
+		&inv.CreditedInvoiceID,
+		&inv.IssueDate,
+		&inv.DueDate,
+		&inv.CustomerName,
+		&inv.CustomerAddress,
+		&inv.SubtotalAmount,
+		&inv.VATAmount,
+		&inv.DeliveryFee,
+		&inv.TotalAmount,
+		&inv.Reason,
+		&inv.CreatedAt,
+		&inv.CreatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (r *SQLiteInvoiceRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM invoices WHERE farm_id = ?`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *SQLiteInvoiceRepo) List(ctx context.Context) ([]*domain.Invoice, error) {
+	const q = `SELECT ` + invoiceColumns + ` FROM invoices WHERE farm_id = ? ORDER BY issue_date DESC, invoice_id DESC`
+	return r.list(ctx, q, FarmFrom(ctx))
+}
+
+func (r *SQLiteInvoiceRepo) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Invoice, error) {
+	const q = `SELECT ` + invoiceColumns + ` FROM invoices WHERE customer_id = ? AND farm_id = ? ORDER BY issue_date, invoice_id`
+	return r.list(ctx, q, customerID, FarmFrom(ctx))
+}
+
+func (r *SQLiteInvoiceRepo) ListByOrder(ctx context.Context, orderID int64) ([]*domain.Invoice, error) {
+	const q = `SELECT ` + invoiceColumns + ` FROM invoices WHERE order_id = ? AND farm_id = ? ORDER BY invoice_id`
+	return r.list(ctx, q, orderID, FarmFrom(ctx))
+}
+
+func (r *SQLiteInvoiceRepo) list(ctx context.Context, q string, args ...any) ([]*domain.Invoice, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []*domain.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+	return invoices, rows.Err()
+}
+
+func (r *SQLiteInvoiceRepo) FindByID(ctx context.Context, id int64) (*domain.Invoice, error) {
+	const q = `SELECT ` + invoiceColumns + ` FROM invoices WHERE invoice_id = ? AND farm_id = ?`
+	inv, err := scanInvoice(conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	const qLines = `SELECT invoice_line_id, invoice_id, description, quantity, unit, unit_price, discount, vat_rate, net_amount, vat_amount
+		FROM invoice_lines WHERE invoice_id = ? ORDER BY invoice_line_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qLines, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line domain.InvoiceLine
+		err := rows.Scan(
+			&line.InvoiceLineID,
+			&line.InvoiceID,
+			&line.Description,
+			&line.Quantity,
+			&line.Unit,
+			&line.UnitPrice,
+			&line.Discount,
+			&line.VATRate,
+			&line.NetAmount,
+			&line.VATAmount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		inv.Lines = append(inv.Lines, &line)
+	}
+	return inv, rows.Err()
+}
+
+func (r *SQLiteInvoiceRepo) CreditNoteFor(ctx context.Context, invoiceID int64) (*domain.Invoice, error) {
+	const q = `SELECT ` + invoiceColumns + ` FROM invoices WHERE credited_invoice_id = ? AND farm_id = ?`
+	return scanInvoice(conn(ctx, r.DB).QueryRowContext(ctx, q, invoiceID, FarmFrom(ctx)).Scan)
+}
+
+func (r *SQLiteInvoiceRepo) Issue(ctx context.Context, inv *domain.Invoice) (int64, error) {
+	const qSequence = `INSERT INTO invoice_sequences (fiscal_year, kind, last_number) VALUES (?, ?, 1)
+		ON CONFLICT (fiscal_year, kind) DO UPDATE SET last_number = last_number + 1
+		RETURNING last_number`
+	const qInvoice = `INSERT INTO invoices (farm_id, kind, number, fiscal_year, sequence, order_id, customer_id, credited_invoice_id,
+		issue_date, due_date, customer_name, customer_address, subtotal_amount, vat_amount, delivery_fee, total_amount,
+		reason, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const qLine = `INSERT INTO invoice_lines (invoice_id, description, quantity, unit, unit_price, discount, vat_rate, net_amount, vat_amount)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	const qOpen = `SELECT COUNT(1) FROM invoices i
+		WHERE i.order_id = ? AND i.kind = 'invoice'
+		AND NOT EXISTS (SELECT 1 FROM invoices c WHERE c.credited_invoice_id = i.invoice_id)`
+	const qStatus = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+
+	inv.CreatedAt = time.Now()
+	if inv.CreatedBy == nil {
+		inv.CreatedBy = actorID(ctx)
+	}
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var status domain.OrderStatus
+		if inv.Kind == domain.InvoiceKindInvoice {
+			var open int
+			if err := tx.QueryRowContext(ctx, qOpen, inv.OrderID).Scan(&open); err != nil {
+				return err
+			}
+			if open > 0 {
+				return domain.ErrOrderAlreadyInvoiced
+			}
+			if err := tx.QueryRowContext(ctx, qStatus, inv.OrderID, FarmFrom(ctx)).Scan(&status); err != nil {
+				return err
+			}
+			if status != domain.OrderStatusDelivered && status != domain.OrderStatusInvoiced {
+				return domain.ErrOrderNotDelivered
+			}
+		}
+
+		// The sequence row is incremented in the same transaction as the insert, so a failed
+		// issue rolls the number back and numbering stays gap-free.
+		if err := tx.QueryRowContext(ctx, qSequence, inv.FiscalYear, inv.Kind).Scan(&inv.Sequence); err != nil {
+			return err
+		}
+		inv.Number = domain.FormatInvoiceNumber(inv.Kind, inv.FiscalYear, inv.Sequence)
+
+		result, err := tx.ExecContext(ctx, qInvoice,
+			FarmFrom(ctx),
+			inv.Kind,
+			inv.Number,
+			inv.FiscalYear,
+			inv.Sequence,
+			inv.OrderID,
+			inv.CustomerID,
+			inv.CreditedInvoiceID,
+			inv.IssueDate,
+			inv.DueDate,
+			inv.CustomerName,
+			inv.CustomerAddress,
+			inv.SubtotalAmount,
+			inv.VATAmount,
+			inv.DeliveryFee,
+			inv.TotalAmount,
+			inv.Reason,
+			inv.CreatedAt,
+			inv.CreatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if inv.InvoiceID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		for _, line := range inv.Lines {
+			line.InvoiceID = inv.InvoiceID
+			result, err := tx.ExecContext(ctx, qLine,
+				line.InvoiceID,
+				line.Description,
+				line.Quantity,
+				line.Unit,
+				line.UnitPrice,
+				line.Discount,
+				line.VATRate,
+				line.NetAmount,
+				line.VATAmount,
+			)
+			if err != nil {
+				return err
+			}
+			if line.InvoiceLineID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+		}
+
+		if status == domain.OrderStatusDelivered {
+			note := "Invoice " + inv.Number
+			return transitionOrderStatus(ctx, tx, inv.OrderID, domain.OrderStatusInvoiced, &note)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "invoices", inv.InvoiceID, events.Created)
+	// The order page lists its invoices, and issuing an invoice may have moved its status.
+	publish(ctx, r.Events, "orders", inv.OrderID, events.Updated)
+	return inv.InvoiceID, nil
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestInvoiceRepo_IssueNumbersAndCredits(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+	invoices := NewSQLiteInvoiceRepo(db)
+
+	customer := &domain.Customer{Name: "Butcher"}
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, customer)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	customer.CustomerID = customerID
+
+	f := func(v float64) *float64 { return &v }
+	deliveredOrder := func() *domain.Order {
+		t.Helper()
+		orderID, err := orders.Create(ctx, &domain.Order{CustomerID: customerID, DeliveryFee: 4})
+		if err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+		if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, Quantity: f(2), UnitPrice: f(10), VATRate: 9}); err != nil {
+			t.Fatalf("create line: %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE orders SET status = 'delivered' WHERE order_id = ?`, orderID); err != nil {
+			t.Fatalf("deliver order: %v", err)
+		}
+		order, err := orders.FindByID(ctx, orderID)
+		if err != nil {
+			t.Fatalf("find order: %v", err)
+		}
+		if order.Items, err = lines.ListByOrder(ctx, orderID); err != nil {
+			t.Fatalf("list lines: %v", err)
+		}
+		return order
+	}
+	issue := func(order *domain.Order) (*domain.Invoice, error) {
+		t.Helper()
+		inv, err := domain.NewInvoiceFromOrder(order, customer, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 30, time.January)
+		if err != nil {
+			t.Fatalf("draft invoice: %v", err)
+		}
+		_, err = invoices.Issue(ctx, inv)
+		return inv, err
+	}
+
+	first := deliveredOrder()
+	inv, err := issue(first)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if inv.Number != "INV-2026-00001" || inv.TotalAmount != 25.8 {
+		t.Fatalf("invoice = %s %v, want INV-2026-00001 25.8", inv.Number, inv.TotalAmount)
+	}
+	order, err := orders.FindByID(ctx, first.OrderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if order.Status != domain.OrderStatusInvoiced {
+		t.Errorf("order status = %s, want invoiced", order.Status)
+	}
+	order.Items = first.Items
+
+	// A second invoice for the same order is refused and does not consume a number.
+	if _, err := issue(order); !errors.Is(err, domain.ErrOrderAlreadyInvoiced) {
+		t.Fatalf("re-issue err = %v, want ErrOrderAlreadyInvoiced", err)
+	}
+	second, err := issue(deliveredOrder())
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if second.Number != "INV-2026-00002" {
+		t.Errorf("second number = %s, want INV-2026-00002", second.Number)
+	}
+
+	// Issued invoices cannot be changed.
+	if _, err := db.ExecContext(ctx, `UPDATE invoices SET total_amount = 0 WHERE invoice_id = ?`, inv.InvoiceID); err == nil {
+		t.Error("update of an issued invoice succeeded")
+	}
+
+	// A credit note reverses the invoice and allows billing the order again.
+	stored, err := invoices.FindByID(ctx, inv.InvoiceID)
+	if err != nil {
+		t.Fatalf("find invoice: %v", err)
+	}
+	note, err := domain.NewCreditNote(stored, "wrong weight", time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), time.January)
+	if err != nil {
+		t.Fatalf("draft credit note: %v", err)
+	}
+	if _, err := invoices.Issue(ctx, note); err != nil {
+		t.Fatalf("issue credit note: %v", err)
+	}
+	if note.Number != "CN-2026-00001" || note.TotalAmount != -25.8 {
+		t.Errorf("credit note = %s %v, want CN-2026-00001 -25.8", note.Number, note.TotalAmount)
+	}
+	credit, err := invoices.CreditNoteFor(ctx, inv.InvoiceID)
+	if err != nil || credit.InvoiceID != note.InvoiceID {
+		t.Fatalf("credit note for invoice = %v, %v", credit, err)
+	}
+	rebilled, err := issue(order)
+	if err != nil {
+		t.Fatalf("re-issue after credit: %v", err)
+	}
+	if rebilled.Number != "INV-2026-00003" {
+		t.Errorf("re-issued number = %s, want INV-2026-00003", rebilled.Number)
+	}
+}
@@ -0,0 +1,292 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// LabourRepo defines operations for staff time entries and the labour and feed cost of flocks.
+type LabourRepo interface {
+	// CountClockedIn returns the number of staff members clocked in right now.
+	CountClockedIn(ctx context.Context) (int64, error)
+	// ListClockedIn returns the open time entries, longest running first.
+	ListClockedIn(ctx context.Context) ([]*domain.TimeEntry, error)
+	// ListEntries returns the time entries started from from up to to, newest first.
+	ListEntries(ctx context.Context, from, to time.Time) ([]*domain.TimeEntry, error)
+	// ClockIn opens a time entry at e.StartedAt with the staff member's current hourly rate. It
+	// returns domain.ErrAlreadyClockedIn when the staff member has an open entry.
+	ClockIn(ctx context.Context, e *domain.TimeEntry) (int64, error)
+	// ClockOut closes the open time entry of a staff member. It returns ErrNotFound when the
+	// staff member is not clocked in.
+	ClockOut(ctx context.Context, staffID int64, at time.Time) error
+	// LogEntry records time worked after the fact, e.g. the hour a checklist task took, with the
+	// staff member's current hourly rate.
+	LogEntry(ctx context.Context, e *domain.TimeEntry) (int64, error)
+	DeleteEntry(ctx context.Context, id int64, deletedAt time.Time) error
+	// FlockCosts returns the labour and feed cost, birds placed and meat yield of every flock,
+	// newest first, and the hours that could not be allocated to a flock.
+	FlockCosts(ctx context.Context) ([]*domain.FlockCost, float64, error)
+}
+
+type SQLiteLabourRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteLabourRepo(db *sql.DB) *SQLiteLabourRepo {
+	return &SQLiteLabourRepo{DB: db}
+}
+
+func (r *SQLiteLabourRepo) CountClockedIn(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM time_entries WHERE farm_id = ? AND ended_at IS NULL AND deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// timeEntryColumns lists the columns listTimeEntries reads.
+const timeEntryColumns = `e.time_entry_id, e.staff_id, e.barn_id, e.flock_id, e.task_id, e.started_at, e.ended_at,
+	e.hourly_rate, e.notes, e.created_at, e.updated_at, e.deleted_at, e.created_by, e.updated_by,
+	st.name, b.name, f.breed, k.name`
+
+// timeEntryJoins joins the staff member, barn, flock and task of a time entry.
+const timeEntryJoins = `FROM time_entries e
+	JOIN staff st ON st.staff_id = e.staff_id
+	JOIN barns b ON b.barn_id = e.barn_id
+	LEFT JOIN flocks f ON f.flock_id = e.flock_id
+	LEFT JOIN tasks k ON k.task_id = e.task_id`
+
+func (r *SQLiteLabourRepo) ListClockedIn(ctx context.Context) ([]*domain.TimeEntry, error) {
+	const q = `SELECT ` + timeEntryColumns + ` ` + timeEntryJoins + `
+		WHERE e.farm_id = ? AND e.ended_at IS NULL AND e.deleted_at IS NULL
+		ORDER BY e.started_at`
+	return listTimeEntries(ctx, conn(ctx, r.DB), q, FarmFrom(ctx))
+}
+
+func (r *SQLiteLabourRepo) ListEntries(ctx context.Context, from, to time.Time) ([]*domain.TimeEntry, error) {
+	const q = `SELECT ` + timeEntryColumns + ` ` + timeEntryJoins + `
+		WHERE e.farm_id = ? AND e.deleted_at IS NULL AND e.started_at >= ? AND e.started_at < ?
+		ORDER BY e.started_at DESC`
+	return listTimeEntries(ctx, conn(ctx, r.DB), q, FarmFrom(ctx), from, to)
+}
+
+func (r *SQLiteLabourRepo) ClockIn(ctx context.Context, e *domain.TimeEntry) (int64, error) {
+	const qOpen = `SELECT COUNT(1) FROM time_entries WHERE staff_id = ? AND ended_at IS NULL AND deleted_at IS NULL`
+	e.EndedAt = nil
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "staff", "staff_id", e.StaffID); err != nil {
+			return err
+		}
+		var open int
+		if err := tx.QueryRowContext(ctx, qOpen, e.StaffID).Scan(&open); err != nil {
+			return err
+		}
+		if open > 0 {
+			return domain.ErrAlreadyClockedIn
+		}
+		var err error
+		id, err = insertTimeEntry(ctx, tx, e)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "time_entries", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteLabourRepo) ClockOut(ctx context.Context, staffID int64, at time.Time) error {
+	const qOpen = `SELECT time_entry_id, started_at FROM time_entries WHERE staff_id = ? AND farm_id = ? AND ended_at IS NULL AND deleted_at IS NULL`
+	const q = `UPDATE time_entries SET ended_at = ?, updated_at = ?, updated_by = ? WHERE time_entry_id = ?`
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var startedAt time.Time
+		if err := tx.QueryRowContext(ctx, qOpen, staffID, FarmFrom(ctx)).Scan(&id, &startedAt); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return err
+		}
+		if !at.After(startedAt) {
+			return domain.ErrEntryEndsBeforeStart
+		}
+		_, err := tx.ExecContext(ctx, q, at, time.Now(), actorID(ctx), id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "time_entries", id, events.Updated)
+	return nil
+}
+
+func (r *SQLiteLabourRepo) LogEntry(ctx context.Context, e *domain.TimeEntry) (int64, error) {
+	if e.EndedAt == nil || !e.EndedAt.After(e.StartedAt) {
+		return 0, domain.ErrEntryEndsBeforeStart
+	}
+	if err := onFarm(ctx, conn(ctx, r.DB), "staff", "staff_id", e.StaffID); err != nil {
+		return 0, err
+	}
+	id, err := insertTimeEntry(ctx, conn(ctx, r.DB), e)
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "time_entries", id, events.Created)
+	return id, nil
+}
+
+// insertTimeEntry inserts e with the hourly rate its staff member has now.
+func insertTimeEntry(ctx context.Context, db execer, e *domain.TimeEntry) (int64, error) {
+	const q = `INSERT INTO time_entries (farm_id, staff_id, barn_id, flock_id, task_id, started_at, ended_at, hourly_rate, notes, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, (SELECT hourly_rate FROM staff WHERE staff_id = ?), ?, ?, ?, ?, ?)`
+	e.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &e.Audit)
+
+	result, err := db.ExecContext(ctx, q,
+		FarmFrom(ctx),
+		e.StaffID,
+		e.BarnID,
+		e.FlockID,
+		e.TaskID,
+		e.StartedAt,
+		e.EndedAt,
+		e.StaffID,
+		e.Notes,
+		e.Audit.CreatedAt,
+		e.Audit.UpdatedAt,
+		e.Audit.CreatedBy,
+		e.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *SQLiteLabourRepo) DeleteEntry(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE time_entries SET deleted_at = ? WHERE time_entry_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	publish(ctx, r.Events, "time_entries", id, events.Deleted)
+	return nil
+}
+
+func (r *SQLiteLabourRepo) FlockCosts(ctx context.Context) ([]*domain.FlockCost, float64, error) {
+	// Feed without a cost per kg and slaughter records without a yield add nothing to the costs.
+	const qFlocks = `
+		SELECT f.flock_id, f.breed, f.barn_id, b.name, COALESCE(f.number_of_birds, 0),
+			COALESCE(fd.kg, 0), COALESCE(fd.cost, 0), COALESCE(fd.unpriced_kg, 0), COALESCE(m.kg, 0)
+		FROM flocks f
+		LEFT JOIN barns b ON b.barn_id = f.barn_id
+		LEFT JOIN (
+			SELECT fr.flock_id,
+				SUM(fr.amount_given) AS kg,
+				SUM(fr.amount_given * ft.cost_per_kg) AS cost,
+				SUM(CASE WHEN ft.cost_per_kg IS NULL THEN fr.amount_given ELSE 0 END) AS unpriced_kg
+			FROM feeding_records fr
+			LEFT JOIN feed_types ft ON ft.feed_type_id = fr.feed_type_id
+			WHERE fr.deleted_at IS NULL AND fr.amount_given IS NOT NULL
+			GROUP BY fr.flock_id
+		) fd ON fd.flock_id = f.flock_id
+		LEFT JOIN (
+			SELECT pb.flock_id, SUM(sr.meat_yield) AS kg
+			FROM slaughter_records sr
+			JOIN production_batches pb ON pb.batch_id = sr.batch_id AND pb.deleted_at IS NULL
+			WHERE sr.deleted_at IS NULL
+			GROUP BY pb.flock_id
+		) m ON m.flock_id = f.flock_id
+		WHERE f.farm_id = ? AND f.deleted_at IS NULL
+		ORDER BY f.flock_id DESC`
+	const qEntries = `SELECT ` + timeEntryColumns + ` ` + timeEntryJoins + `
+		WHERE e.farm_id = ? AND e.deleted_at IS NULL AND e.ended_at IS NOT NULL`
+
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qFlocks, FarmFrom(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var costs []*domain.FlockCost
+	for rows.Next() {
+		var c domain.FlockCost
+		err := rows.Scan(
+			&c.FlockID,
+			&c.Breed,
+			&c.BarnID,
+			&c.BarnName,
+			&c.Birds,
+			&c.FeedKg,
+			&c.FeedCost,
+			&c.UnpricedFeedKg,
+			&c.MeatKg,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		costs = append(costs, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	entries, err := listTimeEntries(ctx, conn(ctx, r.DB), qEntries, FarmFrom(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	unallocated := domain.AllocateLabour(costs, entries)
+	return costs, unallocated, nil
+}
+
+func listTimeEntries(ctx context.Context, db queryer, q string, args ...any) ([]*domain.TimeEntry, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.TimeEntry
+	for rows.Next() {
+		var item domain.TimeEntry
+		err := rows.Scan(
+			&item.TimeEntryID,
+			&item.StaffID,
+			&item.BarnID,
+			&item.FlockID,
+			&item.TaskID,
+			&item.StartedAt,
+			&item.EndedAt,
+			&item.HourlyRate,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.StaffName,
+			&item.BarnName,
+			&item.FlockBreed,
+			&item.TaskName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestLabourRepo_ClockAndFlockCosts(t *testing.T) {
+	ctx, db := openTestDB(t)
+	labour := NewSQLiteLabourRepo(db)
+
+	barnID, err := NewSQLiteBarnRepo(db).Create(ctx, &domain.Barn{Name: "North"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	birds := 100
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze", BarnID: &barnID, NumberOfBirds: &birds})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	rate := 18.0
+	staffID, err := NewSQLiteStaffRepo(db).Create(ctx, &domain.Staff{Name: "Ana", HourlyRate: &rate})
+	if err != nil {
+		t.Fatalf("create staff: %v", err)
+	}
+	costPerKg := 0.5
+	feedTypeID, err := NewSQLiteFeedTypeRepo(db).Create(ctx, &domain.FeedType{Name: "Grower", CostPerKg: &costPerKg})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+	kg := 400.0
+	if _, err := NewSQLiteFeedingRecordRepo(db).Create(ctx, &domain.FeedingRecord{FlockID: flockID, FeedTypeID: feedTypeID, AmountGiven: &kg}); err != nil {
+		t.Fatalf("create feeding record: %v", err)
+	}
+	batchID, err := NewSQLiteProductionBatchRepo(db).Create(ctx, &domain.ProductionBatch{FlockID: flockID})
+	if err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	meat := 640.0
+	if _, err := NewSQLiteSlaughterRecordRepo(db).Create(ctx, &domain.SlaughterRecord{BatchID: batchID, MeatYield: &meat}); err != nil {
+		t.Fatalf("create slaughter record: %v", err)
+	}
+
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Second)
+	if _, err := labour.ClockIn(ctx, &domain.TimeEntry{StaffID: staffID, BarnID: barnID, StartedAt: start}); err != nil {
+		t.Fatalf("clock in: %v", err)
+	}
+	if _, err := labour.ClockIn(ctx, &domain.TimeEntry{StaffID: staffID, BarnID: barnID, StartedAt: start}); err != domain.ErrAlreadyClockedIn {
+		t.Errorf("clocking in twice: err = %v, want ErrAlreadyClockedIn", err)
+	}
+	if n, _ := labour.CountClockedIn(ctx); n != 1 {
+		t.Errorf("clocked in = %d, want 1", n)
+	}
+	if err := labour.ClockOut(ctx, staffID, start.Add(-time.Minute)); err != domain.ErrEntryEndsBeforeStart {
+		t.Errorf("clocking out before clocking in: err = %v", err)
+	}
+	if err := labour.ClockOut(ctx, staffID, start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("clock out: %v", err)
+	}
+	if err := labour.ClockOut(ctx, staffID, start.Add(3*time.Hour)); err != ErrNotFound {
+		t.Errorf("clocking out twice: err = %v, want ErrNotFound", err)
+	}
+
+	// A pay rise does not change the cost of time already booked.
+	raised := 30.0
+	if err := NewSQLiteStaffRepo(db).Update(ctx, &domain.Staff{StaffID: staffID, Name: "Ana", HourlyRate: &raised, Audit: domain.AuditFields{Version: 1}}); err != nil {
+		t.Fatalf("update staff: %v", err)
+	}
+	ended := start.Add(2*time.Hour + 30*time.Minute)
+	if _, err := labour.LogEntry(ctx, &domain.TimeEntry{StaffID: staffID, BarnID: barnID, FlockID: &flockID, StartedAt: start.Add(2 * time.Hour), EndedAt: &ended}); err != nil {
+		t.Fatalf("log entry: %v", err)
+	}
+
+	entries, err := labour.ListEntries(ctx, start.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	if len(entries) != 2 || entries[1].StaffName != "Ana" || entries[1].BarnName != "North" || *entries[1].HourlyRate != 18 {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	costs, unallocated, err := labour.FlockCosts(ctx)
+	if err != nil {
+		t.Fatalf("flock costs: %v", err)
+	}
+	if len(costs) != 1 || unallocated != 0 {
+		t.Fatalf("costs = %+v, unallocated = %v", costs, unallocated)
+	}
+	c := costs[0]
+	// 2 barn hours at 18 and half an hour at 30, plus 400 kg of feed at 0.50.
+	if c.LabourHours != 2.5 || c.LabourCost != 51 || c.FeedKg != 400 || c.FeedCost != 200 || c.MeatKg != 640 {
+		t.Errorf("flock cost = %+v", c)
+	}
+	if perKg, ok := c.CostPerKg(); !ok || math.Abs(perKg-251.0/640) > 1e-9 {
+		t.Errorf("cost per kg = %v", perKg)
+	}
+}
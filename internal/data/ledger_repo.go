@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// LedgerRepo defines operations for the flock cost ledger and the revenue traced to flocks.
+type LedgerRepo interface {
+	Count(ctx context.Context) (int64, error)
+	// ListEntries returns the cost ledger, newest first.
+	ListEntries(ctx context.Context) ([]*domain.CostEntry, error)
+	CreateEntry(ctx context.Context, e *domain.CostEntry) (int64, error)
+	DeleteEntry(ctx context.Context, id int64, deletedAt time.Time) error
+	// FlockRevenue returns the net revenue per flock of the orders that are not drafts,
+	// cancelled or returned. An order line counts for the flocks of the lots its stock was
+	// reserved from, in proportion to the quantity; a line without reservations counts for the
+	// slaughter it was traced to.
+	FlockRevenue(ctx context.Context) (map[int64]float64, error)
+}
+
+type SQLiteLedgerRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteLedgerRepo(db *sql.DB) *SQLiteLedgerRepo {
+	return &SQLiteLedgerRepo{DB: db}
+}
+
+func (r *SQLiteLedgerRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM cost_entries WHERE farm_id = ? AND deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *SQLiteLedgerRepo) ListEntries(ctx context.Context) ([]*domain.CostEntry, error) {
+	const q = `
+		SELECT c.cost_entry_id, c.category, c.flock_id, c.barn_id, c.entry_date, c.amount, c.description,
+			c.created_at, c.updated_at, c.deleted_at, c.created_by, c.updated_by, f.breed, b.name
+		FROM cost_entries c
+		LEFT JOIN flocks f ON f.flock_id = c.flock_id
+		LEFT JOIN barns b ON b.barn_id = c.barn_id
+		WHERE c.farm_id = ? AND c.deleted_at IS NULL
+		ORDER BY c.entry_date DESC, c.cost_entry_id DESC`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.CostEntry
+	for rows.Next() {
+		var item domain.CostEntry
+		err := rows.Scan(
+			&item.CostEntryID,
+			&item.Category,
+			&item.FlockID,
+			&item.BarnID,
+			&item.EntryDate,
+			&item.Amount,
+			&item.Description,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.FlockBreed,
+			&item.BarnName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteLedgerRepo) CreateEntry(ctx context.Context, e *domain.CostEntry) (int64, error) {
+	const q = `INSERT INTO cost_entries (farm_id, category, flock_id, barn_id, entry_date, amount, description, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	e.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &e.Audit)
+
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
+		e.Category,
+		e.FlockID,
+		e.BarnID,
+		e.EntryDate,
+		e.Amount,
+		e.Description,
+		e.Audit.CreatedAt,
+		e.Audit.UpdatedAt,
+		e.Audit.CreatedBy,
+		e.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "cost_entries", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteLedgerRepo) DeleteEntry(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE cost_entries SET deleted_at = ? WHERE cost_entry_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	publish(ctx, r.Events, "cost_entries", id, events.Deleted)
+	return nil
+}
+
+func (r *SQLiteLedgerRepo) FlockRevenue(ctx context.Context) (map[int64]float64, error) {
+	const q = `
+		SELECT flock_id, SUM(amount) FROM (
+			SELECT pb.flock_id, COALESCE(oi.total_price, 0) * sr.quantity / oi.quantity AS amount
+			FROM stock_reservations sr
+			JOIN order_items oi ON oi.order_item_id = sr.order_item_id AND oi.deleted_at IS NULL AND oi.quantity > 0
+			JOIN orders o ON o.order_id = oi.order_id AND o.deleted_at IS NULL
+			JOIN product_lots l ON l.product_lot_id = sr.product_lot_id
+			JOIN slaughter_records s ON s.slaughter_id = l.slaughter_id
+			JOIN production_batches pb ON pb.batch_id = s.batch_id
+			WHERE o.farm_id = ? AND o.status NOT IN ('draft', 'cancelled', 'returned')
+			UNION ALL
+			SELECT pb.flock_id, COALESCE(oi.total_price, 0)
+			FROM order_items oi
+			JOIN orders o ON o.order_id = oi.order_id AND o.deleted_at IS NULL
+			JOIN slaughter_records s ON s.slaughter_id = oi.slaughter_id
+			JOIN production_batches pb ON pb.batch_id = s.batch_id
+			WHERE o.farm_id = ? AND oi.deleted_at IS NULL AND o.status NOT IN ('draft', 'cancelled', 'returned')
+				AND NOT EXISTS (SELECT 1 FROM stock_reservations sr WHERE sr.order_item_id = oi.order_item_id)
+		)
+		WHERE flock_id IS NOT NULL
+		GROUP BY flock_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revenue := map[int64]float64{}
+	for rows.Next() {
+		var flockID int64
+		var amount float64
+		if err := rows.Scan(&flockID, &amount); err != nil {
+			return nil, err
+		}
+		revenue[flockID] = amount
+	}
+	return revenue, rows.Err()
+}
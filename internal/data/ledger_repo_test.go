@@ -0,0 +1,111 @@
+package data
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestLedgerRepo_EntriesAndFlockRevenue(t *testing.T) {
+	ctx, db := openTestDB(t)
+	ledger := NewSQLiteLedgerRepo(db)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+	lots := NewSQLiteProductLotRepo(db)
+
+	flocks := NewSQLiteFlockRepo(db)
+	flockA, err := flocks.Create(ctx, &domain.Flock{Breed: "Bronze"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	flockB, err := flocks.Create(ctx, &domain.Flock{Breed: "Norfolk Black"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (1, ?), (2, ?)`, []any{flockA, flockB}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (11, 1, CURRENT_DATE), (12, 2, CURRENT_DATE)`, nil},
+		{`INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher')`, nil},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "WB", Name: "Whole bird", Unit: "kg", Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	now := time.Now()
+	if _, err := lots.Create(ctx, &domain.ProductLot{SlaughterID: 11, ProductID: productID, WeightKg: 6, PackingDate: now}); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+	// 10 kg at 12: 6 kg reserved from flock A's lot, the other 4 from flock B's lot made later.
+	orderID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, ProductID: &productID, Quantity: f(10), UnitPrice: f(12)}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusConfirmed, nil); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if _, err := lots.Create(ctx, &domain.ProductLot{SlaughterID: 12, ProductID: productID, WeightKg: 5, PackingDate: now}); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+
+	// A line traced to a slaughter without reservations counts whole; a draft order does not count.
+	slaughterB, giblets := int64(12), "Giblets"
+	tracedID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: tracedID, ProductDescription: &giblets, Quantity: f(2), UnitPrice: f(5), SlaughterID: &slaughterB}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	if err := orders.TransitionStatus(ctx, tracedID, domain.OrderStatusConfirmed, nil); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	draftID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: draftID, ProductDescription: &giblets, Quantity: f(1), UnitPrice: f(5), SlaughterID: &slaughterB}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+
+	revenue, err := ledger.FlockRevenue(ctx)
+	if err != nil {
+		t.Fatalf("flock revenue: %v", err)
+	}
+	if math.Abs(revenue[flockA]-72) > 1e-9 || math.Abs(revenue[flockB]-58) > 1e-9 {
+		t.Errorf("revenue = %v, want 72 for flock A and 48 + 10 for flock B", revenue)
+	}
+
+	if _, err := ledger.CreateEntry(ctx, &domain.CostEntry{Category: domain.CostChicks, FlockID: &flockA, EntryDate: now, Amount: 900}); err != nil {
+		t.Fatalf("create entry: %v", err)
+	}
+	if _, err := ledger.CreateEntry(ctx, &domain.CostEntry{Category: domain.CostEnergy, EntryDate: now, Amount: 50}); err == nil {
+		t.Error("expected an entry without flock or barn to be refused")
+	}
+	entries, err := ledger.ListEntries(ctx)
+	if err != nil {
+		t.Fatalf("list entries: %v", err)
+	}
+	if len(entries) != 1 || entries[0].FlockBreed == nil || *entries[0].FlockBreed != "Bronze" {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if err := ledger.DeleteEntry(ctx, entries[0].CostEntryID, now); err != nil {
+		t.Fatalf("delete entry: %v", err)
+	}
+	if err := ledger.DeleteEntry(ctx, entries[0].CostEntryID, now); err != ErrNotFound {
+		t.Errorf("deleting twice: err = %v, want ErrNotFound", err)
+	}
+}
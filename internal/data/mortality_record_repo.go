@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // MortalityRecordRepo defines operations for mortalityrecord management.
@@ -19,7 +20,8 @@ type MortalityRecordRepo interface {
 }
 
 type SQLiteMortalityRecordRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteMortalityRecordRepo(db *sql.DB) *SQLiteMortalityRecordRepo {
@@ -27,17 +29,17 @@ func NewSQLiteMortalityRecordRepo(db *sql.DB) *SQLiteMortalityRecordRepo {
 }
 
 func (r *SQLiteMortalityRecordRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM mortality_records WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM mortality_records WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteMortalityRecordRepo) List(ctx context.Context) ([]*domain.MortalityRecord, error) {
-	const q = `SELECT mortality_record_id, flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM mortality_records WHERE deleted_at IS NULL ORDER BY mortality_record_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT mortality_record_id, flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM mortality_records WHERE farm_id = ? AND deleted_at IS NULL ORDER BY mortality_record_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +70,9 @@ func (r *SQLiteMortalityRecordRepo) List(ctx context.Context) ([]*domain.Mortali
 }
 
 func (r *SQLiteMortalityRecordRepo) FindByID(ctx context.Context, id int64) (*domain.MortalityRecord, error) {
-	const q = `SELECT mortality_record_id, flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM mortality_records WHERE mortality_record_id = ? AND deleted_at IS NULL`
+	const q = `SELECT mortality_record_id, flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, deleted_at, created_by, updated_by, version FROM mortality_records WHERE mortality_record_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.MortalityRecord
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.MortalityRecordID,
 		&item.FlockID,
 		&item.Date,
@@ -82,6 +84,7 @@ func (r *SQLiteMortalityRecordRepo) FindByID(ctx context.Context, id int64) (*do
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -90,12 +93,19 @@ func (r *SQLiteMortalityRecordRepo) FindByID(ctx context.Context, id int64) (*do
 }
 
 func (r *SQLiteMortalityRecordRepo) Create(ctx context.Context, m *domain.MortalityRecord) (int64, error) {
-	const q = `INSERT INTO mortality_records (flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO mortality_records (farm_id, flock_id, date, number_dead, cause_of_death, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	m.Audit.CreatedAt = now
 	m.Audit.UpdatedAt = now
+	stampActor(ctx, &m.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &m.FlockID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		m.FlockID,
 		m.Date,
 		m.NumberDead,
@@ -109,14 +119,25 @@ func (r *SQLiteMortalityRecordRepo) Create(ctx context.Context, m *domain.Mortal
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "mortality_records", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteMortalityRecordRepo) Update(ctx context.Context, m *domain.MortalityRecord) error {
-	const q = `UPDATE mortality_records SET flock_id = ?, date = ?, number_dead = ?, cause_of_death = ?, notes = ?, updated_at = ?, updated_by = ? WHERE mortality_record_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE mortality_records SET flock_id = ?, date = ?, number_dead = ?, cause_of_death = ?, notes = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE mortality_record_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	m.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &m.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &m.FlockID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		m.FlockID,
 		m.Date,
 		m.NumberDead,
@@ -125,12 +146,22 @@ func (r *SQLiteMortalityRecordRepo) Update(ctx context.Context, m *domain.Mortal
 		m.Audit.UpdatedAt,
 		m.Audit.UpdatedBy,
 		m.MortalityRecordID,
-	)
-	return err
+		FarmFrom(ctx),
+		m.Audit.Version,
+	).Scan(&m.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "mortality_records", "mortality_record_id", m.MortalityRecordID)
+	}
+	publish(ctx, r.Events, "mortality_records", m.MortalityRecordID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteMortalityRecordRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE mortality_records SET deleted_at = ? WHERE mortality_record_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE mortality_records SET deleted_at = ? WHERE mortality_record_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "mortality_records", id, events.Deleted)
+	return nil
 }
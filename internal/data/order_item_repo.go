@@ -3,15 +3,21 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
-// OrderItemRepo defines operations for orderitem management.
+// OrderItemRepo defines operations for order lines.
+// Every write derives the line total and re-derives the order totals in the same transaction,
+// and is refused with domain.ErrOrderLinesLocked once the order is past draft.
 type OrderItemRepo interface {
 	Count(ctx context.Context) (int64, error)
 	List(ctx context.Context) ([]*domain.OrderItem, error)
+	// ListByOrder returns the non-deleted lines of an order with their products.
+	ListByOrder(ctx context.Context, orderID int64) ([]*domain.OrderItem, error)
 	FindByID(ctx context.Context, id int64) (*domain.OrderItem, error)
 	Create(ctx context.Context, o *domain.OrderItem) (int64, error)
 	Update(ctx context.Context, o *domain.OrderItem) error
@@ -19,7 +25,8 @@ type OrderItemRepo interface {
 }
 
 type SQLiteOrderItemRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteOrderItemRepo(db *sql.DB) *SQLiteOrderItemRepo {
@@ -27,17 +34,17 @@ func NewSQLiteOrderItemRepo(db *sql.DB) *SQLiteOrderItemRepo {
 }
 
 func (r *SQLiteOrderItemRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM order_items WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM order_items WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteOrderItemRepo) List(ctx context.Context) ([]*domain.OrderItem, error) {
-	const q = `SELECT order_item_id, order_id, product_description, quantity, unit_price, total_price, created_at, updated_at, deleted_at, created_by, updated_by FROM order_items WHERE deleted_at IS NULL ORDER BY order_item_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT order_item_id, order_id, product_id, product_description, quantity, unit_price, discount, vat_rate, total_price, slaughter_id, created_at, updated_at, deleted_at, created_by, updated_by FROM order_items WHERE farm_id = ? AND deleted_at IS NULL ORDER BY order_item_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -49,10 +56,14 @@ func (r *SQLiteOrderItemRepo) List(ctx context.Context) ([]*domain.OrderItem, er
 		err := rows.Scan(
 			&item.OrderItemID,
 			&item.OrderID,
+			&item.ProductID,
 			&item.ProductDescription,
 			&item.Quantity,
 			&item.UnitPrice,
+			&item.Discount,
+			&item.VATRate,
 			&item.TotalPrice,
+			&item.SlaughterID,
 			&item.Audit.CreatedAt,
 			&item.Audit.UpdatedAt,
 			&item.Audit.DeletedAt,
@@ -67,21 +78,78 @@ func (r *SQLiteOrderItemRepo) List(ctx context.Context) ([]*domain.OrderItem, er
 	return items, rows.Err()
 }
 
+func (r *SQLiteOrderItemRepo) ListByOrder(ctx context.Context, orderID int64) ([]*domain.OrderItem, error) {
+	const q = `SELECT oi.order_item_id, oi.order_id, oi.product_id, oi.product_description, oi.quantity, oi.unit_price, oi.discount, oi.vat_rate, oi.total_price, oi.slaughter_id,
+		oi.created_at, oi.updated_at, oi.deleted_at, oi.created_by, oi.updated_by, oi.version,
+		p.sku, p.name, p.unit,
+		COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.order_item_id = oi.order_item_id), 0)
+		FROM order_items oi
+		LEFT JOIN products p ON p.product_id = oi.product_id
+		WHERE oi.order_id = ? AND oi.farm_id = ? AND oi.deleted_at IS NULL
+		ORDER BY oi.order_item_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, orderID, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.OrderItem
+	for rows.Next() {
+		var item domain.OrderItem
+		var sku, name, unit sql.NullString
+		err := rows.Scan(
+			&item.OrderItemID,
+			&item.OrderID,
+			&item.ProductID,
+			&item.ProductDescription,
+			&item.Quantity,
+			&item.UnitPrice,
+			&item.Discount,
+			&item.VATRate,
+			&item.TotalPrice,
+			&item.SlaughterID,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.Audit.Version,
+			&sku,
+			&name,
+			&unit,
+			&item.Reserved,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if item.ProductID != nil && sku.Valid {
+			item.Product = &domain.Product{ProductID: *item.ProductID, SKU: sku.String, Name: name.String, Unit: unit.String}
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
 func (r *SQLiteOrderItemRepo) FindByID(ctx context.Context, id int64) (*domain.OrderItem, error) {
-	const q = `SELECT order_item_id, order_id, product_description, quantity, unit_price, total_price, created_at, updated_at, deleted_at, created_by, updated_by FROM order_items WHERE order_item_id = ? AND deleted_at IS NULL`
+	const q = `SELECT order_item_id, order_id, product_id, product_description, quantity, unit_price, discount, vat_rate, total_price, slaughter_id, created_at, updated_at, deleted_at, created_by, updated_by, version FROM order_items WHERE order_item_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.OrderItem
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.OrderItemID,
 		&item.OrderID,
+		&item.ProductID,
 		&item.ProductDescription,
 		&item.Quantity,
 		&item.UnitPrice,
+		&item.Discount,
+		&item.VATRate,
 		&item.TotalPrice,
+		&item.SlaughterID,
 		&item.Audit.CreatedAt,
 		&item.Audit.UpdatedAt,
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -90,47 +158,149 @@ func (r *SQLiteOrderItemRepo) FindByID(ctx context.Context, id int64) (*domain.O
 }
 
 func (r *SQLiteOrderItemRepo) Create(ctx context.Context, o *domain.OrderItem) (int64, error) {
-	const q = `INSERT INTO order_items (order_id, product_description, quantity, unit_price, total_price, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO order_items (farm_id, order_id, product_id, product_description, quantity, unit_price, discount, vat_rate, total_price, slaughter_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	o.Audit.CreatedAt = now
 	o.Audit.UpdatedAt = now
+	stampActor(ctx, &o.Audit)
+	total := o.LineTotal()
+	o.TotalPrice = &total
 
-	result, err := r.DB.ExecContext(ctx, q,
-		o.OrderID,
-		o.ProductDescription,
-		o.Quantity,
-		o.UnitPrice,
-		o.TotalPrice,
-		o.Audit.CreatedAt,
-		o.Audit.UpdatedAt,
-		o.Audit.CreatedBy,
-		o.Audit.UpdatedBy,
-	)
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := requireDraftOrder(ctx, tx, o.OrderID); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q,
+			FarmFrom(ctx),
+			o.OrderID,
+			o.ProductID,
+			o.ProductDescription,
+			o.Quantity,
+			o.UnitPrice,
+			o.Discount,
+			o.VATRate,
+			o.TotalPrice,
+			o.SlaughterID,
+			o.Audit.CreatedAt,
+			o.Audit.UpdatedAt,
+			o.Audit.CreatedBy,
+			o.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if id, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		return recalculateOrderTotals(ctx, tx, o.OrderID)
+	})
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	r.publish(ctx, id, o.OrderID, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteOrderItemRepo) Update(ctx context.Context, o *domain.OrderItem) error {
-	const q = `UPDATE order_items SET order_id = ?, product_description = ?, quantity = ?, unit_price = ?, total_price = ?, updated_at = ?, updated_by = ? WHERE order_item_id = ? AND deleted_at IS NULL`
+	const qOrder = `SELECT order_id FROM order_items WHERE order_item_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE order_items SET order_id = ?, product_id = ?, product_description = ?, quantity = ?, unit_price = ?, discount = ?, vat_rate = ?, total_price = ?, slaughter_id = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE order_item_id = ? AND deleted_at IS NULL` + versionCheck
 	o.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &o.Audit)
+	total := o.LineTotal()
+	o.TotalPrice = &total
 
-	_, err := r.DB.ExecContext(ctx, q,
-		o.OrderID,
-		o.ProductDescription,
-		o.Quantity,
-		o.UnitPrice,
-		o.TotalPrice,
-		o.Audit.UpdatedAt,
-		o.Audit.UpdatedBy,
-		o.OrderItemID,
-	)
-	return err
+	var previousOrderID int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, qOrder, o.OrderItemID, FarmFrom(ctx)).Scan(&previousOrderID); err != nil {
+			return err
+		}
+		if err := requireDraftOrder(ctx, tx, previousOrderID); err != nil {
+			return err
+		}
+		if err := requireDraftOrder(ctx, tx, o.OrderID); err != nil {
+			return err
+		}
+		err := tx.QueryRowContext(ctx, q,
+			o.OrderID,
+			o.ProductID,
+			o.ProductDescription,
+			o.Quantity,
+			o.UnitPrice,
+			o.Discount,
+			o.VATRate,
+			o.TotalPrice,
+			o.SlaughterID,
+			o.Audit.UpdatedAt,
+			o.Audit.UpdatedBy,
+			o.OrderItemID,
+			o.Audit.Version,
+		).Scan(&o.Audit.Version)
+		if err != nil {
+			return versionError(ctx, tx, err, "order_items", "order_item_id", o.OrderItemID)
+		}
+		// A line moved to another order changes the totals of both.
+		if previousOrderID != o.OrderID {
+			if err := recalculateOrderTotals(ctx, tx, previousOrderID); err != nil {
+				return err
+			}
+		}
+		return recalculateOrderTotals(ctx, tx, o.OrderID)
+	})
+	if err != nil {
+		return err
+	}
+	if previousOrderID != o.OrderID {
+		publish(ctx, r.Events, "orders", previousOrderID, events.Updated)
+	}
+	r.publish(ctx, o.OrderItemID, o.OrderID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteOrderItemRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const qOrder = `SELECT order_id FROM order_items WHERE order_item_id = ? AND farm_id = ?`
 	const q = `UPDATE order_items SET deleted_at = ? WHERE order_item_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+
+	var orderID int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, qOrder, id, FarmFrom(ctx)).Scan(&orderID); err != nil {
+			return err
+		}
+		if err := requireDraftOrder(ctx, tx, orderID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, q, deletedAt, id); err != nil {
+			return err
+		}
+		return recalculateOrderTotals(ctx, tx, orderID)
+	})
+	if err != nil {
+		return err
+	}
+	r.publish(ctx, id, orderID, events.Deleted)
+	return nil
+}
+
+// requireDraftOrder returns ErrOrderLinesLocked unless the order of the context's farm is still
+// a draft. It runs in the transaction of the line write, so the check and the write cannot be
+// split by a confirm.
+func requireDraftOrder(ctx context.Context, q queryer, orderID int64) error {
+	const qStatus = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	var status domain.OrderStatus
+	if err := q.QueryRowContext(ctx, qStatus, orderID, FarmFrom(ctx)).Scan(&status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if !status.LinesEditable() {
+		return domain.ErrOrderLinesLocked
+	}
+	return nil
+}
+
+// publish announces a line change together with the change of its order's totals.
+func (r *SQLiteOrderItemRepo) publish(ctx context.Context, id, orderID int64, action events.Action) {
+	publish(ctx, r.Events, "order_items", id, action)
+	publish(ctx, r.Events, "orders", orderID, events.Updated)
 }
@@ -0,0 +1,148 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestOrderItemRepo_DerivesOrderTotals(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, &domain.Customer{Name: "Butcher"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	orderID, err := orders.Create(ctx, &domain.Order{CustomerID: customerID, DeliveryFee: 5})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	otherID, err := orders.Create(ctx, &domain.Order{CustomerID: customerID})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	wantTotals := func(id int64, subtotal, vat, total float64) {
+		t.Helper()
+		order, err := orders.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("find order: %v", err)
+		}
+		if order.SubtotalAmount != subtotal || order.VATAmount != vat || order.TotalAmount == nil || *order.TotalAmount != total {
+			t.Fatalf("order %d totals = %v/%v/%v, want %v/%v/%v", id, order.SubtotalAmount, order.VATAmount, order.TotalAmount, subtotal, vat, total)
+		}
+	}
+	wantTotals(orderID, 0, 0, 5)
+
+	// 2 × 12.50 less 1.00 = 24.00 at 9% VAT; 3 × 4.00 = 12.00 without VAT.
+	turkey := &domain.OrderItem{OrderID: orderID, Quantity: f(2), UnitPrice: f(12.5), Discount: 1, VATRate: 9}
+	turkeyID, err := lines.Create(ctx, turkey)
+	if err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	eggsID, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, Quantity: f(3), UnitPrice: f(4), TotalPrice: f(999)})
+	if err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	wantTotals(orderID, 36, 2.16, 43.16)
+
+	eggs, err := lines.FindByID(ctx, eggsID)
+	if err != nil {
+		t.Fatalf("find line: %v", err)
+	}
+	if *eggs.TotalPrice != 12 {
+		t.Errorf("client total_price kept: got %v, want 12", *eggs.TotalPrice)
+	}
+
+	// Moving a line re-derives both orders.
+	eggs.OrderID = otherID
+	if err := lines.Update(ctx, eggs); err != nil {
+		t.Fatalf("update line: %v", err)
+	}
+	wantTotals(orderID, 24, 2.16, 31.16)
+	wantTotals(otherID, 12, 0, 12)
+
+	if err := lines.SoftDelete(ctx, turkeyID, time.Now()); err != nil {
+		t.Fatalf("delete line: %v", err)
+	}
+	wantTotals(orderID, 0, 0, 5)
+
+	// Changing the delivery fee on the header re-derives the total.
+	order, err := orders.FindByID(ctx, otherID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	order.DeliveryFee = 7.5
+	if err := orders.Update(ctx, order); err != nil {
+		t.Fatalf("update order: %v", err)
+	}
+	wantTotals(otherID, 12, 0, 19.5)
+}
+
+func TestOrderItemRepo_LocksConfirmedOrders(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, &domain.Customer{Name: "Butcher"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	orderID, err := orders.Create(ctx, &domain.Order{CustomerID: customerID, DeliveryFee: 5})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	f := func(v float64) *float64 { return &v }
+	lineID, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, Quantity: f(2), UnitPrice: f(10)})
+	if err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	draft, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusConfirmed, nil); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	// A form loaded while the order was a draft is stale once it is confirmed.
+	stale := *draft
+	delivery := time.Now().AddDate(0, 0, 3)
+	stale.DeliveryDate = &delivery
+	if err := orders.Update(ctx, &stale); !errors.Is(err, ErrConflict) {
+		t.Fatalf("update from before the confirm: err = %v, want ErrConflict", err)
+	}
+	current, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	current.DeliveryFee = 0
+	if err := orders.Update(ctx, current); !errors.Is(err, domain.ErrOrderHeaderLocked) {
+		t.Fatalf("change the fee of a confirmed order: err = %v, want ErrOrderHeaderLocked", err)
+	}
+	current.DeliveryFee = 5
+	current.DeliveryDate = &delivery
+	if err := orders.Update(ctx, current); err != nil {
+		t.Fatalf("move the delivery date of a confirmed order: %v", err)
+	}
+
+	if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, Quantity: f(1), UnitPrice: f(3)}); !errors.Is(err, domain.ErrOrderLinesLocked) {
+		t.Fatalf("add a line to a confirmed order: err = %v, want ErrOrderLinesLocked", err)
+	}
+	line, err := lines.FindByID(ctx, lineID)
+	if err != nil {
+		t.Fatalf("find line: %v", err)
+	}
+	line.Quantity = f(5)
+	if err := lines.Update(ctx, line); !errors.Is(err, domain.ErrOrderLinesLocked) {
+		t.Fatalf("change a line of a confirmed order: err = %v, want ErrOrderLinesLocked", err)
+	}
+	if err := lines.SoftDelete(ctx, lineID, time.Now()); !errors.Is(err, domain.ErrOrderLinesLocked) {
+		t.Fatalf("delete a line of a confirmed order: err = %v, want ErrOrderLinesLocked", err)
+	}
+}
@@ -3,23 +3,42 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // OrderRepo defines operations for order management.
+// Order amounts are derived from the order lines and never written directly.
 type OrderRepo interface {
 	Count(ctx context.Context) (int64, error)
 	List(ctx context.Context) ([]*domain.Order, error)
+	// ListByCustomer returns the orders of one customer, newest first.
+	ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Order, error)
 	FindByID(ctx context.Context, id int64) (*domain.Order, error)
 	Create(ctx context.Context, o *domain.Order) (int64, error)
+	// Place inserts a draft order together with its lines, so a customer's order is never
+	// seen half-entered.
+	Place(ctx context.Context, o *domain.Order, lines []*domain.OrderItem) (int64, error)
+	// Update modifies the order header and re-derives its totals. The status is left alone. Past
+	// draft only the delivery date may change: another customer, order date or delivery fee is
+	// refused with domain.ErrOrderHeaderLocked.
 	Update(ctx context.Context, o *domain.Order) error
 	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+	// TransitionFacts returns the facts the status transition guards look at.
+	TransitionFacts(ctx context.Context, orderID int64) (domain.OrderTransitionFacts, error)
+	// TransitionStatus moves an order to a new status and records the transition. Refused
+	// transitions return a *domain.OrderTransitionError.
+	TransitionStatus(ctx context.Context, orderID int64, to domain.OrderStatus, note *string) error
+	// ListTransitions returns the status history of an order, oldest first.
+	ListTransitions(ctx context.Context, orderID int64) ([]*domain.OrderStatusTransition, error)
 }
 
 type SQLiteOrderRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteOrderRepo(db *sql.DB) *SQLiteOrderRepo {
@@ -27,17 +46,27 @@ func NewSQLiteOrderRepo(db *sql.DB) *SQLiteOrderRepo {
 }
 
 func (r *SQLiteOrderRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM orders WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM orders WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
+// orderColumns are the order fields read by scanOrder.
+const orderColumns = `order_id, customer_id, order_date, delivery_date, subtotal_amount, vat_amount, delivery_fee, total_amount, COALESCE(status, 'draft'), source, created_at, updated_at, deleted_at, created_by, updated_by, version`
+
 func (r *SQLiteOrderRepo) List(ctx context.Context) ([]*domain.Order, error) {
-	const q = `SELECT order_id, customer_id, order_date, delivery_date, total_amount, status, created_at, updated_at, deleted_at, created_by, updated_by FROM orders WHERE deleted_at IS NULL ORDER BY order_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	return r.list(ctx, `SELECT `+orderColumns+` FROM orders WHERE farm_id = ? AND deleted_at IS NULL ORDER BY order_id`, FarmFrom(ctx))
+}
+
+func (r *SQLiteOrderRepo) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Order, error) {
+	return r.list(ctx, `SELECT `+orderColumns+` FROM orders WHERE customer_id = ? AND farm_id = ? AND deleted_at IS NULL ORDER BY order_id DESC`, customerID, FarmFrom(ctx))
+}
+
+func (r *SQLiteOrderRepo) list(ctx context.Context, q string, args ...any) ([]*domain.Order, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -45,43 +74,39 @@ func (r *SQLiteOrderRepo) List(ctx context.Context) ([]*domain.Order, error) {
 
 	var items []*domain.Order
 	for rows.Next() {
-		var item domain.Order
-		err := rows.Scan(
-			&item.OrderID,
-			&item.CustomerID,
-			&item.OrderDate,
-			&item.DeliveryDate,
-			&item.TotalAmount,
-			&item.Status,
-			&item.Audit.CreatedAt,
-			&item.Audit.UpdatedAt,
-			&item.Audit.DeletedAt,
-			&item.Audit.CreatedBy,
-			&item.Audit.UpdatedBy,
-		)
+		item, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
-		items = append(items, &item)
+		items = append(items, item)
 	}
 	return items, rows.Err()
 }
 
 func (r *SQLiteOrderRepo) FindByID(ctx context.Context, id int64) (*domain.Order, error) {
-	const q = `SELECT order_id, customer_id, order_date, delivery_date, total_amount, status, created_at, updated_at, deleted_at, created_by, updated_by FROM orders WHERE order_id = ? AND deleted_at IS NULL`
+	return scanOrder(conn(ctx, r.DB).QueryRowContext(ctx, `SELECT `+orderColumns+` FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`, id, FarmFrom(ctx)))
+}
+
+// scanOrder reads one row of orderColumns.
+func scanOrder(row interface{ Scan(...any) error }) (*domain.Order, error) {
 	var item domain.Order
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := row.Scan(
 		&item.OrderID,
 		&item.CustomerID,
 		&item.OrderDate,
 		&item.DeliveryDate,
+		&item.SubtotalAmount,
+		&item.VATAmount,
+		&item.DeliveryFee,
 		&item.TotalAmount,
 		&item.Status,
+		&item.Source,
 		&item.Audit.CreatedAt,
 		&item.Audit.UpdatedAt,
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -90,17 +115,89 @@ func (r *SQLiteOrderRepo) FindByID(ctx context.Context, id int64) (*domain.Order
 }
 
 func (r *SQLiteOrderRepo) Create(ctx context.Context, o *domain.Order) (int64, error) {
-	const q = `INSERT INTO orders (customer_id, order_date, delivery_date, total_amount, status, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	id, err := insertOrder(ctx, conn(ctx, r.DB), o)
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "orders", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteOrderRepo) Place(ctx context.Context, o *domain.Order, lines []*domain.OrderItem) (int64, error) {
+	const qLine = `INSERT INTO order_items (farm_id, order_id, product_id, product_description, quantity, unit_price, discount, vat_rate, total_price, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var err error
+		if id, err = insertOrder(ctx, tx, o); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			line.OrderID = id
+			line.Audit.CreatedAt, line.Audit.UpdatedAt = o.Audit.CreatedAt, o.Audit.CreatedAt
+			line.Audit.CreatedBy, line.Audit.UpdatedBy = o.Audit.CreatedBy, o.Audit.CreatedBy
+			total := line.LineTotal()
+			line.TotalPrice = &total
+			_, err := tx.ExecContext(ctx, qLine,
+				FarmFrom(ctx),
+				line.OrderID,
+				line.ProductID,
+				line.ProductDescription,
+				line.Quantity,
+				line.UnitPrice,
+				line.Discount,
+				line.VATRate,
+				line.TotalPrice,
+				line.Audit.CreatedAt,
+				line.Audit.UpdatedAt,
+				line.Audit.CreatedBy,
+				line.Audit.UpdatedBy,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return recalculateOrderTotals(ctx, tx, id)
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "orders", id, events.Created)
+	return id, nil
+}
+
+// insertOrder inserts an order header; its totals start at the delivery fee alone.
+func insertOrder(ctx context.Context, db dbConn, o *domain.Order) (int64, error) {
+	const q = `INSERT INTO orders (farm_id, customer_id, order_date, delivery_date, subtotal_amount, vat_amount, delivery_fee, total_amount, status, source, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	o.Audit.CreatedAt = now
 	o.Audit.UpdatedAt = now
+	stampActor(ctx, &o.Audit)
+	if o.Status == "" {
+		o.Status = domain.OrderStatusDraft
+	}
+	if o.Source == "" {
+		o.Source = domain.OrderSourceStaff
+	}
+	if err := onFarm(ctx, db, "customers", "customer_id", o.CustomerID); err != nil {
+		return 0, err
+	}
+
+	// A new order has no lines yet, so its total is the delivery fee alone.
+	totals := domain.ComputeOrderTotals(nil, o.DeliveryFee)
+	o.SubtotalAmount, o.VATAmount, o.TotalAmount = totals.Subtotal, totals.VAT, &totals.Total
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := db.ExecContext(ctx, q,
+		FarmFrom(ctx),
 		o.CustomerID,
 		o.OrderDate,
 		o.DeliveryDate,
+		o.SubtotalAmount,
+		o.VATAmount,
+		o.DeliveryFee,
 		o.TotalAmount,
 		o.Status,
+		o.Source,
 		o.Audit.CreatedAt,
 		o.Audit.UpdatedAt,
 		o.Audit.CreatedBy,
@@ -113,25 +210,229 @@ func (r *SQLiteOrderRepo) Create(ctx context.Context, o *domain.Order) (int64, e
 }
 
 func (r *SQLiteOrderRepo) Update(ctx context.Context, o *domain.Order) error {
-	const q = `UPDATE orders SET customer_id = ?, order_date = ?, delivery_date = ?, total_amount = ?, status = ?, updated_at = ?, updated_by = ? WHERE order_id = ? AND deleted_at IS NULL`
+	const qCurrent = `SELECT COALESCE(status, 'draft'), customer_id, order_date, delivery_fee FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE orders SET customer_id = ?, order_date = ?, delivery_date = ?, delivery_fee = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	o.Audit.UpdatedAt = now
+	stampActor(ctx, &o.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
-		o.CustomerID,
-		o.OrderDate,
-		o.DeliveryDate,
-		o.TotalAmount,
-		o.Status,
-		now,
-		o.Audit.UpdatedBy,
-		o.OrderID,
-	)
-	return err
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "customers", "customer_id", o.CustomerID); err != nil {
+			return err
+		}
+		// The status is read in the same transaction as the write, so a confirm landing in
+		// between cannot let the header of a confirmed order change.
+		var current domain.Order
+		if err := tx.QueryRowContext(ctx, qCurrent, o.OrderID, FarmFrom(ctx)).Scan(&current.Status, &current.CustomerID, &current.OrderDate, &current.DeliveryFee); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if !current.Status.LinesEditable() && current.HeaderChanged(o) {
+			return domain.ErrOrderHeaderLocked
+		}
+		err := tx.QueryRowContext(ctx, q,
+			o.CustomerID,
+			o.OrderDate,
+			o.DeliveryDate,
+			o.DeliveryFee,
+			now,
+			o.Audit.UpdatedBy,
+			o.OrderID,
+			FarmFrom(ctx),
+			o.Audit.Version,
+		).Scan(&o.Audit.Version)
+		if err != nil {
+			return versionError(ctx, tx, err, "orders", "order_id", o.OrderID)
+		}
+		return recalculateOrderTotals(ctx, tx, o.OrderID)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "orders", o.OrderID, events.Updated)
+	return nil
 }
 
+// SoftDelete deletes an order that has not been delivered and is not on a delivery run, and
+// returns its reserved stock.
 func (r *SQLiteOrderRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE orders SET deleted_at = ? WHERE order_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
+	const qStatus = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE orders SET deleted_at = ? WHERE order_id = ? AND farm_id = ?`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var status domain.OrderStatus
+		if err := tx.QueryRowContext(ctx, qStatus, id, FarmFrom(ctx)).Scan(&status); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+			return err
+		}
+		if !status.Deletable() {
+			return domain.ErrOrderDelivered
+		}
+		if onRun, err := orderOnDeliveryRun(ctx, tx, id); err != nil {
+			return err
+		} else if onRun {
+			return domain.ErrOrderOnRun
+		}
+		if _, err := tx.ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx)); err != nil {
+			return err
+		}
+		return releaseOrderStock(ctx, tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "orders", id, events.Deleted)
+	return nil
+}
+
+func (r *SQLiteOrderRepo) TransitionFacts(ctx context.Context, orderID int64) (domain.OrderTransitionFacts, error) {
+	return orderTransitionFacts(ctx, conn(ctx, r.DB), orderID)
+}
+
+func (r *SQLiteOrderRepo) TransitionStatus(ctx context.Context, orderID int64, to domain.OrderStatus, note *string) error {
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		return transitionOrderStatus(ctx, tx, orderID, to, note)
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "orders", orderID, events.Updated)
+	return nil
+}
+
+// transitionOrderStatus checks and records a status change inside tx, so other writes (such as
+// issuing the invoice) commit together with it.
+func transitionOrderStatus(ctx context.Context, tx *sql.Tx, orderID int64, to domain.OrderStatus, note *string) error {
+	const qStatus = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qUpdate = `UPDATE orders SET status = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE order_id = ?`
+	const qInsert = `INSERT INTO order_status_transitions (order_id, from_status, to_status, note, created_at, created_by) VALUES (?, ?, ?, ?, ?, ?)`
+
+	var from domain.OrderStatus
+	if err := tx.QueryRowContext(ctx, qStatus, orderID, FarmFrom(ctx)).Scan(&from); err != nil {
+		return err
+	}
+	facts, err := orderTransitionFacts(ctx, tx, orderID)
+	if err != nil {
+		return err
+	}
+	if err := domain.CheckOrderTransition(from, to, facts); err != nil {
+		return err
+	}
+
+	now, by := time.Now(), actorID(ctx)
+	if _, err := tx.ExecContext(ctx, qUpdate, to, now, by, orderID); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, qInsert, orderID, from, to, note, now, by); err != nil {
+		return err
+	}
+
+	// Confirming sets stock aside; reopening, cancelling or taking the goods back returns it.
+	switch to {
+	case domain.OrderStatusConfirmed:
+		return reserveOrderStock(ctx, tx, orderID)
+	case domain.OrderStatusDraft, domain.OrderStatusCancelled, domain.OrderStatusReturned:
+		return releaseOrderStock(ctx, tx, orderID)
+	}
+	return nil
+}
+
+func (r *SQLiteOrderRepo) ListTransitions(ctx context.Context, orderID int64) ([]*domain.OrderStatusTransition, error) {
+	const q = `SELECT t.transition_id, t.order_id, t.from_status, t.to_status, t.note, t.created_at, t.created_by, u.username
+		FROM order_status_transitions t
+		LEFT JOIN users u ON u.id = t.created_by
+		WHERE t.order_id = ?
+		ORDER BY t.created_at, t.transition_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transitions []*domain.OrderStatusTransition
+	for rows.Next() {
+		var t domain.OrderStatusTransition
+		err := rows.Scan(
+			&t.TransitionID,
+			&t.OrderID,
+			&t.FromStatus,
+			&t.ToStatus,
+			&t.Note,
+			&t.CreatedAt,
+			&t.CreatedBy,
+			&t.CreatedByName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, &t)
+	}
+	return transitions, rows.Err()
+}
+
+// orderTransitionFacts counts an order's lines and those without stock reserved for them. A
+// catalog line counts as reserved once product lot reservations cover its quantity; a free-text
+// line once it is allocated to a slaughter lot.
+func orderTransitionFacts(ctx context.Context, q queryer, orderID int64) (domain.OrderTransitionFacts, error) {
+	const qFacts = `SELECT COUNT(1), COALESCE(SUM(CASE
+			WHEN oi.product_id IS NULL THEN oi.slaughter_id IS NULL
+			ELSE COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.order_item_id = oi.order_item_id), 0) < COALESCE(oi.quantity, 0) - 0.0005
+		END), 0)
+		FROM order_items oi WHERE oi.order_id = ? AND oi.deleted_at IS NULL`
+	var facts domain.OrderTransitionFacts
+	if err := q.QueryRowContext(ctx, qFacts, orderID).Scan(&facts.Lines, &facts.UnreservedLines); err != nil {
+		return facts, err
+	}
+	onRun, err := orderOnDeliveryRun(ctx, q, orderID)
+	facts.OnDeliveryRun = onRun
+	return facts, err
+}
+
+// orderOnDeliveryRun reports whether a pending stop of a live delivery run holds the order.
+func orderOnDeliveryRun(ctx context.Context, q queryer, orderID int64) (bool, error) {
+	const qStops = `SELECT COUNT(1) FROM delivery_stops s
+		JOIN delivery_runs r ON r.delivery_run_id = s.delivery_run_id AND r.deleted_at IS NULL
+		WHERE s.order_id = ? AND s.status = 'pending'`
+	var n int
+	err := q.QueryRowContext(ctx, qStops, orderID).Scan(&n)
+	return n > 0, err
+}
+
+// recalculateOrderTotals re-derives an order's subtotal, VAT and total from its non-deleted
+// lines. It runs inside the transaction that changed the lines so totals never drift.
+func recalculateOrderTotals(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	const qFee = `SELECT delivery_fee FROM orders WHERE order_id = ?`
+	const qLines = `SELECT quantity, unit_price, discount, vat_rate FROM order_items WHERE order_id = ? AND deleted_at IS NULL`
+	const qUpdate = `UPDATE orders SET subtotal_amount = ?, vat_amount = ?, total_amount = ? WHERE order_id = ?`
+
+	var deliveryFee float64
+	if err := tx.QueryRowContext(ctx, qFee, orderID).Scan(&deliveryFee); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, qLines, orderID)
+	if err != nil {
+		return err
+	}
+	var lines []*domain.OrderItem
+	for rows.Next() {
+		var line domain.OrderItem
+		if err := rows.Scan(&line.Quantity, &line.UnitPrice, &line.Discount, &line.VATRate); err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, &line)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	totals := domain.ComputeOrderTotals(lines, deliveryFee)
+	_, err = tx.ExecContext(ctx, qUpdate, totals.Subtotal, totals.VAT, totals.Total, orderID)
 	return err
 }
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// OutdoorAccessRecordRepo defines operations for the outdoor access log.
+type OutdoorAccessRecordRepo interface {
+	ListByFlock(ctx context.Context, flockID int64) ([]*domain.OutdoorAccessRecord, error)
+	Create(ctx context.Context, o *domain.OutdoorAccessRecord) (int64, error)
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+}
+
+type SQLiteOutdoorAccessRecordRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteOutdoorAccessRecordRepo(db *sql.DB) *SQLiteOutdoorAccessRecordRepo {
+	return &SQLiteOutdoorAccessRecordRepo{DB: db}
+}
+
+func (r *SQLiteOutdoorAccessRecordRepo) ListByFlock(ctx context.Context, flockID int64) ([]*domain.OutdoorAccessRecord, error) {
+	const q = `SELECT outdoor_access_record_id, flock_id, date, hours, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM outdoor_access_records
+		WHERE flock_id = ? AND deleted_at IS NULL AND flock_id IN (SELECT flock_id FROM flocks WHERE farm_id = ?)
+		ORDER BY date DESC, outdoor_access_record_id DESC`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, flockID, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.OutdoorAccessRecord
+	for rows.Next() {
+		var item domain.OutdoorAccessRecord
+		err := rows.Scan(
+			&item.OutdoorAccessRecordID,
+			&item.FlockID,
+			&item.Date,
+			&item.Hours,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteOutdoorAccessRecordRepo) Create(ctx context.Context, o *domain.OutdoorAccessRecord) (int64, error) {
+	const q = `INSERT INTO outdoor_access_records (flock_id, date, hours, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	now := time.Now()
+	o.Audit.CreatedAt = now
+	o.Audit.UpdatedAt = now
+	stampActor(ctx, &o.Audit)
+
+	if err := refsOnFarm(ctx, conn(ctx, r.DB), farmRef{"flocks", "flock_id", &o.FlockID}); err != nil {
+		return 0, err
+	}
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		o.FlockID,
+		o.Date,
+		o.Hours,
+		o.Notes,
+		o.Audit.CreatedAt,
+		o.Audit.UpdatedAt,
+		o.Audit.CreatedBy,
+		o.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "outdoor_access_records", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteOutdoorAccessRecordRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE outdoor_access_records SET deleted_at = ? WHERE outdoor_access_record_id = ?
+		AND flock_id IN (SELECT flock_id FROM flocks WHERE farm_id = ?)`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx)); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "outdoor_access_records", id, events.Deleted)
+	return nil
+}
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// PaymentRepo defines operations for customer payments and the receivables they settle.
+// Payments are financial records and are never changed once recorded.
+type PaymentRepo interface {
+	// Count returns the number of recorded payments.
+	Count(ctx context.Context) (int64, error)
+	// List returns all payments with their customer names, newest first, without allocations.
+	List(ctx context.Context) ([]*domain.Payment, error)
+	// ListByCustomer returns a customer's payments, oldest first, without allocations.
+	ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Payment, error)
+	// FindByID returns a payment with its allocations.
+	FindByID(ctx context.Context, id int64) (*domain.Payment, error)
+	// Create records a payment and its allocations after checking them against the open invoice
+	// balances. Orders whose invoice becomes fully paid move to paid in the same transaction.
+	Create(ctx context.Context, p *domain.Payment) (int64, error)
+	// InvoiceBalances returns the credited and paid amounts of the invoices (not credit notes)
+	// of a customer, or of all customers when customerID is 0, oldest first.
+	InvoiceBalances(ctx context.Context, customerID int64) ([]*domain.InvoiceBalance, error)
+}
+
+type SQLitePaymentRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLitePaymentRepo(db *sql.DB) *SQLitePaymentRepo {
+	return &SQLitePaymentRepo{DB: db}
+}
+
+func (r *SQLitePaymentRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM payments WHERE farm_id = ? AND deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+const paymentSelect = `
+	SELECT p.payment_id, p.customer_id, p.payment_date, p.method, p.amount, p.reference, p.notes,
+		   p.created_at, p.updated_at, p.deleted_at, p.created_by, p.updated_by, COALESCE(c.name, '')
+	FROM payments p
+	LEFT JOIN customers c ON c.customer_id = p.customer_id
+	WHERE p.farm_id = ? AND p.deleted_at IS NULL`
+
+func scanPayment(scan func(dest ...any) error) (*domain.Payment, error) {
+	var p domain.Payment
+	err := scan(
+		&p.PaymentID,
+		&p.CustomerID,
+		&p.PaymentDate,
+		&p.Method,
+		&p.Amount,
+		&p.Reference,
+		&p.Notes,
+		&p.Audit.CreatedAt,
+		&p.Audit.UpdatedAt,
+		&p.Audit.DeletedAt,
+		&p.Audit.CreatedBy,
+		&p.Audit.UpdatedBy,
+		&p.CustomerName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *SQLitePaymentRepo) List(ctx context.Context) ([]*domain.Payment, error) {
+	const q = paymentSelect + ` ORDER BY p.payment_date DESC, p.payment_id DESC`
+	return r.list(ctx, q, FarmFrom(ctx))
+}
+
+func (r *SQLitePaymentRepo) ListByCustomer(ctx context.Context, customerID int64) ([]*domain.Payment, error) {
+	const q = paymentSelect + ` AND p.customer_id = ? ORDER BY p.payment_date, p.payment_id`
+	return r.list(ctx, q, FarmFrom(ctx), customerID)
+}
+
+func (r *SQLitePaymentRepo) list(ctx context.Context, q string, args ...any) ([]*domain.Payment, error) {
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []*domain.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+func (r *SQLitePaymentRepo) FindByID(ctx context.Context, id int64) (*domain.Payment, error) {
+	const q = paymentSelect + ` AND p.payment_id = ?`
+	p, err := scanPayment(conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx), id).Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	const qAllocations = `
+		SELECT a.payment_allocation_id, a.payment_id, a.invoice_id, a.amount, i.number
+		FROM payment_allocations a
+		JOIN invoices i ON i.invoice_id = a.invoice_id
+		WHERE a.payment_id = ?
+		ORDER BY i.issue_date, i.invoice_id
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qAllocations, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a domain.PaymentAllocation
+		if err := rows.Scan(&a.PaymentAllocationID, &a.PaymentID, &a.InvoiceID, &a.Amount, &a.InvoiceNumber); err != nil {
+			return nil, err
+		}
+		p.Allocations = append(p.Allocations, &a)
+	}
+	return p, rows.Err()
+}
+
+func (r *SQLitePaymentRepo) Create(ctx context.Context, p *domain.Payment) (int64, error) {
+	const qPayment = `INSERT INTO payments (farm_id, customer_id, payment_date, method, amount, reference, notes, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const qAllocation = `INSERT INTO payment_allocations (payment_id, invoice_id, amount) VALUES (?, ?, ?)`
+	const qOrderStatus = `SELECT COALESCE(status, 'draft') FROM orders WHERE order_id = ? AND deleted_at IS NULL`
+
+	p.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &p.Audit)
+	var paidOrders []int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		ids := make([]int64, 0, len(p.Allocations))
+		for _, a := range p.Allocations {
+			ids = append(ids, a.InvoiceID)
+		}
+		balances, err := invoiceBalances(ctx, tx, 0, ids)
+		if err != nil {
+			return err
+		}
+		byID := make(map[int64]*domain.InvoiceBalance, len(balances))
+		for _, b := range balances {
+			byID[b.Invoice.InvoiceID] = b
+		}
+		if err := domain.CheckAllocations(p, byID); err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, qPayment,
+			FarmFrom(ctx),
+			p.CustomerID,
+			p.PaymentDate,
+			p.Method,
+			p.Amount,
+			p.Reference,
+			p.Notes,
+			p.Audit.CreatedAt,
+			p.Audit.UpdatedAt,
+			p.Audit.CreatedBy,
+			p.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if p.PaymentID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		for _, a := range p.Allocations {
+			a.PaymentID = p.PaymentID
+			result, err := tx.ExecContext(ctx, qAllocation, a.PaymentID, a.InvoiceID, a.Amount)
+			if err != nil {
+				return err
+			}
+			if a.PaymentAllocationID, err = result.LastInsertId(); err != nil {
+				return err
+			}
+
+			balance := byID[a.InvoiceID]
+			balance.Paid += a.Amount
+			if balance.Open() > 0 {
+				continue
+			}
+			var status domain.OrderStatus
+			if err := tx.QueryRowContext(ctx, qOrderStatus, balance.Invoice.OrderID).Scan(&status); err != nil {
+				return err
+			}
+			if status == domain.OrderStatusInvoiced {
+				note := fmt.Sprintf("Invoice %s settled by payment #%d", balance.Invoice.Number, p.PaymentID)
+				if err := transitionOrderStatus(ctx, tx, balance.Invoice.OrderID, domain.OrderStatusPaid, &note); err != nil {
+					return err
+				}
+				paidOrders = append(paidOrders, balance.Invoice.OrderID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "payments", p.PaymentID, events.Created)
+	for _, a := range p.Allocations {
+		publish(ctx, r.Events, "invoices", a.InvoiceID, events.Updated)
+	}
+	for _, orderID := range paidOrders {
+		publish(ctx, r.Events, "orders", orderID, events.Updated)
+	}
+	return p.PaymentID, nil
+}
+
+func (r *SQLitePaymentRepo) InvoiceBalances(ctx context.Context, customerID int64) ([]*domain.InvoiceBalance, error) {
+	return invoiceBalances(ctx, conn(ctx, r.DB), customerID, nil)
+}
+
+// invoiceBalances loads the invoice balances of the context's farm, optionally restricted to a
+// customer and/or a set of invoice IDs. An empty (non-nil) ID set matches nothing.
+func invoiceBalances(ctx context.Context, q queryer, customerID int64, invoiceIDs []int64) ([]*domain.InvoiceBalance, error) {
+	if invoiceIDs != nil && len(invoiceIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT ` + invoiceColumns + `,
+		COALESCE((SELECT -SUM(c.total_amount) FROM invoices c WHERE c.credited_invoice_id = i.invoice_id), 0),
+		COALESCE((SELECT SUM(a.amount) FROM payment_allocations a
+			JOIN payments p ON p.payment_id = a.payment_id AND p.deleted_at IS NULL
+			WHERE a.invoice_id = i.invoice_id), 0)
+		FROM invoices i
+		WHERE i.farm_id = ? AND i.kind = 'invoice'`
+	args := []any{FarmFrom(ctx)}
+	if customerID != 0 {
+		query += ` AND i.customer_id = ?`
+		args = append(args, customerID)
+	}
+	if invoiceIDs != nil {
+		query += ` AND i.invoice_id IN (?` + strings.Repeat(`, ?`, len(invoiceIDs)-1) + `)`
+		for _, id := range invoiceIDs {
+			args = append(args, id)
+		}
+	}
+	query += ` ORDER BY i.issue_date, i.invoice_id`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []*domain.InvoiceBalance
+	for rows.Next() {
+		var b domain.InvoiceBalance
+		b.Invoice, err = scanInvoice(func(dest ...any) error {
+			return rows.Scan(append(dest, &b.Credited, &b.Paid)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+		balances = append(balances, &b)
+	}
+	return balances, rows.Err()
+}
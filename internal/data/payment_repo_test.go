@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestPaymentRepo_AllocatesAndSettles(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	invoices := NewSQLiteInvoiceRepo(db)
+	payments := NewSQLitePaymentRepo(db)
+
+	customer := &domain.Customer{Name: "Butcher"}
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, customer)
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+	customer.CustomerID = customerID
+	orderID, err := orders.Create(ctx, &domain.Order{CustomerID: customerID})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	qty, price := 4.0, 25.0
+	if _, err := NewSQLiteOrderItemRepo(db).Create(ctx, &domain.OrderItem{OrderID: orderID, Quantity: &qty, UnitPrice: &price}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE orders SET status = 'delivered' WHERE order_id = ?`, orderID); err != nil {
+		t.Fatalf("deliver order: %v", err)
+	}
+	order, err := orders.FindByID(ctx, orderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if order.Items, err = NewSQLiteOrderItemRepo(db).ListByOrder(ctx, orderID); err != nil {
+		t.Fatalf("list lines: %v", err)
+	}
+	inv, err := domain.NewInvoiceFromOrder(order, customer, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 30, time.January)
+	if err != nil {
+		t.Fatalf("draft invoice: %v", err)
+	}
+	if _, err := invoices.Issue(ctx, inv); err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+
+	pay := func(amount, allocated float64) error {
+		t.Helper()
+		_, err := payments.Create(ctx, &domain.Payment{
+			CustomerID:  customerID,
+			PaymentDate: time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC),
+			Method:      domain.PaymentMethodBankTransfer,
+			Amount:      amount,
+			Allocations: []*domain.PaymentAllocation{{InvoiceID: inv.InvoiceID, Amount: allocated}},
+		})
+		return err
+	}
+	wantStatus := func(want domain.OrderStatus) {
+		t.Helper()
+		order, err := orders.FindByID(ctx, orderID)
+		if err != nil {
+			t.Fatalf("find order: %v", err)
+		}
+		if order.Status != want {
+			t.Errorf("order status = %s, want %s", order.Status, want)
+		}
+	}
+
+	if err := pay(30, 40); !errors.Is(err, domain.ErrOverAllocated) {
+		t.Fatalf("over-allocated payment err = %v, want ErrOverAllocated", err)
+	}
+	if err := pay(60, 60); err != nil {
+		t.Fatalf("partial payment: %v", err)
+	}
+	wantStatus(domain.OrderStatusInvoiced)
+	if err := pay(50, 50); !errors.Is(err, domain.ErrAllocationExceedsOpen) {
+		t.Fatalf("overpaying allocation err = %v, want ErrAllocationExceedsOpen", err)
+	}
+	if err := pay(50, 40); err != nil {
+		t.Fatalf("final payment: %v", err)
+	}
+	wantStatus(domain.OrderStatusPaid)
+
+	balances, err := payments.InvoiceBalances(ctx, customerID)
+	if err != nil {
+		t.Fatalf("balances: %v", err)
+	}
+	if len(balances) != 1 || balances[0].Paid != 100 || balances[0].Open() != 0 {
+		t.Fatalf("balances = %+v, want one invoice paid 100, open 0", balances)
+	}
+}
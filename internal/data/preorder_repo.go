@@ -0,0 +1,453 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// PreorderRepo defines operations for seasonal pre-order campaigns, their reservations and deposits.
+// Campaigns carry no version as nothing edits them after creation; their weight bands are only
+// added and removed, the removal checking inside its transaction that no pre-order uses the band.
+type PreorderRepo interface {
+	// Count returns the number of open (reserved) pre-orders across all campaigns.
+	Count(ctx context.Context) (int64, error)
+	// ListCampaigns returns all campaigns with their weight bands, latest pickup first.
+	ListCampaigns(ctx context.Context) ([]*domain.PreorderCampaign, error)
+	// FindCampaign returns a campaign with its weight bands.
+	FindCampaign(ctx context.Context, id int64) (*domain.PreorderCampaign, error)
+	CreateCampaign(ctx context.Context, c *domain.PreorderCampaign) (int64, error)
+	AddWeightBand(ctx context.Context, band *domain.WeightBand) (int64, error)
+	// DeleteWeightBand removes a band of a campaign, refusing with domain.ErrWeightBandInUse
+	// while pre-orders reserve birds in it.
+	DeleteWeightBand(ctx context.Context, campaignID, bandID int64) error
+	// ListByCampaign returns the pre-orders of a campaign with customer, band and deposit paid,
+	// by pickup date.
+	ListByCampaign(ctx context.Context, campaignID int64) ([]*domain.Preorder, error)
+	// FindByID returns a pre-order with its deposits.
+	FindByID(ctx context.Context, id int64) (*domain.Preorder, error)
+	// Create records a pre-order after checking the pickup date and weight band against its campaign.
+	Create(ctx context.Context, p *domain.Preorder) (int64, error)
+	// ChangeStatus collects or cancels a reserved pre-order loaded at version.
+	ChangeStatus(ctx context.Context, id int64, to domain.PreorderStatus, version int64) error
+	// AddDeposit records a deposit received for a reserved pre-order.
+	AddDeposit(ctx context.Context, d *domain.PreorderDeposit) (int64, error)
+	// SupplyBatches returns the production batches ready between from and to (inclusive) with
+	// their flocks, which forecast the birds available to the campaign.
+	SupplyBatches(ctx context.Context, from, to time.Time) ([]*domain.ProductionBatch, error)
+}
+
+type SQLitePreorderRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLitePreorderRepo(db *sql.DB) *SQLitePreorderRepo {
+	return &SQLitePreorderRepo{DB: db}
+}
+
+func (r *SQLitePreorderRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM preorders WHERE farm_id = ? AND deleted_at IS NULL AND status = 'reserved'`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+const campaignSelect = `
+	SELECT campaign_id, name, pickup_from, pickup_to, deposit_per_bird, notes,
+		   created_at, updated_at, deleted_at, created_by, updated_by
+	FROM preorder_campaigns
+	WHERE farm_id = ? AND deleted_at IS NULL`
+
+func scanCampaign(scan func(dest ...any) error) (*domain.PreorderCampaign, error) {
+	var c domain.PreorderCampaign
+	err := scan(
+		&c.CampaignID,
+		&c.Name,
+		&c.PickupFrom,
+		&c.PickupTo,
+		&c.DepositPerBird,
+		&c.Notes,
+		&c.Audit.CreatedAt,
+		&c.Audit.UpdatedAt,
+		&c.Audit.DeletedAt,
+		&c.Audit.CreatedBy,
+		&c.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *SQLitePreorderRepo) ListCampaigns(ctx context.Context) ([]*domain.PreorderCampaign, error) {
+	const q = campaignSelect + ` ORDER BY pickup_from DESC, campaign_id DESC`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []*domain.PreorderCampaign
+	byID := map[int64]*domain.PreorderCampaign{}
+	for rows.Next() {
+		c, err := scanCampaign(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+		byID[c.CampaignID] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	bands, err := r.weightBands(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, band := range bands {
+		if c, ok := byID[band.CampaignID]; ok {
+			c.Bands = append(c.Bands, band)
+		}
+	}
+	return campaigns, nil
+}
+
+func (r *SQLitePreorderRepo) FindCampaign(ctx context.Context, id int64) (*domain.PreorderCampaign, error) {
+	const q = campaignSelect + ` AND campaign_id = ?`
+	c, err := scanCampaign(conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx), id).Scan)
+	if err != nil {
+		return nil, err
+	}
+	if c.Bands, err = r.weightBands(ctx, id); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// weightBands returns the bands of a campaign, or of all campaigns when campaignID is 0, lightest first.
+func (r *SQLitePreorderRepo) weightBands(ctx context.Context, campaignID int64) ([]*domain.WeightBand, error) {
+	const q = `SELECT weight_band_id, campaign_id, label, min_kg, max_kg FROM preorder_weight_bands
+		WHERE (? = 0 OR campaign_id = ?) AND campaign_id IN (SELECT campaign_id FROM preorder_campaigns WHERE farm_id = ?)
+		ORDER BY campaign_id, min_kg, weight_band_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, campaignID, campaignID, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bands []*domain.WeightBand
+	for rows.Next() {
+		var band domain.WeightBand
+		if err := rows.Scan(&band.WeightBandID, &band.CampaignID, &band.Label, &band.MinKg, &band.MaxKg); err != nil {
+			return nil, err
+		}
+		bands = append(bands, &band)
+	}
+	return bands, rows.Err()
+}
+
+func (r *SQLitePreorderRepo) CreateCampaign(ctx context.Context, c *domain.PreorderCampaign) (int64, error) {
+	const q = `INSERT INTO preorder_campaigns (farm_id, name, pickup_from, pickup_to, deposit_per_bird, notes, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	c.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &c.Audit)
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
+		c.Name,
+		c.PickupFrom,
+		c.PickupTo,
+		c.DepositPerBird,
+		c.Notes,
+		c.Audit.CreatedAt,
+		c.Audit.UpdatedAt,
+		c.Audit.CreatedBy,
+		c.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "preorder_campaigns", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLitePreorderRepo) AddWeightBand(ctx context.Context, band *domain.WeightBand) (int64, error) {
+	const q = `INSERT INTO preorder_weight_bands (campaign_id, label, min_kg, max_kg) VALUES (?, ?, ?, ?)`
+	if err := onFarm(ctx, conn(ctx, r.DB), "preorder_campaigns", "campaign_id", band.CampaignID); err != nil {
+		return 0, err
+	}
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q, band.CampaignID, band.Label, band.MinKg, band.MaxKg)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "preorder_campaigns", band.CampaignID, events.Updated)
+	return id, nil
+}
+
+func (r *SQLitePreorderRepo) DeleteWeightBand(ctx context.Context, campaignID, bandID int64) error {
+	const qUsed = `SELECT COUNT(1) FROM preorders WHERE weight_band_id = ? AND deleted_at IS NULL`
+	const q = `DELETE FROM preorder_weight_bands WHERE weight_band_id = ? AND campaign_id = ?`
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "preorder_campaigns", "campaign_id", campaignID); err != nil {
+			return err
+		}
+		var used int
+		if err := tx.QueryRowContext(ctx, qUsed, bandID).Scan(&used); err != nil {
+			return err
+		}
+		if used > 0 {
+			return domain.ErrWeightBandInUse
+		}
+		result, err := tx.ExecContext(ctx, q, bandID, campaignID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "preorder_campaigns", campaignID, events.Updated)
+	return nil
+}
+
+const preorderSelect = `
+	SELECT p.preorder_id, p.campaign_id, p.customer_id, p.weight_band_id, p.quantity, p.pickup_date, p.status, p.notes,
+		   p.created_at, p.updated_at, p.deleted_at, p.created_by, p.updated_by, p.version, COALESCE(c.name, ''),
+		   b.weight_band_id, b.campaign_id, b.label, b.min_kg, b.max_kg,
+		   COALESCE((SELECT SUM(d.amount) FROM preorder_deposits d WHERE d.preorder_id = p.preorder_id), 0)
+	FROM preorders p
+	JOIN preorder_weight_bands b ON b.weight_band_id = p.weight_band_id
+	LEFT JOIN customers c ON c.customer_id = p.customer_id
+	WHERE p.farm_id = ? AND p.deleted_at IS NULL`
+
+func scanPreorder(scan func(dest ...any) error) (*domain.Preorder, error) {
+	var p domain.Preorder
+	var band domain.WeightBand
+	err := scan(
+		&p.PreorderID,
+		&p.CampaignID,
+		&p.CustomerID,
+		&p.WeightBandID,
+		&p.Quantity,
+		&p.PickupDate,
+		&p.Status,
+		&p.Notes,
+		&p.Audit.CreatedAt,
+		&p.Audit.UpdatedAt,
+		&p.Audit.DeletedAt,
+		&p.Audit.CreatedBy,
+		&p.Audit.UpdatedBy,
+		&p.Audit.Version,
+		&p.CustomerName,
+		&band.WeightBandID,
+		&band.CampaignID,
+		&band.Label,
+		&band.MinKg,
+		&band.MaxKg,
+		&p.DepositPaid,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Band = &band
+	return &p, nil
+}
+
+func (r *SQLitePreorderRepo) ListByCampaign(ctx context.Context, campaignID int64) ([]*domain.Preorder, error) {
+	const q = preorderSelect + ` AND p.campaign_id = ? ORDER BY p.pickup_date, c.name, p.preorder_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), campaignID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var preorders []*domain.Preorder
+	for rows.Next() {
+		p, err := scanPreorder(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		preorders = append(preorders, p)
+	}
+	return preorders, rows.Err()
+}
+
+func (r *SQLitePreorderRepo) FindByID(ctx context.Context, id int64) (*domain.Preorder, error) {
+	const q = preorderSelect + ` AND p.preorder_id = ?`
+	p, err := scanPreorder(conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx), id).Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	const qDeposits = `SELECT preorder_deposit_id, preorder_id, received_on, method, amount, reference, created_at, created_by
+		FROM preorder_deposits WHERE preorder_id = ? ORDER BY received_on, preorder_deposit_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qDeposits, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d domain.PreorderDeposit
+		if err := rows.Scan(&d.PreorderDepositID, &d.PreorderID, &d.ReceivedOn, &d.Method, &d.Amount, &d.Reference, &d.Audit.CreatedAt, &d.Audit.CreatedBy); err != nil {
+			return nil, err
+		}
+		p.Deposits = append(p.Deposits, &d)
+	}
+	return p, rows.Err()
+}
+
+func (r *SQLitePreorderRepo) Create(ctx context.Context, p *domain.Preorder) (int64, error) {
+	const qCampaign = `SELECT pickup_from, pickup_to FROM preorder_campaigns WHERE campaign_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const qBand = `SELECT COUNT(1) FROM preorder_weight_bands WHERE weight_band_id = ? AND campaign_id = ?`
+	const q = `INSERT INTO preorders (farm_id, campaign_id, customer_id, weight_band_id, quantity, pickup_date, status, notes, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	p.Status = domain.PreorderStatusReserved
+	p.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &p.Audit)
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var campaign domain.PreorderCampaign
+		if err := tx.QueryRowContext(ctx, qCampaign, p.CampaignID, FarmFrom(ctx)).Scan(&campaign.PickupFrom, &campaign.PickupTo); err != nil {
+			return err
+		}
+		if !campaign.InPickupWindow(p.PickupDate) {
+			return domain.ErrPickupOutsideCampaign
+		}
+		var bands int
+		if err := tx.QueryRowContext(ctx, qBand, p.WeightBandID, p.CampaignID).Scan(&bands); err != nil {
+			return err
+		}
+		if bands == 0 {
+			return ErrNotFound
+		}
+
+		result, err := tx.ExecContext(ctx, q,
+			FarmFrom(ctx),
+			p.CampaignID,
+			p.CustomerID,
+			p.WeightBandID,
+			p.Quantity,
+			p.PickupDate,
+			p.Status,
+			p.Notes,
+			p.Audit.CreatedAt,
+			p.Audit.UpdatedAt,
+			p.Audit.CreatedBy,
+			p.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		p.PreorderID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "preorders", p.PreorderID, events.Created)
+	return p.PreorderID, nil
+}
+
+func (r *SQLitePreorderRepo) ChangeStatus(ctx context.Context, id int64, to domain.PreorderStatus, version int64) error {
+	const qStatus = `SELECT status FROM preorders WHERE preorder_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE preorders SET status = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE preorder_id = ?` + versionCheck
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var from domain.PreorderStatus
+		if err := tx.QueryRowContext(ctx, qStatus, id, FarmFrom(ctx)).Scan(&from); err != nil {
+			return err
+		}
+		if !from.CanChangeTo(to) {
+			return domain.ErrPreorderClosed
+		}
+		if err := tx.QueryRowContext(ctx, q, to, time.Now(), actorID(ctx), id, version).Scan(&version); err != nil {
+			return versionError(ctx, tx, err, "preorders", "preorder_id", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "preorders", id, events.Updated)
+	return nil
+}
+
+func (r *SQLitePreorderRepo) AddDeposit(ctx context.Context, d *domain.PreorderDeposit) (int64, error) {
+	const qStatus = `SELECT status FROM preorders WHERE preorder_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	const q = `INSERT INTO preorder_deposits (preorder_id, received_on, method, amount, reference, created_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	d.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &d.Audit)
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var status domain.PreorderStatus
+		if err := tx.QueryRowContext(ctx, qStatus, d.PreorderID, FarmFrom(ctx)).Scan(&status); err != nil {
+			return err
+		}
+		if status != domain.PreorderStatusReserved {
+			return domain.ErrPreorderClosed
+		}
+		result, err := tx.ExecContext(ctx, q, d.PreorderID, d.ReceivedOn, d.Method, d.Amount, d.Reference, d.Audit.CreatedAt, d.Audit.CreatedBy)
+		if err != nil {
+			return err
+		}
+		d.PreorderDepositID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "preorders", d.PreorderID, events.Updated)
+	return d.PreorderDepositID, nil
+}
+
+func (r *SQLitePreorderRepo) SupplyBatches(ctx context.Context, from, to time.Time) ([]*domain.ProductionBatch, error) {
+	const q = `
+		SELECT b.batch_id, b.flock_id, b.date_ready, b.number_in_batch, b.weight_estimate, b.notes,
+			   f.flock_id, f.breed, f.number_of_birds
+		FROM production_batches b
+		JOIN flocks f ON f.flock_id = b.flock_id
+		WHERE b.farm_id = ? AND b.deleted_at IS NULL AND substr(b.date_ready, 1, 10) BETWEEN ? AND ?
+		ORDER BY b.date_ready, b.batch_id
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx), from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batches []*domain.ProductionBatch
+	for rows.Next() {
+		var b domain.ProductionBatch
+		var f domain.Flock
+		if err := rows.Scan(&b.BatchID, &b.FlockID, &b.DateReady, &b.NumberInBatch, &b.WeightEstimate, &b.Notes, &f.FlockID, &f.Breed, &f.NumberOfBirds); err != nil {
+			return nil, err
+		}
+		b.Flock = &f
+		batches = append(batches, &b)
+	}
+	return batches, rows.Err()
+}
@@ -0,0 +1,87 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestPreorderRepo_ReservationsDepositsAndSupply(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLitePreorderRepo(db)
+
+	day := func(d int) time.Time { return time.Date(2026, 12, d, 0, 0, 0, 0, time.UTC) }
+	campaignID, err := repo.CreateCampaign(ctx, &domain.PreorderCampaign{Name: "Christmas", PickupFrom: day(21), PickupTo: day(23), DepositPerBird: 20})
+	if err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+	bandID, err := repo.AddWeightBand(ctx, &domain.WeightBand{CampaignID: campaignID, Label: "Medium", MinKg: 6, MaxKg: 8})
+	if err != nil {
+		t.Fatalf("add band: %v", err)
+	}
+	customerID, err := NewSQLiteCustomerRepo(db).Create(ctx, &domain.Customer{Name: "Family Smith"})
+	if err != nil {
+		t.Fatalf("create customer: %v", err)
+	}
+
+	if _, err := repo.Create(ctx, &domain.Preorder{CampaignID: campaignID, CustomerID: customerID, WeightBandID: bandID, Quantity: 2, PickupDate: day(24)}); !errors.Is(err, domain.ErrPickupOutsideCampaign) {
+		t.Fatalf("pickup after the campaign err = %v, want ErrPickupOutsideCampaign", err)
+	}
+	preorderID, err := repo.Create(ctx, &domain.Preorder{CampaignID: campaignID, CustomerID: customerID, WeightBandID: bandID, Quantity: 2, PickupDate: day(22)})
+	if err != nil {
+		t.Fatalf("create preorder: %v", err)
+	}
+	if _, err := repo.AddDeposit(ctx, &domain.PreorderDeposit{PreorderID: preorderID, ReceivedOn: day(1), Method: domain.PaymentMethodCash, Amount: 25}); err != nil {
+		t.Fatalf("add deposit: %v", err)
+	}
+	if err := repo.DeleteWeightBand(ctx, campaignID, bandID); !errors.Is(err, domain.ErrWeightBandInUse) {
+		t.Fatalf("delete used band err = %v, want ErrWeightBandInUse", err)
+	}
+
+	preorders, err := repo.ListByCampaign(ctx, campaignID)
+	if err != nil || len(preorders) != 1 {
+		t.Fatalf("list preorders: %v (%d)", err, len(preorders))
+	}
+	if p := preorders[0]; p.CustomerName != "Family Smith" || p.Band.Label != "Medium" || p.DepositPaid != 25 || p.DepositOutstanding(20) != 15 {
+		t.Fatalf("unexpected preorder: %+v", p)
+	}
+
+	if err := repo.ChangeStatus(ctx, preorderID, domain.PreorderStatusCollected, 0); !errors.Is(err, ErrConflict) {
+		t.Fatalf("collect without a version err = %v, want ErrConflict", err)
+	}
+	if err := repo.ChangeStatus(ctx, preorderID, domain.PreorderStatusCollected, preorders[0].Audit.Version); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if err := repo.ChangeStatus(ctx, preorderID, domain.PreorderStatusCancelled, preorders[0].Audit.Version+1); !errors.Is(err, domain.ErrPreorderClosed) {
+		t.Fatalf("cancel collected err = %v, want ErrPreorderClosed", err)
+	}
+	if _, err := repo.AddDeposit(ctx, &domain.PreorderDeposit{PreorderID: preorderID, ReceivedOn: day(22), Method: domain.PaymentMethodCash, Amount: 5}); !errors.Is(err, domain.ErrPreorderClosed) {
+		t.Fatalf("deposit on collected err = %v, want ErrPreorderClosed", err)
+	}
+
+	birds := 300
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze", NumberOfBirds: &birds})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	batches := NewSQLiteProductionBatchRepo(db)
+	for _, ready := range []time.Time{day(1), day(15), day(28)} {
+		if _, err := batches.Create(ctx, &domain.ProductionBatch{FlockID: flockID, DateReady: &ready}); err != nil {
+			t.Fatalf("create batch: %v", err)
+		}
+	}
+	campaign, err := repo.FindCampaign(ctx, campaignID)
+	if err != nil {
+		t.Fatalf("find campaign: %v", err)
+	}
+	from, to := campaign.SupplyWindow()
+	supply, err := repo.SupplyBatches(ctx, from, to)
+	if err != nil {
+		t.Fatalf("supply batches: %v", err)
+	}
+	if len(supply) != 1 || supply[0].Birds() != 300 {
+		t.Fatalf("expected only the batch ready on the 15th, counted with its flock's birds, got %+v", supply)
+	}
+}
@@ -0,0 +1,341 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// PriceListRepo defines operations for customer-type price lists.
+type PriceListRepo interface {
+	// Count returns the number of non-deleted price lists.
+	Count(ctx context.Context) (int64, error)
+	// List returns all non-deleted price lists without their items.
+	List(ctx context.Context) ([]*domain.PriceList, error)
+	// FindByID returns a price list with its items and their products.
+	FindByID(ctx context.Context, id int64) (*domain.PriceList, error)
+	// Create inserts a new price list.
+	Create(ctx context.Context, list *domain.PriceList) (int64, error)
+	// Update modifies the name, customer type and validity of a price list.
+	Update(ctx context.Context, list *domain.PriceList) error
+	// SoftDelete marks the price list as deleted.
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+	// SetItemPrice creates or replaces the price of a product in a list. Prices are versioned
+	// through their list: the change only applies while the list is still at version, and
+	// bumps it.
+	SetItemPrice(ctx context.Context, item *domain.PriceListItem, version int64) error
+	// DeleteItem removes a product price from a list, with the same version check as
+	// SetItemPrice.
+	DeleteItem(ctx context.Context, listID, itemID, version int64, deletedAt time.Time) error
+	// PriceFor returns the price of a product for a customer type on a day, or ErrNotFound
+	// when no valid price list carries the product.
+	PriceFor(ctx context.Context, productID int64, customerType string, day time.Time) (*domain.PriceListItem, error)
+}
+
+type SQLitePriceListRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLitePriceListRepo(db *sql.DB) *SQLitePriceListRepo {
+	return &SQLitePriceListRepo{DB: db}
+}
+
+func (r *SQLitePriceListRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM price_lists WHERE deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *SQLitePriceListRepo) List(ctx context.Context) ([]*domain.PriceList, error) {
+	const q = `
+		SELECT price_list_id, name, customer_type, valid_from, valid_to,
+			   created_at, updated_at, deleted_at, created_by, updated_by
+		FROM price_lists
+		WHERE deleted_at IS NULL
+		ORDER BY name
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*domain.PriceList
+	for rows.Next() {
+		var list domain.PriceList
+		err := rows.Scan(
+			&list.PriceListID,
+			&list.Name,
+			&list.CustomerType,
+			&list.ValidFrom,
+			&list.ValidTo,
+			&list.Audit.CreatedAt,
+			&list.Audit.UpdatedAt,
+			&list.Audit.DeletedAt,
+			&list.Audit.CreatedBy,
+			&list.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	return lists, rows.Err()
+}
+
+func (r *SQLitePriceListRepo) FindByID(ctx context.Context, id int64) (*domain.PriceList, error) {
+	const q = `
+		SELECT price_list_id, name, customer_type, valid_from, valid_to,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
+		FROM price_lists
+		WHERE price_list_id = ? AND deleted_at IS NULL
+	`
+	var list domain.PriceList
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id).Scan(
+		&list.PriceListID,
+		&list.Name,
+		&list.CustomerType,
+		&list.ValidFrom,
+		&list.ValidTo,
+		&list.Audit.CreatedAt,
+		&list.Audit.UpdatedAt,
+		&list.Audit.DeletedAt,
+		&list.Audit.CreatedBy,
+		&list.Audit.UpdatedBy,
+		&list.Audit.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	const qItems = `
+		SELECT i.price_list_item_id, i.price_list_id, i.product_id, i.unit_price,
+			   p.product_id, p.sku, p.name, p.unit, p.vat_rate, p.active
+		FROM price_list_items i
+		JOIN products p ON p.product_id = i.product_id
+		WHERE i.price_list_id = ? AND i.deleted_at IS NULL
+		ORDER BY p.name
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, qItems, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item domain.PriceListItem
+		var product domain.Product
+		err := rows.Scan(
+			&item.PriceListItemID,
+			&item.PriceListID,
+			&item.ProductID,
+			&item.UnitPrice,
+			&product.ProductID,
+			&product.SKU,
+			&product.Name,
+			&product.Unit,
+			&product.VATRate,
+			&product.Active,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Product = &product
+		list.Items = append(list.Items, &item)
+	}
+	return &list, rows.Err()
+}
+
+func (r *SQLitePriceListRepo) Create(ctx context.Context, list *domain.PriceList) (int64, error) {
+	const q = `
+		INSERT INTO price_lists (name, customer_type, valid_from, valid_to,
+								 created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	list.Audit.CreatedAt = now
+	list.Audit.UpdatedAt = now
+	stampActor(ctx, &list.Audit)
+
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		list.Name,
+		list.CustomerType,
+		list.ValidFrom,
+		list.ValidTo,
+		list.Audit.CreatedAt,
+		list.Audit.UpdatedAt,
+		list.Audit.CreatedBy,
+		list.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "price_lists", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLitePriceListRepo) Update(ctx context.Context, list *domain.PriceList) error {
+	const q = `
+		UPDATE price_lists
+		SET name = ?, customer_type = ?, valid_from = ?, valid_to = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE price_list_id = ? AND deleted_at IS NULL` + versionCheck
+	list.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &list.Audit)
+
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
+		list.Name,
+		list.CustomerType,
+		list.ValidFrom,
+		list.ValidTo,
+		list.Audit.UpdatedAt,
+		list.Audit.UpdatedBy,
+		list.PriceListID,
+		list.Audit.Version,
+	).Scan(&list.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "price_lists", "price_list_id", list.PriceListID)
+	}
+	publish(ctx, r.Events, "price_lists", list.PriceListID, events.Updated)
+	return nil
+}
+
+func (r *SQLitePriceListRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE price_lists SET deleted_at = ? WHERE price_list_id = ?`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "price_lists", id, events.Deleted)
+	return nil
+}
+
+func (r *SQLitePriceListRepo) SetItemPrice(ctx context.Context, item *domain.PriceListItem, version int64) error {
+	const qUpdate = `
+		UPDATE price_list_items SET unit_price = ?, updated_at = ?, updated_by = ?
+		WHERE price_list_id = ? AND product_id = ? AND deleted_at IS NULL
+	`
+	const qInsert = `
+		INSERT INTO price_list_items (price_list_id, product_id, unit_price, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	item.Audit.UpdatedAt = now
+	stampActor(ctx, &item.Audit)
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := claimPriceList(ctx, tx, item.PriceListID, version); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, qUpdate, item.UnitPrice, now, item.Audit.UpdatedBy, item.PriceListID, item.ProductID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			return err
+		}
+
+		item.Audit.CreatedAt = now
+		result, err = tx.ExecContext(ctx, qInsert, item.PriceListID, item.ProductID, item.UnitPrice, now, now, item.Audit.CreatedBy, item.Audit.UpdatedBy)
+		if err != nil {
+			return err
+		}
+		item.PriceListItemID, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "price_lists", item.PriceListID, events.Updated)
+	return nil
+}
+
+func (r *SQLitePriceListRepo) DeleteItem(ctx context.Context, listID, itemID, version int64, deletedAt time.Time) error {
+	const q = `UPDATE price_list_items SET deleted_at = ? WHERE price_list_item_id = ? AND price_list_id = ? AND deleted_at IS NULL`
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := claimPriceList(ctx, tx, listID, version); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q, deletedAt, itemID, listID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "price_lists", listID, events.Updated)
+	return nil
+}
+
+// claimPriceList moves a price list from the version its page was loaded at to the next one
+// before one of its prices changes, returning ErrConflict when the list changed since.
+func claimPriceList(ctx context.Context, tx *sql.Tx, listID, version int64) error {
+	const q = `UPDATE price_lists SET updated_at = ?, updated_by = ?, version = version + 1
+		WHERE price_list_id = ? AND deleted_at IS NULL` + versionCheck
+	if err := tx.QueryRowContext(ctx, q, time.Now(), actorID(ctx), listID, version).Scan(&version); err != nil {
+		return versionError(ctx, tx, err, "price_lists", "price_list_id", listID)
+	}
+	return nil
+}
+
+func (r *SQLitePriceListRepo) PriceFor(ctx context.Context, productID int64, customerType string, day time.Time) (*domain.PriceListItem, error) {
+	const q = `
+		SELECT l.price_list_id, l.name, l.customer_type, l.valid_from, l.valid_to,
+			   i.price_list_item_id, i.product_id, i.unit_price
+		FROM price_list_items i
+		JOIN price_lists l ON l.price_list_id = i.price_list_id
+		WHERE i.product_id = ? AND i.deleted_at IS NULL AND l.deleted_at IS NULL
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*domain.PriceList
+	for rows.Next() {
+		var list domain.PriceList
+		var item domain.PriceListItem
+		err := rows.Scan(
+			&list.PriceListID,
+			&list.Name,
+			&list.CustomerType,
+			&list.ValidFrom,
+			&list.ValidTo,
+			&item.PriceListItemID,
+			&item.ProductID,
+			&item.UnitPrice,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.PriceListID = list.PriceListID
+		list.Items = []*domain.PriceListItem{&item}
+		lists = append(lists, &list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	best := domain.SelectPriceList(lists, customerType, day)
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best.Items[0], nil
+}
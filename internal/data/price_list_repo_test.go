@@ -0,0 +1,97 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestPriceListRepo_PriceFor(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLitePriceListRepo(db)
+
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "TRK-WHOLE", Name: "Whole turkey", Unit: "kg", VATRate: 9, Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+
+	wholesale := domain.CustomerTypeWholesale
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	jun := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+	lists := []struct {
+		list  *domain.PriceList
+		price float64
+	}{
+		{&domain.PriceList{Name: "Default"}, 14},
+		{&domain.PriceList{Name: "Wholesale H1", CustomerType: &wholesale, ValidFrom: &jan, ValidTo: &jun}, 10},
+	}
+	for _, l := range lists {
+		id, err := repo.Create(ctx, l.list)
+		if err != nil {
+			t.Fatalf("create list %s: %v", l.list.Name, err)
+		}
+		if err := repo.SetItemPrice(ctx, &domain.PriceListItem{PriceListID: id, ProductID: productID, UnitPrice: l.price}, 1); err != nil {
+			t.Fatalf("set price: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name         string
+		customerType string
+		day          time.Time
+		want         float64
+	}{
+		{"wholesale in range", "Wholesale", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 10},
+		{"wholesale on last day", "wholesale", jun, 10},
+		{"wholesale after range falls back", "wholesale", jun.AddDate(0, 0, 1), 14},
+		{"retail uses default", "retail", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), 14},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			item, err := repo.PriceFor(ctx, productID, tc.customerType, tc.day)
+			if err != nil {
+				t.Fatalf("price for: %v", err)
+			}
+			if item.UnitPrice != tc.want {
+				t.Errorf("unit price = %v, want %v", item.UnitPrice, tc.want)
+			}
+		})
+	}
+
+	// Setting a price again replaces it instead of adding a second row.
+	list, err := repo.FindByID(ctx, 1)
+	if err != nil {
+		t.Fatalf("find list: %v", err)
+	}
+	if err := repo.SetItemPrice(ctx, &domain.PriceListItem{PriceListID: list.PriceListID, ProductID: productID, UnitPrice: 15}, list.Audit.Version); err != nil {
+		t.Fatalf("replace price: %v", err)
+	}
+	// A second price from the same, now stale, page does not overwrite the first.
+	if err := repo.SetItemPrice(ctx, &domain.PriceListItem{PriceListID: list.PriceListID, ProductID: productID, UnitPrice: 16}, list.Audit.Version); err != ErrConflict {
+		t.Fatalf("replace price from a stale page: got %v, want ErrConflict", err)
+	}
+	stale := list.Audit.Version
+	list, err = repo.FindByID(ctx, list.PriceListID)
+	if err != nil {
+		t.Fatalf("find list: %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].UnitPrice != 15 {
+		t.Fatalf("items after replace = %+v, want one item at 15", list.Items)
+	}
+
+	itemID := list.Items[0].PriceListItemID
+	if err := repo.DeleteItem(ctx, list.PriceListID, itemID, stale, time.Now()); err != ErrConflict {
+		t.Fatalf("delete price from a stale page: got %v, want ErrConflict", err)
+	}
+	if err := repo.DeleteItem(ctx, list.PriceListID, itemID, list.Audit.Version, time.Now()); err != nil {
+		t.Fatalf("delete price: %v", err)
+	}
+	if list, err = repo.FindByID(ctx, list.PriceListID); err != nil || len(list.Items) != 0 {
+		t.Fatalf("items after delete = %v, %v; want none", list, err)
+	}
+
+	if _, err := repo.PriceFor(ctx, productID+1, "retail", jan); err != ErrNotFound {
+		t.Errorf("unknown product err = %v, want ErrNotFound", err)
+	}
+}
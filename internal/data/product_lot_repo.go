@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// ProductLotRepo defines operations for the finished-goods product lots packed from slaughter output.
+// Lots carry no version: a lot is packed once and then only deleted, and the deletion checks its
+// reservations in the same transaction.
+type ProductLotRepo interface {
+	// Count returns the number of non-deleted product lots.
+	Count(ctx context.Context) (int64, error)
+	// ListBySlaughter returns the lots packed from a slaughter with their products and reservations.
+	ListBySlaughter(ctx context.Context, slaughterID int64) ([]*domain.ProductLot, error)
+	// List returns all non-deleted lots with their products and reservations, oldest first.
+	List(ctx context.Context) ([]*domain.ProductLot, error)
+	// Create inserts a lot and tops up the reservations of confirmed orders still short of its product.
+	Create(ctx context.Context, lot *domain.ProductLot) (int64, error)
+	// SoftDelete marks a lot as deleted; lots with reservations return ErrLotReserved.
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+}
+
+type SQLiteProductLotRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteProductLotRepo(db *sql.DB) *SQLiteProductLotRepo {
+	return &SQLiteProductLotRepo{DB: db}
+}
+
+func (r *SQLiteProductLotRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM product_lots WHERE farm_id = ? AND deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// productLotSelect loads lots with their product and the quantities committed to orders and
+// already shipped (orders delivered and beyond).
+const productLotSelect = `
+	SELECT l.product_lot_id, l.slaughter_id, l.product_id, l.weight_kg, l.piece_count, l.packing_date, l.use_by_date,
+		   l.created_at, l.updated_at, l.deleted_at, l.created_by, l.updated_by,
+		   p.sku, p.name, p.unit,
+		   COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.product_lot_id = l.product_lot_id), 0),
+		   COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r
+				JOIN order_items oi ON oi.order_item_id = r.order_item_id
+				JOIN orders o ON o.order_id = oi.order_id
+				WHERE r.product_lot_id = l.product_lot_id AND o.status IN ('delivered', 'invoiced', 'paid')), 0)
+	FROM product_lots l
+	JOIN products p ON p.product_id = l.product_id
+	WHERE l.deleted_at IS NULL`
+
+func listProductLots(ctx context.Context, q queryer, query string, args ...any) ([]*domain.ProductLot, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []*domain.ProductLot
+	for rows.Next() {
+		lot := domain.ProductLot{Product: &domain.Product{}}
+		err := rows.Scan(
+			&lot.ProductLotID,
+			&lot.SlaughterID,
+			&lot.ProductID,
+			&lot.WeightKg,
+			&lot.PieceCount,
+			&lot.PackingDate,
+			&lot.UseByDate,
+			&lot.Audit.CreatedAt,
+			&lot.Audit.UpdatedAt,
+			&lot.Audit.DeletedAt,
+			&lot.Audit.CreatedBy,
+			&lot.Audit.UpdatedBy,
+			&lot.Product.SKU,
+			&lot.Product.Name,
+			&lot.Product.Unit,
+			&lot.Committed,
+			&lot.Shipped,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lot.Product.ProductID = lot.ProductID
+		lots = append(lots, &lot)
+	}
+	return lots, rows.Err()
+}
+
+func (r *SQLiteProductLotRepo) ListBySlaughter(ctx context.Context, slaughterID int64) ([]*domain.ProductLot, error) {
+	const q = productLotSelect + ` AND l.slaughter_id = ? AND l.farm_id = ? ORDER BY p.name, l.product_lot_id`
+	return listProductLots(ctx, conn(ctx, r.DB), q, slaughterID, FarmFrom(ctx))
+}
+
+func (r *SQLiteProductLotRepo) List(ctx context.Context) ([]*domain.ProductLot, error) {
+	const q = productLotSelect + ` AND l.farm_id = ? ORDER BY l.packing_date, l.product_lot_id`
+	return listProductLots(ctx, conn(ctx, r.DB), q, FarmFrom(ctx))
+}
+
+func (r *SQLiteProductLotRepo) Create(ctx context.Context, lot *domain.ProductLot) (int64, error) {
+	const q = `INSERT INTO product_lots (farm_id, slaughter_id, product_id, weight_kg, piece_count, packing_date, use_by_date, created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	// Lines of this farm's confirmed orders for this product, oldest order first.
+	const qShort = `SELECT oi.order_item_id FROM order_items oi
+		JOIN orders o ON o.order_id = oi.order_id
+		WHERE oi.product_id = ? AND o.farm_id = ? AND oi.deleted_at IS NULL AND o.deleted_at IS NULL AND o.status = 'confirmed'
+		ORDER BY o.order_date, o.order_id, oi.order_item_id`
+
+	lot.Audit.TouchCreated(time.Now())
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, q,
+			FarmFrom(ctx),
+			lot.SlaughterID,
+			lot.ProductID,
+			lot.WeightKg,
+			lot.PieceCount,
+			lot.PackingDate,
+			lot.UseByDate,
+			lot.Audit.CreatedAt,
+			lot.Audit.UpdatedAt,
+			lot.Audit.CreatedBy,
+			lot.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		if lot.ProductLotID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+
+		lineIDs, err := queryIDs(ctx, tx, qShort, lot.ProductID, FarmFrom(ctx))
+		if err != nil {
+			return err
+		}
+		for _, lineID := range lineIDs {
+			if err := reserveLineStock(ctx, tx, lineID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "product_lots", lot.ProductLotID, events.Created)
+	return lot.ProductLotID, nil
+}
+
+func (r *SQLiteProductLotRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const qReserved = `SELECT COUNT(1) FROM stock_reservations WHERE product_lot_id = ?`
+	const q = `UPDATE product_lots SET deleted_at = ?, updated_at = ? WHERE product_lot_id = ? AND farm_id = ? AND deleted_at IS NULL`
+
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		var reserved int
+		if err := tx.QueryRowContext(ctx, qReserved, id).Scan(&reserved); err != nil {
+			return err
+		}
+		if reserved > 0 {
+			return domain.ErrLotReserved
+		}
+		result, err := tx.ExecContext(ctx, q, deletedAt, deletedAt, id, FarmFrom(ctx))
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "product_lots", id, events.Deleted)
+	return nil
+}
+
+// reserveOrderStock reserves product lot stock for every catalog line of an order that is not
+// fully reserved yet. Lines are left short when stock runs out.
+func reserveOrderStock(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	const q = `SELECT order_item_id FROM order_items WHERE order_id = ? AND product_id IS NOT NULL AND deleted_at IS NULL ORDER BY order_item_id`
+	lineIDs, err := queryIDs(ctx, tx, q, orderID)
+	if err != nil {
+		return err
+	}
+	for _, lineID := range lineIDs {
+		if err := reserveLineStock(ctx, tx, lineID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveLineStock tops up the reservations of one order line from the lots of its product,
+// first-expiring first. A line without a slaughter lot is traced to the first lot reserved.
+func reserveLineStock(ctx context.Context, tx *sql.Tx, lineID int64) error {
+	const qLine = `SELECT oi.product_id, COALESCE(oi.quantity, 0), oi.slaughter_id,
+		COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r WHERE r.order_item_id = oi.order_item_id), 0)
+		FROM order_items oi WHERE oi.order_item_id = ?`
+	const qLots = productLotSelect + ` AND l.product_id = ? AND l.farm_id = ?`
+	const qReserve = `INSERT INTO stock_reservations (order_item_id, product_lot_id, quantity, created_at) VALUES (?, ?, ?, ?)`
+	const qTrace = `UPDATE order_items SET slaughter_id = ? WHERE order_item_id = ?`
+
+	var (
+		productID   int64
+		quantity    float64
+		slaughterID *int64
+		reserved    float64
+	)
+	if err := tx.QueryRowContext(ctx, qLine, lineID).Scan(&productID, &quantity, &slaughterID, &reserved); err != nil {
+		return err
+	}
+	need := quantity - reserved
+	if need <= 0 {
+		return nil
+	}
+
+	lots, err := listProductLots(ctx, tx, qLots, productID, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	allocations := domain.AllocateLots(need, lots, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	for _, allocation := range allocations {
+		if _, err := tx.ExecContext(ctx, qReserve, lineID, allocation.Lot.ProductLotID, allocation.Quantity, now); err != nil {
+			return err
+		}
+	}
+	if slaughterID == nil && len(allocations) > 0 {
+		_, err = tx.ExecContext(ctx, qTrace, allocations[0].Lot.SlaughterID, lineID)
+	}
+	return err
+}
+
+// releaseOrderStock drops the reservations of an order, returning the stock to the lots.
+func releaseOrderStock(ctx context.Context, tx *sql.Tx, orderID int64) error {
+	const q = `DELETE FROM stock_reservations WHERE order_item_id IN (SELECT order_item_id FROM order_items WHERE order_id = ?)`
+	_, err := tx.ExecContext(ctx, q, orderID)
+	return err
+}
+
+// queryIDs returns the single integer column of a query.
+func queryIDs(ctx context.Context, q queryer, query string, args ...any) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
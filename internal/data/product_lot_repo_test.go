@@ -0,0 +1,177 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestProductLotRepo_ReservesForConfirmedOrders(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+	lots := NewSQLiteProductLotRepo(db)
+
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (7, ?)`, []any{flockID}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (21, 7, CURRENT_DATE)`, nil},
+		{`INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher')`, nil},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "BR", Name: "Breast", Unit: "kg", Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+
+	today := time.Now()
+	useBy := today.AddDate(0, 0, 5)
+	firstLot, err := lots.Create(ctx, &domain.ProductLot{SlaughterID: 21, ProductID: productID, WeightKg: 6, PieceCount: 12, PackingDate: today, UseByDate: &useBy})
+	if err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	orderID, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+	if err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+	if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: orderID, ProductID: &productID, Quantity: f(10), UnitPrice: f(12)}); err != nil {
+		t.Fatalf("create line: %v", err)
+	}
+
+	reserved := func() float64 {
+		t.Helper()
+		items, err := lines.ListByOrder(ctx, orderID)
+		if err != nil || len(items) != 1 {
+			t.Fatalf("list lines: %v (%d)", err, len(items))
+		}
+		return items[0].Reserved
+	}
+
+	// Confirming reserves what there is; the order cannot be marked reserved while short.
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusConfirmed, nil); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if got := reserved(); got != 6 {
+		t.Fatalf("reserved after confirm = %v, want 6", got)
+	}
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusReserved, nil); err == nil {
+		t.Fatal("expected a short order not to be marked reserved")
+	}
+
+	// A new lot tops up the short line.
+	if _, err := lots.Create(ctx, &domain.ProductLot{SlaughterID: 21, ProductID: productID, WeightKg: 5, PieceCount: 10, PackingDate: today}); err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+	if got := reserved(); got != 10 {
+		t.Fatalf("reserved after new lot = %v, want 10", got)
+	}
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusReserved, nil); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := lots.SoftDelete(ctx, firstLot, time.Now()); !errors.Is(err, domain.ErrLotReserved) {
+		t.Fatalf("delete reserved lot err = %v, want ErrLotReserved", err)
+	}
+
+	all, err := lots.List(ctx)
+	if err != nil {
+		t.Fatalf("list lots: %v", err)
+	}
+	stock := domain.BuildSellableStock(all, today)
+	if len(stock) != 1 || stock[0].OnHand != 11 || stock[0].Reserved != 10 || stock[0].Available != 1 {
+		t.Fatalf("unexpected stock: %+v", stock)
+	}
+
+	// Cancelling returns the stock to the lots.
+	if err := orders.TransitionStatus(ctx, orderID, domain.OrderStatusCancelled, nil); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if got := reserved(); got != 0 {
+		t.Fatalf("reserved after cancel = %v, want 0", got)
+	}
+	if err := lots.SoftDelete(ctx, firstLot, time.Now()); err != nil {
+		t.Fatalf("delete released lot: %v", err)
+	}
+}
+
+func TestProductLotRepo_DeletingAnOrderReleasesItsStock(t *testing.T) {
+	ctx, db := openTestDB(t)
+	orders := NewSQLiteOrderRepo(db)
+	lines := NewSQLiteOrderItemRepo(db)
+	lots := NewSQLiteProductLotRepo(db)
+
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze"})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (7, ?)`, []any{flockID}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (21, 7, CURRENT_DATE)`, nil},
+		{`INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher')`, nil},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+	productID, err := NewSQLiteProductRepo(db).Create(ctx, &domain.Product{SKU: "BR", Name: "Breast", Unit: "kg", Active: true})
+	if err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	lotID, err := lots.Create(ctx, &domain.ProductLot{SlaughterID: 21, ProductID: productID, WeightKg: 6, PieceCount: 12, PackingDate: time.Now()})
+	if err != nil {
+		t.Fatalf("create lot: %v", err)
+	}
+
+	f := func(v float64) *float64 { return &v }
+	order := func(to ...domain.OrderStatus) int64 {
+		t.Helper()
+		id, err := orders.Create(ctx, &domain.Order{CustomerID: 1})
+		if err != nil {
+			t.Fatalf("create order: %v", err)
+		}
+		if _, err := lines.Create(ctx, &domain.OrderItem{OrderID: id, ProductID: &productID, Quantity: f(3), UnitPrice: f(12)}); err != nil {
+			t.Fatalf("create line: %v", err)
+		}
+		for _, status := range to {
+			if err := orders.TransitionStatus(ctx, id, status, nil); err != nil {
+				t.Fatalf("move order to %s: %v", status, err)
+			}
+		}
+		return id
+	}
+
+	delivered := order(domain.OrderStatusConfirmed, domain.OrderStatusReserved, domain.OrderStatusPicked, domain.OrderStatusDelivered)
+	if err := orders.SoftDelete(ctx, delivered, time.Now()); !errors.Is(err, domain.ErrOrderDelivered) {
+		t.Fatalf("delete delivered order err = %v, want ErrOrderDelivered", err)
+	}
+
+	confirmed := order(domain.OrderStatusConfirmed)
+	if err := orders.SoftDelete(ctx, confirmed, time.Now()); err != nil {
+		t.Fatalf("delete confirmed order: %v", err)
+	}
+	all, err := lots.List(ctx)
+	if err != nil {
+		t.Fatalf("list lots: %v", err)
+	}
+	if len(all) != 1 || all[0].ProductLotID != lotID || all[0].Committed != 3 {
+		t.Fatalf("lots after delete = %+v, want only the delivered order's 3 kg committed", all)
+	}
+	if err := orders.SoftDelete(ctx, confirmed, time.Now()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("delete deleted order err = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// ProductRepo defines operations for the product catalog.
+type ProductRepo interface {
+	// Count returns the number of non-deleted products.
+	Count(ctx context.Context) (int64, error)
+	// List returns all non-deleted products.
+	List(ctx context.Context) ([]*domain.Product, error)
+	// FindByID returns a product by ID (excluding soft-deleted).
+	FindByID(ctx context.Context, id int64) (*domain.Product, error)
+	// Create inserts a new product.
+	Create(ctx context.Context, product *domain.Product) (int64, error)
+	// Update modifies an existing product.
+	Update(ctx context.Context, product *domain.Product) error
+	// SoftDelete marks the product as deleted.
+	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+}
+
+type SQLiteProductRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteProductRepo(db *sql.DB) *SQLiteProductRepo {
+	return &SQLiteProductRepo{DB: db}
+}
+
+func (r *SQLiteProductRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM products WHERE deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (r *SQLiteProductRepo) List(ctx context.Context) ([]*domain.Product, error) {
+	const q = `
+		SELECT product_id, sku, name, unit, vat_rate, description, active,
+			   created_at, updated_at, deleted_at, created_by, updated_by
+		FROM products
+		WHERE deleted_at IS NULL
+		ORDER BY name
+	`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []*domain.Product
+	for rows.Next() {
+		var product domain.Product
+		err := rows.Scan(
+			&product.ProductID,
+			&product.SKU,
+			&product.Name,
+			&product.Unit,
+			&product.VATRate,
+			&product.Description,
+			&product.Active,
+			&product.Audit.CreatedAt,
+			&product.Audit.UpdatedAt,
+			&product.Audit.DeletedAt,
+			&product.Audit.CreatedBy,
+			&product.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+	return products, rows.Err()
+}
+
+func (r *SQLiteProductRepo) FindByID(ctx context.Context, id int64) (*domain.Product, error) {
+	const q = `
+		SELECT product_id, sku, name, unit, vat_rate, description, active,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
+		FROM products
+		WHERE product_id = ? AND deleted_at IS NULL
+	`
+	var product domain.Product
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id).Scan(
+		&product.ProductID,
+		&product.SKU,
+		&product.Name,
+		&product.Unit,
+		&product.VATRate,
+		&product.Description,
+		&product.Active,
+		&product.Audit.CreatedAt,
+		&product.Audit.UpdatedAt,
+		&product.Audit.DeletedAt,
+		&product.Audit.CreatedBy,
+		&product.Audit.UpdatedBy,
+		&product.Audit.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *SQLiteProductRepo) Create(ctx context.Context, product *domain.Product) (int64, error) {
+	const q = `
+		INSERT INTO products (sku, name, unit, vat_rate, description, active,
+							  created_at, updated_at, created_by, updated_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	now := time.Now()
+	product.Audit.CreatedAt = now
+	product.Audit.UpdatedAt = now
+	stampActor(ctx, &product.Audit)
+
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		product.SKU,
+		product.Name,
+		product.Unit,
+		product.VATRate,
+		product.Description,
+		boolToInt(product.Active),
+		product.Audit.CreatedAt,
+		product.Audit.UpdatedAt,
+		product.Audit.CreatedBy,
+		product.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "products", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteProductRepo) Update(ctx context.Context, product *domain.Product) error {
+	const q = `
+		UPDATE products
+		SET sku = ?, name = ?, unit = ?, vat_rate = ?, description = ?, active = ?,
+			updated_at = ?, updated_by = ?, version = version + 1
+		WHERE product_id = ? AND deleted_at IS NULL` + versionCheck
+	product.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &product.Audit)
+
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
+		product.SKU,
+		product.Name,
+		product.Unit,
+		product.VATRate,
+		product.Description,
+		boolToInt(product.Active),
+		product.Audit.UpdatedAt,
+		product.Audit.UpdatedBy,
+		product.ProductID,
+		product.Audit.Version,
+	).Scan(&product.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "products", "product_id", product.ProductID)
+	}
+	publish(ctx, r.Events, "products", product.ProductID, events.Updated)
+	return nil
+}
+
+func (r *SQLiteProductRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE products SET deleted_at = ? WHERE product_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id)
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "products", id, events.Deleted)
+	return nil
+}
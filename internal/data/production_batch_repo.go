@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // ProductionBatchRepo defines operations for productionbatch management.
@@ -19,7 +20,8 @@ type ProductionBatchRepo interface {
 }
 
 type SQLiteProductionBatchRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteProductionBatchRepo(db *sql.DB) *SQLiteProductionBatchRepo {
@@ -27,17 +29,17 @@ func NewSQLiteProductionBatchRepo(db *sql.DB) *SQLiteProductionBatchRepo {
 }
 
 func (r *SQLiteProductionBatchRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM production_batches WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM production_batches WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteProductionBatchRepo) List(ctx context.Context) ([]*domain.ProductionBatch, error) {
-	const q = `SELECT batch_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM production_batches WHERE deleted_at IS NULL ORDER BY batch_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT batch_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM production_batches WHERE farm_id = ? AND deleted_at IS NULL ORDER BY batch_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +70,9 @@ func (r *SQLiteProductionBatchRepo) List(ctx context.Context) ([]*domain.Product
 }
 
 func (r *SQLiteProductionBatchRepo) FindByID(ctx context.Context, id int64) (*domain.ProductionBatch, error) {
-	const q = `SELECT batch_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM production_batches WHERE batch_id = ? AND deleted_at IS NULL`
+	const q = `SELECT batch_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, deleted_at, created_by, updated_by, version FROM production_batches WHERE batch_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.ProductionBatch
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.BatchID,
 		&item.FlockID,
 		&item.DateReady,
@@ -82,6 +84,7 @@ func (r *SQLiteProductionBatchRepo) FindByID(ctx context.Context, id int64) (*do
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -90,12 +93,19 @@ func (r *SQLiteProductionBatchRepo) FindByID(ctx context.Context, id int64) (*do
 }
 
 func (r *SQLiteProductionBatchRepo) Create(ctx context.Context, p *domain.ProductionBatch) (int64, error) {
-	const q = `INSERT INTO production_batches (flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO production_batches (farm_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	p.Audit.CreatedAt = now
 	p.Audit.UpdatedAt = now
+	stampActor(ctx, &p.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &p.FlockID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		p.FlockID,
 		p.DateReady,
 		p.NumberInBatch,
@@ -109,14 +119,25 @@ func (r *SQLiteProductionBatchRepo) Create(ctx context.Context, p *domain.Produc
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "production_batches", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteProductionBatchRepo) Update(ctx context.Context, p *domain.ProductionBatch) error {
-	const q = `UPDATE production_batches SET flock_id = ?, date_ready = ?, number_in_batch = ?, weight_estimate = ?, notes = ?, updated_at = ?, updated_by = ? WHERE batch_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE production_batches SET flock_id = ?, date_ready = ?, number_in_batch = ?, weight_estimate = ?, notes = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE batch_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	p.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &p.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"flocks", "flock_id", &p.FlockID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		p.FlockID,
 		p.DateReady,
 		p.NumberInBatch,
@@ -125,12 +146,22 @@ func (r *SQLiteProductionBatchRepo) Update(ctx context.Context, p *domain.Produc
 		p.Audit.UpdatedAt,
 		p.Audit.UpdatedBy,
 		p.BatchID,
-	)
-	return err
+		FarmFrom(ctx),
+		p.Audit.Version,
+	).Scan(&p.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "production_batches", "batch_id", p.BatchID)
+	}
+	publish(ctx, r.Events, "production_batches", p.BatchID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteProductionBatchRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE production_batches SET deleted_at = ? WHERE batch_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE production_batches SET deleted_at = ? WHERE batch_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "production_batches", id, events.Deleted)
+	return nil
 }
@@ -0,0 +1,257 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// RosterRepo defines operations for shift templates and the shift roster. Templates and shifts
+// carry no version: they are only added and removed, and AssignShift checks a new shift against
+// the roster inside its own transaction, so two planners cannot double-book a staff member.
+type RosterRepo interface {
+	// Count returns the number of rostered shifts.
+	Count(ctx context.Context) (int64, error)
+	ListTemplates(ctx context.Context) ([]*domain.ShiftTemplate, error)
+	FindTemplate(ctx context.Context, id int64) (*domain.ShiftTemplate, error)
+	CreateTemplate(ctx context.Context, t *domain.ShiftTemplate) (int64, error)
+	DeleteTemplate(ctx context.Context, id int64, deletedAt time.Time) error
+	// ListShifts returns the shifts on the days from from up to to, by start time; a staffID
+	// narrows them to one staff member.
+	ListShifts(ctx context.Context, from, to time.Time, staffID *int64) ([]*domain.Shift, error)
+	// AssignShift rosters a shift after checking it against the staff member's shifts around it;
+	// conflicts come back as *domain.ShiftConflictError.
+	AssignShift(ctx context.Context, s *domain.Shift, minRest time.Duration) (int64, error)
+	DeleteShift(ctx context.Context, id int64, deletedAt time.Time) error
+}
+
+type SQLiteRosterRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteRosterRepo(db *sql.DB) *SQLiteRosterRepo {
+	return &SQLiteRosterRepo{DB: db}
+}
+
+func (r *SQLiteRosterRepo) Count(ctx context.Context) (int64, error) {
+	const q = `SELECT COUNT(1) FROM shifts WHERE farm_id = ? AND deleted_at IS NULL`
+	var n int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// shiftTemplateColumns lists the columns scanShiftTemplate reads.
+const shiftTemplateColumns = `t.shift_template_id, t.name, t.start_time, t.end_time, t.barn_id, t.notes,
+	t.created_at, t.updated_at, t.deleted_at, t.created_by, t.updated_by, b.name`
+
+func (r *SQLiteRosterRepo) ListTemplates(ctx context.Context) ([]*domain.ShiftTemplate, error) {
+	const q = `SELECT ` + shiftTemplateColumns + `
+		FROM shift_templates t
+		LEFT JOIN barns b ON b.barn_id = t.barn_id
+		WHERE t.farm_id = ? AND t.deleted_at IS NULL
+		ORDER BY t.start_time, t.name`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.ShiftTemplate
+	for rows.Next() {
+		item, err := scanShiftTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteRosterRepo) FindTemplate(ctx context.Context, id int64) (*domain.ShiftTemplate, error) {
+	const q = `SELECT ` + shiftTemplateColumns + `
+		FROM shift_templates t
+		LEFT JOIN barns b ON b.barn_id = t.barn_id
+		WHERE t.shift_template_id = ? AND t.farm_id = ? AND t.deleted_at IS NULL`
+	return scanShiftTemplate(conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)))
+}
+
+func (r *SQLiteRosterRepo) CreateTemplate(ctx context.Context, t *domain.ShiftTemplate) (int64, error) {
+	const q = `INSERT INTO shift_templates (farm_id, name, start_time, end_time, barn_id, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	t.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &t.Audit)
+
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
+		t.Name,
+		t.StartTime,
+		t.EndTime,
+		t.BarnID,
+		t.Notes,
+		t.Audit.CreatedAt,
+		t.Audit.UpdatedAt,
+		t.Audit.CreatedBy,
+		t.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "shift_templates", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteRosterRepo) DeleteTemplate(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE shift_templates SET deleted_at = ? WHERE shift_template_id = ? AND farm_id = ?`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx)); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "shift_templates", id, events.Deleted)
+	return nil
+}
+
+// shiftColumns lists the columns scanShift reads.
+const shiftColumns = `s.shift_id, s.shift_template_id, s.staff_id, s.barn_id, s.shift_date, s.starts_at, s.ends_at, s.notes,
+	s.created_at, s.updated_at, s.deleted_at, s.created_by, s.updated_by,
+	t.name, st.name, b.name`
+
+// shiftJoins joins the template, staff member and barn of a shift.
+const shiftJoins = `FROM shifts s
+	JOIN shift_templates t ON t.shift_template_id = s.shift_template_id
+	JOIN staff st ON st.staff_id = s.staff_id
+	LEFT JOIN barns b ON b.barn_id = s.barn_id`
+
+func (r *SQLiteRosterRepo) ListShifts(ctx context.Context, from, to time.Time, staffID *int64) ([]*domain.Shift, error) {
+	q := `SELECT ` + shiftColumns + ` ` + shiftJoins + `
+		WHERE s.farm_id = ? AND s.deleted_at IS NULL AND s.shift_date >= ? AND s.shift_date < ?`
+	args := []any{FarmFrom(ctx), from, to}
+	if staffID != nil {
+		q += ` AND s.staff_id = ?`
+		args = append(args, *staffID)
+	}
+	q += ` ORDER BY s.starts_at, st.name`
+	return listShifts(ctx, conn(ctx, r.DB), q, args...)
+}
+
+func (r *SQLiteRosterRepo) AssignShift(ctx context.Context, s *domain.Shift, minRest time.Duration) (int64, error) {
+	const qAround = `SELECT ` + shiftColumns + ` ` + shiftJoins + `
+		WHERE s.deleted_at IS NULL AND s.staff_id = ? AND s.shift_date >= ? AND s.shift_date <= ?`
+	const q = `INSERT INTO shifts (farm_id, shift_template_id, staff_id, barn_id, shift_date, starts_at, ends_at, notes, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	s.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &s.Audit)
+
+	var id int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		if err := onFarm(ctx, tx, "staff", "staff_id", s.StaffID); err != nil {
+			return err
+		}
+		// Shifts ending the next day and the rest after them reach at most two days either side.
+		around, err := listShifts(ctx, tx, qAround, s.StaffID, s.ShiftDate.AddDate(0, 0, -2), s.ShiftDate.AddDate(0, 0, 2))
+		if err != nil {
+			return err
+		}
+		if err := domain.CheckShift(s, around, minRest); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, q,
+			FarmFrom(ctx),
+			s.ShiftTemplateID,
+			s.StaffID,
+			s.BarnID,
+			s.ShiftDate,
+			s.StartsAt,
+			s.EndsAt,
+			s.Notes,
+			s.Audit.CreatedAt,
+			s.Audit.UpdatedAt,
+			s.Audit.CreatedBy,
+			s.Audit.UpdatedBy,
+		)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "shifts", id, events.Created)
+	return id, nil
+}
+
+func (r *SQLiteRosterRepo) DeleteShift(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE shifts SET deleted_at = ? WHERE shift_id = ? AND farm_id = ?`
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx)); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "shifts", id, events.Deleted)
+	return nil
+}
+
+func listShifts(ctx context.Context, db queryer, q string, args ...any) ([]*domain.Shift, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.Shift
+	for rows.Next() {
+		var item domain.Shift
+		err := rows.Scan(
+			&item.ShiftID,
+			&item.ShiftTemplateID,
+			&item.StaffID,
+			&item.BarnID,
+			&item.ShiftDate,
+			&item.StartsAt,
+			&item.EndsAt,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.TemplateName,
+			&item.StaffName,
+			&item.BarnName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+// scanShiftTemplate reads one row of shiftTemplateColumns.
+func scanShiftTemplate(row interface{ Scan(...any) error }) (*domain.ShiftTemplate, error) {
+	var item domain.ShiftTemplate
+	err := row.Scan(
+		&item.ShiftTemplateID,
+		&item.Name,
+		&item.StartTime,
+		&item.EndTime,
+		&item.BarnID,
+		&item.Notes,
+		&item.Audit.CreatedAt,
+		&item.Audit.UpdatedAt,
+		&item.Audit.DeletedAt,
+		&item.Audit.CreatedBy,
+		&item.Audit.UpdatedBy,
+		&item.BarnName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
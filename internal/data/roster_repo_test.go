@@ -0,0 +1,93 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestRosterRepo_AssignShiftChecksConflicts(t *testing.T) {
+	ctx, db := openTestDB(t)
+	staffRepo := NewSQLiteStaffRepo(db)
+	roster := NewSQLiteRosterRepo(db)
+
+	anaID, err := staffRepo.Create(ctx, &domain.Staff{Name: "Ana"})
+	if err != nil {
+		t.Fatalf("create staff: %v", err)
+	}
+	bogdanID, err := staffRepo.Create(ctx, &domain.Staff{Name: "Bogdan"})
+	if err != nil {
+		t.Fatalf("create staff: %v", err)
+	}
+	evening := &domain.ShiftTemplate{Name: "Evening check", StartTime: "18:00", EndTime: "23:00"}
+	if evening.ShiftTemplateID, err = roster.CreateTemplate(ctx, evening); err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	morning := &domain.ShiftTemplate{Name: "Morning feed round", StartTime: "06:00", EndTime: "09:00"}
+	if morning.ShiftTemplateID, err = roster.CreateTemplate(ctx, morning); err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	assign := func(tmpl *domain.ShiftTemplate, staffID int64, day time.Time) error {
+		t.Helper()
+		start, end, err := tmpl.Span(day)
+		if err != nil {
+			t.Fatalf("span: %v", err)
+		}
+		_, err = roster.AssignShift(ctx, &domain.Shift{
+			ShiftTemplateID: tmpl.ShiftTemplateID,
+			StaffID:         staffID,
+			ShiftDate:       day,
+			StartsAt:        start,
+			EndsAt:          end,
+		}, domain.MinRestBetweenShifts)
+		return err
+	}
+
+	if err := assign(evening, anaID, day); err != nil {
+		t.Fatalf("assign evening: %v", err)
+	}
+	if err := assign(evening, anaID, day); !errors.Is(err, domain.ErrShiftOverlap) {
+		t.Errorf("double booking: err = %v, want ErrShiftOverlap", err)
+	}
+	// 23:00 to 06:00 leaves only seven hours of rest.
+	if err := assign(morning, anaID, day.AddDate(0, 0, 1)); !errors.Is(err, domain.ErrShiftRestTooShort) {
+		t.Errorf("short rest: err = %v, want ErrShiftRestTooShort", err)
+	}
+	var conflict *domain.ShiftConflictError
+	if err := assign(morning, anaID, day.AddDate(0, 0, 1)); !errors.As(err, &conflict) || conflict.With == nil || conflict.With.TemplateName != "Evening check" {
+		t.Errorf("conflict = %+v, want one naming the evening check", conflict)
+	}
+	if err := assign(morning, bogdanID, day.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("another staff member: %v", err)
+	}
+	if err := assign(morning, anaID, day.AddDate(0, 0, 2)); err != nil {
+		t.Errorf("after a full rest: %v", err)
+	}
+
+	shifts, err := roster.ListShifts(ctx, day, day.AddDate(0, 0, 7), nil)
+	if err != nil {
+		t.Fatalf("list shifts: %v", err)
+	}
+	if len(shifts) != 3 {
+		t.Fatalf("shifts = %d, want 3", len(shifts))
+	}
+	anas, err := roster.ListShifts(ctx, day, day.AddDate(0, 0, 7), &anaID)
+	if err != nil {
+		t.Fatalf("list staff shifts: %v", err)
+	}
+	if len(anas) != 2 || anas[0].StaffName != "Ana" || anas[0].TemplateName != "Evening check" {
+		t.Fatalf("Ana's shifts = %+v", anas)
+	}
+
+	// A removed shift no longer blocks the roster.
+	if err := roster.DeleteShift(ctx, anas[0].ShiftID, time.Now()); err != nil {
+		t.Fatalf("delete shift: %v", err)
+	}
+	if err := assign(morning, anaID, day.AddDate(0, 0, 1)); err != nil {
+		t.Errorf("after removing the evening check: %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // SlaughterRecordRepo defines operations for slaughterrecord management.
@@ -19,7 +20,8 @@ type SlaughterRecordRepo interface {
 }
 
 type SQLiteSlaughterRecordRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteSlaughterRecordRepo(db *sql.DB) *SQLiteSlaughterRecordRepo {
@@ -27,17 +29,17 @@ func NewSQLiteSlaughterRecordRepo(db *sql.DB) *SQLiteSlaughterRecordRepo {
 }
 
 func (r *SQLiteSlaughterRecordRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM slaughter_records WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM slaughter_records WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 func (r *SQLiteSlaughterRecordRepo) List(ctx context.Context) ([]*domain.SlaughterRecord, error) {
-	const q = `SELECT slaughter_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM slaughter_records WHERE deleted_at IS NULL ORDER BY slaughter_id`
-	rows, err := r.DB.QueryContext(ctx, q)
+	const q = `SELECT slaughter_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM slaughter_records WHERE farm_id = ? AND deleted_at IS NULL ORDER BY slaughter_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -69,9 +71,9 @@ func (r *SQLiteSlaughterRecordRepo) List(ctx context.Context) ([]*domain.Slaught
 }
 
 func (r *SQLiteSlaughterRecordRepo) FindByID(ctx context.Context, id int64) (*domain.SlaughterRecord, error) {
-	const q = `SELECT slaughter_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, deleted_at, created_by, updated_by FROM slaughter_records WHERE slaughter_id = ? AND deleted_at IS NULL`
+	const q = `SELECT slaughter_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, deleted_at, created_by, updated_by, version FROM slaughter_records WHERE slaughter_id = ? AND farm_id = ? AND deleted_at IS NULL`
 	var item domain.SlaughterRecord
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)).Scan(
 		&item.SlaughterID,
 		&item.BatchID,
 		&item.Date,
@@ -84,6 +86,7 @@ func (r *SQLiteSlaughterRecordRepo) FindByID(ctx context.Context, id int64) (*do
 		&item.Audit.DeletedAt,
 		&item.Audit.CreatedBy,
 		&item.Audit.UpdatedBy,
+		&item.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -92,12 +95,19 @@ func (r *SQLiteSlaughterRecordRepo) FindByID(ctx context.Context, id int64) (*do
 }
 
 func (r *SQLiteSlaughterRecordRepo) Create(ctx context.Context, s *domain.SlaughterRecord) (int64, error) {
-	const q = `INSERT INTO slaughter_records (batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	const q = `INSERT INTO slaughter_records (farm_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	now := time.Now()
 	s.Audit.CreatedAt = now
 	s.Audit.UpdatedAt = now
+	stampActor(ctx, &s.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"production_batches", "batch_id", &s.BatchID},
+	); err != nil {
+		return 0, err
+	}
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		s.BatchID,
 		s.Date,
 		s.NumberSlaughtered,
@@ -112,14 +122,25 @@ func (r *SQLiteSlaughterRecordRepo) Create(ctx context.Context, s *domain.Slaugh
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "slaughter_records", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteSlaughterRecordRepo) Update(ctx context.Context, s *domain.SlaughterRecord) error {
-	const q = `UPDATE slaughter_records SET batch_id = ?, date = ?, number_slaughtered = ?, meat_yield = ?, waste = ?, staff_id = ?, updated_at = ?, updated_by = ? WHERE slaughter_id = ? AND deleted_at IS NULL`
+	const q = `UPDATE slaughter_records SET batch_id = ?, date = ?, number_slaughtered = ?, meat_yield = ?, waste = ?, staff_id = ?, updated_at = ?, updated_by = ?, version = version + 1 WHERE slaughter_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	s.Audit.UpdatedAt = time.Now()
+	stampActor(ctx, &s.Audit)
+	if err := refsOnFarm(ctx, conn(ctx, r.DB),
+		farmRef{"production_batches", "batch_id", &s.BatchID},
+	); err != nil {
+		return err
+	}
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		s.BatchID,
 		s.Date,
 		s.NumberSlaughtered,
@@ -129,12 +150,22 @@ func (r *SQLiteSlaughterRecordRepo) Update(ctx context.Context, s *domain.Slaugh
 		s.Audit.UpdatedAt,
 		s.Audit.UpdatedBy,
 		s.SlaughterID,
-	)
-	return err
+		FarmFrom(ctx),
+		s.Audit.Version,
+	).Scan(&s.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "slaughter_records", "slaughter_id", s.SlaughterID)
+	}
+	publish(ctx, r.Events, "slaughter_records", s.SlaughterID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteSlaughterRecordRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE slaughter_records SET deleted_at = ? WHERE slaughter_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
-	return err
+	const q = `UPDATE slaughter_records SET deleted_at = ? WHERE slaughter_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "slaughter_records", id, events.Deleted)
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 // StaffRepo defines operations for staff management.
@@ -16,10 +17,17 @@ type StaffRepo interface {
 	Create(ctx context.Context, staff *domain.Staff) (int64, error)
 	Update(ctx context.Context, staff *domain.Staff) error
 	SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error
+	// SetCalendarToken sets the secret token of a staff member's roster feed; a new token
+	// stops the old feed URL working. It takes no version: the token is not part of the staff
+	// form, so Update never overwrites it, and of two regenerations the later one rightly wins.
+	SetCalendarToken(ctx context.Context, id int64, token string) error
+	// FindByCalendarToken returns the staff member whose roster feed uses token.
+	FindByCalendarToken(ctx context.Context, token string) (*domain.Staff, error)
 }
 
 type SQLiteStaffRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteStaffRepo(db *sql.DB) *SQLiteStaffRepo {
@@ -27,9 +35,9 @@ func NewSQLiteStaffRepo(db *sql.DB) *SQLiteStaffRepo {
 }
 
 func (r *SQLiteStaffRepo) Count(ctx context.Context) (int64, error) {
-	const q = `SELECT COUNT(1) FROM staff WHERE deleted_at IS NULL`
+	const q = `SELECT COUNT(1) FROM staff WHERE farm_id = ? AND deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, FarmFrom(ctx)).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -37,13 +45,13 @@ func (r *SQLiteStaffRepo) Count(ctx context.Context) (int64, error) {
 
 func (r *SQLiteStaffRepo) List(ctx context.Context) ([]*domain.Staff, error) {
 	const q = `
-		SELECT staff_id, name, role, schedule, contact_info,
+		SELECT staff_id, farm_id, name, role, schedule, contact_info, hourly_rate, calendar_token,
 			   created_at, updated_at, deleted_at, created_by, updated_by
 		FROM staff
-		WHERE deleted_at IS NULL
+		WHERE farm_id = ? AND deleted_at IS NULL
 		ORDER BY name
 	`
-	rows, err := r.DB.QueryContext(ctx, q)
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, FarmFrom(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -54,10 +62,13 @@ func (r *SQLiteStaffRepo) List(ctx context.Context) ([]*domain.Staff, error) {
 		var s domain.Staff
 		err := rows.Scan(
 			&s.StaffID,
+			&s.FarmID,
 			&s.Name,
 			&s.Role,
 			&s.Schedule,
 			&s.ContactInfo,
+			&s.HourlyRate,
+			&s.CalendarToken,
 			&s.Audit.CreatedAt,
 			&s.Audit.UpdatedAt,
 			&s.Audit.DeletedAt,
@@ -74,23 +85,41 @@ func (r *SQLiteStaffRepo) List(ctx context.Context) ([]*domain.Staff, error) {
 
 func (r *SQLiteStaffRepo) FindByID(ctx context.Context, id int64) (*domain.Staff, error) {
 	const q = `
-		SELECT staff_id, name, role, schedule, contact_info,
-			   created_at, updated_at, deleted_at, created_by, updated_by
+		SELECT staff_id, farm_id, name, role, schedule, contact_info, hourly_rate, calendar_token,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
+		FROM staff
+		WHERE staff_id = ? AND farm_id = ? AND deleted_at IS NULL
+	`
+	return scanStaff(conn(ctx, r.DB).QueryRowContext(ctx, q, id, FarmFrom(ctx)))
+}
+
+func (r *SQLiteStaffRepo) FindByCalendarToken(ctx context.Context, token string) (*domain.Staff, error) {
+	const q = `
+		SELECT staff_id, farm_id, name, role, schedule, contact_info, hourly_rate, calendar_token,
+			   created_at, updated_at, deleted_at, created_by, updated_by, version
 		FROM staff
-		WHERE staff_id = ? AND deleted_at IS NULL
+		WHERE calendar_token = ? AND deleted_at IS NULL
 	`
+	return scanStaff(conn(ctx, r.DB).QueryRowContext(ctx, q, token))
+}
+
+func scanStaff(row *sql.Row) (*domain.Staff, error) {
 	var staff domain.Staff
-	err := r.DB.QueryRowContext(ctx, q, id).Scan(
+	err := row.Scan(
 		&staff.StaffID,
+		&staff.FarmID,
 		&staff.Name,
 		&staff.Role,
 		&staff.Schedule,
 		&staff.ContactInfo,
+		&staff.HourlyRate,
+		&staff.CalendarToken,
 		&staff.Audit.CreatedAt,
 		&staff.Audit.UpdatedAt,
 		&staff.Audit.DeletedAt,
 		&staff.Audit.CreatedBy,
 		&staff.Audit.UpdatedBy,
+		&staff.Audit.Version,
 	)
 	if err != nil {
 		return nil, err
@@ -100,19 +129,22 @@ func (r *SQLiteStaffRepo) FindByID(ctx context.Context, id int64) (*domain.Staff
 
 func (r *SQLiteStaffRepo) Create(ctx context.Context, staff *domain.Staff) (int64, error) {
 	const q = `
-		INSERT INTO staff (name, role, schedule, contact_info,
+		INSERT INTO staff (farm_id, name, role, schedule, contact_info, hourly_rate,
 						   created_at, updated_at, created_by, updated_by)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	now := time.Now()
 	staff.Audit.CreatedAt = now
 	staff.Audit.UpdatedAt = now
+	stampActor(ctx, &staff.Audit)
 
-	result, err := r.DB.ExecContext(ctx, q,
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
 		staff.Name,
 		staff.Role,
 		staff.Schedule,
 		staff.ContactInfo,
+		staff.HourlyRate,
 		staff.Audit.CreatedAt,
 		staff.Audit.UpdatedAt,
 		staff.Audit.CreatedBy,
@@ -121,33 +153,55 @@ func (r *SQLiteStaffRepo) Create(ctx context.Context, staff *domain.Staff) (int6
 	if err != nil {
 		return 0, err
 	}
-	return result.LastInsertId()
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	publish(ctx, r.Events, "staff", id, events.Created)
+	return id, nil
 }
 
 func (r *SQLiteStaffRepo) Update(ctx context.Context, staff *domain.Staff) error {
 	const q = `
 		UPDATE staff
-		SET name = ?, role = ?, schedule = ?, contact_info = ?,
-			updated_at = ?, updated_by = ?
-		WHERE staff_id = ? AND deleted_at IS NULL
-	`
+		SET name = ?, role = ?, schedule = ?, contact_info = ?, hourly_rate = ?,
+			updated_at = ?, updated_by = ?, version = version + 1
+		WHERE staff_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
 	now := time.Now()
 	staff.Audit.UpdatedAt = now
+	stampActor(ctx, &staff.Audit)
 
-	_, err := r.DB.ExecContext(ctx, q,
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q,
 		staff.Name,
 		staff.Role,
 		staff.Schedule,
 		staff.ContactInfo,
+		staff.HourlyRate,
 		staff.Audit.UpdatedAt,
 		staff.Audit.UpdatedBy,
 		staff.StaffID,
-	)
-	return err
+		FarmFrom(ctx),
+		staff.Audit.Version,
+	).Scan(&staff.Audit.Version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "staff", "staff_id", staff.StaffID)
+	}
+	publish(ctx, r.Events, "staff", staff.StaffID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteStaffRepo) SoftDelete(ctx context.Context, id int64, deletedAt time.Time) error {
-	const q = `UPDATE staff SET deleted_at = ? WHERE staff_id = ?`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt, id)
+	const q = `UPDATE staff SET deleted_at = ? WHERE staff_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	if err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "staff", id, events.Deleted)
+	return nil
+}
+
+func (r *SQLiteStaffRepo) SetCalendarToken(ctx context.Context, id int64, token string) error {
+	const q = `UPDATE staff SET calendar_token = ?, updated_at = ? WHERE staff_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, token, time.Now(), id, FarmFrom(ctx))
 	return err
 }
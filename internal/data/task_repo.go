@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// TaskRepo defines operations for recurring barn task templates and the daily checklists
+// generated from them.
+type TaskRepo interface {
+	ListTemplates(ctx context.Context) ([]*domain.TaskTemplate, error)
+	CreateTemplate(ctx context.Context, t *domain.TaskTemplate) (int64, error)
+	// SetTemplateActive pauses or resumes a template at version; paused templates put no new
+	// tasks on the checklists.
+	SetTemplateActive(ctx context.Context, id int64, active bool, version int64) error
+	DeleteTemplate(ctx context.Context, id int64, deletedAt time.Time) error
+	// Generate puts the tasks of the active templates on the checklists of the days from from
+	// through to. Days already generated are left alone, so it is safe to call repeatedly.
+	Generate(ctx context.Context, from, to time.Time) error
+	// ListForDay returns the tasks on the checklists of day with barn and staff names.
+	ListForDay(ctx context.Context, day time.Time) ([]*domain.Task, error)
+	// ListOpen returns the open tasks up to and including day, oldest first.
+	ListOpen(ctx context.Context, day time.Time) ([]*domain.Task, error)
+	FindByID(ctx context.Context, id int64) (*domain.Task, error)
+	// The task changes below apply to the task at version and return ErrConflict when it has
+	// changed since, for instance when someone else already ticked it off.
+
+	// Assign hands a task to a staff member, or to nobody when staffID is nil.
+	Assign(ctx context.Context, id int64, staffID *int64, version int64) error
+	// Complete marks an open task done, with the record that completed it for mortality,
+	// feeding and health check tasks.
+	Complete(ctx context.Context, id int64, recordID *int64, version int64, at time.Time) error
+	// Skip marks an open task as not needed today.
+	Skip(ctx context.Context, id int64, version int64, at time.Time) error
+	// Reopen puts a done or skipped task back on the checklist, unlinking its record.
+	Reopen(ctx context.Context, id int64, version int64) error
+}
+
+type SQLiteTaskRepo struct {
+	DB     *sql.DB
+	Events events.Publisher
+}
+
+func NewSQLiteTaskRepo(db *sql.DB) *SQLiteTaskRepo {
+	return &SQLiteTaskRepo{DB: db}
+}
+
+// taskTemplateColumns lists the columns scanTaskTemplate reads.
+const taskTemplateColumns = `t.task_template_id, t.name, t.kind, t.barn_id, t.flock_id, t.staff_id, t.weekdays, t.due_time,
+	t.notes, t.active, t.created_at, t.updated_at, t.deleted_at, t.created_by, t.updated_by, t.version,
+	b.name, f.breed, st.name`
+
+// taskTemplateJoins joins the barn, flock and default assignee of a template.
+const taskTemplateJoins = `FROM task_templates t
+	JOIN barns b ON b.barn_id = t.barn_id
+	LEFT JOIN flocks f ON f.flock_id = t.flock_id
+	LEFT JOIN staff st ON st.staff_id = t.staff_id`
+
+func (r *SQLiteTaskRepo) ListTemplates(ctx context.Context) ([]*domain.TaskTemplate, error) {
+	const q = `SELECT ` + taskTemplateColumns + ` ` + taskTemplateJoins + `
+		WHERE t.farm_id = ? AND t.deleted_at IS NULL
+		ORDER BY b.name, t.due_time, t.name`
+	return listTaskTemplates(ctx, conn(ctx, r.DB), q, FarmFrom(ctx))
+}
+
+func (r *SQLiteTaskRepo) CreateTemplate(ctx context.Context, t *domain.TaskTemplate) (int64, error) {
+	const q = `INSERT INTO task_templates (farm_id, name, kind, barn_id, flock_id, staff_id, weekdays, due_time, notes, active, created_at, updated_at, created_by, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	t.Audit.TouchCreated(time.Now())
+	stampActor(ctx, &t.Audit)
+
+	result, err := conn(ctx, r.DB).ExecContext(ctx, q,
+		FarmFrom(ctx),
+		t.Name,
+		t.Kind,
+		t.BarnID,
+		t.FlockID,
+		t.StaffID,
+		t.Weekdays,
+		t.DueTime,
+		t.Notes,
+		t.Active,
+		t.Audit.CreatedAt,
+		t.Audit.UpdatedAt,
+		t.Audit.CreatedBy,
+		t.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (r *SQLiteTaskRepo) SetTemplateActive(ctx context.Context, id int64, active bool, version int64) error {
+	const q = `UPDATE task_templates SET active = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE task_template_id = ? AND farm_id = ? AND deleted_at IS NULL` + versionCheck
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, active, time.Now(), actorID(ctx), id, FarmFrom(ctx), version).Scan(&version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "task_templates", "task_template_id", id)
+	}
+	return nil
+}
+
+func (r *SQLiteTaskRepo) DeleteTemplate(ctx context.Context, id int64, deletedAt time.Time) error {
+	const q = `UPDATE task_templates SET deleted_at = ? WHERE task_template_id = ? AND farm_id = ?`
+	_, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt, id, FarmFrom(ctx))
+	return err
+}
+
+func (r *SQLiteTaskRepo) Generate(ctx context.Context, from, to time.Time) error {
+	const qTemplates = `SELECT ` + taskTemplateColumns + ` ` + taskTemplateJoins + `
+		WHERE t.farm_id = ? AND t.deleted_at IS NULL AND t.active = 1`
+	// The unique (task_template_id, task_date) index skips days already generated, including
+	// tasks deleted since.
+	const q = `INSERT OR IGNORE INTO tasks (farm_id, task_template_id, name, kind, barn_id, flock_id, staff_id, task_date, due_time, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	var generated int64
+	err := withTx(ctx, r.DB, func(tx *sql.Tx) error {
+		templates, err := listTaskTemplates(ctx, tx, qTemplates, FarmFrom(ctx))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+			for _, tmpl := range templates {
+				if !tmpl.DueOn(day) {
+					continue
+				}
+				task := tmpl.NewTask(day)
+				result, err := tx.ExecContext(ctx, q,
+					FarmFrom(ctx),
+					task.TaskTemplateID,
+					task.Name,
+					task.Kind,
+					task.BarnID,
+					task.FlockID,
+					task.StaffID,
+					task.TaskDate,
+					task.DueTime,
+					task.Status,
+					now,
+					now,
+				)
+				if err != nil {
+					return err
+				}
+				n, err := result.RowsAffected()
+				if err != nil {
+					return err
+				}
+				generated += n
+			}
+		}
+		return nil
+	})
+	// Checklists are generated whenever they are looked at, so only new tasks are news.
+	if err == nil && generated > 0 {
+		publish(ctx, r.Events, "tasks", 0, events.Created)
+	}
+	return err
+}
+
+// taskColumns lists the columns scanTask reads.
+const taskColumns = `k.task_id, k.task_template_id, k.name, k.kind, k.barn_id, k.flock_id, k.staff_id, k.task_date, k.due_time,
+	k.status, k.completed_at, k.completed_by, k.record_id, k.notes,
+	k.created_at, k.updated_at, k.deleted_at, k.created_by, k.updated_by, k.version,
+	b.name, st.name`
+
+// taskJoins joins the barn and assignee of a task.
+const taskJoins = `FROM tasks k
+	JOIN barns b ON b.barn_id = k.barn_id
+	LEFT JOIN staff st ON st.staff_id = k.staff_id`
+
+func (r *SQLiteTaskRepo) ListForDay(ctx context.Context, day time.Time) ([]*domain.Task, error) {
+	const q = `SELECT ` + taskColumns + ` ` + taskJoins + `
+		WHERE k.farm_id = ? AND k.deleted_at IS NULL AND k.task_date = ?
+		ORDER BY b.name, k.due_time, k.name`
+	return listTasks(ctx, conn(ctx, r.DB), q, FarmFrom(ctx), day)
+}
+
+func (r *SQLiteTaskRepo) ListOpen(ctx context.Context, day time.Time) ([]*domain.Task, error) {
+	const q = `SELECT ` + taskColumns + ` ` + taskJoins + `
+		WHERE k.farm_id = ? AND k.deleted_at IS NULL AND k.status = 'open' AND k.task_date <= ?
+		ORDER BY k.task_date, k.due_time, b.name`
+	return listTasks(ctx, conn(ctx, r.DB), q, FarmFrom(ctx), day)
+}
+
+func (r *SQLiteTaskRepo) FindByID(ctx context.Context, id int64) (*domain.Task, error) {
+	const q = `SELECT ` + taskColumns + ` ` + taskJoins + `
+		WHERE k.task_id = ? AND k.farm_id = ? AND k.deleted_at IS NULL`
+	tasks, err := listTasks(ctx, conn(ctx, r.DB), q, id, FarmFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, ErrNotFound
+	}
+	return tasks[0], nil
+}
+
+func (r *SQLiteTaskRepo) Assign(ctx context.Context, id int64, staffID *int64, version int64) error {
+	const q = `UPDATE tasks SET staff_id = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE task_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	return r.update(ctx, id, version, q, staffID, time.Now(), actorID(ctx))
+}
+
+func (r *SQLiteTaskRepo) Complete(ctx context.Context, id int64, recordID *int64, version int64, at time.Time) error {
+	const q = `UPDATE tasks SET status = 'done', record_id = ?, completed_at = ?, completed_by = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE task_id = ? AND farm_id = ? AND status = 'open' AND deleted_at IS NULL`
+	by := actorID(ctx)
+	return r.update(ctx, id, version, q, recordID, at, by, at, by)
+}
+
+func (r *SQLiteTaskRepo) Skip(ctx context.Context, id int64, version int64, at time.Time) error {
+	const q = `UPDATE tasks SET status = 'skipped', completed_at = ?, completed_by = ?, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE task_id = ? AND farm_id = ? AND status = 'open' AND deleted_at IS NULL`
+	by := actorID(ctx)
+	return r.update(ctx, id, version, q, at, by, at, by)
+}
+
+func (r *SQLiteTaskRepo) Reopen(ctx context.Context, id int64, version int64) error {
+	const q = `UPDATE tasks SET status = 'open', record_id = NULL, completed_at = NULL, completed_by = NULL, updated_at = ?, updated_by = ?, version = version + 1
+		WHERE task_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	return r.update(ctx, id, version, q, time.Now(), actorID(ctx))
+}
+
+// update runs a single-task update whose last placeholders are the task id and the farm, checked
+// against the version the task was loaded at. It returns ErrConflict when the task has changed
+// since and ErrNotFound when no task of the context's farm matched.
+func (r *SQLiteTaskRepo) update(ctx context.Context, id, version int64, q string, args ...any) error {
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q+versionCheck, append(args, id, FarmFrom(ctx), version)...).Scan(&version)
+	if err != nil {
+		return versionError(ctx, conn(ctx, r.DB), err, "tasks", "task_id", id)
+	}
+	publish(ctx, r.Events, "tasks", id, events.Updated)
+	return nil
+}
+
+func listTaskTemplates(ctx context.Context, db queryer, q string, args ...any) ([]*domain.TaskTemplate, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.TaskTemplate
+	for rows.Next() {
+		var item domain.TaskTemplate
+		err := rows.Scan(
+			&item.TaskTemplateID,
+			&item.Name,
+			&item.Kind,
+			&item.BarnID,
+			&item.FlockID,
+			&item.StaffID,
+			&item.Weekdays,
+			&item.DueTime,
+			&item.Notes,
+			&item.Active,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.Audit.Version,
+			&item.BarnName,
+			&item.FlockBreed,
+			&item.StaffName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func listTasks(ctx context.Context, db queryer, q string, args ...any) ([]*domain.Task, error) {
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.Task
+	for rows.Next() {
+		var item domain.Task
+		err := rows.Scan(
+			&item.TaskID,
+			&item.TaskTemplateID,
+			&item.Name,
+			&item.Kind,
+			&item.BarnID,
+			&item.FlockID,
+			&item.StaffID,
+			&item.TaskDate,
+			&item.DueTime,
+			&item.Status,
+			&item.CompletedAt,
+			&item.CompletedBy,
+			&item.RecordID,
+			&item.Notes,
+			&item.Audit.CreatedAt,
+			&item.Audit.UpdatedAt,
+			&item.Audit.DeletedAt,
+			&item.Audit.CreatedBy,
+			&item.Audit.UpdatedBy,
+			&item.Audit.Version,
+			&item.BarnName,
+			&item.StaffName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestTaskRepo_GenerateAndComplete(t *testing.T) {
+	ctx, db := openTestDB(t)
+	tasks := NewSQLiteTaskRepo(db)
+
+	barnID, err := NewSQLiteBarnRepo(db).Create(ctx, &domain.Barn{Name: "North"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze", BarnID: &barnID})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	staffID, err := NewSQLiteStaffRepo(db).Create(ctx, &domain.Staff{Name: "Ana"})
+	if err != nil {
+		t.Fatalf("create staff: %v", err)
+	}
+
+	if _, err := tasks.CreateTemplate(ctx, &domain.TaskTemplate{
+		Name: "Water line check", Kind: domain.TaskKindGeneral, BarnID: barnID, DueTime: "07:00", Active: true,
+	}); err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+	pickupID, err := tasks.CreateTemplate(ctx, &domain.TaskTemplate{
+		Name: "Mortality pickup", Kind: domain.TaskKindMortality, BarnID: barnID, FlockID: &flockID, StaffID: &staffID,
+		Weekdays: domain.WeekdaysOf(time.Now().Weekday()), DueTime: "08:00", Active: true,
+	})
+	if err != nil {
+		t.Fatalf("create template: %v", err)
+	}
+
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	// Generating twice must not duplicate tasks; days before the templates existed stay empty.
+	for i := 0; i < 2; i++ {
+		if err := tasks.Generate(ctx, day.AddDate(0, 0, -3), day); err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+	}
+	list, err := tasks.ListForDay(ctx, day)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("tasks today = %d, want 2", len(list))
+	}
+	if earlier, _ := tasks.ListForDay(ctx, day.AddDate(0, 0, -1)); len(earlier) != 0 {
+		t.Errorf("tasks yesterday = %d, want none before the templates existed", len(earlier))
+	}
+
+	var pickup *domain.Task
+	for _, task := range list {
+		if task.TaskTemplateID == pickupID {
+			pickup = task
+		}
+	}
+	if pickup == nil || pickup.BarnName != "North" || pickup.StaffName == nil || *pickup.StaffName != "Ana" || *pickup.FlockID != flockID {
+		t.Fatalf("pickup task = %+v", pickup)
+	}
+
+	recordID := int64(42)
+	if err := tasks.Complete(WithActor(ctx, "1"), pickup.TaskID, &recordID, pickup.Audit.Version, time.Now()); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := tasks.Complete(ctx, pickup.TaskID, nil, pickup.Audit.Version, time.Now()); err != ErrConflict {
+		t.Errorf("completing twice: err = %v, want ErrConflict", err)
+	}
+	done, err := tasks.FindByID(ctx, pickup.TaskID)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if done.Status != domain.TaskDone || done.RecordID == nil || *done.RecordID != recordID || done.CompletedAt == nil || done.CompletedBy == nil || *done.CompletedBy != "1" {
+		t.Errorf("completed task = %+v", done)
+	}
+
+	open, err := tasks.ListOpen(ctx, day)
+	if err != nil {
+		t.Fatalf("list open: %v", err)
+	}
+	if len(open) != 1 || open[0].Name != "Water line check" {
+		t.Errorf("open tasks = %+v, want only the water line check", open)
+	}
+
+	if err := tasks.Reopen(ctx, pickup.TaskID, done.Audit.Version); err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if reopened, _ := tasks.FindByID(ctx, pickup.TaskID); reopened.Status != domain.TaskOpen || reopened.RecordID != nil {
+		t.Errorf("reopened task = %+v", reopened)
+	}
+}
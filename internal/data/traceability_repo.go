@@ -0,0 +1,293 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// TraceabilityRepo walks the production chain between flocks and customer orders.
+type TraceabilityRepo interface {
+	// BatchForSlaughter resolves the production batch a slaughter lot came from.
+	BatchForSlaughter(ctx context.Context, slaughterID int64) (int64, error)
+	// BatchForOrderItem resolves the production batch of the slaughter lot linked to an order item.
+	BatchForOrderItem(ctx context.Context, orderItemID int64) (int64, error)
+	// BatchChain loads the full backward and forward chain of a production batch.
+	BatchChain(ctx context.Context, batchID int64) (*domain.TraceabilityChain, error)
+}
+
+type SQLiteTraceabilityRepo struct {
+	DB *sql.DB
+}
+
+func NewSQLiteTraceabilityRepo(db *sql.DB) *SQLiteTraceabilityRepo {
+	return &SQLiteTraceabilityRepo{DB: db}
+}
+
+func (r *SQLiteTraceabilityRepo) BatchForSlaughter(ctx context.Context, slaughterID int64) (int64, error) {
+	const q = `SELECT batch_id FROM slaughter_records WHERE slaughter_id = ? AND farm_id = ? AND deleted_at IS NULL AND batch_id IS NOT NULL`
+	var batchID int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, slaughterID, FarmFrom(ctx)).Scan(&batchID); err != nil {
+		return 0, err
+	}
+	return batchID, nil
+}
+
+func (r *SQLiteTraceabilityRepo) BatchForOrderItem(ctx context.Context, orderItemID int64) (int64, error) {
+	const q = `SELECT s.batch_id FROM order_items oi JOIN slaughter_records s ON s.slaughter_id = oi.slaughter_id
+		WHERE oi.order_item_id = ? AND oi.farm_id = ? AND oi.deleted_at IS NULL AND s.deleted_at IS NULL AND s.batch_id IS NOT NULL`
+	var batchID int64
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q, orderItemID, FarmFrom(ctx)).Scan(&batchID); err != nil {
+		return 0, err
+	}
+	return batchID, nil
+}
+
+func (r *SQLiteTraceabilityRepo) BatchChain(ctx context.Context, batchID int64) (*domain.TraceabilityChain, error) {
+	chain := &domain.TraceabilityChain{}
+
+	const qBatch = `SELECT batch_id, flock_id, date_ready, number_in_batch, weight_estimate, notes, created_at, updated_at, deleted_at, created_by, updated_by FROM production_batches WHERE batch_id = ? AND farm_id = ? AND deleted_at IS NULL`
+	var batch domain.ProductionBatch
+	err := conn(ctx, r.DB).QueryRowContext(ctx, qBatch, batchID, FarmFrom(ctx)).Scan(
+		&batch.BatchID,
+		&batch.FlockID,
+		&batch.DateReady,
+		&batch.NumberInBatch,
+		&batch.WeightEstimate,
+		&batch.Notes,
+		&batch.Audit.CreatedAt,
+		&batch.Audit.UpdatedAt,
+		&batch.Audit.DeletedAt,
+		&batch.Audit.CreatedBy,
+		&batch.Audit.UpdatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+	chain.Batch = &batch
+
+	flock, err := r.flock(ctx, batch.FlockID)
+	switch {
+	case err == sql.ErrNoRows:
+		// Batch points at a deleted or missing flock; the forward chain is still useful.
+	case err != nil:
+		return nil, err
+	default:
+		chain.Flock = flock
+		batch.Flock = flock
+		if chain.FeedingRecords, err = r.feedingRecords(ctx, flock.FlockID); err != nil {
+			return nil, err
+		}
+		if chain.HealthChecks, err = r.healthChecks(ctx, flock.FlockID); err != nil {
+			return nil, err
+		}
+	}
+
+	if chain.SlaughterRecords, err = r.slaughterRecords(ctx, &batch); err != nil {
+		return nil, err
+	}
+	if chain.Deliveries, err = r.deliveries(ctx, chain.SlaughterRecords); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+func (r *SQLiteTraceabilityRepo) flock(ctx context.Context, flockID int64) (*domain.Flock, error) {
+	const q = `SELECT flock_id, breed, hatch_date, number_of_birds, current_age, barn_id, health_status, feed_type_id, notes FROM flocks WHERE flock_id = ? AND deleted_at IS NULL`
+	var flock domain.Flock
+	err := conn(ctx, r.DB).QueryRowContext(ctx, q, flockID).Scan(
+		&flock.FlockID,
+		&flock.Breed,
+		&flock.HatchDate,
+		&flock.NumberOfBirds,
+		&flock.CurrentAge,
+		&flock.BarnID,
+		&flock.HealthStatus,
+		&flock.FeedTypeID,
+		&flock.Notes,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if flock.BarnID != nil {
+		const qBarn = `SELECT barn_id, name, capacity, location, area_m2 FROM barns WHERE barn_id = ?`
+		var barn domain.Barn
+		err := conn(ctx, r.DB).QueryRowContext(ctx, qBarn, *flock.BarnID).Scan(&barn.BarnID, &barn.Name, &barn.Capacity, &barn.Location, &barn.AreaM2)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil {
+			flock.Barn = &barn
+		}
+	}
+	if flock.FeedTypeID != nil {
+		const qFeed = `SELECT feed_type_id, name, organic_certified FROM feed_types WHERE feed_type_id = ?`
+		var feedType domain.FeedType
+		err := conn(ctx, r.DB).QueryRowContext(ctx, qFeed, *flock.FeedTypeID).Scan(&feedType.FeedTypeID, &feedType.Name, &feedType.OrganicCertified)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil {
+			flock.FeedType = &feedType
+		}
+	}
+	return &flock, nil
+}
+
+func (r *SQLiteTraceabilityRepo) feedingRecords(ctx context.Context, flockID int64) ([]*domain.FeedingRecord, error) {
+	const q = `SELECT fr.feeding_record_id, fr.flock_id, fr.feed_type_id, fr.amount_given, fr.lot_number, fr.date_time, fr.staff_id, COALESCE(ft.name, ''), COALESCE(ft.organic_certified, 0)
+		FROM feeding_records fr LEFT JOIN feed_types ft ON ft.feed_type_id = fr.feed_type_id
+		WHERE fr.flock_id = ? AND fr.deleted_at IS NULL ORDER BY fr.date_time, fr.feeding_record_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, flockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.FeedingRecord
+	for rows.Next() {
+		var item domain.FeedingRecord
+		var feedType domain.FeedType
+		err := rows.Scan(
+			&item.FeedingRecordID,
+			&item.FlockID,
+			&item.FeedTypeID,
+			&item.AmountGiven,
+			&item.LotNumber,
+			&item.DateTime,
+			&item.StaffID,
+			&feedType.Name,
+			&feedType.OrganicCertified,
+		)
+		if err != nil {
+			return nil, err
+		}
+		feedType.FeedTypeID = item.FeedTypeID
+		item.FeedType = &feedType
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteTraceabilityRepo) healthChecks(ctx context.Context, flockID int64) ([]*domain.HealthCheck, error) {
+	const q = `SELECT health_check_id, flock_id, check_date, health_status, vaccinations_given, treatments_administered, notes, staff_id FROM health_checks WHERE flock_id = ? AND deleted_at IS NULL ORDER BY check_date, health_check_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, flockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.HealthCheck
+	for rows.Next() {
+		var item domain.HealthCheck
+		err := rows.Scan(
+			&item.HealthCheckID,
+			&item.FlockID,
+			&item.CheckDate,
+			&item.HealthStatus,
+			&item.VaccinationsGiven,
+			&item.TreatmentsAdministered,
+			&item.Notes,
+			&item.StaffID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteTraceabilityRepo) slaughterRecords(ctx context.Context, batch *domain.ProductionBatch) ([]*domain.SlaughterRecord, error) {
+	const q = `SELECT slaughter_id, batch_id, date, number_slaughtered, meat_yield, waste, staff_id FROM slaughter_records WHERE batch_id = ? AND deleted_at IS NULL ORDER BY date, slaughter_id`
+	rows, err := conn(ctx, r.DB).QueryContext(ctx, q, batch.BatchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*domain.SlaughterRecord
+	for rows.Next() {
+		var item domain.SlaughterRecord
+		err := rows.Scan(
+			&item.SlaughterID,
+			&item.BatchID,
+			&item.Date,
+			&item.NumberSlaughtered,
+			&item.MeatYield,
+			&item.Waste,
+			&item.StaffID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.Batch = batch
+		items = append(items, &item)
+	}
+	return items, rows.Err()
+}
+
+func (r *SQLiteTraceabilityRepo) deliveries(ctx context.Context, slaughterRecords []*domain.SlaughterRecord) ([]*domain.TraceDelivery, error) {
+	const q = `SELECT oi.order_item_id, oi.order_id, oi.product_description, oi.quantity, oi.unit_price, oi.total_price, oi.slaughter_id,
+			o.customer_id, o.order_date, o.delivery_date, COALESCE(o.status, 'draft'),
+			c.name, c.contact_info, c.delivery_address, c.customer_type
+		FROM order_items oi
+		JOIN orders o ON o.order_id = oi.order_id AND o.deleted_at IS NULL
+		JOIN customers c ON c.customer_id = o.customer_id
+		WHERE oi.slaughter_id = ? AND oi.deleted_at IS NULL
+		ORDER BY o.order_date, oi.order_item_id`
+
+	customers := map[int64]*domain.Customer{}
+	var deliveries []*domain.TraceDelivery
+	for _, slaughter := range slaughterRecords {
+		rows, err := conn(ctx, r.DB).QueryContext(ctx, q, slaughter.SlaughterID)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var item domain.OrderItem
+			var order domain.Order
+			var customer domain.Customer
+			err := rows.Scan(
+				&item.OrderItemID,
+				&item.OrderID,
+				&item.ProductDescription,
+				&item.Quantity,
+				&item.UnitPrice,
+				&item.TotalPrice,
+				&item.SlaughterID,
+				&order.CustomerID,
+				&order.OrderDate,
+				&order.DeliveryDate,
+				&order.Status,
+				&customer.Name,
+				&customer.ContactInfo,
+				&customer.DeliveryAddress,
+				&customer.CustomerType,
+			)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			order.OrderID = item.OrderID
+			customer.CustomerID = order.CustomerID
+			if known, ok := customers[customer.CustomerID]; ok {
+				order.Customer = known
+			} else {
+				customers[customer.CustomerID] = &customer
+				order.Customer = &customer
+			}
+			item.Order = &order
+			item.Slaughter = slaughter
+			deliveries = append(deliveries, &domain.TraceDelivery{OrderItem: &item, Order: &order, Customer: order.Customer})
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,83 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestTraceabilityRepo_BatchChain(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLiteTraceabilityRepo(db)
+
+	hatch := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	barnID, err := NewSQLiteBarnRepo(db).Create(ctx, &domain.Barn{Name: "North"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	flockID, err := NewSQLiteFlockRepo(db).Create(ctx, &domain.Flock{Breed: "Bronze", HatchDate: &hatch, BarnID: &barnID})
+	if err != nil {
+		t.Fatalf("create flock: %v", err)
+	}
+	feedTypeID, err := NewSQLiteFeedTypeRepo(db).Create(ctx, &domain.FeedType{Name: "Grower", OrganicCertified: true})
+	if err != nil {
+		t.Fatalf("create feed type: %v", err)
+	}
+
+	for _, stmt := range []struct {
+		q    string
+		args []any
+	}{
+		{`INSERT INTO feeding_records (flock_id, feed_type_id, amount_given, lot_number, date_time) VALUES (?, ?, 10, 'LOT-A', ?)`, []any{flockID, feedTypeID, hatch.AddDate(0, 0, 10)}},
+		{`INSERT INTO feeding_records (flock_id, feed_type_id, amount_given, lot_number, date_time) VALUES (?, ?, 15, 'LOT-A', ?)`, []any{flockID, feedTypeID, hatch.AddDate(0, 0, 20)}},
+		{`INSERT INTO feeding_records (flock_id, feed_type_id, amount_given, lot_number, date_time) VALUES (?, ?, 5, 'LOT-B', ?)`, []any{flockID, feedTypeID, hatch.AddDate(0, 0, 30)}},
+		{`INSERT INTO health_checks (flock_id, check_date, treatments_administered) VALUES (?, ?, 'Coccidiostat')`, []any{flockID, hatch.AddDate(0, 0, 15)}},
+		{`INSERT INTO health_checks (flock_id, check_date, health_status) VALUES (?, ?, 'Good')`, []any{flockID, hatch.AddDate(0, 0, 40)}},
+		{`INSERT INTO production_batches (batch_id, flock_id) VALUES (7, ?)`, []any{flockID}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (21, 7, ?)`, []any{hatch.AddDate(0, 0, 150)}},
+		{`INSERT INTO slaughter_records (slaughter_id, batch_id, date) VALUES (22, 7, ?)`, []any{hatch.AddDate(0, 0, 151)}},
+		{`INSERT INTO customers (customer_id, name) VALUES (1, 'Butcher'), (2, 'Restaurant')`, nil},
+		{`INSERT INTO orders (order_id, customer_id) VALUES (100, 1), (101, 2), (102, 1)`, nil},
+		{`INSERT INTO order_items (order_item_id, order_id, product_description, slaughter_id) VALUES (500, 100, 'Whole turkey', 21)`, nil},
+		{`INSERT INTO order_items (order_item_id, order_id, product_description, slaughter_id) VALUES (501, 101, 'Breast', 22)`, nil},
+		{`INSERT INTO order_items (order_item_id, order_id, product_description, slaughter_id) VALUES (502, 102, 'Legs', 22)`, nil},
+		{`INSERT INTO order_items (order_item_id, order_id, product_description) VALUES (503, 102, 'Eggs')`, nil},
+	} {
+		if _, err := db.ExecContext(ctx, stmt.q, stmt.args...); err != nil {
+			t.Fatalf("seed %q: %v", stmt.q, err)
+		}
+	}
+
+	batchID, err := repo.BatchForOrderItem(ctx, 501)
+	if err != nil || batchID != 7 {
+		t.Fatalf("expected order item 501 to trace to batch 7, got %d (%v)", batchID, err)
+	}
+	if _, err := repo.BatchForOrderItem(ctx, 503); err != ErrNotFound {
+		t.Fatalf("expected unlinked order item to be untraceable, got %v", err)
+	}
+	if batchID, err := repo.BatchForSlaughter(ctx, 21); err != nil || batchID != 7 {
+		t.Fatalf("expected lot 21 to trace to batch 7, got %d (%v)", batchID, err)
+	}
+
+	chain, err := repo.BatchChain(ctx, 7)
+	if err != nil {
+		t.Fatalf("batch chain: %v", err)
+	}
+	if chain.Flock == nil || chain.Flock.Barn == nil || chain.Flock.Barn.Name != "North" {
+		t.Fatalf("expected flock in barn North, got %+v", chain.Flock)
+	}
+	lots := chain.FeedLots()
+	if len(lots) != 2 || lots[0].LotNumber != "LOT-A" || lots[0].TotalAmount != 25 {
+		t.Fatalf("unexpected feed lots: %+v", lots)
+	}
+	if n := len(chain.Treatments()); n != 1 {
+		t.Fatalf("expected 1 treatment, got %d", n)
+	}
+	if len(chain.SlaughterRecords) != 2 || len(chain.Deliveries) != 3 {
+		t.Fatalf("expected 2 lots and 3 deliveries, got %d and %d", len(chain.SlaughterRecords), len(chain.Deliveries))
+	}
+	if n := len(chain.Customers()); n != 2 {
+		t.Fatalf("expected 2 distinct customers, got %d", n)
+	}
+}
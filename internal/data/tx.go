@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	appdb "github.com/cr1cr1/farm-manager/internal/db"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// execer runs statements on a *sql.DB or within a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// dbConn is what repositories run their statements on: the database, or the transaction of the
+// unit of work they are called in.
+type dbConn interface {
+	queryer
+	execer
+}
+
+type unitKey struct{}
+
+// unit is the transaction a context carries, with the events of its writes held back until it
+// commits.
+type unit struct {
+	tx   *sql.Tx
+	held []heldEvent
+}
+
+type heldEvent struct {
+	to    events.Publisher
+	event events.Event
+}
+
+// UnitOfWork runs writes spanning several repositories as one transaction, so an operation such
+// as an order with its lines and stock reservations either happens whole or not at all.
+type UnitOfWork struct {
+	DB *sql.DB
+}
+
+func NewUnitOfWork(db *sql.DB) *UnitOfWork {
+	return &UnitOfWork{DB: db}
+}
+
+// Do runs fn in a transaction, committing when it returns nil and rolling back otherwise. Any
+// repository called with the context fn is given runs in that transaction; the events of its
+// writes are published once the transaction has committed. Do called within another unit of
+// work joins it.
+func (u *UnitOfWork) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(unitKey{}).(*unit); ok {
+		return fn(ctx)
+	}
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// A handler may leave fn by panicking (ghttp's Exit does); the transaction must not outlive it
+	// and hold the only connection.
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+	work := &unit{tx: tx}
+	if err := fn(context.WithValue(ctx, unitKey{}, work)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, h := range work.held {
+		h.to.Publish(h.event)
+	}
+	return nil
+}
+
+// conn returns the transaction of the unit of work ctx carries. Outside of one, queries go to
+// the read pool of db and every other statement to db itself. Inside one everything stays on
+// the transaction: the database has a single writer connection, so a statement run on db
+// while a transaction is open would wait for it forever.
+func conn(ctx context.Context, db *sql.DB) dbConn {
+	if work, ok := ctx.Value(unitKey{}).(*unit); ok {
+		return work.tx
+	}
+	return pools{write: db, read: appdb.Reader(db)}
+}
+
+// pools sends reads to the read pool and writes to the writer.
+type pools struct {
+	write, read *sql.DB
+}
+
+func (p pools) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return p.write.ExecContext(ctx, query, args...)
+}
+
+func (p pools) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return p.pick(query).QueryContext(ctx, query, args...)
+}
+
+func (p pools) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.pick(query).QueryRowContext(ctx, query, args...)
+}
+
+// pick returns the read pool for a SELECT. Updates that return the updated row are queried too
+// and stay on the writer.
+func (p pools) pick(query string) *sql.DB {
+	query = strings.TrimLeft(query, " \t\r\n")
+	if len(query) >= 6 && strings.EqualFold(query[:6], "SELECT") {
+		return p.read
+	}
+	return p.write
+}
+
+// withTx runs fn in a transaction, committing on success and rolling back on error. Within a
+// unit of work fn runs in its transaction, which the unit commits or rolls back as a whole.
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	return NewUnitOfWork(db).Do(ctx, func(ctx context.Context) error {
+		return fn(ctx.Value(unitKey{}).(*unit).tx)
+	})
+}
+
+// publish publishes the event of a write to p, holding it back until the unit of work ctx
+// carries has committed.
+func publish(ctx context.Context, p events.Publisher, entity string, id int64, action events.Action) {
+	if p == nil {
+		return
+	}
+	if work, ok := ctx.Value(unitKey{}).(*unit); ok {
+		work.held = append(work.held, heldEvent{to: p, event: events.Event{Entity: entity, ID: id, Action: action}})
+		return
+	}
+	events.Publish(p, entity, id, action)
+}
@@ -0,0 +1,82 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+)
+
+func TestUnitOfWork_RollsBackEveryRepository(t *testing.T) {
+	ctx, db := openTestDB(t)
+	bus := events.NewBus()
+	barns := &SQLiteBarnRepo{DB: db, Events: bus}
+	flocks := &SQLiteFlockRepo{DB: db, Events: bus}
+	ch, cancel := bus.Subscribe("barns", "flocks")
+	defer cancel()
+
+	failed := errors.New("no feed type")
+	err := NewUnitOfWork(db).Do(ctx, func(ctx context.Context) error {
+		barnID, err := barns.Create(ctx, &domain.Barn{Name: "North"})
+		if err != nil {
+			return err
+		}
+		if _, err := flocks.Create(ctx, &domain.Flock{Breed: "Bronze", BarnID: &barnID}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("Do err = %v, want %v", err, failed)
+	}
+
+	if n, _ := barns.Count(ctx); n != 0 {
+		t.Errorf("barns = %d after rollback, want 0", n)
+	}
+	if n, _ := flocks.Count(ctx); n != 0 {
+		t.Errorf("flocks = %d after rollback, want 0", n)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("rolled back write published %+v", e)
+	default:
+	}
+}
+
+func TestUnitOfWork_CommitsAndPublishesAfterwards(t *testing.T) {
+	ctx, db := openTestDB(t)
+	bus := events.NewBus()
+	barns := &SQLiteBarnRepo{DB: db, Events: bus}
+	ch, cancel := bus.Subscribe("barns")
+	defer cancel()
+
+	uow := NewUnitOfWork(db)
+	err := uow.Do(WithActor(ctx, "7"), func(ctx context.Context) error {
+		// A nested unit of work joins the outer transaction.
+		return uow.Do(ctx, func(ctx context.Context) error {
+			if _, err := barns.Create(ctx, &domain.Barn{Name: "North"}); err != nil {
+				return err
+			}
+			if len(ch) != 0 {
+				t.Error("event published before commit")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	list, err := barns.List(ctx)
+	if err != nil || len(list) != 1 {
+		t.Fatalf("barns = %v, %v; want the committed barn", list, err)
+	}
+	if by := list[0].Audit.CreatedBy; by == nil || *by != "7" {
+		t.Errorf("created by = %v, want the actor 7", by)
+	}
+	if len(ch) != 1 {
+		t.Errorf("published %d events after commit, want 1", len(ch))
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 )
 
 var (
@@ -31,7 +32,8 @@ type UserRepo interface {
 }
 
 type SQLiteUserRepo struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events events.Publisher
 }
 
 func NewSQLiteUserRepo(db *sql.DB) *SQLiteUserRepo {
@@ -41,7 +43,7 @@ func NewSQLiteUserRepo(db *sql.DB) *SQLiteUserRepo {
 func (r *SQLiteUserRepo) Count(ctx context.Context) (int64, error) {
 	const q = `SELECT COUNT(1) FROM users WHERE deleted_at IS NULL`
 	var n int64
-	if err := r.DB.QueryRowContext(ctx, q).Scan(&n); err != nil {
+	if err := conn(ctx, r.DB).QueryRowContext(ctx, q).Scan(&n); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -53,7 +55,7 @@ SELECT id, username, password_hash, force_password_change, theme, created_at, up
 FROM users
 WHERE username = ? AND (deleted_at IS NULL)
 LIMIT 1`
-	row := r.DB.QueryRowContext(ctx, q, username)
+	row := conn(ctx, r.DB).QueryRowContext(ctx, q, username)
 	u, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -76,7 +78,7 @@ VALUES (?, ?, ?, strftime('%Y-%m-%dT%H:%M:%fZ','now'), strftime('%Y-%m-%dT%H:%M:
 	if u.Audit.UpdatedBy != nil {
 		updatedBy = *u.Audit.UpdatedBy
 	}
-	res, err := r.DB.ExecContext(ctx, q, u.Username, u.PasswordHash, boolToInt(u.ForcePasswordChange), createdBy, updatedBy)
+	res, err := conn(ctx, r.DB).ExecContext(ctx, q, u.Username, u.PasswordHash, boolToInt(u.ForcePasswordChange), createdBy, updatedBy)
 	if err != nil {
 		return 0, err
 	}
@@ -84,6 +86,7 @@ VALUES (?, ?, ?, strftime('%Y-%m-%dT%H:%M:%fZ','now'), strftime('%Y-%m-%dT%H:%M:
 	if err != nil {
 		return 0, err
 	}
+	publish(ctx, r.Events, "users", id, events.Created)
 	return id, nil
 }
 
@@ -92,8 +95,11 @@ func (r *SQLiteUserRepo) UpdatePassword(ctx context.Context, userID int64, newHa
 UPDATE users
 SET password_hash = ?, force_password_change = ?, updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
 WHERE id = ? AND (deleted_at IS NULL)`
-	_, err := r.DB.ExecContext(ctx, q, newHash, boolToInt(forceChange), userID)
-	return err
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, newHash, boolToInt(forceChange), userID); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "users", userID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteUserRepo) UpdateTheme(ctx context.Context, userID int64, theme int) error {
@@ -101,8 +107,11 @@ func (r *SQLiteUserRepo) UpdateTheme(ctx context.Context, userID int64, theme in
 UPDATE users
 SET theme = ?, updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
 WHERE id = ? AND (deleted_at IS NULL)`
-	_, err := r.DB.ExecContext(ctx, q, theme, userID)
-	return err
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, theme, userID); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "users", userID, events.Updated)
+	return nil
 }
 
 func (r *SQLiteUserRepo) SoftDelete(ctx context.Context, userID int64, deletedAt time.Time) error {
@@ -110,8 +119,11 @@ func (r *SQLiteUserRepo) SoftDelete(ctx context.Context, userID int64, deletedAt
 UPDATE users
 SET deleted_at = ?, updated_at = strftime('%Y-%m-%dT%H:%M:%fZ','now')
 WHERE id = ? AND (deleted_at IS NULL)`
-	_, err := r.DB.ExecContext(ctx, q, deletedAt.UTC().Format(time.RFC3339Nano), userID)
-	return err
+	if _, err := conn(ctx, r.DB).ExecContext(ctx, q, deletedAt.UTC().Format(time.RFC3339Nano), userID); err != nil {
+		return err
+	}
+	publish(ctx, r.Events, "users", userID, events.Deleted)
+	return nil
 }
 
 type rowScanner interface {
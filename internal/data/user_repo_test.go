@@ -15,7 +15,7 @@ import (
 func openTestDB(t *testing.T) (context.Context, *sql.DB) {
 	t.Helper()
 	t.Setenv("SQLITE_DSN", ":memory:")
-	ctx := context.Background()
+	ctx := WithFarm(context.Background(), DefaultFarmID)
 	db, err := appdb.Open(ctx)
 	if err != nil {
 		t.Fatalf("open db: %v", err)
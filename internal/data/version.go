@@ -0,0 +1,33 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrConflict is returned by the update of a versioned record that was changed since the
+// version the update was based on.
+var ErrConflict = errors.New("record changed since it was loaded")
+
+// versionCheck ends the WHERE clause of a versioned update and returns the bumped version. It
+// takes the version the form was loaded at; an update without one (0) matches no row and fails
+// with ErrConflict. Writes that do not come from a form go through their own methods.
+const versionCheck = ` AND version = ? RETURNING version`
+
+// versionError explains a versioned update that matched no row: ErrConflict when the record is
+// still there at another version, ErrNotFound when it is gone.
+func versionError(ctx context.Context, db queryer, err error, table, idColumn string, id int64) error {
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	var exists int
+	q := `SELECT COUNT(1) FROM ` + table + ` WHERE ` + idColumn + ` = ? AND deleted_at IS NULL`
+	if err := db.QueryRowContext(ctx, q, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrConflict
+	}
+	return ErrNotFound
+}
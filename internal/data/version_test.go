@@ -0,0 +1,70 @@
+package data
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+func TestVersionedUpdate_RefusesStaleVersion(t *testing.T) {
+	ctx, db := openTestDB(t)
+	repo := NewSQLiteBarnRepo(db)
+
+	id, err := repo.Create(ctx, &domain.Barn{Name: "North"})
+	if err != nil {
+		t.Fatalf("create barn: %v", err)
+	}
+	mine, err := repo.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("find barn: %v", err)
+	}
+	theirs, err := repo.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("find barn: %v", err)
+	}
+	if mine.Audit.Version != 1 {
+		t.Fatalf("version = %d, want 1", mine.Audit.Version)
+	}
+
+	theirs.Name = "North (theirs)"
+	if err := repo.Update(ctx, theirs); err != nil {
+		t.Fatalf("update theirs: %v", err)
+	}
+	if theirs.Audit.Version != 2 {
+		t.Errorf("version after update = %d, want 2", theirs.Audit.Version)
+	}
+
+	mine.Name = "North (mine)"
+	if err := repo.Update(ctx, mine); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update err = %v, want ErrConflict", err)
+	}
+	stored, err := repo.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("find barn: %v", err)
+	}
+	if stored.Name != "North (theirs)" {
+		t.Errorf("name = %q, stale update was applied", stored.Name)
+	}
+
+	// An update that does not say which version it was based on is refused too.
+	mine.Audit.Version = 0
+	if err := repo.Update(ctx, mine); !errors.Is(err, ErrConflict) {
+		t.Fatalf("update without a version err = %v, want ErrConflict", err)
+	}
+	mine.Audit.Version = stored.Audit.Version
+	if err := repo.Update(ctx, mine); err != nil {
+		t.Fatalf("update at the current version: %v", err)
+	}
+	if mine.Audit.Version != 3 {
+		t.Errorf("version after update = %d, want 3", mine.Audit.Version)
+	}
+
+	if err := repo.SoftDelete(ctx, id, time.Now()); err != nil {
+		t.Fatalf("delete barn: %v", err)
+	}
+	if err := repo.Update(ctx, mine); !errors.Is(err, ErrNotFound) {
+		t.Errorf("update of deleted barn err = %v, want ErrNotFound", err)
+	}
+}
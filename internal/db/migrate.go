@@ -27,14 +27,28 @@ func findMigrationsDir() (string, error) {
 	return "", fmt.Errorf("db/migrations directory not found (looked in: %v)", candidates)
 }
 
-// Migrate executes all .sql files in db/migrations in lexicographic order.
-// Each file may contain multiple SQL statements. Use IF NOT EXISTS to keep it idempotent.
+// Migrate executes all pending .sql files in db/migrations in lexicographic order.
+// Each file may contain multiple SQL statements. Applied files are recorded in schema_migrations
+// so that non-idempotent statements (e.g. ALTER TABLE ... ADD COLUMN) only run once.
 func Migrate(ctx context.Context, db *sql.DB) error {
 	dir, err := findMigrationsDir()
 	if err != nil {
 		return err
 	}
 
+	const createTracking = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  name TEXT PRIMARY KEY,
+  applied_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%fZ','now'))
+)`
+	if _, err := db.ExecContext(ctx, createTracking); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	applied, err := appliedMigrations(ctx, db)
+	if err != nil {
+		return err
+	}
+
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("read migrations dir %q: %w", dir, err)
@@ -53,18 +67,43 @@ func Migrate(ctx context.Context, db *sql.DB) error {
 	sort.Strings(files)
 
 	for _, p := range files {
+		name := filepath.Base(p)
+		if applied[name] {
+			continue
+		}
 		sqlBytes, err := os.ReadFile(p)
 		if err != nil {
 			return fmt.Errorf("read migration %q: %w", p, err)
 		}
 		sqlText := strings.TrimSpace(string(sqlBytes))
-		if sqlText == "" {
-			continue
+		if sqlText != "" {
+			if _, err := db.ExecContext(ctx, sqlText); err != nil {
+				return fmt.Errorf("exec migration %q: %w", p, err)
+			}
 		}
-		if _, err := db.ExecContext(ctx, sqlText); err != nil {
-			return fmt.Errorf("exec migration %q: %w", p, err)
+		if _, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (name) VALUES (?)`, name); err != nil {
+			return fmt.Errorf("record migration %q: %w", p, err)
 		}
 	}
 
 	return nil
 }
+
+// appliedMigrations returns the set of migration file names already recorded.
+func appliedMigrations(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		applied[name] = true
+	}
+	return applied, rows.Err()
+}
@@ -3,18 +3,21 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
 )
 
 const (
-	defaultDSN = "file:./data/app.db?cache=shared&mode=rwc"
+	defaultDSN = "file:./data/app.db?mode=rwc"
 )
 
 // dsnFromEnv returns the SQLite DSN from env or a sane default.
@@ -25,6 +28,16 @@ func dsnFromEnv() string {
 	return defaultDSN
 }
 
+// FilePath returns the database file named by SQLITE_DSN, or false for an in-memory database.
+func FilePath() (string, bool) {
+	dsn := dsnFromEnv()
+	if !isFileDSN(dsn) {
+		return "", false
+	}
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	return path, true
+}
+
 // ensureDataDir tries to create the directory that contains the SQLite file if the DSN points to a file: URL.
 func ensureDataDir(dsn string) error {
 	// Only handle file: DSNs. Others (e.g., :memory:) are ignored.
@@ -47,52 +60,168 @@ func ensureDataDir(dsn string) error {
 	return os.MkdirAll(dir, 0o755)
 }
 
-// Open opens (and creates if needed) the SQLite database with required PRAGMAs.
+// Pool settings, overridable through the environment:
+//   - SQLITE_READ_CONNS: connections of the read pool (default 4)
+//   - SQLITE_CACHE_SIZE_KB: page cache of each connection in KiB (default 20000)
+//   - SQLITE_MMAP_SIZE_MB: memory-mapped I/O per connection in MiB, 0 to disable (default 256)
+const (
+	defaultReadConns   = 4
+	defaultCacheSizeKB = 20000
+	defaultMmapSizeMB  = 256
+)
+
+// readers holds the read pool opened with each writer, see Reader.
+var readers sync.Map // *sql.DB -> *sql.DB
+
+// Open opens (and creates if needed) the SQLite database in WAL mode. The returned handle is
+// the write pool: a single connection that begins transactions IMMEDIATE, so writers queue on
+// busy_timeout instead of failing when they upgrade a read lock. A file database also gets a
+// read pool of query-only connections, which Reader returns; under WAL they read the last
+// commit while the writer works. Every connection of both pools gets its PRAGMAs when it is
+// opened, not only the first one.
 func Open(ctx context.Context) (*sql.DB, error) {
-	dsn := dsnFromEnv()
+	dsn := withoutSharedCache(dsnFromEnv())
 	if err := ensureDataDir(dsn); err != nil {
 		return nil, fmt.Errorf("ensure data dir: %w", err)
 	}
 
-	// modernc.org/sqlite registers as driver name "sqlite".
-	db, err := sql.Open("sqlite", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("open sqlite: %w", err)
+	pragmas := []string{
+		"PRAGMA foreign_keys = ON",
+		"PRAGMA busy_timeout = 5000",
+		"PRAGMA synchronous = NORMAL",
+		fmt.Sprintf("PRAGMA cache_size = -%d", envInt("SQLITE_CACHE_SIZE_KB", defaultCacheSizeKB)),
+		fmt.Sprintf("PRAGMA mmap_size = %d", envInt("SQLITE_MMAP_SIZE_MB", defaultMmapSizeMB)<<20),
 	}
 
-	// Reasonable pool defaults for SQLite without WAL.
-	db.SetConnMaxLifetime(0)
-	db.SetMaxIdleConns(1)
-	db.SetMaxOpenConns(1)
+	// The journal mode is stored in the database file, so setting it on the writer covers the
+	// readers too. An in-memory database keeps its own journal and ignores it.
+	writer := sql.OpenDB(&connector{
+		dsn:     withParam(dsn, "_txlock=immediate"),
+		pragmas: append([]string{"PRAGMA journal_mode = WAL"}, pragmas...),
+	})
+	writer.SetConnMaxLifetime(0)
+	writer.SetMaxIdleConns(1)
+	writer.SetMaxOpenConns(1)
+	if err := ping(ctx, writer); err != nil {
+		_ = writer.Close()
+		return nil, err
+	}
 
+	// Every connection to :memory: is a database of its own, so only files can be shared.
+	if !isFileDSN(dsn) {
+		return writer, nil
+	}
+	n := envInt("SQLITE_READ_CONNS", defaultReadConns)
+	if n == 0 {
+		return writer, nil
+	}
+	reader := sql.OpenDB(&connector{
+		dsn:     dsn,
+		pragmas: append(pragmas, "PRAGMA query_only = ON"),
+	})
+	reader.SetConnMaxLifetime(0)
+	reader.SetMaxIdleConns(n)
+	reader.SetMaxOpenConns(n)
+	if err := ping(ctx, reader); err != nil {
+		_ = reader.Close()
+		_ = writer.Close()
+		return nil, err
+	}
+	readers.Store(writer, reader)
+	return writer, nil
+}
+
+// Reader returns the read pool opened along with the writer db, or db itself when it has none.
+// Statements run on it must not write.
+func Reader(db *sql.DB) *sql.DB {
+	if reader, ok := readers.Load(db); ok {
+		return reader.(*sql.DB)
+	}
+	return db
+}
+
+func ping(ctx context.Context, db *sql.DB) error {
 	ctxPing, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	if err := db.PingContext(ctxPing); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("ping: %w", err)
+		return fmt.Errorf("ping: %w", err)
 	}
+	return nil
+}
 
-	// Enforce pragma settings per connection.
-	if err := applyPragmas(ctx, db); err != nil {
-		_ = db.Close()
-		return nil, err
+// connector opens SQLite connections and applies the PRAGMAs of their pool to each of them
+// before database/sql hands it out.
+type connector struct {
+	dsn     string
+	pragmas []string
+}
+
+var sqliteDriver = &sqlite.Driver{}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sqliteDriver.Open(c.dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open sqlite: %w", err)
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("sqlite connection cannot execute statements")
+	}
+	for _, pragma := range c.pragmas {
+		if _, err := execer.ExecContext(ctx, pragma, nil); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("apply pragma %q: %w", pragma, err)
+		}
 	}
+	return conn, nil
+}
 
-	return db, nil
+func (c *connector) Driver() driver.Driver {
+	return sqliteDriver
 }
 
-func applyPragmas(ctx context.Context, db *sql.DB) error {
-	// busy_timeout in milliseconds; keep conservative default.
-	stmts := []string{
-		"PRAGMA foreign_keys = ON;",
-		"PRAGMA busy_timeout = 5000;",
+// withoutSharedCache drops cache=shared from a DSN. A shared cache takes table locks that make
+// readers fail while the writer works, which defeats WAL.
+func withoutSharedCache(dsn string) string {
+	base, query, ok := strings.Cut(dsn, "?")
+	if !ok {
+		return dsn
 	}
-	for _, s := range stmts {
-		if _, err := db.ExecContext(ctx, s); err != nil {
-			return fmt.Errorf("apply pragma %q: %w", s, err)
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		if param != "cache=shared" && param != "" {
+			kept = append(kept, param)
 		}
 	}
-	return nil
+	if len(kept) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(kept, "&")
+}
+
+// withParam adds a query parameter to a DSN.
+func withParam(dsn, param string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
+}
+
+// isFileDSN reports whether the DSN names a database file rather than an in-memory database.
+func isFileDSN(dsn string) bool {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dsn, "file:"), "?")
+	return path != "" && path != ":memory:" && !strings.Contains(dsn, "mode=memory")
+}
+
+// envInt reads a non-negative integer setting, falling back to def.
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return def
 }
 
 // Close closes the database, returning the first error encountered.
@@ -100,6 +229,9 @@ func Close(db *sql.DB) error {
 	if db == nil {
 		return nil
 	}
+	if reader, ok := readers.LoadAndDelete(db); ok {
+		_ = reader.(*sql.DB).Close()
+	}
 	if err := db.Close(); err != nil {
 		return err
 	}
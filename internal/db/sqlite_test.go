@@ -0,0 +1,158 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func openFileDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	tb.Setenv("SQLITE_DSN", "file:"+filepath.Join(tb.TempDir(), "app.db")+"?cache=shared&mode=rwc")
+	db, err := Open(context.Background())
+	if err != nil {
+		tb.Fatalf("open: %v", err)
+	}
+	tb.Cleanup(func() { _ = Close(db) })
+	return db
+}
+
+func TestOpen_AppliesPragmasToEveryConnection(t *testing.T) {
+	t.Setenv("SQLITE_READ_CONNS", "3")
+	db := openFileDB(t)
+	ctx := context.Background()
+
+	var mode string
+	if err := db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, %v; want wal", mode, err)
+	}
+
+	reader := Reader(db)
+	if reader == db {
+		t.Fatal("file database has no read pool")
+	}
+	// Hold every reader connection at once so each one is checked, not just the first.
+	conns := make([]*sql.Conn, 3)
+	for i := range conns {
+		conn, err := reader.Conn(ctx)
+		if err != nil {
+			t.Fatalf("reader conn: %v", err)
+		}
+		conns[i] = conn
+	}
+	for i, conn := range conns {
+		var foreignKeys, queryOnly, synchronous int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA query_only").Scan(&queryOnly); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA synchronous").Scan(&synchronous); err != nil {
+			t.Fatal(err)
+		}
+		if foreignKeys != 1 || queryOnly != 1 || synchronous != 1 {
+			t.Errorf("reader %d: foreign_keys=%d query_only=%d synchronous=%d, want 1 1 1 (NORMAL)", i, foreignKeys, queryOnly, synchronous)
+		}
+	}
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+
+	if _, err := reader.ExecContext(ctx, "CREATE TABLE t (id INTEGER)"); err == nil {
+		t.Error("read pool accepted a write")
+	}
+}
+
+func TestOpen_MemoryDatabaseHasNoReadPool(t *testing.T) {
+	t.Setenv("SQLITE_DSN", ":memory:")
+	db, err := Open(context.Background())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer Close(db)
+	if Reader(db) != db {
+		t.Error("in-memory database got a read pool of separate databases")
+	}
+}
+
+func TestWithoutSharedCache(t *testing.T) {
+	for dsn, want := range map[string]string{
+		"file:./data/app.db?cache=shared&mode=rwc": "file:./data/app.db?mode=rwc",
+		"file:./data/app.db?cache=shared":          "file:./data/app.db",
+		":memory:":                                 ":memory:",
+	} {
+		if got := withoutSharedCache(dsn); got != want {
+			t.Errorf("withoutSharedCache(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+// BenchmarkReadsUnderWrites runs a report-style aggregate from parallel readers while a writer
+// updates rows continuously. With the read pool the reports no longer queue behind the writer
+// and each other on the single write connection; compare the ns/op and writes/s of the two.
+func BenchmarkReadsUnderWrites(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		reader func(db *sql.DB) *sql.DB
+	}{
+		{"read-pool", Reader},
+		{"writer-only", func(db *sql.DB) *sql.DB { return db }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			db := openFileDB(b)
+			ctx := context.Background()
+			if _, err := db.ExecContext(ctx, `CREATE TABLE readings (id INTEGER PRIMARY KEY, flock_id INTEGER, weight REAL)`); err != nil {
+				b.Fatal(err)
+			}
+			const seed = `WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 20000)
+				INSERT INTO readings (flock_id, weight) SELECT i % 50, i % 7 FROM n`
+			if _, err := db.ExecContext(ctx, seed); err != nil {
+				b.Fatal(err)
+			}
+			reader := bc.reader(db)
+
+			var writes atomic.Int64
+			stop := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Updates keep the table, and so the cost of a report, the same however fast the
+				// writer gets.
+				for i := int64(1); ; i = i%20000 + 1 {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if _, err := db.ExecContext(ctx, `UPDATE readings SET weight = weight + 1 WHERE id = ?`, i); err != nil {
+						b.Error(err)
+						return
+					}
+					writes.Add(1)
+				}
+			}()
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var n int
+					var total float64
+					err := reader.QueryRowContext(ctx, `SELECT COUNT(DISTINCT flock_id), SUM(weight) FROM readings`).Scan(&n, &total)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+			close(stop)
+			wg.Wait()
+			b.ReportMetric(float64(writes.Load())/b.Elapsed().Seconds(), "writes/s")
+		})
+	}
+}
@@ -9,6 +9,9 @@ type AuditFields struct {
 	DeletedAt *time.Time // NULL
 	CreatedBy *string    // NULL
 	UpdatedBy *string    // NULL
+	// Version is bumped by every update of a versioned record; an update carrying a version
+	// only applies while the record is still at it, so one carrying 0 never applies.
+	Version int64
 }
 
 // TouchCreated sets created/updated timestamps to now.
@@ -8,5 +8,6 @@ type Barn struct {
 	EnvironmentControl  *string
 	MaintenanceSchedule *string
 	Location            *string
+	AreaM2              *float64
 	Audit               AuditFields
 }
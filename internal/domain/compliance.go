@@ -0,0 +1,156 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Compliance rule codes understood by EvaluateFlockCompliance.
+const (
+	RuleMaxStockingDensity   = "max_stocking_density"
+	RuleMinOutdoorAccessDays = "min_outdoor_access_days"
+	RuleOrganicFeedOnly      = "organic_feed_only"
+	RuleMaxTreatments        = "max_treatments"
+	RuleMinSlaughterAgeDays  = "min_slaughter_age_days"
+)
+
+// ComplianceStatus is the outcome of a compliance check.
+type ComplianceStatus string
+
+const (
+	CompliancePass    ComplianceStatus = "pass"
+	ComplianceFail    ComplianceStatus = "fail"
+	CompliancePending ComplianceStatus = "pending" // not enough data yet, or flock still growing
+)
+
+// ComplianceRule is a configurable organic certification rule
+type ComplianceRule struct {
+	ComplianceRuleID int64
+	Code             string
+	Name             string
+	Threshold        *float64
+	Enabled          bool
+	Notes            *string
+	Audit            AuditFields
+}
+
+// FlockComplianceFacts gathers the recorded data a flock is evaluated against
+type FlockComplianceFacts struct {
+	Flock               *Flock
+	BarnAreaM2          *float64
+	LiveBirds           int
+	OutdoorAccessDays   int
+	FeedTypesUsed       []string
+	NonOrganicFeedTypes []string
+	TreatmentCount      int
+	SlaughterAgesDays   []int
+	Slaughtered         bool
+}
+
+// ComplianceCheck is the result of evaluating one rule for one flock
+type ComplianceCheck struct {
+	Rule     *ComplianceRule
+	Status   ComplianceStatus
+	Actual   string
+	Expected string
+	Detail   string
+}
+
+// FlockComplianceReport summarises all rule checks for a flock
+type FlockComplianceReport struct {
+	Flock  *Flock
+	Facts  *FlockComplianceFacts
+	Checks []ComplianceCheck
+	Status ComplianceStatus
+}
+
+// EvaluateFlockCompliance checks the enabled rules against the facts of a single flock.
+// The overall status is fail if any check fails, pending if any check is pending, pass otherwise.
+func EvaluateFlockCompliance(rules []*ComplianceRule, facts *FlockComplianceFacts) *FlockComplianceReport {
+	report := &FlockComplianceReport{Flock: facts.Flock, Facts: facts, Status: CompliancePass}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		check := evaluateRule(rule, facts)
+		report.Checks = append(report.Checks, check)
+		switch {
+		case check.Status == ComplianceFail:
+			report.Status = ComplianceFail
+		case check.Status == CompliancePending && report.Status == CompliancePass:
+			report.Status = CompliancePending
+		}
+	}
+	return report
+}
+
+func evaluateRule(rule *ComplianceRule, facts *FlockComplianceFacts) ComplianceCheck {
+	check := ComplianceCheck{Rule: rule, Status: CompliancePending}
+	threshold := 0.0
+	if rule.Threshold != nil {
+		threshold = *rule.Threshold
+	}
+
+	switch rule.Code {
+	case RuleMaxStockingDensity:
+		check.Expected = fmt.Sprintf("≤ %.2f birds/m²", threshold)
+		if facts.BarnAreaM2 == nil || *facts.BarnAreaM2 <= 0 {
+			check.Actual = "-"
+			check.Detail = "Barn area is not recorded"
+			return check
+		}
+		density := float64(facts.LiveBirds) / *facts.BarnAreaM2
+		check.Actual = fmt.Sprintf("%.2f birds/m²", density)
+		check.Status = passIf(density <= threshold)
+	case RuleMinOutdoorAccessDays:
+		check.Expected = fmt.Sprintf("≥ %.0f days", threshold)
+		check.Actual = fmt.Sprintf("%d days", facts.OutdoorAccessDays)
+		switch {
+		case float64(facts.OutdoorAccessDays) >= threshold:
+			check.Status = CompliancePass
+		case facts.Slaughtered:
+			check.Status = ComplianceFail
+		default:
+			check.Detail = "Flock is still growing"
+		}
+	case RuleOrganicFeedOnly:
+		check.Expected = "certified feed only"
+		if len(facts.FeedTypesUsed) == 0 {
+			check.Actual = "-"
+			check.Detail = "No feed recorded"
+			return check
+		}
+		check.Actual = fmt.Sprintf("%d of %d feed types certified", len(facts.FeedTypesUsed)-len(facts.NonOrganicFeedTypes), len(facts.FeedTypesUsed))
+		check.Status = passIf(len(facts.NonOrganicFeedTypes) == 0)
+		if len(facts.NonOrganicFeedTypes) > 0 {
+			check.Detail = "Not certified: " + strings.Join(facts.NonOrganicFeedTypes, ", ")
+		}
+	case RuleMaxTreatments:
+		check.Expected = fmt.Sprintf("≤ %.0f treatments", threshold)
+		check.Actual = fmt.Sprintf("%d treatments", facts.TreatmentCount)
+		check.Status = passIf(float64(facts.TreatmentCount) <= threshold)
+	case RuleMinSlaughterAgeDays:
+		check.Expected = fmt.Sprintf("≥ %.0f days", threshold)
+		if len(facts.SlaughterAgesDays) == 0 {
+			check.Actual = "-"
+			check.Detail = "Not slaughtered yet, or hatch date missing"
+			return check
+		}
+		youngest := facts.SlaughterAgesDays[0]
+		for _, age := range facts.SlaughterAgesDays[1:] {
+			youngest = min(youngest, age)
+		}
+		check.Actual = fmt.Sprintf("%d days", youngest)
+		check.Status = passIf(float64(youngest) >= threshold)
+	default:
+		check.Detail = "Unknown rule"
+	}
+	return check
+}
+
+func passIf(ok bool) ComplianceStatus {
+	if ok {
+		return CompliancePass
+	}
+	return ComplianceFail
+}
@@ -0,0 +1,69 @@
+package domain
+
+import "testing"
+
+func TestEvaluateFlockCompliance(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	rules := []*ComplianceRule{
+		{Code: RuleMaxStockingDensity, Name: "density", Threshold: f(10), Enabled: true},
+		{Code: RuleMinOutdoorAccessDays, Name: "outdoor", Threshold: f(47), Enabled: true},
+		{Code: RuleOrganicFeedOnly, Name: "feed", Enabled: true},
+		{Code: RuleMaxTreatments, Name: "treatments", Threshold: f(1), Enabled: true},
+		{Code: RuleMinSlaughterAgeDays, Name: "age", Threshold: f(140), Enabled: true},
+	}
+
+	compliant := &FlockComplianceFacts{
+		Flock:             &Flock{FlockID: 1},
+		BarnAreaM2:        f(100),
+		LiveBirds:         900,
+		OutdoorAccessDays: 60,
+		FeedTypesUsed:     []string{"Organic grower"},
+		TreatmentCount:    1,
+		SlaughterAgesDays: []int{150, 145},
+		Slaughtered:       true,
+	}
+	report := EvaluateFlockCompliance(rules, compliant)
+	if report.Status != CompliancePass {
+		t.Fatalf("expected pass, got %s: %+v", report.Status, report.Checks)
+	}
+	if len(report.Checks) != len(rules) {
+		t.Fatalf("expected %d checks, got %d", len(rules), len(report.Checks))
+	}
+
+	growing := &FlockComplianceFacts{
+		Flock:             &Flock{FlockID: 2},
+		BarnAreaM2:        f(100),
+		LiveBirds:         900,
+		OutdoorAccessDays: 10,
+		FeedTypesUsed:     []string{"Organic starter"},
+	}
+	if got := EvaluateFlockCompliance(rules, growing).Status; got != CompliancePending {
+		t.Fatalf("expected pending for growing flock, got %s", got)
+	}
+
+	violating := &FlockComplianceFacts{
+		Flock:               &Flock{FlockID: 3},
+		BarnAreaM2:          f(50),
+		LiveBirds:           900,
+		OutdoorAccessDays:   20,
+		FeedTypesUsed:       []string{"Organic grower", "Conventional pellets"},
+		NonOrganicFeedTypes: []string{"Conventional pellets"},
+		TreatmentCount:      3,
+		SlaughterAgesDays:   []int{150, 120},
+		Slaughtered:         true,
+	}
+	report = EvaluateFlockCompliance(rules, violating)
+	if report.Status != ComplianceFail {
+		t.Fatalf("expected fail, got %s", report.Status)
+	}
+	for _, check := range report.Checks {
+		if check.Status != ComplianceFail {
+			t.Fatalf("expected rule %s to fail, got %s", check.Rule.Code, check.Status)
+		}
+	}
+
+	rules[0].Enabled = false
+	if n := len(EvaluateFlockCompliance(rules, violating).Checks); n != len(rules)-1 {
+		t.Fatalf("disabled rule should be skipped, got %d checks", n)
+	}
+}
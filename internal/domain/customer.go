@@ -5,7 +5,27 @@ type Customer struct {
 	CustomerID      int64
 	Name            string
 	ContactInfo     *string
-	DeliveryAddress *string
+	DeliveryAddress *string // the default delivery address
+	BillingAddress  *string // the default billing address
 	CustomerType    *string
+	VATNumber       *string
+	Tags            []string
+	Latitude        *float64 // delivery location, decimal degrees
+	Longitude       *float64
 	Audit           AuditFields
 }
+
+// InvoiceAddress returns the address invoices are sent to: the default billing address, or the
+// delivery address when the customer has no billing address.
+func (c *Customer) InvoiceAddress() *string {
+	if c.BillingAddress != nil {
+		return c.BillingAddress
+	}
+	return c.DeliveryAddress
+}
+
+// CustomerFilter narrows the customer list. Empty fields match every customer.
+type CustomerFilter struct {
+	Tag  string
+	Type string
+}
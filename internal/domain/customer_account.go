@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrEmailTaken is returned when a portal account already uses the email address.
+var ErrEmailTaken = errors.New("another portal account already uses this email")
+
+// CustomerAccount lets someone at a customer sign in to the customer portal. Accounts are
+// separate from staff users: they only ever see and order for their own customer.
+type CustomerAccount struct {
+	CustomerAccountID int64
+	CustomerID        int64
+	Email             string
+	PasswordHash      string
+	LastLoginAt       *time.Time
+	Audit             AuditFields
+
+	// Relations
+	CustomerName string
+	// FarmID is the farm of the customer; the portal shows that farm's stock and orders
+	FarmID int64
+}
+
+// CatalogItem is a product as the portal offers it to a customer: the customer's price today and
+// what is in stock to ship now.
+type CatalogItem struct {
+	Product   *Product
+	UnitPrice float64
+	Available float64
+}
+
+// BuildCatalog lists the active products that have a price for the customer, in product order,
+// with the available stock from the sellable stock rows.
+func BuildCatalog(products []*Product, prices map[int64]float64, stock []*ProductStock) []*CatalogItem {
+	available := make(map[int64]float64, len(stock))
+	for _, row := range stock {
+		if row.Product != nil {
+			available[row.Product.ProductID] = row.Available
+		}
+	}
+
+	var items []*CatalogItem
+	for _, product := range products {
+		price, ok := prices[product.ProductID]
+		if !product.Active || !ok {
+			continue
+		}
+		items = append(items, &CatalogItem{Product: product, UnitPrice: price, Available: available[product.ProductID]})
+	}
+	return items
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "testing"
+
+func TestBuildCatalog(t *testing.T) {
+	legs := &Product{ProductID: 1, Name: "Legs", Active: true}
+	breast := &Product{ProductID: 2, Name: "Breast", Active: true}
+	retired := &Product{ProductID: 3, Name: "Neck", Active: false}
+	unpriced := &Product{ProductID: 4, Name: "Liver", Active: true}
+
+	catalog := BuildCatalog(
+		[]*Product{legs, breast, retired, unpriced},
+		map[int64]float64{1: 6.5, 2: 14, 3: 2},
+		[]*ProductStock{{Product: breast, Available: 8.5}},
+	)
+	if len(catalog) != 2 {
+		t.Fatalf("got %d items, want legs and breast: %+v", len(catalog), catalog)
+	}
+	if catalog[0].Product != legs || catalog[0].UnitPrice != 6.5 || catalog[0].Available != 0 {
+		t.Errorf("legs = %+v", catalog[0])
+	}
+	if catalog[1].Product != breast || catalog[1].UnitPrice != 14 || catalog[1].Available != 8.5 {
+		t.Errorf("breast = %+v", catalog[1])
+	}
+}
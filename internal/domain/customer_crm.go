@@ -0,0 +1,119 @@
+package domain
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// CustomerContact is a person to talk to at a customer.
+type CustomerContact struct {
+	CustomerContactID int64
+	CustomerID        int64
+	Name              string
+	Role              *string
+	Phone             *string
+	Email             *string
+	Audit             AuditFields
+}
+
+// AddressKind tells what a customer address is used for.
+type AddressKind string
+
+const (
+	AddressKindBilling  AddressKind = "billing"
+	AddressKindDelivery AddressKind = "delivery"
+)
+
+// AddressKinds lists the address kinds in display order.
+var AddressKinds = []AddressKind{AddressKindDelivery, AddressKindBilling}
+
+// Label returns the address kind for display.
+func (k AddressKind) Label() string {
+	switch k {
+	case AddressKindBilling:
+		return "Billing"
+	case AddressKindDelivery:
+		return "Delivery"
+	}
+	return string(k)
+}
+
+// CustomerAddress is one of a customer's billing or delivery addresses. Each kind has at most
+// one default address.
+type CustomerAddress struct {
+	CustomerAddressID int64
+	CustomerID        int64
+	Kind              AddressKind
+	Label             *string
+	Address           string
+	IsDefault         bool
+	Audit             AuditFields
+}
+
+// CommunicationKind tells how the farm and a customer were in touch.
+type CommunicationKind string
+
+const (
+	CommunicationCall      CommunicationKind = "call"
+	CommunicationEmail     CommunicationKind = "email"
+	CommunicationVisit     CommunicationKind = "visit"
+	CommunicationComplaint CommunicationKind = "complaint"
+	CommunicationNote      CommunicationKind = "note"
+)
+
+// CommunicationKinds lists the communication kinds in display order.
+var CommunicationKinds = []CommunicationKind{CommunicationCall, CommunicationEmail, CommunicationVisit, CommunicationComplaint, CommunicationNote}
+
+// Label returns the communication kind for display.
+func (k CommunicationKind) Label() string {
+	switch k {
+	case CommunicationCall:
+		return "Call"
+	case CommunicationEmail:
+		return "Email"
+	case CommunicationVisit:
+		return "Visit"
+	case CommunicationComplaint:
+		return "Complaint"
+	case CommunicationNote:
+		return "Note"
+	}
+	return string(k)
+}
+
+// CustomerCommunication is an entry in a customer's communication log.
+type CustomerCommunication struct {
+	CustomerCommunicationID int64
+	CustomerID              int64
+	CustomerContactID       *int64
+	Kind                    CommunicationKind
+	OccurredAt              time.Time
+	Subject                 string
+	Notes                   *string
+	Audit                   AuditFields
+
+	// Relations
+	ContactName *string
+}
+
+// CustomerDetails gathers the CRM records shown on a customer's page.
+type CustomerDetails struct {
+	Contacts       []*CustomerContact
+	Addresses      []*CustomerAddress
+	Communications []*CustomerCommunication // newest first
+}
+
+// ParseTags splits a comma separated list into tags: trimmed, lower case, without duplicates and
+// sorted.
+func ParseTags(s string) []string {
+	var tags []string
+	for _, part := range strings.Split(s, ",") {
+		tag := strings.ToLower(strings.TrimSpace(part))
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	return tags
+}
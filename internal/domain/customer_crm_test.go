@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	got := ParseTags(" Weekly, organic,, weekly ,Restaurant ")
+	want := []string{"organic", "restaurant", "weekly"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseTags = %q, want %q", got, want)
+	}
+	if got := ParseTags(" , "); got != nil {
+		t.Errorf("ParseTags of blanks = %q, want none", got)
+	}
+}
+
+func TestCustomer_InvoiceAddress(t *testing.T) {
+	delivery, billing := "Farm Road 1", "Main Street 2"
+	c := &Customer{DeliveryAddress: &delivery}
+	if got := c.InvoiceAddress(); got == nil || *got != delivery {
+		t.Errorf("without billing address got %v, want the delivery address", got)
+	}
+	c.BillingAddress = &billing
+	if got := c.InvoiceAddress(); got == nil || *got != billing {
+		t.Errorf("with billing address got %v, want the billing address", got)
+	}
+}
@@ -0,0 +1,76 @@
+package domain
+
+import "time"
+
+// BarnOccupancy is the live birds in a barn against its capacity.
+type BarnOccupancy struct {
+	BarnID    int64
+	Name      string
+	Capacity  *int
+	LiveBirds int
+}
+
+// Utilisation returns the live birds as a fraction of the capacity; ok is false when the barn
+// has no capacity recorded.
+func (b *BarnOccupancy) Utilisation() (fraction float64, ok bool) {
+	if b.Capacity == nil || *b.Capacity <= 0 {
+		return 0, false
+	}
+	return float64(b.LiveBirds) / float64(*b.Capacity), true
+}
+
+// MortalityDay is the birds found dead on a day against the birds alive at the start of it.
+type MortalityDay struct {
+	Date  time.Time
+	Dead  int
+	Birds int
+}
+
+// Rate returns the day's deaths as a fraction of the birds alive at the start of the day; ok is
+// false when there were no birds.
+func (d MortalityDay) Rate() (rate float64, ok bool) {
+	if d.Birds <= 0 {
+		return 0, false
+	}
+	return float64(d.Dead) / float64(d.Birds), true
+}
+
+// MortalityTrend returns the mortality of the given number of days up to and including today,
+// oldest first. The birds alive at the start of a day are worked back from the birds alive now
+// by adding the birds that died or were slaughtered from that day on. dead and slaughtered are
+// keyed by day as YYYY-MM-DD.
+func MortalityTrend(today time.Time, days, liveBirds int, dead, slaughtered map[string]int) []MortalityDay {
+	trend := make([]MortalityDay, days)
+	birds := liveBirds
+	for i := days - 1; i >= 0; i-- {
+		day := today.AddDate(0, 0, i-days+1)
+		key := day.Format("2006-01-02")
+		birds += dead[key] + slaughtered[key]
+		trend[i] = MortalityDay{Date: day, Dead: dead[key], Birds: birds}
+	}
+	return trend
+}
+
+// FlockFeed is the feed given to a flock on a day against its planned daily ration.
+type FlockFeed struct {
+	FlockID   int64
+	Breed     string
+	BarnName  *string
+	PlannedKg *float64
+	GivenKg   float64
+}
+
+// Progress returns the feed given as a fraction of the ration; ok is false when the flock has
+// no ration planned.
+func (f *FlockFeed) Progress() (fraction float64, ok bool) {
+	if f.PlannedKg == nil || *f.PlannedKg <= 0 {
+		return 0, false
+	}
+	return f.GivenKg / *f.PlannedKg, true
+}
+
+// OrderStatusCount is the number of orders in a status.
+type OrderStatusCount struct {
+	Status OrderStatus
+	Orders int
+}
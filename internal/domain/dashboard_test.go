@@ -0,0 +1,30 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMortalityTrend(t *testing.T) {
+	today := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	trend := MortalityTrend(today, 3, 90,
+		map[string]int{"2026-10-17": 4, "2026-10-19": 1},
+		map[string]int{"2026-10-18": 5},
+	)
+
+	if len(trend) != 3 || !trend[0].Date.Equal(today.AddDate(0, 0, -2)) || !trend[2].Date.Equal(today) {
+		t.Fatalf("trend = %+v, want the 17th to the 19th", trend)
+	}
+	// 90 alive now; 1 died today, 5 were slaughtered yesterday and 4 died the day before.
+	for i, want := range []MortalityDay{{Dead: 4, Birds: 100}, {Dead: 0, Birds: 96}, {Dead: 1, Birds: 91}} {
+		if trend[i].Dead != want.Dead || trend[i].Birds != want.Birds {
+			t.Errorf("day %d = %+v, want %d dead of %d", i, trend[i], want.Dead, want.Birds)
+		}
+	}
+	if rate, ok := trend[0].Rate(); !ok || rate != 0.04 {
+		t.Errorf("rate = %v, want 0.04", rate)
+	}
+	if _, ok := (MortalityDay{}).Rate(); ok {
+		t.Error("a day without birds should have no rate")
+	}
+}
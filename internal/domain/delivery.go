@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrRunNotPlanned is returned when changing the stops of a run that has left the farm.
+	ErrRunNotPlanned = errors.New("stops can only change while the run is planned")
+	// ErrRunNotDispatched is returned when closing a stop of a run that has not left the farm.
+	ErrRunNotDispatched = errors.New("the run has not been dispatched")
+	// ErrRunEmpty is returned when dispatching a run without stops.
+	ErrRunEmpty = errors.New("the run has no stops")
+	// ErrOrderNotReady is returned when putting an order on a run before its stock is reserved
+	// or after it was delivered.
+	ErrOrderNotReady = errors.New("only reserved or picked orders can go on a delivery run")
+	// ErrOrderOnRun is returned when an order is already on another open delivery run.
+	ErrOrderOnRun = errors.New("the order is already on a delivery run")
+	// ErrStopClosed is returned when closing a stop that was already delivered or failed.
+	ErrStopClosed = errors.New("the stop was already closed")
+)
+
+// DeliveryRunStatus is where a delivery run stands.
+type DeliveryRunStatus string
+
+const (
+	DeliveryRunPlanned    DeliveryRunStatus = "planned"
+	DeliveryRunDispatched DeliveryRunStatus = "dispatched"
+	DeliveryRunCompleted  DeliveryRunStatus = "completed"
+)
+
+// Label returns the status for display.
+func (s DeliveryRunStatus) Label() string {
+	switch s {
+	case DeliveryRunPlanned:
+		return "Planned"
+	case DeliveryRunDispatched:
+		return "Out for delivery"
+	case DeliveryRunCompleted:
+		return "Completed"
+	}
+	return string(s)
+}
+
+// DeliveryRun groups the orders delivered on a day by one driver, in the order the stops are visited.
+type DeliveryRun struct {
+	DeliveryRunID   int64
+	RunDate         time.Time
+	DriverID        *int64
+	Status          DeliveryRunStatus
+	TotalDistanceKm *float64 // planned route length, including the drive back to the farm
+	Notes           *string
+	Audit           AuditFields
+
+	// Relations
+	DriverName *string
+	Stops      []*DeliveryStop
+	StopCount  int
+	OpenStops  int
+}
+
+// DeliveryStopStatus is the outcome of a stop.
+type DeliveryStopStatus string
+
+const (
+	DeliveryStopPending   DeliveryStopStatus = "pending"
+	DeliveryStopDelivered DeliveryStopStatus = "delivered"
+	DeliveryStopFailed    DeliveryStopStatus = "failed"
+)
+
+// Label returns the status for display.
+func (s DeliveryStopStatus) Label() string {
+	switch s {
+	case DeliveryStopPending:
+		return "Pending"
+	case DeliveryStopDelivered:
+		return "Delivered"
+	case DeliveryStopFailed:
+		return "Not delivered"
+	}
+	return string(s)
+}
+
+// DeliveryStop delivers one order on a run. A delivered stop keeps the name and signature of
+// whoever received the goods; a failed stop leaves the order to be put on another run.
+type DeliveryStop struct {
+	DeliveryStopID int64
+	DeliveryRunID  int64
+	OrderID        int64
+	Sequence       int
+	LegDistanceKm  *float64 // from the previous stop, or from the farm for the first stop
+	Status         DeliveryStopStatus
+	DeliveredAt    *time.Time
+	RecipientName  *string
+	Signature      *string // PNG data URL captured on the driver's device
+	Notes          *string
+
+	// Relations
+	Order *Order // with Customer
+}
@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrLastOwner is returned when a change would leave a farm without an owner.
+	ErrLastOwner = errors.New("a farm needs at least one owner")
+	// ErrSameFarm is returned when transferring to the farm the record is already on.
+	ErrSameFarm = errors.New("choose a different farm to transfer to")
+	// ErrTransferQuantity is returned when transferring more than there is, or nothing.
+	ErrTransferQuantity = errors.New("the quantity must be more than zero and no more than is in stock")
+	// ErrFlockHasBatches is returned when transferring a flock that has production batches: their
+	// slaughter records, lots and sales belong to the farm that produced them.
+	ErrFlockHasBatches = errors.New("the flock has production batches, so it stays on this farm")
+	// ErrTransferNeedsBarn is returned when a flock with checklists or logged hours is transferred
+	// without a barn to move them to.
+	ErrTransferNeedsBarn = errors.New("the flock has checklists or logged hours; choose a barn on the farm it moves to")
+)
+
+// Farm is one site of the business. Operational records (barns, flocks, orders, stock, ...)
+// belong to exactly one farm; the product catalog and price lists are shared by all of them.
+type Farm struct {
+	FarmID   int64
+	Name     string
+	Location *string
+	Audit    AuditFields
+}
+
+// Validate checks the farm has a name.
+func (f *Farm) Validate() error {
+	f.Name = strings.TrimSpace(f.Name)
+	if f.Name == "" {
+		return errors.New("farm name is required")
+	}
+	return nil
+}
+
+// FarmRole is what a user may do on a farm.
+type FarmRole string
+
+const (
+	// FarmRoleOwner runs the farm: everything a manager does, plus its members and the reports
+	// across every farm the user owns.
+	FarmRoleOwner FarmRole = "owner"
+	// FarmRoleManager does the day-to-day work and moves flocks and stock to other farms.
+	FarmRoleManager FarmRole = "manager"
+	// FarmRoleWorker does the day-to-day work.
+	FarmRoleWorker FarmRole = "worker"
+)
+
+// FarmRoles lists the roles from most to least privileged.
+var FarmRoles = []FarmRole{FarmRoleOwner, FarmRoleManager, FarmRoleWorker}
+
+// Valid reports whether r is a known role.
+func (r FarmRole) Valid() bool {
+	for _, role := range FarmRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AtLeast reports whether r grants everything min does.
+func (r FarmRole) AtLeast(min FarmRole) bool {
+	return r.rank() >= min.rank()
+}
+
+func (r FarmRole) rank() int {
+	switch r {
+	case FarmRoleOwner:
+		return 3
+	case FarmRoleManager:
+		return 2
+	case FarmRoleWorker:
+		return 1
+	}
+	return 0
+}
+
+// FarmMembership gives a user a role on a farm.
+type FarmMembership struct {
+	FarmID   int64
+	FarmName string
+	UserID   int64
+	Username string
+	Role     FarmRole
+}
+
+// FarmSummary is one farm's line of the cross-farm report.
+type FarmSummary struct {
+	FarmID   int64
+	FarmName string
+	// Flocks and Birds are the active flocks and the birds alive in them.
+	Flocks int64
+	Birds  int64
+	// Deaths and FeedKg cover the report period.
+	Deaths int64
+	FeedKg float64
+	// OpenOrders are the orders that still need work: not paid, cancelled or returned.
+	OpenOrders int64
+	// Invoiced is the total of the invoices issued in the period, credit notes deducted.
+	Invoiced float64
+	// StockLots are the product lots not yet shipped in full.
+	StockLots int64
+	// LabourCost is the cost of the time worked in the period.
+	LabourCost float64
+}
+
+// FarmSummaryTotals adds the summaries of several farms together.
+func FarmSummaryTotals(rows []*FarmSummary) FarmSummary {
+	var t FarmSummary
+	for _, r := range rows {
+		t.Flocks += r.Flocks
+		t.Birds += r.Birds
+		t.Deaths += r.Deaths
+		t.FeedKg += r.FeedKg
+		t.OpenOrders += r.OpenOrders
+		t.Invoiced += r.Invoiced
+		t.StockLots += r.StockLots
+		t.LabourCost += r.LabourCost
+	}
+	return t
+}
@@ -0,0 +1,35 @@
+package domain
+
+import "testing"
+
+func TestFarmRole_AtLeast(t *testing.T) {
+	cases := []struct {
+		role, min FarmRole
+		want      bool
+	}{
+		{FarmRoleOwner, FarmRoleManager, true},
+		{FarmRoleManager, FarmRoleManager, true},
+		{FarmRoleWorker, FarmRoleManager, false},
+		{FarmRoleWorker, FarmRoleWorker, true},
+		{FarmRole("guest"), FarmRoleWorker, false},
+	}
+	for _, c := range cases {
+		if got := c.role.AtLeast(c.min); got != c.want {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", c.role, c.min, got, c.want)
+		}
+	}
+	if FarmRole("guest").Valid() {
+		t.Error("unknown role reported valid")
+	}
+}
+
+func TestFarmSummaryTotals(t *testing.T) {
+	totals := FarmSummaryTotals([]*FarmSummary{
+		{Flocks: 2, Birds: 300, Deaths: 4, FeedKg: 120.5, OpenOrders: 3, Invoiced: 1500, StockLots: 5, LabourCost: 220},
+		{Flocks: 1, Birds: 150, Deaths: 1, FeedKg: 60, OpenOrders: 0, Invoiced: 250.25, StockLots: 2, LabourCost: 80},
+	})
+	want := FarmSummary{Flocks: 3, Birds: 450, Deaths: 5, FeedKg: 180.5, OpenOrders: 3, Invoiced: 1750.25, StockLots: 7, LabourCost: 300}
+	if totals != want {
+		t.Errorf("totals = %+v, want %+v", totals, want)
+	}
+}
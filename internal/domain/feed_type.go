@@ -2,9 +2,11 @@ package domain
 
 // FeedType represents different types of feed available
 type FeedType struct {
-	FeedTypeID      int64
-	Name            string
-	Description     *string
-	NutritionalInfo *string
-	Audit           AuditFields
+	FeedTypeID       int64
+	Name             string
+	Description      *string
+	NutritionalInfo  *string
+	OrganicCertified bool
+	CostPerKg        *float64
+	Audit            AuditFields
 }
@@ -8,6 +8,7 @@ type FeedingRecord struct {
 	FlockID         int64
 	FeedTypeID      int64
 	AmountGiven     *float64
+	LotNumber       *string
 	DateTime        sql.NullTime
 	StaffID         *int64
 	Audit           AuditFields
@@ -12,6 +12,7 @@ type Flock struct {
 	BarnID        *int64
 	HealthStatus  *string
 	FeedTypeID    *int64
+	DailyFeedKg   *float64
 	Notes         *string
 	Audit         AuditFields
 
@@ -0,0 +1,568 @@
+package domain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrImportCommitted is returned when committing an upload whose rows were already imported.
+var ErrImportCommitted = errors.New("the rows of this upload were already imported")
+
+// ImportEntity is the kind of record a spreadsheet import creates.
+type ImportEntity string
+
+const (
+	ImportFeeding   ImportEntity = "feeding"
+	ImportMortality ImportEntity = "mortality"
+	// ImportSales creates orders; rows sharing an order reference become the lines of one order.
+	ImportSales ImportEntity = "sales"
+)
+
+// ImportEntities lists what can be imported, in menu order.
+var ImportEntities = []ImportEntity{ImportFeeding, ImportMortality, ImportSales}
+
+// ParseImportEntity returns the entity named s.
+func ParseImportEntity(s string) (ImportEntity, bool) {
+	for _, e := range ImportEntities {
+		if string(e) == s {
+			return e, true
+		}
+	}
+	return "", false
+}
+
+// Label names the entity for display.
+func (e ImportEntity) Label() string {
+	switch e {
+	case ImportFeeding:
+		return "Feeding records"
+	case ImportMortality:
+		return "Mortality records"
+	case ImportSales:
+		return "Sales"
+	}
+	return string(e)
+}
+
+// ImportField is a value an import reads from a column of the sheet.
+type ImportField struct {
+	Key      string
+	Label    string
+	Required bool
+	Hint     string // how the value is written
+}
+
+const (
+	hintDate     = "YYYY-MM-DD, or a spreadsheet date"
+	hintDateTime = "YYYY-MM-DD HH:MM, or a spreadsheet date"
+)
+
+// flockFields identify the flock a feeding or mortality row belongs to: its breed, narrowed down
+// by hatch date and barn when the farm has several flocks of the breed.
+var flockFields = []ImportField{
+	{Key: "flock_breed", Label: "Flock breed", Required: true},
+	{Key: "hatch_date", Label: "Hatch date", Hint: hintDate},
+	{Key: "barn", Label: "Barn", Hint: "barn name"},
+}
+
+// Fields lists the values the entity's import reads.
+func (e ImportEntity) Fields() []ImportField {
+	switch e {
+	case ImportFeeding:
+		return append(append([]ImportField{}, flockFields...),
+			ImportField{Key: "feed_type", Label: "Feed type", Required: true, Hint: "feed type name"},
+			ImportField{Key: "date", Label: "Date", Required: true, Hint: hintDateTime},
+			ImportField{Key: "amount_kg", Label: "Amount (kg)", Required: true},
+			ImportField{Key: "lot_number", Label: "Lot number"},
+		)
+	case ImportMortality:
+		return append(append([]ImportField{}, flockFields...),
+			ImportField{Key: "date", Label: "Date", Required: true, Hint: hintDate},
+			ImportField{Key: "number_dead", Label: "Number dead", Required: true},
+			ImportField{Key: "cause", Label: "Cause of death"},
+			ImportField{Key: "notes", Label: "Notes"},
+		)
+	case ImportSales:
+		return []ImportField{
+			{Key: "order_ref", Label: "Order reference", Hint: "rows with the same reference make one order"},
+			{Key: "customer", Label: "Customer", Required: true, Hint: "customer name"},
+			{Key: "order_date", Label: "Order date", Required: true, Hint: hintDate},
+			{Key: "product", Label: "Product", Required: true, Hint: "SKU or product name"},
+			{Key: "description", Label: "Description"},
+			{Key: "quantity", Label: "Quantity", Required: true},
+			{Key: "unit_price", Label: "Unit price", Required: true},
+			{Key: "vat_rate", Label: "VAT rate (%)", Hint: "the product's rate when empty"},
+			{Key: "status", Label: "Status", Hint: "delivered, cancelled or draft; delivered when empty"},
+		}
+	}
+	return nil
+}
+
+// ImportMapping maps the key of each field to the heading of the column holding it. Headings
+// rather than positions are kept, so a saved mapping fits next year's sheet with moved columns.
+type ImportMapping map[string]string
+
+// GuessImportMapping maps the fields to the columns whose heading is the field's label or key,
+// ignoring case, spaces and punctuation.
+func GuessImportMapping(e ImportEntity, header []string) ImportMapping {
+	m := ImportMapping{}
+	for _, f := range e.Fields() {
+		for _, h := range header {
+			if k := headingKey(h); k != "" && (k == headingKey(f.Label) || k == headingKey(f.Key)) {
+				m[f.Key] = h
+				break
+			}
+		}
+	}
+	return m
+}
+
+// Validate reports the required fields that have no column and the columns the header lacks.
+func (m ImportMapping) Validate(e ImportEntity, header []string) map[string]string {
+	errs := map[string]string{}
+	for _, f := range e.Fields() {
+		heading := m[f.Key]
+		switch {
+		case heading == "" && f.Required:
+			errs[f.Key] = "Choose the column holding the " + strings.ToLower(f.Label)
+		case heading != "" && columnOf(header, heading) < 0:
+			errs[f.Key] = "The sheet has no column " + heading
+		}
+	}
+	return errs
+}
+
+func headingKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+func columnOf(header []string, heading string) int {
+	for i, h := range header {
+		if h == heading {
+			return i
+		}
+	}
+	return -1
+}
+
+// ImportNames finds records by name, ignoring case and surrounding spaces. Names that more than
+// one record has are ambiguous.
+type ImportNames map[string]int64
+
+// Add records the ID of a record called name.
+func (n ImportNames) Add(name string, id int64) {
+	key := strings.ToLower(strings.TrimSpace(name))
+	if key == "" {
+		return
+	}
+	if prev, ok := n[key]; ok && prev != id {
+		id = 0
+	}
+	n[key] = id
+}
+
+// Find returns the ID of the record called name. what names the kind of record in errors.
+func (n ImportNames) Find(what, name string) (int64, error) {
+	id, ok := n[strings.ToLower(strings.TrimSpace(name))]
+	switch {
+	case !ok:
+		return 0, fmt.Errorf("no %s is called %q", what, name)
+	case id == 0:
+		return 0, fmt.Errorf("more than one %s is called %q", what, name)
+	}
+	return id, nil
+}
+
+// ImportLookups are the farm's records the names in a sheet resolve to.
+type ImportLookups struct {
+	Barns     ImportNames
+	Flocks    []*Flock
+	FeedTypes ImportNames
+	Customers ImportNames
+	Products  ImportNames // by SKU and by name
+	// ProductVAT is the VAT rate of each product, for sales without one.
+	ProductVAT map[int64]float64
+}
+
+// NewImportLookups returns empty lookups for the data layer to fill.
+func NewImportLookups() *ImportLookups {
+	return &ImportLookups{
+		Barns:      ImportNames{},
+		FeedTypes:  ImportNames{},
+		Customers:  ImportNames{},
+		Products:   ImportNames{},
+		ProductVAT: map[int64]float64{},
+	}
+}
+
+// flock finds the one flock of the breed that also matches the hatch date and barn when given.
+func (l *ImportLookups) flock(breed, hatch, barn string) (int64, error) {
+	var hatchDate *time.Time
+	if hatch != "" {
+		d, err := parseImportTime(hatch)
+		if err != nil {
+			return 0, fmt.Errorf("hatch date: %w", err)
+		}
+		hatchDate = &d
+	}
+	var barnID int64
+	if barn != "" {
+		id, err := l.Barns.Find("barn", barn)
+		if err != nil {
+			return 0, err
+		}
+		barnID = id
+	}
+
+	var found []int64
+	for _, f := range l.Flocks {
+		if !strings.EqualFold(strings.TrimSpace(f.Breed), breed) {
+			continue
+		}
+		if hatchDate != nil && (f.HatchDate == nil || f.HatchDate.Format("2006-01-02") != hatchDate.Format("2006-01-02")) {
+			continue
+		}
+		if barnID != 0 && (f.BarnID == nil || *f.BarnID != barnID) {
+			continue
+		}
+		found = append(found, f.FlockID)
+	}
+	switch len(found) {
+	case 0:
+		return 0, fmt.Errorf("no %s flock matches", breed)
+	case 1:
+		return found[0], nil
+	}
+	return 0, fmt.Errorf("%d %s flocks match; map the hatch date or barn", len(found), breed)
+}
+
+// ImportSheetRow is a data row of an uploaded sheet with its row number in the file.
+type ImportSheetRow struct {
+	Line  int      `json:"line"`
+	Cells []string `json:"cells"`
+}
+
+// ImportUpload is a sheet uploaded for import, kept until its rows are committed.
+type ImportUpload struct {
+	UploadID     int64
+	Entity       ImportEntity
+	Filename     string
+	Header       []string
+	Rows         []ImportSheetRow
+	ImportedRows *int
+	CommittedAt  *time.Time
+	Audit        AuditFields
+}
+
+// SavedImportMapping is a column mapping kept under a name for later imports of the entity.
+type SavedImportMapping struct {
+	MappingID int64
+	Entity    ImportEntity
+	Name      string
+	Columns   ImportMapping
+	Audit     AuditFields
+}
+
+// ImportRow is a row of the dry run: its values by field and what is wrong with it.
+type ImportRow struct {
+	Line   int
+	Values map[string]string
+	Errors []string
+}
+
+// OK reports whether the row is accepted.
+func (r *ImportRow) OK() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *ImportRow) fail(err error) {
+	r.Errors = append(r.Errors, err.Error())
+}
+
+// ImportSale is an order of a sales import with its lines and the rows they came from.
+type ImportSale struct {
+	Ref   string
+	Order *Order
+	Lines []*OrderItem
+	Rows  []*ImportRow
+}
+
+// ImportBatch is the dry run of an import: every row with its errors, and the records the
+// accepted rows make.
+type ImportBatch struct {
+	Entity    ImportEntity
+	Rows      []*ImportRow
+	Feeding   []*FeedingRecord
+	Mortality []*MortalityRecord
+	Sales     []*ImportSale
+}
+
+// Accepted returns the number of rows that will be imported.
+func (b *ImportBatch) Accepted() int {
+	n := 0
+	for _, r := range b.Rows {
+		if r.OK() {
+			n++
+		}
+	}
+	return n
+}
+
+// Build runs the upload through the mapping: it reads and checks every row, resolves the names
+// in it and collects the records of the rows without errors. It writes nothing.
+func (u *ImportUpload) Build(m ImportMapping, l *ImportLookups) *ImportBatch {
+	b := &ImportBatch{Entity: u.Entity}
+	fields := u.Entity.Fields()
+	sales := map[string]*ImportSale{}
+	for _, sr := range u.Rows {
+		row := &ImportRow{Line: sr.Line, Values: map[string]string{}}
+		for _, f := range fields {
+			if i := columnOf(u.Header, m[f.Key]); i >= 0 && i < len(sr.Cells) {
+				row.Values[f.Key] = strings.TrimSpace(sr.Cells[i])
+			}
+			if f.Required && row.Values[f.Key] == "" {
+				row.Errors = append(row.Errors, f.Label+" is required")
+			}
+		}
+		b.Rows = append(b.Rows, row)
+		if !row.OK() {
+			if u.Entity == ImportSales {
+				holdSale(row, sales, &b.Sales)
+			}
+			continue
+		}
+		switch u.Entity {
+		case ImportFeeding:
+			if rec := buildFeeding(row, l); row.OK() {
+				b.Feeding = append(b.Feeding, rec)
+			}
+		case ImportMortality:
+			if rec := buildMortality(row, l); row.OK() {
+				b.Mortality = append(b.Mortality, rec)
+			}
+		case ImportSales:
+			buildSale(row, l, sales, &b.Sales)
+		}
+	}
+
+	// An order goes in whole or not at all: a bad line holds back the other lines of its order.
+	if u.Entity == ImportSales {
+		kept := b.Sales[:0]
+		for _, sale := range b.Sales {
+			bad := false
+			for _, r := range sale.Rows {
+				if !r.OK() {
+					bad = true
+				}
+			}
+			if !bad {
+				kept = append(kept, sale)
+				continue
+			}
+			for _, r := range sale.Rows {
+				if r.OK() {
+					r.Errors = append(r.Errors, "another row of order "+sale.Ref+" has errors")
+				}
+			}
+		}
+		b.Sales = kept
+	}
+	return b
+}
+
+func buildFeeding(row *ImportRow, l *ImportLookups) *FeedingRecord {
+	v := row.Values
+	rec := &FeedingRecord{}
+	var err error
+	if rec.FlockID, err = l.flock(v["flock_breed"], v["hatch_date"], v["barn"]); err != nil {
+		row.fail(err)
+	}
+	if rec.FeedTypeID, err = l.FeedTypes.Find("feed type", v["feed_type"]); err != nil {
+		row.fail(err)
+	}
+	if at, err := parseImportTime(v["date"]); err != nil {
+		row.fail(fmt.Errorf("date: %w", err))
+	} else {
+		rec.DateTime = sql.NullTime{Time: at, Valid: true}
+	}
+	if kg, err := parseImportNumber(v["amount_kg"]); err != nil || kg <= 0 {
+		row.fail(errors.New("amount must be a number of kg above zero"))
+	} else {
+		rec.AmountGiven = &kg
+	}
+	if lot := v["lot_number"]; lot != "" {
+		rec.LotNumber = &lot
+	}
+	return rec
+}
+
+func buildMortality(row *ImportRow, l *ImportLookups) *MortalityRecord {
+	v := row.Values
+	rec := &MortalityRecord{}
+	var err error
+	if rec.FlockID, err = l.flock(v["flock_breed"], v["hatch_date"], v["barn"]); err != nil {
+		row.fail(err)
+	}
+	if day, err := parseImportTime(v["date"]); err != nil {
+		row.fail(fmt.Errorf("date: %w", err))
+	} else {
+		rec.Date = &day
+	}
+	if n, err := parseImportNumber(v["number_dead"]); err != nil || n < 1 || n != math.Trunc(n) {
+		row.fail(errors.New("number dead must be a whole number above zero"))
+	} else {
+		dead := int(n)
+		rec.NumberDead = &dead
+	}
+	if cause := v["cause"]; cause != "" {
+		rec.CauseOfDeath = &cause
+	}
+	if notes := v["notes"]; notes != "" {
+		rec.Notes = &notes
+	}
+	return rec
+}
+
+// buildSale adds the row as a line of its order, starting the order on its first row. Rows
+// without an order reference are orders of their own.
+func buildSale(row *ImportRow, l *ImportLookups, orders map[string]*ImportSale, sales *[]*ImportSale) {
+	v := row.Values
+	customerID, err := l.Customers.Find("customer", v["customer"])
+	if err != nil {
+		row.fail(err)
+	}
+	day, err := parseImportTime(v["order_date"])
+	if err != nil {
+		row.fail(fmt.Errorf("order date: %w", err))
+	}
+	status := OrderStatusDelivered
+	if s := v["status"]; s != "" {
+		var ok bool
+		if status, ok = ParseOrderStatus(s); !ok || !importOrderStatus(status) {
+			row.fail(fmt.Errorf("status %q cannot be imported; use delivered, cancelled or draft", s))
+		}
+	}
+
+	line := &OrderItem{}
+	productID, err := l.Products.Find("product", v["product"])
+	if err != nil {
+		row.fail(err)
+	} else {
+		line.ProductID = &productID
+		line.VATRate = l.ProductVAT[productID]
+	}
+	if d := v["description"]; d != "" {
+		line.ProductDescription = &d
+	}
+	if q, err := parseImportNumber(v["quantity"]); err != nil || q <= 0 {
+		row.fail(errors.New("quantity must be a number above zero"))
+	} else {
+		line.Quantity = &q
+	}
+	if p, err := parseImportNumber(v["unit_price"]); err != nil || p < 0 {
+		row.fail(errors.New("unit price must be a number of zero or more"))
+	} else {
+		line.UnitPrice = &p
+	}
+	if s := v["vat_rate"]; s != "" {
+		if rate, err := parseImportNumber(strings.TrimSuffix(s, "%")); err != nil || rate < 0 {
+			row.fail(errors.New("VAT rate must be a percentage"))
+		} else {
+			line.VATRate = rate
+		}
+	}
+
+	ref := v["order_ref"]
+	sale, ok := orders[ref]
+	if ref == "" || !ok {
+		if ref == "" {
+			ref = "in row " + strconv.Itoa(row.Line)
+		}
+		sale = &ImportSale{Ref: ref, Order: &Order{CustomerID: customerID, OrderDate: &day, Status: status}}
+		orders[ref] = sale
+		*sales = append(*sales, sale)
+	} else if row.OK() && sale.Rows[0].OK() {
+		if sale.Order.CustomerID != customerID {
+			row.fail(fmt.Errorf("order %s has another customer in an earlier row", ref))
+		}
+		if !sale.Order.OrderDate.Equal(day) {
+			row.fail(fmt.Errorf("order %s has another date in an earlier row", ref))
+		}
+	}
+	sale.Rows = append(sale.Rows, row)
+	if row.OK() {
+		sale.Lines = append(sale.Lines, line)
+	}
+}
+
+// holdSale adds a row that failed before it could be read to the order its reference names, so
+// the order is held back with it. Rows without a reference are orders of their own.
+func holdSale(row *ImportRow, orders map[string]*ImportSale, sales *[]*ImportSale) {
+	ref := row.Values["order_ref"]
+	if ref == "" {
+		return
+	}
+	sale, ok := orders[ref]
+	if !ok {
+		sale = &ImportSale{Ref: ref}
+		orders[ref] = sale
+		*sales = append(*sales, sale)
+	}
+	sale.Rows = append(sale.Rows, row)
+}
+
+// importOrderStatus reports whether an imported order may have the status. Statuses that stand
+// for reserved stock, an invoice or a payment need those records, which an import does not make.
+func importOrderStatus(s OrderStatus) bool {
+	switch s {
+	case OrderStatusDraft, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// importTimeLayouts are the written forms of dates and times an import reads.
+var importTimeLayouts = []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// excelEpoch is day zero of spreadsheet serial dates (1900 date system, with its leap-year bug).
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
+
+// parseImportTime reads a date or date and time as the farm's local time.
+func parseImportTime(s string) (time.Time, error) {
+	for _, layout := range importTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	// Spreadsheets store dates as days since their epoch, the time of day as the fraction.
+	if days, err := strconv.ParseFloat(s, 64); err == nil && days >= 1 && days < 2958466 {
+		whole := math.Floor(days)
+		t := excelEpoch.AddDate(0, 0, int(whole))
+		return t.Add(time.Duration(math.Round((days-whole)*86400)) * time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date; write it as YYYY-MM-DD", s)
+}
+
+// parseImportNumber reads a number written with a decimal point or comma.
+func parseImportNumber(s string) (float64, error) {
+	s = strings.ReplaceAll(s, " ", "")
+	if strings.Contains(s, ",") {
+		if strings.Contains(s, ".") {
+			s = strings.ReplaceAll(s, ",", "") // 1,234.5
+		} else {
+			s = strings.ReplaceAll(s, ",", ".") // 12,5
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
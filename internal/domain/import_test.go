@@ -0,0 +1,159 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuessImportMapping(t *testing.T) {
+	header := []string{"Flock Breed", "Feed", "Amount (kg)", "date", "Lot-Number"}
+	got := GuessImportMapping(ImportFeeding, header)
+	want := ImportMapping{"flock_breed": "Flock Breed", "amount_kg": "Amount (kg)", "date": "date", "lot_number": "Lot-Number"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("guess = %v, want %v", got, want)
+	}
+
+	errs := got.Validate(ImportFeeding, header)
+	if _, ok := errs["feed_type"]; !ok || len(errs) != 1 {
+		t.Errorf("errors = %v, want the feed type only", errs)
+	}
+	got["feed_type"] = "Feed name"
+	if errs := got.Validate(ImportFeeding, header); !strings.Contains(errs["feed_type"], "no column") {
+		t.Errorf("missing column: errors = %v", errs)
+	}
+}
+
+func TestImportUpload_BuildFeeding(t *testing.T) {
+	day := func(s string) *time.Time {
+		d, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return &d
+	}
+	barn := int64(4)
+	l := NewImportLookups()
+	l.Barns.Add("North shed", 4)
+	l.FeedTypes.Add("Grower", 2)
+	l.FeedTypes.Add("Finisher", 3)
+	l.FeedTypes.Add("finisher ", 5)
+	l.Flocks = []*Flock{
+		{FlockID: 10, Breed: "Bronze", HatchDate: day("2024-03-01"), BarnID: &barn},
+		{FlockID: 11, Breed: "Bronze", HatchDate: day("2024-05-01")},
+		{FlockID: 12, Breed: "White", HatchDate: day("2024-05-01")},
+	}
+
+	u := &ImportUpload{
+		Entity: ImportFeeding,
+		Header: []string{"Breed", "Hatched", "Shed", "Feed", "When", "Kg"},
+		Rows: []ImportSheetRow{
+			{Line: 2, Cells: []string{"white", "", "", "Grower", "2024-06-01 07:30", "12,5"}},
+			{Line: 3, Cells: []string{"Bronze", "45352", "", "grower", "45444.25", "20"}},
+			{Line: 4, Cells: []string{"Bronze", "", "North shed", "Grower", "2024-06-01", "8"}},
+			{Line: 5, Cells: []string{"Bronze", "", "", "Finisher", "01/06/2024", "-1"}},
+			{Line: 6, Cells: []string{"", "", "", "Grower", "2024-06-01", "3"}},
+		},
+	}
+	m := ImportMapping{"flock_breed": "Breed", "hatch_date": "Hatched", "barn": "Shed", "feed_type": "Feed", "date": "When", "amount_kg": "Kg"}
+	b := u.Build(m, l)
+
+	if got := b.Accepted(); got != 3 {
+		t.Fatalf("accepted = %d, want 3 (rows: %+v)", got, b.Rows)
+	}
+	first := b.Feeding[0]
+	if first.FlockID != 12 || first.FeedTypeID != 2 || *first.AmountGiven != 12.5 || first.DateTime.Time.Format("2006-01-02 15:04") != "2024-06-01 07:30" {
+		t.Errorf("first record = %+v", first)
+	}
+	// The serial hatch date picks the March flock; the serial time carries the time of day.
+	if second := b.Feeding[1]; second.FlockID != 10 || second.DateTime.Time.Format("2006-01-02 15:04") != "2024-06-01 06:00" {
+		t.Errorf("second record = %+v (%v)", second, second.DateTime.Time)
+	}
+	if third := b.Feeding[2]; third.FlockID != 10 {
+		t.Errorf("barn narrows to flock %d, want 10", third.FlockID)
+	}
+
+	bad := b.Rows[3].Errors
+	for _, want := range []string{"2 Bronze flocks match", "more than one feed type", "not a date", "amount must be"} {
+		found := false
+		for _, e := range bad {
+			found = found || strings.Contains(e, want)
+		}
+		if !found {
+			t.Errorf("row 5 errors %q lack %q", bad, want)
+		}
+	}
+	if errs := b.Rows[4].Errors; len(errs) != 1 || errs[0] != "Flock breed is required" {
+		t.Errorf("row 6 errors = %q", errs)
+	}
+}
+
+func TestImportUpload_BuildSalesKeepsOrdersWhole(t *testing.T) {
+	l := NewImportLookups()
+	l.Customers.Add("Butcher", 1)
+	l.Customers.Add("Deli", 2)
+	l.Products.Add("BR", 7)
+	l.Products.Add("Breast", 7)
+	l.ProductVAT[7] = 9
+
+	u := &ImportUpload{
+		Entity: ImportSales,
+		Header: []string{"Ref", "Customer", "Date", "Product", "Qty", "Price", "VAT"},
+		Rows: []ImportSheetRow{
+			{Line: 2, Cells: []string{"A1", "Butcher", "2023-12-01", "BR", "10", "12", ""}},
+			{Line: 3, Cells: []string{"A1", "Butcher", "2023-12-01", "breast", "2", "12", "21%"}},
+			{Line: 4, Cells: []string{"A2", "Deli", "2023-12-02", "BR", "3", "12", ""}},
+			{Line: 5, Cells: []string{"A2", "Deli", "2023-12-02", "Wings", "3", "5", ""}},
+			{Line: 6, Cells: []string{"", "Deli", "2023-12-03", "BR", "1", "12", ""}},
+		},
+	}
+	m := ImportMapping{"order_ref": "Ref", "customer": "Customer", "order_date": "Date", "product": "Product", "quantity": "Qty", "unit_price": "Price", "vat_rate": "VAT"}
+	b := u.Build(m, l)
+
+	if len(b.Sales) != 2 || b.Accepted() != 3 {
+		t.Fatalf("sales = %d, accepted = %d; want 2 orders from 3 rows (rows: %+v)", len(b.Sales), b.Accepted(), b.Rows)
+	}
+	a1 := b.Sales[0]
+	if a1.Ref != "A1" || a1.Order.CustomerID != 1 || a1.Order.Status != OrderStatusDelivered || len(a1.Lines) != 2 {
+		t.Errorf("order A1 = %+v with %d lines", a1.Order, len(a1.Lines))
+	}
+	if a1.Lines[0].VATRate != 9 || a1.Lines[1].VATRate != 21 {
+		t.Errorf("VAT rates = %v, %v; want 9 from the product and 21 from the sheet", a1.Lines[0].VATRate, a1.Lines[1].VATRate)
+	}
+	if errs := b.Rows[2].Errors; len(errs) != 1 || !strings.Contains(errs[0], "another row of order A2") {
+		t.Errorf("row 4 errors = %q, want held back by its order", errs)
+	}
+	if got := b.Sales[1].Ref; got != "in row 6" {
+		t.Errorf("unreferenced order = %q, want a row of its own", got)
+	}
+}
+
+func TestImportUpload_BuildSalesHoldsOrderOfRowWithEmptyCell(t *testing.T) {
+	l := NewImportLookups()
+	l.Customers.Add("Butcher", 1)
+	l.Products.Add("BR", 7)
+
+	u := &ImportUpload{
+		Entity: ImportSales,
+		Header: []string{"Ref", "Customer", "Date", "Product", "Qty", "Price", "Status"},
+		Rows: []ImportSheetRow{
+			{Line: 2, Cells: []string{"A1", "Butcher", "2023-12-01", "BR", "10", "12", ""}},
+			{Line: 3, Cells: []string{"A1", "Butcher", "2023-12-01", "BR", "", "12", ""}},
+			{Line: 4, Cells: []string{"A2", "Butcher", "2023-12-02", "BR", "", "12", ""}},
+			{Line: 5, Cells: []string{"A2", "Butcher", "2023-12-02", "BR", "1", "12", ""}},
+			{Line: 6, Cells: []string{"A3", "Butcher", "2023-12-03", "BR", "1", "12", "paid"}},
+		},
+	}
+	m := ImportMapping{"order_ref": "Ref", "customer": "Customer", "order_date": "Date", "product": "Product", "quantity": "Qty", "unit_price": "Price", "status": "Status"}
+	b := u.Build(m, l)
+
+	if len(b.Sales) != 0 || b.Accepted() != 0 {
+		t.Fatalf("sales = %d, accepted = %d; want every order held back (rows: %+v)", len(b.Sales), b.Accepted(), b.Rows)
+	}
+	for _, i := range []int{0, 3} {
+		if errs := b.Rows[i].Errors; len(errs) != 1 || !strings.Contains(errs[0], "another row of order") {
+			t.Errorf("row %d errors = %q, want held back by its order", b.Rows[i].Line, errs)
+		}
+	}
+	if errs := b.Rows[4].Errors; len(errs) != 1 || !strings.Contains(errs[0], "cannot be imported") {
+		t.Errorf("paid status: errors = %q", errs)
+	}
+}
@@ -9,8 +9,18 @@ type InventoryItem struct {
 	Type            *string
 	Quantity        *float64
 	Unit            *string
+	ReorderLevel    *float64
 	ExpirationDate  *time.Time
 	SupplierInfo    *string
 	Notes           *string
 	Audit           AuditFields
 }
+
+// LowStock reports whether the quantity has fallen to the reorder level; items without a
+// reorder level are never low.
+func (i *InventoryItem) LowStock() bool {
+	if i.ReorderLevel == nil {
+		return false
+	}
+	return i.Quantity == nil || *i.Quantity <= *i.ReorderLevel
+}
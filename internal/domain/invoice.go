@@ -0,0 +1,219 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// InvoiceKind distinguishes invoices from the credit notes that correct them.
+type InvoiceKind string
+
+const (
+	InvoiceKindInvoice    InvoiceKind = "invoice"
+	InvoiceKindCreditNote InvoiceKind = "credit_note"
+)
+
+// Label returns the kind for display.
+func (k InvoiceKind) Label() string {
+	if k == InvoiceKindCreditNote {
+		return "Credit note"
+	}
+	return "Invoice"
+}
+
+var (
+	// ErrOrderNotDelivered is returned when invoicing an order that has not been delivered.
+	ErrOrderNotDelivered = errors.New("only delivered orders can be invoiced")
+	// ErrOrderAlreadyInvoiced is returned when the order has an invoice that was not credited.
+	ErrOrderAlreadyInvoiced = errors.New("the order already has an open invoice; issue a credit note first")
+	// ErrOrderHasNoLines is returned when invoicing an order without lines.
+	ErrOrderHasNoLines = errors.New("the order has no lines to invoice")
+	// ErrNotCreditable is returned when crediting a credit note.
+	ErrNotCreditable = errors.New("only invoices can be credited")
+)
+
+// Invoice is an issued invoice or credit note. Customer details and lines are copied from the
+// order when issued so the document never changes afterwards. Credit note amounts are negative.
+type Invoice struct {
+	InvoiceID         int64
+	Kind              InvoiceKind
+	Number            string
+	FiscalYear        int
+	Sequence          int64
+	OrderID           int64
+	CustomerID        int64
+	CreditedInvoiceID *int64 // invoice corrected by this credit note
+	IssueDate         time.Time
+	DueDate           time.Time
+	CustomerName      string
+	CustomerAddress   *string
+	SubtotalAmount    float64
+	VATAmount         float64
+	DeliveryFee       float64
+	TotalAmount       float64
+	Reason            *string // why a credit note was issued
+	CreatedAt         time.Time
+	CreatedBy         *string
+
+	// Relations
+	Lines []*InvoiceLine
+}
+
+// InvoiceLine is one billed order line
+type InvoiceLine struct {
+	InvoiceLineID int64
+	InvoiceID     int64
+	Description   string
+	Quantity      float64
+	Unit          *string
+	UnitPrice     float64
+	Discount      float64
+	VATRate       float64
+	NetAmount     float64
+	VATAmount     float64
+}
+
+// VATBucket totals the lines billed at one VAT rate.
+type VATBucket struct {
+	Rate float64
+	Net  float64
+	VAT  float64
+}
+
+// VATBreakdown groups the invoice lines by VAT rate, lowest rate first.
+func (inv *Invoice) VATBreakdown() []VATBucket {
+	byRate := map[float64]*VATBucket{}
+	var buckets []*VATBucket
+	for _, line := range inv.Lines {
+		bucket, ok := byRate[line.VATRate]
+		if !ok {
+			bucket = &VATBucket{Rate: line.VATRate}
+			byRate[line.VATRate] = bucket
+			buckets = append(buckets, bucket)
+		}
+		bucket.Net += line.NetAmount
+		bucket.VAT += line.VATAmount
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Rate < buckets[j].Rate })
+
+	out := make([]VATBucket, len(buckets))
+	for i, bucket := range buckets {
+		out[i] = VATBucket{Rate: bucket.Rate, Net: roundCents(bucket.Net), VAT: roundCents(bucket.VAT)}
+	}
+	return out
+}
+
+// FiscalYear returns the fiscal year a day falls in, named after the calendar year the fiscal
+// year starts in. With a January start it is the calendar year.
+func FiscalYear(day time.Time, startMonth time.Month) int {
+	if startMonth < time.January || startMonth > time.December {
+		startMonth = time.January
+	}
+	if day.Month() < startMonth {
+		return day.Year() - 1
+	}
+	return day.Year()
+}
+
+// FormatInvoiceNumber renders the document number, e.g. INV-2026-00042 or CN-2026-00003.
+func FormatInvoiceNumber(kind InvoiceKind, fiscalYear int, sequence int64) string {
+	prefix := "INV"
+	if kind == InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+	return fmt.Sprintf("%s-%d-%05d", prefix, fiscalYear, sequence)
+}
+
+// NewInvoiceFromOrder drafts the invoice of a delivered order, with its lines (including
+// Items) and customer. An invoiced order can be billed again once its invoice was credited.
+// Number and sequence are assigned when the invoice is issued.
+func NewInvoiceFromOrder(order *Order, customer *Customer, issueDate time.Time, paymentTermsDays int, fiscalYearStart time.Month) (*Invoice, error) {
+	if order.Status != OrderStatusDelivered && order.Status != OrderStatusInvoiced {
+		return nil, ErrOrderNotDelivered
+	}
+
+	inv := &Invoice{
+		Kind:            InvoiceKindInvoice,
+		FiscalYear:      FiscalYear(issueDate, fiscalYearStart),
+		OrderID:         order.OrderID,
+		CustomerID:      order.CustomerID,
+		IssueDate:       issueDate,
+		DueDate:         issueDate.AddDate(0, 0, paymentTermsDays),
+		CustomerName:    customer.Name,
+		CustomerAddress: customer.InvoiceAddress(),
+	}
+	for _, item := range order.Items {
+		if item.Audit.DeletedAt != nil {
+			continue
+		}
+		line := &InvoiceLine{
+			Discount:  item.Discount,
+			VATRate:   item.VATRate,
+			NetAmount: item.LineTotal(),
+			VATAmount: item.LineVAT(),
+		}
+		if item.ProductDescription != nil {
+			line.Description = *item.ProductDescription
+		}
+		if item.Quantity != nil {
+			line.Quantity = *item.Quantity
+		}
+		if item.UnitPrice != nil {
+			line.UnitPrice = *item.UnitPrice
+		}
+		if item.Product != nil && item.Product.Unit != "" {
+			unit := item.Product.Unit
+			line.Unit = &unit
+		}
+		inv.Lines = append(inv.Lines, line)
+	}
+	if len(inv.Lines) == 0 {
+		return nil, ErrOrderHasNoLines
+	}
+
+	totals := ComputeOrderTotals(order.Items, order.DeliveryFee)
+	inv.SubtotalAmount = totals.Subtotal
+	inv.VATAmount = totals.VAT
+	inv.DeliveryFee = totals.DeliveryFee
+	inv.TotalAmount = totals.Total
+	return inv, nil
+}
+
+// NewCreditNote drafts a credit note cancelling an invoice in full: every line and amount is
+// negated. The customer is then re-billed, if needed, with a new invoice.
+func NewCreditNote(original *Invoice, reason string, issueDate time.Time, fiscalYearStart time.Month) (*Invoice, error) {
+	if original.Kind != InvoiceKindInvoice {
+		return nil, ErrNotCreditable
+	}
+
+	creditedID := original.InvoiceID
+	note := &Invoice{
+		Kind:              InvoiceKindCreditNote,
+		FiscalYear:        FiscalYear(issueDate, fiscalYearStart),
+		OrderID:           original.OrderID,
+		CustomerID:        original.CustomerID,
+		CreditedInvoiceID: &creditedID,
+		IssueDate:         issueDate,
+		DueDate:           issueDate,
+		CustomerName:      original.CustomerName,
+		CustomerAddress:   original.CustomerAddress,
+		SubtotalAmount:    -original.SubtotalAmount,
+		VATAmount:         -original.VATAmount,
+		DeliveryFee:       -original.DeliveryFee,
+		TotalAmount:       -original.TotalAmount,
+		Reason:            &reason,
+	}
+	for _, line := range original.Lines {
+		credited := *line
+		credited.InvoiceLineID = 0
+		credited.InvoiceID = 0
+		credited.Quantity = -line.Quantity
+		credited.Discount = -line.Discount
+		credited.NetAmount = -line.NetAmount
+		credited.VATAmount = -line.VATAmount
+		note.Lines = append(note.Lines, &credited)
+	}
+	return note, nil
+}
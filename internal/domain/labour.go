@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrAlreadyClockedIn is returned when a staff member clocks in twice without clocking out.
+	ErrAlreadyClockedIn = errors.New("the staff member is already clocked in")
+	// ErrEntryEndsBeforeStart is returned when a time entry would end before it starts.
+	ErrEntryEndsBeforeStart = errors.New("the time entry must end after it starts")
+)
+
+// TimeEntry is time a staff member spent working in a barn, from clocking in to clocking out or
+// logged afterwards for a task. Time not booked to a flock is shared by the flocks in the barn.
+type TimeEntry struct {
+	TimeEntryID int64
+	StaffID     int64
+	BarnID      int64
+	FlockID     *int64
+	TaskID      *int64
+	StartedAt   time.Time
+	EndedAt     *time.Time // nil while the staff member is clocked in
+	HourlyRate  *float64   // the staff member's rate when the time was booked
+	Notes       *string
+	Audit       AuditFields
+
+	// Relations
+	StaffName  string
+	BarnName   string
+	FlockBreed *string
+	TaskName   *string
+}
+
+// Open reports whether the staff member is still clocked in.
+func (e *TimeEntry) Open() bool {
+	return e.EndedAt == nil
+}
+
+// Hours returns the hours worked; an open entry counts up to now.
+func (e *TimeEntry) Hours(now time.Time) float64 {
+	end := now
+	if e.EndedAt != nil {
+		end = *e.EndedAt
+	}
+	if !end.After(e.StartedAt) {
+		return 0
+	}
+	return end.Sub(e.StartedAt).Hours()
+}
+
+// Cost returns the labour cost of the entry, zero when the staff member has no hourly rate.
+func (e *TimeEntry) Cost(now time.Time) float64 {
+	if e.HourlyRate == nil {
+		return 0
+	}
+	return e.Hours(now) * *e.HourlyRate
+}
+
+// FlockCost is what raising a flock has cost so far in labour and feed, next to the birds
+// placed and the meat it gave.
+type FlockCost struct {
+	FlockID  int64
+	Breed    string
+	BarnID   *int64
+	BarnName *string
+	Birds    int // birds placed
+
+	// LabourHours includes SharedHours, the flock's share of the time booked to its barn only.
+	LabourHours float64
+	SharedHours float64
+	LabourCost  float64
+	// UnratedHours are hours of staff without an hourly rate; they carry no cost.
+	UnratedHours float64
+
+	FeedKg   float64
+	FeedCost float64
+	// UnpricedFeedKg is feed of types without a cost per kg; it carries no cost.
+	UnpricedFeedKg float64
+
+	MeatKg float64 // meat yield of the flock's slaughtered batches
+}
+
+// TotalCost returns the labour and feed cost of the flock.
+func (c *FlockCost) TotalCost() float64 {
+	return c.LabourCost + c.FeedCost
+}
+
+// CostPerBird returns the total cost per bird placed; ok is false when no birds were placed.
+func (c *FlockCost) CostPerBird() (cost float64, ok bool) {
+	if c.Birds <= 0 {
+		return 0, false
+	}
+	return c.TotalCost() / float64(c.Birds), true
+}
+
+// CostPerKg returns the total cost per kg of meat; ok is false before any meat was recorded.
+func (c *FlockCost) CostPerKg() (cost float64, ok bool) {
+	if c.MeatKg <= 0 {
+		return 0, false
+	}
+	return c.TotalCost() / c.MeatKg, true
+}
+
+// AllocateLabour adds closed time entries to the flock costs. Time booked to a flock goes to
+// that flock; time booked to a barn only is split over the flocks in the barn by the birds
+// placed, or evenly when no flock has a bird count. It returns the hours that could not be
+// allocated because their flock is not in costs or their barn holds no flock.
+func AllocateLabour(costs []*FlockCost, entries []*TimeEntry) (unallocated float64) {
+	byFlock := make(map[int64]*FlockCost, len(costs))
+	for _, c := range costs {
+		byFlock[c.FlockID] = c
+	}
+	byBarn := flocksByBarn(costs)
+
+	for _, e := range entries {
+		if e.Open() {
+			continue
+		}
+		hours := e.Hours(time.Time{})
+		if e.FlockID != nil {
+			c, ok := byFlock[*e.FlockID]
+			if !ok {
+				unallocated += hours
+				continue
+			}
+			c.addLabour(hours, e.HourlyRate, false)
+			continue
+		}
+		flocks := byBarn[e.BarnID]
+		if len(flocks) == 0 {
+			unallocated += hours
+			continue
+		}
+		for i, share := range barnShares(flocks) {
+			flocks[i].addLabour(hours*share, e.HourlyRate, true)
+		}
+	}
+	return unallocated
+}
+
+// barnShares returns the share of each flock in a barn in what is booked to the barn: by the
+// birds placed, or evenly when no flock has a bird count.
+func barnShares(flocks []*FlockCost) []float64 {
+	birds := 0
+	for _, c := range flocks {
+		birds += max(c.Birds, 0)
+	}
+	shares := make([]float64, len(flocks))
+	for i, c := range flocks {
+		shares[i] = 1 / float64(len(flocks))
+		if birds > 0 {
+			shares[i] = float64(max(c.Birds, 0)) / float64(birds)
+		}
+	}
+	return shares
+}
+
+// flocksByBarn groups flock costs by the barn the flock is in.
+func flocksByBarn(costs []*FlockCost) map[int64][]*FlockCost {
+	byBarn := map[int64][]*FlockCost{}
+	for _, c := range costs {
+		if c.BarnID != nil {
+			byBarn[*c.BarnID] = append(byBarn[*c.BarnID], c)
+		}
+	}
+	return byBarn
+}
+
+func (c *FlockCost) addLabour(hours float64, rate *float64, shared bool) {
+	c.LabourHours += hours
+	if shared {
+		c.SharedHours += hours
+	}
+	if rate == nil {
+		c.UnratedHours += hours
+		return
+	}
+	c.LabourCost += hours * *rate
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAllocateLabour(t *testing.T) {
+	barn, otherBarn, emptyBarn := int64(1), int64(2), int64(3)
+	flockA, flockB := int64(10), int64(11)
+	rate := 20.0
+	start := time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)
+	end := func(h float64) *time.Time {
+		e := start.Add(time.Duration(h * float64(time.Hour)))
+		return &e
+	}
+
+	costs := []*FlockCost{
+		{FlockID: flockA, BarnID: &barn, Birds: 300},
+		{FlockID: flockB, BarnID: &barn, Birds: 100},
+		{FlockID: 12, BarnID: &otherBarn},
+	}
+	unallocated := AllocateLabour(costs, []*TimeEntry{
+		{BarnID: barn, FlockID: &flockA, StartedAt: start, EndedAt: end(2), HourlyRate: &rate},
+		{BarnID: barn, StartedAt: start, EndedAt: end(4), HourlyRate: &rate}, // split 3:1 by birds
+		{BarnID: barn, FlockID: &flockB, StartedAt: start, EndedAt: end(1)},  // no hourly rate
+		{BarnID: otherBarn, StartedAt: start, EndedAt: end(1)},
+		{BarnID: emptyBarn, StartedAt: start, EndedAt: end(5)},
+		{BarnID: barn, FlockID: &flockA, StartedAt: start}, // still clocked in
+	})
+
+	if unallocated != 5 {
+		t.Errorf("unallocated = %v, want the 5 hours in the empty barn", unallocated)
+	}
+	a, b := costs[0], costs[1]
+	if a.LabourHours != 5 || a.SharedHours != 3 || a.LabourCost != 100 {
+		t.Errorf("flock A = %+v, want 5 hours of which 3 shared, costing 100", a)
+	}
+	if b.LabourHours != 2 || b.UnratedHours != 1 || b.LabourCost != 20 {
+		t.Errorf("flock B = %+v, want 2 hours of which 1 unrated, costing 20", b)
+	}
+	if costs[2].LabourHours != 1 {
+		t.Errorf("flock without a bird count = %v hours, want the whole barn share", costs[2].LabourHours)
+	}
+}
+
+func TestFlockCost_PerUnit(t *testing.T) {
+	c := &FlockCost{Birds: 200, LabourCost: 450, FeedCost: 1550, MeatKg: 1600}
+	if perBird, ok := c.CostPerBird(); !ok || perBird != 10 {
+		t.Errorf("cost per bird = %v, %v; want 10", perBird, ok)
+	}
+	if perKg, ok := c.CostPerKg(); !ok || math.Abs(perKg-1.25) > 1e-9 {
+		t.Errorf("cost per kg = %v, %v; want 1.25", perKg, ok)
+	}
+	if _, ok := (&FlockCost{LabourCost: 10}).CostPerKg(); ok {
+		t.Error("a flock without meat has no cost per kg")
+	}
+}
@@ -0,0 +1,181 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// CostCategory groups the costs of raising a flock on its P&L.
+type CostCategory string
+
+const (
+	CostChicks     CostCategory = "chicks"
+	CostFeed       CostCategory = "feed"
+	CostMedication CostCategory = "medication"
+	CostLabour     CostCategory = "labour"
+	CostEnergy     CostCategory = "energy"
+	CostSlaughter  CostCategory = "slaughter"
+	CostOther      CostCategory = "other"
+)
+
+// CostCategories lists the cost categories in P&L order.
+var CostCategories = []CostCategory{CostChicks, CostFeed, CostMedication, CostLabour, CostEnergy, CostSlaughter, CostOther}
+
+// LedgerCostCategories are the categories booked on the cost ledger; feed and labour come from
+// the feeding records and time entries instead.
+var LedgerCostCategories = []CostCategory{CostChicks, CostMedication, CostEnergy, CostSlaughter, CostOther}
+
+// Label returns the cost category for display.
+func (c CostCategory) Label() string {
+	switch c {
+	case CostChicks:
+		return "Chicks"
+	case CostFeed:
+		return "Feed"
+	case CostMedication:
+		return "Medication"
+	case CostLabour:
+		return "Labour"
+	case CostEnergy:
+		return "Energy"
+	case CostSlaughter:
+		return "Slaughter"
+	case CostOther:
+		return "Other"
+	}
+	return string(c)
+}
+
+// CostEntry is a cost booked on the ledger to a flock, or to a barn when it is shared by the
+// flocks in the barn, e.g. the energy bill.
+type CostEntry struct {
+	CostEntryID int64
+	Category    CostCategory
+	FlockID     *int64
+	BarnID      *int64
+	EntryDate   time.Time
+	Amount      float64
+	Description *string
+	Audit       AuditFields
+
+	// Relations
+	FlockBreed *string
+	BarnName   *string
+}
+
+// FlockPnL is the profit and loss of a flock: its costs per category against the revenue of
+// the orders supplied from its batches.
+type FlockPnL struct {
+	Flock   *FlockCost
+	Costs   map[CostCategory]float64
+	Revenue float64
+}
+
+// TotalCost returns the costs of the flock over all categories.
+func (p *FlockPnL) TotalCost() float64 {
+	total := 0.0
+	for _, cost := range p.Costs {
+		total += cost
+	}
+	return total
+}
+
+// Margin returns the revenue less the costs.
+func (p *FlockPnL) Margin() float64 {
+	return p.Revenue - p.TotalCost()
+}
+
+// MarginPerBird returns the margin per bird placed; ok is false when no birds were placed.
+func (p *FlockPnL) MarginPerBird() (margin float64, ok bool) {
+	if p.Flock.Birds <= 0 {
+		return 0, false
+	}
+	return p.Margin() / float64(p.Flock.Birds), true
+}
+
+// BuildFlockPnL puts together the P&L of every flock from its labour and feed costs, the cost
+// ledger and the revenue per flock. Ledger entries booked to a barn only are shared by the
+// flocks in the barn like barn labour. It returns the ledger amount that could not be booked to
+// a flock because its flock is unknown or its barn holds no flock.
+func BuildFlockPnL(costs []*FlockCost, entries []*CostEntry, revenue map[int64]float64) (pnl []*FlockPnL, unallocated float64) {
+	byFlock := make(map[int64]*FlockPnL, len(costs))
+	for _, c := range costs {
+		p := &FlockPnL{
+			Flock: c,
+			Costs: map[CostCategory]float64{
+				CostFeed:   c.FeedCost,
+				CostLabour: c.LabourCost,
+			},
+			Revenue: revenue[c.FlockID],
+		}
+		byFlock[c.FlockID] = p
+		pnl = append(pnl, p)
+	}
+	byBarn := flocksByBarn(costs)
+
+	for _, e := range entries {
+		if e.FlockID != nil {
+			p, ok := byFlock[*e.FlockID]
+			if !ok {
+				unallocated += e.Amount
+				continue
+			}
+			p.Costs[e.Category] += e.Amount
+			continue
+		}
+		var flocks []*FlockCost
+		if e.BarnID != nil {
+			flocks = byBarn[*e.BarnID]
+		}
+		if len(flocks) == 0 {
+			unallocated += e.Amount
+			continue
+		}
+		for i, share := range barnShares(flocks) {
+			byFlock[flocks[i].FlockID].Costs[e.Category] += e.Amount * share
+		}
+	}
+	return pnl, unallocated
+}
+
+// BreedPnL adds up the P&L of the flocks of a breed.
+type BreedPnL struct {
+	Breed     string
+	Flocks    int
+	Birds     int
+	TotalCost float64
+	Revenue   float64
+}
+
+// Margin returns the revenue less the costs of the breed's flocks.
+func (b *BreedPnL) Margin() float64 {
+	return b.Revenue - b.TotalCost
+}
+
+// MarginPerBird returns the margin per bird placed; ok is false when no birds were placed.
+func (b *BreedPnL) MarginPerBird() (margin float64, ok bool) {
+	if b.Birds <= 0 {
+		return 0, false
+	}
+	return b.Margin() / float64(b.Birds), true
+}
+
+// SummariseBreeds adds up flock P&Ls per breed, by breed name.
+func SummariseBreeds(pnl []*FlockPnL) []*BreedPnL {
+	byBreed := map[string]*BreedPnL{}
+	var breeds []*BreedPnL
+	for _, p := range pnl {
+		b, ok := byBreed[p.Flock.Breed]
+		if !ok {
+			b = &BreedPnL{Breed: p.Flock.Breed}
+			byBreed[p.Flock.Breed] = b
+			breeds = append(breeds, b)
+		}
+		b.Flocks++
+		b.Birds += max(p.Flock.Birds, 0)
+		b.TotalCost += p.TotalCost()
+		b.Revenue += p.Revenue
+	}
+	sort.Slice(breeds, func(i, j int) bool { return breeds[i].Breed < breeds[j].Breed })
+	return breeds
+}
@@ -0,0 +1,50 @@
+package domain
+
+import "testing"
+
+func TestBuildFlockPnL(t *testing.T) {
+	barn, emptyBarn := int64(1), int64(2)
+	flockA, flockB, gone := int64(10), int64(11), int64(99)
+	costs := []*FlockCost{
+		{FlockID: flockA, Breed: "Bronze", BarnID: &barn, Birds: 300, FeedCost: 900, LabourCost: 300},
+		{FlockID: flockB, Breed: "Norfolk Black", BarnID: &barn, Birds: 100, FeedCost: 250},
+	}
+	pnl, unallocated := BuildFlockPnL(costs, []*CostEntry{
+		{Category: CostChicks, FlockID: &flockA, Amount: 1500},
+		{Category: CostEnergy, BarnID: &barn, Amount: 400}, // split 3:1 by birds
+		{Category: CostEnergy, BarnID: &emptyBarn, Amount: 50},
+		{Category: CostOther, FlockID: &gone, Amount: 20},
+	}, map[int64]float64{flockA: 4500, flockB: 600})
+
+	if unallocated != 70 {
+		t.Errorf("unallocated = %v, want 70", unallocated)
+	}
+	a, b := pnl[0], pnl[1]
+	if a.Costs[CostEnergy] != 300 || b.Costs[CostEnergy] != 100 {
+		t.Errorf("energy = %v and %v, want 300 and 100", a.Costs[CostEnergy], b.Costs[CostEnergy])
+	}
+	if a.TotalCost() != 3000 || a.Margin() != 1500 {
+		t.Errorf("flock A cost %v margin %v, want 3000 and 1500", a.TotalCost(), a.Margin())
+	}
+	if perBird, ok := a.MarginPerBird(); !ok || perBird != 5 {
+		t.Errorf("flock A margin per bird = %v, want 5", perBird)
+	}
+	if b.Margin() != 250 {
+		t.Errorf("flock B margin = %v, want 250", b.Margin())
+	}
+}
+
+func TestSummariseBreeds(t *testing.T) {
+	pnl := []*FlockPnL{
+		{Flock: &FlockCost{Breed: "Norfolk Black", Birds: 100}, Costs: map[CostCategory]float64{CostFeed: 300}, Revenue: 500},
+		{Flock: &FlockCost{Breed: "Bronze", Birds: 200}, Costs: map[CostCategory]float64{CostFeed: 1000}, Revenue: 1600},
+		{Flock: &FlockCost{Breed: "Bronze", Birds: 200}, Costs: map[CostCategory]float64{CostFeed: 1200}, Revenue: 1400},
+	}
+	breeds := SummariseBreeds(pnl)
+	if len(breeds) != 2 || breeds[0].Breed != "Bronze" || breeds[0].Flocks != 2 {
+		t.Fatalf("breeds = %+v, want Bronze with two flocks first", breeds)
+	}
+	if perBird, ok := breeds[0].MarginPerBird(); !ok || perBird != 2 {
+		t.Errorf("Bronze margin per bird = %v, want 2", perBird)
+	}
+}
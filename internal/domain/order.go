@@ -1,17 +1,73 @@
 package domain
 
-import "time"
+import (
+	"math"
+	"time"
+)
 
 // Order represents customer orders
 type Order struct {
-	OrderID      int64
-	CustomerID   int64
-	OrderDate    *time.Time
-	DeliveryDate *time.Time
-	TotalAmount  *float64
-	Status       *string
-	Audit        AuditFields
+	OrderID        int64
+	CustomerID     int64
+	OrderDate      *time.Time
+	DeliveryDate   *time.Time
+	SubtotalAmount float64 // sum of line totals, derived
+	VATAmount      float64 // VAT over all lines, derived
+	DeliveryFee    float64
+	TotalAmount    *float64 // subtotal + VAT + delivery fee, derived
+	Status         OrderStatus
+	Source         OrderSource
+	Audit          AuditFields
 
 	// Relations
 	Customer *Customer
+	Items    []*OrderItem
+}
+
+// HeaderChanged reports whether next gives the order another customer, order date (by day) or
+// delivery fee; only drafts may change them.
+func (o *Order) HeaderChanged(next *Order) bool {
+	sameDate := (o.OrderDate == nil) == (next.OrderDate == nil)
+	if sameDate && next.OrderDate != nil {
+		sameDate = o.OrderDate.Format("2006-01-02") == next.OrderDate.Format("2006-01-02")
+	}
+	return o.CustomerID != next.CustomerID || !sameDate || math.Abs(o.DeliveryFee-next.DeliveryFee) >= 0.005
+}
+
+// OrderSource records who placed an order.
+type OrderSource string
+
+const (
+	OrderSourceStaff  OrderSource = "staff"
+	OrderSourcePortal OrderSource = "portal" // placed by the customer in the customer portal
+)
+
+// OrderTotals are the amounts derived from an order's lines.
+type OrderTotals struct {
+	Subtotal    float64
+	VAT         float64
+	DeliveryFee float64
+	Total       float64
+}
+
+// ComputeOrderTotals sums the non-deleted lines of an order and adds VAT and the delivery fee.
+// VAT is computed per line at the line's rate and rounded to cents before summing.
+func ComputeOrderTotals(items []*OrderItem, deliveryFee float64) OrderTotals {
+	var totals OrderTotals
+	for _, item := range items {
+		if item.Audit.DeletedAt != nil {
+			continue
+		}
+		totals.Subtotal += item.LineTotal()
+		totals.VAT += item.LineVAT()
+	}
+	totals.Subtotal = roundCents(totals.Subtotal)
+	totals.VAT = roundCents(totals.VAT)
+	totals.DeliveryFee = roundCents(deliveryFee)
+	totals.Total = roundCents(totals.Subtotal + totals.VAT + totals.DeliveryFee)
+	return totals
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
 }
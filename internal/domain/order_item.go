@@ -4,12 +4,39 @@ package domain
 type OrderItem struct {
 	OrderItemID        int64
 	OrderID            int64
+	ProductID          *int64
 	ProductDescription *string
 	Quantity           *float64
 	UnitPrice          *float64
-	TotalPrice         *float64
+	Discount           float64  // amount taken off the line
+	VATRate            float64  // percent, copied from the product when the line is priced
+	TotalPrice         *float64 // quantity × unit price less discount, derived
+	SlaughterID        *int64   // slaughter output lot the meat came from
 	Audit              AuditFields
 
+	// Reserved is the quantity set aside from product lots for this line.
+	Reserved float64
+
 	// Relations
-	Order *Order
+	Order     *Order
+	Product   *Product
+	Slaughter *SlaughterRecord
+}
+
+// LineTotal returns quantity × unit price less the discount, rounded to cents and never negative.
+// Lines without a quantity or unit price total zero.
+func (i *OrderItem) LineTotal() float64 {
+	if i.Quantity == nil || i.UnitPrice == nil {
+		return 0
+	}
+	total := roundCents(*i.Quantity**i.UnitPrice - i.Discount)
+	if total < 0 {
+		return 0
+	}
+	return total
+}
+
+// LineVAT returns the VAT due on the line total.
+func (i *OrderItem) LineVAT() float64 {
+	return roundCents(i.LineTotal() * i.VATRate / 100)
 }
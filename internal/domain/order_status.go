@@ -0,0 +1,185 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OrderStatus is a state of the order fulfilment workflow.
+type OrderStatus string
+
+// Order statuses in workflow order, followed by the exits.
+const (
+	OrderStatusDraft     OrderStatus = "draft"
+	OrderStatusConfirmed OrderStatus = "confirmed"
+	OrderStatusReserved  OrderStatus = "reserved"
+	OrderStatusPicked    OrderStatus = "picked"
+	OrderStatusDelivered OrderStatus = "delivered"
+	OrderStatusInvoiced  OrderStatus = "invoiced"
+	OrderStatusPaid      OrderStatus = "paid"
+	OrderStatusCancelled OrderStatus = "cancelled"
+	OrderStatusReturned  OrderStatus = "returned"
+)
+
+// OrderStatuses lists every status in display order.
+var OrderStatuses = []OrderStatus{
+	OrderStatusDraft,
+	OrderStatusConfirmed,
+	OrderStatusReserved,
+	OrderStatusPicked,
+	OrderStatusDelivered,
+	OrderStatusInvoiced,
+	OrderStatusPaid,
+	OrderStatusCancelled,
+	OrderStatusReturned,
+}
+
+// orderTransitions is the workflow graph. Cancellation is possible until the goods leave the
+// farm; afterwards they can only come back as a return. Cancelled and returned are final.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusDraft:     {OrderStatusConfirmed, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusReserved, OrderStatusDraft, OrderStatusCancelled},
+	OrderStatusReserved:  {OrderStatusPicked, OrderStatusCancelled},
+	OrderStatusPicked:    {OrderStatusDelivered, OrderStatusCancelled},
+	OrderStatusDelivered: {OrderStatusInvoiced, OrderStatusReturned},
+	OrderStatusInvoiced:  {OrderStatusPaid, OrderStatusReturned},
+	OrderStatusPaid:      {OrderStatusReturned},
+}
+
+// ParseOrderStatus returns the status named by s (case-insensitive), or false when unknown.
+func ParseOrderStatus(s string) (OrderStatus, bool) {
+	status := OrderStatus(strings.ToLower(strings.TrimSpace(s)))
+	for _, known := range OrderStatuses {
+		if status == known {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// Label returns the status for display.
+func (s OrderStatus) Label() string {
+	if s == "" {
+		return ""
+	}
+	return strings.ToUpper(string(s[:1])) + string(s[1:])
+}
+
+// LinesEditable reports whether order lines may still be added, changed or removed.
+func (s OrderStatus) LinesEditable() bool {
+	return s == OrderStatusDraft
+}
+
+var (
+	// ErrOrderLinesLocked is returned when adding, changing or removing a line of an order past
+	// draft.
+	ErrOrderLinesLocked = errors.New("order lines can only be changed while the order is a draft")
+	// ErrOrderHeaderLocked is returned when changing the customer, order date or delivery fee of
+	// an order past draft.
+	ErrOrderHeaderLocked = errors.New("customer, order date and delivery fee can only be changed while the order is a draft")
+)
+
+// ErrOrderDelivered is returned when deleting an order whose goods have left the farm.
+var ErrOrderDelivered = errors.New("the order has been delivered; return it instead of deleting it")
+
+// Deletable reports whether the order may be deleted. Delivered, invoiced and paid orders are
+// kept for their invoices and stock history; they can only be returned.
+func (s OrderStatus) Deletable() bool {
+	switch s {
+	case OrderStatusDelivered, OrderStatusInvoiced, OrderStatusPaid:
+		return false
+	}
+	return true
+}
+
+// Next returns the statuses the workflow graph allows after s, before guards are applied.
+func (s OrderStatus) Next() []OrderStatus {
+	return orderTransitions[s]
+}
+
+// OrderTransitionFacts are the order facts the transition guards look at.
+type OrderTransitionFacts struct {
+	Lines           int  // non-deleted order lines
+	UnreservedLines int  // lines without stock reserved for them
+	OnDeliveryRun   bool // a pending stop of a live delivery run holds the order
+}
+
+// OrderTransitionError explains why a status change is refused.
+type OrderTransitionError struct {
+	From   OrderStatus
+	To     OrderStatus
+	Reason string
+}
+
+func (e *OrderTransitionError) Error() string {
+	return fmt.Sprintf("cannot move order from %s to %s: %s", e.From, e.To, e.Reason)
+}
+
+// CheckOrderTransition validates a status change against the workflow graph and its guards:
+// an order needs at least one line to be confirmed, and every line needs reserved stock
+// before the order is marked reserved or delivered.
+func CheckOrderTransition(from, to OrderStatus, facts OrderTransitionFacts) error {
+	allowed := false
+	for _, next := range from.Next() {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return &OrderTransitionError{From: from, To: to, Reason: "not an allowed transition"}
+	}
+
+	switch to {
+	case OrderStatusConfirmed:
+		if facts.Lines == 0 {
+			return &OrderTransitionError{From: from, To: to, Reason: "the order has no lines"}
+		}
+	case OrderStatusReserved, OrderStatusDelivered:
+		if facts.Lines == 0 || facts.UnreservedLines > 0 {
+			return &OrderTransitionError{From: from, To: to, Reason: fmt.Sprintf("%d of %d lines have no reserved stock", facts.UnreservedLines, facts.Lines)}
+		}
+	case OrderStatusCancelled:
+		// Its stop could never be closed, and the run never completed.
+		if facts.OnDeliveryRun {
+			return &OrderTransitionError{From: from, To: to, Reason: "the order is on a delivery run; take it off the run first"}
+		}
+	}
+	return nil
+}
+
+// AllowedOrderTransitions returns the statuses an order can move to right now.
+func AllowedOrderTransitions(from OrderStatus, facts OrderTransitionFacts) []OrderStatus {
+	var allowed []OrderStatus
+	for _, next := range from.Next() {
+		if CheckOrderTransition(from, next, facts) == nil {
+			allowed = append(allowed, next)
+		}
+	}
+	return allowed
+}
+
+// OrderStatusTransition records a status change of an order
+type OrderStatusTransition struct {
+	TransitionID int64
+	OrderID      int64
+	FromStatus   OrderStatus
+	ToStatus     OrderStatus
+	Note         *string
+	CreatedAt    time.Time
+	CreatedBy    *string
+
+	// Relations
+	CreatedByName *string // username of CreatedBy
+}
+
+// Open reports whether the order still needs work, i.e. it is not paid, cancelled or returned.
+func (s OrderStatus) Open() bool {
+	switch s {
+	case OrderStatusPaid, OrderStatusCancelled, OrderStatusReturned:
+		return false
+	}
+	return true
+}
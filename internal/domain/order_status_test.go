@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckOrderTransition(t *testing.T) {
+	ready := OrderTransitionFacts{Lines: 2}
+	cases := []struct {
+		name     string
+		from, to OrderStatus
+		facts    OrderTransitionFacts
+		ok       bool
+	}{
+		{"confirm with lines", OrderStatusDraft, OrderStatusConfirmed, ready, true},
+		{"confirm empty order", OrderStatusDraft, OrderStatusConfirmed, OrderTransitionFacts{}, false},
+		{"skip to delivered", OrderStatusDraft, OrderStatusDelivered, ready, false},
+		{"reserve with unreserved line", OrderStatusConfirmed, OrderStatusReserved, OrderTransitionFacts{Lines: 2, UnreservedLines: 1}, false},
+		{"reserve fully reserved", OrderStatusConfirmed, OrderStatusReserved, ready, true},
+		{"deliver picked", OrderStatusPicked, OrderStatusDelivered, ready, true},
+		{"cancel after delivery", OrderStatusDelivered, OrderStatusCancelled, ready, false},
+		{"cancel on a delivery run", OrderStatusPicked, OrderStatusCancelled, OrderTransitionFacts{Lines: 2, OnDeliveryRun: true}, false},
+		{"cancel picked", OrderStatusPicked, OrderStatusCancelled, ready, true},
+		{"return after payment", OrderStatusPaid, OrderStatusReturned, ready, true},
+		{"leave cancelled", OrderStatusCancelled, OrderStatusDraft, ready, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckOrderTransition(tc.from, tc.to, tc.facts)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var transitionErr *OrderTransitionError
+			if !tc.ok && !errors.As(err, &transitionErr) {
+				t.Fatalf("expected *OrderTransitionError, got %v", err)
+			}
+		})
+	}
+
+	allowed := AllowedOrderTransitions(OrderStatusDraft, OrderTransitionFacts{})
+	if !slices.Equal(allowed, []OrderStatus{OrderStatusCancelled}) {
+		t.Errorf("allowed from empty draft = %v, want [cancelled]", allowed)
+	}
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// OutdoorAccessRecord logs a day on which a flock had access to the outdoor range
+type OutdoorAccessRecord struct {
+	OutdoorAccessRecordID int64
+	FlockID               int64
+	Date                  time.Time
+	Hours                 *float64
+	Notes                 *string
+	Audit                 AuditFields
+
+	// Relations
+	Flock *Flock
+}
@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// PaymentMethod is how a customer paid.
+type PaymentMethod string
+
+const (
+	PaymentMethodCash         PaymentMethod = "cash"
+	PaymentMethodBankTransfer PaymentMethod = "bank_transfer"
+	PaymentMethodCard         PaymentMethod = "card"
+)
+
+// PaymentMethods lists the accepted payment methods in display order.
+var PaymentMethods = []PaymentMethod{PaymentMethodBankTransfer, PaymentMethodCash, PaymentMethodCard}
+
+// Label returns the method for display.
+func (m PaymentMethod) Label() string {
+	switch m {
+	case PaymentMethodCash:
+		return "Cash"
+	case PaymentMethodBankTransfer:
+		return "Bank transfer"
+	case PaymentMethodCard:
+		return "Card"
+	}
+	return string(m)
+}
+
+var (
+	// ErrOverAllocated is returned when allocations add up to more than the payment.
+	ErrOverAllocated = errors.New("allocations exceed the payment amount")
+	// ErrAllocationExceedsOpen is returned when an allocation is larger than what is still owed on the invoice.
+	ErrAllocationExceedsOpen = errors.New("allocation exceeds the open amount of the invoice")
+	// ErrAllocationCustomer is returned when allocating to another customer's invoice or to a credit note.
+	ErrAllocationCustomer = errors.New("payments can only be allocated to the customer's own invoices")
+)
+
+// Payment is money received from a customer, allocated to one or more of their invoices.
+// Whatever is not allocated stays on the customer's account.
+type Payment struct {
+	PaymentID   int64
+	CustomerID  int64
+	PaymentDate time.Time
+	Method      PaymentMethod
+	Amount      float64
+	Reference   *string
+	Notes       *string
+	Audit       AuditFields
+
+	// Relations
+	CustomerName string
+	Allocations  []*PaymentAllocation
+}
+
+// PaymentAllocation settles (part of) an invoice with a payment.
+type PaymentAllocation struct {
+	PaymentAllocationID int64
+	PaymentID           int64
+	InvoiceID           int64
+	Amount              float64
+
+	// Relations
+	InvoiceNumber string
+}
+
+// Allocated returns the part of the payment allocated to invoices.
+func (p *Payment) Allocated() float64 {
+	var sum float64
+	for _, a := range p.Allocations {
+		sum += a.Amount
+	}
+	return roundCents(sum)
+}
+
+// Unallocated returns the part of the payment left on the customer's account.
+func (p *Payment) Unallocated() float64 {
+	return roundCents(p.Amount - p.Allocated())
+}
+
+// InvoiceBalance is what is still owed on an invoice after its credit note and payments.
+type InvoiceBalance struct {
+	Invoice  *Invoice
+	Credited float64 // total of the credit note, as a positive amount
+	Paid     float64
+}
+
+// Open returns the amount still owed; it is negative when more was paid than is owed.
+func (b *InvoiceBalance) Open() float64 {
+	return roundCents(b.Invoice.TotalAmount - b.Credited - b.Paid)
+}
+
+// CheckAllocations validates a payment's allocations against the balances of the invoices they
+// settle, keyed by invoice ID.
+func CheckAllocations(p *Payment, balances map[int64]*InvoiceBalance) error {
+	if p.Allocated() > roundCents(p.Amount) {
+		return ErrOverAllocated
+	}
+	for _, a := range p.Allocations {
+		balance, ok := balances[a.InvoiceID]
+		if !ok || balance.Invoice.CustomerID != p.CustomerID || balance.Invoice.Kind != InvoiceKindInvoice {
+			return ErrAllocationCustomer
+		}
+		if roundCents(a.Amount) > balance.Open() {
+			return ErrAllocationExceedsOpen
+		}
+	}
+	return nil
+}
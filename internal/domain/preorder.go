@@ -0,0 +1,239 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// PreorderSupplyLeadDays is how many days before the first pickup day a production batch may be
+// ready and still count towards a campaign's supply: birds are slaughtered in the days before
+// pickup, so batches ready earlier are sold fresh through regular orders.
+const PreorderSupplyLeadDays = 14
+
+var (
+	// ErrPickupOutsideCampaign is returned when a pre-order's pickup date is outside the campaign's pickup window.
+	ErrPickupOutsideCampaign = errors.New("the pickup date is outside the campaign's pickup window")
+	// ErrPreorderClosed is returned when changing a pre-order that was already collected or cancelled.
+	ErrPreorderClosed = errors.New("the pre-order is already collected or cancelled")
+	// ErrWeightBandInUse is returned when removing a weight band that pre-orders reserve birds in.
+	ErrWeightBandInUse = errors.New("pre-orders reserve birds in this weight band")
+)
+
+// PreorderCampaign is a seasonal pre-order drive, e.g. "Christmas 2026", with the days customers
+// can pick up their bird and the deposit asked per bird.
+type PreorderCampaign struct {
+	CampaignID     int64
+	Name           string
+	PickupFrom     time.Time
+	PickupTo       time.Time
+	DepositPerBird float64
+	Notes          *string
+	Audit          AuditFields
+
+	// Relations
+	Bands []*WeightBand
+}
+
+// InPickupWindow reports whether customers can pick up on day.
+func (c *PreorderCampaign) InPickupWindow(day time.Time) bool {
+	return !day.Before(c.PickupFrom) && !day.After(c.PickupTo)
+}
+
+// SupplyWindow returns the ready dates of the production batches that supply the campaign.
+func (c *PreorderCampaign) SupplyWindow() (from, to time.Time) {
+	return c.PickupFrom.AddDate(0, 0, -PreorderSupplyLeadDays), c.PickupTo
+}
+
+// Band returns the campaign's weight band with the given ID, or nil.
+func (c *PreorderCampaign) Band(id int64) *WeightBand {
+	for _, band := range c.Bands {
+		if band.WeightBandID == id {
+			return band
+		}
+	}
+	return nil
+}
+
+// BandFor returns the weight band a bird of kg falls in, or nil.
+func (c *PreorderCampaign) BandFor(kg float64) *WeightBand {
+	for _, band := range c.Bands {
+		if band.Contains(kg) {
+			return band
+		}
+	}
+	return nil
+}
+
+// WeightBand is a range of dressed weights customers reserve a bird in, e.g. "Medium" 6-8 kg.
+// The minimum is inclusive and the maximum exclusive.
+type WeightBand struct {
+	WeightBandID int64
+	CampaignID   int64
+	Label        string
+	MinKg        float64
+	MaxKg        float64
+}
+
+// Contains reports whether a bird of kg falls in the band.
+func (b *WeightBand) Contains(kg float64) bool {
+	return kg >= b.MinKg && kg < b.MaxKg
+}
+
+// String returns the band for display, e.g. "Medium (6-8 kg)".
+func (b *WeightBand) String() string {
+	return fmt.Sprintf("%s (%s-%s kg)", b.Label, strconv.FormatFloat(b.MinKg, 'f', -1, 64), strconv.FormatFloat(b.MaxKg, 'f', -1, 64))
+}
+
+// PreorderStatus is where a pre-order stands.
+type PreorderStatus string
+
+const (
+	PreorderStatusReserved  PreorderStatus = "reserved"
+	PreorderStatusCollected PreorderStatus = "collected"
+	PreorderStatusCancelled PreorderStatus = "cancelled"
+)
+
+// Label returns the status for display.
+func (s PreorderStatus) Label() string {
+	switch s {
+	case PreorderStatusReserved:
+		return "Reserved"
+	case PreorderStatusCollected:
+		return "Collected"
+	case PreorderStatusCancelled:
+		return "Cancelled"
+	}
+	return string(s)
+}
+
+// CanChangeTo reports whether a pre-order can move to status: only reserved pre-orders are
+// collected or cancelled.
+func (s PreorderStatus) CanChangeTo(to PreorderStatus) bool {
+	return s == PreorderStatusReserved && (to == PreorderStatusCollected || to == PreorderStatusCancelled)
+}
+
+// Preorder reserves whole birds in a weight band for a customer to pick up on a day of the campaign.
+type Preorder struct {
+	PreorderID   int64
+	CampaignID   int64
+	CustomerID   int64
+	WeightBandID int64
+	Quantity     int
+	PickupDate   time.Time
+	Status       PreorderStatus
+	Notes        *string
+	Audit        AuditFields
+
+	// Relations
+	CustomerName string
+	Band         *WeightBand
+	DepositPaid  float64
+	Deposits     []*PreorderDeposit
+}
+
+// DepositDue returns the deposit asked for the pre-order at perBird.
+func (p *Preorder) DepositDue(perBird float64) float64 {
+	return roundCents(float64(p.Quantity) * perBird)
+}
+
+// DepositOutstanding returns the part of the deposit not received yet.
+func (p *Preorder) DepositOutstanding(perBird float64) float64 {
+	outstanding := roundCents(p.DepositDue(perBird) - p.DepositPaid)
+	if outstanding < 0 {
+		return 0
+	}
+	return outstanding
+}
+
+// PreorderDeposit is money received up front for a pre-order.
+type PreorderDeposit struct {
+	PreorderDepositID int64
+	PreorderID        int64
+	ReceivedOn        time.Time
+	Method            PaymentMethod
+	Amount            float64
+	Reference         *string
+	Audit             AuditFields
+}
+
+// BandForecast compares the birds reserved in a weight band with the birds forecast to weigh in it.
+type BandForecast struct {
+	Band     *WeightBand
+	Reserved int
+	Supply   int
+}
+
+// Shortfall returns how many reserved birds the band's forecast supply does not cover.
+func (f *BandForecast) Shortfall() int {
+	return max(0, f.Reserved-f.Supply)
+}
+
+// PreorderForecast matches a campaign's reservations against the production batches forecast
+// to supply it.
+type PreorderForecast struct {
+	Bands    []*BandForecast
+	Reserved int // birds reserved by open and collected pre-orders
+	Supply   int // birds in the supplying batches
+	Unbanded int // birds without a weight estimate or estimated outside every band
+}
+
+// Overbooked reports whether more birds are reserved than forecast.
+func (f *PreorderForecast) Overbooked() bool {
+	return f.Reserved > f.Supply
+}
+
+// Warnings returns the reasons the campaign may not be able to deliver, overall first.
+func (f *PreorderForecast) Warnings() []string {
+	var warnings []string
+	if f.Overbooked() {
+		warnings = append(warnings, fmt.Sprintf("%d birds reserved but only %d forecast: %d over supply", f.Reserved, f.Supply, f.Reserved-f.Supply))
+	}
+	for _, band := range f.Bands {
+		if short := band.Shortfall(); short > 0 {
+			warnings = append(warnings, fmt.Sprintf("%s: %d reserved, %d forecast in this band", band.Band, band.Reserved, band.Supply))
+		}
+	}
+	return warnings
+}
+
+// BuildPreorderForecast totals the campaign's reservations per weight band and spreads the
+// supplying batches over the bands by their estimated weight per bird. A batch without a head
+// count is counted with the birds of its flock. Cancelled pre-orders do not count.
+func BuildPreorderForecast(campaign *PreorderCampaign, preorders []*Preorder, batches []*ProductionBatch) *PreorderForecast {
+	forecast := &PreorderForecast{}
+	byBand := map[int64]*BandForecast{}
+	for _, band := range campaign.Bands {
+		row := &BandForecast{Band: band}
+		byBand[band.WeightBandID] = row
+		forecast.Bands = append(forecast.Bands, row)
+	}
+	sort.SliceStable(forecast.Bands, func(i, j int) bool { return forecast.Bands[i].Band.MinKg < forecast.Bands[j].Band.MinKg })
+
+	for _, p := range preorders {
+		if p.Status == PreorderStatusCancelled {
+			continue
+		}
+		forecast.Reserved += p.Quantity
+		if row, ok := byBand[p.WeightBandID]; ok {
+			row.Reserved += p.Quantity
+		}
+	}
+
+	for _, batch := range batches {
+		birds := batch.Birds()
+		forecast.Supply += birds
+		var band *WeightBand
+		if batch.WeightEstimate != nil {
+			band = campaign.BandFor(*batch.WeightEstimate)
+		}
+		if band == nil {
+			forecast.Unbanded += birds
+			continue
+		}
+		byBand[band.WeightBandID].Supply += birds
+	}
+	return forecast
+}
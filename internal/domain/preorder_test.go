@@ -0,0 +1,49 @@
+package domain
+
+import "testing"
+
+func TestBuildPreorderForecast(t *testing.T) {
+	small := &WeightBand{WeightBandID: 1, Label: "Small", MinKg: 4, MaxKg: 6}
+	large := &WeightBand{WeightBandID: 2, Label: "Large", MinKg: 6, MaxKg: 9}
+	campaign := &PreorderCampaign{Bands: []*WeightBand{large, small}}
+	kg := func(v float64) *float64 { return &v }
+	n := func(v int) *int { return &v }
+
+	forecast := BuildPreorderForecast(campaign, []*Preorder{
+		{WeightBandID: 1, Quantity: 10, Status: PreorderStatusReserved},
+		{WeightBandID: 2, Quantity: 25, Status: PreorderStatusReserved},
+		{WeightBandID: 2, Quantity: 5, Status: PreorderStatusCollected},
+		{WeightBandID: 2, Quantity: 50, Status: PreorderStatusCancelled},
+	}, []*ProductionBatch{
+		{NumberInBatch: n(20), WeightEstimate: kg(5.2)},
+		{WeightEstimate: kg(7), Flock: &Flock{NumberOfBirds: n(18)}},
+		{NumberInBatch: n(4)},
+	})
+
+	if forecast.Reserved != 40 || forecast.Supply != 42 || forecast.Unbanded != 4 || forecast.Overbooked() {
+		t.Fatalf("forecast totals = %+v", forecast)
+	}
+	if forecast.Bands[0].Band != small || forecast.Bands[0].Supply != 20 || forecast.Bands[0].Shortfall() != 0 {
+		t.Errorf("small band = %+v", forecast.Bands[0])
+	}
+	if forecast.Bands[1].Reserved != 30 || forecast.Bands[1].Supply != 18 || forecast.Bands[1].Shortfall() != 12 {
+		t.Errorf("large band = %+v", forecast.Bands[1])
+	}
+	if warnings := forecast.Warnings(); len(warnings) != 1 {
+		t.Errorf("warnings = %q, want only the large band", warnings)
+	}
+}
+
+func TestPreorderDepositOutstanding(t *testing.T) {
+	p := &Preorder{Quantity: 3, DepositPaid: 20}
+	if got := p.DepositOutstanding(12.5); got != 17.5 {
+		t.Errorf("outstanding = %v, want 17.5", got)
+	}
+	p.DepositPaid = 50
+	if got := p.DepositOutstanding(12.5); got != 0 {
+		t.Errorf("overpaid outstanding = %v, want 0", got)
+	}
+	if !PreorderStatusReserved.CanChangeTo(PreorderStatusCollected) || PreorderStatusCancelled.CanChangeTo(PreorderStatusCollected) {
+		t.Error("only reserved pre-orders can be collected")
+	}
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Customer types that price lists can target.
+const (
+	CustomerTypeRetail     = "retail"
+	CustomerTypeWholesale  = "wholesale"
+	CustomerTypeRestaurant = "restaurant"
+)
+
+// CustomerTypes lists the customer types in display order.
+var CustomerTypes = []string{CustomerTypeRetail, CustomerTypeWholesale, CustomerTypeRestaurant}
+
+// PriceList is a set of product prices for a customer type, valid over a date range.
+// A nil CustomerType makes it the default list for customers without a dedicated one.
+type PriceList struct {
+	PriceListID  int64
+	Name         string
+	CustomerType *string
+	ValidFrom    *time.Time
+	ValidTo      *time.Time
+	Audit        AuditFields
+
+	// Relations
+	Items []*PriceListItem
+}
+
+// PriceListItem is the unit price of one product in a price list
+type PriceListItem struct {
+	PriceListItemID int64
+	PriceListID     int64
+	ProductID       int64
+	UnitPrice       float64
+	Audit           AuditFields
+
+	// Relations
+	Product *Product
+}
+
+// ValidOn reports whether the list applies on the given day. Bounds are inclusive and open when unset.
+func (p *PriceList) ValidOn(day time.Time) bool {
+	d := truncateDay(day)
+	if p.ValidFrom != nil && d.Before(truncateDay(*p.ValidFrom)) {
+		return false
+	}
+	if p.ValidTo != nil && d.After(truncateDay(*p.ValidTo)) {
+		return false
+	}
+	return true
+}
+
+// AppliesTo reports whether the list targets the given customer type (case-insensitive).
+func (p *PriceList) AppliesTo(customerType string) bool {
+	if p.CustomerType == nil {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(*p.CustomerType), strings.TrimSpace(customerType))
+}
+
+// SelectPriceList picks the list to price an order for a customer type on a day: a valid list
+// dedicated to the customer type wins over a valid default list; among equals the one that
+// started most recently wins.
+func SelectPriceList(lists []*PriceList, customerType string, day time.Time) *PriceList {
+	var best *PriceList
+	for _, list := range lists {
+		if !list.ValidOn(day) || !list.AppliesTo(customerType) {
+			continue
+		}
+		if best == nil || priceListRank(list) > priceListRank(best) ||
+			(priceListRank(list) == priceListRank(best) && startsAfter(list, best)) {
+			best = list
+		}
+	}
+	return best
+}
+
+func priceListRank(p *PriceList) int {
+	if p.CustomerType != nil {
+		return 1
+	}
+	return 0
+}
+
+func startsAfter(a, b *PriceList) bool {
+	switch {
+	case a.ValidFrom == nil:
+		return false
+	case b.ValidFrom == nil:
+		return true
+	default:
+		return a.ValidFrom.After(*b.ValidFrom)
+	}
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,16 @@
+package domain
+
+// Product is a sellable item from the catalog (whole bird, breast fillet, ground meat...)
+type Product struct {
+	ProductID   int64
+	SKU         string
+	Name        string
+	Unit        string  // sales unit, e.g. "kg" or "piece"
+	VATRate     float64 // percentage, e.g. 9 for 9%
+	Description *string
+	Active      bool
+	Audit       AuditFields
+}
+
+// Product sales units offered in the catalog form.
+var ProductUnits = []string{"kg", "piece", "pack"}
@@ -0,0 +1,150 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// ErrLotReserved is returned when deleting a product lot that orders have reserved stock from.
+var ErrLotReserved = errors.New("the lot has stock reserved by orders")
+
+// ProductLot is a packed batch of one product from a slaughter, e.g. 40 breast fillets weighing
+// 12.5 kg. Lots are the sellable finished-goods stock.
+type ProductLot struct {
+	ProductLotID int64
+	SlaughterID  int64
+	ProductID    int64
+	WeightKg     float64
+	PieceCount   int
+	PackingDate  time.Time
+	UseByDate    *time.Time
+	Audit        AuditFields
+
+	// Relations
+	Product   *Product
+	Committed float64 // reserved by orders, including stock already shipped
+	Shipped   float64 // reserved by orders that have been delivered
+}
+
+// Quantity returns the lot size in the product's sales unit: the weight for products sold by
+// the kg, the piece count otherwise.
+func (l *ProductLot) Quantity() float64 {
+	if l.Product != nil && l.Product.Unit == "kg" {
+		return l.WeightKg
+	}
+	return float64(l.PieceCount)
+}
+
+// Available returns the quantity not yet reserved by any order.
+func (l *ProductLot) Available() float64 {
+	available := roundQuantity(l.Quantity() - l.Committed)
+	if available < 0 {
+		return 0
+	}
+	return available
+}
+
+// Expired reports whether the lot is past its use-by date on day.
+func (l *ProductLot) Expired(day time.Time) bool {
+	return l.UseByDate != nil && l.UseByDate.Before(day)
+}
+
+// StockReservation sets aside part of a product lot for an order line.
+type StockReservation struct {
+	StockReservationID int64
+	OrderItemID        int64
+	ProductLotID       int64
+	Quantity           float64
+}
+
+// LotAllocation is the part of a lot reserved for an order line.
+type LotAllocation struct {
+	Lot      *ProductLot
+	Quantity float64
+}
+
+// AllocateLots reserves up to need from the lots, first-expiring first (lots without a use-by
+// date last, then oldest packing first), skipping expired and exhausted lots. The allocations
+// may fall short of need when stock runs out.
+func AllocateLots(need float64, lots []*ProductLot, day time.Time) []LotAllocation {
+	candidates := make([]*ProductLot, 0, len(lots))
+	for _, lot := range lots {
+		if !lot.Expired(day) && lot.Available() > 0 {
+			candidates = append(candidates, lot)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.UseByDate == nil && b.UseByDate != nil:
+			return false
+		case a.UseByDate != nil && b.UseByDate == nil:
+			return true
+		case a.UseByDate != nil && !a.UseByDate.Equal(*b.UseByDate):
+			return a.UseByDate.Before(*b.UseByDate)
+		}
+		return a.PackingDate.Before(b.PackingDate)
+	})
+
+	var allocations []LotAllocation
+	for _, lot := range candidates {
+		if roundQuantity(need) <= 0 {
+			break
+		}
+		take := min(lot.Available(), need)
+		allocations = append(allocations, LotAllocation{Lot: lot, Quantity: roundQuantity(take)})
+		need -= take
+	}
+	return allocations
+}
+
+// ProductStock summarises the finished-goods stock of one product for the sales team.
+type ProductStock struct {
+	Product   *Product
+	Lots      int
+	OnHand    float64    // in the cold room: packed and not yet delivered
+	Reserved  float64    // on hand but set aside for confirmed orders
+	Expired   float64    // on hand, unreserved and past its use-by date
+	Available float64    // on hand, unreserved and still within its use-by date
+	NextUseBy *time.Time // earliest use-by date of the available lots
+}
+
+// BuildSellableStock totals the lots per product on day, ordered by product name. Lots that are
+// fully shipped are left out.
+func BuildSellableStock(lots []*ProductLot, day time.Time) []*ProductStock {
+	byProduct := map[int64]*ProductStock{}
+	var rows []*ProductStock
+	for _, lot := range lots {
+		onHand := roundQuantity(lot.Quantity() - lot.Shipped)
+		if onHand <= 0 {
+			continue
+		}
+		row, ok := byProduct[lot.ProductID]
+		if !ok {
+			row = &ProductStock{Product: lot.Product}
+			byProduct[lot.ProductID] = row
+			rows = append(rows, row)
+		}
+		row.Lots++
+		row.OnHand = roundQuantity(row.OnHand + onHand)
+		row.Reserved = roundQuantity(row.Reserved + lot.Committed - lot.Shipped)
+		if lot.Expired(day) {
+			row.Expired = roundQuantity(row.Expired + lot.Available())
+			continue
+		}
+		row.Available = roundQuantity(row.Available + lot.Available())
+		if lot.UseByDate != nil && lot.Available() > 0 && (row.NextUseBy == nil || lot.UseByDate.Before(*row.NextUseBy)) {
+			row.NextUseBy = lot.UseByDate
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Product.Name < rows[j].Product.Name })
+	return rows
+}
+
+// roundQuantity rounds stock quantities to grams (or thousandths of a piece) so float sums
+// compare cleanly.
+func roundQuantity(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllocateLots_FirstExpiringFirst(t *testing.T) {
+	day := time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+	date := func(d int) *time.Time { v := day.AddDate(0, 0, d); return &v }
+	kg := &Product{Name: "Breast", Unit: "kg"}
+
+	expired := &ProductLot{ProductLotID: 1, Product: kg, WeightKg: 10, PackingDate: day.AddDate(0, 0, -9), UseByDate: date(-1)}
+	undated := &ProductLot{ProductLotID: 2, Product: kg, WeightKg: 10, PackingDate: day.AddDate(0, 0, -8)}
+	late := &ProductLot{ProductLotID: 3, Product: kg, WeightKg: 10, PackingDate: day.AddDate(0, 0, -2), UseByDate: date(6)}
+	early := &ProductLot{ProductLotID: 4, Product: kg, WeightKg: 5, Committed: 2, PackingDate: day.AddDate(0, 0, -3), UseByDate: date(3)}
+
+	allocations := AllocateLots(15.5, []*ProductLot{expired, undated, late, early}, day)
+	want := []struct {
+		id  int64
+		qty float64
+	}{{4, 3}, {3, 10}, {2, 2.5}}
+	if len(allocations) != len(want) {
+		t.Fatalf("got %d allocations, want %d: %+v", len(allocations), len(want), allocations)
+	}
+	for i, w := range want {
+		if allocations[i].Lot.ProductLotID != w.id || allocations[i].Quantity != w.qty {
+			t.Errorf("allocation %d = lot %d x %v, want lot %d x %v", i, allocations[i].Lot.ProductLotID, allocations[i].Quantity, w.id, w.qty)
+		}
+	}
+
+	if short := AllocateLots(100, []*ProductLot{early}, day); len(short) != 1 || short[0].Quantity != 3 {
+		t.Errorf("short allocation = %+v, want the 3 available", short)
+	}
+}
+
+func TestBuildSellableStock(t *testing.T) {
+	day := time.Date(2026, 5, 10, 0, 0, 0, 0, time.UTC)
+	date := func(d int) *time.Time { v := day.AddDate(0, 0, d); return &v }
+	legs := &Product{ProductID: 1, Name: "Legs", Unit: "piece"}
+	breast := &Product{ProductID: 2, Name: "Breast", Unit: "kg"}
+
+	stock := BuildSellableStock([]*ProductLot{
+		{ProductID: 1, Product: legs, PieceCount: 20, Committed: 20, Shipped: 20},
+		{ProductID: 2, Product: breast, WeightKg: 12.5, Committed: 4, Shipped: 1, UseByDate: date(4)},
+		{ProductID: 2, Product: breast, WeightKg: 3, UseByDate: date(-2)},
+		{ProductID: 2, Product: breast, WeightKg: 6, UseByDate: date(2)},
+	}, day)
+
+	if len(stock) != 1 {
+		t.Fatalf("got %d products, want only breast (legs are shipped): %+v", len(stock), stock)
+	}
+	row := stock[0]
+	if row.Lots != 3 || row.OnHand != 20.5 || row.Reserved != 3 || row.Expired != 3 || row.Available != 14.5 {
+		t.Errorf("breast stock = %+v", row)
+	}
+	if row.NextUseBy == nil || !row.NextUseBy.Equal(*date(2)) {
+		t.Errorf("next use-by = %v, want %v", row.NextUseBy, date(2))
+	}
+}
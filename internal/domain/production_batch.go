@@ -8,10 +8,22 @@ type ProductionBatch struct {
 	FlockID        int64
 	DateReady      *time.Time
 	NumberInBatch  *int
-	WeightEstimate *float64
+	WeightEstimate *float64 // estimated weight per bird, in kg
 	Notes          *string
 	Audit          AuditFields
 
 	// Relations
 	Flock *Flock
 }
+
+// Birds returns the head count of the batch, falling back to the birds of its flock when the
+// batch count is not recorded.
+func (p *ProductionBatch) Birds() int {
+	switch {
+	case p.NumberInBatch != nil:
+		return *p.NumberInBatch
+	case p.Flock != nil && p.Flock.NumberOfBirds != nil:
+		return *p.Flock.NumberOfBirds
+	}
+	return 0
+}
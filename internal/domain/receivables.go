@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// AgingBucket groups open invoices by how long they are past due.
+type AgingBucket int
+
+const (
+	AgingCurrent AgingBucket = iota // not due, or less than 30 days past due
+	Aging30                         // 30-59 days past due
+	Aging60                         // 60-89 days past due
+	Aging90                         // 90 or more days past due
+)
+
+// AgingBuckets lists the buckets in report order.
+var AgingBuckets = []AgingBucket{AgingCurrent, Aging30, Aging60, Aging90}
+
+// Label returns the bucket column title.
+func (b AgingBucket) Label() string {
+	switch b {
+	case Aging30:
+		return "30 days"
+	case Aging60:
+		return "60 days"
+	case Aging90:
+		return "90+ days"
+	}
+	return "Current"
+}
+
+// AgingBucketFor returns the bucket of an invoice due on dueDate, as of asOf.
+func AgingBucketFor(dueDate, asOf time.Time) AgingBucket {
+	overdue := int(asOf.Sub(dueDate).Hours() / 24)
+	switch {
+	case overdue >= 90:
+		return Aging90
+	case overdue >= 60:
+		return Aging60
+	case overdue >= 30:
+		return Aging30
+	}
+	return AgingCurrent
+}
+
+// CustomerAging is one customer's row in the accounts-receivable aging report.
+type CustomerAging struct {
+	CustomerID   int64
+	CustomerName string
+	Buckets      [4]float64 // indexed by AgingBucket
+	Total        float64
+}
+
+// BuildAging totals the open amounts of the invoices per customer and aging bucket, ordered by
+// customer name. Settled invoices are left out.
+func BuildAging(balances []*InvoiceBalance, asOf time.Time) []*CustomerAging {
+	byCustomer := map[int64]*CustomerAging{}
+	var rows []*CustomerAging
+	for _, b := range balances {
+		open := b.Open()
+		if open <= 0 {
+			continue
+		}
+		row, ok := byCustomer[b.Invoice.CustomerID]
+		if !ok {
+			row = &CustomerAging{CustomerID: b.Invoice.CustomerID, CustomerName: b.Invoice.CustomerName}
+			byCustomer[b.Invoice.CustomerID] = row
+			rows = append(rows, row)
+		}
+		bucket := AgingBucketFor(b.Invoice.DueDate, asOf)
+		row.Buckets[bucket] = roundCents(row.Buckets[bucket] + open)
+		row.Total = roundCents(row.Total + open)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].CustomerName < rows[j].CustomerName })
+	return rows
+}
+
+// StatementLine is one movement on a customer statement. Invoices are debits; credit notes and
+// payments are credits. Balance is the running amount owed after the line.
+type StatementLine struct {
+	Date        time.Time
+	Description string
+	InvoiceID   *int64
+	PaymentID   *int64
+	Debit       float64
+	Credit      float64
+	Balance     float64
+}
+
+// BuildStatement lists a customer's invoices, credit notes and payments by date with the
+// running balance; on the same day documents come before payments.
+func BuildStatement(invoices []*Invoice, payments []*Payment) []StatementLine {
+	lines := make([]StatementLine, 0, len(invoices)+len(payments))
+	for _, inv := range invoices {
+		id := inv.InvoiceID
+		line := StatementLine{Date: inv.IssueDate, Description: inv.Kind.Label() + " " + inv.Number, InvoiceID: &id}
+		if inv.TotalAmount >= 0 {
+			line.Debit = inv.TotalAmount
+		} else {
+			line.Credit = -inv.TotalAmount
+		}
+		lines = append(lines, line)
+	}
+	for _, p := range payments {
+		id := p.PaymentID
+		description := "Payment (" + p.Method.Label() + ")"
+		if p.Reference != nil && *p.Reference != "" {
+			description += " " + *p.Reference
+		}
+		lines = append(lines, StatementLine{Date: p.PaymentDate, Description: description, PaymentID: &id, Credit: p.Amount})
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if !lines[i].Date.Equal(lines[j].Date) {
+			return lines[i].Date.Before(lines[j].Date)
+		}
+		return lines[i].PaymentID == nil && lines[j].PaymentID != nil
+	})
+
+	var balance float64
+	for i := range lines {
+		balance = roundCents(balance + lines[i].Debit - lines[i].Credit)
+		lines[i].Balance = balance
+	}
+	return lines
+}
@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildAging(t *testing.T) {
+	asOf := time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC)
+	due := func(daysAgo int) time.Time { return asOf.AddDate(0, 0, -daysAgo) }
+	invoice := func(customerID int64, name string, total float64, dueDate time.Time) *Invoice {
+		return &Invoice{Kind: InvoiceKindInvoice, CustomerID: customerID, CustomerName: name, TotalAmount: total, DueDate: dueDate}
+	}
+
+	rows := BuildAging([]*InvoiceBalance{
+		{Invoice: invoice(2, "Shop", 100, due(-10))},             // not yet due
+		{Invoice: invoice(2, "Shop", 50, due(45)), Paid: 20},     // partially paid, 30 days
+		{Invoice: invoice(2, "Shop", 80, due(120))},              // 90+ days
+		{Invoice: invoice(1, "Butcher", 40, due(61))},            // 60 days
+		{Invoice: invoice(1, "Butcher", 25, due(200)), Paid: 25}, // settled
+		{Invoice: invoice(1, "Butcher", 30, due(95)), Credited: 30},
+	}, asOf)
+
+	if len(rows) != 2 || rows[0].CustomerName != "Butcher" || rows[1].CustomerName != "Shop" {
+		t.Fatalf("rows = %+v, want Butcher then Shop", rows)
+	}
+	if want := [4]float64{0, 0, 40, 0}; rows[0].Buckets != want || rows[0].Total != 40 {
+		t.Errorf("Butcher = %v total %v, want %v total 40", rows[0].Buckets, rows[0].Total, want)
+	}
+	if want := [4]float64{100, 30, 0, 80}; rows[1].Buckets != want || rows[1].Total != 210 {
+		t.Errorf("Shop = %v total %v, want %v total 210", rows[1].Buckets, rows[1].Total, want)
+	}
+}
+
+func TestBuildStatement(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 5, d, 0, 0, 0, 0, time.UTC) }
+	lines := BuildStatement(
+		[]*Invoice{
+			{InvoiceID: 1, Kind: InvoiceKindInvoice, Number: "INV-2026-00001", IssueDate: day(1), TotalAmount: 100},
+			{InvoiceID: 2, Kind: InvoiceKindCreditNote, Number: "CN-2026-00001", IssueDate: day(10), TotalAmount: -100},
+			{InvoiceID: 3, Kind: InvoiceKindInvoice, Number: "INV-2026-00002", IssueDate: day(10), TotalAmount: 90},
+		},
+		[]*Payment{
+			{PaymentID: 1, PaymentDate: day(10), Method: PaymentMethodCash, Amount: 60},
+		},
+	)
+
+	want := []float64{100, 0, 90, 30}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(want))
+	}
+	for i, line := range lines {
+		if line.Balance != want[i] {
+			t.Errorf("line %d (%s) balance = %v, want %v", i, line.Description, line.Balance, want[i])
+		}
+	}
+	if lines[3].PaymentID == nil {
+		t.Errorf("payment should follow the documents of the same day, got %s last", lines[3].Description)
+	}
+}
@@ -0,0 +1,208 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// MinRestBetweenShifts is the daily rest a staff member gets in every 24 hours under the EU
+// working time rules.
+const MinRestBetweenShifts = 11 * time.Hour
+
+var (
+	// ErrInvalidClockTime is returned when a shift or task time is not a HH:MM clock time.
+	ErrInvalidClockTime = errors.New("times must be given as HH:MM")
+	// ErrShiftOverlap is returned when a staff member would work two shifts at once.
+	ErrShiftOverlap = errors.New("the staff member is already rostered at that time")
+	// ErrShiftRestTooShort is returned when a staff member would not get the daily rest.
+	ErrShiftRestTooShort = errors.New("the staff member would not get the minimum daily rest")
+)
+
+// ShiftTemplate is a recurring kind of shift, e.g. "Morning feed round" from 06:00 to 09:00.
+// A template ending at or before its start time runs into the next day.
+type ShiftTemplate struct {
+	ShiftTemplateID int64
+	Name            string
+	StartTime       string // HH:MM
+	EndTime         string // HH:MM
+	BarnID          *int64 // barn the shift is usually worked in
+	Notes           *string
+	Audit           AuditFields
+
+	// Relations
+	BarnName *string
+}
+
+// Span returns when the shift starts and ends on day.
+func (t *ShiftTemplate) Span(day time.Time) (start, end time.Time, err error) {
+	from, err := parseClock(t.StartTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	to, err := parseClock(t.EndTime)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	start, end = midnight.Add(from), midnight.Add(to)
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// ValidateClock reports whether s is a HH:MM clock time.
+func ValidateClock(s string) error {
+	_, err := parseClock(s)
+	return err
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, ErrInvalidClockTime
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Shift is a staff member rostered on a day. Start and end are copied from the template when
+// the shift is assigned.
+type Shift struct {
+	ShiftID         int64
+	ShiftTemplateID int64
+	StaffID         int64
+	BarnID          *int64
+	ShiftDate       time.Time
+	StartsAt        time.Time
+	EndsAt          time.Time
+	Notes           *string
+	Audit           AuditFields
+
+	// Relations
+	TemplateName string
+	StaffName    string
+	BarnName     *string
+}
+
+// Hours returns the length of the shift.
+func (s *Shift) Hours() float64 {
+	return s.EndsAt.Sub(s.StartsAt).Hours()
+}
+
+// ShiftConflictError tells which rostered shift a new shift clashes with.
+type ShiftConflictError struct {
+	Err  error  // ErrShiftOverlap or ErrShiftRestTooShort
+	With *Shift // nil when the shift alone is too long to leave the rest
+}
+
+func (e *ShiftConflictError) Error() string {
+	if e.With == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (%s on %s, %s–%s)", e.Err, e.With.TemplateName, e.With.StartsAt.Format("2006-01-02"),
+		e.With.StartsAt.Format("15:04"), e.With.EndsAt.Format("15:04"))
+}
+
+func (e *ShiftConflictError) Unwrap() error { return e.Err }
+
+// CheckShift checks a new shift against the other shifts of the same staff member. Shifts may
+// not overlap. Shifts less than minRest apart are one working period (a split shift, e.g. a
+// morning round and an evening check); a working period must end early enough to leave minRest
+// off within the 24 hours from its start.
+func CheckShift(s *Shift, others []*Shift, minRest time.Duration) error {
+	mine := []*Shift{s}
+	for _, other := range others {
+		if other.StaffID != s.StaffID || (s.ShiftID != 0 && other.ShiftID == s.ShiftID) {
+			continue
+		}
+		if s.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(s.EndsAt) {
+			return &ShiftConflictError{Err: ErrShiftOverlap, With: other}
+		}
+		mine = append(mine, other)
+	}
+	sort.Slice(mine, func(i, j int) bool { return mine[i].StartsAt.Before(mine[j].StartsAt) })
+
+	// Find the working period around s.
+	at := slices.Index(mine, s)
+	first, last := at, at
+	for first > 0 && mine[first].StartsAt.Sub(mine[first-1].EndsAt) < minRest {
+		first--
+	}
+	for last < len(mine)-1 && mine[last+1].StartsAt.Sub(mine[last].EndsAt) < minRest {
+		last++
+	}
+	if mine[last].EndsAt.Sub(mine[first].StartsAt) <= 24*time.Hour-minRest {
+		return nil
+	}
+	conflict := &ShiftConflictError{Err: ErrShiftRestTooShort}
+	switch {
+	case last > at:
+		conflict.With = mine[at+1]
+	case first < at:
+		conflict.With = mine[at-1]
+	}
+	return conflict
+}
+
+// RosterView is how much of the roster the calendar shows at once.
+type RosterView string
+
+const (
+	RosterWeek  RosterView = "week"
+	RosterMonth RosterView = "month"
+)
+
+// RosterRange returns the days the calendar shows around day: its week, or the whole weeks
+// covering its month. Weeks start on Monday. to is exclusive.
+func RosterRange(view RosterView, day time.Time) (from, to time.Time) {
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if view == RosterMonth {
+		first := day.AddDate(0, 0, 1-day.Day())
+		last := first.AddDate(0, 1, -1)
+		return weekStart(first), weekStart(last).AddDate(0, 0, 7)
+	}
+	from = weekStart(day)
+	return from, from.AddDate(0, 0, 7)
+}
+
+// RosterStep moves the calendar one week or one month from day.
+func RosterStep(view RosterView, day time.Time, n int) time.Time {
+	if view == RosterMonth {
+		first := day.AddDate(0, 0, 1-day.Day())
+		return first.AddDate(0, n, 0)
+	}
+	return day.AddDate(0, 0, 7*n)
+}
+
+func weekStart(day time.Time) time.Time {
+	offset := (int(day.Weekday()) + 6) % 7 // Monday = 0
+	return day.AddDate(0, 0, -offset)
+}
+
+// RosterDay is one calendar cell: a day and the shifts starting on it.
+type RosterDay struct {
+	Date    time.Time
+	InMonth bool // false for the days padding a month view to whole weeks
+	Shifts  []*Shift
+}
+
+// BuildRosterCalendar lays out shifts on the days from from up to to. The month of focus marks
+// which days belong to the month shown.
+func BuildRosterCalendar(from, to time.Time, focus time.Time, shifts []*Shift) []*RosterDay {
+	var days []*RosterDay
+	byDate := map[string]*RosterDay{}
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		day := &RosterDay{Date: d, InMonth: d.Month() == focus.Month() && d.Year() == focus.Year()}
+		days = append(days, day)
+		byDate[d.Format("2006-01-02")] = day
+	}
+	for _, s := range shifts {
+		if day, ok := byDate[s.ShiftDate.Format("2006-01-02")]; ok {
+			day.Shifts = append(day.Shifts, s)
+		}
+	}
+	return days
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestShiftTemplate_Span(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	night := &ShiftTemplate{StartTime: "22:00", EndTime: "06:00"}
+	start, end, err := night.Span(day)
+	if err != nil {
+		t.Fatalf("span: %v", err)
+	}
+	if !start.Equal(day.Add(22*time.Hour)) || !end.Equal(day.Add(30*time.Hour)) {
+		t.Errorf("night shift = %v – %v, want 22:00 to 06:00 the next day", start, end)
+	}
+	if _, _, err := (&ShiftTemplate{StartTime: "6am", EndTime: "09:00"}).Span(day); !errors.Is(err, ErrInvalidClockTime) {
+		t.Errorf("bad time: got %v, want ErrInvalidClockTime", err)
+	}
+}
+
+func TestCheckShift(t *testing.T) {
+	day := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	shift := func(id int64, from, to float64) *Shift {
+		return &Shift{ShiftID: id, StaffID: 1, StartsAt: day.Add(time.Duration(from * float64(time.Hour))), EndsAt: day.Add(time.Duration(to * float64(time.Hour)))}
+	}
+	morning := shift(1, 6, 9)
+	midday := shift(2, 12, 16)
+	rostered := []*Shift{morning, midday, {ShiftID: 3, StaffID: 2, StartsAt: day.Add(17 * time.Hour), EndsAt: day.Add(21 * time.Hour)}}
+
+	tests := []struct {
+		name  string
+		shift *Shift
+		want  error
+		with  *Shift
+	}{
+		{"overlap", shift(0, 8, 10), ErrShiftOverlap, morning},
+		{"split shift within 13 hours", shift(0, 17, 19), nil, nil},
+		{"split shift too long", shift(0, 18, 22), ErrShiftRestTooShort, midday},
+		{"other staff member's shift ignored", &Shift{StaffID: 3, StartsAt: day.Add(6 * time.Hour), EndsAt: day.Add(9 * time.Hour)}, nil, nil},
+		{"early next day without rest", shift(0, 24+2, 24+5), ErrShiftRestTooShort, midday},
+		{"next morning after rest", shift(0, 24+5, 24+8), nil, nil},
+		{"single shift too long", &Shift{StaffID: 5, StartsAt: day, EndsAt: day.Add(14 * time.Hour)}, ErrShiftRestTooShort, nil},
+	}
+	for _, tt := range tests {
+		err := CheckShift(tt.shift, rostered, MinRestBetweenShifts)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		var conflict *ShiftConflictError
+		if errors.As(err, &conflict) && conflict.With != tt.with {
+			t.Errorf("%s: conflicts with %+v, want %+v", tt.name, conflict.With, tt.with)
+		}
+	}
+}
+
+func TestRosterRange(t *testing.T) {
+	day := time.Date(2026, 10, 22, 15, 0, 0, 0, time.UTC) // a Thursday
+	from, to := RosterRange(RosterWeek, day)
+	if from.Format("2006-01-02") != "2026-10-19" || to.Format("2006-01-02") != "2026-10-26" {
+		t.Errorf("week = %v – %v, want Monday 19 to Monday 26", from, to)
+	}
+	from, to = RosterRange(RosterMonth, day)
+	if from.Format("2006-01-02") != "2026-09-28" || to.Format("2006-01-02") != "2026-11-02" {
+		t.Errorf("month = %v – %v, want the whole weeks from 28 Sep to 1 Nov", from, to)
+	}
+	if got := RosterStep(RosterMonth, time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC), 1); got.Format("2006-01-02") != "2026-02-01" {
+		t.Errorf("next month from 31 Jan = %v, want 1 Feb", got)
+	}
+}
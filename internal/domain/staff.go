@@ -2,10 +2,16 @@ package domain
 
 // Staff represents farm staff members
 type Staff struct {
-	StaffID     int64
+	StaffID int64
+	// FarmID is the farm the staff member works on
+	FarmID      int64
 	Name        string
 	Role        *string
 	Schedule    *string
 	ContactInfo *string
-	Audit       AuditFields
+	// HourlyRate is what an hour of the staff member's time costs the farm
+	HourlyRate *float64
+	// CalendarToken is the secret in the URL of the staff member's roster feed
+	CalendarToken *string
+	Audit         AuditFields
 }
@@ -0,0 +1,232 @@
+package domain
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaskKind says how a barn task is recorded: ticked off, or through the record it produces.
+type TaskKind string
+
+const (
+	TaskKindGeneral     TaskKind = "general"
+	TaskKindMortality   TaskKind = "mortality"
+	TaskKindFeeding     TaskKind = "feeding"
+	TaskKindHealthCheck TaskKind = "health_check"
+)
+
+// TaskKinds lists the task kinds in display order.
+var TaskKinds = []TaskKind{TaskKindGeneral, TaskKindMortality, TaskKindFeeding, TaskKindHealthCheck}
+
+// Label returns the task kind for display.
+func (k TaskKind) Label() string {
+	switch k {
+	case TaskKindGeneral:
+		return "Checklist item"
+	case TaskKindMortality:
+		return "Mortality pickup"
+	case TaskKindFeeding:
+		return "Feed round"
+	case TaskKindHealthCheck:
+		return "Health check"
+	}
+	return string(k)
+}
+
+// RecordPath is the path of the form that records a task of this kind, empty for checklist
+// items that are simply ticked off.
+func (k TaskKind) RecordPath() string {
+	switch k {
+	case TaskKindMortality:
+		return "/management/mortality-records/new"
+	case TaskKindFeeding:
+		return "/management/feeding-records/new"
+	case TaskKindHealthCheck:
+		return "/management/health-checks/new"
+	}
+	return ""
+}
+
+// Weekdays is the set of weekdays a task recurs on, one bit per time.Weekday. The empty set
+// means every day.
+type Weekdays uint8
+
+// WeekdaysOf returns the set of the given days.
+func WeekdaysOf(days ...time.Weekday) Weekdays {
+	var w Weekdays
+	for _, d := range days {
+		w |= 1 << d
+	}
+	return w
+}
+
+// Has reports whether the task recurs on d.
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w == 0 || w&(1<<d) != 0
+}
+
+// Label returns the recurrence for display, e.g. "Every day" or "Mon, Thu".
+func (w Weekdays) Label() string {
+	if w == 0 || w == WeekdaysOf(time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday) {
+		return "Every day"
+	}
+	var days []string
+	for _, d := range WeekdayOrder {
+		if w&(1<<d) != 0 {
+			days = append(days, d.String()[:3])
+		}
+	}
+	return strings.Join(days, ", ")
+}
+
+// WeekdayOrder lists the weekdays starting on Monday.
+var WeekdayOrder = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// TaskTemplate is a recurring piece of barn work, e.g. the water line check at 07:00 every day,
+// optionally for one flock and with a default assignee.
+type TaskTemplate struct {
+	TaskTemplateID int64
+	Name           string
+	Kind           TaskKind
+	BarnID         int64
+	FlockID        *int64
+	StaffID        *int64
+	Weekdays       Weekdays
+	DueTime        string // HH:MM
+	Notes          *string
+	Active         bool
+	Audit          AuditFields
+
+	// Relations
+	BarnName   string
+	FlockBreed *string
+	StaffName  *string
+}
+
+// DueOn reports whether the template puts a task on the checklist of day. Templates do not
+// reach back before the day they were created.
+func (t *TaskTemplate) DueOn(day time.Time) bool {
+	if !t.Active || !t.Weekdays.Has(day.Weekday()) {
+		return false
+	}
+	if created := t.Audit.CreatedAt; !created.IsZero() {
+		c := created.In(day.Location())
+		if day.Before(time.Date(c.Year(), c.Month(), c.Day(), 0, 0, 0, 0, day.Location())) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewTask returns the task the template puts on the checklist of day.
+func (t *TaskTemplate) NewTask(day time.Time) *Task {
+	return &Task{
+		TaskTemplateID: t.TaskTemplateID,
+		Name:           t.Name,
+		Kind:           t.Kind,
+		BarnID:         t.BarnID,
+		FlockID:        t.FlockID,
+		StaffID:        t.StaffID,
+		TaskDate:       time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location()),
+		DueTime:        t.DueTime,
+		Status:         TaskOpen,
+	}
+}
+
+// TaskStatus is where a task stands on its checklist.
+type TaskStatus string
+
+const (
+	TaskOpen    TaskStatus = "open"
+	TaskDone    TaskStatus = "done"
+	TaskSkipped TaskStatus = "skipped"
+)
+
+// Label returns the status for display.
+func (s TaskStatus) Label() string {
+	switch s {
+	case TaskOpen:
+		return "Open"
+	case TaskDone:
+		return "Done"
+	case TaskSkipped:
+		return "Skipped"
+	}
+	return string(s)
+}
+
+// Task is one item on a barn's checklist for a day.
+type Task struct {
+	TaskID         int64
+	TaskTemplateID int64
+	Name           string
+	Kind           TaskKind
+	BarnID         int64
+	FlockID        *int64
+	StaffID        *int64
+	TaskDate       time.Time
+	DueTime        string // HH:MM
+	Status         TaskStatus
+	CompletedAt    *time.Time
+	CompletedBy    *string
+	RecordID       *int64 // the record completing a mortality, feeding or health check task
+	Notes          *string
+	Audit          AuditFields
+
+	// Relations
+	BarnName  string
+	StaffName *string
+}
+
+// DueAt returns when the task is due; an unreadable due time counts as the end of its day.
+func (t *Task) DueAt() time.Time {
+	day := time.Date(t.TaskDate.Year(), t.TaskDate.Month(), t.TaskDate.Day(), 0, 0, 0, 0, t.TaskDate.Location())
+	d, err := parseClock(t.DueTime)
+	if err != nil {
+		return day.AddDate(0, 0, 1)
+	}
+	return day.Add(d)
+}
+
+// Overdue reports whether the task is still open after its due time.
+func (t *Task) Overdue(now time.Time) bool {
+	return t.Status == TaskOpen && now.After(t.DueAt())
+}
+
+// BarnChecklist is the day's tasks of one barn.
+type BarnChecklist struct {
+	BarnID   int64
+	BarnName string
+	Tasks    []*Task
+}
+
+// Progress returns how many of the checklist's tasks are settled (done or skipped).
+func (c *BarnChecklist) Progress() (settled, total int) {
+	for _, t := range c.Tasks {
+		if t.Status != TaskOpen {
+			settled++
+		}
+	}
+	return settled, len(c.Tasks)
+}
+
+// BuildChecklists groups tasks into one checklist per barn, barns by name and tasks by due time.
+func BuildChecklists(tasks []*Task) []*BarnChecklist {
+	byBarn := map[int64]*BarnChecklist{}
+	var lists []*BarnChecklist
+	for _, t := range tasks {
+		list, ok := byBarn[t.BarnID]
+		if !ok {
+			list = &BarnChecklist{BarnID: t.BarnID, BarnName: t.BarnName}
+			byBarn[t.BarnID] = list
+			lists = append(lists, list)
+		}
+		list.Tasks = append(list.Tasks, t)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].BarnName < lists[j].BarnName })
+	for _, list := range lists {
+		sort.SliceStable(list.Tasks, func(i, j int) bool { return list.Tasks[i].DueTime < list.Tasks[j].DueTime })
+	}
+	return lists
+}
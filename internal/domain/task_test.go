@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskTemplate_DueOn(t *testing.T) {
+	created := time.Date(2026, 10, 14, 15, 0, 0, 0, time.UTC) // a Wednesday
+	tmpl := &TaskTemplate{Active: true, Weekdays: WeekdaysOf(time.Monday, time.Thursday), Audit: AuditFields{CreatedAt: created}}
+
+	cases := []struct {
+		day  time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), false}, // Monday before the template existed
+		{time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), true},  // Thursday
+		{time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), false}, // Saturday
+		{time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), true},  // Monday
+	}
+	for _, c := range cases {
+		if got := tmpl.DueOn(c.day); got != c.want {
+			t.Errorf("DueOn(%s) = %v, want %v", c.day.Format("Mon 2006-01-02"), got, c.want)
+		}
+	}
+
+	daily := &TaskTemplate{Active: true, Audit: AuditFields{CreatedAt: created}}
+	if !daily.DueOn(created) {
+		t.Error("a daily template is due on the day it was created")
+	}
+	daily.Active = false
+	if daily.DueOn(created.AddDate(0, 0, 1)) {
+		t.Error("a paused template is never due")
+	}
+}
+
+func TestWeekdays_Label(t *testing.T) {
+	if got := Weekdays(0).Label(); got != "Every day" {
+		t.Errorf("empty set = %q", got)
+	}
+	if got := WeekdaysOf(time.Sunday, time.Monday, time.Thursday).Label(); got != "Mon, Thu, Sun" {
+		t.Errorf("label = %q, want weeks starting on Monday", got)
+	}
+}
+
+func TestTask_Overdue(t *testing.T) {
+	task := &Task{TaskDate: time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), DueTime: "07:30", Status: TaskOpen}
+	if task.Overdue(time.Date(2026, 10, 19, 7, 30, 0, 0, time.UTC)) {
+		t.Error("a task is not overdue at its due time")
+	}
+	if !task.Overdue(time.Date(2026, 10, 19, 7, 31, 0, 0, time.UTC)) {
+		t.Error("an open task after its due time is overdue")
+	}
+	task.Status = TaskDone
+	if task.Overdue(time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Error("a done task is never overdue")
+	}
+}
+
+func TestBuildChecklists(t *testing.T) {
+	lists := BuildChecklists([]*Task{
+		{Name: "Evening check", BarnID: 2, BarnName: "North", DueTime: "19:00", Status: TaskDone},
+		{Name: "Water line check", BarnID: 1, BarnName: "East", DueTime: "07:00", Status: TaskOpen},
+		{Name: "Feed round", BarnID: 2, BarnName: "North", DueTime: "06:30", Status: TaskOpen},
+	})
+	if len(lists) != 2 || lists[0].BarnName != "East" || lists[1].BarnName != "North" {
+		t.Fatalf("lists = %+v, want East then North", lists)
+	}
+	if lists[1].Tasks[0].Name != "Feed round" {
+		t.Errorf("first North task = %q, want the earliest due", lists[1].Tasks[0].Name)
+	}
+	if settled, total := lists[1].Progress(); settled != 1 || total != 2 {
+		t.Errorf("progress = %d of %d, want 1 of 2", settled, total)
+	}
+}
@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SlaughterLotCode formats the lot code printed on labels for the output of a slaughter run
+func SlaughterLotCode(slaughterID int64) string {
+	return "L-" + strconv.FormatInt(slaughterID, 10)
+}
+
+// TraceDelivery is an order line that shipped meat from a traced slaughter lot
+type TraceDelivery struct {
+	OrderItem *OrderItem
+	Order     *Order
+	Customer  *Customer
+}
+
+// TraceFeedLot summarises one feed lot given to a traced flock
+type TraceFeedLot struct {
+	FeedTypeName     string
+	OrganicCertified bool
+	LotNumber        string
+	TotalAmount      float64
+	FirstFed         *time.Time
+	LastFed          *time.Time
+}
+
+// TraceabilityChain is the full hatchery-to-customer chain of one production batch.
+// Backwards it reaches the flock, barn, feed lots and treatments; forwards every
+// customer who received meat from any slaughter lot of the batch.
+type TraceabilityChain struct {
+	Batch            *ProductionBatch
+	Flock            *Flock
+	FeedingRecords   []*FeedingRecord
+	HealthChecks     []*HealthCheck
+	SlaughterRecords []*SlaughterRecord
+	Deliveries       []*TraceDelivery
+}
+
+// FeedLots groups the feeding records of the chain by feed type and lot number
+func (c *TraceabilityChain) FeedLots() []*TraceFeedLot {
+	byKey := map[string]*TraceFeedLot{}
+	var lots []*TraceFeedLot
+	for _, record := range c.FeedingRecords {
+		name := ""
+		organic := false
+		if record.FeedType != nil {
+			name = record.FeedType.Name
+			organic = record.FeedType.OrganicCertified
+		}
+		lotNumber := ""
+		if record.LotNumber != nil {
+			lotNumber = *record.LotNumber
+		}
+		key := strconv.FormatInt(record.FeedTypeID, 10) + "|" + lotNumber
+		lot, ok := byKey[key]
+		if !ok {
+			lot = &TraceFeedLot{FeedTypeName: name, OrganicCertified: organic, LotNumber: lotNumber}
+			byKey[key] = lot
+			lots = append(lots, lot)
+		}
+		if record.AmountGiven != nil {
+			lot.TotalAmount += *record.AmountGiven
+		}
+		if record.DateTime.Valid {
+			fed := record.DateTime.Time
+			if lot.FirstFed == nil || fed.Before(*lot.FirstFed) {
+				lot.FirstFed = &fed
+			}
+			if lot.LastFed == nil || fed.After(*lot.LastFed) {
+				lot.LastFed = &fed
+			}
+		}
+	}
+	sort.SliceStable(lots, func(i, j int) bool {
+		if lots[i].FeedTypeName != lots[j].FeedTypeName {
+			return lots[i].FeedTypeName < lots[j].FeedTypeName
+		}
+		return lots[i].LotNumber < lots[j].LotNumber
+	})
+	return lots
+}
+
+// Treatments returns the health checks that recorded a treatment or vaccination
+func (c *TraceabilityChain) Treatments() []*HealthCheck {
+	var treatments []*HealthCheck
+	for _, check := range c.HealthChecks {
+		if nonBlank(check.TreatmentsAdministered) || nonBlank(check.VaccinationsGiven) {
+			treatments = append(treatments, check)
+		}
+	}
+	return treatments
+}
+
+// Customers returns the distinct customers reached by the chain, in first-delivery order
+func (c *TraceabilityChain) Customers() []*Customer {
+	seen := map[int64]bool{}
+	var customers []*Customer
+	for _, delivery := range c.Deliveries {
+		if delivery.Customer == nil || seen[delivery.Customer.CustomerID] {
+			continue
+		}
+		seen[delivery.Customer.CustomerID] = true
+		customers = append(customers, delivery.Customer)
+	}
+	return customers
+}
+
+func nonBlank(s *string) bool {
+	return s != nil && strings.TrimSpace(*s) != ""
+}
@@ -0,0 +1,105 @@
+// Package events is an in-process publish/subscribe bus. Repositories publish an event after
+// every successful write and the server-sent event streams of open pages subscribe to the
+// entities they show, so a change made in one browser reaches the others without a reload.
+// Delivery is best effort: a subscriber that falls behind misses events rather than blocking
+// the writer, which is fine because every event only means "render again".
+package events
+
+import "sync"
+
+// Action is what happened to a record.
+type Action string
+
+const (
+	Created Action = "created"
+	Updated Action = "updated"
+	Deleted Action = "deleted"
+)
+
+// Event tells that a record of an entity changed. Entity is the name of the table the record
+// lives in, e.g. "feeding_records".
+type Event struct {
+	Entity string
+	ID     int64
+	Action Action
+}
+
+// Publisher is what repositories publish their writes to.
+type Publisher interface {
+	Publish(e Event)
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before events are dropped.
+const subscriberBuffer = 16
+
+type subscriber struct {
+	entities map[string]bool
+	ch       chan Event
+}
+
+// Bus fans events out to the subscribers of their entity. The zero value is ready to use and a
+// nil *Bus drops everything, so repositories built without one need no checks.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[*subscriber]struct{}
+}
+
+// NewBus returns an empty bus.
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Publish hands the event to every subscriber of its entity without waiting for them.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subs {
+		if !s.entities[e.Entity] {
+			continue
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the events of the given entities until cancel is called, which closes the
+// channel. Subscribing to no entity receives nothing.
+func (b *Bus) Subscribe(entities ...string) (<-chan Event, func()) {
+	s := &subscriber{entities: map[string]bool{}, ch: make(chan Event, subscriberBuffer)}
+	for _, entity := range entities {
+		s.entities[entity] = true
+	}
+	if b == nil {
+		return s.ch, func() {}
+	}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = map[*subscriber]struct{}{}
+	}
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, s)
+			b.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
+
+// Publish publishes the event when p is set. Repositories call it after a write succeeded.
+func Publish(p Publisher, entity string, id int64, action Action) {
+	if p == nil {
+		return
+	}
+	p.Publish(Event{Entity: entity, ID: id, Action: action})
+}
@@ -0,0 +1,57 @@
+package events
+
+import "testing"
+
+func TestBus_DeliversToSubscribersOfTheEntity(t *testing.T) {
+	bus := NewBus()
+	feeding, cancelFeeding := bus.Subscribe("feeding_records", "flocks")
+	defer cancelFeeding()
+	orders, cancelOrders := bus.Subscribe("orders")
+	defer cancelOrders()
+
+	Publish(bus, "feeding_records", 7, Updated)
+
+	select {
+	case e := <-feeding:
+		if e != (Event{Entity: "feeding_records", ID: 7, Action: Updated}) {
+			t.Errorf("event = %+v", e)
+		}
+	default:
+		t.Fatal("feeding subscriber got no event")
+	}
+	select {
+	case e := <-orders:
+		t.Errorf("orders subscriber got %+v", e)
+	default:
+	}
+}
+
+func TestBus_DropsWhenSubscriberFallsBehind(t *testing.T) {
+	bus := NewBus()
+	ch, cancel := bus.Subscribe("flocks")
+	for i := 0; i < subscriberBuffer*2; i++ {
+		bus.Publish(Event{Entity: "flocks", ID: int64(i), Action: Created})
+	}
+	if len(ch) != subscriberBuffer {
+		t.Errorf("buffered = %d, want %d", len(ch), subscriberBuffer)
+	}
+
+	cancel()
+	cancel()
+	bus.Publish(Event{Entity: "flocks", ID: 99, Action: Deleted})
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("drained %d events after cancel, want %d", n, subscriberBuffer)
+	}
+}
+
+func TestBus_NilIsSafe(t *testing.T) {
+	var bus *Bus
+	bus.Publish(Event{Entity: "flocks"})
+	Publish(nil, "flocks", 1, Created)
+	_, cancel := bus.Subscribe("flocks")
+	cancel()
+}
@@ -0,0 +1,95 @@
+// Package ical writes iCalendar (RFC 5545) feeds that calendar apps can subscribe to. Event
+// times are written as floating local times: the farm's wall clock, whatever the zone of the
+// device showing them.
+package ical
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// Event is a calendar entry.
+type Event struct {
+	UID         string // stable across feed refreshes so apps update instead of duplicating
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+}
+
+// Calendar is a named list of events.
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// maxLineOctets is the longest content line before it is folded.
+const maxLineOctets = 75
+
+// Encode writes the calendar as text/calendar; stamp is the DTSTAMP of every event.
+func (c *Calendar) Encode(w io.Writer, stamp time.Time) error {
+	var b bytes.Buffer
+	line := func(name, value string) { writeLine(&b, name+":"+value) }
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//farm-manager//roster//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", escape(e.UID))
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART", floating(e.Start))
+		line("DTEND", floating(e.End))
+		line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func floating(t time.Time) string {
+	return t.Format("20060102T150405")
+}
+
+// escape escapes TEXT values.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeLine writes a content line with CRLF, folding it at maxLineOctets without splitting a
+// UTF-8 sequence.
+func writeLine(b *bytes.Buffer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(s[cut]) {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1 // the leading space counts
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(c byte) bool {
+	return c&0xC0 != 0x80
+}
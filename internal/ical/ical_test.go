@@ -0,0 +1,46 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_Encode(t *testing.T) {
+	start := time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)
+	cal := &Calendar{Name: "Roster, Ana", Events: []Event{{
+		UID:         "shift-7@farm",
+		Start:       start,
+		End:         start.Add(3 * time.Hour),
+		Summary:     "Morning feed; barn 2",
+		Description: strings.Repeat("Check water lines ", 6),
+	}}}
+
+	var b bytes.Buffer
+	if err := cal.Encode(&b, time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Roster\\, Ana\r\n",
+		"DTSTAMP:20261018T120000Z\r\n",
+		"DTSTART:20261019T060000\r\n",
+		"DTEND:20261019T090000\r\n",
+		`SUMMARY:Morning feed\; barn 2` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line longer than %d octets: %q", maxLineOctets, line)
+		}
+	}
+	if !strings.Contains(out, "\r\n ") {
+		t.Errorf("long description not folded:\n%s", out)
+	}
+}
@@ -0,0 +1,295 @@
+// Package pdf writes simple A4 text-and-table PDF documents (recall reports,
+// invoices, run sheets) using the standard Helvetica fonts, so no font files
+// or third-party libraries are needed.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	pageWidth    = 595.28
+	pageHeight   = 841.89
+	margin       = 50.0
+	contentWidth = pageWidth - 2*margin
+	footerY      = 30.0
+	cellPadding  = 3.0
+)
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// Column describes one table column. Width is a fraction of the content width.
+type Column struct {
+	Header     string
+	Width      float64
+	AlignRight bool
+}
+
+// Document accumulates pages of content; call Bytes or WriteTo when done.
+type Document struct {
+	title string
+	pages []*bytes.Buffer
+	y     float64
+}
+
+// New starts a document whose title is stored in the metadata and page footers.
+func New(title string) *Document {
+	d := &Document{title: title}
+	d.newPage()
+	return d
+}
+
+// Heading writes a large bold line.
+func (d *Document) Heading(text string) {
+	d.line(text, fontBold, 16, 0)
+	d.Gap(4)
+}
+
+// Subheading writes a bold section title.
+func (d *Document) Subheading(text string) {
+	d.Gap(6)
+	d.line(text, fontBold, 12, 0)
+	d.Gap(2)
+}
+
+// Text writes a paragraph, wrapping it to the content width.
+func (d *Document) Text(text string) {
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, l := range wrap(paragraph, fontRegular, 10, contentWidth) {
+			d.line(l, fontRegular, 10, 0)
+		}
+	}
+}
+
+// Gap adds vertical space.
+func (d *Document) Gap(points float64) {
+	d.y -= points
+}
+
+// Table writes rows under a bold header, breaking pages and repeating the header as needed.
+// Cells that do not fit their column are truncated.
+func (d *Document) Table(columns []Column, rows [][]string) {
+	const size, rowHeight = 9.0, 14.0
+	header := func() {
+		d.ensure(2 * rowHeight)
+		d.row(columns, headerCells(columns), fontBold, size)
+		d.rule()
+	}
+	header()
+	for _, cells := range rows {
+		if d.y-rowHeight < margin {
+			d.newPage()
+			header()
+		}
+		d.row(columns, cells, fontRegular, size)
+	}
+	d.Gap(4)
+}
+
+// Bytes renders the document.
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	_, _ = d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo renders the document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed; each page then takes a page object and a content stream.
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj(fmt.Sprintf("<< /Title (%s) /Producer (farm-manager) >>", escape(d.title)))
+	for i, page := range d.pages {
+		stream := page.String() + footer(d.title, i+1, len(d.pages))
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, 7+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(out.Bytes())
+	return int64(n), err
+}
+
+func (d *Document) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+func (d *Document) current() *bytes.Buffer {
+	return d.pages[len(d.pages)-1]
+}
+
+// ensure starts a new page when less than height points remain.
+func (d *Document) ensure(height float64) {
+	if d.y-height < margin {
+		d.newPage()
+	}
+}
+
+func (d *Document) line(text, font string, size, x float64) {
+	leading := size * 1.4
+	d.ensure(leading)
+	d.y -= leading
+	writeText(d.current(), text, font, size, margin+x, d.y)
+}
+
+func (d *Document) row(columns []Column, cells []string, font string, size float64) {
+	d.y -= size * 1.55
+	x := margin
+	for i, col := range columns {
+		width := col.Width * contentWidth
+		cell := ""
+		if i < len(cells) {
+			cell = truncate(cells[i], font, size, width-2*cellPadding)
+		}
+		tx := x + cellPadding
+		if col.AlignRight {
+			tx = x + width - cellPadding - textWidth(cell, font, size)
+		}
+		writeText(d.current(), cell, font, size, tx, d.y)
+		x += width
+	}
+}
+
+func (d *Document) rule() {
+	d.y -= 3
+	fmt.Fprintf(d.current(), "0.6 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", margin, d.y, pageWidth-margin, d.y)
+}
+
+func headerCells(columns []Column) []string {
+	cells := make([]string, len(columns))
+	for i, col := range columns {
+		cells[i] = col.Header
+	}
+	return cells
+}
+
+func footer(title string, page, pages int) string {
+	var buf bytes.Buffer
+	writeText(&buf, title, fontRegular, 8, margin, footerY)
+	label := fmt.Sprintf("Page %d of %d", page, pages)
+	writeText(&buf, label, fontRegular, 8, pageWidth-margin-textWidth(label, fontRegular, 8), footerY)
+	return buf.String()
+}
+
+func writeText(buf *bytes.Buffer, text, font string, size, x, y float64) {
+	if text == "" {
+		return
+	}
+	fmt.Fprintf(buf, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(text))
+}
+
+// wrap splits text into lines no wider than width.
+func wrap(text, font string, size, width float64) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	current := words[0]
+	for _, word := range words[1:] {
+		if textWidth(current+" "+word, font, size) > width {
+			lines = append(lines, current)
+			current = word
+			continue
+		}
+		current += " " + word
+	}
+	return append(lines, current)
+}
+
+func truncate(text, font string, size, width float64) string {
+	if textWidth(text, font, size) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && textWidth(string(runes)+"...", font, size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// textWidth approximates the rendered width using the Helvetica metrics.
+func textWidth(text, font string, size float64) float64 {
+	units := 0
+	for _, r := range text {
+		if r >= 32 && r < 127 {
+			units += helveticaWidths[r-32]
+		} else {
+			units += 556
+		}
+	}
+	w := float64(units) * size / 1000
+	if font == fontBold {
+		w *= 1.07
+	}
+	return w
+}
+
+// escape encodes text as a WinAnsi PDF string literal body.
+func escape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			if c, ok := winAnsiExtras[r]; ok {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte('?')
+			}
+		}
+	}
+	return b.String()
+}
+
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// helveticaWidths holds the Helvetica advance widths for ASCII 32-126.
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
@@ -0,0 +1,43 @@
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	doc := New("Recall report (batch 7)")
+	doc.Heading("Recall report")
+	doc.Text("Barn North – organic feed only")
+	rows := make([][]string, 150)
+	for i := range rows {
+		rows[i] = []string{"Customer " + strconv.Itoa(i), strings.Repeat("very long description ", 10), "12.50"}
+	}
+	doc.Table([]Column{
+		{Header: "Customer", Width: 0.3},
+		{Header: "Product", Width: 0.5},
+		{Header: "Qty", Width: 0.2, AlignRight: true},
+	}, rows)
+
+	out := doc.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+	if len(doc.pages) < 2 {
+		t.Fatalf("expected table to break across pages, got %d page(s)", len(doc.pages))
+	}
+	if !bytes.Contains(out, []byte("/Count "+strconv.Itoa(len(doc.pages)))) {
+		t.Fatalf("page tree count does not match %d pages", len(doc.pages))
+	}
+	if !bytes.Contains(out, []byte(`Recall report \(batch 7\)`)) {
+		t.Fatalf("title parentheses not escaped")
+	}
+	if !bytes.Contains(out, []byte(`North \226 organic`)) {
+		t.Fatalf("en dash not mapped to WinAnsi")
+	}
+	if !bytes.Contains(out, []byte("...) Tj")) {
+		t.Fatalf("long cell not truncated")
+	}
+}
@@ -0,0 +1,117 @@
+// Package routing orders the stops of a delivery run. Distances come from a pluggable
+// Provider; the default StraightLine provider needs no network and uses the great-circle
+// distance between stored coordinates.
+package routing
+
+import (
+	"context"
+	"math"
+)
+
+// Point is a location in decimal degrees.
+type Point struct {
+	Lat float64
+	Lng float64
+}
+
+// Provider returns the travel distance in km between two points. Implementations backed by a
+// road-routing service can be plugged in where the straight line is too rough.
+type Provider interface {
+	Distance(ctx context.Context, from, to Point) (float64, error)
+}
+
+// earthRadiusKm is the mean Earth radius used by the haversine formula.
+const earthRadiusKm = 6371.0
+
+// StraightLine is the default Provider: the haversine (great-circle) distance, which
+// underestimates road distance but ranks stops well enough for a farm's delivery area.
+type StraightLine struct{}
+
+func (StraightLine) Distance(_ context.Context, from, to Point) (float64, error) {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(to.Lat - from.Lat)
+	dLng := rad(to.Lng - from.Lng)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(from.Lat))*math.Cos(rad(to.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a)), nil
+}
+
+// Stop is a place to visit. Point is nil when the location is unknown.
+type Stop struct {
+	ID    int64
+	Point *Point
+}
+
+// Leg is a stop in visiting order with the distance from the previous stop (or the depot).
+// DistanceKm is nil when either end has no location.
+type Leg struct {
+	ID         int64
+	DistanceKm *float64
+}
+
+// Route is the planned visiting order. TotalKm includes the drive back to the depot when the
+// depot is known.
+type Route struct {
+	Legs    []Leg
+	TotalKm float64
+}
+
+// Plan orders the stops by repeatedly driving to the nearest unvisited stop, starting from the
+// depot (or from the first located stop when the depot is unknown). Stops without a location
+// cannot be placed and keep their relative order at the end of the route.
+func Plan(ctx context.Context, provider Provider, depot *Point, stops []Stop) (Route, error) {
+	var route Route
+	var located, unlocated []Stop
+	for _, stop := range stops {
+		if stop.Point != nil {
+			located = append(located, stop)
+		} else {
+			unlocated = append(unlocated, stop)
+		}
+	}
+
+	current := depot
+	for len(located) > 0 {
+		next, nextKm := 0, math.Inf(1)
+		if current != nil {
+			for i, stop := range located {
+				km, err := provider.Distance(ctx, *current, *stop.Point)
+				if err != nil {
+					return Route{}, err
+				}
+				if km < nextKm {
+					next, nextKm = i, km
+				}
+			}
+		}
+
+		stop := located[next]
+		leg := Leg{ID: stop.ID}
+		if current != nil {
+			km := roundKm(nextKm)
+			leg.DistanceKm = &km
+			route.TotalKm += nextKm
+		}
+		route.Legs = append(route.Legs, leg)
+		current = stop.Point
+		located = append(located[:next], located[next+1:]...)
+	}
+
+	if depot != nil && current != nil && current != depot {
+		km, err := provider.Distance(ctx, *current, *depot)
+		if err != nil {
+			return Route{}, err
+		}
+		route.TotalKm += km
+	}
+	route.TotalKm = roundKm(route.TotalKm)
+
+	for _, stop := range unlocated {
+		route.Legs = append(route.Legs, Leg{ID: stop.ID})
+	}
+	return route, nil
+}
+
+// roundKm rounds distances to 100 m.
+func roundKm(km float64) float64 {
+	return math.Round(km*10) / 10
+}
@@ -0,0 +1,44 @@
+package routing
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestStraightLine_Distance(t *testing.T) {
+	// One degree of latitude is about 111.2 km everywhere.
+	km, err := StraightLine{}.Distance(context.Background(), Point{Lat: 45, Lng: 10}, Point{Lat: 46, Lng: 10})
+	if err != nil {
+		t.Fatalf("distance: %v", err)
+	}
+	if math.Abs(km-111.2) > 0.1 {
+		t.Fatalf("distance = %.2f km, want about 111.2", km)
+	}
+}
+
+func TestPlan_NearestNeighbour(t *testing.T) {
+	depot := &Point{Lat: 45, Lng: 10}
+	far := &Point{Lat: 45.2, Lng: 10}
+	near := &Point{Lat: 45.1, Lng: 10}
+	stops := []Stop{{ID: 1, Point: far}, {ID: 2}, {ID: 3, Point: near}}
+
+	route, err := Plan(context.Background(), StraightLine{}, depot, stops)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	var ids []int64
+	for _, leg := range route.Legs {
+		ids = append(ids, leg.ID)
+	}
+	if len(ids) != 3 || ids[0] != 3 || ids[1] != 1 || ids[2] != 2 {
+		t.Fatalf("visiting order = %v, want [3 1 2]", ids)
+	}
+	if route.Legs[2].DistanceKm != nil {
+		t.Fatal("expected no distance for the stop without a location")
+	}
+	// Out 22.2 km and back again.
+	if math.Abs(route.TotalKm-44.5) > 0.1 {
+		t.Fatalf("total = %.1f km, want about 44.5", route.TotalKm)
+	}
+}
@@ -0,0 +1,295 @@
+// Package sheet reads a spreadsheet, CSV or the first worksheet of an XLSX workbook, into rows of
+// text for the imports. The first non-empty row is the header. Values are taken as written: XLSX
+// dates arrive as Excel serial day numbers, since telling a date from a number needs the styles.
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MaxRows is the most data rows a sheet may have.
+const MaxRows = 10000
+
+var (
+	// ErrFormat is returned for files that are neither CSV nor XLSX.
+	ErrFormat = errors.New("upload a .csv or .xlsx file")
+	// ErrEmpty is returned for files without a header row.
+	ErrEmpty = errors.New("the file has no rows")
+	// ErrTooLarge is returned for sheets with more than MaxRows rows.
+	ErrTooLarge = fmt.Errorf("the file has more than %d rows; split it up", MaxRows)
+)
+
+// Sheet is the header and the data rows of a spreadsheet. Empty rows are left out.
+type Sheet struct {
+	Header []string
+	Rows   []Row
+}
+
+// Row is a data row with the line or row number it has in the file, for error messages.
+type Row struct {
+	Line  int
+	Cells []string
+}
+
+// Cell returns the value of column i, empty when the row is shorter.
+func (r Row) Cell(i int) string {
+	if i < 0 || i >= len(r.Cells) {
+		return ""
+	}
+	return r.Cells[i]
+}
+
+// Read reads a CSV or XLSX file, telling them apart by the file name's extension.
+func Read(filename string, data []byte) (*Sheet, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".txt":
+		return readCSV(data)
+	case ".xlsx":
+		return readXLSX(data)
+	}
+	return nil, ErrFormat
+}
+
+// build turns numbered rows into a sheet, trimming values and dropping empty rows.
+func build(lines []int, rows [][]string) (*Sheet, error) {
+	s := &Sheet{}
+	for i, cells := range rows {
+		empty := true
+		for j := range cells {
+			cells[j] = strings.TrimSpace(cells[j])
+			if cells[j] != "" {
+				empty = false
+			}
+		}
+		if empty {
+			continue
+		}
+		if s.Header == nil {
+			s.Header = cells
+			continue
+		}
+		if len(s.Rows) == MaxRows {
+			return nil, ErrTooLarge
+		}
+		s.Rows = append(s.Rows, Row{Line: lines[i], Cells: cells})
+	}
+	if s.Header == nil {
+		return nil, ErrEmpty
+	}
+	return s, nil
+}
+
+// readCSV reads comma, semicolon or tab separated values, whichever the first line uses most.
+// Spreadsheet apps in much of Europe save CSV with semicolons.
+func readCSV(data []byte) (*Sheet, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	first, _, _ := bytes.Cut(data, []byte("\n"))
+	comma := ','
+	for _, sep := range []rune{';', '\t'} {
+		if bytes.Count(first, []byte(string(sep))) > bytes.Count(first, []byte(string(comma))) {
+			comma = sep
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	var (
+		lines []int
+		rows  [][]string
+	)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read CSV: %w", err)
+		}
+		line, _ := r.FieldPos(0)
+		lines = append(lines, line)
+		rows = append(rows, record)
+	}
+	return build(lines, rows)
+}
+
+// readXLSX reads the first worksheet of a workbook.
+func readXLSX(data []byte) (*Sheet, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, ErrFormat
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	sheetPath, err := firstSheetPath(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []richText `xml:"si"`
+		}
+		if err := decodeXML(f, &sst); err != nil {
+			return nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	f, ok := files[sheetPath]
+	if !ok {
+		return nil, fmt.Errorf("read XLSX: missing %s", sheetPath)
+	}
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string    `xml:"r,attr"`
+				T      string    `xml:"t,attr"`
+				V      string    `xml:"v"`
+				Inline *richText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decodeXML(f, &ws); err != nil {
+		return nil, err
+	}
+
+	var (
+		lines []int
+		rows  [][]string
+	)
+	for i, row := range ws.Rows {
+		line := row.R
+		if line == 0 {
+			line = i + 1
+		}
+		var cells []string
+		for j, c := range row.Cells {
+			col := j
+			if c.R != "" {
+				col = columnIndex(c.R)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			switch c.T {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("read XLSX: bad shared string in %s", c.R)
+				}
+				cells[col] = shared[n]
+			case "inlineStr":
+				if c.Inline != nil {
+					cells[col] = c.Inline.String()
+				}
+			case "b":
+				cells[col] = "FALSE"
+				if c.V == "1" {
+					cells[col] = "TRUE"
+				}
+			default:
+				cells[col] = c.V
+			}
+		}
+		lines = append(lines, line)
+		rows = append(rows, cells)
+	}
+	return build(lines, rows)
+}
+
+// richText is a string item made of plain text or formatted runs.
+type richText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t richText) String() string {
+	s := t.T
+	for _, r := range t.Runs {
+		s += r.T
+	}
+	return s
+}
+
+// firstSheetPath finds the part holding the workbook's first worksheet.
+func firstSheetPath(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+	wb, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", ErrFormat
+	}
+	var workbook struct {
+		Sheets []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeXML(wb, &workbook); err != nil {
+		return "", err
+	}
+	rels, ok := files["xl/_rels/workbook.xml.rels"]
+	if !ok || len(workbook.Sheets) == 0 {
+		return fallback, nil
+	}
+	var relationships struct {
+		Items []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeXML(rels, &relationships); err != nil {
+		return "", err
+	}
+	for _, rel := range relationships.Items {
+		if rel.ID == workbook.Sheets[0].RelID {
+			if strings.HasPrefix(rel.Target, "/") {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+			return path.Join("xl", rel.Target), nil
+		}
+	}
+	return fallback, nil
+}
+
+func decodeXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("read XLSX %s: %w", f.Name, err)
+	}
+	return nil
+}
+
+// columnIndex returns the zero-based column of a cell reference such as "AB12".
+func columnIndex(ref string) int {
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
@@ -0,0 +1,87 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRead_CSV(t *testing.T) {
+	data := []byte("\xef\xbb\xbfFlock;Date;Kg\n\nBronze;2024-03-01;\"12,5\"\n;;\nBronze;2024-03-02;13\n")
+	s, err := Read("feed.CSV", data)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if want := []string{"Flock", "Date", "Kg"}; !reflect.DeepEqual(s.Header, want) {
+		t.Errorf("header = %q, want %q", s.Header, want)
+	}
+	want := []Row{
+		{Line: 3, Cells: []string{"Bronze", "2024-03-01", "12,5"}},
+		{Line: 5, Cells: []string{"Bronze", "2024-03-02", "13"}},
+	}
+	if !reflect.DeepEqual(s.Rows, want) {
+		t.Errorf("rows = %+v, want %+v", s.Rows, want)
+	}
+
+	if _, err := Read("feed.ods", data); !errors.Is(err, ErrFormat) {
+		t.Errorf("ods: err = %v, want ErrFormat", err)
+	}
+	if _, err := Read("empty.csv", []byte("\n ,\n")); !errors.Is(err, ErrEmpty) {
+		t.Errorf("empty: err = %v, want ErrEmpty", err)
+	}
+}
+
+func TestRead_XLSX(t *testing.T) {
+	parts := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+			<sheets><sheet name="Deaths" sheetId="1" r:id="rId3"/><sheet name="Other" sheetId="2" r:id="rId4"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+			<Relationship Id="rId4" Target="worksheets/sheet1.xml"/><Relationship Id="rId3" Target="worksheets/sheet2.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+			<si><t>Flock</t></si><si><t>Date</t></si><si><r><t>Dead</t></r><r><t> birds</t></r></si><si><t>Bronze</t></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row r="1"><c r="A1"><v>9</v></c></row></sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+			<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="D2" t="s"><v>2</v></c></row>
+			<row r="3"><c r="A3" t="s"><v>3</v></c><c r="B3" s="1"><v>45352</v></c><c r="D3"><f>1+2</f><v>3</v></c></row>
+			<row r="5"><c r="A5" t="inlineStr"><is><t>White</t></is></c><c r="C5" t="b"><v>1</v></c></row>
+		</sheetData></worksheet>`,
+	}
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for name, body := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Read("history.xlsx", b.Bytes())
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if want := []string{"Flock", "Date", "", "Dead birds"}; !reflect.DeepEqual(s.Header, want) {
+		t.Errorf("header = %q, want %q", s.Header, want)
+	}
+	want := []Row{
+		{Line: 3, Cells: []string{"Bronze", "45352", "", "3"}},
+		{Line: 5, Cells: []string{"White", "", "TRUE"}},
+	}
+	if !reflect.DeepEqual(s.Rows, want) {
+		t.Errorf("rows = %+v, want %+v", s.Rows, want)
+	}
+	if got := s.Rows[1].Cell(3); got != "" {
+		t.Errorf("cell past the row = %q, want empty", got)
+	}
+
+	if _, err := Read("broken.xlsx", []byte("not a zip")); !errors.Is(err, ErrFormat) {
+		t.Errorf("not a zip: err = %v, want ErrFormat", err)
+	}
+}
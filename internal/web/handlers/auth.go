@@ -17,12 +17,13 @@ import (
 )
 
 type Auth struct {
-	Repo data.UserRepo
+	Repo  data.UserRepo
+	Farms data.FarmRepo
 }
 
 // RegisterAuthRoutes wires auth endpoints under /app.
-func RegisterAuthRoutes(group *ghttp.RouterGroup, repo data.UserRepo) {
-	h := &Auth{Repo: repo}
+func RegisterAuthRoutes(group *ghttp.RouterGroup, repo data.UserRepo, farms data.FarmRepo) {
+	h := &Auth{Repo: repo, Farms: farms}
 	group.GET("/login", h.LoginGet)
 	group.POST("/login", h.LoginPost)
 	group.POST("/logout", h.LogoutPost)
@@ -124,6 +125,7 @@ func (h *Auth) LogoutPost(r *ghttp.Request) {
 
 // ensureSeedAdmin creates a default admin user if users table is empty.
 // Default username: admin; password must be provided via ADMIN_PASSWORD (no default).
+// The admin owns the home farm, so they can add further farms and members.
 func (h *Auth) ensureSeedAdmin(r *ghttp.Request) error {
 	n, err := h.Repo.Count(r.GetCtx())
 	if err != nil {
@@ -147,13 +149,14 @@ func (h *Auth) ensureSeedAdmin(r *ghttp.Request) error {
 		PasswordHash:        string(hash),
 		ForcePasswordChange: false, // optional flow not implemented here
 	}
-	_, err = h.Repo.Create(r.GetCtx(), u)
+	id, err := h.Repo.Create(r.GetCtx(), u)
 	if err != nil {
 		// Ignore unique errors if seeded concurrently.
 		if err == sql.ErrNoRows {
 			return nil
 		}
 		g.Log().Noticef(r.GetCtx(), "admin seed may already exist: %v", err)
+		return nil
 	}
-	return nil
+	return h.Farms.SetMember(r.GetCtx(), data.DefaultFarmID, id, domain.FarmRoleOwner)
 }
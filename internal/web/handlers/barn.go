@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -16,16 +20,19 @@ import (
 
 type BarnManager struct {
 	BarnRepo data.BarnRepo
+	Events   *events.Bus
 }
 
 // RegisterBarnRoutes wires barn management endpoints under /app.
-func RegisterBarnRoutes(group *ghttp.RouterGroup, barnRepo data.BarnRepo) {
+func RegisterBarnRoutes(group *ghttp.RouterGroup, barnRepo data.BarnRepo, bus *events.Bus) {
 	bm := &BarnManager{
 		BarnRepo: barnRepo,
+		Events:   bus,
 	}
 
 	// Barn management
 	group.GET("/management/barns", bm.BarnsGet)
+	group.GET("/management/barns/stream", bm.BarnsStream)
 	group.POST("/management/barns", bm.BarnPost)
 	group.GET("/management/barns/new", bm.BarnGet)
 	group.GET("/management/barns/:id", bm.BarnGet)
@@ -74,6 +81,18 @@ func (bm *BarnManager) BarnsGet(r *ghttp.Request) {
 	)
 }
 
+// BarnsStream keeps the barn list up to date over server-sent events.
+func (bm *BarnManager) BarnsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, bm.Events, func(ctx context.Context) (templ.Component, error) {
+		barns, err := bm.BarnRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.BarnsList(basePath, csrf, barns), nil
+	}, "barns")
+}
+
 // BarnPost creates a new barn.
 func (bm *BarnManager) BarnPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -87,6 +106,7 @@ func (bm *BarnManager) BarnPost(r *ghttp.Request) {
 	environmentControl := strings.TrimSpace(r.Get("environment_control").String())
 	maintenanceSchedule := strings.TrimSpace(r.Get("maintenance_schedule").String())
 	location := strings.TrimSpace(r.Get("location").String())
+	areaStr := strings.TrimSpace(r.Get("area_m2").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -103,6 +123,16 @@ func (bm *BarnManager) BarnPost(r *ghttp.Request) {
 		}
 	}
 
+	var area *float64
+	if areaStr != "" {
+		if areaVal, err := strconv.ParseFloat(areaStr, 64); err == nil && areaVal > 0 {
+			area = new(float64)
+			*area = areaVal
+		} else {
+			errs["area_m2"] = "Area must be a positive number"
+		}
+	}
+
 	var envControl *string
 	if environmentControl != "" {
 		envControl = new(string)
@@ -135,6 +165,7 @@ func (bm *BarnManager) BarnPost(r *ghttp.Request) {
 			EnvironmentControl:  envControl,
 			MaintenanceSchedule: maintSchedule,
 			Location:            loc,
+			AreaM2:              area,
 			Audit: domain.AuditFields{
 				CreatedBy: createdBy,
 				UpdatedBy: updatedBy,
@@ -255,6 +286,7 @@ func (bm *BarnManager) BarnPut(r *ghttp.Request) {
 	environmentControl := strings.TrimSpace(r.Get("environment_control").String())
 	maintenanceSchedule := strings.TrimSpace(r.Get("maintenance_schedule").String())
 	location := strings.TrimSpace(r.Get("location").String())
+	areaStr := strings.TrimSpace(r.Get("area_m2").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -271,6 +303,16 @@ func (bm *BarnManager) BarnPut(r *ghttp.Request) {
 		}
 	}
 
+	var area *float64
+	if areaStr != "" {
+		if areaVal, err := strconv.ParseFloat(areaStr, 64); err == nil && areaVal > 0 {
+			area = new(float64)
+			*area = areaVal
+		} else {
+			errs["area_m2"] = "Area must be a positive number"
+		}
+	}
+
 	var envControl *string
 	if environmentControl != "" {
 		envControl = new(string)
@@ -302,12 +344,21 @@ func (bm *BarnManager) BarnPut(r *ghttp.Request) {
 			EnvironmentControl:  envControl,
 			MaintenanceSchedule: maintSchedule,
 			Location:            loc,
+			AreaM2:              area,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := bm.BarnRepo.Update(r.GetCtx(), barn)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := bm.BarnRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/barns/%d", middleware.BasePath(), id)
+				writeConflict(r, "Barn", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update barn: %v", err)
 			errs["form"] = "Failed to update barn"
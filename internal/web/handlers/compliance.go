@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type ComplianceManager struct {
+	ComplianceRepo          data.ComplianceRepo
+	OutdoorAccessRecordRepo data.OutdoorAccessRecordRepo
+	FlockRepo               data.FlockRepo
+	BarnRepo                data.BarnRepo
+	FeedTypeRepo            data.FeedTypeRepo
+}
+
+// RegisterComplianceRoutes wires organic compliance endpoints under /app.
+func RegisterComplianceRoutes(group *ghttp.RouterGroup, complianceRepo data.ComplianceRepo, outdoorAccessRecordRepo data.OutdoorAccessRecordRepo, flockRepo data.FlockRepo, barnRepo data.BarnRepo, feedTypeRepo data.FeedTypeRepo) {
+	cm := &ComplianceManager{
+		ComplianceRepo:          complianceRepo,
+		OutdoorAccessRecordRepo: outdoorAccessRecordRepo,
+		FlockRepo:               flockRepo,
+		BarnRepo:                barnRepo,
+		FeedTypeRepo:            feedTypeRepo,
+	}
+
+	// Organic compliance
+	group.GET("/management/compliance", cm.ComplianceGet)
+	group.GET("/management/compliance/dossier", cm.DossierGet)
+	group.PUT("/management/compliance/rules/:id", cm.RulePut)
+	group.GET("/management/compliance/flocks/:id", cm.FlockReportGet)
+	group.POST("/management/compliance/flocks/:id/outdoor-access", cm.OutdoorAccessPost)
+	group.DELETE("/management/compliance/outdoor-access/:id", cm.OutdoorAccessDelete)
+}
+
+// FlockReports evaluates the configured rules for every flock.
+func FlockReports(ctx context.Context, complianceRepo data.ComplianceRepo, flockRepo data.FlockRepo) ([]*domain.FlockComplianceReport, []*domain.ComplianceRule, error) {
+	rules, err := complianceRepo.ListRules(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list compliance rules: %w", err)
+	}
+	flocks, err := flockRepo.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list flocks: %w", err)
+	}
+
+	reports := make([]*domain.FlockComplianceReport, 0, len(flocks))
+	for _, flock := range flocks {
+		facts, err := complianceRepo.FlockFacts(ctx, flock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("flock %d facts: %w", flock.FlockID, err)
+		}
+		reports = append(reports, domain.EvaluateFlockCompliance(rules, facts))
+	}
+	return reports, rules, nil
+}
+
+// ComplianceGet renders the compliance overview with per-flock status and rule configuration.
+func (cm *ComplianceManager) ComplianceGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	reports, rules, err := FlockReports(r.GetCtx(), cm.ComplianceRepo, cm.FlockRepo)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "compliance reports: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.ComplianceContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				reports,
+				rules,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.CompliancePage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			reports,
+			rules,
+		),
+	)
+}
+
+// RulePut updates the threshold and enabled flag of a compliance rule.
+func (cm *ComplianceManager) RulePut(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid rule ID")
+		return
+	}
+
+	thresholdStr := strings.TrimSpace(r.Get("threshold").String())
+	notes := strings.TrimSpace(r.Get("notes").String())
+
+	errs := map[string]string{}
+	var threshold *float64
+	if thresholdStr != "" {
+		if val, err := strconv.ParseFloat(thresholdStr, 64); err == nil && val >= 0 {
+			threshold = &val
+		} else {
+			errs["threshold"] = "Threshold must be a non-negative number"
+		}
+	}
+
+	var notesPtr *string
+	if notes != "" {
+		notesPtr = &notes
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		rule := &domain.ComplianceRule{
+			ComplianceRuleID: id,
+			Threshold:        threshold,
+			Enabled:          r.Get("enabled").Bool(),
+			Notes:            notesPtr,
+			Audit: domain.AuditFields{
+				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
+			},
+		}
+		switch err := cm.ComplianceRepo.UpdateRule(r.GetCtx(), rule); {
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "update compliance rule: %v", err)
+			errs["form"] = "Failed to update rule"
+		}
+	}
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(middleware.BasePath() + "/management/compliance")
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/compliance")
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + "/management/compliance")
+}
+
+// FlockReportGet renders the compliance report and outdoor access log of one flock.
+func (cm *ComplianceManager) FlockReportGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid flock ID")
+		return
+	}
+
+	flock, err := cm.FlockRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Flock not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find flock: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	rules, err := cm.ComplianceRepo.ListRules(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list compliance rules: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	facts, err := cm.ComplianceRepo.FlockFacts(r.GetCtx(), flock)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "flock compliance facts: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	records, err := cm.OutdoorAccessRecordRepo.ListByFlock(r.GetCtx(), id)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list outdoor access records: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	report := domain.EvaluateFlockCompliance(rules, facts)
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.ComplianceFlockContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				report,
+				records,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ComplianceFlockPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			report,
+			records,
+		),
+	)
+}
+
+// OutdoorAccessPost logs a day of outdoor access for a flock.
+func (cm *ComplianceManager) OutdoorAccessPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	flockID, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid flock ID")
+		return
+	}
+
+	dateStr := strings.TrimSpace(r.Get("date").String())
+	hoursStr := strings.TrimSpace(r.Get("hours").String())
+	notes := strings.TrimSpace(r.Get("notes").String())
+
+	errs := map[string]string{}
+	var date time.Time
+	if dateStr == "" {
+		errs["date"] = "Date is required"
+	} else if parsedDate, err := time.Parse("2006-01-02", dateStr); err == nil {
+		date = parsedDate
+	} else {
+		errs["date"] = "Date must be in YYYY-MM-DD format"
+	}
+
+	var hours *float64
+	if hoursStr != "" {
+		if val, err := strconv.ParseFloat(hoursStr, 64); err == nil && val >= 0 && val <= 24 {
+			hours = &val
+		} else {
+			errs["hours"] = "Hours must be between 0 and 24"
+		}
+	}
+
+	var notesPtr *string
+	if notes != "" {
+		notesPtr = &notes
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		record := &domain.OutdoorAccessRecord{
+			FlockID: flockID,
+			Date:    date,
+			Hours:   hours,
+			Notes:   notesPtr,
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := cm.OutdoorAccessRecordRepo.Create(r.GetCtx(), record); err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Flock not found")
+			return
+		} else if err != nil {
+			g.Log().Errorf(r.GetCtx(), "create outdoor access record: %v", err)
+			errs["form"] = "Failed to log outdoor access"
+		}
+	}
+
+	redirectURL := fmt.Sprintf("%s/management/compliance/flocks/%d", middleware.BasePath(), flockID)
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(redirectURL)
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", redirectURL)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(redirectURL)
+}
+
+// OutdoorAccessDelete soft deletes an outdoor access record.
+func (cm *ComplianceManager) OutdoorAccessDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid outdoor access record ID")
+		return
+	}
+
+	if err := cm.OutdoorAccessRecordRepo.SoftDelete(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete outdoor access record: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	redirectURL := middleware.BasePath() + "/management/compliance"
+	if flockID := r.Get("flock_id").Int64(); flockID > 0 {
+		redirectURL = fmt.Sprintf("%s/management/compliance/flocks/%d", middleware.BasePath(), flockID)
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", redirectURL)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(redirectURL)
+}
+
+// DossierGet renders the printable farm-wide certification dossier for the annual inspection.
+func (cm *ComplianceManager) DossierGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	reports, rules, err := FlockReports(r.GetCtx(), cm.ComplianceRepo, cm.FlockRepo)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "compliance reports: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	barns, err := cm.BarnRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list barns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	feedTypes, err := cm.FeedTypeRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list feed types: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ComplianceDossierPage(
+			models.FarmProfileFromEnv(),
+			time.Now(),
+			rules,
+			reports,
+			barns,
+			feedTypes,
+		),
+	)
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/util/gconv"
+)
+
+// conflictSkipFields are the form fields that belong to the request rather than the record.
+var conflictSkipFields = map[string]bool{"csrf_token": true, "_method": true, "version": true}
+
+// staleFormMessage answers an update refused with data.ErrConflict on the pages that are not
+// resolved field by field: status buttons, toggles and small settings forms.
+const staleFormMessage = "Someone else changed this since the page was loaded. Reload it and try again."
+
+// writeConflict answers an update refused with data.ErrConflict. It shows the submitted form
+// next to current, the record as saved by someone else, and lets the user send it again
+// against current's version, keeping their values, the stored ones or a mix of both.
+func writeConflict(r *ghttp.Request, title, action, recordURL string, current any) {
+	stored, version := recordFormValues(current)
+	view := pages.ConflictView{
+		Title:     title,
+		Action:    action,
+		RecordURL: recordURL,
+		Version:   version,
+	}
+
+	submitted := r.GetFormMap()
+	names := make([]string, 0, len(submitted))
+	for name := range submitted {
+		if !conflictSkipFields[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		yours := strings.TrimSpace(gconv.String(submitted[name]))
+		field := pages.ConflictField{Name: name, Label: conflictLabel(name), Yours: yours}
+		if value, ok := stored[name]; ok {
+			field.Current = value
+			field.Changed = !sameFormValue(yours, value)
+		}
+		view.Fields = append(view.Fields, field)
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.ConflictContent(middleware.CsrfToken(r), view))
+		return
+	}
+	var username string
+	theme := ""
+	if user, ok := middleware.CurrentUser(r); ok {
+		username = user.Username
+		theme = ThemeToString(user.Theme)
+	}
+	r.Response.WriteHeader(http.StatusConflict)
+	_ = middleware.TemplRender(r, pages.ConflictPage(middleware.BasePath(), middleware.CsrfToken(r), username, theme, view))
+}
+
+// recordFormValues flattens a domain record into the values its edit form would hold, keyed by
+// the snake_case name of each field, and returns its version. Related records, lists of them
+// and the audit fields are left out.
+func recordFormValues(record any) (map[string]string, int64) {
+	values := map[string]string{}
+	v := reflect.Indirect(reflect.ValueOf(record))
+	if v.Kind() != reflect.Struct {
+		return values, 0
+	}
+	var version int64
+	if audit := v.FieldByName("Audit"); audit.IsValid() {
+		if field := audit.FieldByName("Version"); field.IsValid() && field.Kind() == reflect.Int64 {
+			version = field.Int()
+		}
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		if value, ok := formValue(v.Field(i)); ok {
+			values[snakeCase(v.Type().Field(i).Name)] = value
+		}
+	}
+	return values, version
+}
+
+// formValue formats a field the way the edit forms fill their inputs. It reports false for
+// fields no form input holds.
+func formValue(v reflect.Value) (string, bool) {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return formTime(value), true
+	case sql.NullTime:
+		if !value.Valid {
+			return "", true
+		}
+		return formTime(value.Time), true
+	case []string:
+		return strings.Join(value, ", "), true
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			if v.Type().Elem().Kind() == reflect.Struct && v.Type().Elem() != reflect.TypeOf(time.Time{}) {
+				return "", false
+			}
+			return "", true
+		}
+		return formValue(v.Elem())
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// formTime formats dates as date inputs and moments with a time of day as datetime-local inputs.
+func formTime(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+	return t.Format("2006-01-02T15:04")
+}
+
+// sameFormValue compares a submitted value with a stored one, treating numbers that only differ
+// in formatting and checked checkboxes as equal.
+func sameFormValue(submitted, stored string) bool {
+	if submitted == stored {
+		return true
+	}
+	if submitted == "on" && stored == "true" {
+		return true
+	}
+	a, errA := strconv.ParseFloat(submitted, 64)
+	b, errB := strconv.ParseFloat(stored, 64)
+	return errA == nil && errB == nil && a == b
+}
+
+// snakeCase turns a Go field name such as VATNumber or AreaM2 into its form name.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, c := range runes {
+		if unicode.IsUpper(c) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// conflictLabel turns a form name into a field label, e.g. number_of_birds into Number of birds.
+func conflictLabel(name string) string {
+	label := strings.ReplaceAll(strings.TrimSuffix(name, "_id"), "_", " ")
+	if label == "" {
+		return name
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -15,22 +19,35 @@ import (
 )
 
 type CustomerManager struct {
-	CustomerRepo data.CustomerRepo
+	CustomerRepo    data.CustomerRepo
+	CustomerCRMRepo data.CustomerCRMRepo
+	Events          *events.Bus
 }
 
 // RegisterCustomerRoutes wires customer management endpoints under /app.
-func RegisterCustomerRoutes(group *ghttp.RouterGroup, customerRepo data.CustomerRepo) {
+func RegisterCustomerRoutes(group *ghttp.RouterGroup, customerRepo data.CustomerRepo, customerCRMRepo data.CustomerCRMRepo, bus *events.Bus) {
 	cm := &CustomerManager{
-		CustomerRepo: customerRepo,
+		CustomerRepo:    customerRepo,
+		CustomerCRMRepo: customerCRMRepo,
+		Events:          bus,
 	}
 
 	// Customer management
 	group.GET("/management/customers", cm.CustomersGet)
+	group.GET("/management/customers/stream", cm.CustomersStream)
 	group.POST("/management/customers", cm.CustomerPost)
 	group.GET("/management/customers/new", cm.CustomerGet)
 	group.GET("/management/customers/:id", cm.CustomerGet)
 	group.PUT("/management/customers/:id", cm.CustomerPut)
 	group.DELETE("/management/customers/:id", cm.CustomerDelete)
+
+	// Contacts, addresses and communication log
+	group.POST("/management/customers/:id/contacts", cm.ContactPost)
+	group.DELETE("/management/customers/:id/contacts/:contact_id", cm.ContactDelete)
+	group.POST("/management/customers/:id/addresses", cm.AddressPost)
+	group.POST("/management/customers/:id/addresses/:address_id/default", cm.AddressDefaultPost)
+	group.DELETE("/management/customers/:id/addresses/:address_id", cm.AddressDelete)
+	group.POST("/management/customers/:id/communications", cm.CommunicationPost)
 }
 
 // CustomersGet renders the customers management page.
@@ -41,12 +58,19 @@ func (cm *CustomerManager) CustomersGet(r *ghttp.Request) {
 		return
 	}
 
-	customers, err := cm.CustomerRepo.List(r.GetCtx())
+	filter := customerFilter(r)
+	customers, err := cm.CustomerRepo.Search(r.GetCtx(), filter)
 	if err != nil {
 		g.Log().Errorf(r.GetCtx(), "list customers: %v", err)
 		r.Response.WriteStatusExit(500, "Internal server error")
 		return
 	}
+	tags, err := cm.CustomerRepo.ListTags(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer tags: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
 
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
@@ -55,6 +79,8 @@ func (cm *CustomerManager) CustomersGet(r *ghttp.Request) {
 			pages.CustomersContent(
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
+				filter,
+				tags,
 				customers,
 			),
 		)
@@ -68,11 +94,37 @@ func (cm *CustomerManager) CustomersGet(r *ghttp.Request) {
 			middleware.CsrfToken(r),
 			user.Username,
 			ThemeToString(user.Theme),
+			filter,
+			tags,
 			customers,
 		),
 	)
 }
 
+// CustomersStream keeps the filtered customer list up to date over server-sent events.
+func (cm *CustomerManager) CustomersStream(r *ghttp.Request) {
+	basePath, csrf, filter := middleware.BasePath(), middleware.CsrfToken(r), customerFilter(r)
+	streamLive(r, cm.Events, func(ctx context.Context) (templ.Component, error) {
+		customers, err := cm.CustomerRepo.Search(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := cm.CustomerRepo.ListTags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.CustomersList(basePath, csrf, filter, tags, customers), nil
+	}, "customers")
+}
+
+// customerFilter reads the tag and type filter of the customer list.
+func customerFilter(r *ghttp.Request) domain.CustomerFilter {
+	return domain.CustomerFilter{
+		Tag:  strings.TrimSpace(r.Get("tag").String()),
+		Type: strings.TrimSpace(r.Get("type").String()),
+	}
+}
+
 // CustomerPost creates a new customer.
 func (cm *CustomerManager) CustomerPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -85,6 +137,8 @@ func (cm *CustomerManager) CustomerPost(r *ghttp.Request) {
 	contactInfo := strings.TrimSpace(r.Get("contact_info").String())
 	deliveryAddress := strings.TrimSpace(r.Get("delivery_address").String())
 	customerType := strings.TrimSpace(r.Get("customer_type").String())
+	vatNumber := strings.TrimSpace(r.Get("vat_number").String())
+	tags := domain.ParseTags(r.Get("tags").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -109,6 +163,14 @@ func (cm *CustomerManager) CustomerPost(r *ghttp.Request) {
 		*custType = customerType
 	}
 
+	var vat *string
+	if vatNumber != "" {
+		vat = new(string)
+		*vat = strings.ToUpper(vatNumber)
+	}
+
+	latitude, longitude := parseCoordinates(r, errs)
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -122,6 +184,10 @@ func (cm *CustomerManager) CustomerPost(r *ghttp.Request) {
 			ContactInfo:     contact,
 			DeliveryAddress: deliveryAddr,
 			CustomerType:    custType,
+			VATNumber:       vat,
+			Tags:            tags,
+			Latitude:        latitude,
+			Longitude:       longitude,
 			Audit: domain.AuditFields{
 				CreatedBy: createdBy,
 				UpdatedBy: updatedBy,
@@ -171,6 +237,7 @@ func (cm *CustomerManager) CustomerGet(r *ghttp.Request) {
 
 	idStr := r.Get("id").String()
 	var customer *domain.Customer
+	var details *domain.CustomerDetails
 
 	// Check if this is a request for a new customer (no ID provided)
 	if idStr == "" || idStr == "new" {
@@ -194,6 +261,12 @@ func (cm *CustomerManager) CustomerGet(r *ghttp.Request) {
 			r.Response.WriteStatusExit(500, "Internal server error")
 			return
 		}
+		details, err = cm.CustomerCRMRepo.Details(r.GetCtx(), id)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "load customer details: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
 	}
 
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
@@ -204,6 +277,7 @@ func (cm *CustomerManager) CustomerGet(r *ghttp.Request) {
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
 				customer,
+				details,
 			),
 		)
 		return
@@ -217,6 +291,7 @@ func (cm *CustomerManager) CustomerGet(r *ghttp.Request) {
 			user.Username,
 			ThemeToString(user.Theme),
 			customer,
+			details,
 		),
 	)
 }
@@ -238,8 +313,9 @@ func (cm *CustomerManager) CustomerPut(r *ghttp.Request) {
 
 	name := strings.TrimSpace(r.Get("name").String())
 	contactInfo := strings.TrimSpace(r.Get("contact_info").String())
-	deliveryAddress := strings.TrimSpace(r.Get("delivery_address").String())
 	customerType := strings.TrimSpace(r.Get("customer_type").String())
+	vatNumber := strings.TrimSpace(r.Get("vat_number").String())
+	tags := domain.ParseTags(r.Get("tags").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -252,18 +328,20 @@ func (cm *CustomerManager) CustomerPut(r *ghttp.Request) {
 		*contact = contactInfo
 	}
 
-	var deliveryAddr *string
-	if deliveryAddress != "" {
-		deliveryAddr = new(string)
-		*deliveryAddr = deliveryAddress
-	}
-
 	var custType *string
 	if customerType != "" {
 		custType = new(string)
 		*custType = customerType
 	}
 
+	var vat *string
+	if vatNumber != "" {
+		vat = new(string)
+		*vat = strings.ToUpper(vatNumber)
+	}
+
+	latitude, longitude := parseCoordinates(r, errs)
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -271,17 +349,28 @@ func (cm *CustomerManager) CustomerPut(r *ghttp.Request) {
 		updatedBy := new(string)
 		*updatedBy = userIDStr
 		customer := &domain.Customer{
-			CustomerID:      id,
-			Name:            name,
-			ContactInfo:     contact,
-			DeliveryAddress: deliveryAddr,
-			CustomerType:    custType,
+			CustomerID:   id,
+			Name:         name,
+			ContactInfo:  contact,
+			CustomerType: custType,
+			VATNumber:    vat,
+			Tags:         tags,
+			Latitude:     latitude,
+			Longitude:    longitude,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := cm.CustomerRepo.Update(r.GetCtx(), customer)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := cm.CustomerRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/customers/%d", middleware.BasePath(), id)
+				writeConflict(r, "Customer", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update customer: %v", err)
 			errs["form"] = "Failed to update customer"
@@ -348,3 +437,26 @@ func (cm *CustomerManager) CustomerDelete(r *ghttp.Request) {
 	// For regular requests, redirect to the list
 	r.Response.RedirectTo(middleware.BasePath() + "/management/customers")
 }
+
+// parseCoordinates reads the optional delivery location. Both coordinates are needed to plan
+// routes, so giving only one of them is an error.
+func parseCoordinates(r *ghttp.Request, errs map[string]string) (latitude, longitude *float64) {
+	latStr := strings.TrimSpace(r.Get("latitude").String())
+	lngStr := strings.TrimSpace(r.Get("longitude").String())
+	if latStr == "" && lngStr == "" {
+		return nil, nil
+	}
+
+	lat, err := strconv.ParseFloat(latStr, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		errs["latitude"] = "Latitude must be a number between -90 and 90"
+	}
+	lng, err := strconv.ParseFloat(lngStr, 64)
+	if err != nil || lng < -180 || lng > 180 {
+		errs["longitude"] = "Longitude must be a number between -180 and 180"
+	}
+	if errs["latitude"] != "" || errs["longitude"] != "" {
+		return nil, nil
+	}
+	return &lat, &lng
+}
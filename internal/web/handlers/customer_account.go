@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type CustomerAccountManager struct {
+	CustomerAccountRepo data.CustomerAccountRepo
+	CustomerRepo        data.CustomerRepo
+}
+
+// RegisterCustomerAccountRoutes wires the staff endpoints granting customers portal access under /app.
+func RegisterCustomerAccountRoutes(group *ghttp.RouterGroup, customerAccountRepo data.CustomerAccountRepo, customerRepo data.CustomerRepo) {
+	cam := &CustomerAccountManager{
+		CustomerAccountRepo: customerAccountRepo,
+		CustomerRepo:        customerRepo,
+	}
+
+	group.GET("/management/customers/:id/portal-access", cam.PortalAccessGet)
+	group.POST("/management/customers/:id/portal-access", cam.PortalAccountPost)
+	group.DELETE("/management/customers/:id/portal-access/:account_id", cam.PortalAccountDelete)
+}
+
+// PortalAccessGet renders the portal accounts of a customer with the form adding one.
+func (cam *CustomerAccountManager) PortalAccessGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	customer, ok := cam.customer(r)
+	if !ok {
+		return
+	}
+	accounts, err := cam.CustomerAccountRepo.ListByCustomer(r.GetCtx(), customer.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer accounts: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.CustomerPortalAccessContent(middleware.BasePath(), middleware.PortalBasePath(), middleware.CsrfToken(r), customer, accounts))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.CustomerPortalAccessPage(
+			middleware.BasePath(),
+			middleware.PortalBasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			customer,
+			accounts,
+		),
+	)
+}
+
+// PortalAccountPost gives someone at the customer a portal account with an initial password.
+func (cam *CustomerAccountManager) PortalAccountPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	customer, ok := cam.customer(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	email := strings.TrimSpace(r.Get("email").String())
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		errs["email"] = "Enter a valid email address"
+	}
+	password := r.Get("password").String()
+	if len(password) < 8 {
+		errs["password"] = "Password must be at least 8 characters"
+	}
+
+	if len(errs) == 0 {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "hash customer password: %v", err)
+			errs["form"] = "Failed to create the account"
+		} else {
+			userIDStr := strconv.FormatInt(user.ID, 10)
+			account := &domain.CustomerAccount{CustomerID: customer.CustomerID, Email: email, PasswordHash: string(hash)}
+			account.Audit.CreatedBy = &userIDStr
+			account.Audit.UpdatedBy = &userIDStr
+			switch _, err := cam.CustomerAccountRepo.Create(r.GetCtx(), account); {
+			case errors.Is(err, domain.ErrEmailTaken):
+				errs["email"] = err.Error()
+			case err != nil:
+				g.Log().Errorf(r.GetCtx(), "create customer account: %v", err)
+				errs["form"] = "Failed to create the account"
+			}
+		}
+	}
+
+	writeResult(r, portalAccessURL(customer.CustomerID), errs)
+}
+
+// PortalAccountDelete revokes a portal account; its open sessions end on their next request.
+func (cam *CustomerAccountManager) PortalAccountDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	customer, ok := cam.customer(r)
+	if !ok {
+		return
+	}
+	accountID, err := strconv.ParseInt(r.Get("account_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid account ID")
+		return
+	}
+	account, err := cam.CustomerAccountRepo.FindByID(r.GetCtx(), accountID)
+	if err == nil && account.CustomerID != customer.CustomerID {
+		err = data.ErrNotFound
+	}
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Account not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find customer account: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if err := cam.CustomerAccountRepo.SoftDelete(r.GetCtx(), accountID, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete customer account: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, portalAccessURL(customer.CustomerID), nil)
+}
+
+// customer loads the customer named in the route, writing the error response when it cannot.
+func (cam *CustomerAccountManager) customer(r *ghttp.Request) (*domain.Customer, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return nil, false
+	}
+
+	customer, err := cam.CustomerRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Customer not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find customer: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return customer, true
+}
+
+// portalAccessURL returns the portal access page of a customer.
+func portalAccessURL(customerID int64) string {
+	return fmt.Sprintf("%s/management/customers/%d/portal-access", middleware.BasePath(), customerID)
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// ContactPost adds a contact person to a customer.
+func (cm *CustomerManager) ContactPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+
+	name := strings.TrimSpace(r.Get("contact_name").String())
+	email := optionalText(r, "contact_email")
+
+	errs := map[string]string{}
+	if name == "" {
+		errs["contact_name"] = "Name is required"
+	}
+	if email != nil {
+		if _, err := mail.ParseAddress(*email); err != nil {
+			errs["contact_email"] = "Enter a valid email address"
+		}
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		contact := &domain.CustomerContact{
+			CustomerID: id,
+			Name:       name,
+			Role:       optionalText(r, "contact_role"),
+			Phone:      optionalText(r, "contact_phone"),
+			Email:      email,
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := cm.CustomerCRMRepo.CreateContact(r.GetCtx(), contact); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create customer contact: %v", err)
+			errs["form"] = "Failed to add contact"
+		}
+	}
+
+	writeResult(r, customerURL(id), errs)
+}
+
+// ContactDelete removes a contact person from a customer.
+func (cm *CustomerManager) ContactDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+	contactID, err := strconv.ParseInt(r.Get("contact_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid contact ID")
+		return
+	}
+
+	if err := cm.CustomerCRMRepo.DeleteContact(r.GetCtx(), id, contactID, time.Now()); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Contact not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "delete customer contact: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, customerURL(id), nil)
+}
+
+// AddressPost adds a billing or delivery address to a customer.
+func (cm *CustomerManager) AddressPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+
+	kind := domain.AddressKind(r.Get("address_kind").String())
+	address := strings.TrimSpace(r.Get("address").String())
+
+	errs := map[string]string{}
+	if !slices.Contains(domain.AddressKinds, kind) {
+		errs["address_kind"] = "Choose billing or delivery"
+	}
+	if address == "" {
+		errs["address"] = "Address is required"
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		a := &domain.CustomerAddress{
+			CustomerID: id,
+			Kind:       kind,
+			Label:      optionalText(r, "address_label"),
+			Address:    address,
+			IsDefault:  r.Get("is_default").Bool(),
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := cm.CustomerCRMRepo.CreateAddress(r.GetCtx(), a); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create customer address: %v", err)
+			errs["form"] = "Failed to add address"
+		}
+	}
+
+	writeResult(r, customerURL(id), errs)
+}
+
+// AddressDefaultPost makes an address the default of its kind.
+func (cm *CustomerManager) AddressDefaultPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+	addressID, err := strconv.ParseInt(r.Get("address_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid address ID")
+		return
+	}
+
+	if err := cm.CustomerCRMRepo.SetDefaultAddress(r.GetCtx(), id, addressID); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Address not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "set default customer address: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, customerURL(id), nil)
+}
+
+// AddressDelete removes an address from a customer.
+func (cm *CustomerManager) AddressDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+	addressID, err := strconv.ParseInt(r.Get("address_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid address ID")
+		return
+	}
+
+	if err := cm.CustomerCRMRepo.DeleteAddress(r.GetCtx(), id, addressID, time.Now()); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Address not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "delete customer address: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, customerURL(id), nil)
+}
+
+// CommunicationPost records a call, email, visit, complaint or note in a customer's log.
+func (cm *CustomerManager) CommunicationPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+
+	kind := domain.CommunicationKind(r.Get("kind").String())
+	subject := strings.TrimSpace(r.Get("subject").String())
+	occurredAtStr := strings.TrimSpace(r.Get("occurred_at").String())
+	contactIDStr := strings.TrimSpace(r.Get("customer_contact_id").String())
+
+	errs := map[string]string{}
+	if !slices.Contains(domain.CommunicationKinds, kind) {
+		errs["kind"] = "Choose what kind of contact this was"
+	}
+	if subject == "" {
+		errs["subject"] = "Subject is required"
+	}
+	occurredAt := time.Now()
+	if occurredAtStr != "" {
+		parsed, err := time.ParseInLocation("2006-01-02T15:04", occurredAtStr, time.Local)
+		if err != nil {
+			errs["occurred_at"] = "Invalid date and time"
+		}
+		occurredAt = parsed
+	}
+	var contactID *int64
+	if contactIDStr != "" {
+		v, err := strconv.ParseInt(contactIDStr, 10, 64)
+		if err != nil {
+			errs["customer_contact_id"] = "Invalid contact"
+		}
+		contactID = &v
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		entry := &domain.CustomerCommunication{
+			CustomerID:        id,
+			CustomerContactID: contactID,
+			Kind:              kind,
+			OccurredAt:        occurredAt,
+			Subject:           subject,
+			Notes:             optionalText(r, "notes"),
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		_, err := cm.CustomerCRMRepo.CreateCommunication(r.GetCtx(), entry)
+		if err == data.ErrNotFound {
+			errs["customer_contact_id"] = "Choose one of the customer's contacts"
+		} else if err != nil {
+			g.Log().Errorf(r.GetCtx(), "create customer communication: %v", err)
+			errs["form"] = "Failed to record the communication"
+		}
+	}
+
+	writeResult(r, customerURL(id), errs)
+}
+
+// customerURL is the page of a customer.
+func customerURL(customerID int64) string {
+	return fmt.Sprintf("%s/management/customers/%d", middleware.BasePath(), customerID)
+}
+
+// optionalText reads a trimmed form field, nil when empty.
+func optionalText(r *ghttp.Request, field string) *string {
+	v := strings.TrimSpace(r.Get(field).String())
+	if v == "" {
+		return nil
+	}
+	return &v
+}
@@ -3,45 +3,49 @@ package handlers
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/models"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
 
-// RegisterDashboardRoutes wires the protected dashboard and a demo fragment.
-func RegisterDashboardRoutes(group *ghttp.RouterGroup, repos *DashboardRepos) {
-	d := &Dashboard{Repos: repos}
+// dashboardRefresh is how often the dashboard stream sends fresh widgets.
+const dashboardRefresh = 30 * time.Second
+
+// dashboardEntities are the entities the dashboard widgets are computed from.
+var dashboardEntities = []string{
+	"barns", "flocks", "feeding_records", "mortality_records", "production_batches",
+	"slaughter_records", "orders", "inventory_items", "tasks",
+}
+
+// RegisterDashboardRoutes wires the protected dashboard, its widget stream and a demo fragment.
+func RegisterDashboardRoutes(group *ghttp.RouterGroup, repos *DashboardRepos, bus *events.Bus) {
+	d := &Dashboard{Repos: repos, Events: bus}
 	// Protected root
 	group.GET("/", d.DashboardGet)
+	group.GET("/dashboard/stream", d.DashboardStream)
 	// Demo fragment endpoint to showcase hypermedia/DataStar swap.
 	group.GET("/fragment/ping", d.PingFragment)
 }
 
 type DashboardRepos struct {
-	UserRepo            data.UserRepo
-	BarnRepo            data.BarnRepo
-	FeedTypeRepo        data.FeedTypeRepo
-	StaffRepo           data.StaffRepo
-	FlockRepo           data.FlockRepo
-	FeedingRecordRepo   data.FeedingRecordRepo
-	HealthCheckRepo     data.HealthCheckRepo
-	MortalityRecordRepo data.MortalityRecordRepo
-	ProductionBatchRepo data.ProductionBatchRepo
-	SlaughterRecordRepo data.SlaughterRecordRepo
-	InventoryItemRepo   data.InventoryItemRepo
-	CustomerRepo        data.CustomerRepo
-	OrderRepo           data.OrderRepo
-	OrderItemRepo       data.OrderItemRepo
+	DashboardRepo data.DashboardRepo
+	TaskRepo      data.TaskRepo
 }
 
 type Dashboard struct {
-	Repos *DashboardRepos
+	Repos  *DashboardRepos
+	Events *events.Bus
 }
 
-// DashboardGet renders the dashboard with counts for all domain objects.
+// DashboardGet renders the dashboard with its widgets; the page then keeps them fresh through
+// DashboardStream.
 func (d *Dashboard) DashboardGet(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
 	if !ok {
@@ -49,62 +53,96 @@ func (d *Dashboard) DashboardGet(r *ghttp.Request) {
 		return
 	}
 
-	ctx := context.Background()
-	counts := &models.DashboardCounts{}
+	_ = middleware.TemplRender(
+		r,
+		pages.DashboardPage(
+			middleware.BasePath(),
+			"Dashboard",
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			d.widgets(r.GetCtx()),
+		),
+	)
+}
 
-	// Get counts for all domain objects
-	if count, err := d.Repos.BarnRepo.Count(ctx); err == nil {
-		counts.Barns = count
-	}
-	if count, err := d.Repos.FeedTypeRepo.Count(ctx); err == nil {
-		counts.FeedTypes = count
-	}
-	if count, err := d.Repos.StaffRepo.Count(ctx); err == nil {
-		counts.Staff = count
-	}
-	if count, err := d.Repos.FlockRepo.Count(ctx); err == nil {
-		counts.Flocks = count
+// DashboardStream is a Datastar server-sent event stream sending the dashboard widgets again
+// shortly after a change to the records behind them, and every dashboardRefresh as the day
+// moves on, until the browser goes away.
+func (d *Dashboard) DashboardStream(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.WriteStatusExit(401, "Unauthorized")
+		return
 	}
-	if count, err := d.Repos.FeedingRecordRepo.Count(ctx); err == nil {
-		counts.FeedingRecords = count
+
+	ctx := r.GetCtx()
+	changes, cancel := d.Events.Subscribe(dashboardEntities...)
+	defer cancel()
+	middleware.SSEStart(r)
+	ticker := time.NewTicker(dashboardRefresh)
+	defer ticker.Stop()
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			if pending == nil {
+				pending = time.After(liveDebounce)
+			}
+			continue
+		case <-pending:
+			pending = nil
+		case <-ticker.C:
+		}
+		if err := middleware.SSEPatchElements(r, pages.DashboardWidgets(middleware.BasePath(), d.widgets(ctx))); err != nil {
+			return
+		}
 	}
-	if count, err := d.Repos.HealthCheckRepo.Count(ctx); err == nil {
-		counts.HealthChecks = count
+}
+
+// widgets gathers the dashboard widgets; a widget whose query fails is logged and left empty.
+// Today's checklists are generated by ScheduleChecklists, not here, so showing the dashboard
+// writes nothing.
+func (d *Dashboard) widgets(ctx context.Context) *models.DashboardWidgets {
+	now := time.Now()
+	w := &models.DashboardWidgets{Today: today(), UpdatedAt: now}
+	var err error
+	if w.Barns, err = d.Repos.DashboardRepo.BarnOccupancy(ctx); err != nil {
+		g.Log().Errorf(ctx, "dashboard barn occupancy: %v", err)
 	}
-	if count, err := d.Repos.MortalityRecordRepo.Count(ctx); err == nil {
-		counts.MortalityRecords = count
+	if w.Mortality, err = d.Repos.DashboardRepo.MortalityTrend(ctx, w.Today, 7); err != nil {
+		g.Log().Errorf(ctx, "dashboard mortality trend: %v", err)
 	}
-	if count, err := d.Repos.ProductionBatchRepo.Count(ctx); err == nil {
-		counts.ProductionBatches = count
+	if w.Feed, err = d.Repos.DashboardRepo.FeedOnDay(ctx, w.Today); err != nil {
+		g.Log().Errorf(ctx, "dashboard feed today: %v", err)
 	}
-	if count, err := d.Repos.SlaughterRecordRepo.Count(ctx); err == nil {
-		counts.SlaughterRecords = count
+	if w.Batches, err = d.Repos.DashboardRepo.BatchesReadyBy(ctx, w.Today.AddDate(0, 0, 14)); err != nil {
+		g.Log().Errorf(ctx, "dashboard batches ready: %v", err)
 	}
-	if count, err := d.Repos.InventoryItemRepo.Count(ctx); err == nil {
-		counts.InventoryItems = count
+	if w.OpenOrders, err = d.Repos.DashboardRepo.OpenOrdersByStatus(ctx); err != nil {
+		g.Log().Errorf(ctx, "dashboard open orders: %v", err)
 	}
-	if count, err := d.Repos.CustomerRepo.Count(ctx); err == nil {
-		counts.Customers = count
+	if w.LowStock, err = d.Repos.DashboardRepo.LowStock(ctx); err != nil {
+		g.Log().Errorf(ctx, "dashboard low stock: %v", err)
 	}
-	if count, err := d.Repos.OrderRepo.Count(ctx); err == nil {
-		counts.Orders = count
+	tasks, err := d.Repos.TaskRepo.ListOpen(ctx, w.Today)
+	if err != nil {
+		g.Log().Errorf(ctx, "dashboard open tasks: %v", err)
 	}
-	if count, err := d.Repos.OrderItemRepo.Count(ctx); err == nil {
-		counts.OrderItems = count
+	for _, task := range tasks {
+		switch {
+		case !task.Overdue(now):
+		case task.Kind == domain.TaskKindHealthCheck:
+			w.OverdueHealthChecks = append(w.OverdueHealthChecks, task)
+		default:
+			w.OverdueTasks = append(w.OverdueTasks, task)
+		}
 	}
+	return w
+}
 
-	_ = middleware.TemplRender(
-		r,
-		pages.DashboardPage(
-			middleware.BasePath(),
-			"Dashboard",
-			middleware.CsrfToken(r),
-			user.Username,
-			ThemeToString(user.Theme),
-			counts,
-		),
-	)
-} // PingFragment returns HTML containing an element with id=content for DataStar morphing.
+// PingFragment returns HTML containing an element with id=content for DataStar morphing.
 func (d *Dashboard) PingFragment(r *ghttp.Request) {
 	r.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
 	r.Response.WriteStatus(http.StatusOK)
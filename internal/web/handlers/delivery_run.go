@@ -0,0 +1,555 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/routing"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// signaturePrefix is the data URL prefix of the PNG signatures drawn on the delivery note.
+const signaturePrefix = "data:image/png;base64,"
+
+// maxSignatureBytes bounds the size of a captured signature image.
+const maxSignatureBytes = 256 << 10
+
+type DeliveryRunManager struct {
+	DeliveryRunRepo  data.DeliveryRunRepo
+	OrderItemRepo    data.OrderItemRepo
+	StaffRepo        data.StaffRepo
+	DistanceProvider routing.Provider
+}
+
+// RegisterDeliveryRunRoutes wires delivery run, route planning and delivery note endpoints under /app.
+func RegisterDeliveryRunRoutes(group *ghttp.RouterGroup, deliveryRunRepo data.DeliveryRunRepo, orderItemRepo data.OrderItemRepo, staffRepo data.StaffRepo, distanceProvider routing.Provider) {
+	dm := &DeliveryRunManager{
+		DeliveryRunRepo:  deliveryRunRepo,
+		OrderItemRepo:    orderItemRepo,
+		StaffRepo:        staffRepo,
+		DistanceProvider: distanceProvider,
+	}
+
+	group.GET("/management/delivery-runs", dm.DeliveryRunsGet)
+	group.POST("/management/delivery-runs", dm.DeliveryRunPost)
+	group.GET("/management/delivery-runs/:id", dm.DeliveryRunGet)
+	group.DELETE("/management/delivery-runs/:id", dm.DeliveryRunDelete)
+	group.POST("/management/delivery-runs/:id/stops", dm.DeliveryStopPost)
+	group.DELETE("/management/delivery-runs/:id/stops/:stop_id", dm.DeliveryStopDelete)
+	group.POST("/management/delivery-runs/:id/route", dm.DeliveryRoutePost)
+	group.POST("/management/delivery-runs/:id/dispatch", dm.DeliveryDispatchPost)
+	group.GET("/management/delivery-runs/:id/notes", dm.DeliveryNotesGet)
+	group.GET("/management/delivery-runs/:id/stops/:stop_id", dm.DeliveryStopGet)
+	group.POST("/management/delivery-runs/:id/stops/:stop_id/close", dm.DeliveryStopClosePost)
+}
+
+// DeliveryRunsGet renders the delivery runs with the form planning a new one.
+func (dm *DeliveryRunManager) DeliveryRunsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	runs, err := dm.DeliveryRunRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list delivery runs: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	staff, err := dm.StaffRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list staff: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	runDate := today().Format("2006-01-02")
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.DeliveryRunsContent(middleware.BasePath(), middleware.CsrfToken(r), runDate, runs, staff))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.DeliveryRunsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			runDate,
+			runs,
+			staff,
+		),
+	)
+}
+
+// DeliveryRunPost plans a delivery run for a day.
+func (dm *DeliveryRunManager) DeliveryRunPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	errs := map[string]string{}
+	run := &domain.DeliveryRun{}
+	var err error
+	if run.RunDate, err = time.Parse("2006-01-02", r.Get("run_date").String()); err != nil {
+		errs["run_date"] = "Run date must be a valid date"
+	}
+	if driver := strings.TrimSpace(r.Get("driver_id").String()); driver != "" {
+		if driverID, err := strconv.ParseInt(driver, 10, 64); err == nil {
+			run.DriverID = &driverID
+		} else {
+			errs["driver_id"] = "Driver must be a valid staff member"
+		}
+	}
+	if notes := strings.TrimSpace(r.Get("notes").String()); notes != "" {
+		run.Notes = &notes
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		run.Audit.CreatedBy = &userIDStr
+		run.Audit.UpdatedBy = &userIDStr
+		if run.DeliveryRunID, err = dm.DeliveryRunRepo.Create(r.GetCtx(), run); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create delivery run: %v", err)
+			errs["form"] = "Failed to plan delivery run"
+		}
+	}
+
+	target := middleware.BasePath() + "/management/delivery-runs"
+	if len(errs) == 0 {
+		target = deliveryRunURL(run.DeliveryRunID)
+	}
+	writeResult(r, target, errs)
+}
+
+// DeliveryRunGet renders a run with its stops in visiting order and, while it is planned, the
+// orders ready to be added.
+func (dm *DeliveryRunManager) DeliveryRunGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+	var ready []*domain.Order
+	if run.Status == domain.DeliveryRunPlanned {
+		var err error
+		if ready, err = dm.DeliveryRunRepo.ReadyOrders(r.GetCtx()); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list ready orders: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+	farm := models.FarmProfileFromEnv()
+	depotKnown := farm.Latitude != nil && farm.Longitude != nil
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.DeliveryRunContent(middleware.BasePath(), middleware.CsrfToken(r), run, ready, depotKnown))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.DeliveryRunPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			run,
+			ready,
+			depotKnown,
+		),
+	)
+}
+
+// DeliveryRunDelete removes a planned run.
+func (dm *DeliveryRunManager) DeliveryRunDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+
+	switch err := dm.DeliveryRunRepo.SoftDelete(r.GetCtx(), run.DeliveryRunID, time.Now()); {
+	case errors.Is(err, domain.ErrRunNotPlanned):
+		writeResult(r, deliveryRunURL(run.DeliveryRunID), map[string]string{"form": err.Error()})
+		return
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "delete delivery run: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/delivery-runs", nil)
+}
+
+// DeliveryStopPost adds a ready order to the end of a planned run.
+func (dm *DeliveryRunManager) DeliveryStopPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	orderID, err := strconv.ParseInt(r.Get("order_id").String(), 10, 64)
+	if err != nil {
+		errs["order_id"] = "Order is required"
+	}
+	if len(errs) == 0 {
+		_, err := dm.DeliveryRunRepo.AddStop(r.GetCtx(), run.DeliveryRunID, orderID, r.Get("version").Int64())
+		switch {
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case errors.Is(err, domain.ErrRunNotPlanned), errors.Is(err, domain.ErrOrderNotReady), errors.Is(err, domain.ErrOrderOnRun):
+			errs["order_id"] = err.Error()
+		case err == data.ErrNotFound:
+			errs["order_id"] = "Order not found"
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "add delivery stop: %v", err)
+			errs["form"] = "Failed to add stop"
+		}
+	}
+
+	writeResult(r, deliveryRunURL(run.DeliveryRunID), errs)
+}
+
+// DeliveryStopDelete takes a stop off a planned run.
+func (dm *DeliveryRunManager) DeliveryStopDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+	stopID, err := strconv.ParseInt(r.Get("stop_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid stop ID")
+		return
+	}
+
+	errs := map[string]string{}
+	switch err := dm.DeliveryRunRepo.RemoveStop(r.GetCtx(), run.DeliveryRunID, stopID, r.Get("version").Int64()); {
+	case errors.Is(err, domain.ErrRunNotPlanned):
+		errs["form"] = err.Error()
+	case errors.Is(err, data.ErrConflict):
+		errs["form"] = staleFormMessage
+	case err == data.ErrNotFound:
+		r.Response.WriteStatusExit(404, "Stop not found")
+		return
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "remove delivery stop: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, deliveryRunURL(run.DeliveryRunID), errs)
+}
+
+// DeliveryRoutePost orders the stops of a planned run with the distance provider, starting
+// from the farm when its location is configured.
+func (dm *DeliveryRunManager) DeliveryRoutePost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	var depot *routing.Point
+	if farm.Latitude != nil && farm.Longitude != nil {
+		depot = &routing.Point{Lat: *farm.Latitude, Lng: *farm.Longitude}
+	}
+	stops := make([]routing.Stop, 0, len(run.Stops))
+	byID := make(map[int64]*domain.DeliveryStop, len(run.Stops))
+	for _, stop := range run.Stops {
+		byID[stop.DeliveryStopID] = stop
+		routed := routing.Stop{ID: stop.DeliveryStopID}
+		if c := stop.Order.Customer; c.Latitude != nil && c.Longitude != nil {
+			routed.Point = &routing.Point{Lat: *c.Latitude, Lng: *c.Longitude}
+		}
+		stops = append(stops, routed)
+	}
+
+	errs := map[string]string{}
+	route, err := routing.Plan(r.GetCtx(), dm.DistanceProvider, depot, stops)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "plan delivery route: %v", err)
+		errs["form"] = "Failed to plan the route"
+	}
+	if len(errs) == 0 {
+		ordered := make([]*domain.DeliveryStop, 0, len(route.Legs))
+		for i, leg := range route.Legs {
+			stop := byID[leg.ID]
+			stop.Sequence = i + 1
+			stop.LegDistanceKm = leg.DistanceKm
+			ordered = append(ordered, stop)
+		}
+		var total *float64
+		if depot != nil || len(route.Legs) > 1 {
+			total = &route.TotalKm
+		}
+		switch err := dm.DeliveryRunRepo.SetRoute(r.GetCtx(), run.DeliveryRunID, ordered, total, r.Get("version").Int64()); {
+		case errors.Is(err, domain.ErrRunNotPlanned):
+			errs["form"] = err.Error()
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "save delivery route: %v", err)
+			errs["form"] = "Failed to save the route"
+		}
+	}
+
+	writeResult(r, deliveryRunURL(run.DeliveryRunID), errs)
+}
+
+// DeliveryDispatchPost sends a planned run out for delivery.
+func (dm *DeliveryRunManager) DeliveryDispatchPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	err := dm.DeliveryRunRepo.Dispatch(r.GetCtx(), run.DeliveryRunID, r.Get("version").Int64())
+	var transitionErr *domain.OrderTransitionError
+	switch {
+	case errors.Is(err, domain.ErrRunNotPlanned), errors.Is(err, domain.ErrRunEmpty):
+		errs["form"] = err.Error()
+	case errors.Is(err, data.ErrConflict):
+		errs["form"] = staleFormMessage
+	case errors.As(err, &transitionErr):
+		errs["form"] = transitionErr.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "dispatch delivery run: %v", err)
+		errs["form"] = "Failed to dispatch the run"
+	}
+
+	writeResult(r, deliveryRunURL(run.DeliveryRunID), errs)
+}
+
+// DeliveryNotesGet renders the printable delivery notes of every stop of a run.
+func (dm *DeliveryRunManager) DeliveryNotesGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+	notes := make([]pages.DeliveryNote, 0, len(run.Stops))
+	for _, stop := range run.Stops {
+		items, err := dm.OrderItemRepo.ListByOrder(r.GetCtx(), stop.OrderID)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "list order lines: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		notes = append(notes, pages.DeliveryNote{Run: run, Stop: stop, Items: items})
+	}
+
+	_ = middleware.TemplRender(r, pages.DeliveryNotesPage(models.FarmProfileFromEnv(), run, notes))
+}
+
+// DeliveryStopGet renders the delivery note of one stop, where the driver captures the
+// recipient's signature.
+func (dm *DeliveryRunManager) DeliveryStopGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+	stop, ok := dm.stop(r, run)
+	if !ok {
+		return
+	}
+	items, err := dm.OrderItemRepo.ListByOrder(r.GetCtx(), stop.OrderID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list order lines: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	note := pages.DeliveryNote{Run: run, Stop: stop, Items: items}
+	farm := models.FarmProfileFromEnv()
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.DeliveryStopContent(middleware.BasePath(), middleware.CsrfToken(r), farm, note))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.DeliveryStopPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			farm,
+			note,
+		),
+	)
+}
+
+// DeliveryStopClosePost records a stop as delivered (with the recipient's name and signature)
+// or as not delivered.
+func (dm *DeliveryRunManager) DeliveryStopClosePost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	run, ok := dm.run(r)
+	if !ok {
+		return
+	}
+	stop, ok := dm.stop(r, run)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	closed := &domain.DeliveryStop{
+		DeliveryStopID: stop.DeliveryStopID,
+		DeliveryRunID:  run.DeliveryRunID,
+		Status:         domain.DeliveryStopStatus(r.Get("status").String()),
+	}
+	if recipient := strings.TrimSpace(r.Get("recipient_name").String()); recipient != "" {
+		closed.RecipientName = &recipient
+	}
+	if notes := strings.TrimSpace(r.Get("notes").String()); notes != "" {
+		closed.Notes = &notes
+	}
+	switch closed.Status {
+	case domain.DeliveryStopDelivered:
+		if closed.RecipientName == nil {
+			errs["recipient_name"] = "Enter who received the goods"
+		}
+		if signature := r.Get("signature").String(); signature != "" {
+			if !validSignature(signature) {
+				errs["signature"] = "The signature could not be read; clear it and sign again"
+			} else {
+				closed.Signature = &signature
+			}
+		}
+	case domain.DeliveryStopFailed:
+		if closed.Notes == nil {
+			errs["notes"] = "Note why the order could not be delivered"
+		}
+	default:
+		errs["status"] = "Choose delivered or not delivered"
+	}
+
+	if len(errs) == 0 {
+		err := dm.DeliveryRunRepo.CloseStop(r.GetCtx(), closed)
+		var transitionErr *domain.OrderTransitionError
+		switch {
+		case errors.Is(err, domain.ErrRunNotDispatched), errors.Is(err, domain.ErrStopClosed):
+			errs["form"] = err.Error()
+		case errors.As(err, &transitionErr):
+			errs["form"] = transitionErr.Error()
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "close delivery stop: %v", err)
+			errs["form"] = "Failed to record the delivery"
+		}
+	}
+
+	writeResult(r, deliveryRunURL(run.DeliveryRunID), errs)
+}
+
+// run loads the delivery run named in the route, writing the error response when it cannot.
+func (dm *DeliveryRunManager) run(r *ghttp.Request) (*domain.DeliveryRun, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid delivery run ID")
+		return nil, false
+	}
+
+	run, err := dm.DeliveryRunRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Delivery run not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find delivery run: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return run, true
+}
+
+// stop finds the stop named in the route among the run's stops.
+func (dm *DeliveryRunManager) stop(r *ghttp.Request, run *domain.DeliveryRun) (*domain.DeliveryStop, bool) {
+	id, err := strconv.ParseInt(r.Get("stop_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid stop ID")
+		return nil, false
+	}
+	for _, stop := range run.Stops {
+		if stop.DeliveryStopID == id {
+			return stop, true
+		}
+	}
+	r.Response.WriteStatusExit(404, "Stop not found")
+	return nil, false
+}
+
+// validSignature reports whether s is a PNG data URL of reasonable size.
+func validSignature(s string) bool {
+	if !strings.HasPrefix(s, signaturePrefix) || len(s) > maxSignatureBytes {
+		return false
+	}
+	png, err := base64.StdEncoding.DecodeString(s[len(signaturePrefix):])
+	return err == nil && strings.HasPrefix(string(png), "\x89PNG\r\n\x1a\n")
+}
+
+// deliveryRunURL returns the page of a delivery run.
+func deliveryRunURL(id int64) string {
+	return fmt.Sprintf("%s/management/delivery-runs/%d", middleware.BasePath(), id)
+}
@@ -0,0 +1,559 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type FarmManager struct {
+	FarmRepo          data.FarmRepo
+	UserRepo          data.UserRepo
+	BarnRepo          data.BarnRepo
+	FlockRepo         data.FlockRepo
+	ProductLotRepo    data.ProductLotRepo
+	InventoryItemRepo data.InventoryItemRepo
+}
+
+// RegisterFarmRoutes wires the farm switcher, farm and member management, the cross-farm report
+// and the transfers between farms under /app.
+func RegisterFarmRoutes(group *ghttp.RouterGroup, farmRepo data.FarmRepo, userRepo data.UserRepo, barnRepo data.BarnRepo, flockRepo data.FlockRepo, productLotRepo data.ProductLotRepo, inventoryItemRepo data.InventoryItemRepo) {
+	fm := &FarmManager{
+		FarmRepo:          farmRepo,
+		UserRepo:          userRepo,
+		BarnRepo:          barnRepo,
+		FlockRepo:         flockRepo,
+		ProductLotRepo:    productLotRepo,
+		InventoryItemRepo: inventoryItemRepo,
+	}
+
+	group.POST("/farms/switch", fm.SwitchPost)
+	group.GET("/farms", fm.FarmsGet)
+	group.POST("/farms", fm.FarmPost)
+	group.GET("/farms/report", fm.ReportGet)
+	group.GET("/farms/transfers", fm.TransfersGet)
+	group.POST("/farms/transfers/flock", fm.TransferFlockPost)
+	group.POST("/farms/transfers/lot", fm.TransferLotPost)
+	group.POST("/farms/transfers/inventory", fm.TransferInventoryPost)
+	group.GET("/farms/:id", fm.FarmGet)
+	group.POST("/farms/:id", fm.FarmUpdatePost)
+	group.POST("/farms/:id/members", fm.MemberPost)
+	group.DELETE("/farms/:id/members/:user_id", fm.MemberDelete)
+}
+
+// SwitchPost makes another of the user's farms the active one and returns to the dashboard,
+// since the page they were on may show a record of the farm they left.
+func (fm *FarmManager) SwitchPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	farmID, err := strconv.ParseInt(r.Get("farm_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid farm ID")
+		return
+	}
+	if _, ok := models.FarmAccessFrom(r.GetCtx()).Membership(farmID); !ok {
+		r.Response.WriteStatusExit(403, "Forbidden: you do not belong to that farm")
+		return
+	}
+	middleware.SetActiveFarm(r, farmID)
+	r.Response.RedirectTo(middleware.BasePath())
+}
+
+// FarmsGet renders the farms the user belongs to with the form adding one.
+func (fm *FarmManager) FarmsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	access := models.FarmAccessFrom(r.GetCtx())
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.FarmsContent(middleware.BasePath(), middleware.CsrfToken(r), access))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FarmsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			access,
+		),
+	)
+}
+
+// FarmPost adds a farm with the user as its owner. Only owners add farms.
+func (fm *FarmManager) FarmPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if len(models.FarmAccessFrom(r.GetCtx()).Owned()) == 0 {
+		r.Response.WriteStatusExit(403, "Forbidden: only farm owners add farms")
+		return
+	}
+
+	errs := map[string]string{}
+	farm := farmFromRequest(r)
+	if err := farm.Validate(); err != nil {
+		errs["name"] = err.Error()
+	}
+
+	if len(errs) == 0 {
+		if _, err := fm.FarmRepo.Create(r.GetCtx(), farm, user.ID); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create farm: %v", err)
+			errs["form"] = "Failed to create the farm"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/farms", errs)
+}
+
+// FarmGet renders a farm's settings and members to its owners.
+func (fm *FarmManager) FarmGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	farm, ok := fm.ownedFarm(r)
+	if !ok {
+		return
+	}
+	members, err := fm.FarmRepo.Members(r.GetCtx(), farm.FarmID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list farm members: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.FarmContent(middleware.BasePath(), middleware.CsrfToken(r), farm, members))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FarmPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			farm,
+			members,
+		),
+	)
+}
+
+// FarmUpdatePost renames or relocates a farm.
+func (fm *FarmManager) FarmUpdatePost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	farm, ok := fm.ownedFarm(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	update := farmFromRequest(r)
+	update.FarmID = farm.FarmID
+	update.Audit.Version = r.Get("version").Int64()
+	if err := update.Validate(); err != nil {
+		errs["name"] = err.Error()
+	}
+
+	if len(errs) == 0 {
+		switch err := fm.FarmRepo.Update(r.GetCtx(), update); {
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "update farm: %v", err)
+			errs["form"] = "Failed to update the farm"
+		}
+	}
+
+	writeResult(r, farmURL(farm.FarmID), errs)
+}
+
+// MemberPost gives a user a role on a farm, or changes the role they have. A username nobody
+// has yet creates that user with the initial password given.
+func (fm *FarmManager) MemberPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	farm, ok := fm.ownedFarm(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	username := strings.TrimSpace(r.Get("username").String())
+	if username == "" {
+		errs["username"] = "Username is required"
+	}
+	role := domain.FarmRole(r.Get("role").String())
+	if !role.Valid() {
+		errs["role"] = "Choose a role"
+	}
+
+	if len(errs) == 0 {
+		ctx := r.GetCtx()
+		member, err := fm.UserRepo.FindByUsername(ctx, username)
+		switch {
+		case err == data.ErrNotFound:
+			password := r.Get("password").String()
+			if len(password) < 8 {
+				errs["password"] = "There is no such user yet; give them a password of at least 8 characters"
+				break
+			}
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				g.Log().Errorf(ctx, "hash user password: %v", err)
+				errs["form"] = "Failed to add the member"
+				break
+			}
+			member = &domain.User{Username: username, PasswordHash: string(hash)}
+			if member.ID, err = fm.UserRepo.Create(ctx, member); err != nil {
+				g.Log().Errorf(ctx, "create user: %v", err)
+				errs["form"] = "Failed to add the member"
+			}
+		case err != nil:
+			g.Log().Errorf(ctx, "find user: %v", err)
+			errs["form"] = "Failed to add the member"
+		}
+
+		if len(errs) == 0 {
+			switch err := fm.FarmRepo.SetMember(ctx, farm.FarmID, member.ID, role); {
+			case errors.Is(err, domain.ErrLastOwner):
+				errs["role"] = err.Error()
+			case err != nil:
+				g.Log().Errorf(ctx, "set farm member: %v", err)
+				errs["form"] = "Failed to add the member"
+			}
+		}
+	}
+
+	writeResult(r, farmURL(farm.FarmID), errs)
+}
+
+// MemberDelete takes a user off a farm; their other farms are unaffected.
+func (fm *FarmManager) MemberDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	farm, ok := fm.ownedFarm(r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(r.Get("user_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid user ID")
+		return
+	}
+
+	errs := map[string]string{}
+	switch err := fm.FarmRepo.RemoveMember(r.GetCtx(), farm.FarmID, userID); {
+	case errors.Is(err, domain.ErrLastOwner):
+		errs["form"] = err.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "remove farm member: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, farmURL(farm.FarmID), errs)
+}
+
+// ReportGet renders the key figures of every farm the user owns side by side, over a period
+// that defaults to the month so far.
+func (fm *FarmManager) ReportGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	owned := models.FarmAccessFrom(r.GetCtx()).Owned()
+	if len(owned) == 0 {
+		r.Response.WriteStatusExit(403, "Forbidden: the report is for farm owners")
+		return
+	}
+
+	to := today()
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, to.Location())
+	for name, day := range map[string]*time.Time{"from": &from, "to": &to} {
+		if v := strings.TrimSpace(r.Get(name).String()); v != "" {
+			parsed, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				r.Response.WriteStatusExit(400, "Invalid date")
+				return
+			}
+			*day = parsed
+		}
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+
+	summaries, err := fm.FarmRepo.Summaries(r.GetCtx(), owned, from, to)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "summarise farms: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.FarmReportContent(middleware.BasePath(), from, to, summaries))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FarmReportPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			from,
+			to,
+			summaries,
+		),
+	)
+}
+
+// TransfersGet renders the forms moving a flock, a product lot or inventory stock from the active
+// farm to another of the user's farms.
+func (fm *FarmManager) TransfersGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	access, ok := transferAccess(r)
+	if !ok {
+		return
+	}
+	ctx := r.GetCtx()
+	transfers := &pages.FarmTransfers{From: access.Active}
+	var err error
+	if transfers.Flocks, err = fm.FlockRepo.List(ctx); err != nil {
+		g.Log().Errorf(ctx, "list flocks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if transfers.Lots, err = fm.ProductLotRepo.List(ctx); err != nil {
+		g.Log().Errorf(ctx, "list product lots: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if transfers.Items, err = fm.InventoryItemRepo.List(ctx); err != nil {
+		g.Log().Errorf(ctx, "list inventory items: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	for _, m := range access.Memberships {
+		if m.FarmID == access.Active.FarmID || !m.Role.AtLeast(domain.FarmRoleManager) {
+			continue
+		}
+		barns, err := fm.BarnRepo.List(data.WithFarm(ctx, m.FarmID))
+		if err != nil {
+			g.Log().Errorf(ctx, "list barns: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		transfers.Targets = append(transfers.Targets, pages.FarmTransferTarget{Farm: m, Barns: barns})
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.FarmTransfersContent(middleware.BasePath(), middleware.CsrfToken(r), transfers))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FarmTransfersPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			transfers,
+		),
+	)
+}
+
+// TransferFlockPost moves a flock, with its records, to another farm.
+func (fm *FarmManager) TransferFlockPost(r *ghttp.Request) {
+	fm.transfer(r, "flock_id", func(id, toFarmID int64, errs map[string]string) error {
+		var barnID *int64
+		if v := strings.TrimSpace(r.Get("barn_id").String()); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs["barn_id"] = "Invalid barn"
+				return nil
+			}
+			barnID = &parsed
+		}
+		// The barn is checked first, so a barn given makes it the likelier thing not found.
+		err := fm.FarmRepo.TransferFlock(r.GetCtx(), id, toFarmID, barnID)
+		if err == data.ErrNotFound && barnID != nil {
+			errs["barn_id"] = "Choose a barn on the farm the flock moves to"
+			return nil
+		}
+		return err
+	})
+}
+
+// TransferLotPost moves a product lot nobody has reserved stock from to another farm.
+func (fm *FarmManager) TransferLotPost(r *ghttp.Request) {
+	fm.transfer(r, "product_lot_id", func(id, toFarmID int64, errs map[string]string) error {
+		return fm.FarmRepo.TransferLot(r.GetCtx(), id, toFarmID)
+	})
+}
+
+// TransferInventoryPost moves part or all of an inventory item's stock to another farm.
+func (fm *FarmManager) TransferInventoryPost(r *ghttp.Request) {
+	fm.transfer(r, "inventory_item_id", func(id, toFarmID int64, errs map[string]string) error {
+		quantity, err := strconv.ParseFloat(strings.TrimSpace(r.Get("quantity").String()), 64)
+		if err != nil {
+			errs["quantity"] = "Quantity must be a number"
+			return nil
+		}
+		err = fm.FarmRepo.TransferInventory(r.GetCtx(), id, toFarmID, quantity)
+		if errors.Is(err, domain.ErrTransferQuantity) {
+			errs["quantity"] = err.Error()
+			return nil
+		}
+		return err
+	})
+}
+
+// transfer reads the record named by idField and the farm it goes to, checks the user manages
+// both farms, and runs move. move may report problems with its own fields in errs.
+func (fm *FarmManager) transfer(r *ghttp.Request, idField string, move func(id, toFarmID int64, errs map[string]string) error) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	access, ok := transferAccess(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	id, err := strconv.ParseInt(r.Get(idField).String(), 10, 64)
+	if err != nil {
+		errs[idField] = "Choose what to transfer"
+	}
+	toFarmID, err := strconv.ParseInt(r.Get("to_farm_id").String(), 10, 64)
+	if m, ok := access.Membership(toFarmID); err != nil || !ok || !m.Role.AtLeast(domain.FarmRoleManager) {
+		errs["to_farm_id"] = "Choose a farm you manage"
+	}
+
+	if len(errs) == 0 {
+		switch err := move(id, toFarmID, errs); {
+		case err == nil:
+		case errors.Is(err, domain.ErrSameFarm):
+			errs["to_farm_id"] = err.Error()
+		case errors.Is(err, domain.ErrLotReserved), errors.Is(err, domain.ErrFlockHasBatches):
+			errs[idField] = err.Error()
+		case errors.Is(err, domain.ErrTransferNeedsBarn):
+			errs["barn_id"] = err.Error()
+		case err == data.ErrNotFound:
+			errs[idField] = "It is no longer on this farm"
+		default:
+			g.Log().Errorf(r.GetCtx(), "transfer %s: %v", idField, err)
+			errs["form"] = "Failed to make the transfer"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/farms/transfers", errs)
+}
+
+// ownedFarm loads the farm named in the route, writing the error response when it cannot or when
+// the user does not own it.
+func (fm *FarmManager) ownedFarm(r *ghttp.Request) (*domain.Farm, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid farm ID")
+		return nil, false
+	}
+	if m, ok := models.FarmAccessFrom(r.GetCtx()).Membership(id); !ok || m.Role != domain.FarmRoleOwner {
+		r.Response.WriteStatusExit(403, "Forbidden: only the farm's owners manage it")
+		return nil, false
+	}
+
+	farm, err := fm.FarmRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Farm not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find farm: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return farm, true
+}
+
+// transferAccess returns the user's farm access when they manage the active farm, writing the
+// error response when they do not.
+func transferAccess(r *ghttp.Request) (models.FarmAccess, bool) {
+	access := models.FarmAccessFrom(r.GetCtx())
+	if !access.Can(domain.FarmRoleManager) {
+		r.Response.WriteStatusExit(403, "Forbidden: transfers are for farm managers and owners")
+		return access, false
+	}
+	return access, true
+}
+
+// sharedDataAccess writes a 403 unless the user manages the active farm. The product catalog,
+// price lists and compliance rules apply to every farm, so workers can only read them.
+func sharedDataAccess(r *ghttp.Request) bool {
+	if !models.FarmAccessFrom(r.GetCtx()).Can(domain.FarmRoleManager) {
+		r.Response.WriteStatusExit(403, "Forbidden: shared products, price lists and compliance rules are changed by farm managers and owners")
+		return false
+	}
+	return true
+}
+
+// farmFromRequest reads the farm form.
+func farmFromRequest(r *ghttp.Request) *domain.Farm {
+	farm := &domain.Farm{Name: r.Get("name").String()}
+	if v := strings.TrimSpace(r.Get("location").String()); v != "" {
+		farm.Location = &v
+	}
+	return farm
+}
+
+// farmURL returns the settings page of a farm.
+func farmURL(farmID int64) string {
+	return fmt.Sprintf("%s/farms/%d", middleware.BasePath(), farmID)
+}
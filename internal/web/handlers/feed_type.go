@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -16,16 +20,19 @@ import (
 
 type FeedTypeManager struct {
 	FeedTypeRepo data.FeedTypeRepo
+	Events       *events.Bus
 }
 
 // RegisterFeedTypeRoutes wires feed type management endpoints under /app.
-func RegisterFeedTypeRoutes(group *ghttp.RouterGroup, feedTypeRepo data.FeedTypeRepo) {
+func RegisterFeedTypeRoutes(group *ghttp.RouterGroup, feedTypeRepo data.FeedTypeRepo, bus *events.Bus) {
 	ftm := &FeedTypeManager{
 		FeedTypeRepo: feedTypeRepo,
+		Events:       bus,
 	}
 
 	// FeedType management
 	group.GET("/management/feed-types", ftm.FeedTypesGet)
+	group.GET("/management/feed-types/stream", ftm.FeedTypesStream)
 	group.POST("/management/feed-types", ftm.FeedTypePost)
 	group.GET("/management/feed-types/new", ftm.FeedTypeGet)
 	group.GET("/management/feed-types/:id", ftm.FeedTypeGet)
@@ -74,6 +81,18 @@ func (ftm *FeedTypeManager) FeedTypesGet(r *ghttp.Request) {
 	)
 }
 
+// FeedTypesStream keeps the feed type list up to date over server-sent events.
+func (ftm *FeedTypeManager) FeedTypesStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, ftm.Events, func(ctx context.Context) (templ.Component, error) {
+		feedTypes, err := ftm.FeedTypeRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.FeedTypesList(basePath, csrf, feedTypes), nil
+	}, "feed_types")
+}
+
 // FeedTypePost creates a new feed type.
 func (ftm *FeedTypeManager) FeedTypePost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -85,6 +104,8 @@ func (ftm *FeedTypeManager) FeedTypePost(r *ghttp.Request) {
 	name := strings.TrimSpace(r.Get("name").String())
 	description := strings.TrimSpace(r.Get("description").String())
 	nutritionalInfo := strings.TrimSpace(r.Get("nutritional_info").String())
+	organicCertified := r.Get("organic_certified").Bool()
+	costPerKgStr := strings.TrimSpace(r.Get("cost_per_kg").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -103,6 +124,16 @@ func (ftm *FeedTypeManager) FeedTypePost(r *ghttp.Request) {
 		*nutritional = nutritionalInfo
 	}
 
+	var costPerKg *float64
+	if costPerKgStr != "" {
+		if costVal, err := strconv.ParseFloat(costPerKgStr, 64); err == nil && costVal >= 0 {
+			costPerKg = new(float64)
+			*costPerKg = costVal
+		} else {
+			errs["cost_per_kg"] = "Cost per kg must be a number of zero or more"
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -112,9 +143,11 @@ func (ftm *FeedTypeManager) FeedTypePost(r *ghttp.Request) {
 		updatedBy := new(string)
 		*updatedBy = userIDStr
 		feedType := &domain.FeedType{
-			Name:            name,
-			Description:     desc,
-			NutritionalInfo: nutritional,
+			Name:             name,
+			Description:      desc,
+			NutritionalInfo:  nutritional,
+			OrganicCertified: organicCertified,
+			CostPerKg:        costPerKg,
 			Audit: domain.AuditFields{
 				CreatedBy: createdBy,
 				UpdatedBy: updatedBy,
@@ -233,6 +266,8 @@ func (ftm *FeedTypeManager) FeedTypePut(r *ghttp.Request) {
 	name := strings.TrimSpace(r.Get("name").String())
 	description := strings.TrimSpace(r.Get("description").String())
 	nutritionalInfo := strings.TrimSpace(r.Get("nutritional_info").String())
+	organicCertified := r.Get("organic_certified").Bool()
+	costPerKgStr := strings.TrimSpace(r.Get("cost_per_kg").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -251,6 +286,16 @@ func (ftm *FeedTypeManager) FeedTypePut(r *ghttp.Request) {
 		*nutritional = nutritionalInfo
 	}
 
+	var costPerKg *float64
+	if costPerKgStr != "" {
+		if costVal, err := strconv.ParseFloat(costPerKgStr, 64); err == nil && costVal >= 0 {
+			costPerKg = new(float64)
+			*costPerKg = costVal
+		} else {
+			errs["cost_per_kg"] = "Cost per kg must be a number of zero or more"
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -258,16 +303,26 @@ func (ftm *FeedTypeManager) FeedTypePut(r *ghttp.Request) {
 		updatedBy := new(string)
 		*updatedBy = userIDStr
 		feedType := &domain.FeedType{
-			FeedTypeID:      id,
-			Name:            name,
-			Description:     desc,
-			NutritionalInfo: nutritional,
+			FeedTypeID:       id,
+			Name:             name,
+			Description:      desc,
+			NutritionalInfo:  nutritional,
+			OrganicCertified: organicCertified,
+			CostPerKg:        costPerKg,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := ftm.FeedTypeRepo.Update(r.GetCtx(), feedType)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := ftm.FeedTypeRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/feed-types/%d", middleware.BasePath(), id)
+				writeConflict(r, "Feed Type", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update feed type: %v", err)
 			errs["form"] = "Failed to update feed type"
@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -20,19 +24,24 @@ type FeedingRecordManager struct {
 	FlockRepo         data.FlockRepo
 	FeedTypeRepo      data.FeedTypeRepo
 	StaffRepo         data.StaffRepo
+	TaskRepo          data.TaskRepo
+	Events            *events.Bus
 }
 
 // RegisterFeedingRecordRoutes wires feeding record management endpoints under /app.
-func RegisterFeedingRecordRoutes(group *ghttp.RouterGroup, feedingRecordRepo data.FeedingRecordRepo, flockRepo data.FlockRepo, feedTypeRepo data.FeedTypeRepo, staffRepo data.StaffRepo) {
+func RegisterFeedingRecordRoutes(group *ghttp.RouterGroup, feedingRecordRepo data.FeedingRecordRepo, flockRepo data.FlockRepo, feedTypeRepo data.FeedTypeRepo, staffRepo data.StaffRepo, taskRepo data.TaskRepo, bus *events.Bus) {
 	frm := &FeedingRecordManager{
 		FeedingRecordRepo: feedingRecordRepo,
 		FlockRepo:         flockRepo,
 		FeedTypeRepo:      feedTypeRepo,
 		StaffRepo:         staffRepo,
+		TaskRepo:          taskRepo,
+		Events:            bus,
 	}
 
 	// Feeding record management
 	group.GET("/management/feeding-records", frm.FeedingRecordsGet)
+	group.GET("/management/feeding-records/stream", frm.FeedingRecordsStream)
 	group.POST("/management/feeding-records", frm.FeedingRecordPost)
 	group.GET("/management/feeding-records/new", frm.FeedingRecordGet)
 	group.GET("/management/feeding-records/:id", frm.FeedingRecordGet)
@@ -80,6 +89,18 @@ func (frm *FeedingRecordManager) FeedingRecordsGet(r *ghttp.Request) {
 	)
 }
 
+// FeedingRecordsStream keeps the feeding record list up to date over server-sent events.
+func (frm *FeedingRecordManager) FeedingRecordsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, frm.Events, func(ctx context.Context) (templ.Component, error) {
+		feedingRecords, err := frm.FeedingRecordRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.FeedingRecordsList(basePath, csrf, feedingRecords), nil
+	}, "feeding_records")
+}
+
 // FeedingRecordPost creates a new feeding record.
 func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -91,6 +112,7 @@ func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 	flockIDStr := strings.TrimSpace(r.Get("flock_id").String())
 	feedTypeIDStr := strings.TrimSpace(r.Get("feed_type_id").String())
 	amountGivenStr := strings.TrimSpace(r.Get("amount_given").String())
+	lotNumberStr := strings.TrimSpace(r.Get("lot_number").String())
 	dateTimeStr := strings.TrimSpace(r.Get("date_time").String())
 	staffIDStr := strings.TrimSpace(r.Get("staff_id").String())
 
@@ -129,6 +151,11 @@ func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 		}
 	}
 
+	var lotNumber *string
+	if lotNumberStr != "" {
+		lotNumber = &lotNumberStr
+	}
+
 	var dateTime sql.NullTime
 	if dateTimeStr != "" {
 		if parsedDateTime, err := time.Parse("2006-01-02T15:04", dateTimeStr); err == nil {
@@ -149,12 +176,14 @@ func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
+	target := middleware.BasePath() + "/management/feeding-records"
 	if len(errs) == 0 {
 		userIDStr := strconv.FormatInt(user.ID, 10)
 		feedingRecord := &domain.FeedingRecord{
 			FlockID:     flockID,
 			FeedTypeID:  feedTypeID,
 			AmountGiven: amountGiven,
+			LotNumber:   lotNumber,
 			DateTime:    dateTime,
 			StaffID:     staffID,
 			Audit: domain.AuditFields{
@@ -163,10 +192,12 @@ func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 			},
 		}
 
-		_, err := frm.FeedingRecordRepo.Create(r.GetCtx(), feedingRecord)
+		id, err := frm.FeedingRecordRepo.Create(r.GetCtx(), feedingRecord)
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "create feeding record: %v", err)
 			errs["form"] = "Failed to create feeding record"
+		} else if next := completeRecordTask(r, frm.TaskRepo, domain.TaskKindFeeding, id); next != "" {
+			target = next
 		}
 	}
 
@@ -186,14 +217,14 @@ func (frm *FeedingRecordManager) FeedingRecordPost(r *ghttp.Request) {
 
 	if isDataStarRequest {
 		// For DataStar requests, redirect via JavaScript
-		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/feeding-records")
+		js := fmt.Sprintf("window.location.href = %q;", target)
 		r.Response.Header().Set("Content-Type", "text/javascript")
 		r.Response.Write([]byte(js))
 		return
 	}
 
-	// For regular requests, redirect to the list
-	r.Response.RedirectTo(middleware.BasePath() + "/management/feeding-records")
+	// For regular requests, redirect to the list or back to the checklist
+	r.Response.RedirectTo(target)
 }
 
 // FeedingRecordGet renders a specific feeding record for editing or a new feeding record form.
@@ -252,6 +283,12 @@ func (frm *FeedingRecordManager) FeedingRecordGet(r *ghttp.Request) {
 		return
 	}
 
+	// A new record opened from a checklist task starts from the task.
+	var task *domain.Task
+	if feedingRecord == nil {
+		task = recordFormTask(r, frm.TaskRepo, domain.TaskKindFeeding)
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -260,6 +297,7 @@ func (frm *FeedingRecordManager) FeedingRecordGet(r *ghttp.Request) {
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
 				feedingRecord,
+				task,
 				flocks,
 				feedTypes,
 				staff,
@@ -276,6 +314,7 @@ func (frm *FeedingRecordManager) FeedingRecordGet(r *ghttp.Request) {
 			user.Username,
 			ThemeToString(user.Theme),
 			feedingRecord,
+			task,
 			flocks,
 			feedTypes,
 			staff,
@@ -301,6 +340,7 @@ func (frm *FeedingRecordManager) FeedingRecordPut(r *ghttp.Request) {
 	flockIDStr := strings.TrimSpace(r.Get("flock_id").String())
 	feedTypeIDStr := strings.TrimSpace(r.Get("feed_type_id").String())
 	amountGivenStr := strings.TrimSpace(r.Get("amount_given").String())
+	lotNumberStr := strings.TrimSpace(r.Get("lot_number").String())
 	dateTimeStr := strings.TrimSpace(r.Get("date_time").String())
 	staffIDStr := strings.TrimSpace(r.Get("staff_id").String())
 
@@ -339,6 +379,11 @@ func (frm *FeedingRecordManager) FeedingRecordPut(r *ghttp.Request) {
 		}
 	}
 
+	var lotNumber *string
+	if lotNumberStr != "" {
+		lotNumber = &lotNumberStr
+	}
+
 	var dateTime sql.NullTime
 	if dateTimeStr != "" {
 		if parsedDateTime, err := time.Parse("2006-01-02T15:04", dateTimeStr); err == nil {
@@ -366,14 +411,23 @@ func (frm *FeedingRecordManager) FeedingRecordPut(r *ghttp.Request) {
 			FlockID:         flockID,
 			FeedTypeID:      feedTypeID,
 			AmountGiven:     amountGiven,
+			LotNumber:       lotNumber,
 			DateTime:        dateTime,
 			StaffID:         staffID,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := frm.FeedingRecordRepo.Update(r.GetCtx(), feedingRecord)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := frm.FeedingRecordRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/feeding-records/%d", middleware.BasePath(), id)
+				writeConflict(r, "Feeding Record", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update feeding record: %v", err)
 			errs["form"] = "Failed to update feeding record"
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -18,18 +22,21 @@ type FlockManager struct {
 	FlockRepo    data.FlockRepo
 	BarnRepo     data.BarnRepo
 	FeedTypeRepo data.FeedTypeRepo
+	Events       *events.Bus
 }
 
 // RegisterFlockRoutes wires flock management endpoints under /app.
-func RegisterFlockRoutes(group *ghttp.RouterGroup, flockRepo data.FlockRepo, barnRepo data.BarnRepo, feedTypeRepo data.FeedTypeRepo) {
+func RegisterFlockRoutes(group *ghttp.RouterGroup, flockRepo data.FlockRepo, barnRepo data.BarnRepo, feedTypeRepo data.FeedTypeRepo, bus *events.Bus) {
 	fm := &FlockManager{
 		FlockRepo:    flockRepo,
 		BarnRepo:     barnRepo,
 		FeedTypeRepo: feedTypeRepo,
+		Events:       bus,
 	}
 
 	// Flock management
 	group.GET("/management/flocks", fm.FlocksGet)
+	group.GET("/management/flocks/stream", fm.FlocksStream)
 	group.POST("/management/flocks", fm.FlockPost)
 	group.GET("/management/flocks/new", fm.FlockGet)
 	group.GET("/management/flocks/:id", fm.FlockGet)
@@ -77,6 +84,18 @@ func (fm *FlockManager) FlocksGet(r *ghttp.Request) {
 	)
 }
 
+// FlocksStream keeps the flock list up to date over server-sent events.
+func (fm *FlockManager) FlocksStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, fm.Events, func(ctx context.Context) (templ.Component, error) {
+		flocks, err := fm.FlockRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.FlocksList(basePath, csrf, flocks), nil
+	}, "flocks", "barns", "feed_types")
+}
+
 // FlockPost creates a new flock.
 func (fm *FlockManager) FlockPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -92,6 +111,7 @@ func (fm *FlockManager) FlockPost(r *ghttp.Request) {
 	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
 	healthStatus := strings.TrimSpace(r.Get("health_status").String())
 	feedTypeIDStr := strings.TrimSpace(r.Get("feed_type_id").String())
+	dailyFeedKgStr := strings.TrimSpace(r.Get("daily_feed_kg").String())
 	notes := strings.TrimSpace(r.Get("notes").String())
 
 	errs := map[string]string{}
@@ -149,6 +169,16 @@ func (fm *FlockManager) FlockPost(r *ghttp.Request) {
 		}
 	}
 
+	var dailyFeedKg *float64
+	if dailyFeedKgStr != "" {
+		if kgVal, err := strconv.ParseFloat(dailyFeedKgStr, 64); err == nil && kgVal >= 0 {
+			dailyFeedKg = new(float64)
+			*dailyFeedKg = kgVal
+		} else {
+			errs["daily_feed_kg"] = "Daily ration must be a number of zero or more"
+		}
+	}
+
 	var notesPtr *string
 	if notes != "" {
 		notesPtr = &notes
@@ -166,6 +196,7 @@ func (fm *FlockManager) FlockPost(r *ghttp.Request) {
 			BarnID:        barnID,
 			HealthStatus:  healthStat,
 			FeedTypeID:    feedTypeID,
+			DailyFeedKg:   dailyFeedKg,
 			Notes:         notesPtr,
 			Audit: domain.AuditFields{
 				CreatedBy: &userIDStr,
@@ -306,6 +337,7 @@ func (fm *FlockManager) FlockPut(r *ghttp.Request) {
 	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
 	healthStatus := strings.TrimSpace(r.Get("health_status").String())
 	feedTypeIDStr := strings.TrimSpace(r.Get("feed_type_id").String())
+	dailyFeedKgStr := strings.TrimSpace(r.Get("daily_feed_kg").String())
 	notes := strings.TrimSpace(r.Get("notes").String())
 
 	errs := map[string]string{}
@@ -363,6 +395,16 @@ func (fm *FlockManager) FlockPut(r *ghttp.Request) {
 		}
 	}
 
+	var dailyFeedKg *float64
+	if dailyFeedKgStr != "" {
+		if kgVal, err := strconv.ParseFloat(dailyFeedKgStr, 64); err == nil && kgVal >= 0 {
+			dailyFeedKg = new(float64)
+			*dailyFeedKg = kgVal
+		} else {
+			errs["daily_feed_kg"] = "Daily ration must be a number of zero or more"
+		}
+	}
+
 	var notesPtr *string
 	if notes != "" {
 		notesPtr = &notes
@@ -381,13 +423,22 @@ func (fm *FlockManager) FlockPut(r *ghttp.Request) {
 			BarnID:        barnID,
 			HealthStatus:  healthStat,
 			FeedTypeID:    feedTypeID,
+			DailyFeedKg:   dailyFeedKg,
 			Notes:         notesPtr,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := fm.FlockRepo.Update(r.GetCtx(), flock)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := fm.FlockRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/flocks/%d", middleware.BasePath(), id)
+				writeConflict(r, "Flock", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update flock: %v", err)
 			errs["form"] = "Failed to update flock"
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -18,18 +22,23 @@ type HealthCheckManager struct {
 	HealthCheckRepo data.HealthCheckRepo
 	FlockRepo       data.FlockRepo
 	StaffRepo       data.StaffRepo
+	TaskRepo        data.TaskRepo
+	Events          *events.Bus
 }
 
 // RegisterHealthCheckRoutes wires health check management endpoints under /app.
-func RegisterHealthCheckRoutes(group *ghttp.RouterGroup, healthCheckRepo data.HealthCheckRepo, flockRepo data.FlockRepo, staffRepo data.StaffRepo) {
+func RegisterHealthCheckRoutes(group *ghttp.RouterGroup, healthCheckRepo data.HealthCheckRepo, flockRepo data.FlockRepo, staffRepo data.StaffRepo, taskRepo data.TaskRepo, bus *events.Bus) {
 	hcm := &HealthCheckManager{
 		HealthCheckRepo: healthCheckRepo,
 		FlockRepo:       flockRepo,
 		StaffRepo:       staffRepo,
+		TaskRepo:        taskRepo,
+		Events:          bus,
 	}
 
 	// Health check management
 	group.GET("/management/health-checks", hcm.HealthChecksGet)
+	group.GET("/management/health-checks/stream", hcm.HealthChecksStream)
 	group.POST("/management/health-checks", hcm.HealthCheckPost)
 	group.GET("/management/health-checks/new", hcm.HealthCheckGet)
 	group.GET("/management/health-checks/:id", hcm.HealthCheckGet)
@@ -77,6 +86,18 @@ func (hcm *HealthCheckManager) HealthChecksGet(r *ghttp.Request) {
 	)
 }
 
+// HealthChecksStream keeps the health check list up to date over server-sent events.
+func (hcm *HealthCheckManager) HealthChecksStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, hcm.Events, func(ctx context.Context) (templ.Component, error) {
+		healthChecks, err := hcm.HealthCheckRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.HealthChecksList(basePath, csrf, healthChecks), nil
+	}, "health_checks")
+}
+
 // HealthCheckPost creates a new health check.
 func (hcm *HealthCheckManager) HealthCheckPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -147,6 +168,7 @@ func (hcm *HealthCheckManager) HealthCheckPost(r *ghttp.Request) {
 
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
+	target := middleware.BasePath() + "/management/health-checks"
 	if len(errs) == 0 {
 		userIDStr := strconv.FormatInt(user.ID, 10)
 		healthCheck := &domain.HealthCheck{
@@ -163,10 +185,12 @@ func (hcm *HealthCheckManager) HealthCheckPost(r *ghttp.Request) {
 			},
 		}
 
-		_, err := hcm.HealthCheckRepo.Create(r.GetCtx(), healthCheck)
+		id, err := hcm.HealthCheckRepo.Create(r.GetCtx(), healthCheck)
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "create health check: %v", err)
 			errs["form"] = "Failed to create health check"
+		} else if next := completeRecordTask(r, hcm.TaskRepo, domain.TaskKindHealthCheck, id); next != "" {
+			target = next
 		}
 	}
 
@@ -186,14 +210,14 @@ func (hcm *HealthCheckManager) HealthCheckPost(r *ghttp.Request) {
 
 	if isDataStarRequest {
 		// For DataStar requests, redirect via JavaScript
-		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/health-checks")
+		js := fmt.Sprintf("window.location.href = %q;", target)
 		r.Response.Header().Set("Content-Type", "text/javascript")
 		r.Response.Write([]byte(js))
 		return
 	}
 
-	// For regular requests, redirect to the list
-	r.Response.RedirectTo(middleware.BasePath() + "/management/health-checks")
+	// For regular requests, redirect to the list or back to the checklist
+	r.Response.RedirectTo(target)
 }
 
 // HealthCheckGet renders a specific health check for editing or a new health check form.
@@ -245,6 +269,12 @@ func (hcm *HealthCheckManager) HealthCheckGet(r *ghttp.Request) {
 		return
 	}
 
+	// A new record opened from a checklist task starts from the task.
+	var task *domain.Task
+	if healthCheck == nil {
+		task = recordFormTask(r, hcm.TaskRepo, domain.TaskKindHealthCheck)
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -253,6 +283,7 @@ func (hcm *HealthCheckManager) HealthCheckGet(r *ghttp.Request) {
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
 				healthCheck,
+				task,
 				flocks,
 				staff,
 			),
@@ -268,6 +299,7 @@ func (hcm *HealthCheckManager) HealthCheckGet(r *ghttp.Request) {
 			user.Username,
 			ThemeToString(user.Theme),
 			healthCheck,
+			task,
 			flocks,
 			staff,
 		),
@@ -364,10 +396,18 @@ func (hcm *HealthCheckManager) HealthCheckPut(r *ghttp.Request) {
 			StaffID:                staffID,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := hcm.HealthCheckRepo.Update(r.GetCtx(), healthCheck)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := hcm.HealthCheckRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/health-checks/%d", middleware.BasePath(), id)
+				writeConflict(r, "Health Check", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update health check: %v", err)
 			errs["form"] = "Failed to update health check"
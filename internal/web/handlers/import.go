@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/sheet"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// maxImportFileSize is the largest spreadsheet an import accepts.
+const maxImportFileSize = 5 << 20
+
+type ImportManager struct {
+	ImportRepo          data.ImportRepo
+	FeedingRecordRepo   data.FeedingRecordRepo
+	MortalityRecordRepo data.MortalityRecordRepo
+	OrderRepo           data.OrderRepo
+	Tx                  *data.UnitOfWork
+}
+
+// RegisterImportRoutes wires the spreadsheet import wizard under /app: upload a sheet, map its
+// columns, check the dry run and commit the accepted rows.
+func RegisterImportRoutes(group *ghttp.RouterGroup, importRepo data.ImportRepo, feedingRecordRepo data.FeedingRecordRepo, mortalityRecordRepo data.MortalityRecordRepo, orderRepo data.OrderRepo, tx *data.UnitOfWork) {
+	im := &ImportManager{
+		ImportRepo:          importRepo,
+		FeedingRecordRepo:   feedingRecordRepo,
+		MortalityRecordRepo: mortalityRecordRepo,
+		OrderRepo:           orderRepo,
+		Tx:                  tx,
+	}
+
+	group.GET("/management/import", im.ImportsGet)
+	group.GET("/management/import/:entity", im.UploadGet)
+	group.POST("/management/import/:entity", im.UploadPost)
+	group.DELETE("/management/import/:entity/mappings/:mapping_id", im.MappingDelete)
+	group.GET("/management/import/:entity/:upload_id", im.MapGet)
+	group.POST("/management/import/:entity/:upload_id/commit", im.CommitPost)
+}
+
+// ImportsGet renders what can be imported and the farm's latest uploads.
+func (im *ImportManager) ImportsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !importAccess(r) {
+		return
+	}
+
+	uploads, err := im.ImportRepo.ListUploads(r.GetCtx(), 20)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list import uploads: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.ImportsContent(middleware.BasePath(), uploads))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ImportsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			uploads,
+		),
+	)
+}
+
+// UploadGet renders the upload step of an entity's import with its saved mappings.
+func (im *ImportManager) UploadGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	wizard, ok := im.wizard(r)
+	if !ok {
+		return
+	}
+	im.renderUpload(r, wizard)
+}
+
+// UploadPost reads the uploaded CSV or XLSX file and keeps it for mapping.
+func (im *ImportManager) UploadPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	wizard, ok := im.wizard(r)
+	if !ok {
+		return
+	}
+
+	s, filename, err := readUploadedSheet(r)
+	if err != nil {
+		wizard.Errors["file"] = err.Error()
+		im.renderUpload(r, wizard)
+		return
+	}
+
+	upload := &domain.ImportUpload{Entity: wizard.Entity, Filename: filename, Header: s.Header}
+	for _, row := range s.Rows {
+		upload.Rows = append(upload.Rows, domain.ImportSheetRow{Line: row.Line, Cells: row.Cells})
+	}
+	id, err := im.ImportRepo.CreateUpload(r.GetCtx(), upload)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "create import upload: %v", err)
+		wizard.Errors["form"] = "Failed to keep the upload"
+		im.renderUpload(r, wizard)
+		return
+	}
+
+	target := importURL(wizard.Entity) + "/" + strconv.FormatInt(id, 10)
+	if mappingID := r.Get("mapping_id").String(); mappingID != "" {
+		target += "?mapping_id=" + mappingID
+	}
+	r.Response.RedirectTo(middleware.BasePath() + target)
+}
+
+// readUploadedSheet reads the file of the upload form.
+func readUploadedSheet(r *ghttp.Request) (*sheet.Sheet, string, error) {
+	file := r.GetUploadFile("file")
+	if file == nil {
+		return nil, "", errors.New("choose a file to upload")
+	}
+	if file.Size > maxImportFileSize {
+		return nil, "", errors.New("the file is larger than 5 MB; split it up")
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	body, err := io.ReadAll(io.LimitReader(f, maxImportFileSize))
+	if err != nil {
+		return nil, "", err
+	}
+	s, err := sheet.Read(file.Filename, body)
+	return s, file.Filename, err
+}
+
+// MapGet renders the column mapping of an upload, taken from the query, a saved mapping or a
+// guess from the headings, with the dry run once every required field has a column.
+func (im *ImportManager) MapGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	wizard, ok := im.wizardUpload(r)
+	if !ok {
+		return
+	}
+
+	switch {
+	case r.Get("mapped").String() != "":
+		wizard.Mapping = mappingFromRequest(r, wizard.Entity)
+	case r.Get("mapping_id").String() != "":
+		id, err := strconv.ParseInt(r.Get("mapping_id").String(), 10, 64)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid mapping ID")
+			return
+		}
+		saved, err := im.ImportRepo.FindMapping(r.GetCtx(), id)
+		if err != nil || saved.Entity != wizard.Entity {
+			if err != nil && err != data.ErrNotFound {
+				g.Log().Errorf(r.GetCtx(), "find import mapping: %v", err)
+			}
+			r.Response.WriteStatusExit(404, "Mapping not found")
+			return
+		}
+		wizard.MappingID = saved.MappingID
+		wizard.MappingName = saved.Name
+		wizard.Mapping = saved.Columns
+	default:
+		wizard.Mapping = domain.GuessImportMapping(wizard.Entity, wizard.Upload.Header)
+	}
+
+	if !im.dryRun(r, wizard) {
+		return
+	}
+	im.renderMap(r, wizard)
+}
+
+// CommitPost imports the accepted rows of the dry run in one transaction, saving the mapping
+// under a name when one is given. Nothing is imported when the dry run fails or has no
+// accepted rows.
+func (im *ImportManager) CommitPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	wizard, ok := im.wizardUpload(r)
+	if !ok {
+		return
+	}
+	wizard.Mapping = mappingFromRequest(r, wizard.Entity)
+	wizard.MappingName = r.Get("mapping_name").String()
+	if !im.dryRun(r, wizard) {
+		return
+	}
+	switch {
+	case wizard.Upload.CommittedAt != nil:
+		wizard.Errors["form"] = domain.ErrImportCommitted.Error()
+	case wizard.Batch == nil:
+		wizard.Errors["form"] = "Map a column to every required field first"
+	case wizard.Batch.Accepted() == 0:
+		wizard.Errors["form"] = "No row can be imported"
+	}
+	if len(wizard.Errors) > 0 {
+		im.renderMap(r, wizard)
+		return
+	}
+
+	batch := wizard.Batch
+	err := im.Tx.Do(r.GetCtx(), func(ctx context.Context) error {
+		if err := im.ImportRepo.MarkCommitted(ctx, wizard.Upload.UploadID, batch.Accepted()); err != nil {
+			return err
+		}
+		for _, rec := range batch.Feeding {
+			if _, err := im.FeedingRecordRepo.Create(ctx, rec); err != nil {
+				return err
+			}
+		}
+		for _, rec := range batch.Mortality {
+			if _, err := im.MortalityRecordRepo.Create(ctx, rec); err != nil {
+				return err
+			}
+		}
+		for _, sale := range batch.Sales {
+			id, err := im.OrderRepo.Place(ctx, sale.Order, sale.Lines)
+			if err != nil {
+				return err
+			}
+			if err := im.ImportRepo.RecordImportedOrder(ctx, id, sale.Order.Status, wizard.Upload.Filename); err != nil {
+				return err
+			}
+		}
+		if wizard.MappingName == "" {
+			return nil
+		}
+		return im.ImportRepo.SaveMapping(ctx, &domain.SavedImportMapping{
+			Entity:  wizard.Entity,
+			Name:    wizard.MappingName,
+			Columns: wizard.Mapping,
+		})
+	})
+	switch {
+	case errors.Is(err, domain.ErrImportCommitted):
+		wizard.Errors["form"] = err.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "commit import upload %d: %v", wizard.Upload.UploadID, err)
+		wizard.Errors["form"] = "Failed to import the rows; nothing was imported"
+	}
+	if len(wizard.Errors) > 0 {
+		im.renderMap(r, wizard)
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + importURL(wizard.Entity) + "/" + strconv.FormatInt(wizard.Upload.UploadID, 10))
+}
+
+// MappingDelete deletes a saved mapping and reloads the upload step.
+func (im *ImportManager) MappingDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	wizard, ok := im.wizard(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	id, err := strconv.ParseInt(r.Get("mapping_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid mapping ID")
+		return
+	}
+	if err := im.ImportRepo.DeleteMapping(r.GetCtx(), id); err != nil && err != data.ErrNotFound {
+		g.Log().Errorf(r.GetCtx(), "delete import mapping: %v", err)
+		errs["form"] = "Failed to delete the mapping"
+	}
+
+	writeResult(r, middleware.BasePath()+importURL(wizard.Entity), errs)
+}
+
+// wizard starts the wizard state of the entity in the path with its saved mappings, writing the
+// error response when the entity is unknown or the user may not import.
+func (im *ImportManager) wizard(r *ghttp.Request) (*pages.ImportWizard, bool) {
+	if !importAccess(r) {
+		return nil, false
+	}
+	entity, ok := domain.ParseImportEntity(r.Get("entity").String())
+	if !ok {
+		r.Response.WriteStatusExit(404, "Nothing to import by that name")
+		return nil, false
+	}
+	mappings, err := im.ImportRepo.ListMappings(r.GetCtx(), entity)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list import mappings: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return &pages.ImportWizard{Entity: entity, Mappings: mappings, Errors: map[string]string{}}, true
+}
+
+// wizardUpload is wizard with the upload in the path.
+func (im *ImportManager) wizardUpload(r *ghttp.Request) (*pages.ImportWizard, bool) {
+	wizard, ok := im.wizard(r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(r.Get("upload_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid upload ID")
+		return nil, false
+	}
+	upload, err := im.ImportRepo.FindUpload(r.GetCtx(), id)
+	if err != nil || upload.Entity != wizard.Entity {
+		if err != nil && err != data.ErrNotFound {
+			g.Log().Errorf(r.GetCtx(), "find import upload: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return nil, false
+		}
+		r.Response.WriteStatusExit(404, "Upload not found")
+		return nil, false
+	}
+	wizard.Upload = upload
+	return wizard, true
+}
+
+// dryRun checks the wizard's mapping and, when it holds, builds the batch of the upload against
+// the farm's records. It writes the error response when the records cannot be read.
+func (im *ImportManager) dryRun(r *ghttp.Request, wizard *pages.ImportWizard) bool {
+	for key, msg := range wizard.Mapping.Validate(wizard.Entity, wizard.Upload.Header) {
+		wizard.Errors[key] = msg
+	}
+	if len(wizard.Errors) > 0 || wizard.Upload.CommittedAt != nil {
+		return true
+	}
+	lookups, err := im.ImportRepo.Lookups(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "import lookups: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return false
+	}
+	wizard.Batch = wizard.Upload.Build(wizard.Mapping, lookups)
+	return true
+}
+
+func (im *ImportManager) renderUpload(r *ghttp.Request, wizard *pages.ImportWizard) {
+	user, _ := middleware.CurrentUser(r)
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.ImportUploadContent(middleware.BasePath(), middleware.CsrfToken(r), wizard))
+		return
+	}
+	_ = middleware.TemplRender(
+		r,
+		pages.ImportUploadPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			wizard,
+		),
+	)
+}
+
+func (im *ImportManager) renderMap(r *ghttp.Request, wizard *pages.ImportWizard) {
+	user, _ := middleware.CurrentUser(r)
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.ImportMapContent(middleware.BasePath(), middleware.CsrfToken(r), wizard))
+		return
+	}
+	_ = middleware.TemplRender(
+		r,
+		pages.ImportMapPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			wizard,
+		),
+	)
+}
+
+// importAccess reports whether the user manages the active farm, writing the error response
+// when they do not.
+func importAccess(r *ghttp.Request) bool {
+	if !models.FarmAccessFrom(r.GetCtx()).Can(domain.FarmRoleManager) {
+		r.Response.WriteStatusExit(403, "Forbidden: imports are for farm managers and owners")
+		return false
+	}
+	return true
+}
+
+// mappingFromRequest reads the column chosen for each field of the entity from the mapping form.
+func mappingFromRequest(r *ghttp.Request, entity domain.ImportEntity) domain.ImportMapping {
+	m := domain.ImportMapping{}
+	for _, f := range entity.Fields() {
+		if heading := r.Get("col_" + f.Key).String(); heading != "" {
+			m[f.Key] = heading
+		}
+	}
+	return m
+}
+
+// importURL returns the path of an entity's import below the base path.
+func importURL(entity domain.ImportEntity) string {
+	return "/management/import/" + string(entity)
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -16,16 +20,19 @@ import (
 
 type InventoryItemManager struct {
 	InventoryItemRepo data.InventoryItemRepo
+	Events            *events.Bus
 }
 
 // RegisterInventoryItemRoutes wires inventory item management endpoints under /app.
-func RegisterInventoryItemRoutes(group *ghttp.RouterGroup, inventoryItemRepo data.InventoryItemRepo) {
+func RegisterInventoryItemRoutes(group *ghttp.RouterGroup, inventoryItemRepo data.InventoryItemRepo, bus *events.Bus) {
 	iim := &InventoryItemManager{
 		InventoryItemRepo: inventoryItemRepo,
+		Events:            bus,
 	}
 
 	// InventoryItem management
 	group.GET("/management/inventory-items", iim.InventoryItemsGet)
+	group.GET("/management/inventory-items/stream", iim.InventoryItemsStream)
 	group.POST("/management/inventory-items", iim.InventoryItemPost)
 	group.GET("/management/inventory-items/new", iim.InventoryItemGet)
 	group.GET("/management/inventory-items/:id", iim.InventoryItemGet)
@@ -73,6 +80,18 @@ func (iim *InventoryItemManager) InventoryItemsGet(r *ghttp.Request) {
 	)
 }
 
+// InventoryItemsStream keeps the inventory list up to date over server-sent events.
+func (iim *InventoryItemManager) InventoryItemsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, iim.Events, func(ctx context.Context) (templ.Component, error) {
+		inventoryItems, err := iim.InventoryItemRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.InventoryItemsList(basePath, csrf, inventoryItems), nil
+	}, "inventory_items")
+}
+
 // InventoryItemPost creates a new inventory item.
 func (iim *InventoryItemManager) InventoryItemPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -85,6 +104,7 @@ func (iim *InventoryItemManager) InventoryItemPost(r *ghttp.Request) {
 	itemType := strings.TrimSpace(r.Get("type").String())
 	quantityStr := strings.TrimSpace(r.Get("quantity").String())
 	unit := strings.TrimSpace(r.Get("unit").String())
+	reorderLevelStr := strings.TrimSpace(r.Get("reorder_level").String())
 	expirationDateStr := strings.TrimSpace(r.Get("expiration_date").String())
 	supplierInfo := strings.TrimSpace(r.Get("supplier_info").String())
 	notes := strings.TrimSpace(r.Get("notes").String())
@@ -110,6 +130,16 @@ func (iim *InventoryItemManager) InventoryItemPost(r *ghttp.Request) {
 		}
 	}
 
+	var reorderLevel *float64
+	if reorderLevelStr != "" {
+		if level, err := strconv.ParseFloat(reorderLevelStr, 64); err == nil && level >= 0 {
+			reorderLevel = new(float64)
+			*reorderLevel = level
+		} else {
+			errs["reorder_level"] = "Reorder level must be a number of zero or more"
+		}
+	}
+
 	var unitPtr *string
 	if unit != "" {
 		unitPtr = new(string)
@@ -150,6 +180,7 @@ func (iim *InventoryItemManager) InventoryItemPost(r *ghttp.Request) {
 			Name:           name,
 			Type:           typePtr,
 			Quantity:       quantity,
+			ReorderLevel:   reorderLevel,
 			Unit:           unitPtr,
 			ExpirationDate: expirationDate,
 			SupplierInfo:   supplierPtr,
@@ -271,6 +302,7 @@ func (iim *InventoryItemManager) InventoryItemPut(r *ghttp.Request) {
 	itemType := strings.TrimSpace(r.Get("type").String())
 	quantityStr := strings.TrimSpace(r.Get("quantity").String())
 	unit := strings.TrimSpace(r.Get("unit").String())
+	reorderLevelStr := strings.TrimSpace(r.Get("reorder_level").String())
 	expirationDateStr := strings.TrimSpace(r.Get("expiration_date").String())
 	supplierInfo := strings.TrimSpace(r.Get("supplier_info").String())
 	notes := strings.TrimSpace(r.Get("notes").String())
@@ -296,6 +328,16 @@ func (iim *InventoryItemManager) InventoryItemPut(r *ghttp.Request) {
 		}
 	}
 
+	var reorderLevel *float64
+	if reorderLevelStr != "" {
+		if level, err := strconv.ParseFloat(reorderLevelStr, 64); err == nil && level >= 0 {
+			reorderLevel = new(float64)
+			*reorderLevel = level
+		} else {
+			errs["reorder_level"] = "Reorder level must be a number of zero or more"
+		}
+	}
+
 	var unitPtr *string
 	if unit != "" {
 		unitPtr = new(string)
@@ -335,16 +377,25 @@ func (iim *InventoryItemManager) InventoryItemPut(r *ghttp.Request) {
 			Name:            name,
 			Type:            typePtr,
 			Quantity:        quantity,
+			ReorderLevel:    reorderLevel,
 			Unit:            unitPtr,
 			ExpirationDate:  expirationDate,
 			SupplierInfo:    supplierPtr,
 			Notes:           notesPtr,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := iim.InventoryItemRepo.Update(r.GetCtx(), inventoryItem)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := iim.InventoryItemRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/inventory-items/%d", middleware.BasePath(), id)
+				writeConflict(r, "Inventory Item", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update inventory item: %v", err)
 			errs["form"] = "Failed to update inventory item"
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/pdf"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type InvoiceManager struct {
+	InvoiceRepo   data.InvoiceRepo
+	OrderRepo     data.OrderRepo
+	OrderItemRepo data.OrderItemRepo
+	CustomerRepo  data.CustomerRepo
+	PaymentRepo   data.PaymentRepo
+	Tx            *data.UnitOfWork
+}
+
+// RegisterInvoiceRoutes wires invoicing endpoints under /app.
+func RegisterInvoiceRoutes(group *ghttp.RouterGroup, invoiceRepo data.InvoiceRepo, orderRepo data.OrderRepo, orderItemRepo data.OrderItemRepo, customerRepo data.CustomerRepo, paymentRepo data.PaymentRepo, tx *data.UnitOfWork) {
+	im := &InvoiceManager{
+		InvoiceRepo:   invoiceRepo,
+		OrderRepo:     orderRepo,
+		OrderItemRepo: orderItemRepo,
+		CustomerRepo:  customerRepo,
+		PaymentRepo:   paymentRepo,
+		Tx:            tx,
+	}
+
+	group.GET("/management/invoices", im.InvoicesGet)
+	group.GET("/management/invoices/:id", im.InvoiceGet)
+	group.GET("/management/invoices/:id/pdf", im.InvoicePDFGet)
+	group.POST("/management/invoices/:id/credit-note", im.CreditNotePost)
+	group.POST("/management/orders/:id/invoice", im.OrderInvoicePost)
+}
+
+// InvoicesGet renders the issued invoices and credit notes.
+func (im *InvoiceManager) InvoicesGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	invoices, err := im.InvoiceRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list invoices: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.InvoicesContent(middleware.BasePath(), invoices))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.InvoicesPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			invoices,
+		),
+	)
+}
+
+// InvoiceGet renders an invoice or credit note.
+func (im *InvoiceManager) InvoiceGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	inv, ok := im.findInvoice(r)
+	if !ok {
+		return
+	}
+	creditNote, err := im.InvoiceRepo.CreditNoteFor(r.GetCtx(), inv.InvoiceID)
+	if err != nil && err != data.ErrNotFound {
+		g.Log().Errorf(r.GetCtx(), "find credit note: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	var balance *domain.InvoiceBalance
+	if inv.Kind == domain.InvoiceKindInvoice {
+		balances, err := im.PaymentRepo.InvoiceBalances(r.GetCtx(), inv.CustomerID)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "invoice balances: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		for _, b := range balances {
+			if b.Invoice.InvoiceID == inv.InvoiceID {
+				balance = b
+			}
+		}
+	}
+
+	farm := models.FarmProfileFromEnv()
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.InvoiceContent(middleware.BasePath(), middleware.CsrfToken(r), farm, inv, creditNote, balance))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.InvoicePage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			farm,
+			inv,
+			creditNote,
+			balance,
+		),
+	)
+}
+
+// InvoicePDFGet downloads an invoice or credit note as PDF.
+func (im *InvoiceManager) InvoicePDFGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	inv, ok := im.findInvoice(r)
+	if !ok {
+		return
+	}
+
+	r.Response.Header().Set("Content-Type", "application/pdf")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".pdf"))
+	r.Response.Write(invoicePDF(models.FarmProfileFromEnv(), inv))
+}
+
+// OrderInvoicePost issues the invoice of a delivered order, which moves the order to invoiced.
+func (im *InvoiceManager) OrderInvoicePost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	orderID, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid order ID")
+		return
+	}
+	order, err := im.OrderRepo.FindByID(r.GetCtx(), orderID)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Order not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find order: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if order.Items, err = im.OrderItemRepo.ListByOrder(r.GetCtx(), orderID); err != nil {
+		g.Log().Errorf(r.GetCtx(), "list order lines: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	customer, err := im.CustomerRepo.FindByID(r.GetCtx(), order.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "find customer: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	errs := map[string]string{}
+	farm := models.FarmProfileFromEnv()
+	inv, err := domain.NewInvoiceFromOrder(order, customer, today(), farm.PaymentTermsDays, farm.FiscalYearStart)
+	if err == nil {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		inv.CreatedBy = &userIDStr
+		_, err = im.InvoiceRepo.Issue(r.GetCtx(), inv)
+	}
+	switch {
+	case errors.Is(err, domain.ErrOrderNotDelivered), errors.Is(err, domain.ErrOrderHasNoLines), errors.Is(err, domain.ErrOrderAlreadyInvoiced):
+		errs["form"] = err.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "issue invoice: %v", err)
+		errs["form"] = "Failed to issue invoice"
+	}
+
+	if len(errs) > 0 {
+		writeOrderResult(r, orderID, errs)
+		return
+	}
+	writeResult(r, fmt.Sprintf("%s/management/invoices/%d", middleware.BasePath(), inv.InvoiceID), errs)
+}
+
+// CreditNotePost issues a credit note cancelling an invoice.
+func (im *InvoiceManager) CreditNotePost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	original, ok := im.findInvoice(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	reason := strings.TrimSpace(r.Get("reason").String())
+	if reason == "" {
+		errs["reason"] = "Reason is required"
+	}
+
+	// Looking for an earlier credit note and issuing this one share a transaction, so two
+	// submissions cannot both credit the invoice.
+	var note *domain.Invoice
+	err := im.Tx.Do(r.GetCtx(), func(ctx context.Context) error {
+		if _, err := im.InvoiceRepo.CreditNoteFor(ctx, original.InvoiceID); err == nil {
+			errs["form"] = "This invoice has already been credited"
+		} else if err != data.ErrNotFound {
+			return err
+		}
+		if len(errs) > 0 {
+			return nil
+		}
+
+		farm := models.FarmProfileFromEnv()
+		var err error
+		note, err = domain.NewCreditNote(original, reason, today(), farm.FiscalYearStart)
+		if err != nil {
+			return err
+		}
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		note.CreatedBy = &userIDStr
+		_, err = im.InvoiceRepo.Issue(ctx, note)
+		return err
+	})
+	switch {
+	case errors.Is(err, domain.ErrNotCreditable):
+		errs["reason"] = err.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "issue credit note: %v", err)
+		errs["form"] = "Failed to issue credit note"
+	}
+
+	target := fmt.Sprintf("%s/management/invoices/%d", middleware.BasePath(), original.InvoiceID)
+	if len(errs) == 0 {
+		target = fmt.Sprintf("%s/management/invoices/%d", middleware.BasePath(), note.InvoiceID)
+	}
+	writeResult(r, target, errs)
+}
+
+// findInvoice loads the invoice named by the :id route parameter, answering 400/404/500 itself.
+func (im *InvoiceManager) findInvoice(r *ghttp.Request) (*domain.Invoice, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid invoice ID")
+		return nil, false
+	}
+	inv, err := im.InvoiceRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Invoice not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find invoice: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return inv, true
+}
+
+// today returns the current local date at midnight.
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// invoicePDF lays out an invoice or credit note on the farm letterhead.
+func invoicePDF(farm models.FarmProfile, inv *domain.Invoice) []byte {
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	doc := pdf.New(inv.Kind.Label() + " " + inv.Number)
+	doc.Heading(farm.Name)
+	if farm.Address != "" {
+		doc.Text(farm.Address)
+	}
+	if farm.VATNumber != "" {
+		doc.Text("VAT number: " + farm.VATNumber)
+	}
+	if farm.OrganicCertNumber != "" {
+		cert := "Organic certificate: " + farm.OrganicCertNumber
+		if farm.CertificationBody != "" {
+			cert += " (" + farm.CertificationBody + ")"
+		}
+		doc.Text(cert)
+	}
+
+	doc.Subheading(inv.Kind.Label() + " " + inv.Number)
+	doc.Text("Issue date: " + inv.IssueDate.Format("2006-01-02"))
+	if inv.Kind == domain.InvoiceKindInvoice {
+		doc.Text("Due date: " + inv.DueDate.Format("2006-01-02"))
+	}
+	doc.Text(fmt.Sprintf("Order: #%d", inv.OrderID))
+	if inv.Reason != nil {
+		doc.Text("Reason: " + *inv.Reason)
+	}
+
+	doc.Subheading("Bill to")
+	doc.Text(inv.CustomerName)
+	if inv.CustomerAddress != nil {
+		doc.Text(*inv.CustomerAddress)
+	}
+
+	doc.Subheading("Lines")
+	rows := make([][]string, 0, len(inv.Lines))
+	for _, line := range inv.Lines {
+		qty := strconv.FormatFloat(line.Quantity, 'f', -1, 64)
+		if line.Unit != nil {
+			qty += " " + *line.Unit
+		}
+		rows = append(rows, []string{line.Description, qty, money(line.UnitPrice), money(line.Discount), fmt.Sprintf("%g%%", line.VATRate), money(line.NetAmount)})
+	}
+	doc.Table([]pdf.Column{
+		{Header: "Description", Width: 0.38},
+		{Header: "Qty", Width: 0.12, AlignRight: true},
+		{Header: "Unit price", Width: 0.13, AlignRight: true},
+		{Header: "Discount", Width: 0.12, AlignRight: true},
+		{Header: "VAT", Width: 0.10, AlignRight: true},
+		{Header: "Net", Width: 0.15, AlignRight: true},
+	}, rows)
+
+	doc.Subheading("VAT breakdown")
+	vatRows := [][]string{}
+	for _, bucket := range inv.VATBreakdown() {
+		vatRows = append(vatRows, []string{fmt.Sprintf("%g%%", bucket.Rate), money(bucket.Net), money(bucket.VAT)})
+	}
+	doc.Table([]pdf.Column{
+		{Header: "Rate", Width: 0.4},
+		{Header: "Net", Width: 0.3, AlignRight: true},
+		{Header: "VAT", Width: 0.3, AlignRight: true},
+	}, vatRows)
+
+	doc.Table([]pdf.Column{
+		{Header: "", Width: 0.7},
+		{Header: "", Width: 0.3, AlignRight: true},
+	}, [][]string{
+		{"Subtotal", money(inv.SubtotalAmount)},
+		{"VAT", money(inv.VATAmount)},
+		{"Delivery", money(inv.DeliveryFee)},
+		{"Total", money(inv.TotalAmount)},
+	})
+
+	if inv.Kind == domain.InvoiceKindInvoice && farm.BankAccount != "" {
+		doc.Text(fmt.Sprintf("Please pay %s by %s to %s, quoting %s.", money(inv.TotalAmount), inv.DueDate.Format("2006-01-02"), farm.BankAccount, inv.Number))
+	}
+	return doc.Bytes()
+}
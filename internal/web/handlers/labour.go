@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// timeEntryDays is how many days of time entries the time clock lists.
+const timeEntryDays = 14
+
+type LabourManager struct {
+	LabourRepo data.LabourRepo
+	StaffRepo  data.StaffRepo
+	BarnRepo   data.BarnRepo
+	FlockRepo  data.FlockRepo
+	TaskRepo   data.TaskRepo
+}
+
+// RegisterLabourRoutes wires the time clock, time entry and flock cost endpoints under /app.
+func RegisterLabourRoutes(group *ghttp.RouterGroup, labourRepo data.LabourRepo, staffRepo data.StaffRepo, barnRepo data.BarnRepo, flockRepo data.FlockRepo, taskRepo data.TaskRepo) {
+	lm := &LabourManager{
+		LabourRepo: labourRepo,
+		StaffRepo:  staffRepo,
+		BarnRepo:   barnRepo,
+		FlockRepo:  flockRepo,
+		TaskRepo:   taskRepo,
+	}
+
+	group.GET("/management/time-clock", lm.TimeClockGet)
+	group.POST("/management/time-clock/clock-in", lm.ClockInPost)
+	group.POST("/management/time-clock/clock-out", lm.ClockOutPost)
+	group.POST("/management/time-entries", lm.TimeEntryPost)
+	group.DELETE("/management/time-entries/:entry_id", lm.TimeEntryDelete)
+	group.GET("/management/flock-costs", lm.FlockCostsGet)
+}
+
+// TimeClockGet renders who is clocked in, the forms booking time and the recent time entries.
+// Opened from a checklist through ?task_id= the form logging time is filled in from the task.
+func (lm *LabourManager) TimeClockGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	ctx := r.GetCtx()
+	now := time.Now()
+	clockedIn, err := lm.LabourRepo.ListClockedIn(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list clocked in: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	entries, err := lm.LabourRepo.ListEntries(ctx, today().AddDate(0, 0, -timeEntryDays), now.Add(time.Minute))
+	if err != nil {
+		g.Log().Errorf(ctx, "list time entries: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	staff, err := lm.StaffRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list staff: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	barns, err := lm.BarnRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list barns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	flocks, err := lm.FlockRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list flocks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	page := &pages.TimeClock{
+		Now:       now,
+		Days:      timeEntryDays,
+		ClockedIn: clockedIn,
+		Entries:   entries,
+	}
+	if id, err := strconv.ParseInt(r.Get("task_id").String(), 10, 64); err == nil {
+		if task, err := lm.TaskRepo.FindByID(ctx, id); err == nil {
+			page.Task = task
+		} else if err != data.ErrNotFound {
+			g.Log().Errorf(ctx, "find task: %v", err)
+		}
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.TimeClockContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				page,
+				staff,
+				barns,
+				flocks,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.TimeClockPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			page,
+			staff,
+			barns,
+			flocks,
+		),
+	)
+}
+
+// ClockInPost clocks a staff member in to a barn, and optionally a flock, now.
+func (lm *LabourManager) ClockInPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	entry, errs := lm.parseTimeEntryForm(r)
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		entry.StartedAt = time.Now()
+		entry.Audit = domain.AuditFields{CreatedBy: &userIDStr, UpdatedBy: &userIDStr}
+		if _, err := lm.LabourRepo.ClockIn(r.GetCtx(), entry); err != nil {
+			if err == domain.ErrAlreadyClockedIn {
+				errs["staff_id"] = err.Error()
+			} else {
+				g.Log().Errorf(r.GetCtx(), "clock in: %v", err)
+				errs["form"] = "Failed to clock in"
+			}
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/time-clock", errs)
+}
+
+// ClockOutPost clocks a staff member out now.
+func (lm *LabourManager) ClockOutPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	staffID, err := strconv.ParseInt(r.Get("staff_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid staff ID")
+		return
+	}
+
+	errs := map[string]string{}
+	if err := lm.LabourRepo.ClockOut(r.GetCtx(), staffID, time.Now()); err != nil {
+		switch err {
+		case data.ErrNotFound:
+			errs["staff_id"] = "The staff member is not clocked in"
+		case domain.ErrEntryEndsBeforeStart:
+			errs["staff_id"] = err.Error()
+		default:
+			g.Log().Errorf(r.GetCtx(), "clock out: %v", err)
+			errs["form"] = "Failed to clock out"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/time-clock", errs)
+}
+
+// TimeEntryPost logs time worked after the fact, e.g. how long a checklist task took.
+func (lm *LabourManager) TimeEntryPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	entry, errs := lm.parseTimeEntryForm(r)
+	date := strings.TrimSpace(r.Get("date").String())
+	from := strings.TrimSpace(r.Get("from").String())
+	to := strings.TrimSpace(r.Get("to").String())
+	startedAt, err := time.ParseInLocation("2006-01-02 15:04", date+" "+from, time.Local)
+	if err != nil {
+		errs["from"] = "Give the date and the time the work started"
+	}
+	endedAt, err := time.ParseInLocation("2006-01-02 15:04", date+" "+to, time.Local)
+	if err != nil {
+		errs["to"] = "Give the time the work ended"
+	} else if !endedAt.After(startedAt) {
+		errs["to"] = domain.ErrEntryEndsBeforeStart.Error()
+	}
+	if v := strings.TrimSpace(r.Get("task_id").String()); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs["task_id"] = "Invalid task"
+		}
+		entry.TaskID = &id
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		entry.StartedAt = startedAt
+		entry.EndedAt = &endedAt
+		entry.Audit = domain.AuditFields{CreatedBy: &userIDStr, UpdatedBy: &userIDStr}
+		if _, err := lm.LabourRepo.LogEntry(r.GetCtx(), entry); err != nil {
+			g.Log().Errorf(r.GetCtx(), "log time entry: %v", err)
+			errs["form"] = "Failed to log the time"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/time-clock", errs)
+}
+
+// TimeEntryDelete removes a time entry booked by mistake.
+func (lm *LabourManager) TimeEntryDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("entry_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid time entry ID")
+		return
+	}
+	if err := lm.LabourRepo.DeleteEntry(r.GetCtx(), id, time.Now()); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Time entry not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "delete time entry: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/time-clock", nil)
+}
+
+// FlockCostsGet renders the labour and feed cost of every flock per bird and per kg of meat.
+func (lm *LabourManager) FlockCostsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	costs, unallocated, err := lm.LabourRepo.FlockCosts(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "flock costs: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.FlockCostsContent(
+				middleware.BasePath(),
+				costs,
+				unallocated,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FlockCostsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			costs,
+			unallocated,
+		),
+	)
+}
+
+// parseTimeEntryForm reads who worked where from a time clock form. The barn may be left out
+// when a flock is chosen; it is then the barn the flock is in.
+func (lm *LabourManager) parseTimeEntryForm(r *ghttp.Request) (*domain.TimeEntry, map[string]string) {
+	entry := &domain.TimeEntry{Notes: optionalText(r, "notes")}
+	errs := map[string]string{}
+
+	var err error
+	if entry.StaffID, err = strconv.ParseInt(strings.TrimSpace(r.Get("staff_id").String()), 10, 64); err != nil {
+		errs["staff_id"] = "Staff member is required"
+	}
+	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
+	if barnIDStr != "" {
+		if entry.BarnID, err = strconv.ParseInt(barnIDStr, 10, 64); err != nil {
+			errs["barn_id"] = "Invalid barn"
+		}
+	}
+	if v := strings.TrimSpace(r.Get("flock_id").String()); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			errs["flock_id"] = "Invalid flock"
+			return entry, errs
+		}
+		flock, err := lm.FlockRepo.FindByID(r.GetCtx(), id)
+		if err != nil {
+			if err != data.ErrNotFound {
+				g.Log().Errorf(r.GetCtx(), "find flock: %v", err)
+			}
+			errs["flock_id"] = "Flock not found"
+			return entry, errs
+		}
+		entry.FlockID = &id
+		switch {
+		case flock.BarnID == nil:
+			if barnIDStr == "" {
+				errs["barn_id"] = "The flock is not in a barn; choose the barn worked in"
+			}
+		case barnIDStr == "":
+			entry.BarnID = *flock.BarnID
+		case *flock.BarnID != entry.BarnID:
+			errs["flock_id"] = "The flock is not in this barn"
+		}
+	} else if barnIDStr == "" {
+		errs["barn_id"] = "Barn is required"
+	}
+	return entry, errs
+}
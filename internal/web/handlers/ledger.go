@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type LedgerManager struct {
+	LedgerRepo data.LedgerRepo
+	LabourRepo data.LabourRepo
+	BarnRepo   data.BarnRepo
+	FlockRepo  data.FlockRepo
+}
+
+// RegisterLedgerRoutes wires the cost ledger and flock P&L endpoints under /app.
+func RegisterLedgerRoutes(group *ghttp.RouterGroup, ledgerRepo data.LedgerRepo, labourRepo data.LabourRepo, barnRepo data.BarnRepo, flockRepo data.FlockRepo) {
+	lm := &LedgerManager{
+		LedgerRepo: ledgerRepo,
+		LabourRepo: labourRepo,
+		BarnRepo:   barnRepo,
+		FlockRepo:  flockRepo,
+	}
+
+	group.GET("/management/flock-pnl", lm.FlockPnLGet)
+	group.GET("/management/cost-ledger", lm.CostLedgerGet)
+	group.POST("/management/cost-ledger", lm.CostEntryPost)
+	group.DELETE("/management/cost-ledger/:entry_id", lm.CostEntryDelete)
+}
+
+// FlockPnLGet renders the profit and loss of every flock and the margin per bird per breed.
+func (lm *LedgerManager) FlockPnLGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	ctx := r.GetCtx()
+	costs, _, err := lm.LabourRepo.FlockCosts(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "flock costs: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	entries, err := lm.LedgerRepo.ListEntries(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list cost entries: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	revenue, err := lm.LedgerRepo.FlockRevenue(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "flock revenue: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	pnl, unallocated := domain.BuildFlockPnL(costs, entries, revenue)
+	breeds := domain.SummariseBreeds(pnl)
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.FlockPnLContent(
+				middleware.BasePath(),
+				pnl,
+				breeds,
+				unallocated,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.FlockPnLPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			pnl,
+			breeds,
+			unallocated,
+		),
+	)
+}
+
+// CostLedgerGet renders the cost ledger and the form booking a cost.
+func (lm *LedgerManager) CostLedgerGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	ctx := r.GetCtx()
+	entries, err := lm.LedgerRepo.ListEntries(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list cost entries: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	barns, err := lm.BarnRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list barns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	flocks, err := lm.FlockRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list flocks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.CostLedgerContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				entries,
+				barns,
+				flocks,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.CostLedgerPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			entries,
+			barns,
+			flocks,
+		),
+	)
+}
+
+// CostEntryPost books a cost to a flock, or to a barn to share it over the barn's flocks.
+func (lm *LedgerManager) CostEntryPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	category := domain.CostCategory(r.Get("category").String())
+	flockIDStr := strings.TrimSpace(r.Get("flock_id").String())
+	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
+
+	errs := map[string]string{}
+	if !slices.Contains(domain.LedgerCostCategories, category) {
+		errs["category"] = "Choose what the cost is for"
+	}
+	var flockID, barnID *int64
+	if flockIDStr != "" {
+		id, err := strconv.ParseInt(flockIDStr, 10, 64)
+		if err != nil {
+			errs["flock_id"] = "Invalid flock"
+		}
+		flockID = &id
+	}
+	if barnIDStr != "" && flockID == nil {
+		id, err := strconv.ParseInt(barnIDStr, 10, 64)
+		if err != nil {
+			errs["barn_id"] = "Invalid barn"
+		}
+		barnID = &id
+	}
+	if flockIDStr == "" && barnIDStr == "" {
+		errs["flock_id"] = "Choose the flock, or the barn whose flocks share the cost"
+	}
+	entryDate, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(r.Get("entry_date").String()), time.Local)
+	if err != nil {
+		errs["entry_date"] = "Date is required"
+	}
+	amount, err := strconv.ParseFloat(strings.TrimSpace(r.Get("amount").String()), 64)
+	if err != nil || amount < 0 {
+		errs["amount"] = "Amount must be a number of zero or more"
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		entry := &domain.CostEntry{
+			Category:    category,
+			FlockID:     flockID,
+			BarnID:      barnID,
+			EntryDate:   entryDate,
+			Amount:      amount,
+			Description: optionalText(r, "description"),
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := lm.LedgerRepo.CreateEntry(r.GetCtx(), entry); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create cost entry: %v", err)
+			errs["form"] = "Failed to book the cost"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/cost-ledger", errs)
+}
+
+// CostEntryDelete removes a cost booked by mistake.
+func (lm *LedgerManager) CostEntryDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("entry_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid cost entry ID")
+		return
+	}
+	if err := lm.LedgerRepo.DeleteEntry(r.GetCtx(), id, time.Now()); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Cost entry not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "delete cost entry: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/cost-ledger", nil)
+}
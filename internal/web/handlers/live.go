@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/cr1cr1/farm-manager/internal/events"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// liveDebounce gathers the events of a burst of writes, such as an order and its lines, into a
+// single render.
+const liveDebounce = 200 * time.Millisecond
+
+// liveEntities are the entities whose record pages can follow changes over /live/:entity.
+var liveEntities = map[string]bool{
+	"barns":              true,
+	"customers":          true,
+	"feed_types":         true,
+	"feeding_records":    true,
+	"flocks":             true,
+	"health_checks":      true,
+	"inventory_items":    true,
+	"mortality_records":  true,
+	"orders":             true,
+	"production_batches": true,
+	"products":           true,
+	"slaughter_records":  true,
+	"staff":              true,
+}
+
+// RegisterLiveRoutes wires the change stream of record pages under /app. List pages stream from
+// their own /stream endpoint, which also sends the list.
+func RegisterLiveRoutes(group *ghttp.RouterGroup, bus *events.Bus) {
+	lm := &LiveManager{Bus: bus}
+	group.GET("/live/:entity", lm.LiveGet)
+}
+
+type LiveManager struct {
+	Bus *events.Bus
+}
+
+// LiveGet streams the changed signals of an entity to a record page opened on its own.
+func (lm *LiveManager) LiveGet(r *ghttp.Request) {
+	entity := r.Get("entity").String()
+	if !liveEntities[entity] {
+		r.Response.WriteStatusExit(404, "Not found")
+		return
+	}
+	streamLive(r, lm.Bus, nil, entity)
+}
+
+// streamLive keeps a Datastar event stream open until the page is left. An update or delete of
+// a record of entity sets the record's changed signal, which shows the notice of an open edit
+// form; after any change to entity or the related entities the component built by render, when
+// there is one, is sent again.
+func streamLive(r *ghttp.Request, bus *events.Bus, render func(ctx context.Context) (templ.Component, error), entity string, related ...string) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.WriteStatusExit(401, "Unauthorized")
+		return
+	}
+
+	ctx := r.GetCtx()
+	ch, cancel := bus.Subscribe(append([]string{entity}, related...)...)
+	defer cancel()
+	middleware.SSEStart(r)
+
+	var pending <-chan time.Time
+	changed := map[string]string{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-ch:
+			if e.Entity == entity && e.Action != events.Created {
+				changed[pages.ChangedSignal(e.Entity, e.ID)] = changedNotice(e.Action)
+			}
+			if pending == nil {
+				pending = time.After(liveDebounce)
+			}
+			continue
+		case <-pending:
+			pending = nil
+		}
+
+		if len(changed) > 0 {
+			if err := middleware.SSEPatchSignals(r, map[string]any{"changed": changed}); err != nil {
+				return
+			}
+			changed = map[string]string{}
+		}
+		if render == nil {
+			continue
+		}
+		component, err := render(ctx)
+		if err != nil {
+			g.Log().Errorf(ctx, "render live %s: %v", entity, err)
+			continue
+		}
+		if err := middleware.SSEPatchElements(r, component); err != nil {
+			return
+		}
+	}
+}
+
+// changedNotice is the text of the notice shown on the edit form of a changed record.
+func changedNotice(action events.Action) string {
+	if action == events.Deleted {
+		return "This record has been deleted since you opened it."
+	}
+	return "This record has been changed since you opened it."
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -17,17 +21,22 @@ import (
 type MortalityRecordManager struct {
 	MortalityRecordRepo data.MortalityRecordRepo
 	FlockRepo           data.FlockRepo
+	TaskRepo            data.TaskRepo
+	Events              *events.Bus
 }
 
 // RegisterMortalityRecordRoutes wires mortality record management endpoints under /app.
-func RegisterMortalityRecordRoutes(group *ghttp.RouterGroup, mortalityRecordRepo data.MortalityRecordRepo, flockRepo data.FlockRepo) {
+func RegisterMortalityRecordRoutes(group *ghttp.RouterGroup, mortalityRecordRepo data.MortalityRecordRepo, flockRepo data.FlockRepo, taskRepo data.TaskRepo, bus *events.Bus) {
 	mrm := &MortalityRecordManager{
 		MortalityRecordRepo: mortalityRecordRepo,
 		FlockRepo:           flockRepo,
+		TaskRepo:            taskRepo,
+		Events:              bus,
 	}
 
 	// Mortality record management
 	group.GET("/management/mortality-records", mrm.MortalityRecordsGet)
+	group.GET("/management/mortality-records/stream", mrm.MortalityRecordsStream)
 	group.POST("/management/mortality-records", mrm.MortalityRecordPost)
 	group.GET("/management/mortality-records/new", mrm.MortalityRecordGet)
 	group.GET("/management/mortality-records/:id", mrm.MortalityRecordGet)
@@ -75,6 +84,18 @@ func (mrm *MortalityRecordManager) MortalityRecordsGet(r *ghttp.Request) {
 	)
 }
 
+// MortalityRecordsStream keeps the mortality record list up to date over server-sent events.
+func (mrm *MortalityRecordManager) MortalityRecordsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, mrm.Events, func(ctx context.Context) (templ.Component, error) {
+		mortalityRecords, err := mrm.MortalityRecordRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.MortalityRecordsList(basePath, csrf, mortalityRecords), nil
+	}, "mortality_records")
+}
+
 // MortalityRecordPost creates a new mortality record.
 func (mrm *MortalityRecordManager) MortalityRecordPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -133,6 +154,7 @@ func (mrm *MortalityRecordManager) MortalityRecordPost(r *ghttp.Request) {
 
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
+	target := middleware.BasePath() + "/management/mortality-records"
 	if len(errs) == 0 {
 		userIDStr := strconv.FormatInt(user.ID, 10)
 		mortalityRecord := &domain.MortalityRecord{
@@ -147,10 +169,12 @@ func (mrm *MortalityRecordManager) MortalityRecordPost(r *ghttp.Request) {
 			},
 		}
 
-		_, err := mrm.MortalityRecordRepo.Create(r.GetCtx(), mortalityRecord)
+		id, err := mrm.MortalityRecordRepo.Create(r.GetCtx(), mortalityRecord)
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "create mortality record: %v", err)
 			errs["form"] = "Failed to create mortality record"
+		} else if next := completeRecordTask(r, mrm.TaskRepo, domain.TaskKindMortality, id); next != "" {
+			target = next
 		}
 	}
 
@@ -170,14 +194,14 @@ func (mrm *MortalityRecordManager) MortalityRecordPost(r *ghttp.Request) {
 
 	if isDataStarRequest {
 		// For DataStar requests, redirect via JavaScript
-		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/mortality-records")
+		js := fmt.Sprintf("window.location.href = %q;", target)
 		r.Response.Header().Set("Content-Type", "text/javascript")
 		r.Response.Write([]byte(js))
 		return
 	}
 
-	// For regular requests, redirect to the list
-	r.Response.RedirectTo(middleware.BasePath() + "/management/mortality-records")
+	// For regular requests, redirect to the list or back to the checklist
+	r.Response.RedirectTo(target)
 }
 
 // MortalityRecordGet renders a specific mortality record for editing or a new mortality record form.
@@ -222,6 +246,12 @@ func (mrm *MortalityRecordManager) MortalityRecordGet(r *ghttp.Request) {
 		return
 	}
 
+	// A new record opened from a checklist task starts from the task.
+	var task *domain.Task
+	if mortalityRecord == nil {
+		task = recordFormTask(r, mrm.TaskRepo, domain.TaskKindMortality)
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -230,6 +260,7 @@ func (mrm *MortalityRecordManager) MortalityRecordGet(r *ghttp.Request) {
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
 				mortalityRecord,
+				task,
 				flocks,
 			),
 		)
@@ -243,6 +274,7 @@ func (mrm *MortalityRecordManager) MortalityRecordGet(r *ghttp.Request) {
 			middleware.CsrfToken(r),
 			ThemeToString(user.Theme),
 			mortalityRecord,
+			task,
 			flocks,
 		),
 	)
@@ -324,10 +356,18 @@ func (mrm *MortalityRecordManager) MortalityRecordPut(r *ghttp.Request) {
 			Notes:             notesPtr,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := mrm.MortalityRecordRepo.Update(r.GetCtx(), mortalityRecord)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := mrm.MortalityRecordRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/mortality-records/%d", middleware.BasePath(), id)
+				writeConflict(r, "Mortality Record", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update mortality record: %v", err)
 			errs["form"] = "Failed to update mortality record"
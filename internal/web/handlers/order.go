@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -15,24 +19,44 @@ import (
 )
 
 type OrderManager struct {
-	OrderRepo    data.OrderRepo
-	CustomerRepo data.CustomerRepo
+	OrderRepo           data.OrderRepo
+	OrderItemRepo       data.OrderItemRepo
+	CustomerRepo        data.CustomerRepo
+	ProductRepo         data.ProductRepo
+	PriceListRepo       data.PriceListRepo
+	SlaughterRecordRepo data.SlaughterRecordRepo
+	InvoiceRepo         data.InvoiceRepo
+	Events              *events.Bus
 }
 
-// RegisterOrderRoutes wires order management endpoints under /app.
-func RegisterOrderRoutes(group *ghttp.RouterGroup, orderRepo data.OrderRepo, customerRepo data.CustomerRepo) {
+// RegisterOrderRoutes wires order management endpoints, including the inline order lines, under /app.
+func RegisterOrderRoutes(group *ghttp.RouterGroup, orderRepo data.OrderRepo, orderItemRepo data.OrderItemRepo, customerRepo data.CustomerRepo, productRepo data.ProductRepo, priceListRepo data.PriceListRepo, slaughterRecordRepo data.SlaughterRecordRepo, invoiceRepo data.InvoiceRepo, bus *events.Bus) {
 	om := &OrderManager{
-		OrderRepo:    orderRepo,
-		CustomerRepo: customerRepo,
+		OrderRepo:           orderRepo,
+		OrderItemRepo:       orderItemRepo,
+		CustomerRepo:        customerRepo,
+		ProductRepo:         productRepo,
+		PriceListRepo:       priceListRepo,
+		SlaughterRecordRepo: slaughterRecordRepo,
+		InvoiceRepo:         invoiceRepo,
+		Events:              bus,
 	}
 
 	// Order management
 	group.GET("/management/orders", om.OrdersGet)
+	group.GET("/management/orders/stream", om.OrdersStream)
 	group.POST("/management/orders", om.OrderPost)
 	group.GET("/management/orders/new", om.OrderGet)
 	group.GET("/management/orders/:id", om.OrderGet)
 	group.PUT("/management/orders/:id", om.OrderPut)
 	group.DELETE("/management/orders/:id", om.OrderDelete)
+	group.POST("/management/orders/:id/transitions", om.OrderTransitionPost)
+
+	// Order lines, edited inline on the order page
+	group.GET("/management/orders/:id/lines/price", om.OrderLinePriceGet)
+	group.POST("/management/orders/:id/lines", om.OrderLinePost)
+	group.PUT("/management/orders/:id/lines/:line_id", om.OrderLinePut)
+	group.DELETE("/management/orders/:id/lines/:line_id", om.OrderLineDelete)
 }
 
 // OrdersGet renders the orders management page.
@@ -75,6 +99,18 @@ func (om *OrderManager) OrdersGet(r *ghttp.Request) {
 	)
 }
 
+// OrdersStream keeps the order list up to date over server-sent events.
+func (om *OrderManager) OrdersStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, om.Events, func(ctx context.Context) (templ.Component, error) {
+		orders, err := om.OrderRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.OrdersList(basePath, csrf, orders), nil
+	}, "orders", "customers")
+}
+
 // OrderPost creates a new order.
 func (om *OrderManager) OrderPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -86,8 +122,7 @@ func (om *OrderManager) OrderPost(r *ghttp.Request) {
 	customerIDStr := strings.TrimSpace(r.Get("customer_id").String())
 	orderDateStr := strings.TrimSpace(r.Get("order_date").String())
 	deliveryDateStr := strings.TrimSpace(r.Get("delivery_date").String())
-	totalAmountStr := strings.TrimSpace(r.Get("total_amount").String())
-	status := strings.TrimSpace(r.Get("status").String())
+	deliveryFeeStr := strings.TrimSpace(r.Get("delivery_fee").String())
 
 	errs := map[string]string{}
 	if customerIDStr == "" {
@@ -123,24 +158,18 @@ func (om *OrderManager) OrderPost(r *ghttp.Request) {
 		}
 	}
 
-	var totalAmount *float64
-	if totalAmountStr != "" {
-		if amountVal, err := strconv.ParseFloat(totalAmountStr, 64); err == nil {
-			totalAmount = new(float64)
-			*totalAmount = amountVal
+	var deliveryFee float64
+	if deliveryFeeStr != "" {
+		if feeVal, err := strconv.ParseFloat(deliveryFeeStr, 64); err == nil && feeVal >= 0 {
+			deliveryFee = feeVal
 		} else {
-			errs["total_amount"] = "Total amount must be a valid number"
+			errs["delivery_fee"] = "Delivery fee must be a non-negative number"
 		}
 	}
 
-	var statusPtr *string
-	if status != "" {
-		statusPtr = new(string)
-		*statusPtr = status
-	}
-
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
+	var id int64
 	if len(errs) == 0 {
 		userIDStr := strconv.FormatInt(user.ID, 10)
 		createdBy := new(string)
@@ -151,15 +180,16 @@ func (om *OrderManager) OrderPost(r *ghttp.Request) {
 			CustomerID:   customerID,
 			OrderDate:    orderDate,
 			DeliveryDate: deliveryDate,
-			TotalAmount:  totalAmount,
-			Status:       statusPtr,
+			DeliveryFee:  deliveryFee,
+			Status:       domain.OrderStatusDraft,
 			Audit: domain.AuditFields{
 				CreatedBy: createdBy,
 				UpdatedBy: updatedBy,
 			},
 		}
 
-		_, err := om.OrderRepo.Create(r.GetCtx(), order)
+		var err error
+		id, err = om.OrderRepo.Create(r.GetCtx(), order)
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "create order: %v", err)
 			errs["form"] = "Failed to create order"
@@ -180,16 +210,17 @@ func (om *OrderManager) OrderPost(r *ghttp.Request) {
 		return
 	}
 
+	// Open the new order so its lines can be added
+	target := fmt.Sprintf("%s/management/orders/%d", middleware.BasePath(), id)
 	if isDataStarRequest {
 		// For DataStar requests, redirect via JavaScript
-		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/orders")
+		js := fmt.Sprintf("window.location.href = %q;", target)
 		r.Response.Header().Set("Content-Type", "text/javascript")
 		r.Response.Write([]byte(js))
 		return
 	}
 
-	// For regular requests, redirect to the list
-	r.Response.RedirectTo(middleware.BasePath() + "/management/orders")
+	r.Response.RedirectTo(target)
 }
 
 // OrderGet renders a specific order for editing or a new order form.
@@ -235,6 +266,46 @@ func (om *OrderManager) OrderGet(r *ghttp.Request) {
 		return
 	}
 
+	// Lines are edited inline and the workflow is driven once the order exists
+	lineOptions := pages.OrderLineOptions{}
+	workflow := pages.OrderWorkflow{}
+	if order != nil {
+		facts, err := om.OrderRepo.TransitionFacts(r.GetCtx(), order.OrderID)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "order transition facts: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		workflow.Allowed = domain.AllowedOrderTransitions(order.Status, facts)
+		if workflow.History, err = om.OrderRepo.ListTransitions(r.GetCtx(), order.OrderID); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list order transitions: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		if workflow.Invoices, err = om.InvoiceRepo.ListByOrder(r.GetCtx(), order.OrderID); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list order invoices: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		workflow.CanInvoice = canInvoice(order.Status, workflow.Invoices)
+
+		if order.Items, err = om.OrderItemRepo.ListByOrder(r.GetCtx(), order.OrderID); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list order lines: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		if lineOptions.Products, err = om.ProductRepo.List(r.GetCtx()); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list products: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		if lineOptions.SlaughterRecords, err = om.SlaughterRecordRepo.List(r.GetCtx()); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list slaughter records: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -244,6 +315,8 @@ func (om *OrderManager) OrderGet(r *ghttp.Request) {
 				middleware.CsrfToken(r),
 				order,
 				customers,
+				lineOptions,
+				workflow,
 			),
 		)
 		return
@@ -258,6 +331,8 @@ func (om *OrderManager) OrderGet(r *ghttp.Request) {
 			ThemeToString(user.Theme),
 			order,
 			customers,
+			lineOptions,
+			workflow,
 		),
 	)
 }
@@ -280,8 +355,7 @@ func (om *OrderManager) OrderPut(r *ghttp.Request) {
 	customerIDStr := strings.TrimSpace(r.Get("customer_id").String())
 	orderDateStr := strings.TrimSpace(r.Get("order_date").String())
 	deliveryDateStr := strings.TrimSpace(r.Get("delivery_date").String())
-	totalAmountStr := strings.TrimSpace(r.Get("total_amount").String())
-	status := strings.TrimSpace(r.Get("status").String())
+	deliveryFeeStr := strings.TrimSpace(r.Get("delivery_fee").String())
 
 	errs := map[string]string{}
 	if customerIDStr == "" {
@@ -317,22 +391,15 @@ func (om *OrderManager) OrderPut(r *ghttp.Request) {
 		}
 	}
 
-	var totalAmount *float64
-	if totalAmountStr != "" {
-		if amountVal, err := strconv.ParseFloat(totalAmountStr, 64); err == nil {
-			totalAmount = new(float64)
-			*totalAmount = amountVal
+	var deliveryFee float64
+	if deliveryFeeStr != "" {
+		if feeVal, err := strconv.ParseFloat(deliveryFeeStr, 64); err == nil && feeVal >= 0 {
+			deliveryFee = feeVal
 		} else {
-			errs["total_amount"] = "Total amount must be a valid number"
+			errs["delivery_fee"] = "Delivery fee must be a non-negative number"
 		}
 	}
 
-	var statusPtr *string
-	if status != "" {
-		statusPtr = new(string)
-		*statusPtr = status
-	}
-
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -344,15 +411,29 @@ func (om *OrderManager) OrderPut(r *ghttp.Request) {
 			CustomerID:   customerID,
 			OrderDate:    orderDate,
 			DeliveryDate: deliveryDate,
-			TotalAmount:  totalAmount,
-			Status:       statusPtr,
+			DeliveryFee:  deliveryFee,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := om.OrderRepo.Update(r.GetCtx(), order)
-		if err != nil {
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := om.OrderRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/orders/%d", middleware.BasePath(), id)
+				writeConflict(r, "Order", recordURL, recordURL, current)
+				return
+			}
+		}
+		switch {
+		case errors.Is(err, domain.ErrOrderHeaderLocked):
+			// Past draft the order may be invoiced, so only the delivery date can still move.
+			errs["form"] = headerLockedMessage
+		case errors.Is(err, data.ErrNotFound):
+			r.Response.WriteStatusExit(404, "Order not found")
+			return
+		case err != nil:
 			g.Log().Errorf(r.GetCtx(), "update order: %v", err)
 			errs["form"] = "Failed to update order"
 		}
@@ -384,6 +465,8 @@ func (om *OrderManager) OrderPut(r *ghttp.Request) {
 	r.Response.RedirectTo(fmt.Sprintf("%s/management/orders/%d", middleware.BasePath(), id))
 }
 
+const headerLockedMessage = "Customer, order date and delivery fee can only be changed while the order is a draft"
+
 // OrderDelete soft deletes an order.
 func (om *OrderManager) OrderDelete(r *ghttp.Request) {
 	_, ok := middleware.CurrentUser(r)
@@ -400,7 +483,17 @@ func (om *OrderManager) OrderDelete(r *ghttp.Request) {
 	}
 
 	err = om.OrderRepo.SoftDelete(r.GetCtx(), id, time.Now())
-	if err != nil {
+	switch {
+	case errors.Is(err, data.ErrNotFound):
+		r.Response.WriteStatusExit(404, "Order not found")
+		return
+	case errors.Is(err, domain.ErrOrderDelivered):
+		r.Response.WriteStatusExit(409, "Delivered orders cannot be deleted; return them instead")
+		return
+	case errors.Is(err, domain.ErrOrderOnRun):
+		r.Response.WriteStatusExit(409, "The order is on a delivery run; take it off the run first")
+		return
+	case err != nil:
 		g.Log().Errorf(r.GetCtx(), "delete order: %v", err)
 		r.Response.WriteStatusExit(500, "Internal server error")
 		return
@@ -418,3 +511,68 @@ func (om *OrderManager) OrderDelete(r *ghttp.Request) {
 	// For regular requests, redirect to the list
 	r.Response.RedirectTo(middleware.BasePath() + "/management/orders")
 }
+
+// OrderTransitionPost moves an order along the fulfilment workflow.
+func (om *OrderManager) OrderTransitionPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid order ID")
+		return
+	}
+
+	errs := map[string]string{}
+	to, ok := domain.ParseOrderStatus(r.Get("to").String())
+	if !ok {
+		errs["to"] = "Unknown order status"
+	} else if to == domain.OrderStatusInvoiced {
+		errs["to"] = "Orders are invoiced by issuing their invoice"
+	}
+
+	var notePtr *string
+	if note := strings.TrimSpace(r.Get("note").String()); note != "" {
+		notePtr = &note
+	}
+
+	if len(errs) == 0 {
+		err := om.OrderRepo.TransitionStatus(r.GetCtx(), id, to, notePtr)
+		var transitionErr *domain.OrderTransitionError
+		switch {
+		case err == data.ErrNotFound:
+			r.Response.WriteStatusExit(404, "Order not found")
+			return
+		case errors.As(err, &transitionErr):
+			errs["to"] = transitionErr.Error()
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "transition order: %v", err)
+			errs["form"] = "Failed to change order status"
+		}
+	}
+
+	writeOrderResult(r, id, errs)
+}
+
+// canInvoice reports whether an invoice can be issued for the order: it has been delivered, or
+// it was invoiced and every invoice has since been credited.
+func canInvoice(status domain.OrderStatus, invoices []*domain.Invoice) bool {
+	if status != domain.OrderStatusDelivered && status != domain.OrderStatusInvoiced {
+		return false
+	}
+	credited := map[int64]bool{}
+	for _, inv := range invoices {
+		if inv.CreditedInvoiceID != nil {
+			credited[*inv.CreditedInvoiceID] = true
+		}
+	}
+	for _, inv := range invoices {
+		if inv.Kind == domain.InvoiceKindInvoice && !credited[inv.InvoiceID] {
+			return false
+		}
+	}
+	return true
+}
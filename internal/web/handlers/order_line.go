@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// linesLockedMessage explains why lines of a confirmed order cannot change.
+const linesLockedMessage = "Order lines can only be changed while the order is a draft"
+
+// OrderLinePost adds a line to an order. Line and order totals are derived by the repository.
+func (om *OrderManager) OrderLinePost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	order, ok := om.lineOrder(r)
+	if !ok {
+		return
+	}
+
+	line, errs := parseOrderLineForm(r)
+	if len(errs) == 0 {
+		om.priceOrderLine(r.GetCtx(), order, line, errs)
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		line.OrderID = order.OrderID
+		line.Audit = domain.AuditFields{
+			CreatedBy: &userIDStr,
+			UpdatedBy: &userIDStr,
+		}
+
+		switch _, err := om.OrderItemRepo.Create(r.GetCtx(), line); {
+		case errors.Is(err, domain.ErrOrderLinesLocked):
+			errs["form"] = linesLockedMessage
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "create order line: %v", err)
+			errs["form"] = "Failed to add order line"
+		}
+	}
+
+	writeOrderResult(r, order.OrderID, errs)
+}
+
+// OrderLinePut updates a line of an order.
+func (om *OrderManager) OrderLinePut(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	order, ok := om.lineOrder(r)
+	if !ok {
+		return
+	}
+	existing, ok := om.orderLine(r, order.OrderID)
+	if !ok {
+		return
+	}
+
+	line, errs := parseOrderLineForm(r)
+	if len(errs) == 0 {
+		om.priceOrderLine(r.GetCtx(), order, line, errs)
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		line.OrderItemID = existing.OrderItemID
+		line.OrderID = order.OrderID
+		line.Audit = domain.AuditFields{
+			UpdatedBy: &userIDStr,
+			Version:   r.Get("version").Int64(),
+		}
+
+		err := om.OrderItemRepo.Update(r.GetCtx(), line)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := om.OrderItemRepo.FindByID(r.GetCtx(), line.OrderItemID); findErr == nil {
+				orderURL := fmt.Sprintf("%s/management/orders/%d", middleware.BasePath(), order.OrderID)
+				writeConflict(r, "Order Line", fmt.Sprintf("%s/lines/%d", orderURL, line.OrderItemID), orderURL, current)
+				return
+			}
+		}
+		switch {
+		case errors.Is(err, domain.ErrOrderLinesLocked):
+			errs["form"] = linesLockedMessage
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "update order line: %v", err)
+			errs["form"] = "Failed to update order line"
+		}
+	}
+
+	writeOrderResult(r, order.OrderID, errs)
+}
+
+// OrderLineDelete removes a line from an order.
+func (om *OrderManager) OrderLineDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	order, ok := om.lineOrder(r)
+	if !ok {
+		return
+	}
+	line, ok := om.orderLine(r, order.OrderID)
+	if !ok {
+		return
+	}
+	err := om.OrderItemRepo.SoftDelete(r.GetCtx(), line.OrderItemID, time.Now())
+	if errors.Is(err, domain.ErrOrderLinesLocked) {
+		writeOrderResult(r, order.OrderID, map[string]string{"form": linesLockedMessage})
+		return
+	}
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete order line: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeOrderResult(r, order.OrderID, nil)
+}
+
+// OrderLinePriceGet returns the catalog description and the customer's price list price for a
+// product as DataStar signals, so the new line form can prefill them.
+func (om *OrderManager) OrderLinePriceGet(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	order, ok := om.lineOrder(r)
+	if !ok {
+		return
+	}
+
+	productID, err := strconv.ParseInt(r.Get("product_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid product ID")
+		return
+	}
+
+	product, err := om.ProductRepo.FindByID(r.GetCtx(), productID)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Product not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find product: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	signals := map[string]interface{}{
+		"product_description": product.Name,
+	}
+	if item, err := om.catalogPrice(r.GetCtx(), order, productID); err == nil {
+		signals["unit_price"] = strconv.FormatFloat(item.UnitPrice, 'f', 2, 64)
+	} else if err != data.ErrNotFound {
+		g.Log().Errorf(r.GetCtx(), "price order line: %v", err)
+	}
+
+	r.Response.Header().Set("Content-Type", "application/json")
+	r.Response.WriteJson(map[string]interface{}{
+		"order_line_new": signals,
+	})
+}
+
+// lineOrder loads the order named in the route, writing the error response when it cannot.
+func (om *OrderManager) lineOrder(r *ghttp.Request) (*domain.Order, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid order ID")
+		return nil, false
+	}
+
+	order, err := om.OrderRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Order not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find order: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return order, true
+}
+
+// orderLine loads the line named in the route and checks it belongs to the order.
+func (om *OrderManager) orderLine(r *ghttp.Request, orderID int64) (*domain.OrderItem, bool) {
+	id, err := strconv.ParseInt(r.Get("line_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid order line ID")
+		return nil, false
+	}
+
+	line, err := om.OrderItemRepo.FindByID(r.GetCtx(), id)
+	if err == nil && line.OrderID != orderID {
+		err = data.ErrNotFound
+	}
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Order line not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find order line: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return line, true
+}
+
+// catalogPrice looks up the price of a product for the order's customer type on the order date
+// (today when the order is undated).
+func (om *OrderManager) catalogPrice(ctx context.Context, order *domain.Order, productID int64) (*domain.PriceListItem, error) {
+	day := time.Now()
+	if order.OrderDate != nil {
+		day = *order.OrderDate
+	}
+
+	customerType := ""
+	customer, err := om.CustomerRepo.FindByID(ctx, order.CustomerID)
+	if err != nil && err != data.ErrNotFound {
+		return nil, err
+	}
+	if customer != nil && customer.CustomerType != nil {
+		customerType = *customer.CustomerType
+	}
+	return om.PriceListRepo.PriceFor(ctx, productID, customerType, day)
+}
+
+// priceOrderLine completes a catalog line: a blank description takes the product name, a blank
+// unit price takes the customer's price list price and the VAT rate is copied from the product.
+func (om *OrderManager) priceOrderLine(ctx context.Context, order *domain.Order, line *domain.OrderItem, errs map[string]string) {
+	if line.ProductID != nil {
+		product, err := om.ProductRepo.FindByID(ctx, *line.ProductID)
+		if err != nil {
+			if err != data.ErrNotFound {
+				g.Log().Errorf(ctx, "find product: %v", err)
+			}
+			errs["product_id"] = "Product not found"
+			return
+		}
+		line.VATRate = product.VATRate
+		if line.ProductDescription == nil {
+			line.ProductDescription = &product.Name
+		}
+		if line.UnitPrice == nil {
+			if item, err := om.catalogPrice(ctx, order, product.ProductID); err == nil {
+				line.UnitPrice = &item.UnitPrice
+			} else if err != data.ErrNotFound {
+				g.Log().Errorf(ctx, "price order line: %v", err)
+			}
+		}
+	}
+
+	if line.ProductDescription == nil {
+		errs["product_description"] = "Pick a product or enter a description"
+	}
+	if line.UnitPrice == nil {
+		errs["unit_price"] = "Unit price is required (no price list covers this product)"
+	}
+}
+
+// parseOrderLineForm reads and validates the order line fields shared by create and update.
+func parseOrderLineForm(r *ghttp.Request) (*domain.OrderItem, map[string]string) {
+	productIDStr := strings.TrimSpace(r.Get("product_id").String())
+	productDescription := strings.TrimSpace(r.Get("product_description").String())
+	quantityStr := strings.TrimSpace(r.Get("quantity").String())
+	unitPriceStr := strings.TrimSpace(r.Get("unit_price").String())
+	discountStr := strings.TrimSpace(r.Get("discount").String())
+	slaughterIDStr := strings.TrimSpace(r.Get("slaughter_id").String())
+
+	errs := map[string]string{}
+	line := &domain.OrderItem{}
+
+	if productIDStr != "" {
+		if idVal, err := strconv.ParseInt(productIDStr, 10, 64); err == nil {
+			line.ProductID = &idVal
+		} else {
+			errs["product_id"] = "Product must be a valid number"
+		}
+	}
+
+	if productDescription != "" {
+		line.ProductDescription = &productDescription
+	}
+
+	if qtyVal, err := strconv.ParseFloat(quantityStr, 64); err == nil && qtyVal > 0 {
+		line.Quantity = &qtyVal
+	} else {
+		errs["quantity"] = "Quantity must be a positive number"
+	}
+
+	if unitPriceStr != "" {
+		if priceVal, err := strconv.ParseFloat(unitPriceStr, 64); err == nil && priceVal >= 0 {
+			line.UnitPrice = &priceVal
+		} else {
+			errs["unit_price"] = "Unit price must be a non-negative number"
+		}
+	}
+
+	if discountStr != "" {
+		if discountVal, err := strconv.ParseFloat(discountStr, 64); err == nil && discountVal >= 0 {
+			line.Discount = discountVal
+		} else {
+			errs["discount"] = "Discount must be a non-negative amount"
+		}
+	}
+
+	if slaughterIDStr != "" {
+		if idVal, err := strconv.ParseInt(slaughterIDStr, 10, 64); err == nil {
+			line.SlaughterID = &idVal
+		} else {
+			errs["slaughter_id"] = "Slaughter lot must be a valid number"
+		}
+	}
+
+	return line, errs
+}
+
+// writeOrderResult answers an order or line change with the validation errors or by reloading the order.
+func writeOrderResult(r *ghttp.Request, orderID int64, errs map[string]string) {
+	writeResult(r, fmt.Sprintf("%s/management/orders/%d", middleware.BasePath(), orderID), errs)
+}
+
+// writeResult answers a form post with the validation errors or by navigating to target.
+func writeResult(r *ghttp.Request, target string, errs map[string]string) {
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(target)
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", target)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(target)
+}
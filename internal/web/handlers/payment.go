@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type PaymentManager struct {
+	PaymentRepo  data.PaymentRepo
+	InvoiceRepo  data.InvoiceRepo
+	CustomerRepo data.CustomerRepo
+}
+
+// RegisterPaymentRoutes wires payment, receivables aging and customer statement endpoints under /app.
+func RegisterPaymentRoutes(group *ghttp.RouterGroup, paymentRepo data.PaymentRepo, invoiceRepo data.InvoiceRepo, customerRepo data.CustomerRepo) {
+	pm := &PaymentManager{
+		PaymentRepo:  paymentRepo,
+		InvoiceRepo:  invoiceRepo,
+		CustomerRepo: customerRepo,
+	}
+
+	group.GET("/management/payments", pm.PaymentsGet)
+	group.POST("/management/payments", pm.PaymentPost)
+	group.GET("/management/payments/new", pm.PaymentNewGet)
+	group.GET("/management/payments/:id", pm.PaymentGet)
+	group.GET("/management/receivables", pm.ReceivablesGet)
+	group.GET("/management/customers/:id/statement", pm.StatementGet)
+}
+
+// PaymentsGet renders the payments page.
+func (pm *PaymentManager) PaymentsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	payments, err := pm.PaymentRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list payments: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PaymentsContent(middleware.BasePath(), payments))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PaymentsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			payments,
+		),
+	)
+}
+
+// PaymentNewGet renders the payment form; with customer_id it lists the customer's open
+// invoices for allocation, and invoice_id pre-allocates that invoice's open amount.
+func (pm *PaymentManager) PaymentNewGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	customers, err := pm.CustomerRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customers: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	customerID := r.Get("customer_id").Int64()
+	invoiceID := r.Get("invoice_id").Int64()
+	balances, err := pm.openBalances(r, customerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "invoice balances: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	paymentDate := time.Now().Format("2006-01-02")
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(
+			r,
+			pages.PaymentFormContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				paymentDate,
+				customers,
+				customerID,
+				balances,
+				invoiceID,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PaymentFormPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			paymentDate,
+			customers,
+			customerID,
+			balances,
+			invoiceID,
+		),
+	)
+}
+
+// PaymentPost records a payment and its allocations.
+func (pm *PaymentManager) PaymentPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	payment, errs := pm.parsePaymentForm(r)
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		payment.Audit.CreatedBy = &userIDStr
+		payment.Audit.UpdatedBy = &userIDStr
+		_, err := pm.PaymentRepo.Create(r.GetCtx(), payment)
+		switch {
+		case errors.Is(err, domain.ErrOverAllocated):
+			errs["amount"] = err.Error()
+		case errors.Is(err, domain.ErrAllocationExceedsOpen), errors.Is(err, domain.ErrAllocationCustomer):
+			errs["allocations"] = err.Error()
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "create payment: %v", err)
+			errs["form"] = "Failed to record payment"
+		}
+	}
+
+	target := middleware.BasePath() + "/management/payments"
+	if len(errs) == 0 {
+		target = fmt.Sprintf("%s/management/customers/%d/statement", middleware.BasePath(), payment.CustomerID)
+	}
+	writeResult(r, target, errs)
+}
+
+// PaymentGet renders a payment with its allocations.
+func (pm *PaymentManager) PaymentGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid payment ID")
+		return
+	}
+	payment, err := pm.PaymentRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Payment not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find payment: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PaymentContent(middleware.BasePath(), payment))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PaymentPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			payment,
+		),
+	)
+}
+
+// ReceivablesGet renders the accounts-receivable aging report.
+func (pm *PaymentManager) ReceivablesGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	balances, err := pm.PaymentRepo.InvoiceBalances(r.GetCtx(), 0)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "invoice balances: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	asOf := today()
+	rows := domain.BuildAging(balances, asOf)
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.ReceivablesContent(middleware.BasePath(), asOf, rows))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ReceivablesPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			asOf,
+			rows,
+		),
+	)
+}
+
+// StatementGet renders a customer's statement with the running balance.
+func (pm *PaymentManager) StatementGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid customer ID")
+		return
+	}
+	customer, err := pm.CustomerRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Customer not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find customer: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	invoices, err := pm.InvoiceRepo.ListByCustomer(r.GetCtx(), id)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer invoices: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	payments, err := pm.PaymentRepo.ListByCustomer(r.GetCtx(), id)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer payments: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	lines := domain.BuildStatement(invoices, payments)
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.CustomerStatementContent(middleware.BasePath(), customer, lines))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.CustomerStatementPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			customer,
+			lines,
+		),
+	)
+}
+
+// openBalances returns the customer's invoices that still have an amount open.
+func (pm *PaymentManager) openBalances(r *ghttp.Request, customerID int64) ([]*domain.InvoiceBalance, error) {
+	if customerID == 0 {
+		return nil, nil
+	}
+	balances, err := pm.PaymentRepo.InvoiceBalances(r.GetCtx(), customerID)
+	if err != nil {
+		return nil, err
+	}
+	open := balances[:0]
+	for _, balance := range balances {
+		if balance.Open() > 0 {
+			open = append(open, balance)
+		}
+	}
+	return open, nil
+}
+
+// parsePaymentForm reads the payment fields and one alloc_<invoice id> amount per open invoice
+// of the customer.
+func (pm *PaymentManager) parsePaymentForm(r *ghttp.Request) (*domain.Payment, map[string]string) {
+	errs := map[string]string{}
+	payment := &domain.Payment{}
+
+	customerID, err := strconv.ParseInt(r.Get("customer_id").String(), 10, 64)
+	if err != nil || customerID <= 0 {
+		errs["customer_id"] = "Customer is required"
+	}
+	payment.CustomerID = customerID
+
+	if payment.PaymentDate, err = time.Parse("2006-01-02", r.Get("payment_date").String()); err != nil {
+		errs["payment_date"] = "Payment date must be a valid date"
+	}
+
+	payment.Method = domain.PaymentMethod(r.Get("method").String())
+	switch payment.Method {
+	case domain.PaymentMethodCash, domain.PaymentMethodBankTransfer, domain.PaymentMethodCard:
+	default:
+		errs["method"] = "Unknown payment method"
+	}
+
+	if payment.Amount, err = strconv.ParseFloat(strings.TrimSpace(r.Get("amount").String()), 64); err != nil || payment.Amount <= 0 {
+		errs["amount"] = "Amount must be a positive number"
+	}
+
+	if reference := strings.TrimSpace(r.Get("reference").String()); reference != "" {
+		payment.Reference = &reference
+	}
+	if notes := strings.TrimSpace(r.Get("notes").String()); notes != "" {
+		payment.Notes = &notes
+	}
+
+	if _, failed := errs["customer_id"]; failed {
+		return payment, errs
+	}
+	balances, err := pm.openBalances(r, customerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "invoice balances: %v", err)
+		errs["form"] = "Failed to load open invoices"
+		return payment, errs
+	}
+	for _, balance := range balances {
+		field := "alloc_" + strconv.FormatInt(balance.Invoice.InvoiceID, 10)
+		value := strings.TrimSpace(r.Get(field).String())
+		if value == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(value, 64)
+		if err != nil || amount < 0 {
+			errs[field] = "Allocation must be a positive number"
+			continue
+		}
+		if amount > 0 {
+			payment.Allocations = append(payment.Allocations, &domain.PaymentAllocation{InvoiceID: balance.Invoice.InvoiceID, Amount: amount})
+		}
+	}
+	return payment, errs
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PortalRepos are the repositories the customer portal reads and writes. Every query a handler
+// makes is scoped to the signed-in customer.
+type PortalRepos struct {
+	CustomerAccountRepo data.CustomerAccountRepo
+	CustomerRepo        data.CustomerRepo
+	ProductRepo         data.ProductRepo
+	PriceListRepo       data.PriceListRepo
+	ProductLotRepo      data.ProductLotRepo
+	OrderRepo           data.OrderRepo
+	OrderItemRepo       data.OrderItemRepo
+	InvoiceRepo         data.InvoiceRepo
+}
+
+type Portal struct {
+	Repos *PortalRepos
+}
+
+// RegisterPortalAuthRoutes wires the customer portal sign-in endpoints under /portal.
+func RegisterPortalAuthRoutes(group *ghttp.RouterGroup, repos *PortalRepos) {
+	p := &Portal{Repos: repos}
+	group.GET("/login", p.LoginGet)
+	group.POST("/login", p.LoginPost)
+	group.POST("/logout", p.LogoutPost)
+}
+
+// RegisterPortalRoutes wires the signed-in customer portal endpoints under /portal.
+func RegisterPortalRoutes(group *ghttp.RouterGroup, repos *PortalRepos) {
+	p := &Portal{Repos: repos}
+	group.GET("/", p.ShopGet)
+	group.POST("/orders", p.OrderPost)
+	group.GET("/orders", p.OrdersGet)
+	group.GET("/orders/:id", p.OrderGet)
+	group.GET("/invoices", p.InvoicesGet)
+	group.GET("/invoices/:id/pdf", p.InvoicePDFGet)
+	group.GET("/account", p.AccountGet)
+	group.POST("/account/password", p.PasswordPost)
+}
+
+// LoginGet renders the portal sign-in page. Signed-in customers go straight to the shop.
+func (p *Portal) LoginGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentCustomer(r); ok {
+		r.Response.RedirectTo(middleware.PortalBasePath())
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalLoginPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), map[string]string{}, ""))
+}
+
+// LoginPost signs a customer in with their email and password.
+func (p *Portal) LoginPost(r *ghttp.Request) {
+	email := strings.TrimSpace(r.Get("email").String())
+	password := r.Get("password").String()
+
+	errs := map[string]string{}
+	if email == "" {
+		errs["email"] = "Email is required"
+	}
+	if password == "" {
+		errs["password"] = "Password is required"
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		account, err := p.Repos.CustomerAccountRepo.FindByEmail(r.GetCtx(), email)
+		switch {
+		case err == data.ErrNotFound:
+			errs["form"] = "Invalid email or password"
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "find customer account: %v", err)
+			errs["form"] = "Sign-in failed"
+		case bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil:
+			errs["form"] = "Invalid email or password"
+		default:
+			if err := p.Repos.CustomerAccountRepo.RecordLogin(r.GetCtx(), account.CustomerAccountID, time.Now()); err != nil {
+				g.Log().Errorf(r.GetCtx(), "record customer login: %v", err)
+			}
+			middleware.SetCustomerLoggedIn(r, account)
+			middleware.SetNoCache(r)
+			writeResult(r, middleware.PortalBasePath(), nil)
+			return
+		}
+	}
+
+	farm := models.FarmProfileFromEnv()
+	csrf := middleware.CsrfToken(r)
+	var component templ.Component
+	if isDataStarRequest {
+		component = pages.PortalLoginContent(middleware.PortalBasePath(), csrf, errs, email)
+	} else {
+		component = pages.PortalLoginPage(middleware.PortalBasePath(), farm.Name, csrf, errs, email)
+	}
+	_ = middleware.TemplRender(r, component)
+}
+
+// LogoutPost signs the customer out of the portal.
+func (p *Portal) LogoutPost(r *ghttp.Request) {
+	middleware.ClearCustomerLogin(r)
+	middleware.SetNoCache(r)
+	r.Response.RedirectTo(middleware.PortalBasePath() + "/login")
+}
+
+// ShopGet renders the catalog with the customer's prices, the stock available now and the order form.
+func (p *Portal) ShopGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	catalog, err := p.catalog(r.GetCtx(), account.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "build portal catalog: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	earliest := today().Format("2006-01-02")
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PortalShopContent(middleware.PortalBasePath(), middleware.CsrfToken(r), earliest, catalog))
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalShopPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), account.CustomerName, earliest, catalog))
+}
+
+// OrderPost places the quantities entered in the shop as a draft order for staff to confirm.
+// Prices are taken from the catalog, never from the form.
+func (p *Portal) OrderPost(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	catalog, err := p.catalog(r.GetCtx(), account.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "build portal catalog: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	errs := map[string]string{}
+	var lines []*domain.OrderItem
+	for _, item := range catalog {
+		field := fmt.Sprintf("qty_%d", item.Product.ProductID)
+		qtyStr := strings.TrimSpace(r.Get(field).String())
+		if qtyStr == "" {
+			continue
+		}
+		qty, err := strconv.ParseFloat(qtyStr, 64)
+		if err != nil || qty < 0 {
+			errs[field] = "Quantity must be a positive number"
+			continue
+		}
+		if qty == 0 {
+			continue
+		}
+		productID, price := item.Product.ProductID, item.UnitPrice
+		lines = append(lines, &domain.OrderItem{
+			ProductID:          &productID,
+			ProductDescription: &item.Product.Name,
+			Quantity:           &qty,
+			UnitPrice:          &price,
+			VATRate:            item.Product.VATRate,
+		})
+	}
+	if len(lines) == 0 && len(errs) == 0 {
+		errs["form"] = "Enter a quantity for at least one product"
+	}
+
+	day := today()
+	order := &domain.Order{
+		CustomerID: account.CustomerID,
+		OrderDate:  &day,
+		Status:     domain.OrderStatusDraft,
+		Source:     domain.OrderSourcePortal,
+	}
+	if deliveryStr := strings.TrimSpace(r.Get("delivery_date").String()); deliveryStr != "" {
+		if delivery, err := time.Parse("2006-01-02", deliveryStr); err != nil {
+			errs["delivery_date"] = "Delivery date must be a valid date"
+		} else if delivery.Before(day) {
+			errs["delivery_date"] = "Delivery date cannot be in the past"
+		} else {
+			order.DeliveryDate = &delivery
+		}
+	}
+
+	target := middleware.PortalBasePath()
+	if len(errs) == 0 {
+		id, err := p.Repos.OrderRepo.Place(r.GetCtx(), order, lines)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "place portal order: %v", err)
+			errs["form"] = "Failed to place the order"
+		} else {
+			target = fmt.Sprintf("%s/orders/%d", middleware.PortalBasePath(), id)
+		}
+	}
+
+	writeResult(r, target, errs)
+}
+
+// OrdersGet renders the customer's order history.
+func (p *Portal) OrdersGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	orders, err := p.Repos.OrderRepo.ListByCustomer(r.GetCtx(), account.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer orders: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PortalOrdersContent(middleware.PortalBasePath(), orders))
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalOrdersPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), account.CustomerName, orders))
+}
+
+// OrderGet renders one of the customer's orders with its lines and invoices.
+func (p *Portal) OrderGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid order ID")
+		return
+	}
+	order, err := p.Repos.OrderRepo.FindByID(r.GetCtx(), id)
+	if err == nil && order.CustomerID != account.CustomerID {
+		err = data.ErrNotFound
+	}
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Order not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find order: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if order.Items, err = p.Repos.OrderItemRepo.ListByOrder(r.GetCtx(), order.OrderID); err != nil {
+		g.Log().Errorf(r.GetCtx(), "list order lines: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	invoices, err := p.Repos.InvoiceRepo.ListByOrder(r.GetCtx(), order.OrderID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list order invoices: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PortalOrderContent(middleware.PortalBasePath(), order, invoices))
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalOrderPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), account.CustomerName, order, invoices))
+}
+
+// InvoicesGet renders the customer's invoices and credit notes.
+func (p *Portal) InvoicesGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	invoices, err := p.Repos.InvoiceRepo.ListByCustomer(r.GetCtx(), account.CustomerID)
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customer invoices: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PortalInvoicesContent(middleware.PortalBasePath(), invoices))
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalInvoicesPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), account.CustomerName, invoices))
+}
+
+// InvoicePDFGet downloads one of the customer's invoices or credit notes as PDF.
+func (p *Portal) InvoicePDFGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid invoice ID")
+		return
+	}
+	inv, err := p.Repos.InvoiceRepo.FindByID(r.GetCtx(), id)
+	if err == nil && inv.CustomerID != account.CustomerID {
+		err = data.ErrNotFound
+	}
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Invoice not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find invoice: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	r.Response.Header().Set("Content-Type", "application/pdf")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", inv.Number+".pdf"))
+	r.Response.Write(invoicePDF(models.FarmProfileFromEnv(), inv))
+}
+
+// AccountGet renders the account page where customers change their password.
+func (p *Portal) AccountGet(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	_ = middleware.TemplRender(r, pages.PortalAccountPage(middleware.PortalBasePath(), farm.Name, middleware.CsrfToken(r), account))
+}
+
+// PasswordPost changes the signed-in account's password.
+func (p *Portal) PasswordPost(r *ghttp.Request) {
+	account, ok := p.account(r)
+	if !ok {
+		return
+	}
+
+	current := r.Get("current_password").String()
+	newpw := r.Get("new_password").String()
+	confirm := r.Get("confirm_password").String()
+
+	errs := map[string]string{}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(current)) != nil {
+		errs["current_password"] = "Current password is incorrect"
+	}
+	if len(newpw) < 8 {
+		errs["new_password"] = "New password must be at least 8 characters"
+	}
+	if newpw != confirm {
+		errs["confirm_password"] = "Passwords do not match"
+	}
+
+	if len(errs) == 0 {
+		hash, err := bcrypt.GenerateFromPassword([]byte(newpw), bcrypt.DefaultCost)
+		if err == nil {
+			err = p.Repos.CustomerAccountRepo.UpdatePassword(r.GetCtx(), account.CustomerAccountID, string(hash))
+		}
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "update customer password: %v", err)
+			errs["form"] = "Failed to change the password"
+		}
+	}
+
+	writeResult(r, middleware.PortalBasePath()+"/account", errs)
+}
+
+// account reloads the signed-in portal account so that revoked access takes effect at once,
+// signing the session out when the account is gone.
+func (p *Portal) account(r *ghttp.Request) (*domain.CustomerAccount, bool) {
+	session, ok := middleware.CurrentCustomer(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.PortalBasePath() + "/login")
+		return nil, false
+	}
+
+	account, err := p.Repos.CustomerAccountRepo.FindByID(r.GetCtx(), session.CustomerAccountID)
+	if err != nil {
+		if err != data.ErrNotFound {
+			g.Log().Errorf(r.GetCtx(), "find customer account: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return nil, false
+		}
+		middleware.ClearCustomerLogin(r)
+		r.Response.RedirectTo(middleware.PortalBasePath() + "/login")
+		return nil, false
+	}
+	return account, true
+}
+
+// catalog builds the products a customer can order today at the price list price for their
+// customer type.
+func (p *Portal) catalog(ctx context.Context, customerID int64) ([]*domain.CatalogItem, error) {
+	customer, err := p.Repos.CustomerRepo.FindByID(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	customerType := ""
+	if customer.CustomerType != nil {
+		customerType = *customer.CustomerType
+	}
+
+	products, err := p.Repos.ProductRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	day := today()
+	prices := map[int64]float64{}
+	for _, product := range products {
+		if !product.Active {
+			continue
+		}
+		item, err := p.Repos.PriceListRepo.PriceFor(ctx, product.ProductID, customerType, day)
+		if err == data.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		prices[product.ProductID] = item.UnitPrice
+	}
+
+	lots, err := p.Repos.ProductLotRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return domain.BuildCatalog(products, prices, domain.BuildSellableStock(lots, day)), nil
+}
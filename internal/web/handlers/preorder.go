@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type PreorderManager struct {
+	PreorderRepo data.PreorderRepo
+	CustomerRepo data.CustomerRepo
+}
+
+// RegisterPreorderRoutes wires the seasonal pre-order campaign endpoints under /app.
+func RegisterPreorderRoutes(group *ghttp.RouterGroup, preorderRepo data.PreorderRepo, customerRepo data.CustomerRepo) {
+	pm := &PreorderManager{
+		PreorderRepo: preorderRepo,
+		CustomerRepo: customerRepo,
+	}
+
+	group.GET("/management/preorders", pm.CampaignsGet)
+	group.POST("/management/preorders", pm.CampaignPost)
+	group.GET("/management/preorders/:id", pm.CampaignGet)
+	group.POST("/management/preorders/:id/bands", pm.WeightBandPost)
+	group.DELETE("/management/preorders/:id/bands/:band_id", pm.WeightBandDelete)
+	group.POST("/management/preorders/:id/reservations", pm.PreorderPost)
+	group.POST("/management/preorders/:id/reservations/:preorder_id/status", pm.PreorderStatusPost)
+	group.POST("/management/preorders/:id/deposits", pm.PreorderDepositPost)
+}
+
+// CampaignsGet renders the pre-order campaigns with the form starting a new one.
+func (pm *PreorderManager) CampaignsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaigns, err := pm.PreorderRepo.ListCampaigns(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list preorder campaigns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PreorderCampaignsContent(middleware.BasePath(), middleware.CsrfToken(r), campaigns))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PreorderCampaignsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			campaigns,
+		),
+	)
+}
+
+// CampaignPost starts a pre-order campaign.
+func (pm *PreorderManager) CampaignPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	errs := map[string]string{}
+	campaign := &domain.PreorderCampaign{Name: strings.TrimSpace(r.Get("name").String())}
+	if campaign.Name == "" {
+		errs["name"] = "Name is required"
+	}
+	var err error
+	if campaign.PickupFrom, err = time.Parse("2006-01-02", r.Get("pickup_from").String()); err != nil {
+		errs["pickup_from"] = "First pickup day must be a valid date"
+	}
+	if campaign.PickupTo, err = time.Parse("2006-01-02", r.Get("pickup_to").String()); err != nil {
+		errs["pickup_to"] = "Last pickup day must be a valid date"
+	} else if campaign.PickupTo.Before(campaign.PickupFrom) {
+		errs["pickup_to"] = "Last pickup day cannot be before the first"
+	}
+	if deposit := strings.TrimSpace(r.Get("deposit_per_bird").String()); deposit != "" {
+		if campaign.DepositPerBird, err = strconv.ParseFloat(deposit, 64); err != nil || campaign.DepositPerBird < 0 {
+			errs["deposit_per_bird"] = "Deposit must be a non-negative amount"
+		}
+	}
+	if notes := strings.TrimSpace(r.Get("notes").String()); notes != "" {
+		campaign.Notes = &notes
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		campaign.Audit.CreatedBy = &userIDStr
+		campaign.Audit.UpdatedBy = &userIDStr
+		if campaign.CampaignID, err = pm.PreorderRepo.CreateCampaign(r.GetCtx(), campaign); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create preorder campaign: %v", err)
+			errs["form"] = "Failed to create campaign"
+		}
+	}
+
+	target := middleware.BasePath() + "/management/preorders"
+	if len(errs) == 0 {
+		target = campaignURL(campaign.CampaignID)
+	}
+	writeResult(r, target, errs)
+}
+
+// CampaignGet renders a campaign: its weight bands, the forecast against the supplying
+// production batches, the pre-orders and their deposits.
+func (pm *PreorderManager) CampaignGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+	view := pages.PreorderCampaignView{Campaign: campaign, Today: today()}
+	var err error
+	if view.Preorders, err = pm.PreorderRepo.ListByCampaign(r.GetCtx(), campaign.CampaignID); err != nil {
+		g.Log().Errorf(r.GetCtx(), "list preorders: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	from, to := campaign.SupplyWindow()
+	if view.Batches, err = pm.PreorderRepo.SupplyBatches(r.GetCtx(), from, to); err != nil {
+		g.Log().Errorf(r.GetCtx(), "list supply batches: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if view.Customers, err = pm.CustomerRepo.List(r.GetCtx()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "list customers: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	view.Forecast = domain.BuildPreorderForecast(campaign, view.Preorders, view.Batches)
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.PreorderCampaignContent(middleware.BasePath(), middleware.CsrfToken(r), view))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PreorderCampaignPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			view,
+		),
+	)
+}
+
+// WeightBandPost adds a weight band customers can reserve a bird in.
+func (pm *PreorderManager) WeightBandPost(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	band := &domain.WeightBand{CampaignID: campaign.CampaignID, Label: strings.TrimSpace(r.Get("label").String())}
+	if band.Label == "" {
+		errs["label"] = "Label is required"
+	}
+	var err error
+	if band.MinKg, err = strconv.ParseFloat(strings.TrimSpace(r.Get("min_kg").String()), 64); err != nil || band.MinKg < 0 {
+		errs["min_kg"] = "Minimum weight must be a non-negative number"
+	}
+	if band.MaxKg, err = strconv.ParseFloat(strings.TrimSpace(r.Get("max_kg").String()), 64); err != nil || band.MaxKg <= band.MinKg {
+		errs["max_kg"] = "Maximum weight must be above the minimum"
+	}
+	if len(errs) == 0 {
+		for _, existing := range campaign.Bands {
+			if band.MinKg < existing.MaxKg && existing.MinKg < band.MaxKg {
+				errs["min_kg"] = "The band overlaps " + existing.String()
+				break
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		if _, err := pm.PreorderRepo.AddWeightBand(r.GetCtx(), band); err != nil {
+			g.Log().Errorf(r.GetCtx(), "add weight band: %v", err)
+			errs["form"] = "Failed to add weight band"
+		}
+	}
+
+	writeResult(r, campaignURL(campaign.CampaignID), errs)
+}
+
+// WeightBandDelete removes a weight band no pre-order reserves birds in.
+func (pm *PreorderManager) WeightBandDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+	bandID, err := strconv.ParseInt(r.Get("band_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid weight band ID")
+		return
+	}
+
+	errs := map[string]string{}
+	switch err := pm.PreorderRepo.DeleteWeightBand(r.GetCtx(), campaign.CampaignID, bandID); {
+	case errors.Is(err, domain.ErrWeightBandInUse):
+		errs["form"] = err.Error()
+	case err == data.ErrNotFound:
+		r.Response.WriteStatusExit(404, "Weight band not found")
+		return
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "delete weight band: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, campaignURL(campaign.CampaignID), errs)
+}
+
+// PreorderPost reserves birds in a weight band for a customer. Reservations beyond the
+// forecast supply are accepted; the campaign page warns about them.
+func (pm *PreorderManager) PreorderPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	preorder := &domain.Preorder{CampaignID: campaign.CampaignID}
+	var err error
+	if preorder.CustomerID, err = strconv.ParseInt(r.Get("customer_id").String(), 10, 64); err != nil || preorder.CustomerID <= 0 {
+		errs["customer_id"] = "Customer is required"
+	}
+	if preorder.WeightBandID, err = strconv.ParseInt(r.Get("weight_band_id").String(), 10, 64); err != nil || campaign.Band(preorder.WeightBandID) == nil {
+		errs["weight_band_id"] = "Weight band is required"
+	}
+	if preorder.Quantity, err = strconv.Atoi(strings.TrimSpace(r.Get("quantity").String())); err != nil || preorder.Quantity <= 0 {
+		errs["quantity"] = "Number of birds must be a positive whole number"
+	}
+	if preorder.PickupDate, err = time.Parse("2006-01-02", r.Get("pickup_date").String()); err != nil {
+		errs["pickup_date"] = "Pickup date must be a valid date"
+	} else if !campaign.InPickupWindow(preorder.PickupDate) {
+		errs["pickup_date"] = domain.ErrPickupOutsideCampaign.Error()
+	}
+	if notes := strings.TrimSpace(r.Get("notes").String()); notes != "" {
+		preorder.Notes = &notes
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		preorder.Audit.CreatedBy = &userIDStr
+		preorder.Audit.UpdatedBy = &userIDStr
+		if _, err := pm.PreorderRepo.Create(r.GetCtx(), preorder); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create preorder: %v", err)
+			errs["form"] = "Failed to record pre-order"
+		}
+	}
+
+	writeResult(r, campaignURL(campaign.CampaignID), errs)
+}
+
+// PreorderStatusPost marks a pre-order collected or cancelled.
+func (pm *PreorderManager) PreorderStatusPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+	preorder, ok := pm.preorder(r, r.Get("preorder_id").String(), campaign.CampaignID)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	to := domain.PreorderStatus(r.Get("to").String())
+	switch err := pm.PreorderRepo.ChangeStatus(r.GetCtx(), preorder.PreorderID, to, r.Get("version").Int64()); {
+	case errors.Is(err, domain.ErrPreorderClosed):
+		errs["form"] = err.Error()
+	case errors.Is(err, data.ErrConflict):
+		errs["form"] = staleFormMessage
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "change preorder status: %v", err)
+		errs["form"] = "Failed to update pre-order"
+	}
+
+	writeResult(r, campaignURL(campaign.CampaignID), errs)
+}
+
+// PreorderDepositPost records a deposit received for a pre-order of the campaign.
+func (pm *PreorderManager) PreorderDepositPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	campaign, ok := pm.campaign(r)
+	if !ok {
+		return
+	}
+
+	errs := map[string]string{}
+	deposit := &domain.PreorderDeposit{Method: domain.PaymentMethod(r.Get("method").String())}
+	if preorderID := r.Get("preorder_id").String(); preorderID == "" {
+		errs["preorder_id"] = "Pre-order is required"
+	} else if preorder, ok := pm.preorder(r, preorderID, campaign.CampaignID); ok {
+		deposit.PreorderID = preorder.PreorderID
+	} else {
+		return
+	}
+	var err error
+	if deposit.ReceivedOn, err = time.Parse("2006-01-02", r.Get("received_on").String()); err != nil {
+		errs["received_on"] = "Date received must be a valid date"
+	}
+	validMethod := false
+	for _, method := range domain.PaymentMethods {
+		validMethod = validMethod || method == deposit.Method
+	}
+	if !validMethod {
+		errs["method"] = "Method must be one of the accepted payment methods"
+	}
+	if deposit.Amount, err = strconv.ParseFloat(strings.TrimSpace(r.Get("amount").String()), 64); err != nil || deposit.Amount <= 0 {
+		errs["amount"] = "Amount must be a positive number"
+	}
+	if reference := strings.TrimSpace(r.Get("reference").String()); reference != "" {
+		deposit.Reference = &reference
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		deposit.Audit.CreatedBy = &userIDStr
+		switch _, err := pm.PreorderRepo.AddDeposit(r.GetCtx(), deposit); {
+		case errors.Is(err, domain.ErrPreorderClosed):
+			errs["preorder_id"] = err.Error()
+		case err != nil:
+			g.Log().Errorf(r.GetCtx(), "add preorder deposit: %v", err)
+			errs["form"] = "Failed to record deposit"
+		}
+	}
+
+	writeResult(r, campaignURL(campaign.CampaignID), errs)
+}
+
+// campaign loads the campaign named in the route, writing the error response when it cannot.
+func (pm *PreorderManager) campaign(r *ghttp.Request) (*domain.PreorderCampaign, bool) {
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid campaign ID")
+		return nil, false
+	}
+
+	campaign, err := pm.PreorderRepo.FindCampaign(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Campaign not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find preorder campaign: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return campaign, true
+}
+
+// preorder loads a pre-order and checks it belongs to the campaign.
+func (pm *PreorderManager) preorder(r *ghttp.Request, idStr string, campaignID int64) (*domain.Preorder, bool) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid pre-order ID")
+		return nil, false
+	}
+
+	preorder, err := pm.PreorderRepo.FindByID(r.GetCtx(), id)
+	if err == nil && preorder.CampaignID != campaignID {
+		err = data.ErrNotFound
+	}
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Pre-order not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "find preorder: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return preorder, true
+}
+
+// campaignURL returns the page of a pre-order campaign.
+func campaignURL(id int64) string {
+	return fmt.Sprintf("%s/management/preorders/%d", middleware.BasePath(), id)
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type PriceListManager struct {
+	PriceListRepo data.PriceListRepo
+	ProductRepo   data.ProductRepo
+}
+
+// RegisterPriceListRoutes wires price list endpoints under /app.
+func RegisterPriceListRoutes(group *ghttp.RouterGroup, priceListRepo data.PriceListRepo, productRepo data.ProductRepo) {
+	plm := &PriceListManager{
+		PriceListRepo: priceListRepo,
+		ProductRepo:   productRepo,
+	}
+
+	// Price lists
+	group.GET("/management/price-lists", plm.PriceListsGet)
+	group.POST("/management/price-lists", plm.PriceListPost)
+	group.GET("/management/price-lists/new", plm.PriceListGet)
+	group.GET("/management/price-lists/:id", plm.PriceListGet)
+	group.PUT("/management/price-lists/:id", plm.PriceListPut)
+	group.DELETE("/management/price-lists/:id", plm.PriceListDelete)
+	group.POST("/management/price-lists/:id/items", plm.PriceListItemPost)
+	group.DELETE("/management/price-lists/:id/items/:item_id", plm.PriceListItemDelete)
+}
+
+// PriceListsGet renders the price lists page.
+func (plm *PriceListManager) PriceListsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	lists, err := plm.PriceListRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list price lists: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.PriceListsContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				lists,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PriceListsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			lists,
+		),
+	)
+}
+
+// PriceListPost creates a new price list and opens it to add prices.
+func (plm *PriceListManager) PriceListPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	list, errs := parsePriceListForm(r)
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	var id int64
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		list.Audit = domain.AuditFields{
+			CreatedBy: &userIDStr,
+			UpdatedBy: &userIDStr,
+		}
+
+		var err error
+		if id, err = plm.PriceListRepo.Create(r.GetCtx(), list); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create price list: %v", err)
+			errs["form"] = "Failed to create price list"
+		}
+	}
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(middleware.BasePath() + "/management/price-lists")
+		return
+	}
+
+	target := fmt.Sprintf("%s/management/price-lists/%d", middleware.BasePath(), id)
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", target)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(target)
+}
+
+// PriceListGet renders a price list with its prices, or a new price list form.
+func (plm *PriceListManager) PriceListGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	idStr := r.Get("id").String()
+	var list *domain.PriceList
+
+	if idStr != "" && idStr != "new" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid price list ID")
+			return
+		}
+
+		list, err = plm.PriceListRepo.FindByID(r.GetCtx(), id)
+		if err != nil {
+			if err == data.ErrNotFound {
+				r.Response.WriteStatusExit(404, "Price list not found")
+				return
+			}
+			g.Log().Errorf(r.GetCtx(), "find price list: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+
+	products, err := plm.ProductRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list products: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.PriceListContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				list,
+				products,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.PriceListPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			list,
+			products,
+		),
+	)
+}
+
+// PriceListPut updates the name, customer type and validity of a price list.
+func (plm *PriceListManager) PriceListPut(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid price list ID")
+		return
+	}
+
+	list, errs := parsePriceListForm(r)
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		list.PriceListID = id
+		list.Audit = domain.AuditFields{
+			UpdatedBy: &userIDStr,
+			Version:   r.Get("version").Int64(),
+		}
+
+		err := plm.PriceListRepo.Update(r.GetCtx(), list)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := plm.PriceListRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/price-lists/%d", middleware.BasePath(), id)
+				writeConflict(r, "Price List", recordURL, recordURL, current)
+				return
+			}
+		}
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "update price list: %v", err)
+			errs["form"] = "Failed to update price list"
+		}
+	}
+
+	target := fmt.Sprintf("%s/management/price-lists/%d", middleware.BasePath(), id)
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(target)
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", target)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(target)
+}
+
+// PriceListDelete soft deletes a price list.
+func (plm *PriceListManager) PriceListDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid price list ID")
+		return
+	}
+
+	if err := plm.PriceListRepo.SoftDelete(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete price list: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/price-lists")
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + "/management/price-lists")
+}
+
+// PriceListItemPost sets the price of a product in a price list.
+func (plm *PriceListManager) PriceListItemPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid price list ID")
+		return
+	}
+
+	productIDStr := strings.TrimSpace(r.Get("product_id").String())
+	unitPriceStr := strings.TrimSpace(r.Get("unit_price").String())
+
+	errs := map[string]string{}
+	productID, err := strconv.ParseInt(productIDStr, 10, 64)
+	if err != nil {
+		errs["product_id"] = "Product is required"
+	}
+	unitPrice, err := strconv.ParseFloat(unitPriceStr, 64)
+	if err != nil || unitPrice < 0 {
+		errs["unit_price"] = "Unit price must be a non-negative number"
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		item := &domain.PriceListItem{
+			PriceListID: id,
+			ProductID:   productID,
+			UnitPrice:   unitPrice,
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		switch err := plm.PriceListRepo.SetItemPrice(r.GetCtx(), item, r.Get("version").Int64()); {
+		case err == nil:
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case errors.Is(err, data.ErrNotFound):
+			r.Response.WriteStatusExit(404, "Price list not found")
+			return
+		default:
+			g.Log().Errorf(r.GetCtx(), "set price list item: %v", err)
+			errs["form"] = "Failed to save price"
+		}
+	}
+
+	target := fmt.Sprintf("%s/management/price-lists/%d", middleware.BasePath(), id)
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(target)
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", target)
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(target)
+}
+
+// PriceListItemDelete removes a product price from a price list.
+func (plm *PriceListManager) PriceListItemDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid price list ID")
+		return
+	}
+	itemID, err := strconv.ParseInt(r.Get("item_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid price list item ID")
+		return
+	}
+
+	errs := map[string]string{}
+	switch err := plm.PriceListRepo.DeleteItem(r.GetCtx(), id, itemID, r.Get("version").Int64(), time.Now()); {
+	case errors.Is(err, data.ErrConflict):
+		errs["form"] = staleFormMessage
+	case errors.Is(err, data.ErrNotFound):
+		r.Response.WriteStatusExit(404, "Price not found")
+		return
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "delete price list item: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, fmt.Sprintf("%s/management/price-lists/%d", middleware.BasePath(), id), errs)
+}
+
+// parsePriceListForm reads and validates the price list header fields shared by create and update.
+func parsePriceListForm(r *ghttp.Request) (*domain.PriceList, map[string]string) {
+	name := strings.TrimSpace(r.Get("name").String())
+	customerType := strings.TrimSpace(r.Get("customer_type").String())
+	validFromStr := strings.TrimSpace(r.Get("valid_from").String())
+	validToStr := strings.TrimSpace(r.Get("valid_to").String())
+
+	errs := map[string]string{}
+	if name == "" {
+		errs["name"] = "Name is required"
+	}
+
+	var custType *string
+	if customerType != "" {
+		custType = &customerType
+	}
+
+	var validFrom, validTo *time.Time
+	if validFromStr != "" {
+		if t, err := time.Parse("2006-01-02", validFromStr); err == nil {
+			validFrom = &t
+		} else {
+			errs["valid_from"] = "Valid from must be a valid date (YYYY-MM-DD)"
+		}
+	}
+	if validToStr != "" {
+		if t, err := time.Parse("2006-01-02", validToStr); err == nil {
+			validTo = &t
+		} else {
+			errs["valid_to"] = "Valid to must be a valid date (YYYY-MM-DD)"
+		}
+	}
+	if validFrom != nil && validTo != nil && validTo.Before(*validFrom) {
+		errs["valid_to"] = "Valid to must not be before valid from"
+	}
+
+	return &domain.PriceList{
+		Name:         name,
+		CustomerType: custType,
+		ValidFrom:    validFrom,
+		ValidTo:      validTo,
+	}, errs
+}
@@ -0,0 +1,343 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type ProductManager struct {
+	ProductRepo data.ProductRepo
+	Events      *events.Bus
+}
+
+// RegisterProductRoutes wires product catalog endpoints under /app.
+func RegisterProductRoutes(group *ghttp.RouterGroup, productRepo data.ProductRepo, bus *events.Bus) {
+	pm := &ProductManager{
+		ProductRepo: productRepo,
+		Events:      bus,
+	}
+
+	// Product catalog
+	group.GET("/management/products", pm.ProductsGet)
+	group.GET("/management/products/stream", pm.ProductsStream)
+	group.POST("/management/products", pm.ProductPost)
+	group.GET("/management/products/new", pm.ProductGet)
+	group.GET("/management/products/:id", pm.ProductGet)
+	group.PUT("/management/products/:id", pm.ProductPut)
+	group.DELETE("/management/products/:id", pm.ProductDelete)
+}
+
+// ProductsGet renders the product catalog page.
+func (pm *ProductManager) ProductsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	products, err := pm.ProductRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list products: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.ProductsContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				products,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ProductsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			products,
+		),
+	)
+}
+
+// ProductsStream keeps the product catalogue up to date over server-sent events.
+func (pm *ProductManager) ProductsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, pm.Events, func(ctx context.Context) (templ.Component, error) {
+		products, err := pm.ProductRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.ProductsList(basePath, csrf, products), nil
+	}, "products")
+}
+
+// ProductPost creates a new product.
+func (pm *ProductManager) ProductPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	product, errs := parseProductForm(r)
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		product.Audit = domain.AuditFields{
+			CreatedBy: &userIDStr,
+			UpdatedBy: &userIDStr,
+		}
+
+		if _, err := pm.ProductRepo.Create(r.GetCtx(), product); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create product: %v", err)
+			errs["form"] = "Failed to create product (is the SKU unique?)"
+		}
+	}
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(middleware.BasePath() + "/management/products")
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/products")
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + "/management/products")
+}
+
+// ProductGet renders a specific product for editing or a new product form.
+func (pm *ProductManager) ProductGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	idStr := r.Get("id").String()
+	var product *domain.Product
+
+	if idStr != "" && idStr != "new" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid product ID")
+			return
+		}
+
+		product, err = pm.ProductRepo.FindByID(r.GetCtx(), id)
+		if err != nil {
+			if err == data.ErrNotFound {
+				r.Response.WriteStatusExit(404, "Product not found")
+				return
+			}
+			g.Log().Errorf(r.GetCtx(), "find product: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.ProductContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				product,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ProductPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			product,
+		),
+	)
+}
+
+// ProductPut updates an existing product.
+func (pm *ProductManager) ProductPut(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid product ID")
+		return
+	}
+
+	product, errs := parseProductForm(r)
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		product.ProductID = id
+		product.Audit = domain.AuditFields{
+			UpdatedBy: &userIDStr,
+			Version:   r.Get("version").Int64(),
+		}
+
+		err := pm.ProductRepo.Update(r.GetCtx(), product)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := pm.ProductRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/products/%d", middleware.BasePath(), id)
+				writeConflict(r, "Product", recordURL, recordURL, current)
+				return
+			}
+		}
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "update product: %v", err)
+			errs["form"] = "Failed to update product (is the SKU unique?)"
+		}
+	}
+
+	if len(errs) > 0 {
+		if isDataStarRequest {
+			// For DataStar requests, return validation errors
+			r.Response.Header().Set("Content-Type", "application/json")
+			r.Response.WriteJson(map[string]interface{}{
+				"errors": errs,
+			})
+			return
+		}
+		r.Response.RedirectTo(fmt.Sprintf("%s/management/products/%d", middleware.BasePath(), id))
+		return
+	}
+
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/products")
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + "/management/products")
+}
+
+// ProductDelete soft deletes a product.
+func (pm *ProductManager) ProductDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+	if !sharedDataAccess(r) {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid product ID")
+		return
+	}
+
+	if err := pm.ProductRepo.SoftDelete(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete product: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		// For DataStar requests, redirect via JavaScript
+		js := fmt.Sprintf("window.location.href = %q;", middleware.BasePath()+"/management/products")
+		r.Response.Header().Set("Content-Type", "text/javascript")
+		r.Response.Write([]byte(js))
+		return
+	}
+
+	r.Response.RedirectTo(middleware.BasePath() + "/management/products")
+}
+
+// parseProductForm reads and validates the product form fields shared by create and update.
+func parseProductForm(r *ghttp.Request) (*domain.Product, map[string]string) {
+	sku := strings.ToUpper(strings.TrimSpace(r.Get("sku").String()))
+	name := strings.TrimSpace(r.Get("name").String())
+	unit := strings.TrimSpace(r.Get("unit").String())
+	vatRateStr := strings.TrimSpace(r.Get("vat_rate").String())
+	description := strings.TrimSpace(r.Get("description").String())
+
+	errs := map[string]string{}
+	if sku == "" {
+		errs["sku"] = "SKU is required"
+	}
+	if name == "" {
+		errs["name"] = "Name is required"
+	}
+	if unit == "" {
+		unit = domain.ProductUnits[0]
+	}
+
+	var vatRate float64
+	if vatRateStr != "" {
+		if val, err := strconv.ParseFloat(vatRateStr, 64); err == nil && val >= 0 && val <= 100 {
+			vatRate = val
+		} else {
+			errs["vat_rate"] = "VAT rate must be a percentage between 0 and 100"
+		}
+	}
+
+	var desc *string
+	if description != "" {
+		desc = &description
+	}
+
+	return &domain.Product{
+		SKU:         sku,
+		Name:        name,
+		Unit:        unit,
+		VATRate:     vatRate,
+		Description: desc,
+		Active:      r.Get("active").Bool(),
+	}, errs
+}
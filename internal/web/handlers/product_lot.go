@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// ProductLotPost packs a product lot from a slaughter, adding it to the sellable stock.
+func (srm *SlaughterRecordManager) ProductLotPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	slaughterID, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid slaughter record ID")
+		return
+	}
+	if _, err := srm.SlaughterRecordRepo.FindByID(r.GetCtx(), slaughterID); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Slaughter record not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find slaughter record: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	lot, errs := parseProductLotForm(r)
+	if len(errs) == 0 {
+		lot.SlaughterID = slaughterID
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		lot.Audit.CreatedBy = &userIDStr
+		lot.Audit.UpdatedBy = &userIDStr
+		if _, err := srm.ProductLotRepo.Create(r.GetCtx(), lot); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create product lot: %v", err)
+			errs["form"] = "Failed to create product lot"
+		}
+	}
+
+	writeResult(r, fmt.Sprintf("%s/management/slaughter-records/%d", middleware.BasePath(), slaughterID), errs)
+}
+
+// ProductLotDelete removes a product lot that no order has reserved stock from.
+func (srm *SlaughterRecordManager) ProductLotDelete(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	slaughterID, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid slaughter record ID")
+		return
+	}
+	lotID, err := strconv.ParseInt(r.Get("lot_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid product lot ID")
+		return
+	}
+
+	errs := map[string]string{}
+	switch err := srm.ProductLotRepo.SoftDelete(r.GetCtx(), lotID, time.Now()); {
+	case err == data.ErrNotFound:
+		r.Response.WriteStatusExit(404, "Product lot not found")
+		return
+	case err == domain.ErrLotReserved:
+		errs["form"] = err.Error()
+	case err != nil:
+		g.Log().Errorf(r.GetCtx(), "delete product lot: %v", err)
+		errs["form"] = "Failed to delete product lot"
+	}
+
+	writeResult(r, fmt.Sprintf("%s/management/slaughter-records/%d", middleware.BasePath(), slaughterID), errs)
+}
+
+func parseProductLotForm(r *ghttp.Request) (*domain.ProductLot, map[string]string) {
+	errs := map[string]string{}
+	lot := &domain.ProductLot{}
+
+	productID, err := strconv.ParseInt(r.Get("product_id").String(), 10, 64)
+	if err != nil || productID <= 0 {
+		errs["product_id"] = "Product is required"
+	}
+	lot.ProductID = productID
+
+	if weight := strings.TrimSpace(r.Get("weight_kg").String()); weight != "" {
+		if lot.WeightKg, err = strconv.ParseFloat(weight, 64); err != nil || lot.WeightKg < 0 {
+			errs["weight_kg"] = "Weight must be a non-negative number"
+		}
+	}
+	if count := strings.TrimSpace(r.Get("piece_count").String()); count != "" {
+		if lot.PieceCount, err = strconv.Atoi(count); err != nil || lot.PieceCount < 0 {
+			errs["piece_count"] = "Count must be a non-negative whole number"
+		}
+	}
+	if lot.WeightKg == 0 && lot.PieceCount == 0 {
+		errs["weight_kg"] = "Enter the weight or the count of the lot"
+	}
+
+	if lot.PackingDate, err = time.Parse("2006-01-02", r.Get("packing_date").String()); err != nil {
+		errs["packing_date"] = "Packing date must be a valid date"
+	}
+	if useBy := r.Get("use_by_date").String(); useBy != "" {
+		day, err := time.Parse("2006-01-02", useBy)
+		switch {
+		case err != nil:
+			errs["use_by_date"] = "Use-by date must be a valid date"
+		case day.Before(lot.PackingDate):
+			errs["use_by_date"] = "Use-by date cannot be before the packing date"
+		default:
+			lot.UseByDate = &day
+		}
+	}
+
+	return lot, errs
+}
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -18,18 +22,21 @@ type ProductionBatchManager struct {
 	ProductionBatchRepo data.ProductionBatchRepo
 	FlockRepo           data.FlockRepo
 	StaffRepo           data.StaffRepo
+	Events              *events.Bus
 }
 
 // RegisterProductionBatchRoutes wires production batch management endpoints under /app.
-func RegisterProductionBatchRoutes(group *ghttp.RouterGroup, productionBatchRepo data.ProductionBatchRepo, flockRepo data.FlockRepo, staffRepo data.StaffRepo) {
+func RegisterProductionBatchRoutes(group *ghttp.RouterGroup, productionBatchRepo data.ProductionBatchRepo, flockRepo data.FlockRepo, staffRepo data.StaffRepo, bus *events.Bus) {
 	pbm := &ProductionBatchManager{
 		ProductionBatchRepo: productionBatchRepo,
 		FlockRepo:           flockRepo,
 		StaffRepo:           staffRepo,
+		Events:              bus,
 	}
 
 	// Production batch management
 	group.GET("/management/production-batches", pbm.ProductionBatchesGet)
+	group.GET("/management/production-batches/stream", pbm.ProductionBatchesStream)
 	group.POST("/management/production-batches", pbm.ProductionBatchPost)
 	group.GET("/management/production-batches/new", pbm.ProductionBatchGet)
 	group.GET("/management/production-batches/:id", pbm.ProductionBatchGet)
@@ -77,6 +84,18 @@ func (pbm *ProductionBatchManager) ProductionBatchesGet(r *ghttp.Request) {
 	)
 }
 
+// ProductionBatchesStream keeps the production batch list up to date over server-sent events.
+func (pbm *ProductionBatchManager) ProductionBatchesStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, pbm.Events, func(ctx context.Context) (templ.Component, error) {
+		productionBatches, err := pbm.ProductionBatchRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.ProductionBatchesList(basePath, csrf, productionBatches), nil
+	}, "production_batches")
+}
+
 // ProductionBatchPost creates a new production batch.
 func (pbm *ProductionBatchManager) ProductionBatchPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -343,10 +362,18 @@ func (pbm *ProductionBatchManager) ProductionBatchPut(r *ghttp.Request) {
 			Notes:          notesPtr,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := pbm.ProductionBatchRepo.Update(r.GetCtx(), productionBatch)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := pbm.ProductionBatchRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/production-batches/%d", middleware.BasePath(), id)
+				writeConflict(r, "Production Batch", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update production batch: %v", err)
 			errs["form"] = "Failed to update production batch"
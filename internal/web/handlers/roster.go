@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/ical"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// rosterFeedPast and rosterFeedAhead bound the shifts a roster feed carries around today.
+const (
+	rosterFeedPast  = 30
+	rosterFeedAhead = 180
+)
+
+// RegisterRosterFeedRoutes wires the staff roster iCalendar feeds. Calendar apps cannot sign in,
+// so the feeds are public and protected by each staff member's secret calendar token.
+func RegisterRosterFeedRoutes(group *ghttp.RouterGroup, staffRepo data.StaffRepo, rosterRepo data.RosterRepo) {
+	sm := &StaffManager{
+		StaffRepo:  staffRepo,
+		RosterRepo: rosterRepo,
+	}
+
+	group.GET("/calendar/:token", sm.RosterFeedGet)
+}
+
+// RosterGet renders the shift roster as a week or month calendar.
+func (sm *StaffManager) RosterGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	view := domain.RosterView(r.Get("view").String())
+	if view != domain.RosterMonth {
+		view = domain.RosterWeek
+	}
+	focus := today()
+	if v := strings.TrimSpace(r.Get("date").String()); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid date")
+			return
+		}
+		focus = parsed
+	}
+	var staffID *int64
+	if v := strings.TrimSpace(r.Get("staff_id").String()); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid staff ID")
+			return
+		}
+		staffID = &id
+	}
+
+	ctx := r.GetCtx()
+	from, to := domain.RosterRange(view, focus)
+	shifts, err := sm.RosterRepo.ListShifts(ctx, from, to, staffID)
+	if err != nil {
+		g.Log().Errorf(ctx, "list shifts: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	templates, err := sm.RosterRepo.ListTemplates(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list shift templates: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	staff, err := sm.StaffRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list staff: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	barns, err := sm.BarnRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list barns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	calendar := &pages.RosterCalendar{
+		View:    view,
+		Focus:   focus,
+		Prev:    domain.RosterStep(view, focus, -1),
+		Next:    domain.RosterStep(view, focus, 1),
+		StaffID: staffID,
+		Days:    domain.BuildRosterCalendar(from, to, focus, shifts),
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.RosterContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				calendar,
+				templates,
+				staff,
+				barns,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.RosterPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			calendar,
+			templates,
+			staff,
+			barns,
+		),
+	)
+}
+
+// ShiftPost assigns a staff member to a shift on a day, refusing double bookings and shifts
+// that cut into the daily rest.
+func (sm *StaffManager) ShiftPost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	dateStr := strings.TrimSpace(r.Get("shift_date").String())
+	templateIDStr := strings.TrimSpace(r.Get("shift_template_id").String())
+	staffIDStr := strings.TrimSpace(r.Get("staff_id").String())
+	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
+
+	errs := map[string]string{}
+	shiftDate, err := time.ParseInLocation("2006-01-02", dateStr, time.Local)
+	if err != nil {
+		errs["shift_date"] = "Date is required"
+	}
+	templateID, err := strconv.ParseInt(templateIDStr, 10, 64)
+	if err != nil {
+		errs["shift_template_id"] = "Shift is required"
+	}
+	staffID, err := strconv.ParseInt(staffIDStr, 10, 64)
+	if err != nil {
+		errs["staff_id"] = "Staff member is required"
+	}
+	var barnID *int64
+	if barnIDStr != "" {
+		id, err := strconv.ParseInt(barnIDStr, 10, 64)
+		if err != nil {
+			errs["barn_id"] = "Invalid barn"
+		}
+		barnID = &id
+	}
+
+	ctx := r.GetCtx()
+	var tmpl *domain.ShiftTemplate
+	if len(errs) == 0 {
+		if tmpl, err = sm.RosterRepo.FindTemplate(ctx, templateID); err != nil {
+			if err != data.ErrNotFound {
+				g.Log().Errorf(ctx, "find shift template: %v", err)
+			}
+			errs["shift_template_id"] = "Shift not found"
+		}
+	}
+
+	if len(errs) == 0 {
+		start, end, err := tmpl.Span(shiftDate)
+		if err != nil {
+			errs["shift_template_id"] = err.Error()
+		}
+		if barnID == nil {
+			barnID = tmpl.BarnID
+		}
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		shift := &domain.Shift{
+			ShiftTemplateID: templateID,
+			StaffID:         staffID,
+			BarnID:          barnID,
+			ShiftDate:       shiftDate,
+			StartsAt:        start,
+			EndsAt:          end,
+			Notes:           optionalText(r, "notes"),
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if len(errs) == 0 {
+			_, err := sm.RosterRepo.AssignShift(ctx, shift, models.FarmProfileFromEnv().MinDailyRest)
+			var conflict *domain.ShiftConflictError
+			if errors.As(err, &conflict) {
+				errs["staff_id"] = conflict.Error()
+			} else if err != nil {
+				g.Log().Errorf(ctx, "assign shift: %v", err)
+				errs["form"] = "Failed to assign the shift"
+			}
+		}
+	}
+
+	writeResult(r, rosterURL(domain.RosterWeek, shiftDate), errs)
+}
+
+// ShiftDelete takes a shift off the roster.
+func (sm *StaffManager) ShiftDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("shift_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid shift ID")
+		return
+	}
+	if err := sm.RosterRepo.DeleteShift(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete shift: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	target := middleware.BasePath() + "/management/roster"
+	if referer, err := url.Parse(r.Referer()); err == nil && referer.Path == target {
+		target += "?" + referer.RawQuery
+	}
+	writeResult(r, target, nil)
+}
+
+// ShiftTemplatePost adds a shift template.
+func (sm *StaffManager) ShiftTemplatePost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	name := strings.TrimSpace(r.Get("name").String())
+	startTime := strings.TrimSpace(r.Get("start_time").String())
+	endTime := strings.TrimSpace(r.Get("end_time").String())
+	barnIDStr := strings.TrimSpace(r.Get("template_barn_id").String())
+
+	errs := map[string]string{}
+	if name == "" {
+		errs["name"] = "Name is required"
+	}
+	if err := domain.ValidateClock(startTime); err != nil {
+		errs["start_time"] = err.Error()
+	}
+	if err := domain.ValidateClock(endTime); err != nil {
+		errs["end_time"] = err.Error()
+	}
+	var barnID *int64
+	if barnIDStr != "" {
+		id, err := strconv.ParseInt(barnIDStr, 10, 64)
+		if err != nil {
+			errs["template_barn_id"] = "Invalid barn"
+		}
+		barnID = &id
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		tmpl := &domain.ShiftTemplate{
+			Name:      name,
+			StartTime: startTime,
+			EndTime:   endTime,
+			BarnID:    barnID,
+			Notes:     optionalText(r, "template_notes"),
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := sm.RosterRepo.CreateTemplate(r.GetCtx(), tmpl); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create shift template: %v", err)
+			errs["form"] = "Failed to create the shift template"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/roster", errs)
+}
+
+// ShiftTemplateDelete removes a shift template; shifts already rostered from it stay.
+func (sm *StaffManager) ShiftTemplateDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("template_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid shift template ID")
+		return
+	}
+	if err := sm.RosterRepo.DeleteTemplate(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete shift template: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/roster", nil)
+}
+
+// CalendarTokenPost gives a staff member a new roster feed URL; the previous URL stops working.
+func (sm *StaffManager) CalendarTokenPost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid staff ID")
+		return
+	}
+
+	token, err := newCalendarToken()
+	if err == nil {
+		err = sm.StaffRepo.SetCalendarToken(r.GetCtx(), id, token)
+	}
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "set calendar token: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, fmt.Sprintf("%s/management/staff/%d", middleware.BasePath(), id), nil)
+}
+
+// RosterFeedGet serves a staff member's shifts as an iCalendar feed.
+func (sm *StaffManager) RosterFeedGet(r *ghttp.Request) {
+	token := strings.TrimSuffix(r.Get("token").String(), ".ics")
+	if token == "" {
+		r.Response.WriteStatusExit(404, "Not found")
+		return
+	}
+
+	ctx := r.GetCtx()
+	staff, err := sm.StaffRepo.FindByCalendarToken(ctx, token)
+	if err != nil {
+		if err != data.ErrNotFound {
+			g.Log().Errorf(ctx, "find staff by calendar token: %v", err)
+		}
+		r.Response.WriteStatusExit(404, "Not found")
+		return
+	}
+	// The feed has no session: the shifts are those of the farm the staff member works on.
+	ctx = data.WithFarm(ctx, staff.FarmID)
+
+	day := today()
+	shifts, err := sm.RosterRepo.ListShifts(ctx, day.AddDate(0, 0, -rosterFeedPast), day.AddDate(0, 0, rosterFeedAhead), &staff.StaffID)
+	if err != nil {
+		g.Log().Errorf(ctx, "list shifts: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	farm := models.FarmProfileFromEnv()
+	cal := &ical.Calendar{Name: farm.Name + " roster · " + staff.Name}
+	for _, s := range shifts {
+		event := ical.Event{
+			UID:     fmt.Sprintf("shift-%d@farm-manager", s.ShiftID),
+			Start:   s.StartsAt,
+			End:     s.EndsAt,
+			Summary: s.TemplateName,
+		}
+		if s.BarnName != nil {
+			event.Location = *s.BarnName
+			event.Summary += " · " + *s.BarnName
+		}
+		if s.Notes != nil {
+			event.Description = *s.Notes
+		}
+		cal.Events = append(cal.Events, event)
+	}
+
+	r.Response.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	r.Response.Header().Set("Content-Disposition", `inline; filename="roster.ics"`)
+	if err := cal.Encode(r.Response.Writer, time.Now()); err != nil {
+		g.Log().Errorf(ctx, "write roster feed: %v", err)
+	}
+}
+
+// rosterURL is the roster calendar around day.
+func rosterURL(view domain.RosterView, day time.Time) string {
+	return fmt.Sprintf("%s/management/roster?view=%s&date=%s", middleware.BasePath(), view, day.Format("2006-01-02"))
+}
+
+// calendarFeedURL is the absolute URL of a roster feed, for pasting into a calendar app.
+func calendarFeedURL(r *ghttp.Request, token string) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s/calendar/%s.ics", scheme, r.Host, middleware.BasePath(), token)
+}
+
+// newCalendarToken returns a random, URL-safe calendar token.
+func newCalendarToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
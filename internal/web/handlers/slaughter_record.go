@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -18,23 +22,35 @@ type SlaughterRecordManager struct {
 	SlaughterRecordRepo data.SlaughterRecordRepo
 	ProductionBatchRepo data.ProductionBatchRepo
 	StaffRepo           data.StaffRepo
+	ProductLotRepo      data.ProductLotRepo
+	ProductRepo         data.ProductRepo
+	Events              *events.Bus
 }
 
-// RegisterSlaughterRecordRoutes wires slaughter record management endpoints under /app.
-func RegisterSlaughterRecordRoutes(group *ghttp.RouterGroup, slaughterRecordRepo data.SlaughterRecordRepo, productionBatchRepo data.ProductionBatchRepo, staffRepo data.StaffRepo) {
+// RegisterSlaughterRecordRoutes wires slaughter record management endpoints, including the
+// product lots packed from each slaughter, under /app.
+func RegisterSlaughterRecordRoutes(group *ghttp.RouterGroup, slaughterRecordRepo data.SlaughterRecordRepo, productionBatchRepo data.ProductionBatchRepo, staffRepo data.StaffRepo, productLotRepo data.ProductLotRepo, productRepo data.ProductRepo, bus *events.Bus) {
 	srm := &SlaughterRecordManager{
 		SlaughterRecordRepo: slaughterRecordRepo,
 		ProductionBatchRepo: productionBatchRepo,
 		StaffRepo:           staffRepo,
+		ProductLotRepo:      productLotRepo,
+		ProductRepo:         productRepo,
+		Events:              bus,
 	}
 
 	// Slaughter record management
 	group.GET("/management/slaughter-records", srm.SlaughterRecordsGet)
+	group.GET("/management/slaughter-records/stream", srm.SlaughterRecordsStream)
 	group.POST("/management/slaughter-records", srm.SlaughterRecordPost)
 	group.GET("/management/slaughter-records/new", srm.SlaughterRecordGet)
 	group.GET("/management/slaughter-records/:id", srm.SlaughterRecordGet)
 	group.PUT("/management/slaughter-records/:id", srm.SlaughterRecordPut)
 	group.DELETE("/management/slaughter-records/:id", srm.SlaughterRecordDelete)
+
+	// Product lots packed from a slaughter
+	group.POST("/management/slaughter-records/:id/lots", srm.ProductLotPost)
+	group.DELETE("/management/slaughter-records/:id/lots/:lot_id", srm.ProductLotDelete)
 }
 
 // SlaughterRecordsGet renders the slaughter records management page.
@@ -77,6 +93,18 @@ func (srm *SlaughterRecordManager) SlaughterRecordsGet(r *ghttp.Request) {
 	)
 }
 
+// SlaughterRecordsStream keeps the slaughter record list up to date over server-sent events.
+func (srm *SlaughterRecordManager) SlaughterRecordsStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, srm.Events, func(ctx context.Context) (templ.Component, error) {
+		slaughterRecords, err := srm.SlaughterRecordRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.SlaughterRecordsList(basePath, csrf, slaughterRecords), nil
+	}, "slaughter_records")
+}
+
 // SlaughterRecordPost creates a new slaughter record.
 func (srm *SlaughterRecordManager) SlaughterRecordPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -251,6 +279,21 @@ func (srm *SlaughterRecordManager) SlaughterRecordGet(r *ghttp.Request) {
 		return
 	}
 
+	// Product lots are packed once the slaughter is recorded
+	lots := pages.SlaughterLots{}
+	if slaughterRecord != nil {
+		if lots.Lots, err = srm.ProductLotRepo.ListBySlaughter(r.GetCtx(), slaughterRecord.SlaughterID); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list product lots: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+		if lots.Products, err = srm.ProductRepo.List(r.GetCtx()); err != nil {
+			g.Log().Errorf(r.GetCtx(), "list products: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -261,6 +304,7 @@ func (srm *SlaughterRecordManager) SlaughterRecordGet(r *ghttp.Request) {
 				slaughterRecord,
 				productionBatches,
 				staff,
+				lots,
 			),
 		)
 		return
@@ -276,6 +320,7 @@ func (srm *SlaughterRecordManager) SlaughterRecordGet(r *ghttp.Request) {
 			slaughterRecord,
 			productionBatches,
 			staff,
+			lots,
 		),
 	)
 }
@@ -375,10 +420,18 @@ func (srm *SlaughterRecordManager) SlaughterRecordPut(r *ghttp.Request) {
 			StaffID:           staffID,
 			Audit: domain.AuditFields{
 				UpdatedBy: &userIDStr,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := srm.SlaughterRecordRepo.Update(r.GetCtx(), slaughterRecord)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := srm.SlaughterRecordRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/slaughter-records/%d", middleware.BasePath(), id)
+				writeConflict(r, "Slaughter Record", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update slaughter record: %v", err)
 			errs["form"] = "Failed to update slaughter record"
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/a-h/templ"
 	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/events"
 	"github.com/cr1cr1/farm-manager/internal/web/middleware"
 	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
 	"github.com/gogf/gf/v2/frame/g"
@@ -15,22 +19,37 @@ import (
 )
 
 type StaffManager struct {
-	StaffRepo data.StaffRepo
+	StaffRepo  data.StaffRepo
+	RosterRepo data.RosterRepo
+	BarnRepo   data.BarnRepo
+	Events     *events.Bus
 }
 
-// RegisterStaffRoutes wires staff management endpoints under /app.
-func RegisterStaffRoutes(group *ghttp.RouterGroup, staffRepo data.StaffRepo) {
+// RegisterStaffRoutes wires staff management and shift roster endpoints under /app.
+func RegisterStaffRoutes(group *ghttp.RouterGroup, staffRepo data.StaffRepo, rosterRepo data.RosterRepo, barnRepo data.BarnRepo, bus *events.Bus) {
 	sm := &StaffManager{
-		StaffRepo: staffRepo,
+		StaffRepo:  staffRepo,
+		RosterRepo: rosterRepo,
+		BarnRepo:   barnRepo,
+		Events:     bus,
 	}
 
 	// Staff management
 	group.GET("/management/staff", sm.StaffGet)
+	group.GET("/management/staff/stream", sm.StaffStream)
 	group.POST("/management/staff", sm.StaffPost)
 	group.GET("/management/staff/:id", sm.StaffGetByID)
 	group.GET("/management/staff/new", sm.StaffGetByID)
 	group.PUT("/management/staff/:id", sm.StaffPut)
 	group.DELETE("/management/staff/:id", sm.StaffDelete)
+	group.POST("/management/staff/:id/calendar-token", sm.CalendarTokenPost)
+
+	// Shift roster
+	group.GET("/management/roster", sm.RosterGet)
+	group.POST("/management/roster/shifts", sm.ShiftPost)
+	group.DELETE("/management/roster/shifts/:shift_id", sm.ShiftDelete)
+	group.POST("/management/roster/templates", sm.ShiftTemplatePost)
+	group.DELETE("/management/roster/templates/:template_id", sm.ShiftTemplateDelete)
 }
 
 // StaffGet renders the staff management page.
@@ -73,6 +92,18 @@ func (sm *StaffManager) StaffGet(r *ghttp.Request) {
 	)
 }
 
+// StaffStream keeps the staff list up to date over server-sent events.
+func (sm *StaffManager) StaffStream(r *ghttp.Request) {
+	basePath, csrf := middleware.BasePath(), middleware.CsrfToken(r)
+	streamLive(r, sm.Events, func(ctx context.Context) (templ.Component, error) {
+		staff, err := sm.StaffRepo.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return pages.StaffList(basePath, csrf, staff), nil
+	}, "staff")
+}
+
 // StaffPost creates a new staff member.
 func (sm *StaffManager) StaffPost(r *ghttp.Request) {
 	user, ok := middleware.CurrentUser(r)
@@ -85,6 +116,7 @@ func (sm *StaffManager) StaffPost(r *ghttp.Request) {
 	role := strings.TrimSpace(r.Get("role").String())
 	schedule := strings.TrimSpace(r.Get("schedule").String())
 	contactInfo := strings.TrimSpace(r.Get("contact_info").String())
+	hourlyRateStr := strings.TrimSpace(r.Get("hourly_rate").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -109,6 +141,16 @@ func (sm *StaffManager) StaffPost(r *ghttp.Request) {
 		*contact = contactInfo
 	}
 
+	var hourlyRate *float64
+	if hourlyRateStr != "" {
+		if rateVal, err := strconv.ParseFloat(hourlyRateStr, 64); err == nil && rateVal >= 0 {
+			hourlyRate = new(float64)
+			*hourlyRate = rateVal
+		} else {
+			errs["hourly_rate"] = "Hourly rate must be a number of zero or more"
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -122,6 +164,7 @@ func (sm *StaffManager) StaffPost(r *ghttp.Request) {
 			Role:        rol,
 			Schedule:    sched,
 			ContactInfo: contact,
+			HourlyRate:  hourlyRate,
 			Audit: domain.AuditFields{
 				CreatedBy: createdBy,
 				UpdatedBy: updatedBy,
@@ -192,6 +235,11 @@ func (sm *StaffManager) StaffGetByID(r *ghttp.Request) {
 		}
 	}
 
+	var calendarURL string
+	if staff != nil && staff.CalendarToken != nil {
+		calendarURL = calendarFeedURL(r, *staff.CalendarToken)
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 	if isDataStarRequest {
 		_ = middleware.TemplRender(
@@ -200,6 +248,7 @@ func (sm *StaffManager) StaffGetByID(r *ghttp.Request) {
 				middleware.BasePath(),
 				middleware.CsrfToken(r),
 				staff,
+				calendarURL,
 			),
 		)
 		return
@@ -213,6 +262,7 @@ func (sm *StaffManager) StaffGetByID(r *ghttp.Request) {
 			user.Username,
 			ThemeToString(user.Theme),
 			staff,
+			calendarURL,
 		),
 	)
 }
@@ -236,6 +286,7 @@ func (sm *StaffManager) StaffPut(r *ghttp.Request) {
 	role := strings.TrimSpace(r.Get("role").String())
 	schedule := strings.TrimSpace(r.Get("schedule").String())
 	contactInfo := strings.TrimSpace(r.Get("contact_info").String())
+	hourlyRateStr := strings.TrimSpace(r.Get("hourly_rate").String())
 
 	errs := map[string]string{}
 	if name == "" {
@@ -260,6 +311,16 @@ func (sm *StaffManager) StaffPut(r *ghttp.Request) {
 		*contact = contactInfo
 	}
 
+	var hourlyRate *float64
+	if hourlyRateStr != "" {
+		if rateVal, err := strconv.ParseFloat(hourlyRateStr, 64); err == nil && rateVal >= 0 {
+			hourlyRate = new(float64)
+			*hourlyRate = rateVal
+		} else {
+			errs["hourly_rate"] = "Hourly rate must be a number of zero or more"
+		}
+	}
+
 	isDataStarRequest := r.Header.Get("datastar-request") == "true"
 
 	if len(errs) == 0 {
@@ -272,12 +333,21 @@ func (sm *StaffManager) StaffPut(r *ghttp.Request) {
 			Role:        rol,
 			Schedule:    sched,
 			ContactInfo: contact,
+			HourlyRate:  hourlyRate,
 			Audit: domain.AuditFields{
 				UpdatedBy: updatedBy,
+				Version:   r.Get("version").Int64(),
 			},
 		}
 
 		err := sm.StaffRepo.Update(r.GetCtx(), staff)
+		if errors.Is(err, data.ErrConflict) {
+			if current, findErr := sm.StaffRepo.FindByID(r.GetCtx(), id); findErr == nil {
+				recordURL := fmt.Sprintf("%s/management/staff/%d", middleware.BasePath(), id)
+				writeConflict(r, "Staff Member", recordURL, recordURL, current)
+				return
+			}
+		}
 		if err != nil {
 			g.Log().Errorf(r.GetCtx(), "update staff: %v", err)
 			errs["form"] = "Failed to update staff member"
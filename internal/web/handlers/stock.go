@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type StockManager struct {
+	ProductLotRepo data.ProductLotRepo
+}
+
+// RegisterStockRoutes wires the sellable stock overview under /app.
+func RegisterStockRoutes(group *ghttp.RouterGroup, productLotRepo data.ProductLotRepo) {
+	sm := &StockManager{ProductLotRepo: productLotRepo}
+
+	group.GET("/management/stock", sm.StockGet)
+}
+
+// StockGet renders the sellable finished-goods stock per product.
+func (sm *StockManager) StockGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	lots, err := sm.ProductLotRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list product lots: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	day := today()
+	stock := domain.BuildSellableStock(lots, day)
+
+	if r.Header.Get("datastar-request") == "true" {
+		_ = middleware.TemplRender(r, pages.StockContent(middleware.BasePath(), day, stock))
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.StockPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			day,
+			stock,
+		),
+	)
+}
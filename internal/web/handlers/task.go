@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// taskCatchUpDays is how far back checklists are generated when nobody opened them, so
+// missed tasks still show up as overdue.
+const taskCatchUpDays = 7
+
+type TaskManager struct {
+	TaskRepo  data.TaskRepo
+	BarnRepo  data.BarnRepo
+	FlockRepo data.FlockRepo
+	StaffRepo data.StaffRepo
+}
+
+// RegisterTaskRoutes wires barn task template and daily checklist endpoints under /app.
+func RegisterTaskRoutes(group *ghttp.RouterGroup, taskRepo data.TaskRepo, barnRepo data.BarnRepo, flockRepo data.FlockRepo, staffRepo data.StaffRepo) {
+	tm := &TaskManager{
+		TaskRepo:  taskRepo,
+		BarnRepo:  barnRepo,
+		FlockRepo: flockRepo,
+		StaffRepo: staffRepo,
+	}
+
+	group.GET("/management/tasks", tm.ChecklistsGet)
+	group.POST("/management/tasks/:task_id/complete", tm.TaskCompletePost)
+	group.POST("/management/tasks/:task_id/skip", tm.TaskSkipPost)
+	group.POST("/management/tasks/:task_id/reopen", tm.TaskReopenPost)
+	group.POST("/management/tasks/:task_id/assign", tm.TaskAssignPost)
+
+	group.GET("/management/task-templates", tm.TaskTemplatesGet)
+	group.POST("/management/task-templates", tm.TaskTemplatePost)
+	group.POST("/management/task-templates/:template_id/active", tm.TaskTemplateActivePost)
+	group.DELETE("/management/task-templates/:template_id", tm.TaskTemplateDelete)
+}
+
+// generateChecklists makes sure the checklists of the last days up to today exist.
+func generateChecklists(ctx context.Context, taskRepo data.TaskRepo) error {
+	day := today()
+	return taskRepo.Generate(ctx, day.AddDate(0, 0, -taskCatchUpDays), day)
+}
+
+// checklistInterval is how often ScheduleChecklists makes sure today's checklists exist.
+const checklistInterval = 15 * time.Minute
+
+// ScheduleChecklists generates the checklists of every farm now and again every
+// checklistInterval until ctx is done, so overdue tasks reach the dashboard without anyone
+// opening the checklists first.
+func ScheduleChecklists(ctx context.Context, taskRepo data.TaskRepo, farmRepo data.FarmRepo) {
+	ticker := time.NewTicker(checklistInterval)
+	defer ticker.Stop()
+	for {
+		farmIDs, err := farmRepo.IDs(ctx)
+		if err != nil {
+			g.Log().Errorf(ctx, "list farms for checklists: %v", err)
+		}
+		for _, farmID := range farmIDs {
+			if err := generateChecklists(data.WithFarm(ctx, farmID), taskRepo); err != nil {
+				g.Log().Errorf(ctx, "generate checklists of farm %d: %v", farmID, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ChecklistsGet renders the barn checklists of a day with the tasks still open from earlier days.
+func (tm *TaskManager) ChecklistsGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	day := today()
+	if v := strings.TrimSpace(r.Get("date").String()); v != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			r.Response.WriteStatusExit(400, "Invalid date")
+			return
+		}
+		day = parsed
+	}
+
+	ctx := r.GetCtx()
+	if err := generateChecklists(ctx, tm.TaskRepo); err != nil {
+		g.Log().Errorf(ctx, "generate checklists: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	tasks, err := tm.TaskRepo.ListForDay(ctx, day)
+	if err != nil {
+		g.Log().Errorf(ctx, "list tasks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	earlier, err := tm.TaskRepo.ListOpen(ctx, day.AddDate(0, 0, -1))
+	if err != nil {
+		g.Log().Errorf(ctx, "list open tasks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	staff, err := tm.StaffRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list staff: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	page := &pages.ChecklistDay{
+		Day:        day,
+		Now:        time.Now(),
+		Checklists: domain.BuildChecklists(tasks),
+		Earlier:    earlier,
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.ChecklistsContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				page,
+				staff,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.ChecklistsPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			page,
+			staff,
+		),
+	)
+}
+
+// TaskCompletePost ticks a task off without a record.
+func (tm *TaskManager) TaskCompletePost(r *ghttp.Request) {
+	tm.settleTask(r, func(id, version int64) error {
+		return tm.TaskRepo.Complete(r.GetCtx(), id, nil, version, time.Now())
+	})
+}
+
+// TaskSkipPost marks a task as not needed today.
+func (tm *TaskManager) TaskSkipPost(r *ghttp.Request) {
+	tm.settleTask(r, func(id, version int64) error {
+		return tm.TaskRepo.Skip(r.GetCtx(), id, version, time.Now())
+	})
+}
+
+// TaskReopenPost puts a done or skipped task back on its checklist.
+func (tm *TaskManager) TaskReopenPost(r *ghttp.Request) {
+	tm.settleTask(r, func(id, version int64) error {
+		return tm.TaskRepo.Reopen(r.GetCtx(), id, version)
+	})
+}
+
+// TaskAssignPost hands a task to a staff member.
+func (tm *TaskManager) TaskAssignPost(r *ghttp.Request) {
+	tm.settleTask(r, func(id, version int64) error {
+		var staffID *int64
+		if v := strings.TrimSpace(r.Get("staff_id").String()); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+			staffID = &parsed
+		}
+		return tm.TaskRepo.Assign(r.GetCtx(), id, staffID, version)
+	})
+}
+
+// settleTask loads the task of the request, applies change at the version the checklist was
+// loaded with and returns to its checklist.
+func (tm *TaskManager) settleTask(r *ghttp.Request, change func(id, version int64) error) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("task_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid task ID")
+		return
+	}
+	task, err := tm.TaskRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Task not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "find task: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	errs := map[string]string{}
+	if err := change(id, r.Get("version").Int64()); err != nil {
+		switch {
+		case errors.Is(err, data.ErrConflict):
+			errs["form"] = staleFormMessage
+		case errors.Is(err, data.ErrNotFound):
+		default:
+			g.Log().Errorf(r.GetCtx(), "update task: %v", err)
+			r.Response.WriteStatusExit(500, "Internal server error")
+			return
+		}
+	}
+
+	writeResult(r, checklistURL(task.TaskDate), errs)
+}
+
+// TaskTemplatesGet renders the recurring task templates.
+func (tm *TaskManager) TaskTemplatesGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	ctx := r.GetCtx()
+	templates, err := tm.TaskRepo.ListTemplates(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list task templates: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	barns, err := tm.BarnRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list barns: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	flocks, err := tm.FlockRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list flocks: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	staff, err := tm.StaffRepo.List(ctx)
+	if err != nil {
+		g.Log().Errorf(ctx, "list staff: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.TaskTemplatesContent(
+				middleware.BasePath(),
+				middleware.CsrfToken(r),
+				templates,
+				barns,
+				flocks,
+				staff,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.TaskTemplatesPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			templates,
+			barns,
+			flocks,
+			staff,
+		),
+	)
+}
+
+// TaskTemplatePost adds a recurring task template.
+func (tm *TaskManager) TaskTemplatePost(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	name := strings.TrimSpace(r.Get("name").String())
+	kind := domain.TaskKind(r.Get("kind").String())
+	barnIDStr := strings.TrimSpace(r.Get("barn_id").String())
+	flockIDStr := strings.TrimSpace(r.Get("flock_id").String())
+	staffIDStr := strings.TrimSpace(r.Get("staff_id").String())
+	dueTime := strings.TrimSpace(r.Get("due_time").String())
+
+	errs := map[string]string{}
+	if name == "" {
+		errs["name"] = "Name is required"
+	}
+	if !slices.Contains(domain.TaskKinds, kind) {
+		errs["kind"] = "Choose how the task is recorded"
+	}
+	barnID, err := strconv.ParseInt(barnIDStr, 10, 64)
+	if err != nil {
+		errs["barn_id"] = "Barn is required"
+	}
+	var flockID *int64
+	if flockIDStr != "" {
+		id, err := strconv.ParseInt(flockIDStr, 10, 64)
+		if err != nil {
+			errs["flock_id"] = "Invalid flock"
+		}
+		flockID = &id
+	} else if kind != domain.TaskKindGeneral && kind != "" {
+		errs["flock_id"] = "Choose the flock the record is for"
+	}
+	var staffID *int64
+	if staffIDStr != "" {
+		id, err := strconv.ParseInt(staffIDStr, 10, 64)
+		if err != nil {
+			errs["staff_id"] = "Invalid staff member"
+		}
+		staffID = &id
+	}
+	if err := domain.ValidateClock(dueTime); err != nil {
+		errs["due_time"] = err.Error()
+	}
+	var weekdays domain.Weekdays
+	for _, v := range r.Get("weekdays").Strings() {
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 || d > 6 {
+			errs["weekdays"] = "Invalid weekday"
+			break
+		}
+		weekdays |= domain.WeekdaysOf(time.Weekday(d))
+	}
+
+	if len(errs) == 0 {
+		userIDStr := strconv.FormatInt(user.ID, 10)
+		tmpl := &domain.TaskTemplate{
+			Name:     name,
+			Kind:     kind,
+			BarnID:   barnID,
+			FlockID:  flockID,
+			StaffID:  staffID,
+			Weekdays: weekdays,
+			DueTime:  dueTime,
+			Notes:    optionalText(r, "notes"),
+			Active:   true,
+			Audit: domain.AuditFields{
+				CreatedBy: &userIDStr,
+				UpdatedBy: &userIDStr,
+			},
+		}
+		if _, err := tm.TaskRepo.CreateTemplate(r.GetCtx(), tmpl); err != nil {
+			g.Log().Errorf(r.GetCtx(), "create task template: %v", err)
+			errs["form"] = "Failed to create the task template"
+		}
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/task-templates", errs)
+}
+
+// TaskTemplateActivePost pauses or resumes a task template.
+func (tm *TaskManager) TaskTemplateActivePost(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("template_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid task template ID")
+		return
+	}
+	errs := map[string]string{}
+	if err := tm.TaskRepo.SetTemplateActive(r.GetCtx(), id, r.Get("active").Bool(), r.Get("version").Int64()); err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Task template not found")
+			return
+		}
+		if errors.Is(err, data.ErrConflict) {
+			errs["form"] = staleFormMessage
+			writeResult(r, middleware.BasePath()+"/management/task-templates", errs)
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "set task template active: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/task-templates", nil)
+}
+
+// TaskTemplateDelete removes a task template; tasks already on checklists stay.
+func (tm *TaskManager) TaskTemplateDelete(r *ghttp.Request) {
+	_, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("template_id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid task template ID")
+		return
+	}
+	if err := tm.TaskRepo.DeleteTemplate(r.GetCtx(), id, time.Now()); err != nil {
+		g.Log().Errorf(r.GetCtx(), "delete task template: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	writeResult(r, middleware.BasePath()+"/management/task-templates", nil)
+}
+
+// checklistURL is the checklists page of day.
+func checklistURL(day time.Time) string {
+	return fmt.Sprintf("%s/management/tasks?date=%s", middleware.BasePath(), day.Format("2006-01-02"))
+}
+
+// recordFormTask returns the open task a record form was opened from through ?task_id=, or nil.
+func recordFormTask(r *ghttp.Request, taskRepo data.TaskRepo, kind domain.TaskKind) *domain.Task {
+	id, err := strconv.ParseInt(r.Get("task_id").String(), 10, 64)
+	if err != nil {
+		return nil
+	}
+	task, err := taskRepo.FindByID(r.GetCtx(), id)
+	if err != nil {
+		if err != data.ErrNotFound {
+			g.Log().Errorf(r.GetCtx(), "find task: %v", err)
+		}
+		return nil
+	}
+	if task.Kind != kind || task.Status != domain.TaskOpen {
+		return nil
+	}
+	return task
+}
+
+// completeRecordTask marks the task a record was created from done, linking the record. It
+// returns the checklist to go back to, or "" when the record was not created from a task.
+func completeRecordTask(r *ghttp.Request, taskRepo data.TaskRepo, kind domain.TaskKind, recordID int64) string {
+	task := recordFormTask(r, taskRepo, kind)
+	if task == nil {
+		return ""
+	}
+	if err := taskRepo.Complete(r.GetCtx(), task.TaskID, &recordID, task.Audit.Version, time.Now()); err != nil && err != data.ErrNotFound {
+		g.Log().Errorf(r.GetCtx(), "complete task: %v", err)
+	}
+	return checklistURL(task.TaskDate)
+}
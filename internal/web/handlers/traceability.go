@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/pdf"
+	"github.com/cr1cr1/farm-manager/internal/web/middleware"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
+	"github.com/cr1cr1/farm-manager/internal/web/templates/pages"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+type TraceabilityManager struct {
+	TraceabilityRepo    data.TraceabilityRepo
+	ProductionBatchRepo data.ProductionBatchRepo
+	SlaughterRecordRepo data.SlaughterRecordRepo
+}
+
+// RegisterTraceabilityRoutes wires traceability and recall endpoints under /app.
+func RegisterTraceabilityRoutes(group *ghttp.RouterGroup, traceabilityRepo data.TraceabilityRepo, productionBatchRepo data.ProductionBatchRepo, slaughterRecordRepo data.SlaughterRecordRepo) {
+	tm := &TraceabilityManager{
+		TraceabilityRepo:    traceabilityRepo,
+		ProductionBatchRepo: productionBatchRepo,
+		SlaughterRecordRepo: slaughterRecordRepo,
+	}
+
+	// Traceability
+	group.GET("/management/traceability", tm.TraceabilityGet)
+	group.GET("/management/traceability/batches/:id", tm.BatchChainGet)
+	group.GET("/management/traceability/batches/:id/recall.json", tm.RecallJSONGet)
+	group.GET("/management/traceability/batches/:id/recall.pdf", tm.RecallPDFGet)
+}
+
+// TraceabilityGet renders the trace lookup page. A slaughter_id, order_item_id or
+// batch_id query parameter jumps straight to the chain of the matching batch.
+func (tm *TraceabilityManager) TraceabilityGet(r *ghttp.Request) {
+	user, ok := middleware.CurrentUser(r)
+	if !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	batchID, err := tm.resolveBatch(r)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Nothing to trace: the lot is unknown or not linked to a batch")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "resolve trace batch: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	if batchID != 0 {
+		tm.renderChain(r, batchID)
+		return
+	}
+
+	batches, err := tm.ProductionBatchRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list production batches: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	slaughterRecords, err := tm.SlaughterRecordRepo.List(r.GetCtx())
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "list slaughter records: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.TraceabilityContent(
+				middleware.BasePath(),
+				batches,
+				slaughterRecords,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.TraceabilityPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			batches,
+			slaughterRecords,
+		),
+	)
+}
+
+// BatchChainGet renders the backward and forward chain of a production batch.
+func (tm *TraceabilityManager) BatchChainGet(r *ghttp.Request) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid batch ID")
+		return
+	}
+	tm.renderChain(r, id)
+}
+
+// RecallJSONGet downloads the recall report of a batch as JSON.
+func (tm *TraceabilityManager) RecallJSONGet(r *ghttp.Request) {
+	report, ok := tm.recallReport(r)
+	if !ok {
+		return
+	}
+
+	body, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		g.Log().Errorf(r.GetCtx(), "encode recall report: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+	r.Response.Header().Set("Content-Type", "application/json")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("recall-batch-%d.json", report.Batch.BatchID)))
+	r.Response.Write(body)
+}
+
+// RecallPDFGet downloads the recall report of a batch as PDF.
+func (tm *TraceabilityManager) RecallPDFGet(r *ghttp.Request) {
+	report, ok := tm.recallReport(r)
+	if !ok {
+		return
+	}
+
+	r.Response.Header().Set("Content-Type", "application/pdf")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("recall-batch-%d.pdf", report.Batch.BatchID)))
+	r.Response.Write(recallPDF(report))
+}
+
+func (tm *TraceabilityManager) resolveBatch(r *ghttp.Request) (int64, error) {
+	parse := func(name string) (int64, bool) {
+		id, err := strconv.ParseInt(r.Get(name).String(), 10, 64)
+		return id, err == nil && id > 0
+	}
+	if id, ok := parse("batch_id"); ok {
+		return id, nil
+	}
+	if id, ok := parse("slaughter_id"); ok {
+		return tm.TraceabilityRepo.BatchForSlaughter(r.GetCtx(), id)
+	}
+	if id, ok := parse("order_item_id"); ok {
+		return tm.TraceabilityRepo.BatchForOrderItem(r.GetCtx(), id)
+	}
+	return 0, nil
+}
+
+func (tm *TraceabilityManager) renderChain(r *ghttp.Request, batchID int64) {
+	user, _ := middleware.CurrentUser(r)
+
+	chain, err := tm.TraceabilityRepo.BatchChain(r.GetCtx(), batchID)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Production batch not found")
+			return
+		}
+		g.Log().Errorf(r.GetCtx(), "traceability chain: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return
+	}
+
+	isDataStarRequest := r.Header.Get("datastar-request") == "true"
+	if isDataStarRequest {
+		_ = middleware.TemplRender(
+			r,
+			pages.TraceabilityChainContent(
+				middleware.BasePath(),
+				chain,
+			),
+		)
+		return
+	}
+
+	_ = middleware.TemplRender(
+		r,
+		pages.TraceabilityChainPage(
+			middleware.BasePath(),
+			middleware.CsrfToken(r),
+			user.Username,
+			ThemeToString(user.Theme),
+			chain,
+		),
+	)
+}
+
+func (tm *TraceabilityManager) recallReport(r *ghttp.Request) (*models.RecallReport, bool) {
+	if _, ok := middleware.CurrentUser(r); !ok {
+		r.Response.RedirectTo(middleware.BasePath() + "/login")
+		return nil, false
+	}
+
+	id, err := strconv.ParseInt(r.Get("id").String(), 10, 64)
+	if err != nil {
+		r.Response.WriteStatusExit(400, "Invalid batch ID")
+		return nil, false
+	}
+
+	chain, err := tm.TraceabilityRepo.BatchChain(r.GetCtx(), id)
+	if err != nil {
+		if err == data.ErrNotFound {
+			r.Response.WriteStatusExit(404, "Production batch not found")
+			return nil, false
+		}
+		g.Log().Errorf(r.GetCtx(), "traceability chain: %v", err)
+		r.Response.WriteStatusExit(500, "Internal server error")
+		return nil, false
+	}
+	return models.NewRecallReport(models.FarmProfileFromEnv(), chain, time.Now()), true
+}
+
+// recallPDF lays out a recall report for printing or sending to the authorities.
+func recallPDF(report *models.RecallReport) []byte {
+	doc := pdf.New(fmt.Sprintf("Recall report - batch %d", report.Batch.BatchID))
+	doc.Heading(report.Farm.Name)
+	if report.Farm.Address != "" {
+		doc.Text(report.Farm.Address)
+	}
+	if report.Farm.OrganicCertNumber != "" {
+		doc.Text("Organic certificate: " + report.Farm.OrganicCertNumber)
+	}
+	doc.Subheading(fmt.Sprintf("Recall report - production batch %d", report.Batch.BatchID))
+	doc.Text("Generated " + report.GeneratedAt.Format("2006-01-02 15:04"))
+	if report.Batch.DateReady != nil {
+		doc.Text("Batch ready " + report.Batch.DateReady.Format("2006-01-02"))
+	}
+
+	doc.Subheading("Origin")
+	if flock := report.Flock; flock != nil {
+		line := fmt.Sprintf("Flock #%d %s", flock.FlockID, flock.Breed)
+		if flock.HatchDate != nil {
+			line += ", hatched " + flock.HatchDate.Format("2006-01-02")
+		}
+		if flock.Barn != "" {
+			line += ", barn " + flock.Barn
+		}
+		if flock.BarnLocation != nil {
+			line += " (" + *flock.BarnLocation + ")"
+		}
+		doc.Text(line)
+	} else {
+		doc.Text("The flock of this batch is no longer on record.")
+	}
+
+	doc.Subheading("Feed lots")
+	feedRows := make([][]string, 0, len(report.FeedLots))
+	for _, lot := range report.FeedLots {
+		organic := "No"
+		if lot.OrganicCertified {
+			organic = "Yes"
+		}
+		feedRows = append(feedRows, []string{lot.FeedType, orDash(lot.LotNumber), organic, formatDatePtr(lot.FirstFed), formatDatePtr(lot.LastFed), strconv.FormatFloat(lot.TotalAmount, 'f', 2, 64)})
+	}
+	recallTable(doc, []pdf.Column{
+		{Header: "Feed type", Width: 0.26},
+		{Header: "Lot", Width: 0.18},
+		{Header: "Organic", Width: 0.1},
+		{Header: "First fed", Width: 0.15},
+		{Header: "Last fed", Width: 0.15},
+		{Header: "Amount", Width: 0.16, AlignRight: true},
+	}, feedRows)
+
+	doc.Subheading("Treatments and vaccinations")
+	treatmentRows := make([][]string, 0, len(report.Treatments))
+	for _, t := range report.Treatments {
+		treatmentRows = append(treatmentRows, []string{formatDatePtr(t.Date), derefOrDash(t.Treatments), derefOrDash(t.Vaccinations), derefOrDash(t.Notes)})
+	}
+	recallTable(doc, []pdf.Column{
+		{Header: "Date", Width: 0.15},
+		{Header: "Treatments", Width: 0.3},
+		{Header: "Vaccinations", Width: 0.25},
+		{Header: "Notes", Width: 0.3},
+	}, treatmentRows)
+
+	doc.Subheading("Slaughter lots")
+	slaughterRows := make([][]string, 0, len(report.Slaughters))
+	for _, s := range report.Slaughters {
+		slaughtered := "-"
+		if s.NumberSlaughtered != nil {
+			slaughtered = strconv.Itoa(*s.NumberSlaughtered)
+		}
+		meatYield := "-"
+		if s.MeatYield != nil {
+			meatYield = strconv.FormatFloat(*s.MeatYield, 'f', 2, 64)
+		}
+		slaughterRows = append(slaughterRows, []string{s.LotCode, formatDatePtr(s.Date), slaughtered, meatYield})
+	}
+	recallTable(doc, []pdf.Column{
+		{Header: "Lot", Width: 0.25},
+		{Header: "Date", Width: 0.25},
+		{Header: "Birds", Width: 0.25, AlignRight: true},
+		{Header: "Meat yield", Width: 0.25, AlignRight: true},
+	}, slaughterRows)
+
+	doc.Subheading("Deliveries")
+	deliveryRows := make([][]string, 0, len(report.Deliveries))
+	for _, d := range report.Deliveries {
+		quantity := "-"
+		if d.Quantity != nil {
+			quantity = strconv.FormatFloat(*d.Quantity, 'f', 2, 64)
+		}
+		deliveryRows = append(deliveryRows, []string{d.LotCode, fmt.Sprintf("#%d", d.OrderID), d.CustomerName, derefOrDash(d.Product), quantity, formatDatePtr(d.DeliveryDate)})
+	}
+	recallTable(doc, []pdf.Column{
+		{Header: "Lot", Width: 0.1},
+		{Header: "Order", Width: 0.1},
+		{Header: "Customer", Width: 0.24},
+		{Header: "Product", Width: 0.26},
+		{Header: "Qty", Width: 0.12, AlignRight: true},
+		{Header: "Delivered", Width: 0.18},
+	}, deliveryRows)
+
+	doc.Subheading(fmt.Sprintf("Customers to contact (%d)", len(report.Customers)))
+	customerRows := make([][]string, 0, len(report.Customers))
+	for _, c := range report.Customers {
+		customerRows = append(customerRows, []string{c.Name, derefOrDash(c.ContactInfo), derefOrDash(c.DeliveryAddress)})
+	}
+	recallTable(doc, []pdf.Column{
+		{Header: "Customer", Width: 0.3},
+		{Header: "Contact", Width: 0.3},
+		{Header: "Delivery address", Width: 0.4},
+	}, customerRows)
+
+	return doc.Bytes()
+}
+
+// recallTable writes a table, or a note when a section of the chain has no records.
+func recallTable(doc *pdf.Document, columns []pdf.Column, rows [][]string) {
+	if len(rows) == 0 {
+		doc.Text("None recorded.")
+		return
+	}
+	doc.Table(columns, rows)
+}
+
+func formatDatePtr(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
+
+func derefOrDash(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return orDash(*s)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"os"
+
+	"github.com/cr1cr1/farm-manager/internal/data"
+	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// SessionCustomerKey holds the signed-in portal account. It is separate from SessionUserKey, so
+// a customer session never grants staff access and a staff session never opens the portal.
+const SessionCustomerKey = "portal:account"
+
+// PortalBasePath returns the customer portal base path, defaulting to /portal.
+func PortalBasePath() string {
+	if v := os.Getenv("PORTAL_BASE_PATH"); v != "" {
+		return v
+	}
+	return "/portal"
+}
+
+// CurrentCustomer returns the portal account signed in on the session, if any.
+func CurrentCustomer(r *ghttp.Request) (*domain.CustomerAccount, bool) {
+	v := r.Session.MustGet(SessionCustomerKey)
+	if v == nil || v.IsNil() {
+		return nil, false
+	}
+
+	var account domain.CustomerAccount
+	if err := v.Scan(&account); err != nil {
+		return nil, false
+	}
+
+	return &account, true
+}
+
+// SetCustomerLoggedIn marks the session as signed in to the portal. The password hash is not kept.
+func SetCustomerLoggedIn(r *ghttp.Request, account *domain.CustomerAccount) {
+	stored := *account
+	stored.PasswordHash = ""
+	if err := r.Session.Set(SessionCustomerKey, stored); err != nil {
+		g.Log().Errorf(r.GetCtx(), "set session customer: %v", err)
+	}
+}
+
+// ClearCustomerLogin signs the portal account out of the session.
+func ClearCustomerLogin(r *ghttp.Request) {
+	r.Session.Remove(SessionCustomerKey)
+}
+
+// RequireCustomer redirects to the portal login when no customer is signed in. Signed-in
+// requests are scoped to the farm of the customer.
+func RequireCustomer() ghttp.HandlerFunc {
+	return func(r *ghttp.Request) {
+		account, ok := CurrentCustomer(r)
+		if !ok {
+			r.Response.Header().Set("Cache-Control", "no-store")
+			r.Response.RedirectTo(PortalBasePath() + "/login")
+			return
+		}
+		r.SetCtx(data.WithFarm(r.GetCtx(), account.FarmID))
+		r.Middleware.Next()
+	}
+}
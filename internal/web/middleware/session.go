@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"net/http"
 	"os"
+	"strconv"
 
+	"github.com/cr1cr1/farm-manager/internal/data"
 	"github.com/cr1cr1/farm-manager/internal/domain"
+	"github.com/cr1cr1/farm-manager/internal/web/models"
 	"github.com/gogf/gf/v2/frame/g"
 	"github.com/gogf/gf/v2/net/ghttp"
 )
@@ -46,17 +50,54 @@ func SetLoggedIn(r *ghttp.Request, user *domain.User) {
 // ClearLogin removes login information from the session.
 func ClearLogin(r *ghttp.Request) {
 	r.Session.Remove(SessionUserKey)
+	r.Session.Remove(SessionFarmKey)
 }
 
-// RequireAuth redirects to /app/login (or APP_BASE_PATH/login) when not authenticated.
-func RequireAuth() ghttp.HandlerFunc {
+// SessionFarmKey holds the farm the signed-in user is working on.
+const SessionFarmKey = "auth:farm"
+
+// SetActiveFarm switches the session to another farm; RequireAuth checks the user belongs to it.
+func SetActiveFarm(r *ghttp.Request, farmID int64) {
+	if err := r.Session.Set(SessionFarmKey, farmID); err != nil {
+		g.Log().Errorf(r.GetCtx(), "set session farm: %v", err)
+	}
+}
+
+// RequireAuth redirects to /app/login (or APP_BASE_PATH/login) when not authenticated. Signed-in
+// requests carry the user as the actor of their writes and are scoped to the farm the user is
+// working on: the one chosen in the session, or else the first they belong to. A user who
+// belongs to no farm is refused.
+func RequireAuth(farms data.FarmRepo) ghttp.HandlerFunc {
 	return func(r *ghttp.Request) {
-		if _, ok := CurrentUser(r); !ok {
+		user, ok := CurrentUser(r)
+		if !ok {
 			// Ensure no caching on redirect responses.
 			r.Response.Header().Set("Cache-Control", "no-store")
 			r.Response.RedirectTo(BasePath() + "/login")
 			return
 		}
+		memberships, err := farms.Memberships(r.GetCtx(), user.ID)
+		if err != nil {
+			g.Log().Errorf(r.GetCtx(), "load farm memberships: %v", err)
+			r.Response.WriteStatus(http.StatusInternalServerError)
+			return
+		}
+		if len(memberships) == 0 {
+			r.Response.WriteStatus(http.StatusForbidden)
+			r.Response.Write("Forbidden: you do not belong to any farm")
+			return
+		}
+
+		access := models.FarmAccess{Active: memberships[0], Memberships: memberships}
+		if chosen := r.Session.MustGet(SessionFarmKey).Int64(); chosen != 0 {
+			if m, ok := access.Membership(chosen); ok {
+				access.Active = m
+			}
+		}
+
+		ctx := data.WithActor(r.GetCtx(), strconv.FormatInt(user.ID, 10))
+		ctx = data.WithFarm(ctx, access.Active.FarmID)
+		r.SetCtx(models.WithFarmAccess(ctx, access))
 		r.Middleware.Next()
 	}
 }
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// SSEStart turns the response into a server-sent event stream for Datastar. The headers are
+// flushed straight away so the browser sees the stream open before the first event.
+func SSEStart(r *ghttp.Request) {
+	r.Response.Header().Set("Content-Type", "text/event-stream")
+	r.Response.Header().Set("Cache-Control", "no-cache")
+	r.Response.Header().Set("Connection", "keep-alive")
+	r.Response.Header().Set("X-Accel-Buffering", "no")
+	r.Response.WriteHeader(200)
+	r.Response.Flush()
+}
+
+// SSEPatchElements renders the component and sends it as a Datastar patch-elements event (the
+// merge-fragments event of Datastar before v1), which morphs the rendered elements into the page
+// by their id.
+func SSEPatchElements(r *ghttp.Request, component templ.Component) error {
+	var buf bytes.Buffer
+	if err := component.Render(r.GetCtx(), &buf); err != nil {
+		return err
+	}
+
+	var event strings.Builder
+	event.WriteString("event: datastar-patch-elements\n")
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		event.WriteString("data: elements ")
+		event.WriteString(line)
+		event.WriteString("\n")
+	}
+	event.WriteString("\n")
+
+	r.Response.Write(event.String())
+	r.Response.Flush()
+	return r.GetCtx().Err()
+}
+
+// SSEPatchSignals sends a Datastar patch-signals event merging the signals into the page's.
+func SSEPatchSignals(r *ghttp.Request, signals any) error {
+	b, err := json.Marshal(signals)
+	if err != nil {
+		return err
+	}
+	r.Response.Write("event: datastar-patch-signals\ndata: signals " + string(b) + "\n\n")
+	r.Response.Flush()
+	return r.GetCtx().Err()
+}
@@ -1,18 +1,32 @@
 package models
 
-// DashboardCounts holds the count data for the dashboard
-type DashboardCounts struct {
-	Barns             int64
-	FeedTypes         int64
-	Staff             int64
-	Flocks            int64
-	FeedingRecords    int64
-	HealthChecks      int64
-	MortalityRecords  int64
-	ProductionBatches int64
-	SlaughterRecords  int64
-	InventoryItems    int64
-	Customers         int64
-	Orders            int64
-	OrderItems        int64
+import (
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// DashboardWidgets holds the data of the operational dashboard widgets
+type DashboardWidgets struct {
+	// Barns are the live birds per barn against capacity
+	Barns []*domain.BarnOccupancy
+	// Mortality is the daily mortality of the last seven days, oldest first
+	Mortality []domain.MortalityDay
+	// Feed is the feed given today per flock against its daily ration
+	Feed []*domain.FlockFeed
+	// Batches are the production batches due for slaughter soon or overdue
+	Batches []*domain.ProductionBatch
+	// OpenOrders is the number of open orders per status
+	OpenOrders []*domain.OrderStatusCount
+	// LowStock are the inventory items at or below their reorder level
+	LowStock []*domain.InventoryItem
+	// OverdueHealthChecks are the open health check tasks past their due time
+	OverdueHealthChecks []*domain.Task
+	// OverdueTasks are the other open barn tasks past their due time, oldest first
+	OverdueTasks []*domain.Task
+
+	// Today is the day the widgets were computed for
+	Today time.Time
+	// UpdatedAt is when the widgets were computed
+	UpdatedAt time.Time
 }
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// FarmProfile holds the farm letterhead details printed on reports and documents
+type FarmProfile struct {
+	Name              string
+	Address           string
+	OrganicCertNumber string
+	CertificationBody string
+	VATNumber         string
+	BankAccount       string
+	// PaymentTermsDays is the number of days between issuing an invoice and its due date.
+	PaymentTermsDays int
+	// FiscalYearStart is the first month of the fiscal year invoices are numbered in.
+	FiscalYearStart time.Month
+	// Latitude and Longitude locate the farm, where delivery runs start and end. Nil when unset.
+	Latitude  *float64
+	Longitude *float64
+	// MinDailyRest is the rest staff must get in every 24 hours; the roster refuses shifts
+	// that cut into it.
+	MinDailyRest time.Duration
+}
+
+// FarmProfileFromEnv reads the farm letterhead from env:
+// - FARM_NAME (default "Farm Manager")
+// - FARM_ADDRESS
+// - ORGANIC_CERT_NUMBER
+// - ORGANIC_CERT_BODY
+// - FARM_VAT_NUMBER
+// - FARM_BANK_ACCOUNT
+// - INVOICE_PAYMENT_TERMS_DAYS (default 30)
+// - FISCAL_YEAR_START_MONTH (1-12, default 1)
+// - FARM_LATITUDE, FARM_LONGITUDE (decimal degrees, both or neither)
+// - ROSTER_MIN_REST_HOURS (default 11, lower only where an agricultural derogation applies)
+func FarmProfileFromEnv() FarmProfile {
+	name := os.Getenv("FARM_NAME")
+	if name == "" {
+		name = "Farm Manager"
+	}
+	terms, err := strconv.Atoi(os.Getenv("INVOICE_PAYMENT_TERMS_DAYS"))
+	if err != nil || terms < 0 {
+		terms = 30
+	}
+	startMonth, err := strconv.Atoi(os.Getenv("FISCAL_YEAR_START_MONTH"))
+	if err != nil || startMonth < 1 || startMonth > 12 {
+		startMonth = 1
+	}
+	restHours, err := strconv.ParseFloat(os.Getenv("ROSTER_MIN_REST_HOURS"), 64)
+	if err != nil || restHours < 0 || restHours > 24 {
+		restHours = domain.MinRestBetweenShifts.Hours()
+	}
+	farm := FarmProfile{
+		Name:              name,
+		Address:           os.Getenv("FARM_ADDRESS"),
+		OrganicCertNumber: os.Getenv("ORGANIC_CERT_NUMBER"),
+		CertificationBody: os.Getenv("ORGANIC_CERT_BODY"),
+		VATNumber:         os.Getenv("FARM_VAT_NUMBER"),
+		BankAccount:       os.Getenv("FARM_BANK_ACCOUNT"),
+		PaymentTermsDays:  terms,
+		FiscalYearStart:   time.Month(startMonth),
+		MinDailyRest:      time.Duration(restHours * float64(time.Hour)),
+	}
+	lat, latErr := strconv.ParseFloat(os.Getenv("FARM_LATITUDE"), 64)
+	lng, lngErr := strconv.ParseFloat(os.Getenv("FARM_LONGITUDE"), 64)
+	if latErr == nil && lngErr == nil {
+		farm.Latitude, farm.Longitude = &lat, &lng
+	}
+	return farm
+}
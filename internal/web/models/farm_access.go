@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// FarmAccess is what the signed-in user may reach: the farm they are working on and every farm
+// they belong to, for the switcher in the header.
+type FarmAccess struct {
+	Active      *domain.FarmMembership
+	Memberships []*domain.FarmMembership
+}
+
+// Can reports whether the user's role on the active farm grants everything min does.
+func (a FarmAccess) Can(min domain.FarmRole) bool {
+	return a.Active != nil && a.Active.Role.AtLeast(min)
+}
+
+// Membership returns the user's membership of a farm, if they have one.
+func (a FarmAccess) Membership(farmID int64) (*domain.FarmMembership, bool) {
+	for _, m := range a.Memberships {
+		if m.FarmID == farmID {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// Owned returns the IDs of the farms the user owns.
+func (a FarmAccess) Owned() []int64 {
+	var ids []int64
+	for _, m := range a.Memberships {
+		if m.Role == domain.FarmRoleOwner {
+			ids = append(ids, m.FarmID)
+		}
+	}
+	return ids
+}
+
+type farmAccessKey struct{}
+
+// WithFarmAccess returns a context carrying the user's farm access.
+func WithFarmAccess(ctx context.Context, a FarmAccess) context.Context {
+	return context.WithValue(ctx, farmAccessKey{}, a)
+}
+
+// FarmAccessFrom returns the farm access ctx carries; the zero value when it carries none.
+func FarmAccessFrom(ctx context.Context) FarmAccess {
+	a, _ := ctx.Value(farmAccessKey{}).(FarmAccess)
+	return a
+}
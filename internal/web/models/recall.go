@@ -0,0 +1,176 @@
+package models
+
+import (
+	"time"
+
+	"github.com/cr1cr1/farm-manager/internal/domain"
+)
+
+// RecallReport is the exported hatchery-to-customer chain of one production batch
+type RecallReport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Farm        RecallFarm        `json:"farm"`
+	Batch       RecallBatch       `json:"batch"`
+	Flock       *RecallFlock      `json:"flock,omitempty"`
+	FeedLots    []RecallFeedLot   `json:"feed_lots"`
+	Treatments  []RecallTreatment `json:"treatments"`
+	Slaughters  []RecallSlaughter `json:"slaughter_lots"`
+	Deliveries  []RecallDelivery  `json:"deliveries"`
+	Customers   []RecallCustomer  `json:"customers"`
+}
+
+type RecallFarm struct {
+	Name              string `json:"name"`
+	Address           string `json:"address,omitempty"`
+	OrganicCertNumber string `json:"organic_cert_number,omitempty"`
+}
+
+type RecallBatch struct {
+	BatchID        int64      `json:"batch_id"`
+	DateReady      *time.Time `json:"date_ready,omitempty"`
+	NumberInBatch  *int       `json:"number_in_batch,omitempty"`
+	WeightEstimate *float64   `json:"weight_estimate,omitempty"`
+	Notes          *string    `json:"notes,omitempty"`
+}
+
+type RecallFlock struct {
+	FlockID       int64      `json:"flock_id"`
+	Breed         string     `json:"breed"`
+	HatchDate     *time.Time `json:"hatch_date,omitempty"`
+	NumberOfBirds *int       `json:"number_of_birds,omitempty"`
+	Barn          string     `json:"barn,omitempty"`
+	BarnLocation  *string    `json:"barn_location,omitempty"`
+}
+
+type RecallFeedLot struct {
+	FeedType         string     `json:"feed_type"`
+	OrganicCertified bool       `json:"organic_certified"`
+	LotNumber        string     `json:"lot_number,omitempty"`
+	TotalAmount      float64    `json:"total_amount"`
+	FirstFed         *time.Time `json:"first_fed,omitempty"`
+	LastFed          *time.Time `json:"last_fed,omitempty"`
+}
+
+type RecallTreatment struct {
+	HealthCheckID int64      `json:"health_check_id"`
+	Date          *time.Time `json:"date,omitempty"`
+	Treatments    *string    `json:"treatments,omitempty"`
+	Vaccinations  *string    `json:"vaccinations,omitempty"`
+	Notes         *string    `json:"notes,omitempty"`
+}
+
+type RecallSlaughter struct {
+	LotCode           string     `json:"lot_code"`
+	SlaughterID       int64      `json:"slaughter_id"`
+	Date              *time.Time `json:"date,omitempty"`
+	NumberSlaughtered *int       `json:"number_slaughtered,omitempty"`
+	MeatYield         *float64   `json:"meat_yield,omitempty"`
+}
+
+type RecallDelivery struct {
+	LotCode      string     `json:"lot_code"`
+	OrderID      int64      `json:"order_id"`
+	OrderItemID  int64      `json:"order_item_id"`
+	CustomerID   int64      `json:"customer_id"`
+	CustomerName string     `json:"customer_name"`
+	Product      *string    `json:"product,omitempty"`
+	Quantity     *float64   `json:"quantity,omitempty"`
+	OrderDate    *time.Time `json:"order_date,omitempty"`
+	DeliveryDate *time.Time `json:"delivery_date,omitempty"`
+}
+
+// RecallCustomer is a customer to contact in a recall
+type RecallCustomer struct {
+	CustomerID      int64   `json:"customer_id"`
+	Name            string  `json:"name"`
+	ContactInfo     *string `json:"contact_info,omitempty"`
+	DeliveryAddress *string `json:"delivery_address,omitempty"`
+}
+
+// NewRecallReport flattens a traceability chain for export
+func NewRecallReport(farm FarmProfile, chain *domain.TraceabilityChain, generatedAt time.Time) *RecallReport {
+	report := &RecallReport{
+		GeneratedAt: generatedAt,
+		Farm: RecallFarm{
+			Name:              farm.Name,
+			Address:           farm.Address,
+			OrganicCertNumber: farm.OrganicCertNumber,
+		},
+		Batch: RecallBatch{
+			BatchID:        chain.Batch.BatchID,
+			DateReady:      chain.Batch.DateReady,
+			NumberInBatch:  chain.Batch.NumberInBatch,
+			WeightEstimate: chain.Batch.WeightEstimate,
+			Notes:          chain.Batch.Notes,
+		},
+		FeedLots:   []RecallFeedLot{},
+		Treatments: []RecallTreatment{},
+		Slaughters: []RecallSlaughter{},
+		Deliveries: []RecallDelivery{},
+		Customers:  []RecallCustomer{},
+	}
+
+	if flock := chain.Flock; flock != nil {
+		report.Flock = &RecallFlock{
+			FlockID:       flock.FlockID,
+			Breed:         flock.Breed,
+			HatchDate:     flock.HatchDate,
+			NumberOfBirds: flock.NumberOfBirds,
+		}
+		if flock.Barn != nil {
+			report.Flock.Barn = flock.Barn.Name
+			report.Flock.BarnLocation = flock.Barn.Location
+		}
+	}
+	for _, lot := range chain.FeedLots() {
+		report.FeedLots = append(report.FeedLots, RecallFeedLot{
+			FeedType:         lot.FeedTypeName,
+			OrganicCertified: lot.OrganicCertified,
+			LotNumber:        lot.LotNumber,
+			TotalAmount:      lot.TotalAmount,
+			FirstFed:         lot.FirstFed,
+			LastFed:          lot.LastFed,
+		})
+	}
+	for _, check := range chain.Treatments() {
+		report.Treatments = append(report.Treatments, RecallTreatment{
+			HealthCheckID: check.HealthCheckID,
+			Date:          check.CheckDate,
+			Treatments:    check.TreatmentsAdministered,
+			Vaccinations:  check.VaccinationsGiven,
+			Notes:         check.Notes,
+		})
+	}
+	for _, slaughter := range chain.SlaughterRecords {
+		report.Slaughters = append(report.Slaughters, RecallSlaughter{
+			LotCode:           domain.SlaughterLotCode(slaughter.SlaughterID),
+			SlaughterID:       slaughter.SlaughterID,
+			Date:              slaughter.Date,
+			NumberSlaughtered: slaughter.NumberSlaughtered,
+			MeatYield:         slaughter.MeatYield,
+		})
+	}
+	for _, delivery := range chain.Deliveries {
+		item := delivery.OrderItem
+		report.Deliveries = append(report.Deliveries, RecallDelivery{
+			LotCode:      domain.SlaughterLotCode(*item.SlaughterID),
+			OrderID:      delivery.Order.OrderID,
+			OrderItemID:  item.OrderItemID,
+			CustomerID:   delivery.Customer.CustomerID,
+			CustomerName: delivery.Customer.Name,
+			Product:      item.ProductDescription,
+			Quantity:     item.Quantity,
+			OrderDate:    delivery.Order.OrderDate,
+			DeliveryDate: delivery.Order.DeliveryDate,
+		})
+	}
+	for _, customer := range chain.Customers() {
+		report.Customers = append(report.Customers, RecallCustomer{
+			CustomerID:      customer.CustomerID,
+			Name:            customer.Name,
+			ContactInfo:     customer.ContactInfo,
+			DeliveryAddress: customer.DeliveryAddress,
+		})
+	}
+	return report
+}
@@ -26,4 +26,59 @@
     }
     return originalFetch.call(this, input, init);
   };
+
+  // Signature pads: a <canvas data-signature-for="input-id"> writes what is drawn on it into the
+  // hidden input as a PNG data URL; a button with data-signature-clear="canvas-id" wipes it.
+  // Delegated on the document so pads swapped in by DataStar work without re-binding.
+  let drawing = null;
+
+  function padPoint(canvas, e) {
+    const rect = canvas.getBoundingClientRect();
+    return {
+      x: (e.clientX - rect.left) * (canvas.width / rect.width),
+      y: (e.clientY - rect.top) * (canvas.height / rect.height),
+    };
+  }
+
+  document.addEventListener("pointerdown", function (e) {
+    const canvas = e.target.closest && e.target.closest("canvas[data-signature-for]");
+    if (!canvas) return;
+    e.preventDefault();
+    canvas.setPointerCapture(e.pointerId);
+    const ctx = canvas.getContext("2d");
+    ctx.lineWidth = 2.5;
+    ctx.lineCap = "round";
+    ctx.strokeStyle = "#000";
+    const p = padPoint(canvas, e);
+    ctx.beginPath();
+    ctx.moveTo(p.x, p.y);
+    drawing = canvas;
+  });
+
+  document.addEventListener("pointermove", function (e) {
+    if (!drawing) return;
+    const ctx = drawing.getContext("2d");
+    const p = padPoint(drawing, e);
+    ctx.lineTo(p.x, p.y);
+    ctx.stroke();
+  });
+
+  function endStroke() {
+    if (!drawing) return;
+    const input = document.getElementById(drawing.dataset.signatureFor);
+    if (input) input.value = drawing.toDataURL("image/png");
+    drawing = null;
+  }
+  document.addEventListener("pointerup", endStroke);
+  document.addEventListener("pointercancel", endStroke);
+
+  document.addEventListener("click", function (e) {
+    const button = e.target.closest && e.target.closest("[data-signature-clear]");
+    if (!button) return;
+    const canvas = document.getElementById(button.dataset.signatureClear);
+    if (!canvas) return;
+    canvas.getContext("2d").clearRect(0, 0, canvas.width, canvas.height);
+    const input = document.getElementById(canvas.dataset.signatureFor);
+    if (input) input.value = "";
+  });
 })();